@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var aliasFlags struct {
+	clientConfig
+}
+
+var aliasCmd = &cobra.Command{
+	Use:   "alias <token> [alias...]",
+	Short: "Replace a token's subdomain aliases",
+	Long: `Replace the subdomain aliases of an existing token. Interactions with
+<alias>.<domain> are recorded against the token. Omit the aliases to remove them.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runAlias,
+}
+
+func init() {
+	rootCmd.AddCommand(aliasCmd)
+
+	addClientFlags(aliasCmd, &aliasFlags.clientConfig)
+}
+
+func runAlias(cmd *cobra.Command, args []string) error {
+	c, err := aliasFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	info, err := c.SetTokenAliases(context.Background(), args[0], args[1:])
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
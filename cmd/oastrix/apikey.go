@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rsclarke/oastrix/internal/auth"
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var apikeyFlags struct {
+	pepperConfig
+	dbPath     string
+	name       string
+	scope      string
+	allowCIDRs []string
+}
+
+var apikeyCmd = &cobra.Command{
+	Use:   "apikey",
+	Short: "Manage API keys",
+	Long: `Manage API keys directly in the server database.
+
+These commands operate on the local database file and do not go through
+the API, so they must be run on the server host.`,
+}
+
+var apikeyCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a new API key",
+	Long: `Create a new API key and print it. The key is shown only once.
+
+Scopes:
+  admin → as full, plus server-wide plugin config, log levels, stray
+          interactions and purges across every token
+  full  → create, list, purge, and delete tokens
+  read  → list tokens and fetch interactions only`,
+	Args: cobra.NoArgs,
+	RunE: runAPIKeyCreate,
+}
+
+var apikeyAllowlistCmd = &cobra.Command{
+	Use:   "allowlist <prefix> [cidr...]",
+	Short: "Restrict the source addresses an API key may be used from",
+	Long: `Replace the IP allowlist of an API key. Entries may be CIDR ranges or
+single addresses. Omit all entries to remove the restriction.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runAPIKeyAllowlist,
+}
+
+var apikeyBindCertCmd = &cobra.Command{
+	Use:   "bind-cert <prefix> [common-name]",
+	Short: "Authenticate an API key with a client certificate",
+	Long: `Bind a client certificate subject common name to an API key. When the
+server runs with --api-client-ca, requests presenting a verified certificate
+with this common name act as the key without a bearer token. Omit the common
+name to remove the binding.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runAPIKeyBindCert,
+}
+
+var apikeyRevokeCmd = &cobra.Command{
+	Use:   "revoke <prefix>",
+	Short: "Revoke an API key",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runAPIKeyRevoke,
+}
+
+var apikeyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API keys",
+	Args:  cobra.NoArgs,
+	RunE:  runAPIKeyList,
+}
+
+func init() {
+	rootCmd.AddCommand(apikeyCmd)
+	apikeyCmd.AddCommand(apikeyCreateCmd)
+	apikeyCmd.AddCommand(apikeyListCmd)
+	apikeyCmd.AddCommand(apikeyAllowlistCmd)
+	apikeyCmd.AddCommand(apikeyRevokeCmd)
+	apikeyCmd.AddCommand(apikeyBindCertCmd)
+
+	apikeyCmd.PersistentFlags().StringVar(&apikeyFlags.dbPath, "db", getEnv("OASTRIX_DB", "oastrix.db"), "database path")
+	addPepperFlags(apikeyCreateCmd, &apikeyFlags.pepperConfig)
+	apikeyCreateCmd.Flags().StringVar(&apikeyFlags.name, "name", "", "human-readable name for the key (e.g. \"alice laptop\")")
+	apikeyCreateCmd.Flags().StringVar(&apikeyFlags.scope, "scope", string(auth.ScopeFull), "key scope (read, full or admin)")
+	apikeyCreateCmd.Flags().StringSliceVar(&apikeyFlags.allowCIDRs, "allow-cidr", nil, "restrict the key to these CIDR ranges (repeatable)")
+}
+
+func runAPIKeyCreate(cmd *cobra.Command, args []string) error {
+	scope, err := auth.ParseScope(apikeyFlags.scope)
+	if err != nil {
+		return err
+	}
+	if _, err := auth.ParseAllowlist(apikeyFlags.allowCIDRs); err != nil {
+		return err
+	}
+
+	pepper, err := apikeyFlags.load(apikeyFlags.dbPath, false)
+	if err != nil {
+		return fmt.Errorf("load pepper: %w", err)
+	}
+
+	database, err := db.Open(apikeyFlags.dbPath)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	displayKey, prefix, hash, err := auth.GenerateAPIKey(pepper)
+	if err != nil {
+		return fmt.Errorf("generate API key: %w", err)
+	}
+	var namePtr *string
+	if apikeyFlags.name != "" {
+		namePtr = &apikeyFlags.name
+	}
+
+	id, err := db.CreateAPIKey(database, prefix, hash, string(scope), namePtr)
+	if err != nil {
+		return fmt.Errorf("create API key: %w", err)
+	}
+	if err := db.SetAPIKeyAllowlist(database, id, apikeyFlags.allowCIDRs); err != nil {
+		return fmt.Errorf("set allowlist: %w", err)
+	}
+
+	result := struct {
+		APIKey       string   `json:"api_key"`
+		Prefix       string   `json:"prefix"`
+		Name         *string  `json:"name"`
+		Scope        string   `json:"scope"`
+		AllowedCIDRs []string `json:"allowed_cidrs,omitempty"`
+	}{
+		APIKey:       displayKey,
+		Prefix:       prefix,
+		Name:         namePtr,
+		Scope:        string(scope),
+		AllowedCIDRs: apikeyFlags.allowCIDRs,
+	}
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
+
+type apiKeyInfo struct {
+	ID           int64    `json:"id"`
+	Prefix       string   `json:"prefix"`
+	Name         *string  `json:"name"`
+	Scope        string   `json:"scope"`
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"`
+	ClientCert   *string  `json:"client_cert,omitempty"`
+	CreatedAt    string   `json:"created_at"`
+	LastUsedAt   *string  `json:"last_used_at"`
+	LastUsedIP   *string  `json:"last_used_ip"`
+	RevokedAt    *string  `json:"revoked_at,omitempty"`
+}
+
+func runAPIKeyList(cmd *cobra.Command, args []string) error {
+	database, err := db.Open(apikeyFlags.dbPath)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	keys, err := db.ListAPIKeys(database)
+	if err != nil {
+		return fmt.Errorf("list API keys: %w", err)
+	}
+
+	infos := make([]apiKeyInfo, 0, len(keys))
+	for _, k := range keys {
+		info := apiKeyInfo{
+			ID:           k.ID,
+			Prefix:       k.KeyPrefix,
+			Name:         k.Name,
+			Scope:        k.Scope,
+			AllowedCIDRs: k.AllowedCIDRs,
+			ClientCert:   k.ClientCertSubject,
+			CreatedAt:    formatUnix(k.CreatedAt),
+			LastUsedIP:   k.LastUsedIP,
+		}
+		if k.LastUsedAt != nil {
+			lastUsedAt := formatUnix(*k.LastUsedAt)
+			info.LastUsedAt = &lastUsedAt
+		}
+		if k.RevokedAt != nil {
+			revokedAt := formatUnix(*k.RevokedAt)
+			info.RevokedAt = &revokedAt
+		}
+		infos = append(infos, info)
+	}
+
+	b, err := json.MarshalIndent(struct {
+		Keys []apiKeyInfo `json:"keys"`
+	}{Keys: infos}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
+
+func runAPIKeyAllowlist(cmd *cobra.Command, args []string) error {
+	prefix, cidrs := args[0], args[1:]
+	if _, err := auth.ParseAllowlist(cidrs); err != nil {
+		return err
+	}
+
+	database, err := db.Open(apikeyFlags.dbPath)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	key, err := db.GetAPIKeyByPrefix(database, prefix)
+	if err != nil {
+		return fmt.Errorf("get API key: %w", err)
+	}
+	if key == nil {
+		return fmt.Errorf("API key %q not found", prefix)
+	}
+
+	if err := db.SetAPIKeyAllowlist(database, key.ID, cidrs); err != nil {
+		return fmt.Errorf("set allowlist: %w", err)
+	}
+
+	b, err := json.MarshalIndent(struct {
+		Prefix       string   `json:"prefix"`
+		AllowedCIDRs []string `json:"allowed_cidrs"`
+	}{Prefix: prefix, AllowedCIDRs: cidrs}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
+
+func runAPIKeyBindCert(cmd *cobra.Command, args []string) error {
+	prefix := args[0]
+	var subject *string
+	if len(args) == 2 {
+		subject = &args[1]
+	}
+
+	database, err := db.Open(apikeyFlags.dbPath)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	key, err := db.GetAPIKeyByPrefix(database, prefix)
+	if err != nil {
+		return fmt.Errorf("get API key: %w", err)
+	}
+	if key == nil {
+		return fmt.Errorf("API key %q not found", prefix)
+	}
+
+	if err := db.SetAPIKeyClientCert(database, key.ID, subject); err != nil {
+		return fmt.Errorf("bind client certificate: %w", err)
+	}
+
+	b, err := json.MarshalIndent(struct {
+		Prefix     string  `json:"prefix"`
+		ClientCert *string `json:"client_cert"`
+	}{Prefix: prefix, ClientCert: subject}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
+
+func runAPIKeyRevoke(cmd *cobra.Command, args []string) error {
+	prefix := args[0]
+
+	database, err := db.Open(apikeyFlags.dbPath)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	key, err := db.GetAPIKeyByPrefix(database, prefix)
+	if err != nil {
+		return fmt.Errorf("get API key: %w", err)
+	}
+	if key == nil {
+		return fmt.Errorf("API key %q not found", prefix)
+	}
+
+	revoked, err := db.RevokeAPIKey(database, key.ID)
+	if err != nil {
+		return fmt.Errorf("revoke API key: %w", err)
+	}
+	if !revoked {
+		return fmt.Errorf("API key %q is already revoked", prefix)
+	}
+
+	b, err := json.MarshalIndent(struct {
+		Prefix  string `json:"prefix"`
+		Revoked bool   `json:"revoked"`
+	}{Prefix: prefix, Revoked: true}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
+
+func formatUnix(ts int64) string {
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
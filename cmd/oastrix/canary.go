@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/plugins/canary"
+	"github.com/spf13/cobra"
+)
+
+var canaryFlags struct {
+	clientConfig
+	memo    string
+	context map[string]string
+	ttl     string
+}
+
+var canaryCmd = &cobra.Command{
+	Use:   "canary <web|dns|email>",
+	Short: "Create a canary token",
+	Long: `Create a canary token and print the artifact to plant.
+
+A web canary is a tracking URL, a dns canary a hostname and an email canary
+an address whose domain mail servers look up when mail is sent to it. Every
+interaction with the token is recorded with a canary attribute holding the
+memo and context, so an alert says which artifact was touched. Plant the
+artifact where only an intruder would come across it.
+
+The server must be started with --canary.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{canary.TypeWeb, canary.TypeDNS, canary.TypeEmail},
+	RunE:      runCanary,
+}
+
+func init() {
+	rootCmd.AddCommand(canaryCmd)
+
+	addClientFlags(canaryCmd, &canaryFlags.clientConfig)
+	canaryCmd.Flags().StringVar(&canaryFlags.memo, "memo", "", "where the artifact is planted, shown with every alert (required)")
+	canaryCmd.Flags().StringToStringVar(&canaryFlags.context, "context", nil, "`key=value` recorded with the canary, e.g. host=fileserver01 (repeatable)")
+	canaryCmd.Flags().StringVar(&canaryFlags.ttl, "ttl", "", "expire the canary after this duration, e.g. 8760h")
+	_ = canaryCmd.MarkFlagRequired("memo")
+}
+
+func runCanary(cmd *cobra.Command, args []string) error {
+	cfg := canary.Config{Type: args[0], Memo: canaryFlags.memo, Context: canaryFlags.context}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	c, err := canaryFlags.newClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	tok, err := c.CreateToken(ctx, apitypes.CreateTokenRequest{
+		Tags: []string{canary.ID},
+		TTL:  canaryFlags.ttl,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := c.SetTokenPluginConfig(ctx, tok.Token, canary.ID, raw); err != nil {
+		// Leave no token behind that would not raise alerts.
+		_ = c.DeleteToken(ctx, tok.Token)
+		return err
+	}
+
+	result := struct {
+		Token     string  `json:"token"`
+		Type      string  `json:"type"`
+		Memo      string  `json:"memo"`
+		Artifact  string  `json:"artifact"`
+		ExpiresAt *string `json:"expires_at,omitempty"`
+	}{Token: tok.Token, Type: cfg.Type, Memo: cfg.Memo, ExpiresAt: tok.ExpiresAt}
+	for _, p := range tok.Catalog {
+		if p.Name == "canary_"+cfg.Type {
+			result.Artifact = p.Value
+		}
+	}
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
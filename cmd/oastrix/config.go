@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.yaml.in/yaml/v3"
+)
+
+// pluginsKey is the config file section holding server-wide plugin
+// configurations, keyed by plugin ID.
+const pluginsKey = "plugins"
+
+// flagEnvs names the environment variables of server flags that are not
+// OASTRIX_ followed by the flag name in upper snake case, or "" for flags
+// without one.
+var flagEnvs = map[string]string{
+	"config":          "",
+	"tls-cert":        "",
+	"tls-key":         "",
+	"no-acme":         "",
+	"acme-email":      "",
+	"acme-staging":    "",
+	"api-cors-origin": "OASTRIX_API_CORS_ORIGINS",
+	"api-cors-header": "OASTRIX_API_CORS_HEADERS",
+	"remote-plugin":   "OASTRIX_REMOTE_PLUGINS",
+	"intel-list":      "OASTRIX_INTEL_LISTS",
+	"intel-allowlist": "OASTRIX_INTEL_ALLOWLISTS",
+	"redact-header":   "OASTRIX_REDACT_HEADERS",
+}
+
+// flagEnv returns the environment variable of the flag name, or "" if it has
+// none.
+func flagEnv(name string) string {
+	if env, ok := flagEnvs[name]; ok {
+		return env
+	}
+	return "OASTRIX_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// readConfigFile reads a YAML (.yaml, .yml) or TOML (.toml) config file.
+func readConfigFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := make(map[string]any)
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	case ".toml":
+		if _, err := toml.Decode(string(data), &cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown config file format %q: want .yaml, .yml or .toml", path, ext)
+	}
+	return cfg, nil
+}
+
+// applyConfigFile sets the flags of cmd from the config file at path, whose
+// keys are flag names, and returns the file's plugins section. Flags set on
+// the command line or by their environment variable keep their value.
+func applyConfigFile(cmd *cobra.Command, path string) (map[string]any, error) {
+	cfg, err := readConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var pluginConfigs map[string]any
+	for _, key := range slices.Sorted(maps.Keys(cfg)) {
+		value := cfg[key]
+		if key == pluginsKey {
+			m, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s: %s: want a table of plugin IDs", path, key)
+			}
+			pluginConfigs = m
+			continue
+		}
+
+		f := cmd.Flags().Lookup(key)
+		if f == nil || key == "config" || key == "help" {
+			return nil, fmt.Errorf("%s: unknown key %q", path, key)
+		}
+		if f.Changed {
+			continue
+		}
+		if env := flagEnv(key); env != "" && os.Getenv(env) != "" {
+			continue
+		}
+		if err := setFlag(f, value); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+	}
+	return pluginConfigs, nil
+}
+
+// setFlag sets f to a config file value. A list replaces the values of a
+// repeatable flag; a single value is parsed as on the command line.
+func setFlag(f *pflag.Flag, value any) error {
+	if list, ok := value.([]any); ok {
+		sv, ok := f.Value.(pflag.SliceValue)
+		if !ok {
+			return errors.New("want a single value, not a list")
+		}
+		items := make([]string, len(list))
+		for i, item := range list {
+			s, err := configString(item)
+			if err != nil {
+				return err
+			}
+			items[i] = s
+		}
+		return sv.Replace(items)
+	}
+
+	s, err := configString(value)
+	if err != nil {
+		return err
+	}
+	return f.Value.Set(s)
+}
+
+// configString formats a scalar config file value as a flag would be given it.
+func configString(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339), nil
+	default:
+		return "", fmt.Errorf("want a value or list of values, not %T", value)
+	}
+}
+
+// applyPluginConfigs stores the server-wide configuration of each plugin in
+// configs, which replaces any set through the API. They are validated as the
+// API validates them.
+func applyPluginConfigs(path string, configs map[string]any, pipeline *plugins.Pipeline, store db.ConfigStore) error {
+	for _, id := range slices.Sorted(maps.Keys(configs)) {
+		key := pluginsKey + "." + id
+		p, ok := pipeline.Plugin(id)
+		if !ok {
+			return fmt.Errorf("%s: %s: plugin not found", path, key)
+		}
+		gc, ok := p.(plugins.GlobalConfigurablePlugin)
+		if !ok {
+			return fmt.Errorf("%s: %s: plugin has no server-wide configuration", path, key)
+		}
+
+		cfg := gc.NewGlobalConfig()
+		if err := decodePluginConfig(configs[id], cfg); err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		if v, ok := cfg.(plugins.Validator); ok {
+			if err := v.Validate(); err != nil {
+				return fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+		}
+		if err := store.SetPluginConfig(id, cfg); err != nil {
+			return fmt.Errorf("store %s plugin config: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// decodePluginConfig decodes a config file table into a plugin's
+// configuration type through its JSON form, rejecting unknown fields.
+func decodePluginConfig(value any, out any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
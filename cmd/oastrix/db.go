@@ -0,0 +1,177 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var dbFlags struct {
+	dbPath string
+}
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage the server database",
+	Long: `Manage the schema and health of the server database.
+
+These commands operate on the local database file and do not go through
+the API, so they must be run on the server host. The server applies pending
+migrations itself when it starts; plugins' own migrations are only applied
+by the server.`,
+}
+
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending schema migrations",
+	Args:  cobra.NoArgs,
+	RunE:  runDBMigrate,
+}
+
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show applied and pending schema migrations",
+	Args:  cobra.NoArgs,
+	RunE:  runDBStatus,
+}
+
+var dbCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check the database's integrity and look for orphaned rows",
+	Long: `Run SQLite's integrity check and a foreign key check, which finds rows
+such as interaction details or attributes whose interaction no longer exists.
+Exits non-zero if any problem is found.`,
+	Args: cobra.NoArgs,
+	RunE: runDBCheck,
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbMigrateCmd)
+	dbCmd.AddCommand(dbStatusCmd)
+	dbCmd.AddCommand(dbCheckCmd)
+
+	dbCmd.PersistentFlags().StringVar(&dbFlags.dbPath, "db", getEnv("OASTRIX_DB", "oastrix.db"), "database path")
+}
+
+// openExistingDB opens the database without migrating it, refusing to create
+// one where there is none.
+func openExistingDB() (*sql.DB, error) {
+	if _, err := os.Stat(dbFlags.dbPath); err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	database, err := db.OpenWithoutMigrations(dbFlags.dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	return database, nil
+}
+
+type migrationInfo struct {
+	Version   int     `json:"version"`
+	Name      string  `json:"name"`
+	AppliedAt *string `json:"applied_at"`
+}
+
+func migrationInfos(migrations []db.Migration) []migrationInfo {
+	infos := make([]migrationInfo, 0, len(migrations))
+	for _, m := range migrations {
+		info := migrationInfo{Version: m.Version, Name: m.Name}
+		if m.AppliedAt != nil {
+			appliedAt := formatUnix(*m.AppliedAt)
+			info.AppliedAt = &appliedAt
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func runDBMigrate(cmd *cobra.Command, args []string) error {
+	// Unlike the other subcommands, migrate may create the database.
+	database, err := db.OpenWithoutMigrations(dbFlags.dbPath)
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	before, err := db.Migrations(database)
+	if err != nil {
+		return fmt.Errorf("read migrations: %w", err)
+	}
+	if err := db.Migrate(database); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	after, err := db.Migrations(database)
+	if err != nil {
+		return fmt.Errorf("read migrations: %w", err)
+	}
+
+	var applied []db.Migration
+	for i, m := range after {
+		if before[i].AppliedAt == nil && m.AppliedAt != nil {
+			applied = append(applied, m)
+		}
+	}
+	return printJSON(cmd, struct {
+		Applied []migrationInfo `json:"applied"`
+	}{migrationInfos(applied)})
+}
+
+func runDBStatus(cmd *cobra.Command, args []string) error {
+	database, err := openExistingDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = database.Close() }()
+
+	migrations, err := db.Migrations(database)
+	if err != nil {
+		return fmt.Errorf("read migrations: %w", err)
+	}
+	pending := 0
+	for _, m := range migrations {
+		if m.AppliedAt == nil {
+			pending++
+		}
+	}
+	return printJSON(cmd, struct {
+		Migrations []migrationInfo `json:"migrations"`
+		Pending    int             `json:"pending"`
+	}{migrationInfos(migrations), pending})
+}
+
+type problemInfo struct {
+	Check  string `json:"check"`
+	Detail string `json:"detail"`
+}
+
+func runDBCheck(cmd *cobra.Command, args []string) error {
+	database, err := openExistingDB()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = database.Close() }()
+
+	problems, err := db.Check(database)
+	if err != nil {
+		return err
+	}
+	infos := make([]problemInfo, 0, len(problems))
+	for _, p := range problems {
+		infos = append(infos, problemInfo{Check: p.Check, Detail: p.Detail})
+	}
+	if err := printJSON(cmd, struct {
+		OK       bool          `json:"ok"`
+		Problems []problemInfo `json:"problems"`
+	}{len(problems) == 0, infos}); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return errors.New("database check found problems")
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/spf13/cobra"
+)
+
+var delayFlags struct {
+	clientConfig
+	delay     string
+	jitter    string
+	protocols []string
+	clear     bool
+}
+
+var delayCmd = &cobra.Command{
+	Use:   "delay <token>",
+	Short: "Show, set or clear a token's response delay",
+	Long: `Show, set or clear the response delay of a token.
+
+With --delay, HTTP and DNS responses for the token are held back by that
+duration plus up to --jitter, at most five minutes in total. HTTP connections
+stay open until the delay elapses or the client gives up. The time actually
+waited is recorded in the response_delay_ms attribute, and
+response_delay_aborted is set when the client disconnected first.
+
+Without flags the current delay is shown.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDelay,
+}
+
+func init() {
+	rootCmd.AddCommand(delayCmd)
+
+	addClientFlags(delayCmd, &delayFlags.clientConfig)
+	delayCmd.Flags().StringVar(&delayFlags.delay, "delay", "", "delay each response by this duration, e.g. 10s")
+	delayCmd.Flags().StringVar(&delayFlags.jitter, "jitter", "", "add a random delay of up to this duration")
+	delayCmd.Flags().StringSliceVar(&delayFlags.protocols, "protocol", nil, "only delay http or dns responses (repeatable)")
+	delayCmd.Flags().BoolVar(&delayFlags.clear, "clear", false, "remove the delay")
+	delayCmd.MarkFlagsMutuallyExclusive("delay", "clear")
+}
+
+func runDelay(cmd *cobra.Command, args []string) error {
+	c, err := delayFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	token := args[0]
+
+	var result any
+	switch {
+	case delayFlags.clear:
+		if err := c.DeleteTokenDelay(ctx, token); err != nil {
+			return err
+		}
+		result = struct {
+			Token   string `json:"token"`
+			Cleared bool   `json:"cleared"`
+		}{Token: token, Cleared: true}
+	case cmd.Flags().Changed("delay"):
+		result, err = c.SetTokenDelay(ctx, token, apitypes.TokenDelay{
+			Delay:     delayFlags.delay,
+			Jitter:    delayFlags.jitter,
+			Protocols: delayFlags.protocols,
+		})
+	default:
+		result, err = c.GetTokenDelay(ctx, token)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var disableFlags struct {
+	clientConfig
+}
+
+var disableCmd = &cobra.Command{
+	Use:   "disable <token>",
+	Short: "Pause a token without deleting it",
+	Long: `Disable a token. Its existing interactions are kept, and new interactions are
+dropped or marked while_disabled depending on the server's --disabled-tokens
+policy.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDisable,
+}
+
+func init() {
+	rootCmd.AddCommand(disableCmd)
+
+	addClientFlags(disableCmd, &disableFlags.clientConfig)
+}
+
+func runDisable(cmd *cobra.Command, args []string) error {
+	c, err := disableFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	info, err := c.DisableToken(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var enableFlags struct {
+	clientConfig
+}
+
+var enableCmd = &cobra.Command{
+	Use:   "enable <token>",
+	Short: "Resume recording interactions for a token",
+	Long:  `Re-enable a disabled token so new interactions are recorded normally again.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runEnable,
+}
+
+func init() {
+	rootCmd.AddCommand(enableCmd)
+
+	addClientFlags(enableCmd, &enableFlags.clientConfig)
+}
+
+func runEnable(cmd *cobra.Command, args []string) error {
+	c, err := enableFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	info, err := c.EnableToken(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
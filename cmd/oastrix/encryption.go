@@ -0,0 +1,50 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/spf13/cobra"
+)
+
+type encryptionConfig struct {
+	key     string
+	keyFile string
+}
+
+func addEncryptionFlags(cmd *cobra.Command, cfg *encryptionConfig) {
+	cmd.Flags().StringVar(&cfg.key, "encryption-key", os.Getenv("OASTRIX_ENCRYPTION_KEY"), "base64 32-byte key encrypting stored request headers, query strings and bodies and attribute values (overrides --encryption-key-file)")
+	cmd.Flags().StringVar(&cfg.keyFile, "encryption-key-file", getEnv("OASTRIX_ENCRYPTION_KEY_FILE", ""), "file holding the base64 encryption key, such as one written by a KMS agent")
+}
+
+// loadCipher returns the Cipher for the database if an encryption key was given.
+// A database that has been encrypted requires the key.
+func (cfg *encryptionConfig) loadCipher(d *sql.DB) (*db.Cipher, error) {
+	encoded := cfg.key
+	if encoded == "" && cfg.keyFile != "" {
+		b, err := os.ReadFile(cfg.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read encryption key: %w", err)
+		}
+		encoded = string(b)
+	}
+	if encoded == "" {
+		encrypted, err := db.HasDataKey(d)
+		if err != nil {
+			return nil, fmt.Errorf("check data key: %w", err)
+		}
+		if encrypted {
+			return nil, errors.New("database is encrypted: --encryption-key or --encryption-key-file is required")
+		}
+		return nil, nil
+	}
+
+	key, err := db.ParseKey(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return db.LoadCipher(d, key)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/rsclarke/oastrix/internal/client"
+	"github.com/spf13/cobra"
+)
+
+var exportFlags struct {
+	clientConfig
+	format  string
+	output  string
+	sinceID int64
+	attrs   map[string]string
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export <token>",
+	Short: "Export interactions for a token as NDJSON, CSV, CEF or LEEF",
+	Long: `Export a token's interactions, newest first, for reports, spreadsheets and
+SIEMs. NDJSON writes one v2 interaction per line, including plugin attributes
+and the response that was sent; CSV writes one row per interaction with the
+request line or DNS question and the attributes as JSON. CEF and LEEF write
+one ArcSight or QRadar event per line, with the token, remote address, request
+and key plugin attributes mapped to their standard fields.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExport,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	addClientFlags(exportCmd, &exportFlags.clientConfig)
+	exportCmd.Flags().StringVar(&exportFlags.format, "format", "ndjson", "export format: ndjson, csv, cef or leef")
+	exportCmd.Flags().StringVarP(&exportFlags.output, "output", "o", "", "file to write to (default stdout)")
+	exportCmd.Flags().Int64Var(&exportFlags.sinceID, "since-id", 0, "only export interactions with an ID greater than this")
+	exportCmd.Flags().StringToStringVar(&exportFlags.attrs, "attr", nil, "only export interactions with this attribute `key=value` (repeatable; all must match)")
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	switch exportFlags.format {
+	case "ndjson", "csv", "cef", "leef":
+	default:
+		return fmt.Errorf("invalid format %q: want ndjson, csv, cef or leef", exportFlags.format)
+	}
+
+	c, err := exportFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	filter := client.InteractionFilter{SinceID: exportFlags.sinceID, Attributes: exportFlags.attrs}
+	export := func(w io.Writer) error {
+		return c.ExportInteractions(context.Background(), args[0], exportFlags.format, filter, w)
+	}
+	if exportFlags.output == "" {
+		return export(cmd.OutOrStdout())
+	}
+
+	f, err := os.Create(exportFlags.output)
+	if err != nil {
+		return err
+	}
+	if err := export(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+var fileFlags struct {
+	clientConfig
+	contentType string
+}
+
+var fileCmd = &cobra.Command{
+	Use:   "file",
+	Short: "Manage files served under a token's host",
+	Long: `Manage files served under a token's host.
+
+GET and HEAD requests for an uploaded file's path are answered with the file,
+so payload stagers, SVGs and DTDs are fetched from the same host that records
+the fetch. Served interactions carry a file_served attribute.`,
+}
+
+var fileUploadCmd = &cobra.Command{
+	Use:   "upload <token> <file> [path]",
+	Short: "Upload a file",
+	Long: `Upload a local file to serve under a token's host. The path defaults to
+the file name. The content type is guessed from the extension and content
+unless --content-type is given.`,
+	Args: cobra.RangeArgs(2, 3),
+	RunE: runFileUpload,
+}
+
+var fileListCmd = &cobra.Command{
+	Use:   "list <token>",
+	Short: "List uploaded files",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runFileList,
+}
+
+var fileRemoveCmd = &cobra.Command{
+	Use:   "rm <token> <path>",
+	Short: "Remove an uploaded file",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runFileRemove,
+}
+
+func init() {
+	rootCmd.AddCommand(fileCmd)
+	fileCmd.AddCommand(fileUploadCmd)
+	fileCmd.AddCommand(fileListCmd)
+	fileCmd.AddCommand(fileRemoveCmd)
+
+	for _, cmd := range []*cobra.Command{fileUploadCmd, fileListCmd, fileRemoveCmd} {
+		addClientFlags(cmd, &fileFlags.clientConfig)
+	}
+	fileUploadCmd.Flags().StringVar(&fileFlags.contentType, "content-type", "", "content type to serve the file with")
+}
+
+func runFileUpload(cmd *cobra.Command, args []string) error {
+	c, err := fileFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	path := filepath.Base(args[1])
+	if len(args) > 2 {
+		path = args[2]
+	}
+
+	result, err := c.PutTokenFile(context.Background(), args[0], path, fileFlags.contentType, f)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, result)
+}
+
+func runFileList(cmd *cobra.Command, args []string) error {
+	c, err := fileFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	result, err := c.ListTokenFiles(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, result)
+}
+
+func runFileRemove(cmd *cobra.Command, args []string) error {
+	c, err := fileFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	if err := c.DeleteTokenFile(context.Background(), args[0], args[1]); err != nil {
+		return err
+	}
+	return printJSON(cmd, struct {
+		Token   string `json:"token"`
+		Path    string `json:"path"`
+		Deleted bool   `json:"deleted"`
+	}{Token: args[0], Path: args[1], Deleted: true})
+}
+
+func printJSON(cmd *cobra.Command, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
@@ -5,12 +5,16 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/rsclarke/oastrix/internal/apitypes"
 	"github.com/spf13/cobra"
 )
 
 var generateFlags struct {
 	clientConfig
-	label string
+	label     string
+	tags      []string
+	ttl       string
+	expiresAt string
 }
 
 var generateCmd = &cobra.Command{
@@ -25,6 +29,10 @@ func init() {
 
 	addClientFlags(generateCmd, &generateFlags.clientConfig)
 	generateCmd.Flags().StringVar(&generateFlags.label, "label", "", "optional label for the token")
+	generateCmd.Flags().StringSliceVar(&generateFlags.tags, "tag", nil, "tag for the token (repeatable)")
+	generateCmd.Flags().StringVar(&generateFlags.ttl, "ttl", "", "expire the token after this duration, e.g. 72h")
+	generateCmd.Flags().StringVar(&generateFlags.expiresAt, "expires-at", "", "expire the token at this RFC 3339 time")
+	generateCmd.MarkFlagsMutuallyExclusive("ttl", "expires-at")
 }
 
 func runGenerate(cmd *cobra.Command, args []string) error {
@@ -33,7 +41,12 @@ func runGenerate(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	resp, err := c.CreateToken(context.Background(), generateFlags.label)
+	resp, err := c.CreateToken(context.Background(), apitypes.CreateTokenRequest{
+		Label:     generateFlags.label,
+		Tags:      generateFlags.tags,
+		TTL:       generateFlags.ttl,
+		ExpiresAt: generateFlags.expiresAt,
+	})
 	if err != nil {
 		return err
 	}
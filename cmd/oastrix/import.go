@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var importFlags struct {
+	clientConfig
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import <token> <file>",
+	Short: "Import interactions exported as NDJSON",
+	Long: `Restore interactions from an NDJSON export under a token, keeping their
+timestamps, request and response details and attributes, e.g. to move a token
+to another server or merge a staging server's findings. Use - to read stdin.
+Nothing is imported if any record is invalid.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runImport,
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+
+	addClientFlags(importCmd, &importFlags.clientConfig)
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	c, err := importFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = cmd.InOrStdin()
+	if args[1] != "-" {
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		r = f
+	}
+
+	resp, err := c.ImportInteractions(context.Background(), args[0], r)
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, resp)
+}
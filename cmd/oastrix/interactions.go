@@ -5,25 +5,33 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/rsclarke/oastrix/internal/client"
 	"github.com/spf13/cobra"
 )
 
 var interactionsFlags struct {
 	clientConfig
+	sinceID int64
+	attrs   map[string]string
 }
 
 var interactionsCmd = &cobra.Command{
 	Use:   "interactions <token>",
 	Short: "List interactions for a token",
-	Long:  `List all recorded interactions for a specific token.`,
-	Args:  cobra.ExactArgs(1),
-	RunE:  runInteractions,
+	Long: `List all recorded interactions for a specific token.
+
+Use --attr to list only interactions whose plugin attribute has a value, or is
+a list containing it, e.g. --attr geo.country=GB --attr intel_tags=tor.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runInteractions,
 }
 
 func init() {
 	rootCmd.AddCommand(interactionsCmd)
 
 	addClientFlags(interactionsCmd, &interactionsFlags.clientConfig)
+	interactionsCmd.Flags().Int64Var(&interactionsFlags.sinceID, "since-id", 0, "only show interactions with an ID greater than this")
+	interactionsCmd.Flags().StringToStringVar(&interactionsFlags.attrs, "attr", nil, "only show interactions with this attribute `key=value` (repeatable; all must match)")
 }
 
 func runInteractions(cmd *cobra.Command, args []string) error {
@@ -33,7 +41,10 @@ func runInteractions(cmd *cobra.Command, args []string) error {
 	}
 
 	token := args[0]
-	resp, err := c.GetInteractions(context.Background(), token)
+	resp, err := c.ListInteractions(context.Background(), token, client.InteractionFilter{
+		SinceID:    interactionsFlags.sinceID,
+		Attributes: interactionsFlags.attrs,
+	})
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/spf13/cobra"
+)
+
+var labelFlags struct {
+	clientConfig
+}
+
+var labelCmd = &cobra.Command{
+	Use:   "label <token> [text]",
+	Short: "Set or clear a token's label",
+	Long:  `Set the label of an existing token. Omit the text to clear the label.`,
+	Args:  cobra.RangeArgs(1, 2),
+	RunE:  runLabel,
+}
+
+func init() {
+	rootCmd.AddCommand(labelCmd)
+
+	addClientFlags(labelCmd, &labelFlags.clientConfig)
+}
+
+func runLabel(cmd *cobra.Command, args []string) error {
+	c, err := labelFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	label := ""
+	if len(args) == 2 {
+		label = args[1]
+	}
+
+	info, err := c.UpdateToken(context.Background(), args[0], apitypes.UpdateTokenRequest{Label: &label})
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
@@ -5,23 +5,29 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/rsclarke/oastrix/internal/client"
 	"github.com/spf13/cobra"
 )
 
 var listFlags struct {
 	clientConfig
+	tags  []string
+	label string
 }
 
 var listCmd = &cobra.Command{
 	Use:   "list",
-	Short: "List all tokens with interaction counts",
-	Long:  `List all tokens with their labels, creation times, and interaction counts.`,
-	RunE:  runList,
+	Short: "List tokens with interaction counts",
+	Long: `List tokens with their labels, tags, creation times, and interaction counts.
+Use --tag and --label to narrow the results.`,
+	RunE: runList,
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
 
+	listCmd.Flags().StringSliceVar(&listFlags.tags, "tag", nil, "only list tokens with this tag (repeatable; all must match)")
+	listCmd.Flags().StringVar(&listFlags.label, "label", "", "only list tokens whose label contains this text")
 	addClientFlags(listCmd, &listFlags.clientConfig)
 }
 
@@ -31,7 +37,10 @@ func runList(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	resp, err := c.ListTokens(context.Background())
+	resp, err := c.ListTokens(context.Background(), client.TokenFilter{
+		Tags:  listFlags.tags,
+		Label: listFlags.label,
+	})
 	if err != nil {
 		return err
 	}
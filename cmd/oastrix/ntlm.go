@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/spf13/cobra"
+)
+
+var ntlmFlags struct {
+	clientConfig
+	enable    bool
+	domain    string
+	challenge string
+	accept    bool
+	clear     bool
+}
+
+var ntlmCmd = &cobra.Command{
+	Use:   "ntlm <token>",
+	Short: "Show, enable or disable a token's NTLM capture",
+	Long: `Show, enable or disable NTLM capture for a token.
+
+Once enabled, HTTP requests to the token are offered Negotiate and NTLM
+authentication and answered with a fixed server challenge. The client's
+response is recorded in the ntlm attribute, including a hash in the format
+hashcat and John the Ripper accept. With --accept, requests completing the
+handshake get the token's usual response instead of another challenge.
+
+Without flags the current settings are shown.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runNTLM,
+}
+
+func init() {
+	rootCmd.AddCommand(ntlmCmd)
+
+	addClientFlags(ntlmCmd, &ntlmFlags.clientConfig)
+	ntlmCmd.Flags().BoolVar(&ntlmFlags.enable, "enable", false, "enable capture")
+	ntlmCmd.Flags().StringVar(&ntlmFlags.domain, "domain", "", `NetBIOS domain announced in the challenge (default "OASTRIX"; implies --enable)`)
+	ntlmCmd.Flags().StringVar(&ntlmFlags.challenge, "challenge", "", `server challenge as 16 hex characters (default "1122334455667788"; implies --enable)`)
+	ntlmCmd.Flags().BoolVar(&ntlmFlags.accept, "accept", false, "stop challenging once the handshake completes (implies --enable)")
+	ntlmCmd.Flags().BoolVar(&ntlmFlags.clear, "clear", false, "disable capture")
+	for _, f := range []string{"enable", "domain", "challenge", "accept"} {
+		ntlmCmd.MarkFlagsMutuallyExclusive("clear", f)
+	}
+}
+
+func runNTLM(cmd *cobra.Command, args []string) error {
+	c, err := ntlmFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	token := args[0]
+	flags := cmd.Flags()
+
+	var result any
+	switch {
+	case ntlmFlags.clear:
+		if err := c.DeleteTokenNTLM(ctx, token); err != nil {
+			return err
+		}
+		result = struct {
+			Token   string `json:"token"`
+			Cleared bool   `json:"cleared"`
+		}{Token: token, Cleared: true}
+	case flags.Changed("enable"), flags.Changed("domain"), flags.Changed("challenge"), flags.Changed("accept"):
+		result, err = c.SetTokenNTLM(ctx, token, apitypes.TokenNTLM{
+			Domain:    ntlmFlags.domain,
+			Challenge: ntlmFlags.challenge,
+			Accept:    ntlmFlags.accept,
+		})
+	default:
+		result, err = c.GetTokenNTLM(ctx, token)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
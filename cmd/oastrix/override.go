@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/spf13/cobra"
+)
+
+var overrideFlags struct {
+	clientConfig
+	status  int
+	headers []string
+	clear   bool
+}
+
+var overrideCmd = &cobra.Command{
+	Use:   "override <token>",
+	Short: "Show, set or clear a token's status code and header overrides",
+	Long: `Show, set or clear the status code and header overrides of a token.
+
+The default response is answered with --status and any --header instead of
+200 OK, e.g. a 401 with WWW-Authenticate, a 500 or an empty 204, to probe how
+targets treat different response classes. Tokens with a redirect or custom
+response are not affected.
+
+Without flags the current overrides are shown.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runOverride,
+}
+
+func init() {
+	rootCmd.AddCommand(overrideCmd)
+
+	addClientFlags(overrideCmd, &overrideFlags.clientConfig)
+	overrideCmd.Flags().IntVar(&overrideFlags.status, "status", 0, "HTTP status code")
+	overrideCmd.Flags().StringArrayVar(&overrideFlags.headers, "header", nil, `response header as "Name: value" (repeatable)`)
+	overrideCmd.Flags().BoolVar(&overrideFlags.clear, "clear", false, "remove the overrides")
+	overrideCmd.MarkFlagsMutuallyExclusive("clear", "status")
+	overrideCmd.MarkFlagsMutuallyExclusive("clear", "header")
+}
+
+func runOverride(cmd *cobra.Command, args []string) error {
+	c, err := overrideFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	token := args[0]
+	flags := cmd.Flags()
+
+	var result any
+	switch {
+	case overrideFlags.clear:
+		if err := c.DeleteTokenOverrides(ctx, token); err != nil {
+			return err
+		}
+		result = struct {
+			Token   string `json:"token"`
+			Cleared bool   `json:"cleared"`
+		}{Token: token, Cleared: true}
+	case flags.Changed("status"), flags.Changed("header"):
+		o := apitypes.TokenOverrides{Status: overrideFlags.status}
+		for _, h := range overrideFlags.headers {
+			name, value, ok := strings.Cut(h, ":")
+			if !ok {
+				return fmt.Errorf("invalid header %q: want \"Name: value\"", h)
+			}
+			if o.Headers == nil {
+				o.Headers = make(map[string]string)
+			}
+			o.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+		result, err = c.SetTokenOverrides(ctx, token, o)
+	default:
+		result, err = c.GetTokenOverrides(ctx, token)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
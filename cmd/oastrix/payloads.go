@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var payloadsFlags struct {
+	clientConfig
+	domain string
+}
+
+var payloadsCmd = &cobra.Command{
+	Use:   "payloads <token>",
+	Short: "List ready-to-paste payloads for a token",
+	Long: `List the payload catalog of a token: its hostname and URLs plus payloads for
+Log4Shell, XSS, XXE, SSRF, SMTP, UNC paths and command injection, and any
+contributed by server plugins. They use the server's main domain unless
+--domain names another of its domains.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runPayloads,
+}
+
+func init() {
+	rootCmd.AddCommand(payloadsCmd)
+
+	addClientFlags(payloadsCmd, &payloadsFlags.clientConfig)
+	payloadsCmd.Flags().StringVar(&payloadsFlags.domain, "domain", "", "build the payloads on this of the server's domains")
+}
+
+func runPayloads(cmd *cobra.Command, args []string) error {
+	c, err := payloadsFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.ListPayloads(context.Background(), args[0], payloadsFlags.domain)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
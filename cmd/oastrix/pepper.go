@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/rsclarke/oastrix/internal/auth"
+	"github.com/spf13/cobra"
+)
+
+// defaultPepperFile is the name of the pepper file kept next to the database
+// when --pepper-file is not given.
+const defaultPepperFile = "oastrix.pepper"
+
+type pepperConfig struct {
+	pepper     string
+	pepperFile string
+}
+
+func addPepperFlags(cmd *cobra.Command, cfg *pepperConfig) {
+	cmd.Flags().StringVar(&cfg.pepper, "api-key-pepper", os.Getenv("OASTRIX_API_KEY_PEPPER"), "secret pepper for API key hashing (overrides --pepper-file)")
+	cmd.Flags().StringVar(&cfg.pepperFile, "pepper-file", os.Getenv("OASTRIX_PEPPER_FILE"), "file holding the API key pepper, generated by the server if missing (default "+defaultPepperFile+" next to the database)")
+}
+
+// path returns the pepper file, defaulting to one next to the database at
+// dbPath so every command run against it finds the same pepper.
+func (cfg *pepperConfig) path(dbPath string) string {
+	if cfg.pepperFile != "" {
+		return cfg.pepperFile
+	}
+	return filepath.Join(filepath.Dir(dbPath), defaultPepperFile)
+}
+
+// load returns the explicit pepper if one was given, otherwise the pepper
+// stored in the pepper file. Only the server creates a missing pepper file:
+// a key hashed with any other pepper could never be verified.
+func (cfg *pepperConfig) load(dbPath string, create bool) ([]byte, error) {
+	if cfg.pepper != "" {
+		return []byte(cfg.pepper), nil
+	}
+	path := cfg.path(dbPath)
+	if create {
+		return auth.LoadOrCreatePepper(path)
+	}
+	pepper, err := auth.LoadPepper(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("pepper file %s not found: run the server once to create it, or pass the server's --pepper-file", path)
+	}
+	return pepper, err
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var pluginFlags struct {
+	clientConfig
+	file  string
+	clear bool
+}
+
+var pluginCmd = &cobra.Command{
+	Use:   "plugin",
+	Short: "Manage plugin settings",
+}
+
+var pluginGlobalConfigCmd = &cobra.Command{
+	Use:   "global-config <plugin> [json]",
+	Short: "Show, set or reset a plugin's server-wide configuration",
+	Long: `Show, set or reset the server-wide configuration of a plugin. It applies to
+every token and API key, and takes effect without restarting the server.
+
+The configuration is given as a JSON object, either as an argument or with
+--file (- for stdin), and is validated by the plugin before it is stored.
+--clear resets the plugin to its defaults.
+
+Without a configuration the current one is shown.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runPluginGlobalConfig,
+}
+
+var pluginConfigCmd = &cobra.Command{
+	Use:   "config <token> <plugin> [json]",
+	Short: "Show, set or clear a token's configuration for a plugin",
+	Long: `Show, set or clear a token's configuration for any plugin that reads
+per-token settings, such as quota, delay or ntlm.
+
+The configuration is given as a JSON object, either as an argument or with
+--file (- for stdin), and is validated by the plugin before it is stored.
+
+Without a configuration the current one is shown.`,
+	Args: cobra.RangeArgs(2, 3),
+	RunE: runPluginConfig,
+}
+
+func init() {
+	rootCmd.AddCommand(pluginCmd)
+	pluginCmd.AddCommand(pluginConfigCmd)
+	pluginCmd.AddCommand(pluginGlobalConfigCmd)
+
+	for _, cmd := range []*cobra.Command{pluginConfigCmd, pluginGlobalConfigCmd} {
+		addClientFlags(cmd, &pluginFlags.clientConfig)
+		cmd.Flags().StringVar(&pluginFlags.file, "file", "", "read the configuration from a file, or - for stdin")
+		cmd.Flags().BoolVar(&pluginFlags.clear, "clear", false, "remove the configuration")
+		cmd.MarkFlagsMutuallyExclusive("file", "clear")
+	}
+}
+
+func runPluginConfig(cmd *cobra.Command, args []string) error {
+	cfg, err := readPluginConfig(cmd, args[2:])
+	if err != nil {
+		return err
+	}
+
+	c, err := pluginFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	token, pluginID := args[0], args[1]
+
+	var result any
+	switch {
+	case pluginFlags.clear:
+		if err := c.DeleteTokenPluginConfig(ctx, token, pluginID); err != nil {
+			return err
+		}
+		result = struct {
+			Token   string `json:"token"`
+			Plugin  string `json:"plugin"`
+			Cleared bool   `json:"cleared"`
+		}{Token: token, Plugin: pluginID, Cleared: true}
+	case cfg != nil:
+		result, err = c.SetTokenPluginConfig(ctx, token, pluginID, cfg)
+	default:
+		result, err = c.GetTokenPluginConfig(ctx, token, pluginID)
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, result)
+}
+
+func runPluginGlobalConfig(cmd *cobra.Command, args []string) error {
+	cfg, err := readPluginConfig(cmd, args[1:])
+	if err != nil {
+		return err
+	}
+
+	c, err := pluginFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pluginID := args[0]
+
+	var result any
+	switch {
+	case pluginFlags.clear:
+		if err := c.DeletePluginConfig(ctx, pluginID); err != nil {
+			return err
+		}
+		result = struct {
+			Plugin  string `json:"plugin"`
+			Cleared bool   `json:"cleared"`
+		}{Plugin: pluginID, Cleared: true}
+	case cfg != nil:
+		result, err = c.SetPluginConfig(ctx, pluginID, cfg)
+	default:
+		result, err = c.GetPluginConfig(ctx, pluginID)
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(cmd, result)
+}
+
+// readPluginConfig returns the configuration given as the optional argument in
+// args or with --file, or nil if there is none.
+func readPluginConfig(cmd *cobra.Command, args []string) (json.RawMessage, error) {
+	if len(args) > 0 && (pluginFlags.file != "" || pluginFlags.clear) {
+		return nil, errors.New("a configuration argument cannot be combined with --file or --clear")
+	}
+
+	var cfg json.RawMessage
+	var err error
+	switch {
+	case len(args) > 0:
+		cfg = json.RawMessage(args[0])
+	case pluginFlags.file == "-":
+		cfg, err = io.ReadAll(cmd.InOrStdin())
+	case pluginFlags.file != "":
+		cfg, err = os.ReadFile(pluginFlags.file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg != nil && !json.Valid(cfg) {
+		return nil, errors.New("configuration is not valid JSON")
+	}
+	return cfg, nil
+}
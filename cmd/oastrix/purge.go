@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/spf13/cobra"
+)
+
+var purgeFlags struct {
+	clientConfig
+	olderThan string
+	before    string
+	all       bool
+	server    bool
+}
+
+var purgeCmd = &cobra.Command{
+	Use:   "purge [token]",
+	Short: "Delete old interactions",
+	Long: `Delete interactions older than a given age or timestamp.
+
+Pass a token to purge only its interactions, --all to purge across every
+token owned by the API key, or --server to purge across every token on the
+server with an admin key.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runPurge,
+}
+
+func init() {
+	rootCmd.AddCommand(purgeCmd)
+
+	addClientFlags(purgeCmd, &purgeFlags.clientConfig)
+	purgeCmd.Flags().StringVar(&purgeFlags.olderThan, "older-than", "", "purge interactions older than this duration (e.g. 720h)")
+	purgeCmd.Flags().StringVar(&purgeFlags.before, "before", "", "purge interactions before this RFC 3339 timestamp")
+	purgeCmd.Flags().BoolVar(&purgeFlags.all, "all", false, "purge across all tokens owned by the API key")
+	purgeCmd.Flags().BoolVar(&purgeFlags.server, "server", false, "purge across all tokens on the server (admin keys only)")
+	purgeCmd.MarkFlagsMutuallyExclusive("all", "server")
+}
+
+func runPurge(cmd *cobra.Command, args []string) error {
+	if (purgeFlags.all || purgeFlags.server) == (len(args) == 1) {
+		return fmt.Errorf("specify either a token, --all or --server")
+	}
+
+	c, err := purgeFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	req := apitypes.PurgeInteractionsRequest{
+		OlderThan: purgeFlags.olderThan,
+		Before:    purgeFlags.before,
+	}
+
+	var resp *apitypes.PurgeInteractionsResponse
+	switch {
+	case purgeFlags.server:
+		resp, err = c.PurgeServerInteractions(context.Background(), req)
+	case purgeFlags.all:
+		resp, err = c.PurgeAllInteractions(context.Background(), req)
+	default:
+		resp, err = c.PurgeInteractions(context.Background(), args[0], req)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/spf13/cobra"
+)
+
+var quotaFlags struct {
+	clientConfig
+	max    int
+	window string
+	policy string
+	clear  bool
+}
+
+var quotaCmd = &cobra.Command{
+	Use:   "quota <token>",
+	Short: "Show, set or clear a token's interaction quota",
+	Long: `Show, set or clear the interaction quota of a token.
+
+With --max, at most that many interactions are kept, or with --window, at most
+that many per rolling window. Further interactions are handled by --policy:
+drop discards them, coalesce counts them in a quota_overflow attribute on the
+newest stored interaction, and keep_newest deletes the oldest instead.
+
+Without flags the current quota is shown.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runQuota,
+}
+
+func init() {
+	rootCmd.AddCommand(quotaCmd)
+
+	addClientFlags(quotaCmd, &quotaFlags.clientConfig)
+	quotaCmd.Flags().IntVar(&quotaFlags.max, "max", 0, "maximum interactions to keep, or per window")
+	quotaCmd.Flags().StringVar(&quotaFlags.window, "window", "", "apply --max per rolling window of this duration, e.g. 1m")
+	quotaCmd.Flags().StringVar(&quotaFlags.policy, "policy", "drop", "what to do beyond the quota: drop, coalesce or keep_newest")
+	quotaCmd.Flags().BoolVar(&quotaFlags.clear, "clear", false, "remove the quota")
+	quotaCmd.MarkFlagsMutuallyExclusive("max", "clear")
+}
+
+func runQuota(cmd *cobra.Command, args []string) error {
+	c, err := quotaFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	token := args[0]
+
+	var result any
+	switch {
+	case quotaFlags.clear:
+		if err := c.DeleteTokenQuota(ctx, token); err != nil {
+			return err
+		}
+		result = struct {
+			Token   string `json:"token"`
+			Cleared bool   `json:"cleared"`
+		}{Token: token, Cleared: true}
+	case cmd.Flags().Changed("max"):
+		result, err = c.SetTokenQuota(ctx, token, apitypes.TokenQuota{
+			Max:    quotaFlags.max,
+			Window: quotaFlags.window,
+			Policy: quotaFlags.policy,
+		})
+	default:
+		result, err = c.GetTokenQuota(ctx, token)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
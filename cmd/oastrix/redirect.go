@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/spf13/cobra"
+)
+
+var redirectFlags struct {
+	clientConfig
+	status     int
+	appendPath bool
+	clear      bool
+}
+
+var redirectCmd = &cobra.Command{
+	Use:   "redirect <token> [url]",
+	Short: "Show, set or clear a token's HTTP redirect",
+	Long: `Show, set or clear the HTTP redirect of a token.
+
+With a URL, HTTP interactions with the token are still recorded but answered
+with a redirect to it. The URL may use any scheme and port, e.g.
+gopher://127.0.0.1:6379/_INFO, for open-redirect chains and SSRF pivots.
+
+Without a URL the current redirect is shown.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runRedirect,
+}
+
+func init() {
+	rootCmd.AddCommand(redirectCmd)
+
+	addClientFlags(redirectCmd, &redirectFlags.clientConfig)
+	redirectCmd.Flags().IntVar(&redirectFlags.status, "status", 0, "redirect status: 301, 302, 303, 307 or 308 (default 302)")
+	redirectCmd.Flags().BoolVar(&redirectFlags.appendPath, "append-path", false, "append the request path and query to the URL")
+	redirectCmd.Flags().BoolVar(&redirectFlags.clear, "clear", false, "remove the redirect")
+}
+
+func runRedirect(cmd *cobra.Command, args []string) error {
+	if redirectFlags.clear && len(args) > 1 {
+		return fmt.Errorf("--clear cannot be combined with a URL")
+	}
+
+	c, err := redirectFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	token := args[0]
+
+	var result any
+	switch {
+	case redirectFlags.clear:
+		if err := c.DeleteTokenRedirect(ctx, token); err != nil {
+			return err
+		}
+		result = struct {
+			Token   string `json:"token"`
+			Cleared bool   `json:"cleared"`
+		}{Token: token, Cleared: true}
+	case len(args) > 1:
+		result, err = c.SetTokenRedirect(ctx, token, apitypes.TokenRedirect{
+			URL:        args[1],
+			Status:     redirectFlags.status,
+			AppendPath: redirectFlags.appendPath,
+		})
+	default:
+		result, err = c.GetTokenRedirect(ctx, token)
+	}
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/spf13/cobra"
+)
+
+var responseFlags struct {
+	clientConfig
+	status   int
+	headers  []string
+	body     string
+	bodyFile string
+	template bool
+	clear    bool
+}
+
+var responseCmd = &cobra.Command{
+	Use:   "response <token>",
+	Short: "Show, set or clear a token's custom HTTP response",
+	Long: `Show, set or clear the HTTP response served for a token's HTTP interactions
+in place of the default "ok".
+
+Any of --status, --header, --body or --body-file replaces the whole response.
+Files that are not valid UTF-8 are sent base64 encoded. Without flags the
+current response is shown.
+
+With --template the body is a Go text/template rendered for each request, with
+.Token, .Method, .Scheme, .Host, .Path, .RawQuery, .Query, .Headers, .Body,
+.RemoteIP and .Time available, e.g. '{{.Query.Get "callback"}}({})'.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runResponse,
+}
+
+func init() {
+	rootCmd.AddCommand(responseCmd)
+
+	addClientFlags(responseCmd, &responseFlags.clientConfig)
+	responseCmd.Flags().IntVar(&responseFlags.status, "status", 0, "HTTP status code (default 200)")
+	responseCmd.Flags().StringArrayVar(&responseFlags.headers, "header", nil, `response header as "Name: value" (repeatable)`)
+	responseCmd.Flags().StringVar(&responseFlags.body, "body", "", "response body")
+	responseCmd.Flags().StringVar(&responseFlags.bodyFile, "body-file", "", "read the response body from a file")
+	responseCmd.Flags().BoolVar(&responseFlags.template, "template", false, "render the body as a Go template")
+	responseCmd.Flags().BoolVar(&responseFlags.clear, "clear", false, "restore the default response")
+	responseCmd.MarkFlagsMutuallyExclusive("body", "body-file")
+	responseCmd.MarkFlagsMutuallyExclusive("clear", "status")
+	responseCmd.MarkFlagsMutuallyExclusive("clear", "header")
+	responseCmd.MarkFlagsMutuallyExclusive("clear", "body")
+	responseCmd.MarkFlagsMutuallyExclusive("clear", "body-file")
+	responseCmd.MarkFlagsMutuallyExclusive("clear", "template")
+}
+
+func runResponse(cmd *cobra.Command, args []string) error {
+	c, err := responseFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	token := args[0]
+	flags := cmd.Flags()
+
+	var result any
+	switch {
+	case responseFlags.clear:
+		if err := c.DeleteTokenHTTPResponse(ctx, token); err != nil {
+			return err
+		}
+		result = struct {
+			Token   string `json:"token"`
+			Cleared bool   `json:"cleared"`
+		}{Token: token, Cleared: true}
+	case flags.Changed("status"), flags.Changed("header"), flags.Changed("body"), flags.Changed("body-file"), flags.Changed("template"):
+		resp, err := buildHTTPResponse()
+		if err != nil {
+			return err
+		}
+		result, err = c.SetTokenHTTPResponse(ctx, token, resp)
+		if err != nil {
+			return err
+		}
+	default:
+		result, err = c.GetTokenHTTPResponse(ctx, token)
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
+
+func buildHTTPResponse() (apitypes.TokenHTTPResponse, error) {
+	resp := apitypes.TokenHTTPResponse{
+		Status:   responseFlags.status,
+		Body:     responseFlags.body,
+		Template: responseFlags.template,
+	}
+
+	for _, h := range responseFlags.headers {
+		name, value, ok := strings.Cut(h, ":")
+		if !ok {
+			return resp, fmt.Errorf("invalid header %q: want \"Name: value\"", h)
+		}
+		if resp.Headers == nil {
+			resp.Headers = make(map[string]string)
+		}
+		resp.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+
+	if responseFlags.bodyFile != "" {
+		data, err := os.ReadFile(responseFlags.bodyFile)
+		if err != nil {
+			return resp, fmt.Errorf("read body file: %w", err)
+		}
+		if utf8.Valid(data) || responseFlags.template {
+			resp.Body = string(data)
+		} else {
+			resp.BodyBase64 = base64.StdEncoding.EncodeToString(data)
+		}
+	}
+	return resp, nil
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/rsclarke/oastrix/internal/logging"
 	"github.com/spf13/cobra"
@@ -11,6 +14,9 @@ import (
 
 var logger *zap.Logger
 
+// logLevels are the levels of logger, which the server lets admins change.
+var logLevels *logging.Levels
+
 var rootCmd = &cobra.Command{
 	Use:   "oastrix",
 	Short: "Out-of-band Application Security Testing (OAST) tool",
@@ -18,8 +24,14 @@ var rootCmd = &cobra.Command{
 that provides HTTP, HTTPS, and DNS listeners for detecting out-of-band
 interactions during security testing.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		cfg := logging.FromEnv()
 		var err error
-		logger, err = logging.New(logging.FromEnv())
+		logLevels, err = logging.ParseLevels(cfg.Level)
+		if err != nil {
+			return fmt.Errorf("initializing logger: %w", err)
+		}
+		cfg.Levels = logLevels
+		logger, err = logging.New(cfg)
 		if err != nil {
 			return fmt.Errorf("initializing logger: %w", err)
 		}
@@ -34,6 +46,10 @@ interactions during security testing.`,
 
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
+		// PersistentPostRun is skipped when a command fails.
+		if logger != nil {
+			logging.Sync(logger)
+		}
 		os.Exit(1)
 	}
 }
@@ -54,3 +70,45 @@ func getEnvInt(key string, defaultVal int) int {
 	}
 	return defaultVal
 }
+
+func getEnvBool(key string, defaultVal bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return defaultVal
+}
+
+func getEnvFloat(key string, defaultVal float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		var f float64
+		if _, err := fmt.Sscanf(v, "%g", &f); err == nil {
+			return f
+		}
+	}
+	return defaultVal
+}
+
+func getEnvDuration(key string, defaultVal time.Duration) time.Duration {
+	if v := os.Getenv(key); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d
+		}
+	}
+	return defaultVal
+}
+
+func getEnvList(key string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -3,9 +3,19 @@ package main
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"math"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -14,28 +24,158 @@ import (
 	"github.com/rsclarke/oastrix/internal/db"
 	"github.com/rsclarke/oastrix/internal/logging"
 	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/anomaly"
+	"github.com/rsclarke/oastrix/internal/plugins/asn"
+	"github.com/rsclarke/oastrix/internal/plugins/basicauth"
+	"github.com/rsclarke/oastrix/internal/plugins/blindxss"
+	"github.com/rsclarke/oastrix/internal/plugins/canary"
 	"github.com/rsclarke/oastrix/internal/plugins/core/defaultresponse"
+	"github.com/rsclarke/oastrix/internal/plugins/core/delay"
+	"github.com/rsclarke/oastrix/internal/plugins/core/files"
+	"github.com/rsclarke/oastrix/internal/plugins/core/httpresponse"
+	"github.com/rsclarke/oastrix/internal/plugins/core/interactsh"
+	"github.com/rsclarke/oastrix/internal/plugins/core/overrides"
+	"github.com/rsclarke/oastrix/internal/plugins/core/quota"
+	"github.com/rsclarke/oastrix/internal/plugins/core/redact"
+	"github.com/rsclarke/oastrix/internal/plugins/core/redirect"
 	"github.com/rsclarke/oastrix/internal/plugins/core/storage"
+	"github.com/rsclarke/oastrix/internal/plugins/core/stream"
+	"github.com/rsclarke/oastrix/internal/plugins/core/webhook"
+	"github.com/rsclarke/oastrix/internal/plugins/correlation"
+	"github.com/rsclarke/oastrix/internal/plugins/dedup"
+	"github.com/rsclarke/oastrix/internal/plugins/discord"
+	"github.com/rsclarke/oastrix/internal/plugins/elasticsearch"
+	"github.com/rsclarke/oastrix/internal/plugins/email"
+	"github.com/rsclarke/oastrix/internal/plugins/flood"
+	"github.com/rsclarke/oastrix/internal/plugins/native"
+	"github.com/rsclarke/oastrix/internal/plugins/ntlm"
+	"github.com/rsclarke/oastrix/internal/plugins/splunk"
+	"github.com/rsclarke/oastrix/internal/plugins/ssrf"
+	"github.com/rsclarke/oastrix/internal/plugins/syslog"
+	"github.com/rsclarke/oastrix/internal/plugins/telegram"
+	"github.com/rsclarke/oastrix/internal/plugins/threatintel"
+	"github.com/rsclarke/oastrix/internal/plugins/wasm"
 	"github.com/rsclarke/oastrix/internal/server"
+	"github.com/rsclarke/oastrix/internal/systemd"
+	"github.com/rsclarke/oastrix/internal/token"
+	"github.com/rsclarke/oastrix/internal/tracing"
+	"github.com/rsclarke/oastrix/pkg/plugin/remote"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
 
 var serverFlags struct {
+	pepperConfig
+	encryptionConfig
+	configFile  string
 	httpPort    int
 	httpsPort   int
 	apiPort     int
 	dnsPort     int
 	tlsCert     string
 	tlsKey      string
-	domain      string
+	domains     []string
 	dbPath      string
 	noACME      bool
 	acmeEmail   string
 	acmeStaging bool
+	acmeChal    string
 	publicIP    string
+	apiListen   []string
+	httpListen  []string
+	httpsListen []string
+	dnsListen   []string
+	proxyFrom   []string
+	trustProxy  []string
+	debugAddr   string
+	otlpURL     string
+	expired     string
+	disabled    string
+	purgeAfter  time.Duration
+	traceRatio  float64
+	accessLog   bool
+	accessRatio float64
+	apiClientCA string
+	apiVHost    bool
+	apiRate     float64
+	apiBurst    int
+	corsOrigins []string
+	corsHeaders []string
+	tokenStyle  string
+	tokenLength int
+	tokenChars  string
+	bxssPath    string
+	bxssShot    string
+	defStatus   int
+	defBody     string
+	defType     string
+	serverHdr   string
+	mimic       string
+	dnsAnswer   string
+	dnsTTL      int
+	pluginDir   string
+	asnDB       string
+	dedupWindow time.Duration
+	floodRate   float64
+	floodBurst  int
+	intelLists  []string
+	intelAllow  []string
+	intelEvery  time.Duration
+	remotePlugs []string
+	wasmPlugs   []string
+	hookTimeout time.Duration
+	evtTimeout  time.Duration
+	breakAfter  int
+	breakFor    time.Duration
+	workers     int
+	queueSize   int
+	drainWait   time.Duration
+	batchWindow time.Duration
+	compressAt  int
+	blobDir     string
+	spillAt     int
+	maxBody     int
+	maintEvery  time.Duration
+	dbBusy      time.Duration
+	dbCache     int
+	dbMmap      int
+	dbSync      string
+	dbMaxConns  int
+	dbIdleConns int
+	dbConnLife  time.Duration
+	honeypot    bool
+	interactsh  bool
+	intshAnon   bool
+	intshTTL    time.Duration
+	collab      bool
+	canary      bool
+	strayKeep   time.Duration
+	discordHook string
+	redactHdrs  []string
+	redactQuery []string
+	redactBody  []string
+	redactStore bool
 }
 
+// tokenSweepInterval is how often expired tokens are checked for purging.
+const tokenSweepInterval = 10 * time.Minute
+
+// straySweepInterval is how often stray interactions past their retention
+// are purged.
+const straySweepInterval = time.Hour
+
+// blobSweepInterval is how often unreferenced blobs are collected, and
+// blobSweepGrace how old they must be, so those of interactions still being
+// stored are kept.
+const (
+	blobSweepInterval = time.Hour
+	blobSweepGrace    = time.Hour
+)
+
+// blobMaxBody is the request body size recorded by default when large
+// bodies are spilled to a blob directory.
+const blobMaxBody = 64 << 20
+
 var serverCmd = &cobra.Command{
 	Use:   "server",
 	Short: "Start all listeners (HTTP, HTTPS, DNS, API)",
@@ -44,14 +184,17 @@ var serverCmd = &cobra.Command{
 TLS Modes:
   By default, ACME is enabled and certificates are automatically obtained
   from Let's Encrypt using DNS-01 challenges. The DNS server must be
-  publicly reachable on port 53 for ACME to work.
+  publicly reachable on port 53 for ACME to work; the apex certificates
+  fall back to TLS-ALPN-01 on port 443 (see --acme-challenge).
 
   --tls-cert + --tls-key  → Manual TLS mode (use provided certificates)
   --no-acme               → HTTP only (no HTTPS server)
   (neither)               → ACME mode (automatic Let's Encrypt certificates)
 
 Notes:
-  Ports 80, 443, and 53 require root or 'setcap cap_net_bind_service'.
+  Ports 80, 443, and 53 require root or 'setcap cap_net_bind_service', unless
+  systemd passes them through socket activation: sockets named dns, http,
+  https and api (FileDescriptorName=) are served instead of the ports.
   Certificates are stored in <db-dir>/certmagic/.`,
 	RunE: runServer,
 }
@@ -59,37 +202,247 @@ Notes:
 func init() {
 	rootCmd.AddCommand(serverCmd)
 
+	serverCmd.Flags().StringVar(&serverFlags.configFile, "config", getEnv("OASTRIX_CONFIG", ""), "YAML or TOML file setting any of these flags by name, and server-wide plugin configuration under plugins")
+	serverCmd.Flags().StringSliceVar(&serverFlags.httpListen, "http-listen", getEnvList("OASTRIX_HTTP_LISTEN"), "address to capture HTTP on, host:port (repeatable; default :80)")
+	serverCmd.Flags().StringSliceVar(&serverFlags.httpsListen, "https-listen", getEnvList("OASTRIX_HTTPS_LISTEN"), "address to capture HTTPS on, host:port (repeatable; default :443)")
+	serverCmd.Flags().StringSliceVar(&serverFlags.apiListen, "api-listen", getEnvList("OASTRIX_API_LISTEN"), "address to serve the API on, host:port or unix:///path/to.sock (repeatable; default :8443)")
+	serverCmd.Flags().StringSliceVar(&serverFlags.dnsListen, "dns-listen", getEnvList("OASTRIX_DNS_LISTEN"), "address to serve DNS on over UDP and TCP, host:port (repeatable; default :53, which requires root)")
 	serverCmd.Flags().IntVar(&serverFlags.httpPort, "http-port", getEnvInt("OASTRIX_HTTP_PORT", 80), "HTTP port to listen on")
 	serverCmd.Flags().IntVar(&serverFlags.httpsPort, "https-port", getEnvInt("OASTRIX_HTTPS_PORT", 443), "HTTPS port to listen on")
 	serverCmd.Flags().IntVar(&serverFlags.apiPort, "api-port", getEnvInt("OASTRIX_API_PORT", 8443), "API port to listen on")
 	serverCmd.Flags().IntVar(&serverFlags.dnsPort, "dns-port", getEnvInt("OASTRIX_DNS_PORT", 53), "DNS port to listen on (53 requires root)")
+	serverCmd.Flags().StringSliceVar(&serverFlags.proxyFrom, "proxy-protocol", getEnvList("OASTRIX_PROXY_PROTOCOL"), "address or CIDR prefix of a load balancer whose PROXY protocol headers are trusted on the HTTP, HTTPS and DNS TCP listeners (repeatable)")
+	serverCmd.Flags().StringSliceVar(&serverFlags.trustProxy, "trusted-proxies", getEnvList("OASTRIX_TRUSTED_PROXIES"), "address or CIDR prefix of a reverse proxy whose Forwarded and X-Forwarded-For headers give the remote address of HTTP interactions (repeatable)")
+	for _, name := range []string{"http", "https", "api", "dns"} {
+		_ = serverCmd.Flags().MarkDeprecated(name+"-port", "use --"+name+"-listen instead")
+	}
 	serverCmd.Flags().StringVar(&serverFlags.tlsCert, "tls-cert", "", "path to TLS certificate file (enables manual TLS mode)")
 	serverCmd.Flags().StringVar(&serverFlags.tlsKey, "tls-key", "", "path to TLS key file (enables manual TLS mode)")
-	serverCmd.Flags().StringVar(&serverFlags.domain, "domain", getEnv("OASTRIX_DOMAIN", "localhost"), "domain for token extraction")
+	domains := getEnvList("OASTRIX_DOMAIN")
+	if domains == nil {
+		domains = []string{"localhost"}
+	}
+	serverCmd.Flags().StringSliceVar(&serverFlags.domains, "domain", domains, "domain for token extraction; payloads use the first (repeatable)")
 	serverCmd.Flags().StringVar(&serverFlags.publicIP, "public-ip", getEnv("OASTRIX_PUBLIC_IP", ""), "public IP for DNS responses (required for ACME)")
 	serverCmd.Flags().StringVar(&serverFlags.dbPath, "db", getEnv("OASTRIX_DB", "oastrix.db"), "database path")
 	serverCmd.Flags().BoolVar(&serverFlags.noACME, "no-acme", false, "disable automatic TLS (ACME)")
 	serverCmd.Flags().StringVar(&serverFlags.acmeEmail, "acme-email", "", "email for Let's Encrypt notifications")
 	serverCmd.Flags().BoolVar(&serverFlags.acmeStaging, "acme-staging", false, "use Let's Encrypt staging CA")
+	serverCmd.Flags().StringVar(&serverFlags.acmeChal, "acme-challenge", getEnv("OASTRIX_ACME_CHALLENGE", acme.ChallengeAuto), "challenge for the apex certificates: auto (dns-01, falling back to tls-alpn-01), dns-01 or tls-alpn-01")
+	serverCmd.Flags().StringVar(&serverFlags.apiClientCA, "api-client-ca", getEnv("OASTRIX_API_CLIENT_CA", ""), "PEM CA bundle; require API clients to present a certificate signed by it")
+	serverCmd.Flags().BoolVar(&serverFlags.apiVHost, "api-vhost", getEnvBool("OASTRIX_API_VHOST", false), "also serve the API at api.<domain> on the HTTPS listener")
+	serverCmd.Flags().Float64Var(&serverFlags.apiRate, "api-rate-limit", getEnvFloat("OASTRIX_API_RATE_LIMIT", 10), "API requests per second allowed per key or unauthenticated IP (0 disables)")
+	serverCmd.Flags().IntVar(&serverFlags.apiBurst, "api-rate-burst", getEnvInt("OASTRIX_API_RATE_BURST", 20), "API request burst size per key or unauthenticated IP")
+	serverCmd.Flags().StringSliceVar(&serverFlags.corsOrigins, "api-cors-origin", getEnvList("OASTRIX_API_CORS_ORIGINS"), "browser origin allowed to call the API, or * for any (repeatable; enables CORS)")
+	serverCmd.Flags().StringSliceVar(&serverFlags.corsHeaders, "api-cors-header", getEnvList("OASTRIX_API_CORS_HEADERS"), "request header allowed in CORS requests (repeatable; default Authorization, Content-Type)")
+	serverCmd.Flags().StringVar(&serverFlags.debugAddr, "debug-addr", getEnv("OASTRIX_DEBUG_ADDR", ""), "loopback address to serve pprof and expvar on, e.g. 127.0.0.1:6060 (disabled when empty)")
+	serverCmd.Flags().StringVar(&serverFlags.otlpURL, "otlp-endpoint", getEnv("OASTRIX_OTLP_ENDPOINT", ""), "OTLP/HTTP endpoint URL to export traces to, e.g. http://localhost:4318 (disabled when empty)")
+	serverCmd.Flags().Float64Var(&serverFlags.traceRatio, "trace-sample-ratio", getEnvFloat("OASTRIX_TRACE_SAMPLE_RATIO", 1), "fraction of interactions to trace, 0 to 1")
+	serverCmd.Flags().BoolVar(&serverFlags.accessLog, "access-log", getEnvBool("OASTRIX_ACCESS_LOG", false), "log each request served by the HTTP, HTTPS and API listeners")
+	serverCmd.Flags().Float64Var(&serverFlags.accessRatio, "access-log-sample-ratio", getEnvFloat("OASTRIX_ACCESS_LOG_SAMPLE_RATIO", 1), "fraction of requests access-logged, 0 to 1; server errors are always logged")
+	serverCmd.Flags().StringVar(&serverFlags.expired, "expired-tokens", getEnv("OASTRIX_EXPIRED_TOKENS", string(storage.PolicyDrop)), "what to do with interactions for expired tokens: drop or record")
+	serverCmd.Flags().StringVar(&serverFlags.disabled, "disabled-tokens", getEnv("OASTRIX_DISABLED_TOKENS", string(storage.PolicyDrop)), "what to do with interactions for disabled tokens: drop or record")
+	serverCmd.Flags().StringVar(&serverFlags.tokenStyle, "token-format", getEnv("OASTRIX_TOKEN_FORMAT", "random"), "format of new tokens: random or uuid")
+	serverCmd.Flags().IntVar(&serverFlags.tokenLength, "token-length", getEnvInt("OASTRIX_TOKEN_LENGTH", 12), "length of random tokens (8-63)")
+	serverCmd.Flags().StringVar(&serverFlags.tokenChars, "token-alphabet", getEnv("OASTRIX_TOKEN_ALPHABET", ""), "characters random tokens are drawn from, a subset of a-z0-9 (default a-z0-9)")
+	serverCmd.Flags().StringVar(&serverFlags.bxssPath, "blindxss-path", getEnv("OASTRIX_BLINDXSS_PATH", blindxss.DefaultPath), "path under token hosts serving the blind XSS probe (disabled when empty)")
+	serverCmd.Flags().StringVar(&serverFlags.bxssShot, "blindxss-screenshot-script", getEnv("OASTRIX_BLINDXSS_SCREENSHOT_SCRIPT", ""), "URL of an html2canvas build the blind XSS probe loads to capture screenshots")
+	serverCmd.Flags().IntVar(&serverFlags.defStatus, "default-status", getEnvInt("OASTRIX_DEFAULT_STATUS", 200), "HTTP status of responses no plugin handled")
+	serverCmd.Flags().StringVar(&serverFlags.defBody, "default-body", getEnv("OASTRIX_DEFAULT_BODY", ""), `HTTP body of responses no plugin handled (default "ok", or the --mimic page)`)
+	serverCmd.Flags().StringVar(&serverFlags.defType, "default-content-type", getEnv("OASTRIX_DEFAULT_CONTENT_TYPE", ""), "Content-Type of responses no plugin handled")
+	serverCmd.Flags().StringVar(&serverFlags.serverHdr, "server-header", getEnv("OASTRIX_SERVER_HEADER", ""), "Server header of responses no plugin handled")
+	serverCmd.Flags().StringVar(&serverFlags.mimic, "mimic", getEnv("OASTRIX_MIMIC", ""), "web server whose banner and default page responses mimic: "+strings.Join(defaultresponse.BannerNames(), ", "))
+	serverCmd.Flags().StringVar(&serverFlags.dnsAnswer, "dns-answer", getEnv("OASTRIX_DNS_ANSWER", string(defaultresponse.DNSAnswerA)), "how unhandled DNS queries are answered: a (public IP for A queries), nodata or nxdomain")
+	serverCmd.Flags().IntVar(&serverFlags.dnsTTL, "dns-ttl", getEnvInt("OASTRIX_DNS_TTL", defaultresponse.DefaultDNSTTL), "TTL of default DNS answers in seconds")
+	serverCmd.Flags().DurationVar(&serverFlags.hookTimeout, "plugin-hook-timeout", getEnvDuration("OASTRIX_PLUGIN_HOOK_TIMEOUT", plugins.DefaultHookTimeout), "deadline for each plugin hook call (0 disables)")
+	serverCmd.Flags().DurationVar(&serverFlags.evtTimeout, "pipeline-timeout", getEnvDuration("OASTRIX_PIPELINE_TIMEOUT", 0), "deadline for processing each interaction; hooks and database writes still pending when it expires are skipped, cutting token delays short (0 disables)")
+	serverCmd.Flags().IntVar(&serverFlags.breakAfter, "plugin-failure-threshold", getEnvInt("OASTRIX_PLUGIN_FAILURE_THRESHOLD", plugins.DefaultBreakerThreshold), "consecutive hook errors or timeouts after which a feature plugin is skipped (0 disables)")
+	serverCmd.Flags().DurationVar(&serverFlags.breakFor, "plugin-failure-cooldown", getEnvDuration("OASTRIX_PLUGIN_FAILURE_COOLDOWN", plugins.DefaultBreakerCooldown), "how long a failing feature plugin is skipped for")
+	serverCmd.Flags().IntVar(&serverFlags.workers, "pipeline-workers", getEnvInt("OASTRIX_PIPELINE_WORKERS", 0), "store interactions on this many background workers instead of while responding (0 stores synchronously)")
+	serverCmd.Flags().IntVar(&serverFlags.queueSize, "pipeline-queue-size", getEnvInt("OASTRIX_PIPELINE_QUEUE_SIZE", plugins.DefaultQueueSize), "interactions waiting for a background worker before they are stored synchronously")
+	serverCmd.Flags().DurationVar(&serverFlags.drainWait, "drain-timeout", getEnvDuration("OASTRIX_DRAIN_TIMEOUT", 30*time.Second), "how long shutdown waits for in-flight requests to finish, and then for queued interactions and plugin queues")
+	serverCmd.Flags().DurationVar(&serverFlags.batchWindow, "db-batch-window", getEnvDuration("OASTRIX_DB_BATCH_WINDOW", 0), "commit interactions arriving within this long of each other in one transaction, e.g. 5ms (0 commits each on its own)")
+	serverCmd.Flags().DurationVar(&serverFlags.maintEvery, "db-maintenance-interval", getEnvDuration("OASTRIX_DB_MAINTENANCE_INTERVAL", time.Hour), "how often to checkpoint the WAL, run PRAGMA optimize and free unused pages (0 disables)")
+	serverCmd.Flags().DurationVar(&serverFlags.dbBusy, "db-busy-timeout", getEnvDuration("OASTRIX_DB_BUSY_TIMEOUT", db.DefaultBusyTimeout), "how long a database write waits for another's lock before failing")
+	serverCmd.Flags().IntVar(&serverFlags.dbCache, "db-cache-size", getEnvInt("OASTRIX_DB_CACHE_SIZE", 0), "page cache per database connection, in pages if positive or KiB if negative (0 keeps SQLite's default of 2MB)")
+	serverCmd.Flags().IntVar(&serverFlags.dbMmap, "db-mmap-size", getEnvInt("OASTRIX_DB_MMAP_SIZE", 0), "bytes of the database file to memory-map (0 disables)")
+	serverCmd.Flags().StringVar(&serverFlags.dbSync, "db-synchronous", getEnv("OASTRIX_DB_SYNCHRONOUS", "NORMAL"), "SQLite synchronous level: OFF, NORMAL, FULL or EXTRA")
+	serverCmd.Flags().IntVar(&serverFlags.dbMaxConns, "db-max-open-conns", getEnvInt("OASTRIX_DB_MAX_OPEN_CONNS", 0), "most database connections open at once (0 is unlimited)")
+	serverCmd.Flags().IntVar(&serverFlags.dbIdleConns, "db-max-idle-conns", getEnvInt("OASTRIX_DB_MAX_IDLE_CONNS", 0), "most idle database connections kept open (0 keeps 2)")
+	serverCmd.Flags().DurationVar(&serverFlags.dbConnLife, "db-conn-max-lifetime", getEnvDuration("OASTRIX_DB_CONN_MAX_LIFETIME", 0), "close database connections after this long (0 keeps them)")
+	serverCmd.Flags().IntVar(&serverFlags.compressAt, "db-compress-above", getEnvInt("OASTRIX_DB_COMPRESS_ABOVE", db.DefaultCompressAbove), "store request bodies larger than this many bytes gzipped (0 disables)")
+	serverCmd.Flags().StringVar(&serverFlags.blobDir, "blob-dir", getEnv("OASTRIX_BLOB_DIR", ""), "directory to store large request bodies in, keeping only their hash in the database (disabled when empty)")
+	serverCmd.Flags().IntVar(&serverFlags.spillAt, "blob-above", getEnvInt("OASTRIX_BLOB_ABOVE", db.DefaultSpillAbove), "store request bodies larger than this many bytes, once compressed, in --blob-dir")
+	serverCmd.Flags().IntVar(&serverFlags.maxBody, "http-max-body", getEnvInt("OASTRIX_HTTP_MAX_BODY", 0), "largest HTTP request body recorded, in bytes (default 1MB, or 64MB with --blob-dir)")
+	serverCmd.Flags().StringSliceVar(&serverFlags.remotePlugs, "remote-plugin", getEnvList("OASTRIX_REMOTE_PLUGINS"), "plugin executable to run as a separate process and call over gRPC (repeatable)")
+	serverCmd.Flags().StringSliceVar(&serverFlags.wasmPlugs, "wasm-plugin", getEnvList("OASTRIX_WASM_PLUGINS"), "WebAssembly (.wasm) plugin module to run sandboxed in the server (repeatable)")
+	serverCmd.Flags().Float64Var(&serverFlags.floodRate, "flood-rate", getEnvFloat("OASTRIX_FLOOD_RATE", 0), "interactions per second one remote IP may record with a token before the rest are dropped and summarized in a flood interaction (0 disables)")
+	serverCmd.Flags().IntVar(&serverFlags.floodBurst, "flood-burst", getEnvInt("OASTRIX_FLOOD_BURST", 20), "interaction burst size per remote IP and token under --flood-rate")
+	serverCmd.Flags().DurationVar(&serverFlags.dedupWindow, "dedup-window", getEnvDuration("OASTRIX_DEDUP_WINDOW", 0), "store only the first of identical interactions within this long, counting the rest in its repeat_count attribute (0 disables; tokens can override)")
+	serverCmd.Flags().StringVar(&serverFlags.asnDB, "asn-db", getEnv("OASTRIX_ASN_DB", ""), "iptoasn.com ip2asn-combined.tsv(.gz) table to record remote IPs' autonomous systems from (disabled when empty)")
+	serverCmd.Flags().StringSliceVar(&serverFlags.intelLists, "intel-list", getEnvList("OASTRIX_INTEL_LISTS"), "tag=file-or-URL list of addresses and CIDR prefixes; interactions from them are tagged, e.g. tor_exit=https://check.torproject.org/torbulkexitlist (repeatable)")
+	serverCmd.Flags().StringSliceVar(&serverFlags.intelAllow, "intel-allowlist", getEnvList("OASTRIX_INTEL_ALLOWLISTS"), "file or URL of addresses and CIDR prefixes never tagged from --intel-list lists (repeatable)")
+	serverCmd.Flags().DurationVar(&serverFlags.intelEvery, "intel-refresh", getEnvDuration("OASTRIX_INTEL_REFRESH", threatintel.DefaultRefresh), "how often --intel-list and --intel-allowlist lists are reloaded (0 disables)")
+	serverCmd.Flags().StringVar(&serverFlags.pluginDir, "plugin-dir", getEnv("OASTRIX_PLUGIN_DIR", ""), "directory of Go shared-object (.so) plugins to load at startup (disabled when empty)")
+	serverCmd.Flags().BoolVar(&serverFlags.honeypot, "honeypot", getEnvBool("OASTRIX_HONEYPOT", false), "record traffic to the domain with no token, or one that does not exist, as stray interactions")
+	serverCmd.Flags().DurationVar(&serverFlags.strayKeep, "honeypot-retention", getEnvDuration("OASTRIX_HONEYPOT_RETENTION", 7*24*time.Hour), "delete stray interactions this long after they occurred (0 keeps them)")
+	serverCmd.Flags().BoolVar(&serverFlags.interactsh, "interactsh", getEnvBool("OASTRIX_INTERACTSH", false), "serve the interactsh /register, /poll and /deregister endpoints on the domain, for interactsh-client and nuclei")
+	serverCmd.Flags().BoolVar(&serverFlags.intshAnon, "interactsh-anonymous", getEnvBool("OASTRIX_INTERACTSH_ANONYMOUS", false), "let interactsh clients register without an API key")
+	serverCmd.Flags().DurationVar(&serverFlags.intshTTL, "interactsh-ttl", getEnvDuration("OASTRIX_INTERACTSH_TTL", server.DefaultInteractshTTL), "how long the token registered for an interactsh client lives")
+	serverCmd.Flags().BoolVar(&serverFlags.collab, "collaborator", getEnvBool("OASTRIX_COLLABORATOR", false), "serve Burp Collaborator polls on token hosts, so Burp Suite can use the server as a private Collaborator")
+	serverCmd.Flags().BoolVar(&serverFlags.canary, "canary", getEnvBool("OASTRIX_CANARY", false), "serve canary tokens: record their memo on every trigger and resolve Canarytokens-style tracking URLs on the domain")
+	serverCmd.Flags().StringSliceVar(&serverFlags.redactHdrs, "redact-header", getEnvList("OASTRIX_REDACT_HEADERS"), "HTTP header whose values are replaced with hashes before interactions are forwarded (repeatable)")
+	serverCmd.Flags().StringSliceVar(&serverFlags.redactQuery, "redact-query", getEnvList("OASTRIX_REDACT_QUERY"), "HTTP query parameter whose values are replaced with hashes before interactions are forwarded (repeatable)")
+	serverCmd.Flags().StringArrayVar(&serverFlags.redactBody, "redact-body", getEnvList("OASTRIX_REDACT_BODY"), "regexp whose matches in request bodies, or capture groups if it has any, are replaced with hashes before interactions are forwarded (repeatable)")
+	serverCmd.Flags().BoolVar(&serverFlags.redactStore, "redact-storage", getEnvBool("OASTRIX_REDACT_STORAGE", false), "also redact interactions before they are stored, not just before they are forwarded")
+	serverCmd.Flags().StringVar(&serverFlags.discordHook, "discord-webhook", getEnv("OASTRIX_DISCORD_WEBHOOK", ""), "Discord webhook URL to post interactions of enabled tokens to (disabled when empty)")
+	serverCmd.Flags().DurationVar(&serverFlags.purgeAfter, "purge-expired-after", getEnvDuration("OASTRIX_PURGE_EXPIRED_AFTER", 0), "delete tokens and their interactions this long after they expire (0 disables)")
+	addPepperFlags(serverCmd, &serverFlags.pepperConfig)
+	addEncryptionFlags(serverCmd, &serverFlags.encryptionConfig)
 }
 
 func runServer(cmd *cobra.Command, args []string) error {
-	database, err := db.Open(serverFlags.dbPath)
+	var pluginConfigs map[string]any
+	if serverFlags.configFile != "" {
+		var err error
+		if pluginConfigs, err = applyConfigFile(cmd, serverFlags.configFile); err != nil {
+			return fmt.Errorf("load config: %w", err)
+		}
+	}
+
+	pepper, err := serverFlags.load(serverFlags.dbPath, true)
+	if err != nil {
+		return fmt.Errorf("load pepper: %w", err)
+	}
+
+	// Taken before any child process starts, so none inherits them.
+	sockets, err := systemd.Activated()
+	if err != nil {
+		return fmt.Errorf("socket activation: %w", err)
+	}
+
+	apiNetwork, apiAddrs := "tcp", listenAddrs(nil, serverFlags.apiPort)
+	if len(serverFlags.apiListen) > 0 {
+		apiAddrs = nil
+		for i, s := range serverFlags.apiListen {
+			network, addr, err := server.ParseListenAddr(s)
+			if err != nil {
+				return fmt.Errorf("api listen address: %w", err)
+			}
+			if i > 0 && network != apiNetwork {
+				return errors.New("--api-listen cannot mix unix sockets and TCP addresses")
+			}
+			apiNetwork = network
+			apiAddrs = append(apiAddrs, addr)
+		}
+	}
+	if apiNetwork == "unix" && serverFlags.apiClientCA != "" {
+		return errors.New("--api-client-ca requires a TCP API listen address")
+	}
+
+	expiredPolicy, err := storage.ParseTokenPolicy(serverFlags.expired)
+	if err != nil {
+		return fmt.Errorf("expired tokens: %w", err)
+	}
+	disabledPolicy, err := storage.ParseTokenPolicy(serverFlags.disabled)
+	if err != nil {
+		return fmt.Errorf("disabled tokens: %w", err)
+	}
+
+	tokenFormat := token.Format{Length: serverFlags.tokenLength, Alphabet: serverFlags.tokenChars}
+	switch serverFlags.tokenStyle {
+	case "random":
+	case "uuid":
+		tokenFormat.UUID = true
+	default:
+		return fmt.Errorf("invalid token format %q: want random or uuid", serverFlags.tokenStyle)
+	}
+	if err := tokenFormat.Validate(); err != nil {
+		return err
+	}
+
+	if serverFlags.debugAddr != "" {
+		if err := server.CheckLoopbackAddr(serverFlags.debugAddr); err != nil {
+			return err
+		}
+	}
+	if serverFlags.accessRatio < 0 || serverFlags.accessRatio > 1 {
+		return fmt.Errorf("invalid access log sample ratio %v: want 0 to 1", serverFlags.accessRatio)
+	}
+	if len(serverFlags.domains) == 0 {
+		return errors.New("no domain configured")
+	}
+	domain, altDomains := serverFlags.domains[0], serverFlags.domains[1:]
+	var proxyProto *server.ProxyProtocol
+	if len(serverFlags.proxyFrom) > 0 {
+		if proxyProto, err = server.NewProxyProtocol(serverFlags.proxyFrom); err != nil {
+			return fmt.Errorf("proxy protocol: %w", err)
+		}
+	}
+	var trustedProxies *server.TrustedProxies
+	if len(serverFlags.trustProxy) > 0 {
+		if trustedProxies, err = server.NewTrustedProxies(serverFlags.trustProxy); err != nil {
+			return fmt.Errorf("trusted proxies: %w", err)
+		}
+	}
+	redactRules := redact.Rules{Headers: serverFlags.redactHdrs, Query: serverFlags.redactQuery}
+	for _, expr := range serverFlags.redactBody {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid redact body regexp %q: %w", expr, err)
+		}
+		redactRules.Body = append(redactRules.Body, re)
+	}
+
+	shutdownTracing, err := tracing.Setup(cmd.Context(), tracing.Config{
+		Endpoint:    serverFlags.otlpURL,
+		SampleRatio: serverFlags.traceRatio,
+	})
+	if err != nil {
+		return fmt.Errorf("setup tracing: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Warn("tracing shutdown error", zap.Error(err))
+		}
+	}()
+
+	database, err := db.OpenWithOptions(serverFlags.dbPath, db.Options{
+		BusyTimeout:     serverFlags.dbBusy,
+		CacheSize:       serverFlags.dbCache,
+		MmapSize:        int64(serverFlags.dbMmap),
+		Synchronous:     serverFlags.dbSync,
+		MaxOpenConns:    serverFlags.dbMaxConns,
+		MaxIdleConns:    serverFlags.dbIdleConns,
+		ConnMaxLifetime: serverFlags.dbConnLife,
+	})
 	if err != nil {
 		return fmt.Errorf("open database: %w", err)
 	}
 	defer func() { _ = database.Close() }()
+	store := db.NewSQLite(database)
+	store.CompressAbove = serverFlags.compressAt
+	if serverFlags.blobDir != "" {
+		store.Blobs = db.DirBlobStore{Dir: serverFlags.blobDir}
+		store.SpillAbove = serverFlags.spillAt
+	}
+	if store.Cipher, err = serverFlags.loadCipher(database); err != nil {
+		return fmt.Errorf("load encryption key: %w", err)
+	}
 
-	count, err := db.CountAPIKeys(database)
+	count, err := store.CountAPIKeys()
 	if err != nil {
 		return fmt.Errorf("count API keys: %w", err)
 	}
 	if count == 0 {
-		displayKey, prefix, hash, err := auth.GenerateAPIKey()
+		displayKey, prefix, hash, err := auth.GenerateAPIKey(pepper)
 		if err != nil {
 			return fmt.Errorf("generate API key: %w", err)
 		}
-		_, err = db.CreateAPIKey(database, prefix, hash)
+		name := "initial"
+		_, err = store.CreateAPIKey(prefix, hash, string(auth.ScopeAdmin), &name)
 		if err != nil {
 			return fmt.Errorf("create API key: %w", err)
 		}
@@ -105,6 +458,22 @@ func runServer(cmd *cobra.Command, args []string) error {
 	if acmeMode && serverFlags.publicIP == "" {
 		return fmt.Errorf("--public-ip is required for ACME mode (or use --no-acme)")
 	}
+	switch serverFlags.acmeChal {
+	case acme.ChallengeAuto, acme.ChallengeDNS01, acme.ChallengeTLSALPN01:
+	default:
+		return fmt.Errorf("invalid ACME challenge %q: want auto, dns-01 or tls-alpn-01", serverFlags.acmeChal)
+	}
+	var apiHost string
+	if serverFlags.apiVHost {
+		if !acmeMode && !manualTLS {
+			return errors.New("--api-vhost requires TLS")
+		}
+		if serverFlags.apiClientCA != "" {
+			// The HTTPS listener does not ask for client certificates.
+			return errors.New("--api-vhost cannot be combined with --api-client-ca")
+		}
+		apiHost = "api." + domain
+	}
 
 	var txtStore *acme.TXTStore
 	if acmeMode {
@@ -112,33 +481,380 @@ func runServer(cmd *cobra.Command, args []string) error {
 		acme.SetLogger(logger.Named("certmagic"))
 	}
 
+	globalConfig := storage.NewGlobalConfig(store)
+	tokenConfig := storage.NewTokenConfig(store)
+	pluginRoutes := server.NewPluginRouter()
+	scheduler := plugins.NewJobScheduler(logger.Named("scheduler"))
+
+	storagePlugin := storage.New(store)
+	storagePlugin.ExpiredTokens = expiredPolicy
+	storagePlugin.DisabledTokens = disabledPolicy
+	storagePlugin.RecordStrays = serverFlags.honeypot
+	if serverFlags.batchWindow > 0 {
+		batcher := db.NewBatcher(database, serverFlags.batchWindow, db.DefaultBatchSize)
+		defer batcher.Close()
+		store.Batcher = batcher
+	}
+
+	// initPlugin applies a plugin's own migrations, then initializes it.
+	initPlugin := func(p plugins.Plugin) error {
+		id := p.ID()
+		if mp, ok := p.(plugins.MigratingPlugin); ok {
+			if err := db.ApplyPluginMigrations(database, id, mp.Migrations()); err != nil {
+				return fmt.Errorf("apply migrations: %w", err)
+			}
+		}
+		return p.Init(plugins.InitContext{
+			Logger:    logger.Named(id),
+			Store:     storagePlugin,
+			Config:    globalConfig,
+			Tokens:    tokenConfig,
+			Router:    pluginRoutes.ForPlugin(id),
+			Scheduler: scheduler.ForPlugin(id),
+		})
+	}
+
+	// Hooks run in each plugin's Priority order; plugins are registered in
+	// that same order here for readability.
 	pipeline := plugins.NewPipeline(logger.Named("pipeline"))
+	pipeline.SetHookTimeout(serverFlags.hookTimeout)
+	pipeline.SetEventTimeout(serverFlags.evtTimeout)
+	pipeline.SetCircuitBreaker(serverFlags.breakAfter, serverFlags.breakFor)
 
-	storagePlugin := storage.New(database)
-	if err := storagePlugin.Init(plugins.InitContext{Logger: logger.Named("storage")}); err != nil {
+	if err := initPlugin(storagePlugin); err != nil {
 		return fmt.Errorf("init storage plugin: %w", err)
 	}
 	pipeline.SetStore(storagePlugin)
 	pipeline.Register(storagePlugin)
 
+	if serverFlags.interactsh {
+		interactshPlugin := interactsh.New(store)
+		if err := initPlugin(interactshPlugin); err != nil {
+			return fmt.Errorf("init interactsh plugin: %w", err)
+		}
+		pipeline.Register(interactshPlugin)
+	}
+
+	if !redactRules.Empty() {
+		redactPlugin := redact.New(redactRules, pepper)
+		redactPlugin.Storage = serverFlags.redactStore
+		if err := initPlugin(redactPlugin); err != nil {
+			return fmt.Errorf("init redact plugin: %w", err)
+		}
+		pipeline.Register(redactPlugin)
+		if redactPlugin.Storage {
+			storagePlugin.RedactStrays = redactPlugin.Redact
+		}
+	}
+
+	quotaPlugin := quota.New(store)
+	if err := initPlugin(quotaPlugin); err != nil {
+		return fmt.Errorf("init quota plugin: %w", err)
+	}
+	pipeline.Register(quotaPlugin)
+
+	if serverFlags.floodRate > 0 {
+		floodPlugin := flood.New(serverFlags.floodRate, serverFlags.floodBurst)
+		if err := initPlugin(floodPlugin); err != nil {
+			return fmt.Errorf("init flood plugin: %w", err)
+		}
+		pipeline.Register(floodPlugin)
+	}
+
+	dedupPlugin := dedup.New(serverFlags.dedupWindow)
+	if err := initPlugin(dedupPlugin); err != nil {
+		return fmt.Errorf("init dedup plugin: %w", err)
+	}
+	pipeline.Register(dedupPlugin)
+
+	if serverFlags.asnDB != "" {
+		table, err := asn.LoadTable(serverFlags.asnDB)
+		if err != nil {
+			return fmt.Errorf("load ASN table: %w", err)
+		}
+		asnPlugin := asn.New(table)
+		if err := initPlugin(asnPlugin); err != nil {
+			return fmt.Errorf("init asn plugin: %w", err)
+		}
+		pipeline.Register(asnPlugin)
+	}
+
+	anomalyPlugin := anomaly.New()
+	if err := initPlugin(anomalyPlugin); err != nil {
+		return fmt.Errorf("init anomaly plugin: %w", err)
+	}
+	pipeline.Register(anomalyPlugin)
+
+	correlationPlugin := correlation.New()
+	if err := initPlugin(correlationPlugin); err != nil {
+		return fmt.Errorf("init correlation plugin: %w", err)
+	}
+	pipeline.Register(correlationPlugin)
+
+	ssrfPlugin := ssrf.New()
+	if err := initPlugin(ssrfPlugin); err != nil {
+		return fmt.Errorf("init ssrf plugin: %w", err)
+	}
+	pipeline.Register(ssrfPlugin)
+
+	if len(serverFlags.intelLists) > 0 {
+		var lists []threatintel.List
+		for _, s := range serverFlags.intelLists {
+			l, err := threatintel.ParseList(s)
+			if err != nil {
+				return fmt.Errorf("intel list: %w", err)
+			}
+			lists = append(lists, l)
+		}
+		for _, source := range serverFlags.intelAllow {
+			lists = append(lists, threatintel.List{Source: source, Allow: true})
+		}
+		intel := threatintel.New(lists)
+		intel.CacheDir = filepath.Join(filepath.Dir(serverFlags.dbPath), "threatintel")
+		intel.Refresh = serverFlags.intelEvery
+		if err := initPlugin(intel); err != nil {
+			return fmt.Errorf("init threatintel plugin: %w", err)
+		}
+		pipeline.Register(intel)
+	}
+
+	if serverFlags.discordHook != "" {
+		discordPlugin := discord.New(serverFlags.discordHook)
+		if err := initPlugin(discordPlugin); err != nil {
+			return fmt.Errorf("init discord plugin: %w", err)
+		}
+		pipeline.Register(discordPlugin)
+	}
+
+	// Configured through their server-wide plugin config, so always present.
+	emailPlugin := email.New()
+	if err := initPlugin(emailPlugin); err != nil {
+		return fmt.Errorf("init email plugin: %w", err)
+	}
+	pipeline.Register(emailPlugin)
+
+	telegramPlugin := telegram.New()
+	if err := initPlugin(telegramPlugin); err != nil {
+		return fmt.Errorf("init telegram plugin: %w", err)
+	}
+	pipeline.Register(telegramPlugin)
+
+	syslogPlugin := syslog.New()
+	if err := initPlugin(syslogPlugin); err != nil {
+		return fmt.Errorf("init syslog plugin: %w", err)
+	}
+	defer func() { _ = syslogPlugin.Close() }()
+	pipeline.Register(syslogPlugin)
+
+	splunkPlugin := splunk.New()
+	if err := initPlugin(splunkPlugin); err != nil {
+		return fmt.Errorf("init splunk plugin: %w", err)
+	}
+	defer func() {
+		if err := splunkPlugin.Close(); err != nil {
+			logger.Warn("splunk flush error", zap.Error(err))
+		}
+	}()
+	pipeline.Register(splunkPlugin)
+
+	elasticsearchPlugin := elasticsearch.New()
+	if err := initPlugin(elasticsearchPlugin); err != nil {
+		return fmt.Errorf("init elasticsearch plugin: %w", err)
+	}
+	defer func() {
+		if err := elasticsearchPlugin.Close(); err != nil {
+			logger.Warn("elasticsearch flush error", zap.Error(err))
+		}
+	}()
+	pipeline.Register(elasticsearchPlugin)
+
+	streamPlugin := stream.New()
+	if err := initPlugin(streamPlugin); err != nil {
+		return fmt.Errorf("init stream plugin: %w", err)
+	}
+	pipeline.Register(streamPlugin)
+
+	webhookPlugin := webhook.New(store)
+	if err := initPlugin(webhookPlugin); err != nil {
+		return fmt.Errorf("init webhook plugin: %w", err)
+	}
+	pipeline.Register(webhookPlugin)
+
+	delayPlugin := delay.New(store)
+	if err := initPlugin(delayPlugin); err != nil {
+		return fmt.Errorf("init delay plugin: %w", err)
+	}
+	pipeline.Register(delayPlugin)
+
+	// Authentication challenges come before anything else answers a token.
+	basicAuth := basicauth.New()
+	if err := initPlugin(basicAuth); err != nil {
+		return fmt.Errorf("init basicauth plugin: %w", err)
+	}
+	pipeline.Register(basicAuth)
+
+	ntlmCapture := ntlm.New()
+	if err := initPlugin(ntlmCapture); err != nil {
+		return fmt.Errorf("init ntlm plugin: %w", err)
+	}
+	pipeline.Register(ntlmCapture)
+
+	if serverFlags.bxssPath != "" {
+		bxss := blindxss.New()
+		bxss.Path = serverFlags.bxssPath
+		bxss.ScreenshotScript = serverFlags.bxssShot
+		if err := initPlugin(bxss); err != nil {
+			return fmt.Errorf("init blindxss plugin: %w", err)
+		}
+		pipeline.Register(bxss)
+	}
+
+	if serverFlags.canary {
+		canaryPlugin := canary.New()
+		if err := initPlugin(canaryPlugin); err != nil {
+			return fmt.Errorf("init canary plugin: %w", err)
+		}
+		pipeline.Register(canaryPlugin)
+	}
+
+	// Configured responses take precedence over defaultresponse. An uploaded
+	// file wins for its path, then a redirect, then a custom response.
+	filesPlugin := files.New(store)
+	if err := initPlugin(filesPlugin); err != nil {
+		return fmt.Errorf("init files plugin: %w", err)
+	}
+	pipeline.Register(filesPlugin)
+
+	redirectPlugin := redirect.New()
+	if err := initPlugin(redirectPlugin); err != nil {
+		return fmt.Errorf("init redirect plugin: %w", err)
+	}
+	pipeline.Register(redirectPlugin)
+
+	httpResp := httpresponse.New()
+	if err := initPlugin(httpResp); err != nil {
+		return fmt.Errorf("init httpresponse plugin: %w", err)
+	}
+	pipeline.Register(httpResp)
+
+	// Adjusts the status and headers that defaultresponse then answers with.
+	overridesPlugin := overrides.New()
+	if err := initPlugin(overridesPlugin); err != nil {
+		return fmt.Errorf("init overrides plugin: %w", err)
+	}
+	pipeline.Register(overridesPlugin)
+
+	if serverFlags.dnsTTL < 0 || serverFlags.dnsTTL > math.MaxInt32 {
+		return fmt.Errorf("invalid DNS TTL %d", serverFlags.dnsTTL)
+	}
 	defaultResp := defaultresponse.New(serverFlags.publicIP)
-	if err := defaultResp.Init(plugins.InitContext{Logger: logger.Named("defaultresponse")}); err != nil {
+	defaultResp.Status = serverFlags.defStatus
+	defaultResp.Body = serverFlags.defBody
+	defaultResp.ContentType = serverFlags.defType
+	defaultResp.Server = serverFlags.serverHdr
+	defaultResp.Banner = serverFlags.mimic
+	defaultResp.DNSAnswer = defaultresponse.DNSAnswer(serverFlags.dnsAnswer)
+	defaultResp.DNSTTL = uint32(serverFlags.dnsTTL)
+	if err := initPlugin(defaultResp); err != nil {
 		return fmt.Errorf("init defaultresponse plugin: %w", err)
 	}
 	pipeline.Register(defaultResp)
 
-	httpSrv := &server.HTTPServer{
-		Pipeline: pipeline,
-		Domain:   serverFlags.domain,
+	if serverFlags.pluginDir != "" {
+		if err := registerNativePlugins(serverFlags.pluginDir, pipeline, initPlugin, logger); err != nil {
+			return err
+		}
+	}
+	for _, path := range serverFlags.remotePlugs {
+		if rp := registerRemotePlugin(path, pipeline, initPlugin, logger); rp != nil {
+			defer func() { _ = rp.Close() }()
+		}
+	}
+	for _, path := range serverFlags.wasmPlugs {
+		if wp := registerWASMPlugin(path, pipeline, initPlugin, logger); wp != nil {
+			defer func() { _ = wp.Close() }()
+		}
+	}
+
+	if err := applyPluginConfigs(serverFlags.configFile, pluginConfigs, pipeline, store); err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	scheduler.Start(context.Background())
+	defer scheduler.Stop()
+	pipeline.StartWorkers(serverFlags.workers, serverFlags.queueSize)
+
+	apiSrv := &server.APIServer{
+		Store:    store,
+		Domain:   domain,
+		Domains:  altDomains,
 		PublicIP: serverFlags.publicIP,
-		Logger:   logger.Named("http"),
+		Logger:   logger.Named("api"),
+		Plugins:  pipeline,
+		Stream:   streamPlugin,
+		Pepper:   pepper,
+		Tokens:   tokenFormat,
+
+		LogLevels: logLevels,
+	}
+	if serverFlags.apiRate > 0 {
+		apiSrv.Limiter = server.NewRateLimiter(serverFlags.apiRate, serverFlags.apiBurst)
+	}
+	if len(serverFlags.corsOrigins) > 0 {
+		apiSrv.CORS = &server.CORSConfig{
+			AllowedOrigins: serverFlags.corsOrigins,
+			AllowedHeaders: serverFlags.corsHeaders,
+		}
+	}
+
+	httpSrv := &server.HTTPServer{
+		Pipeline:       pipeline,
+		Domain:         domain,
+		Domains:        altDomains,
+		PublicIP:       serverFlags.publicIP,
+		Logger:         logger.Named("http"),
+		Routes:         pluginRoutes,
+		MaxBodySize:    int64(serverFlags.maxBody),
+		CanaryPaths:    serverFlags.canary,
+		TrustedProxies: trustedProxies,
+	}
+	if httpSrv.MaxBodySize == 0 && store.Blobs != nil {
+		httpSrv.MaxBodySize = blobMaxBody
+	}
+	if serverFlags.honeypot {
+		httpSrv.Strays = storagePlugin
+	}
+	if apiHost != "" {
+		httpSrv.API, httpSrv.APIHost = apiSrv.Handler(), apiHost
+		logger.Info("serving api on the https listener", zap.String("host", apiHost))
+	}
+	if serverFlags.interactsh {
+		httpSrv.Interactsh = &server.InteractshHandler{
+			API:       apiSrv,
+			Domain:    domain,
+			Domains:   altDomains,
+			Anonymous: serverFlags.intshAnon,
+			TTL:       serverFlags.intshTTL,
+		}
+	}
+	if serverFlags.collab {
+		httpSrv.Collaborator = &server.CollaboratorHandler{
+			Store:   store,
+			Domain:  domain,
+			Domains: altDomains,
+			Logger:  logger.Named("collaborator"),
+		}
 	}
 
 	httpLogger := logger.Named("http")
-	httpCfg := server.DefaultServerConfig(fmt.Sprintf(":%d", serverFlags.httpPort), httpSrv, httpLogger)
+	httpCfg := catcherServerConfig("", withAccessLog(httpSrv, httpLogger), httpLogger)
+	if httpCfg.Listeners, err = listenAll(sockets, "http", "tcp", listenAddrs(serverFlags.httpListen, serverFlags.httpPort)); err != nil {
+		return fmt.Errorf("http server: %w", err)
+	}
+	httpCfg.Listeners = withProxyProtocol(httpCfg.Listeners, proxyProto)
 	httpServer := server.NewManagedServer("http", httpCfg)
 
-	logger.Info("starting http server", logging.Port(serverFlags.httpPort))
+	logger.Info("starting http server", listenerAddrs(httpCfg.Listeners))
 	httpServer.Start()
 	if err := httpServer.WaitForStartup(100 * time.Millisecond); err != nil {
 		return fmt.Errorf("http server: %w", err)
@@ -146,12 +862,25 @@ func runServer(cmd *cobra.Command, args []string) error {
 
 	dnsSrv := &server.DNSServer{
 		Pipeline: pipeline,
-		Domain:   serverFlags.domain,
+		Domain:   domain,
 		PublicIP: serverFlags.publicIP,
 		TXTStore: txtStore,
 		Logger:   logger.Named("dns"),
+
+		Domains:       altDomains,
+		APIHost:       apiHost,
+		UDPConns:      sockets.PacketConns("dns"),
+		TCPListeners:  sockets.Listeners("dns"),
+		ProxyProtocol: proxyProto,
+	}
+	if serverFlags.honeypot {
+		dnsSrv.Strays = storagePlugin
+	}
+	var dnsAddrs []string
+	if len(dnsSrv.UDPConns) == 0 && len(dnsSrv.TCPListeners) == 0 {
+		dnsAddrs = listenAddrs(serverFlags.dnsListen, serverFlags.dnsPort)
 	}
-	if err := dnsSrv.Start(serverFlags.dnsPort, serverFlags.dnsPort); err != nil {
+	if err := dnsSrv.Start(dnsAddrs); err != nil {
 		return fmt.Errorf("start DNS server: %w", err)
 	}
 
@@ -163,20 +892,27 @@ func runServer(cmd *cobra.Command, args []string) error {
 
 	httpsLogger := logger.Named("https")
 	if acmeMode {
-		acmeManager := acme.NewManager(serverFlags.domain, serverFlags.acmeEmail, database, serverFlags.acmeStaging, txtStore, serverFlags.publicIP, logger.Named("certmagic"))
+		acmeManager := acme.NewManager(serverFlags.domains, serverFlags.acmeEmail, database, serverFlags.acmeStaging, txtStore, serverFlags.publicIP, logger.Named("certmagic"))
+		acmeManager.Challenge = serverFlags.acmeChal
 
-		logger.Info("starting async certificate management", logging.Domain(serverFlags.domain), zap.Bool("staging", serverFlags.acmeStaging))
+		// Bind the HTTPS listeners first so that TLS-ALPN-01 challenges are
+		// answered on them rather than by a listener of certmagic's own.
+		httpsCfg := catcherServerConfig("", withAccessLog(httpSrv, httpsLogger), httpsLogger)
+		if httpsCfg.Listeners, err = listenAll(sockets, "https", "tcp", listenAddrs(serverFlags.httpsListen, serverFlags.httpsPort)); err != nil {
+			return fmt.Errorf("https server: %w", err)
+		}
+		httpsCfg.Listeners = withProxyProtocol(httpsCfg.Listeners, proxyProto)
+
+		logger.Info("starting async certificate management", logging.Domains(serverFlags.domains), zap.Bool("staging", serverFlags.acmeStaging), zap.String("challenge", serverFlags.acmeChal))
 		if err := acmeManager.Manage(acmeCtx); err != nil {
 			return fmt.Errorf("start ACME certificate management: %w", err)
 		}
 
 		tlsConfig = acmeManager.TLSConfig()
-
-		httpsCfg := server.DefaultServerConfig(fmt.Sprintf(":%d", serverFlags.httpsPort), httpSrv, httpsLogger)
 		httpsCfg.TLSConfig = tlsConfig
 		httpsServer = server.NewManagedServer("https", httpsCfg)
 
-		logger.Info("starting https server", logging.Port(serverFlags.httpsPort), logging.TLSMode("acme"))
+		logger.Info("starting https server", listenerAddrs(httpsCfg.Listeners), logging.TLSMode("acme"))
 		httpsServer.Start()
 		if err := httpsServer.WaitForStartup(100 * time.Millisecond); err != nil {
 			return fmt.Errorf("https server: %w", err)
@@ -196,11 +932,15 @@ func runServer(cmd *cobra.Command, args []string) error {
 			Certificates: []tls.Certificate{cert},
 		}
 
-		httpsCfg := server.DefaultServerConfig(fmt.Sprintf(":%d", serverFlags.httpsPort), httpSrv, httpsLogger)
+		httpsCfg := catcherServerConfig("", withAccessLog(httpSrv, httpsLogger), httpsLogger)
 		httpsCfg.TLSConfig = tlsConfig
+		if httpsCfg.Listeners, err = listenAll(sockets, "https", "tcp", listenAddrs(serverFlags.httpsListen, serverFlags.httpsPort)); err != nil {
+			return fmt.Errorf("https server: %w", err)
+		}
+		httpsCfg.Listeners = withProxyProtocol(httpsCfg.Listeners, proxyProto)
 		httpsServer = server.NewManagedServer("https", httpsCfg)
 
-		logger.Info("starting https server", logging.Port(serverFlags.httpsPort), logging.TLSMode("manual"))
+		logger.Info("starting https server", listenerAddrs(httpsCfg.Listeners), logging.TLSMode("manual"))
 		httpsServer.Start()
 		if err := httpsServer.WaitForStartup(100 * time.Millisecond); err != nil {
 			return fmt.Errorf("https server: %w", err)
@@ -209,45 +949,328 @@ func runServer(cmd *cobra.Command, args []string) error {
 		logger.Info("https disabled", zap.String("reason", "no-acme specified without manual TLS certificates"))
 	}
 
-	apiSrv := &server.APIServer{
-		DB:       database,
-		Domain:   serverFlags.domain,
-		PublicIP: serverFlags.publicIP,
-		Logger:   logger.Named("api"),
-		Plugins:  pipeline,
-	}
 	apiLogger := logger.Named("api")
-	apiCfg := server.DefaultServerConfig(fmt.Sprintf(":%d", serverFlags.apiPort), apiSrv.Handler(), apiLogger)
+	apiCfg := server.DefaultServerConfig("", withAccessLog(apiSrv.Handler(), apiLogger), apiLogger)
+	if apiCfg.Listeners, err = listenAll(sockets, "api", apiNetwork, apiAddrs); err != nil {
+		return fmt.Errorf("api server: %w", err)
+	}
+	apiNetwork = apiCfg.Listeners[0].Addr().Network()
+	apiCfg.Network = apiNetwork
 
-	if tlsConfig != nil {
+	switch {
+	case apiNetwork == "unix":
+		// A unix socket is only reachable locally, typically by a reverse
+		// proxy that terminates TLS itself, so the API is served in plain HTTP.
+		apiServer = server.NewManagedServer("api", apiCfg)
+		logger.Info("starting api server", listenerAddrs(apiCfg.Listeners), logging.TLSMode("none"))
+	case tlsConfig != nil:
 		apiCfg.TLSConfig = tlsConfig
+		if serverFlags.apiClientCA != "" {
+			apiCfg.TLSConfig, err = withClientCA(tlsConfig, serverFlags.apiClientCA)
+			if err != nil {
+				return fmt.Errorf("configure api client certificates: %w", err)
+			}
+		}
 		apiServer = server.NewManagedServer("api", apiCfg)
-		logger.Info("starting api server", logging.Port(serverFlags.apiPort), logging.TLSMode("https"))
+		logger.Info("starting api server", listenerAddrs(apiCfg.Listeners), logging.TLSMode("https"), zap.Bool("mtls", serverFlags.apiClientCA != ""))
+	default:
+		logger.Warn("api server disabled", zap.String("reason", "TLS required but not configured"))
+		for _, ln := range apiCfg.Listeners {
+			_ = ln.Close()
+		}
+	}
+
+	if apiServer != nil {
 		apiServer.Start()
 		if err := apiServer.WaitForStartup(100 * time.Millisecond); err != nil {
 			return fmt.Errorf("api server: %w", err)
 		}
-	} else {
-		logger.Warn("api server disabled", zap.String("reason", "TLS required but not configured"))
+	}
+
+	var debugServer *server.ManagedServer
+	if serverFlags.debugAddr != "" {
+		debugCfg := server.DefaultServerConfig(serverFlags.debugAddr, server.DebugHandler(), logger.Named("debug"))
+		// CPU profiles and traces stream for longer than the default timeout.
+		debugCfg.WriteTimeout = 0
+		debugServer = server.NewManagedServer("debug", debugCfg)
+		logger.Info("starting debug server", logging.Addr(serverFlags.debugAddr))
+		debugServer.Start()
+		if err := debugServer.WaitForStartup(100 * time.Millisecond); err != nil {
+			return fmt.Errorf("debug server: %w", err)
+		}
+	}
+
+	for _, name := range sockets.Close() {
+		logger.Warn("activated socket unused", zap.String("name", name))
+	}
+
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	if serverFlags.purgeAfter > 0 {
+		sweeper := &server.TokenSweeper{
+			Store:     store,
+			Logger:    logger.Named("sweeper"),
+			Retention: serverFlags.purgeAfter,
+			Interval:  tokenSweepInterval,
+		}
+		go sweeper.Run(sweepCtx)
+	}
+	if serverFlags.maintEvery > 0 {
+		maintainer := &server.DBMaintainer{
+			DB:       database,
+			Logger:   logger.Named("db"),
+			Interval: serverFlags.maintEvery,
+		}
+		go maintainer.Run(sweepCtx)
+	}
+	if serverFlags.honeypot && serverFlags.strayKeep > 0 {
+		straySweeper := &server.StraySweeper{
+			Store:     store,
+			Logger:    logger.Named("honeypot"),
+			Retention: serverFlags.strayKeep,
+			Interval:  straySweepInterval,
+		}
+		go straySweeper.Run(sweepCtx)
+	}
+	if store.Blobs != nil {
+		blobSweeper := &server.BlobSweeper{
+			Store:    store,
+			Logger:   logger.Named("blobs"),
+			Grace:    blobSweepGrace,
+			Interval: blobSweepInterval,
+		}
+		go blobSweeper.Run(sweepCtx)
+	}
+
+	listeners := map[string]<-chan error{"http": httpServer.Err(), "dns": dnsSrv.Err()}
+	if httpsServer != nil {
+		listeners["https"] = httpsServer.Err()
+	}
+	if apiServer != nil {
+		listeners["api"] = apiServer.Err()
+	}
+	if debugServer != nil {
+		listeners["debug"] = debugServer.Err()
 	}
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-	<-sigCh
+	var runErr error
+	select {
+	case <-sigCh:
+	case runErr = <-firstFailure(listeners):
+		// Exit rather than keep running without the listener.
+		logger.Error("listener failed", zap.Error(runErr))
+	}
 
-	logger.Info("shutting down")
+	logger.Info("shutting down", zap.Duration("timeout", serverFlags.drainWait))
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), serverFlags.drainWait)
 	defer cancel()
 
-	if httpsServer != nil {
-		httpsServer.Shutdown(ctx)
+	// Stop accepting connections everywhere at once, then wait for the
+	// requests in flight. Interaction streams never finish on their own, so
+	// they are ended first.
+	apiSrv.CloseStreams()
+	var wg sync.WaitGroup
+	for _, srv := range []*server.ManagedServer{httpsServer, httpServer, apiServer, debugServer} {
+		if srv != nil {
+			wg.Go(func() { srv.Shutdown(ctx) })
+		}
 	}
-	httpServer.Shutdown(ctx)
-	if apiServer != nil {
-		apiServer.Shutdown(ctx)
+	wg.Go(func() { dnsSrv.Shutdown(ctx) })
+	wg.Wait()
+
+	// Store what the listeners queued, then send on what plugins queued,
+	// before the deferred closes release the plugins and the database. This
+	// gets a budget of its own, so slow clients cannot leave it none.
+	drainCtx, drainCancel := context.WithTimeout(context.Background(), serverFlags.drainWait)
+	defer drainCancel()
+	if err := pipeline.Drain(drainCtx); err != nil {
+		logger.Error("pipeline drain incomplete", zap.Error(err))
+	}
+	if err := pipeline.Flush(drainCtx); err != nil {
+		logger.Warn("plugin flush error", zap.Error(err))
+	}
+
+	return runErr
+}
+
+// firstFailure returns a channel that receives the first error any of the
+// named listeners fails with, prefixed with its name.
+func firstFailure(listeners map[string]<-chan error) <-chan error {
+	failed := make(chan error, 1)
+	for name, errCh := range listeners {
+		go func() {
+			if err, ok := <-errCh; ok && err != nil {
+				select {
+				case failed <- fmt.Errorf("%s server: %w", name, err):
+				default:
+				}
+			}
+		}()
 	}
-	dnsSrv.Shutdown(ctx)
+	return failed
+}
 
+// registerNativePlugins loads the shared-object plugins in dir and registers
+// them with pipeline. A plugin that fails to load or initialize, or whose ID
+// is already registered, is logged and skipped without affecting the others.
+func registerNativePlugins(dir string, pipeline *plugins.Pipeline, initPlugin func(plugins.Plugin) error, logger *zap.Logger) error {
+	results, err := native.LoadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			logger.Error("load plugin failed", logging.Path(r.Path), zap.Error(r.Err))
+			continue
+		}
+		id := r.Plugin.ID()
+		if _, exists := pipeline.Plugin(id); exists {
+			logger.Error("plugin ID already registered", logging.Path(r.Path), zap.String("plugin", id))
+			continue
+		}
+		if err := initPlugin(r.Plugin); err != nil {
+			logger.Error("init plugin failed", logging.Path(r.Path), zap.String("plugin", id), zap.Error(err))
+			continue
+		}
+		pipeline.Register(r.Plugin)
+		logger.Info("loaded plugin", logging.Path(r.Path), zap.String("plugin", id))
+	}
 	return nil
 }
+
+// registerRemotePlugin starts the plugin executable at path and registers it
+// with pipeline, returning nil if it fails to start, initialize or has an ID
+// that is already registered. Failures are logged without affecting other
+// plugins.
+func registerRemotePlugin(path string, pipeline *plugins.Pipeline, initPlugin func(plugins.Plugin) error, logger *zap.Logger) *remote.Plugin {
+	rp, err := remote.Launch(exec.Command(path), logger.Named("remote"))
+	if err != nil {
+		logger.Error("start plugin failed", logging.Path(path), zap.Error(err))
+		return nil
+	}
+	id := rp.ID()
+	if _, exists := pipeline.Plugin(id); exists {
+		logger.Error("plugin ID already registered", logging.Path(path), zap.String("plugin", id))
+		_ = rp.Close()
+		return nil
+	}
+	if err := initPlugin(rp); err != nil {
+		logger.Error("init plugin failed", logging.Path(path), zap.String("plugin", id), zap.Error(err))
+		_ = rp.Close()
+		return nil
+	}
+	pipeline.Register(rp)
+	logger.Info("started plugin", logging.Path(path), zap.String("plugin", id), zap.Strings("hooks", rp.Hooks()))
+	return rp
+}
+
+// registerWASMPlugin compiles the WebAssembly module at path and registers
+// it with pipeline, returning nil if it fails to compile, initialize or has
+// an ID that is already registered. Failures are logged without affecting
+// other plugins.
+func registerWASMPlugin(path string, pipeline *plugins.Pipeline, initPlugin func(plugins.Plugin) error, logger *zap.Logger) *wasm.Plugin {
+	wp, err := wasm.Load(context.Background(), path)
+	if err != nil {
+		logger.Error("load plugin failed", logging.Path(path), zap.Error(err))
+		return nil
+	}
+	id := wp.ID()
+	if _, exists := pipeline.Plugin(id); exists {
+		logger.Error("plugin ID already registered", logging.Path(path), zap.String("plugin", id))
+		_ = wp.Close()
+		return nil
+	}
+	if err := initPlugin(wp); err != nil {
+		logger.Error("init plugin failed", logging.Path(path), zap.String("plugin", id), zap.Error(err))
+		_ = wp.Close()
+		return nil
+	}
+	pipeline.Register(wp)
+	logger.Info("loaded plugin", logging.Path(path), zap.String("plugin", id), zap.Strings("hooks", wp.Hooks()))
+	return wp
+}
+
+// withClientCA returns a copy of base that requires and verifies client
+// certificates issued by the CAs in caFile.
+func withClientCA(base *tls.Config, caFile string) (*tls.Config, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+
+	cfg := base.Clone()
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	return cfg, nil
+}
+
+// withAccessLog wraps handler to access-log the requests it serves to
+// logger, when enabled.
+func withAccessLog(handler http.Handler, logger *zap.Logger) http.Handler {
+	if !serverFlags.accessLog {
+		return handler
+	}
+	a := &server.AccessLog{Logger: logger.Named("access"), SampleRatio: serverFlags.accessRatio}
+	return a.Middleware(handler)
+}
+
+// listenAddrs returns addrs, or all addresses on port if there are none.
+func listenAddrs(addrs []string, port int) []string {
+	if len(addrs) > 0 {
+		return addrs
+	}
+	return []string{fmt.Sprintf(":%d", port)}
+}
+
+// listenAll returns the sockets systemd passed for name or, without any,
+// listens on network at each of addrs.
+func listenAll(sockets *systemd.Sockets, name, network string, addrs []string) ([]net.Listener, error) {
+	if lns := sockets.Listeners(name); len(lns) > 0 {
+		return lns, nil
+	}
+	var lns []net.Listener
+	for _, addr := range addrs {
+		ln, err := server.Listen(network, addr)
+		if err != nil {
+			for _, ln := range lns {
+				_ = ln.Close()
+			}
+			return nil, err
+		}
+		lns = append(lns, ln)
+	}
+	return lns, nil
+}
+
+// withProxyProtocol wraps lns to read PROXY headers from the load balancers
+// p trusts, when enabled.
+func withProxyProtocol(lns []net.Listener, p *server.ProxyProtocol) []net.Listener {
+	if p == nil {
+		return lns
+	}
+	return p.Listeners(lns)
+}
+
+// listenerAddrs logs the addresses lns listen on.
+func listenerAddrs(lns []net.Listener) zap.Field {
+	addrs := make([]string, len(lns))
+	for i, ln := range lns {
+		addrs[i] = ln.Addr().String()
+	}
+	return logging.Addrs(addrs)
+}
+
+// catcherServerConfig returns the server config for the HTTP(S) listeners that
+// record interactions. The write timeout allows for the longest token delay.
+func catcherServerConfig(addr string, handler http.Handler, logger *zap.Logger) server.Config {
+	cfg := server.DefaultServerConfig(addr, handler, logger)
+	cfg.WriteTimeout += delay.MaxDelay
+	return cfg
+}
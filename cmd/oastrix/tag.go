@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/spf13/cobra"
+)
+
+var tagFlags struct {
+	clientConfig
+}
+
+var tagCmd = &cobra.Command{
+	Use:   "tag <token> [tag...]",
+	Short: "Replace a token's tags",
+	Long:  `Replace the tags of an existing token. Omit the tags to clear them.`,
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runTag,
+}
+
+func init() {
+	rootCmd.AddCommand(tagCmd)
+
+	addClientFlags(tagCmd, &tagFlags.clientConfig)
+}
+
+func runTag(cmd *cobra.Command, args []string) error {
+	c, err := tagFlags.newClient()
+	if err != nil {
+		return err
+	}
+
+	tags := args[1:]
+	info, err := c.UpdateToken(context.Background(), args[0], apitypes.UpdateTokenRequest{Tags: &tags})
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(cmd.OutOrStdout(), string(b))
+	return err
+}
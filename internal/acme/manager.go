@@ -15,19 +15,36 @@ import (
 	"go.uber.org/zap"
 )
 
+// Challenge types for validating the apex certificates. Wildcard
+// certificates can only be validated by DNS-01.
+const (
+	// ChallengeAuto tries DNS-01 and falls back to TLS-ALPN-01.
+	ChallengeAuto = "auto"
+	// ChallengeDNS01 answers _acme-challenge TXT queries from the DNS server.
+	ChallengeDNS01 = "dns-01"
+	// ChallengeTLSALPN01 presents a challenge certificate on the HTTPS
+	// listener, which must be reachable on port 443.
+	ChallengeTLSALPN01 = "tls-alpn-01"
+)
+
 // Manager handles automatic certificate acquisition and renewal via ACME.
 type Manager struct {
-	Domain   string
+	Domains  []string
 	Email    string
 	PublicIP string
 	Staging  bool
 	DB       *sql.DB
 	TXTStore *TXTStore
 	Logger   *zap.Logger
+	// Challenge is the challenge type used for the apex certificates:
+	// ChallengeAuto (the default when empty), ChallengeDNS01 or
+	// ChallengeTLSALPN01.
+	Challenge string
 
-	dnsConfig *certmagic.Config
-	ipConfig  *certmagic.Config
-	storage   *certmagicsqlite.SQLiteStorage
+	dnsConfig  *certmagic.Config
+	apexConfig *certmagic.Config
+	ipConfig   *certmagic.Config
+	storage    *certmagicsqlite.SQLiteStorage
 }
 
 // SetLogger configures the global certmagic loggers.
@@ -40,8 +57,8 @@ func SetLogger(logger *zap.Logger) {
 	certmagic.DefaultACME.Logger = logger
 }
 
-// NewManager creates a new ACME manager.
-func NewManager(domain, email string, db *sql.DB, staging bool, store *TXTStore, publicIP string, logger *zap.Logger) *Manager {
+// NewManager creates a new ACME manager for certificates for domains.
+func NewManager(domains []string, email string, db *sql.DB, staging bool, store *TXTStore, publicIP string, logger *zap.Logger) *Manager {
 	if logger == nil {
 		logger = zap.NewNop()
 	}
@@ -51,7 +68,7 @@ func NewManager(domain, email string, db *sql.DB, staging bool, store *TXTStore,
 	certmagic.DefaultACME.Logger = logger
 
 	return &Manager{
-		Domain:   domain,
+		Domains:  domains,
 		Email:    email,
 		PublicIP: publicIP,
 		Staging:  staging,
@@ -71,8 +88,10 @@ func (m *Manager) newBaseConfig() *certmagic.Config {
 	return cfg
 }
 
-// Manage starts background certificate management for the domain and wildcard.
-// This should be called after the DNS server is started.
+// Manage starts background certificate management for each domain and its
+// wildcard.
+// This should be called after the DNS server is started and the HTTPS
+// listeners are bound, as either may be needed to solve challenges.
 // Certificates are obtained asynchronously; TLS connections will fail gracefully
 // until certificates are available.
 // The provided context controls the lifetime of background certificate management;
@@ -86,10 +105,35 @@ func (m *Manager) Manage(ctx context.Context) error {
 	}
 	m.storage = storage
 
-	// Create the DNS config using the base config helper
-	m.dnsConfig = m.newBaseConfig()
+	if err := m.configure(); err != nil {
+		return err
+	}
+
+	// Manage apex and wildcard certificates asynchronously.
+	// With multi-value TXT support, both can be issued concurrently since
+	// they share _acme-challenge.<domain> but the TXTStore handles multiple values.
+	wildcards := make([]string, 0, len(m.Domains))
+	for _, domain := range m.Domains {
+		wildcards = append(wildcards, "*."+domain)
+	}
+	if err := m.apexConfig.ManageAsync(ctx, m.Domains); err != nil {
+		return fmt.Errorf("manage certificates for %s: %w", strings.Join(m.Domains, ", "), err)
+	}
+	if err := m.dnsConfig.ManageAsync(ctx, wildcards); err != nil {
+		return fmt.Errorf("manage certificates for %s: %w", strings.Join(wildcards, ", "), err)
+	}
+
+	m.Logger.Info("started async certificate management", zap.Strings("domains", m.Domains), zap.String("challenge", m.challenge()))
+
+	return nil
+}
 
-	// Configure the ACME issuer
+// configure creates the certmagic configs for the wildcard certificates,
+// which are validated by DNS-01, and for the apex certificates, which are
+// validated by the challenge types m.Challenge selects. With ChallengeAuto,
+// certmagic tries the DNS-01 issuer first and the TLS-ALPN-01 issuer if it
+// fails.
+func (m *Manager) configure() error {
 	var caURL string
 	if m.Staging {
 		caURL = certmagic.LetsEncryptStagingCA
@@ -100,33 +144,54 @@ func (m *Manager) Manage(ctx context.Context) error {
 	// Create DNS provider using our TXTStore
 	dnsProvider := &Provider{Store: m.TXTStore}
 
-	issuer := certmagic.NewACMEIssuer(m.dnsConfig, certmagic.ACMEIssuer{
-		CA:     caURL,
-		Email:  m.Email,
-		Agreed: true,
-		Logger: m.Logger,
-		DNS01Solver: &certmagic.DNS01Solver{
-			DNSManager: certmagic.DNSManager{
-				DNSProvider: dnsProvider,
-				Logger:      m.Logger,
+	dnsIssuer := func(cfg *certmagic.Config) *certmagic.ACMEIssuer {
+		return certmagic.NewACMEIssuer(cfg, certmagic.ACMEIssuer{
+			CA:     caURL,
+			Email:  m.Email,
+			Agreed: true,
+			Logger: m.Logger,
+			DNS01Solver: &certmagic.DNS01Solver{
+				DNSManager: certmagic.DNSManager{
+					DNSProvider: dnsProvider,
+					Logger:      m.Logger,
+				},
 			},
-		},
-	})
-
-	m.dnsConfig.Issuers = []certmagic.Issuer{issuer}
-
-	// Manage apex and wildcard certificates asynchronously.
-	// With multi-value TXT support, both can be issued concurrently since
-	// they share _acme-challenge.<domain> but the TXTStore handles multiple values.
-	if err := m.dnsConfig.ManageAsync(ctx, []string{m.Domain, "*." + m.Domain}); err != nil {
-		return fmt.Errorf("manage certificates for %s: %w", m.Domain, err)
+		})
+	}
+	alpnIssuer := func(cfg *certmagic.Config) *certmagic.ACMEIssuer {
+		return certmagic.NewACMEIssuer(cfg, certmagic.ACMEIssuer{
+			CA:                   caURL,
+			Email:                m.Email,
+			Agreed:               true,
+			DisableHTTPChallenge: true, // Use TLS-ALPN-01 only
+			Logger:               m.Logger,
+		})
 	}
 
-	m.Logger.Info("started async certificate management", zap.String("domain", m.Domain))
+	m.dnsConfig = m.newBaseConfig()
+	m.dnsConfig.Issuers = []certmagic.Issuer{dnsIssuer(m.dnsConfig)}
 
+	m.apexConfig = m.newBaseConfig()
+	switch m.challenge() {
+	case ChallengeAuto:
+		m.apexConfig.Issuers = []certmagic.Issuer{dnsIssuer(m.apexConfig), alpnIssuer(m.apexConfig)}
+	case ChallengeDNS01:
+		m.apexConfig.Issuers = []certmagic.Issuer{dnsIssuer(m.apexConfig)}
+	case ChallengeTLSALPN01:
+		m.apexConfig.Issuers = []certmagic.Issuer{alpnIssuer(m.apexConfig)}
+	default:
+		return fmt.Errorf("unknown ACME challenge %q", m.Challenge)
+	}
 	return nil
 }
 
+func (m *Manager) challenge() string {
+	if m.Challenge == "" {
+		return ChallengeAuto
+	}
+	return m.Challenge
+}
+
 // ManageIP starts background certificate management for the public IP via HTTP-01.
 // This must be called after the HTTP server is listening on port 80.
 // Only IPv4 is supported; IPv6 HTTP-01 has upstream bugs.
@@ -0,0 +1,64 @@
+package acme
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/caddyserver/certmagic"
+)
+
+func TestManager_ConfigureChallenge(t *testing.T) {
+	tests := []struct {
+		challenge string
+		want      []string // challenge of each apex issuer, in order
+	}{
+		{"", []string{ChallengeDNS01, ChallengeTLSALPN01}},
+		{ChallengeAuto, []string{ChallengeDNS01, ChallengeTLSALPN01}},
+		{ChallengeDNS01, []string{ChallengeDNS01}},
+		{ChallengeTLSALPN01, []string{ChallengeTLSALPN01}},
+	}
+
+	for _, tc := range tests {
+		m := NewManager([]string{"example.com"}, "", nil, true, NewTXTStore(), "", nil)
+		m.Challenge = tc.challenge
+		if err := m.configure(); err != nil {
+			t.Fatalf("configure(%q): %v", tc.challenge, err)
+		}
+
+		if got := issuerChallenges(t, m.apexConfig); !slices.Equal(got, tc.want) {
+			t.Errorf("challenge %q: apex issuers solve %v, want %v", tc.challenge, got, tc.want)
+		}
+		// Wildcards can only be validated by DNS-01.
+		if got := issuerChallenges(t, m.dnsConfig); !slices.Equal(got, []string{ChallengeDNS01}) {
+			t.Errorf("challenge %q: wildcard issuers solve %v, want [dns-01]", tc.challenge, got)
+		}
+	}
+}
+
+func TestManager_ConfigureUnknownChallenge(t *testing.T) {
+	m := NewManager([]string{"example.com"}, "", nil, true, NewTXTStore(), "", nil)
+	m.Challenge = "http-01"
+	if err := m.configure(); err == nil {
+		t.Error("expected error for unknown challenge")
+	}
+}
+
+func issuerChallenges(t *testing.T, cfg *certmagic.Config) []string {
+	t.Helper()
+	var challenges []string
+	for _, iss := range cfg.Issuers {
+		acmeIss, ok := iss.(*certmagic.ACMEIssuer)
+		if !ok {
+			t.Fatalf("unexpected issuer %T", iss)
+		}
+		switch {
+		case acmeIss.DNS01Solver != nil:
+			challenges = append(challenges, ChallengeDNS01)
+		case acmeIss.DisableHTTPChallenge && !acmeIss.DisableTLSALPNChallenge:
+			challenges = append(challenges, ChallengeTLSALPN01)
+		default:
+			t.Fatalf("issuer solves neither DNS-01 nor only TLS-ALPN-01: %+v", acmeIss)
+		}
+	}
+	return challenges
+}
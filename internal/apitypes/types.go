@@ -2,22 +2,67 @@
 package apitypes
 
 // CreateTokenRequest is the request body for creating a new token.
+// At most one of ExpiresAt or TTL may be set; without either the token never
+// expires.
 type CreateTokenRequest struct {
-	Label string `json:"label,omitempty"`
+	Label     string   `json:"label,omitempty"`
+	ExpiresAt string   `json:"expires_at,omitempty"` // RFC 3339 timestamp
+	TTL       string   `json:"ttl,omitempty"`        // Go duration, e.g. "72h"
+	Tags      []string `json:"tags,omitempty"`
 }
 
-// CreateTokenResponse is the response body for token creation.
+// CreateTokenResponse is the response body for token creation. Payloads holds
+// the basic DNS and URL forms; Catalog has the full payload catalog.
 type CreateTokenResponse struct {
-	Token    string            `json:"token"`
-	Payloads map[string]string `json:"payloads"`
+	Token     string            `json:"token"`
+	Payloads  map[string]string `json:"payloads"`
+	Catalog   []Payload         `json:"catalog"`
+	ExpiresAt *string           `json:"expires_at,omitempty"`
+	Tags      []string          `json:"tags,omitempty"`
+}
+
+// Payload is a ready-to-paste string that causes an interaction with a token.
+type Payload struct {
+	Name        string `json:"name"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	Value       string `json:"value"`
+}
+
+// ListPayloadsResponse is the response body for a token's payload catalog.
+type ListPayloadsResponse struct {
+	Token    string    `json:"token"`
+	Payloads []Payload `json:"payloads"`
+}
+
+// UpdateTokenRequest is the request body for updating a token. Omitted fields
+// are left unchanged; an empty label, expires_at or tags list clears it, and
+// tags replaces the existing set. At most one of ExpiresAt or TTL may be set.
+type UpdateTokenRequest struct {
+	Label     *string   `json:"label,omitempty"`
+	ExpiresAt *string   `json:"expires_at,omitempty"` // RFC 3339 timestamp
+	TTL       *string   `json:"ttl,omitempty"`        // Go duration from now, e.g. "72h"
+	Tags      *[]string `json:"tags,omitempty"`
+}
+
+// SetTokenAliasesRequest is the request body for replacing a token's aliases.
+// Each alias is a DNS label that resolves to the token like its own value; an
+// empty list removes them all.
+type SetTokenAliasesRequest struct {
+	Aliases []string `json:"aliases"`
 }
 
 // TokenInfo represents a token with its metadata.
 type TokenInfo struct {
-	Token            string  `json:"token"`
-	Label            *string `json:"label"`
-	CreatedAt        string  `json:"created_at"`
-	InteractionCount int     `json:"interaction_count"`
+	Token            string   `json:"token"`
+	Label            *string  `json:"label"`
+	CreatedAt        string   `json:"created_at"`
+	ExpiresAt        *string  `json:"expires_at"`
+	Expired          bool     `json:"expired"`
+	Enabled          bool     `json:"enabled"`
+	Tags             []string `json:"tags"`
+	Aliases          []string `json:"aliases"`
+	InteractionCount int      `json:"interaction_count"`
 }
 
 // ListTokensResponse is the response body for listing tokens.
@@ -47,6 +92,9 @@ type HTTPInteractionDetail struct {
 	Query   string              `json:"query"`
 	Headers map[string][]string `json:"headers"`
 	Body    string              `json:"body"`
+
+	// Response is the response sent, if it has been recorded.
+	Response *HTTPResponseV2 `json:"response,omitempty"`
 }
 
 // DNSInteractionDetail contains DNS-specific interaction details.
@@ -58,6 +106,9 @@ type DNSInteractionDetail struct {
 	Opcode   int    `json:"opcode"`
 	DNSID    int    `json:"dns_id"`
 	Protocol string `json:"protocol"`
+
+	// Response is the response sent, if it has been recorded.
+	Response *DNSResponseV2 `json:"response,omitempty"`
 }
 
 // GetInteractionsResponse is the response body for retrieving interactions.
@@ -66,21 +117,144 @@ type GetInteractionsResponse struct {
 	Interactions []InteractionResponse `json:"interactions"`
 }
 
+// ImportInteractionsResponse is the response body for importing interactions.
+type ImportInteractionsResponse struct {
+	Imported int `json:"imported"`
+}
+
 // DeleteTokenResponse is the response body for token deletion.
 type DeleteTokenResponse struct {
 	Deleted bool `json:"deleted"`
 }
 
+// TokenQuota caps how many interactions a token records. Without a Window, Max
+// caps the total stored; with one, it caps interactions per rolling window.
+// Policy is "drop", "coalesce" (count overflow on the newest stored
+// interaction) or "keep_newest" (delete the oldest; not valid with a Window).
+type TokenQuota struct {
+	Max    int    `json:"max"`
+	Window string `json:"window,omitempty"` // Go duration, e.g. "1m"
+	Policy string `json:"policy"`
+}
+
+// TokenHTTPResponse is the response served for a token's HTTP interactions
+// in place of the default. Status defaults to 200. Binary bodies are given
+// base64 encoded in BodyBase64 instead of Body. With Template set, Body is a
+// Go text/template with the request's Token, Method, Scheme, Host, Path,
+// RawQuery, Query, Headers, Body, RemoteIP and Time.
+type TokenHTTPResponse struct {
+	Status     int               `json:"status,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	BodyBase64 string            `json:"body_base64,omitempty"`
+	Template   bool              `json:"template,omitempty"`
+}
+
+// TokenDelay holds back a token's responses by Delay plus a random duration of
+// up to Jitter, at most five minutes in total. Protocols limits the delay to
+// "http" or "dns"; empty applies it to both.
+type TokenDelay struct {
+	Delay     string   `json:"delay"`            // Go duration, e.g. "10s"
+	Jitter    string   `json:"jitter,omitempty"` // Go duration
+	Protocols []string `json:"protocols,omitempty"`
+}
+
+// TokenRedirect answers a token's HTTP interactions with a redirect to URL,
+// which may use any scheme and port. Status is 301, 302, 303, 307 or 308 and
+// defaults to 302. With AppendPath, the request path and query are appended.
+type TokenRedirect struct {
+	URL        string `json:"url"`
+	Status     int    `json:"status,omitempty"`
+	AppendPath bool   `json:"append_path,omitempty"`
+}
+
+// TokenOverrides replaces the status code and sets headers on a token's
+// default HTTP response, keeping its body. Tokens with a redirect or custom
+// HTTP response are not affected.
+type TokenOverrides struct {
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// TokenBasicAuth enables an HTTP Basic challenge for a token, recording the
+// credentials presented in the "basic_auth" attribute. Realm defaults to
+// "Restricted". With Accept, requests presenting credentials get the token's
+// usual response instead of another challenge.
+type TokenBasicAuth struct {
+	Realm  string `json:"realm,omitempty"`
+	Accept bool   `json:"accept,omitempty"`
+}
+
+// TokenNTLM enables NTLM capture for a token, recording authenticate messages
+// in the "ntlm" attribute. Domain is the NetBIOS domain announced in the
+// challenge and Challenge the 8-byte server challenge in hex; they default to
+// "OASTRIX" and "1122334455667788". With Accept, requests completing the
+// handshake get the token's usual response instead of another challenge.
+type TokenNTLM struct {
+	Domain    string `json:"domain,omitempty"`
+	Challenge string `json:"challenge,omitempty"`
+	Accept    bool   `json:"accept,omitempty"`
+}
+
+// TokenFile describes a file served under a token's host. URL is where the
+// file is fetched from.
+type TokenFile struct {
+	Path        string `json:"path"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	CreatedAt   string `json:"created_at"`
+	URL         string `json:"url"`
+}
+
+// ListTokenFilesResponse is the response body for listing a token's files.
+type ListTokenFilesResponse struct {
+	Token string      `json:"token"`
+	Files []TokenFile `json:"files"`
+}
+
+// DeleteTokenFileResponse is the response body for removing a token's file.
+type DeleteTokenFileResponse struct {
+	Deleted bool `json:"deleted"`
+}
+
+// DeleteTokenConfigResponse is the response body for removing a token's
+// plugin configuration.
+type DeleteTokenConfigResponse struct {
+	Deleted bool `json:"deleted"`
+}
+
+// DeletePluginConfigResponse is the response body for resetting a plugin's
+// server-wide configuration.
+type DeletePluginConfigResponse struct {
+	Deleted bool `json:"deleted"`
+}
+
+// PurgeInteractionsRequest is the request body for purging interactions.
+// Exactly one of OlderThan or Before must be set.
+type PurgeInteractionsRequest struct {
+	OlderThan string `json:"older_than,omitempty"` // Go duration, e.g. "720h"
+	Before    string `json:"before,omitempty"`     // RFC 3339 timestamp
+}
+
+// PurgeInteractionsResponse is the response body for interaction purges.
+type PurgeInteractionsResponse struct {
+	Deleted int64 `json:"deleted"`
+}
+
 // ErrorResponse represents an API error response.
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
-// PluginInfo represents a registered plugin and its configuration.
+// PluginInfo represents a registered plugin and its configuration. A plugin
+// is unhealthy once one of its hooks has panicked; Problem describes the
+// panic.
 type PluginInfo struct {
 	ID      string         `json:"id"`
 	Type    string         `json:"type"`
 	Enabled bool           `json:"enabled"`
+	Healthy bool           `json:"healthy"`
+	Problem string         `json:"problem,omitempty"`
 	Config  map[string]any `json:"config,omitempty"`
 }
 
@@ -0,0 +1,138 @@
+package apitypes
+
+// InteractionV2 is the v2 representation of a recorded interaction, including
+// plugin attributes and the response that was sent.
+type InteractionV2 struct {
+	ID         int64          `json:"id"`
+	Token      string         `json:"token"`
+	Kind       string         `json:"kind"`
+	OccurredAt string         `json:"occurred_at"`
+	Remote     RemoteEndpoint `json:"remote"`
+	TLS        bool           `json:"tls"`
+	Summary    string         `json:"summary"`
+	Attributes map[string]any `json:"attributes"`
+	HTTP       *HTTPDetailV2  `json:"http,omitempty"`
+	DNS        *DNSDetailV2   `json:"dns,omitempty"`
+}
+
+// RemoteEndpoint identifies the client that caused an interaction.
+type RemoteEndpoint struct {
+	IP   string `json:"ip"`
+	Port int    `json:"port"`
+}
+
+// HTTPDetailV2 contains the HTTP request and the response that was sent.
+type HTTPDetailV2 struct {
+	Request  HTTPRequestV2   `json:"request"`
+	Response *HTTPResponseV2 `json:"response"`
+}
+
+// HTTPRequestV2 describes a received HTTP request. Body is base64-encoded.
+type HTTPRequestV2 struct {
+	Method  string              `json:"method"`
+	Scheme  string              `json:"scheme"`
+	Host    string              `json:"host"`
+	Path    string              `json:"path"`
+	Query   string              `json:"query"`
+	Proto   string              `json:"proto"`
+	Headers map[string][]string `json:"headers"`
+	Body    string              `json:"body"`
+}
+
+// HTTPResponseV2 describes the HTTP response sent. Body is base64-encoded
+// and holds at most the first 4KB sent; BodySize and BodySHA256 describe the
+// whole body.
+type HTTPResponseV2 struct {
+	Status     int               `json:"status"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+	BodySize   int               `json:"body_size"`
+	BodySHA256 string            `json:"body_sha256,omitempty"`
+}
+
+// DNSDetailV2 contains the DNS question and the response that was sent.
+type DNSDetailV2 struct {
+	Query    DNSQueryV2     `json:"query"`
+	Response *DNSResponseV2 `json:"response"`
+}
+
+// DNSQueryV2 describes a received DNS question.
+type DNSQueryV2 struct {
+	QName    string `json:"qname"`
+	QType    int    `json:"qtype"`
+	QClass   int    `json:"qclass"`
+	RD       bool   `json:"rd"`
+	Opcode   int    `json:"opcode"`
+	DNSID    int    `json:"dns_id"`
+	Protocol string `json:"protocol"`
+}
+
+// DNSResponseV2 describes the DNS response sent. Answers are resource records
+// in presentation format.
+type DNSResponseV2 struct {
+	RCode   int      `json:"rcode"`
+	Answers []string `json:"answers"`
+}
+
+// Pagination describes how to fetch the next page of a list response.
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListInteractionsV2Response is the paginated response body for listing a
+// token's interactions, newest first.
+type ListInteractionsV2Response struct {
+	Data       []InteractionV2 `json:"data"`
+	Pagination Pagination      `json:"pagination"`
+}
+
+// StrayInteractionV2 is traffic to the domain that carried no token, or one
+// that does not exist, as recorded in honeypot mode. Body is base64-encoded
+// and holds at most the first 4KB of the request body or raw capture.
+type StrayInteractionV2 struct {
+	ID         int64          `json:"id"`
+	Token      string         `json:"token,omitempty"`
+	Kind       string         `json:"kind"`
+	OccurredAt string         `json:"occurred_at"`
+	Remote     RemoteEndpoint `json:"remote"`
+	TLS        bool           `json:"tls"`
+	Summary    string         `json:"summary"`
+	HTTP       *HTTPRequestV2 `json:"http,omitempty"`
+	DNS        *DNSQueryV2    `json:"dns,omitempty"`
+	Fields     map[string]any `json:"fields,omitempty"`
+	Body       string         `json:"body,omitempty"`
+}
+
+// ListStrayInteractionsV2Response is the paginated response body for
+// listing stray interactions, newest first.
+type ListStrayInteractionsV2Response struct {
+	Data       []StrayInteractionV2 `json:"data"`
+	Pagination Pagination           `json:"pagination"`
+}
+
+// CreateCollaboratorSessionRequest is the request body for binding a token
+// to the biid of the Burp project that will poll it as a Collaborator server.
+type CreateCollaboratorSessionRequest struct {
+	BIID string `json:"biid"`
+}
+
+// CreateCollaboratorSessionResponse is the response body for binding a
+// token to a Burp Collaborator biid.
+type CreateCollaboratorSessionResponse struct {
+	Created bool `json:"created"`
+}
+
+// DeleteCollaboratorSessionResponse is the response body for unbinding a
+// token from the Burp Collaborator biid polling it.
+type DeleteCollaboratorSessionResponse struct {
+	Deleted bool `json:"deleted"`
+}
+
+// LogLevels is the request and response body for the server's log levels:
+// a default level followed by per-logger overrides, e.g.
+// "info,dns=debug,certmagic=warn".
+type LogLevels struct {
+	Levels string `json:"levels"`
+}
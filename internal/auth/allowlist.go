@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ParseAllowlist parses CIDR ranges, accepting bare IP addresses as single-host ranges.
+func ParseAllowlist(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowlist entry %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowlist entry %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// IPAllowed reports whether ip falls within any of the allowlisted ranges.
+// An empty allowlist permits every address.
+func IPAllowed(ip netip.Addr, allowlist []netip.Prefix) bool {
+	if len(allowlist) == 0 {
+		return true
+	}
+	ip = ip.Unmap()
+	for _, prefix := range allowlist {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseAllowlist(t *testing.T) {
+	prefixes, err := ParseAllowlist([]string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32"})
+	if err != nil {
+		t.Fatalf("ParseAllowlist failed: %v", err)
+	}
+	want := []string{"10.0.0.0/8", "192.0.2.7/32", "2001:db8::/32"}
+	for i, p := range prefixes {
+		if p.String() != want[i] {
+			t.Errorf("prefix %d = %s, want %s", i, p, want[i])
+		}
+	}
+
+	if _, err := ParseAllowlist([]string{"not-an-ip"}); err == nil {
+		t.Error("expected error for invalid entry")
+	}
+}
+
+func TestIPAllowed(t *testing.T) {
+	allowlist, err := ParseAllowlist([]string{"10.0.0.0/8", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("ParseAllowlist failed: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"::ffff:10.1.2.3", true},
+		{"192.0.2.1", false},
+		{"2001:db8::1", true},
+		{"2001:db8::2", false},
+	}
+	for _, tt := range tests {
+		if got := IPAllowed(netip.MustParseAddr(tt.ip), allowlist); got != tt.want {
+			t.Errorf("IPAllowed(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+
+	if !IPAllowed(netip.MustParseAddr("192.0.2.1"), nil) {
+		t.Error("empty allowlist should permit every address")
+	}
+}
@@ -2,6 +2,7 @@
 package auth
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
@@ -16,12 +17,22 @@ const (
 	secretBytes   = 32
 )
 
+// Hash versions identify how a stored API key hash was computed.
+const (
+	// HashVersionSHA256 is an unpeppered SHA-256 of the secret, used by keys
+	// created before peppering was introduced.
+	HashVersionSHA256 = 1
+	// HashVersionHMAC is an HMAC-SHA256 of the secret keyed with the server pepper.
+	HashVersionHMAC = 2
+)
+
 // ErrInvalidKeyFormat is returned when an API key does not match the expected format.
 var ErrInvalidKeyFormat = errors.New("invalid API key format")
 
-// GenerateAPIKey creates a new API key and returns the display key, prefix, and hash.
+// GenerateAPIKey creates a new API key and returns the display key, prefix, and
+// hash. The hash is computed with HashSecret using the given pepper.
 // The display key format is: oastrix_<prefix>_<secret>.
-func GenerateAPIKey() (displayKey string, prefix string, hash []byte, err error) {
+func GenerateAPIKey(pepper []byte) (displayKey string, prefix string, hash []byte, err error) {
 	prefixBytes := make([]byte, prefixLength)
 	if _, err := rand.Read(prefixBytes); err != nil {
 		return "", "", nil, err
@@ -38,24 +49,44 @@ func GenerateAPIKey() (displayKey string, prefix string, hash []byte, err error)
 	secret := encodeBase62(secretRaw)
 
 	displayKey = servicePrefix + "_" + prefix + "_" + secret
-	hash = HashSecret(secret)
+	hash = HashSecret(secret, pepper)
 
 	return displayKey, prefix, hash, nil
 }
 
-// HashSecret computes the SHA-256 hash of an API key secret.
-func HashSecret(secret string) []byte {
+// HashSecret computes the HMAC-SHA256 of an API key secret keyed with the pepper.
+// Because the pepper is kept outside the database, a copy of the database
+// alone is not enough to test candidate keys against stored hashes.
+func HashSecret(secret string, pepper []byte) []byte {
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(secret))
+	return mac.Sum(nil)
+}
+
+// LegacyHashSecret computes the unpeppered SHA-256 hash of an API key secret.
+// It exists only to verify keys stored with HashVersionSHA256.
+func LegacyHashSecret(secret string) []byte {
 	h := sha256.Sum256([]byte(secret))
 	return h[:]
 }
 
-// VerifyAPIKey validates an API key by comparing its secret hash against a stored hash.
-func VerifyAPIKey(displayKey string, storedHash []byte) bool {
+// VerifyAPIKey validates an API key by comparing its peppered secret hash against a stored hash.
+func VerifyAPIKey(displayKey string, storedHash []byte, pepper []byte) bool {
+	prefix, secret, err := ParseAPIKey(displayKey)
+	if err != nil || prefix == "" {
+		return false
+	}
+	computedHash := HashSecret(secret, pepper)
+	return subtle.ConstantTimeCompare(computedHash, storedHash) == 1
+}
+
+// VerifyLegacyAPIKey validates an API key against a hash stored with HashVersionSHA256.
+func VerifyLegacyAPIKey(displayKey string, storedHash []byte) bool {
 	prefix, secret, err := ParseAPIKey(displayKey)
 	if err != nil || prefix == "" {
 		return false
 	}
-	computedHash := HashSecret(secret)
+	computedHash := LegacyHashSecret(secret)
 	return subtle.ConstantTimeCompare(computedHash, storedHash) == 1
 }
 
@@ -5,8 +5,10 @@ import (
 	"testing"
 )
 
+var testPepper = []byte("test-pepper")
+
 func TestGenerateAPIKey(t *testing.T) {
-	displayKey, prefix, hash, err := GenerateAPIKey()
+	displayKey, prefix, hash, err := GenerateAPIKey(testPepper)
 	if err != nil {
 		t.Fatalf("GenerateAPIKey failed: %v", err)
 	}
@@ -40,45 +42,70 @@ func TestGenerateAPIKey(t *testing.T) {
 	}
 
 	if len(hash) != 32 {
-		t.Errorf("hash length = %d, want 32 (SHA256)", len(hash))
+		t.Errorf("hash length = %d, want 32 (HMAC-SHA256)", len(hash))
 	}
 }
 
 func TestHashSecretDeterministic(t *testing.T) {
 	secret := "test-secret-value"
 
-	hash1 := HashSecret(secret)
-	hash2 := HashSecret(secret)
+	hash1 := HashSecret(secret, testPepper)
+	hash2 := HashSecret(secret, testPepper)
 
 	if string(hash1) != string(hash2) {
 		t.Error("HashSecret is not deterministic")
 	}
 
 	differentSecret := "different-secret"
-	hash3 := HashSecret(differentSecret)
+	hash3 := HashSecret(differentSecret, testPepper)
 	if string(hash1) == string(hash3) {
 		t.Error("HashSecret should produce different results with different secret")
 	}
+
+	hash4 := HashSecret(secret, []byte("other-pepper"))
+	if string(hash1) == string(hash4) {
+		t.Error("HashSecret should produce different results with different pepper")
+	}
+
+	if string(hash1) == string(LegacyHashSecret(secret)) {
+		t.Error("HashSecret should differ from the unpeppered legacy hash")
+	}
 }
 
 func TestVerifyAPIKey(t *testing.T) {
-	displayKey, _, hash, err := GenerateAPIKey()
+	displayKey, _, hash, err := GenerateAPIKey(testPepper)
 	if err != nil {
 		t.Fatalf("GenerateAPIKey failed: %v", err)
 	}
 
-	if !VerifyAPIKey(displayKey, hash) {
+	if !VerifyAPIKey(displayKey, hash, testPepper) {
 		t.Error("VerifyAPIKey should return true for valid key")
 	}
 
-	if VerifyAPIKey("oastrix_invalid12345_key", hash) {
+	if VerifyAPIKey("oastrix_invalid12345_key", hash, testPepper) {
 		t.Error("VerifyAPIKey should return false for invalid key")
 	}
 
 	wrongHash := make([]byte, 32)
-	if VerifyAPIKey(displayKey, wrongHash) {
+	if VerifyAPIKey(displayKey, wrongHash, testPepper) {
 		t.Error("VerifyAPIKey should return false with wrong hash")
 	}
+
+	if VerifyAPIKey(displayKey, hash, []byte("other-pepper")) {
+		t.Error("VerifyAPIKey should return false with wrong pepper")
+	}
+}
+
+func TestVerifyLegacyAPIKey(t *testing.T) {
+	displayKey := "oastrix_abcdef123456_somesecretvalue123"
+	legacyHash := LegacyHashSecret("somesecretvalue123")
+
+	if !VerifyLegacyAPIKey(displayKey, legacyHash) {
+		t.Error("VerifyLegacyAPIKey should return true for valid legacy hash")
+	}
+	if VerifyAPIKey(displayKey, legacyHash, testPepper) {
+		t.Error("VerifyAPIKey should not accept a legacy hash")
+	}
 }
 
 func TestParseAPIKey(t *testing.T) {
@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+const pepperBytes = 32
+
+// LoadPepper reads the hex-encoded pepper stored at path. The error wraps
+// fs.ErrNotExist if there is no such file.
+func LoadPepper(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read pepper file: %w", err)
+	}
+	pepper, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, fmt.Errorf("decode pepper file %s: %w", path, err)
+	}
+	if len(pepper) == 0 {
+		return nil, fmt.Errorf("pepper file %s is empty", path)
+	}
+	return pepper, nil
+}
+
+// LoadOrCreatePepper reads the hex-encoded pepper stored at path, generating
+// and writing a new random pepper with owner-only permissions if the file does
+// not exist. The pepper must be kept separate from the database.
+func LoadOrCreatePepper(path string) ([]byte, error) {
+	pepper, err := LoadPepper(path)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return pepper, err
+	}
+
+	pepper = make([]byte, pepperBytes)
+	if _, err := rand.Read(pepper); err != nil {
+		return nil, fmt.Errorf("generate pepper: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("create pepper file: %w", err)
+	}
+	if _, err := f.WriteString(hex.EncodeToString(pepper) + "\n"); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("write pepper file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("close pepper file: %w", err)
+	}
+
+	return pepper, nil
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadOrCreatePepper(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pepper")
+
+	created, err := LoadOrCreatePepper(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreatePepper (create) failed: %v", err)
+	}
+	if len(created) != pepperBytes {
+		t.Errorf("pepper length = %d, want %d", len(created), pepperBytes)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat pepper file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("pepper file permissions = %o, want 600", perm)
+	}
+
+	loaded, err := LoadOrCreatePepper(path)
+	if err != nil {
+		t.Fatalf("LoadOrCreatePepper (load) failed: %v", err)
+	}
+	if string(loaded) != string(created) {
+		t.Error("loaded pepper does not match created pepper")
+	}
+}
+
+func TestLoadOrCreatePepper_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pepper")
+	if err := os.WriteFile(path, []byte("not hex"), 0o600); err != nil {
+		t.Fatalf("write pepper file: %v", err)
+	}
+
+	if _, err := LoadOrCreatePepper(path); err == nil {
+		t.Error("expected error for malformed pepper file")
+	}
+}
+
+func TestLoadPepper_Missing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pepper")
+	if _, err := LoadPepper(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("LoadPepper error = %v, want fs.ErrNotExist", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Error("LoadPepper created the pepper file")
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+import "fmt"
+
+// Scope determines which API operations a key may perform.
+type Scope string
+
+// API key scopes.
+const (
+	// ScopeRead permits listing tokens and fetching interactions.
+	ScopeRead Scope = "read"
+	// ScopeFull permits every operation on the key's own tokens, including
+	// creating and deleting them.
+	ScopeFull Scope = "full"
+	// ScopeAdmin permits everything ScopeFull does, and operations affecting
+	// every key, such as configuring plugins server-wide. It is meant for the
+	// server's operators, not for the keys handed out to its users.
+	ScopeAdmin Scope = "admin"
+)
+
+// ParseScope validates a scope name.
+func ParseScope(s string) (Scope, error) {
+	switch Scope(s) {
+	case ScopeRead, ScopeFull, ScopeAdmin:
+		return Scope(s), nil
+	default:
+		return "", fmt.Errorf("unknown scope %q (want %q, %q or %q)", s, ScopeRead, ScopeFull, ScopeAdmin)
+	}
+}
+
+// Allows reports whether a key with scope s may perform an operation requiring scope required.
+func (s Scope) Allows(required Scope) bool {
+	switch required {
+	case ScopeRead:
+		return s == ScopeRead || s == ScopeFull || s == ScopeAdmin
+	case ScopeFull:
+		return s == ScopeFull || s == ScopeAdmin
+	case ScopeAdmin:
+		return s == ScopeAdmin
+	default:
+		return false
+	}
+}
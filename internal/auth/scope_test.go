@@ -0,0 +1,40 @@
+package auth
+
+import "testing"
+
+func TestScopeAllows(t *testing.T) {
+	tests := []struct {
+		scope    Scope
+		required Scope
+		want     bool
+	}{
+		{ScopeFull, ScopeFull, true},
+		{ScopeFull, ScopeRead, true},
+		{ScopeRead, ScopeRead, true},
+		{ScopeRead, ScopeFull, false},
+		{"", ScopeRead, false},
+		{ScopeAdmin, ScopeAdmin, true},
+		{ScopeAdmin, ScopeFull, true},
+		{ScopeAdmin, ScopeRead, true},
+		{ScopeFull, ScopeAdmin, false},
+		{ScopeRead, ScopeAdmin, false},
+		{"root", ScopeFull, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.scope.Allows(tt.required); got != tt.want {
+			t.Errorf("Scope(%q).Allows(%q) = %v, want %v", tt.scope, tt.required, got, tt.want)
+		}
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	for _, valid := range []string{"read", "full", "admin"} {
+		if _, err := ParseScope(valid); err != nil {
+			t.Errorf("ParseScope(%q) unexpected error: %v", valid, err)
+		}
+	}
+	if _, err := ParseScope("write"); err == nil {
+		t.Error("ParseScope(\"write\") expected error")
+	}
+}
@@ -9,6 +9,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rsclarke/oastrix/internal/apitypes"
@@ -51,9 +54,8 @@ func WithHTTPClient(httpClient HTTPClient) Option {
 	}
 }
 
-// CreateToken creates a new token with the given label.
-func (c *Client) CreateToken(ctx context.Context, label string) (*apitypes.CreateTokenResponse, error) {
-	reqBody := apitypes.CreateTokenRequest{Label: label}
+// CreateToken creates a new token with the given label and optional expiry.
+func (c *Client) CreateToken(ctx context.Context, reqBody apitypes.CreateTokenRequest) (*apitypes.CreateTokenResponse, error) {
 	body, err := json.Marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("marshal request: %w", err)
@@ -85,7 +87,43 @@ func (c *Client) CreateToken(ctx context.Context, label string) (*apitypes.Creat
 
 // GetInteractions retrieves all interactions for the specified token.
 func (c *Client) GetInteractions(ctx context.Context, token string) (*apitypes.GetInteractionsResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/v1/tokens/"+token+"/interactions", nil)
+	return c.GetInteractionsSince(ctx, token, 0)
+}
+
+// GetInteractionsSince retrieves interactions for the specified token with an ID
+// greater than sinceID. A sinceID of zero returns all interactions.
+func (c *Client) GetInteractionsSince(ctx context.Context, token string, sinceID int64) (*apitypes.GetInteractionsResponse, error) {
+	return c.ListInteractions(ctx, token, InteractionFilter{SinceID: sinceID})
+}
+
+// InteractionFilter narrows the interactions returned by ListInteractions.
+// Zero-valued fields do not filter.
+type InteractionFilter struct {
+	SinceID    int64             // only interactions with a greater ID
+	Attributes map[string]string // only interactions with these attribute values, or lists containing them
+}
+
+// values encodes f as query parameters.
+func (f InteractionFilter) values() url.Values {
+	q := url.Values{}
+	if f.SinceID > 0 {
+		q.Set("since_id", strconv.FormatInt(f.SinceID, 10))
+	}
+	for key, value := range f.Attributes {
+		q.Set("attr."+key, value)
+	}
+	return q
+}
+
+// ListInteractions retrieves the interactions for the specified token that
+// match filter.
+func (c *Client) ListInteractions(ctx context.Context, token string, filter InteractionFilter) (*apitypes.GetInteractionsResponse, error) {
+	u := c.BaseURL + "/v1/tokens/" + token + "/interactions"
+	if encoded := filter.values().Encode(); encoded != "" {
+		u += "?" + encoded
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -108,9 +146,64 @@ func (c *Client) GetInteractions(ctx context.Context, token string) (*apitypes.G
 	return &result, nil
 }
 
-// ListTokens retrieves all tokens associated with the API key.
-func (c *Client) ListTokens(ctx context.Context) (*apitypes.ListTokensResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+"/v1/tokens", nil)
+// ExportInteractions writes the interactions for the specified token that
+// match filter to w, newest first, in format: "ndjson", one v2 interaction
+// per line, "csv", or "cef" or "leef", one SIEM event per line.
+func (c *Client) ExportInteractions(ctx context.Context, token, format string, filter InteractionFilter, w io.Writer) error {
+	q := filter.values()
+	q.Set("format", format)
+	u := c.BaseURL + "/v1/tokens/" + token + "/interactions/export?" + q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return parseError(resp)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("read export: %w", err)
+	}
+	return nil
+}
+
+// ImportInteractions restores interactions from an NDJSON export read from r
+// under the specified token.
+func (c *Client) ImportInteractions(ctx context.Context, token string, r io.Reader) (*apitypes.ImportInteractionsResponse, error) {
+	var result apitypes.ImportInteractionsResponse
+	if err := c.do(ctx, "POST", "/v1/tokens/"+token+"/interactions/import", "application/x-ndjson", r, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// TokenFilter narrows the tokens returned by ListTokens. Zero-valued fields do
+// not filter.
+type TokenFilter struct {
+	Tags  []string // only tokens carrying all of these tags
+	Label string   // only tokens whose label contains this, ignoring case
+}
+
+// ListTokens retrieves the tokens associated with the API key that match filter.
+func (c *Client) ListTokens(ctx context.Context, filter TokenFilter) (*apitypes.ListTokensResponse, error) {
+	u := c.BaseURL + "/v1/tokens"
+	q := url.Values{"tag": filter.Tags}
+	if filter.Label != "" {
+		q.Set("label", filter.Label)
+	}
+	if encoded := q.Encode(); encoded != "" {
+		u += "?" + encoded
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
@@ -154,6 +247,454 @@ func (c *Client) DeleteToken(ctx context.Context, token string) error {
 	return nil
 }
 
+// UpdateToken changes the label or expiry of the specified token.
+func (c *Client) UpdateToken(ctx context.Context, token string, update apitypes.UpdateTokenRequest) (*apitypes.TokenInfo, error) {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PATCH", c.BaseURL+"/v1/tokens/"+token, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseError(resp)
+	}
+
+	var result apitypes.TokenInfo
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// SetTokenAliases replaces the subdomain aliases of the specified token.
+func (c *Client) SetTokenAliases(ctx context.Context, token string, aliases []string) (*apitypes.TokenInfo, error) {
+	body, err := json.Marshal(apitypes.SetTokenAliasesRequest{Aliases: aliases})
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "PUT", c.BaseURL+"/v1/tokens/"+token+"/aliases", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseError(resp)
+	}
+
+	var result apitypes.TokenInfo
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// EnableToken resumes recording interactions for the specified token.
+func (c *Client) EnableToken(ctx context.Context, token string) (*apitypes.TokenInfo, error) {
+	return c.tokenAction(ctx, token, "enable")
+}
+
+// DisableToken pauses the specified token without deleting its interactions.
+func (c *Client) DisableToken(ctx context.Context, token string) (*apitypes.TokenInfo, error) {
+	return c.tokenAction(ctx, token, "disable")
+}
+
+func (c *Client) tokenAction(ctx context.Context, token, action string) (*apitypes.TokenInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+"/v1/tokens/"+token+"/"+action, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseError(resp)
+	}
+
+	var result apitypes.TokenInfo
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// ListPayloads retrieves the payload catalog of the specified token.
+func (c *Client) ListPayloads(ctx context.Context, token, domain string) (*apitypes.ListPayloadsResponse, error) {
+	path := "/v1/tokens/" + token + "/payloads"
+	if domain != "" {
+		path += "?" + url.Values{"domain": {domain}}.Encode()
+	}
+	var result apitypes.ListPayloadsResponse
+	if err := c.doJSON(ctx, "GET", path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetTokenQuota retrieves the interaction quota of the specified token.
+func (c *Client) GetTokenQuota(ctx context.Context, token string) (*apitypes.TokenQuota, error) {
+	var result apitypes.TokenQuota
+	if err := c.doJSON(ctx, "GET", "/v1/tokens/"+token+"/quota", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetTokenQuota replaces the interaction quota of the specified token.
+func (c *Client) SetTokenQuota(ctx context.Context, token string, q apitypes.TokenQuota) (*apitypes.TokenQuota, error) {
+	var result apitypes.TokenQuota
+	if err := c.doJSON(ctx, "PUT", "/v1/tokens/"+token+"/quota", q, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteTokenQuota removes the interaction quota of the specified token.
+func (c *Client) DeleteTokenQuota(ctx context.Context, token string) error {
+	return c.doJSON(ctx, "DELETE", "/v1/tokens/"+token+"/quota", nil, nil)
+}
+
+// GetTokenHTTPResponse retrieves the custom HTTP response of the specified token.
+func (c *Client) GetTokenHTTPResponse(ctx context.Context, token string) (*apitypes.TokenHTTPResponse, error) {
+	var result apitypes.TokenHTTPResponse
+	if err := c.doJSON(ctx, "GET", "/v1/tokens/"+token+"/http-response", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetTokenHTTPResponse replaces the custom HTTP response of the specified token.
+func (c *Client) SetTokenHTTPResponse(ctx context.Context, token string, resp apitypes.TokenHTTPResponse) (*apitypes.TokenHTTPResponse, error) {
+	var result apitypes.TokenHTTPResponse
+	if err := c.doJSON(ctx, "PUT", "/v1/tokens/"+token+"/http-response", resp, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteTokenHTTPResponse removes the custom HTTP response of the specified
+// token, restoring the default.
+func (c *Client) DeleteTokenHTTPResponse(ctx context.Context, token string) error {
+	return c.doJSON(ctx, "DELETE", "/v1/tokens/"+token+"/http-response", nil, nil)
+}
+
+// GetTokenDelay retrieves the response delay of the specified token.
+func (c *Client) GetTokenDelay(ctx context.Context, token string) (*apitypes.TokenDelay, error) {
+	var result apitypes.TokenDelay
+	if err := c.doJSON(ctx, "GET", "/v1/tokens/"+token+"/delay", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetTokenDelay replaces the response delay of the specified token.
+func (c *Client) SetTokenDelay(ctx context.Context, token string, d apitypes.TokenDelay) (*apitypes.TokenDelay, error) {
+	var result apitypes.TokenDelay
+	if err := c.doJSON(ctx, "PUT", "/v1/tokens/"+token+"/delay", d, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteTokenDelay removes the response delay of the specified token.
+func (c *Client) DeleteTokenDelay(ctx context.Context, token string) error {
+	return c.doJSON(ctx, "DELETE", "/v1/tokens/"+token+"/delay", nil, nil)
+}
+
+// GetTokenRedirect retrieves the redirect of the specified token.
+func (c *Client) GetTokenRedirect(ctx context.Context, token string) (*apitypes.TokenRedirect, error) {
+	var result apitypes.TokenRedirect
+	if err := c.doJSON(ctx, "GET", "/v1/tokens/"+token+"/redirect", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetTokenRedirect replaces the redirect of the specified token.
+func (c *Client) SetTokenRedirect(ctx context.Context, token string, r apitypes.TokenRedirect) (*apitypes.TokenRedirect, error) {
+	var result apitypes.TokenRedirect
+	if err := c.doJSON(ctx, "PUT", "/v1/tokens/"+token+"/redirect", r, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteTokenRedirect removes the redirect of the specified token.
+func (c *Client) DeleteTokenRedirect(ctx context.Context, token string) error {
+	return c.doJSON(ctx, "DELETE", "/v1/tokens/"+token+"/redirect", nil, nil)
+}
+
+// GetTokenOverrides retrieves the response overrides of the specified token.
+func (c *Client) GetTokenOverrides(ctx context.Context, token string) (*apitypes.TokenOverrides, error) {
+	var result apitypes.TokenOverrides
+	if err := c.doJSON(ctx, "GET", "/v1/tokens/"+token+"/overrides", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetTokenOverrides replaces the response overrides of the specified token.
+func (c *Client) SetTokenOverrides(ctx context.Context, token string, o apitypes.TokenOverrides) (*apitypes.TokenOverrides, error) {
+	var result apitypes.TokenOverrides
+	if err := c.doJSON(ctx, "PUT", "/v1/tokens/"+token+"/overrides", o, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteTokenOverrides removes the response overrides of the specified token.
+func (c *Client) DeleteTokenOverrides(ctx context.Context, token string) error {
+	return c.doJSON(ctx, "DELETE", "/v1/tokens/"+token+"/overrides", nil, nil)
+}
+
+// GetTokenBasicAuth retrieves the basic auth challenge of the specified token.
+func (c *Client) GetTokenBasicAuth(ctx context.Context, token string) (*apitypes.TokenBasicAuth, error) {
+	var result apitypes.TokenBasicAuth
+	if err := c.doJSON(ctx, "GET", "/v1/tokens/"+token+"/basic-auth", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetTokenBasicAuth enables or replaces the basic auth challenge of the
+// specified token.
+func (c *Client) SetTokenBasicAuth(ctx context.Context, token string, b apitypes.TokenBasicAuth) (*apitypes.TokenBasicAuth, error) {
+	var result apitypes.TokenBasicAuth
+	if err := c.doJSON(ctx, "PUT", "/v1/tokens/"+token+"/basic-auth", b, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteTokenBasicAuth disables the basic auth challenge of the specified token.
+func (c *Client) DeleteTokenBasicAuth(ctx context.Context, token string) error {
+	return c.doJSON(ctx, "DELETE", "/v1/tokens/"+token+"/basic-auth", nil, nil)
+}
+
+// GetTokenNTLM retrieves the NTLM capture settings of the specified token.
+func (c *Client) GetTokenNTLM(ctx context.Context, token string) (*apitypes.TokenNTLM, error) {
+	var result apitypes.TokenNTLM
+	if err := c.doJSON(ctx, "GET", "/v1/tokens/"+token+"/ntlm", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// SetTokenNTLM enables or replaces NTLM capture for the specified token.
+func (c *Client) SetTokenNTLM(ctx context.Context, token string, n apitypes.TokenNTLM) (*apitypes.TokenNTLM, error) {
+	var result apitypes.TokenNTLM
+	if err := c.doJSON(ctx, "PUT", "/v1/tokens/"+token+"/ntlm", n, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteTokenNTLM disables NTLM capture for the specified token.
+func (c *Client) DeleteTokenNTLM(ctx context.Context, token string) error {
+	return c.doJSON(ctx, "DELETE", "/v1/tokens/"+token+"/ntlm", nil, nil)
+}
+
+// GetTokenPluginConfig retrieves the specified token's configuration for a
+// plugin.
+func (c *Client) GetTokenPluginConfig(ctx context.Context, token, pluginID string) (json.RawMessage, error) {
+	var result json.RawMessage
+	if err := c.doJSON(ctx, "GET", tokenPluginConfigPath(token, pluginID), nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetTokenPluginConfig replaces the specified token's configuration for a
+// plugin, returning it as stored.
+func (c *Client) SetTokenPluginConfig(ctx context.Context, token, pluginID string, cfg json.RawMessage) (json.RawMessage, error) {
+	var result json.RawMessage
+	if err := c.doJSON(ctx, "PUT", tokenPluginConfigPath(token, pluginID), cfg, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeleteTokenPluginConfig removes the specified token's configuration for a
+// plugin.
+func (c *Client) DeleteTokenPluginConfig(ctx context.Context, token, pluginID string) error {
+	return c.doJSON(ctx, "DELETE", tokenPluginConfigPath(token, pluginID), nil, nil)
+}
+
+// GetPluginConfig retrieves a plugin's server-wide configuration.
+func (c *Client) GetPluginConfig(ctx context.Context, pluginID string) (json.RawMessage, error) {
+	var result json.RawMessage
+	if err := c.doJSON(ctx, "GET", pluginConfigPath(pluginID), nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SetPluginConfig replaces a plugin's server-wide configuration, returning it
+// as stored.
+func (c *Client) SetPluginConfig(ctx context.Context, pluginID string, cfg json.RawMessage) (json.RawMessage, error) {
+	var result json.RawMessage
+	if err := c.doJSON(ctx, "PUT", pluginConfigPath(pluginID), cfg, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// DeletePluginConfig resets a plugin's server-wide configuration to its
+// defaults.
+func (c *Client) DeletePluginConfig(ctx context.Context, pluginID string) error {
+	return c.doJSON(ctx, "DELETE", pluginConfigPath(pluginID), nil, nil)
+}
+
+func pluginConfigPath(pluginID string) string {
+	return "/v1/plugins/" + url.PathEscape(pluginID) + "/config"
+}
+
+func tokenPluginConfigPath(token, pluginID string) string {
+	return "/v1/tokens/" + token + "/plugins/" + url.PathEscape(pluginID) + "/config"
+}
+
+// ListTokenFiles lists the files served under the specified token's host.
+func (c *Client) ListTokenFiles(ctx context.Context, token string) (*apitypes.ListTokenFilesResponse, error) {
+	var result apitypes.ListTokenFilesResponse
+	if err := c.doJSON(ctx, "GET", "/v1/tokens/"+token+"/files", nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PutTokenFile uploads content to serve at path under the specified token's
+// host. An empty contentType lets the server guess it.
+func (c *Client) PutTokenFile(ctx context.Context, token, path, contentType string, content io.Reader) (*apitypes.TokenFile, error) {
+	var result apitypes.TokenFile
+	if err := c.do(ctx, "PUT", tokenFilePath(token, path), contentType, content, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// DeleteTokenFile removes the file at path under the specified token's host.
+func (c *Client) DeleteTokenFile(ctx context.Context, token, path string) error {
+	return c.doJSON(ctx, "DELETE", tokenFilePath(token, path), nil, nil)
+}
+
+func tokenFilePath(token, path string) string {
+	return "/v1/tokens/" + token + "/files/" + (&url.URL{Path: strings.TrimPrefix(path, "/")}).EscapedPath()
+}
+
+// PurgeInteractions deletes interactions for the specified token that match the purge request.
+func (c *Client) PurgeInteractions(ctx context.Context, token string, purge apitypes.PurgeInteractionsRequest) (*apitypes.PurgeInteractionsResponse, error) {
+	return c.purge(ctx, "/v1/tokens/"+token+"/interactions/purge", purge)
+}
+
+// PurgeAllInteractions deletes interactions across all tokens owned by the API key.
+func (c *Client) PurgeAllInteractions(ctx context.Context, purge apitypes.PurgeInteractionsRequest) (*apitypes.PurgeInteractionsResponse, error) {
+	return c.purge(ctx, "/v1/interactions/purge", purge)
+}
+
+// PurgeServerInteractions deletes interactions across every token on the
+// server, which needs an admin key.
+func (c *Client) PurgeServerInteractions(ctx context.Context, purge apitypes.PurgeInteractionsRequest) (*apitypes.PurgeInteractionsResponse, error) {
+	return c.purge(ctx, "/v2/admin/interactions/purge", purge)
+}
+
+func (c *Client) purge(ctx context.Context, path string, purge apitypes.PurgeInteractionsRequest) (*apitypes.PurgeInteractionsResponse, error) {
+	body, err := json.Marshal(purge)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseError(resp)
+	}
+
+	var result apitypes.PurgeInteractionsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// doJSON sends an authenticated request with in, if non-nil, as the JSON body
+// and decodes a successful response into out, if non-nil.
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out any) error {
+	if in == nil {
+		return c.do(ctx, method, path, "", nil, out)
+	}
+	b, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+	return c.do(ctx, method, path, "application/json", bytes.NewReader(b), out)
+}
+
+// do sends an authenticated request with body, of type contentType if
+// non-empty, and decodes a successful JSON response into out, if non-nil.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body io.Reader, out any) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("execute request: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return parseError(resp)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return nil
+}
+
 func parseError(resp *http.Response) error {
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// Migration is one of the server's schema migrations.
+type Migration struct {
+	Version   int
+	Name      string // file name, e.g. 001_init.sql
+	AppliedAt *int64 // Unix time, nil while pending
+}
+
+// Migrations lists the server's schema migrations in version order, with
+// when each was applied to the database.
+func Migrations(d *sql.DB) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations dir: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".sql") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	applied := make(map[int]int64)
+	var tracked int
+	if err := d.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'").Scan(&tracked); err != nil {
+		return nil, fmt.Errorf("check schema_migrations: %w", err)
+	}
+	if tracked > 0 {
+		rows, err := d.Query("SELECT version, applied_at FROM schema_migrations")
+		if err != nil {
+			return nil, fmt.Errorf("query schema_migrations: %w", err)
+		}
+		defer func() { _ = rows.Close() }()
+		for rows.Next() {
+			var version int
+			var at int64
+			if err := rows.Scan(&version, &at); err != nil {
+				return nil, fmt.Errorf("scan migration: %w", err)
+			}
+			applied[version] = at
+		}
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("query schema_migrations: %w", err)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		version, err := parseVersion(name)
+		if err != nil {
+			return nil, fmt.Errorf("parse version from %s: %w", name, err)
+		}
+		m := Migration{Version: version, Name: name}
+		if at, ok := applied[version]; ok {
+			m.AppliedAt = &at
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, nil
+}
+
+// Problem is an inconsistency found by Check.
+type Problem struct {
+	Check  string // integrity_check or foreign_key_check
+	Detail string
+}
+
+// Check runs SQLite's integrity check and looks for orphaned rows, such as
+// interaction details or attributes whose interaction no longer exists. It
+// returns the problems found, none for a healthy database.
+func Check(d *sql.DB) ([]Problem, error) {
+	var problems []Problem
+
+	rows, err := d.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, fmt.Errorf("integrity check: %w", err)
+	}
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			_ = rows.Close()
+			return nil, fmt.Errorf("integrity check: %w", err)
+		}
+		if result != "ok" {
+			problems = append(problems, Problem{Check: "integrity_check", Detail: result})
+		}
+	}
+	err = rows.Err()
+	_ = rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("integrity check: %w", err)
+	}
+
+	rows, err = d.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		return nil, fmt.Errorf("foreign key check: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var table, parent string
+		var rowid sql.NullInt64
+		var fkid int
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			return nil, fmt.Errorf("foreign key check: %w", err)
+		}
+		problems = append(problems, Problem{
+			Check:  "foreign_key_check",
+			Detail: fmt.Sprintf("%s row %d references a missing %s row", table, rowid.Int64, parent),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("foreign key check: %w", err)
+	}
+	return problems, nil
+}
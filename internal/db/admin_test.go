@@ -0,0 +1,76 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	db, err := OpenWithoutMigrations(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("OpenWithoutMigrations failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	migrations, err := Migrations(db)
+	if err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	if len(migrations) == 0 || migrations[0].Version != 1 {
+		t.Fatalf("Migrations = %+v, want them from version 1", migrations)
+	}
+	for _, m := range migrations {
+		if m.AppliedAt != nil {
+			t.Errorf("migration %s applied before Migrate", m.Name)
+		}
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if migrations, err = Migrations(db); err != nil {
+		t.Fatalf("Migrations failed: %v", err)
+	}
+	for _, m := range migrations {
+		if m.AppliedAt == nil {
+			t.Errorf("migration %s pending after Migrate", m.Name)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	problems, err := Check(db)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("Check = %+v, %v; want no problems", problems, err)
+	}
+
+	// Foreign keys are enforced per connection, so orphan a row on one with
+	// them off.
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatalf("get connection: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys=OFF"); err != nil {
+		t.Fatalf("disable foreign keys: %v", err)
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO interaction_attributes (interaction_id, key, value) VALUES (999, 'k', '1')"); err != nil {
+		t.Fatalf("insert orphan: %v", err)
+	}
+
+	problems, err = Check(db)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(problems) != 1 || problems[0].Check != "foreign_key_check" {
+		t.Errorf("Check = %+v, want the orphaned attribute", problems)
+	}
+}
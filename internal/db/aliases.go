@@ -0,0 +1,90 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// ErrAliasTaken is returned when an alias is already a token value or belongs
+// to another token.
+var ErrAliasTaken = errors.New("alias already in use")
+
+// SetTokenAliases replaces a token's aliases. An empty aliases clears them.
+// It fails with ErrAliasTaken, leaving the existing aliases unchanged, if any
+// alias collides with a token value or another token's alias.
+func SetTokenAliases(d *sql.DB, tokenID int64, aliases []string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec("DELETE FROM token_aliases WHERE token_id = ?", tokenID); err != nil {
+		return fmt.Errorf("delete aliases: %w", err)
+	}
+
+	now := time.Now().Unix()
+	for _, alias := range aliases {
+		var taken bool
+		err := tx.QueryRow(`
+			SELECT EXISTS (SELECT 1 FROM tokens WHERE token = ?)
+				OR EXISTS (SELECT 1 FROM token_aliases WHERE alias = ?)
+		`, alias, alias).Scan(&taken)
+		if err != nil {
+			return fmt.Errorf("check alias %q: %w", alias, err)
+		}
+		if taken {
+			return fmt.Errorf("%w: %s", ErrAliasTaken, alias)
+		}
+		if _, err := tx.Exec(
+			"INSERT INTO token_aliases (alias, token_id, created_at) VALUES (?, ?, ?)",
+			alias, tokenID, now,
+		); err != nil {
+			return fmt.Errorf("insert alias %q: %w", alias, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// TokenValueInUse reports whether value is already a token value or alias.
+func TokenValueInUse(d *sql.DB, value string) (bool, error) {
+	var taken bool
+	err := d.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM tokens WHERE token = ?)
+			OR EXISTS (SELECT 1 FROM token_aliases WHERE alias = ?)
+	`, value, value).Scan(&taken)
+	return taken, err
+}
+
+// ResolveToken retrieves the token whose value or alias matches value,
+// ignoring case. It returns nil if neither matches.
+func ResolveToken(d *sql.DB, value string) (*models.Token, error) {
+	value = strings.ToLower(value)
+	t, err := GetTokenByValue(d, value)
+	if err != nil || t != nil {
+		return t, err
+	}
+
+	var tokenValue string
+	err = d.QueryRow(`
+		SELECT t.token FROM token_aliases a
+		JOIN tokens t ON t.id = a.token_id
+		WHERE a.alias = ?
+	`, value).Scan(&tokenValue)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetTokenByValue(d, tokenValue)
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenAliases(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	idA, err := CreateToken(db, "tokena", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	idB, err := CreateToken(db, "tokenb", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	if err := SetTokenAliases(db, idA, []string{"img-cdn", "static"}); err != nil {
+		t.Fatalf("set aliases: %v", err)
+	}
+
+	tok, err := ResolveToken(db, "IMG-CDN")
+	if err != nil || tok == nil {
+		t.Fatalf("resolve alias: %v", err)
+	}
+	if tok.ID != idA {
+		t.Errorf("alias resolved to token %d, want %d", tok.ID, idA)
+	}
+	if tok, err := ResolveToken(db, "tokenb"); err != nil || tok == nil || tok.ID != idB {
+		t.Errorf("resolve token value: %v, %v", tok, err)
+	}
+	if tok, err := ResolveToken(db, "unknown"); err != nil || tok != nil {
+		t.Errorf("resolve unknown: %v, %v", tok, err)
+	}
+
+	for _, alias := range []string{"static", "tokena"} {
+		if err := SetTokenAliases(db, idB, []string{"fresh", alias}); !errors.Is(err, ErrAliasTaken) {
+			t.Errorf("alias %q: err = %v, want ErrAliasTaken", alias, err)
+		}
+	}
+	if tok, _ := ResolveToken(db, "fresh"); tok != nil {
+		t.Error("failed alias update was partially applied")
+	}
+
+	// Replacing a token's own aliases may keep ones it already holds.
+	if err := SetTokenAliases(db, idA, []string{"static"}); err != nil {
+		t.Fatalf("replace aliases: %v", err)
+	}
+	if tok, _ := ResolveToken(db, "img-cdn"); tok != nil {
+		t.Error("removed alias still resolves")
+	}
+
+	if err := DeleteToken(db, "tokena"); err != nil {
+		t.Fatalf("delete token: %v", err)
+	}
+	if inUse, err := TokenValueInUse(db, "static"); err != nil || inUse {
+		t.Errorf("alias of deleted token still in use: %v, %v", inUse, err)
+	}
+}
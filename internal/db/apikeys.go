@@ -2,16 +2,22 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"time"
 
-	"github.com/rsclarke/oastrix/internal/models"
+	"github.com/rsclarke/oastrix/internal/auth"
+	"github.com/rsclarke/oastrix/pkg/models"
 )
 
-// CreateAPIKey inserts a new API key into the database and returns its ID.
-func CreateAPIKey(d *sql.DB, prefix string, hash []byte) (int64, error) {
+const apiKeyColumns = "id, key_prefix, key_hash, hash_version, name, scope, allowed_cidrs, client_cert_subject, created_at, revoked_at, last_used_at, last_used_ip"
+
+// CreateAPIKey inserts a new API key with the given scope and optional name into the database and returns its ID.
+// The hash must have been computed with auth.HashSecret.
+func CreateAPIKey(d *sql.DB, prefix string, hash []byte, scope string, name *string) (int64, error) {
 	result, err := d.Exec(
-		"INSERT INTO api_keys (key_prefix, key_hash, created_at) VALUES (?, ?, ?)",
-		prefix, hash, time.Now().Unix(),
+		"INSERT INTO api_keys (key_prefix, key_hash, hash_version, name, scope, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		prefix, hash, auth.HashVersionHMAC, name, scope, time.Now().Unix(),
 	)
 	if err != nil {
 		return 0, err
@@ -21,19 +27,102 @@ func CreateAPIKey(d *sql.DB, prefix string, hash []byte) (int64, error) {
 
 // GetAPIKeyByPrefix retrieves an API key by its prefix.
 func GetAPIKeyByPrefix(d *sql.DB, prefix string) (*models.APIKey, error) {
-	row := d.QueryRow(
-		"SELECT id, key_prefix, key_hash, created_at, revoked_at FROM api_keys WHERE key_prefix = ?",
-		prefix,
-	)
-	var key models.APIKey
-	err := row.Scan(&key.ID, &key.KeyPrefix, &key.KeyHash, &key.CreatedAt, &key.RevokedAt)
+	row := d.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE key_prefix = ?", prefix)
+	key, err := scanAPIKey(row)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &key, nil
+	return key, nil
+}
+
+// GetAPIKeyByClientCert retrieves the API key bound to a client certificate subject.
+func GetAPIKeyByClientCert(d *sql.DB, subject string) (*models.APIKey, error) {
+	row := d.QueryRow("SELECT "+apiKeyColumns+" FROM api_keys WHERE client_cert_subject = ?", subject)
+	key, err := scanAPIKey(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListAPIKeys retrieves all API keys, including revoked ones, oldest first.
+func ListAPIKeys(d *sql.DB) ([]models.APIKey, error) {
+	rows, err := d.Query("SELECT " + apiKeyColumns + " FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// SetAPIKeyAllowlist replaces the CIDR ranges an API key may be used from.
+// An empty list removes the restriction.
+func SetAPIKeyAllowlist(d *sql.DB, id int64, cidrs []string) error {
+	var value *string
+	if len(cidrs) > 0 {
+		encoded, err := json.Marshal(cidrs)
+		if err != nil {
+			return fmt.Errorf("encode allowlist: %w", err)
+		}
+		s := string(encoded)
+		value = &s
+	}
+
+	_, err := d.Exec("UPDATE api_keys SET allowed_cidrs = ? WHERE id = ?", value, id)
+	if err != nil {
+		return fmt.Errorf("update allowlist: %w", err)
+	}
+	return nil
+}
+
+// SetAPIKeyClientCert binds a client certificate subject to an API key.
+// A nil subject removes the binding.
+func SetAPIKeyClientCert(d *sql.DB, id int64, subject *string) error {
+	_, err := d.Exec("UPDATE api_keys SET client_cert_subject = ? WHERE id = ?", subject, id)
+	if err != nil {
+		return fmt.Errorf("update client certificate: %w", err)
+	}
+	return nil
+}
+
+// UpgradeAPIKeyHash replaces a legacy key hash with one computed by auth.HashSecret.
+func UpgradeAPIKeyHash(d *sql.DB, id int64, hash []byte) error {
+	_, err := d.Exec("UPDATE api_keys SET key_hash = ?, hash_version = ? WHERE id = ?", hash, auth.HashVersionHMAC, id)
+	return err
+}
+
+// TouchAPIKey records that an API key was used at the given Unix time from the given IP.
+func TouchAPIKey(d *sql.DB, id int64, usedAt int64, ip string) error {
+	_, err := d.Exec("UPDATE api_keys SET last_used_at = ?, last_used_ip = ? WHERE id = ?", usedAt, ip, id)
+	return err
+}
+
+// RevokeAPIKey marks an API key as revoked. It reports whether an active key was revoked.
+func RevokeAPIKey(d *sql.DB, id int64) (bool, error) {
+	result, err := d.Exec("UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", time.Now().Unix(), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
 }
 
 // CountAPIKeys returns the number of non-revoked API keys in the database.
@@ -42,3 +131,22 @@ func CountAPIKeys(d *sql.DB) (int, error) {
 	err := d.QueryRow("SELECT COUNT(*) FROM api_keys WHERE revoked_at IS NULL").Scan(&count)
 	return count, err
 }
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var key models.APIKey
+	var allowedCIDRs sql.NullString
+	err := row.Scan(&key.ID, &key.KeyPrefix, &key.KeyHash, &key.HashVersion, &key.Name, &key.Scope, &allowedCIDRs, &key.ClientCertSubject, &key.CreatedAt, &key.RevokedAt, &key.LastUsedAt, &key.LastUsedIP)
+	if err != nil {
+		return nil, err
+	}
+	if allowedCIDRs.Valid {
+		if err := json.Unmarshal([]byte(allowedCIDRs.String), &key.AllowedCIDRs); err != nil {
+			return nil, fmt.Errorf("decode allowlist for key %d: %w", key.ID, err)
+		}
+	}
+	return &key, nil
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSetAPIKeyAllowlist(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	id, err := CreateAPIKey(db, "prefix123456", []byte("hash"), "full", nil)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	key, err := GetAPIKeyByPrefix(db, "prefix123456")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByPrefix failed: %v", err)
+	}
+	if key.AllowedCIDRs != nil {
+		t.Errorf("expected no allowlist on new key, got %v", key.AllowedCIDRs)
+	}
+
+	want := []string{"10.0.0.0/8", "192.0.2.1"}
+	if err := SetAPIKeyAllowlist(db, id, want); err != nil {
+		t.Fatalf("SetAPIKeyAllowlist failed: %v", err)
+	}
+	key, err = GetAPIKeyByPrefix(db, "prefix123456")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByPrefix failed: %v", err)
+	}
+	if !reflect.DeepEqual(key.AllowedCIDRs, want) {
+		t.Errorf("AllowedCIDRs = %v, want %v", key.AllowedCIDRs, want)
+	}
+
+	if err := SetAPIKeyAllowlist(db, id, nil); err != nil {
+		t.Fatalf("SetAPIKeyAllowlist (clear) failed: %v", err)
+	}
+	key, err = GetAPIKeyByPrefix(db, "prefix123456")
+	if err != nil {
+		t.Fatalf("GetAPIKeyByPrefix failed: %v", err)
+	}
+	if key.AllowedCIDRs != nil {
+		t.Errorf("expected allowlist to be cleared, got %v", key.AllowedCIDRs)
+	}
+}
+
+func TestTouchAndRevokeAPIKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	id, err := CreateAPIKey(db, "prefix123456", []byte("hash"), "full", nil)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	if err := TouchAPIKey(db, id, 1700000000, "192.0.2.1"); err != nil {
+		t.Fatalf("TouchAPIKey failed: %v", err)
+	}
+
+	revoked, err := RevokeAPIKey(db, id)
+	if err != nil || !revoked {
+		t.Fatalf("RevokeAPIKey = %v, %v; want true, nil", revoked, err)
+	}
+	revoked, err = RevokeAPIKey(db, id)
+	if err != nil || revoked {
+		t.Errorf("second RevokeAPIKey = %v, %v; want false, nil", revoked, err)
+	}
+
+	keys, err := ListAPIKeys(db)
+	if err != nil {
+		t.Fatalf("ListAPIKeys failed: %v", err)
+	}
+	if len(keys) != 1 {
+		t.Fatalf("expected 1 key, got %d", len(keys))
+	}
+	key := keys[0]
+	if key.LastUsedAt == nil || *key.LastUsedAt != 1700000000 {
+		t.Errorf("LastUsedAt = %v, want 1700000000", key.LastUsedAt)
+	}
+	if key.LastUsedIP == nil || *key.LastUsedIP != "192.0.2.1" {
+		t.Errorf("LastUsedIP = %v, want 192.0.2.1", key.LastUsedIP)
+	}
+	if key.RevokedAt == nil {
+		t.Error("expected RevokedAt to be set")
+	}
+}
+
+func TestCreateAPIKeyName(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	name := "alice laptop"
+	if _, err := CreateAPIKey(db, "prefix111111", []byte("hash1"), "full", &name); err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	if _, err := CreateAPIKey(db, "prefix222222", []byte("hash2"), "read", nil); err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	keys, err := ListAPIKeys(db)
+	if err != nil {
+		t.Fatalf("ListAPIKeys failed: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(keys))
+	}
+	if keys[0].Name == nil || *keys[0].Name != name {
+		t.Errorf("Name = %v, want %q", keys[0].Name, name)
+	}
+	if keys[1].Name != nil {
+		t.Errorf("expected unnamed key, got %q", *keys[1].Name)
+	}
+}
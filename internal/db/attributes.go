@@ -4,11 +4,19 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 )
 
 // SaveAttributes stores plugin enrichment data for an interaction.
 // Each key-value pair is stored as a separate row with the value JSON-encoded.
 func SaveAttributes(d *sql.DB, interactionID int64, attrs map[string]any) error {
+	return saveAttributes(d, nil, codec{}, interactionID, attrs)
+}
+
+// saveAttributes is SaveAttributes running its inserts through the statement
+// cache, if one is given.
+func saveAttributes(d *sql.DB, stmts *stmtCache, c codec, interactionID int64, attrs map[string]any) error {
 	if len(attrs) == 0 {
 		return nil
 	}
@@ -19,37 +27,61 @@ func SaveAttributes(d *sql.DB, interactionID int64, attrs map[string]any) error
 	}
 	defer func() { _ = tx.Rollback() }()
 
-	stmt, err := tx.Prepare(`
-		INSERT INTO interaction_attributes (interaction_id, key, value)
-		VALUES (?, ?, ?)
-		ON CONFLICT (interaction_id, key) DO UPDATE SET value = excluded.value
-	`)
-	if err != nil {
-		return fmt.Errorf("prepare statement: %w", err)
+	var e Execer = tx
+	if stmts != nil {
+		e = cachedDB{cache: stmts, tx: tx}
+	}
+	if err := saveAttributesTx(e, c, interactionID, attrs); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
 	}
-	defer func() { _ = stmt.Close() }()
 
+	return nil
+}
+
+// saveAttributeQuery inserts or replaces one attribute of an interaction.
+const saveAttributeQuery = `
+	INSERT INTO interaction_attributes (interaction_id, key, value, flags)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (interaction_id, key) DO UPDATE SET value = excluded.value, flags = excluded.flags
+`
+
+// SaveAttributesTx is SaveAttributes within the transaction tx.
+func SaveAttributesTx(tx *sql.Tx, interactionID int64, attrs map[string]any) error {
+	return saveAttributesTx(tx, codec{}, interactionID, attrs)
+}
+
+func saveAttributesTx(tx Execer, c codec, interactionID int64, attrs map[string]any) error {
 	for key, val := range attrs {
 		encoded, err := json.Marshal(val)
 		if err != nil {
 			return fmt.Errorf("encode value for key %q: %w", key, err)
 		}
-		if _, err := stmt.Exec(interactionID, key, string(encoded)); err != nil {
+		// Plain values stay text so they can be matched in SQL.
+		var value any = string(encoded)
+		sealed, flags := c.encrypt(encoded, attributeAAD(interactionID, key))
+		if flags != 0 {
+			value = sealed
+		}
+		if _, err := tx.Exec(saveAttributeQuery, interactionID, key, value, flags); err != nil {
 			return fmt.Errorf("insert attribute %q: %w", key, err)
 		}
 	}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("commit transaction: %w", err)
-	}
-
 	return nil
 }
 
 // GetAttributes retrieves all plugin enrichment data for an interaction.
 func GetAttributes(d *sql.DB, interactionID int64) (map[string]any, error) {
+	return getAttributes(d, codec{}, interactionID)
+}
+
+func getAttributes(d Querier, c codec, interactionID int64) (map[string]any, error) {
 	rows, err := d.Query(
-		"SELECT key, value FROM interaction_attributes WHERE interaction_id = ?",
+		"SELECT key, value, flags FROM interaction_attributes WHERE interaction_id = ?",
 		interactionID,
 	)
 	if err != nil {
@@ -59,13 +91,15 @@ func GetAttributes(d *sql.DB, interactionID int64) (map[string]any, error) {
 
 	attrs := make(map[string]any)
 	for rows.Next() {
-		var key, value string
-		if err := rows.Scan(&key, &value); err != nil {
+		var key string
+		var value []byte
+		var flags int
+		if err := rows.Scan(&key, &value, &flags); err != nil {
 			return nil, fmt.Errorf("scan attribute: %w", err)
 		}
-		var decoded any
-		if err := json.Unmarshal([]byte(value), &decoded); err != nil {
-			return nil, fmt.Errorf("decode value for key %q: %w", key, err)
+		decoded, err := decodeAttribute(c, interactionID, key, value, flags)
+		if err != nil {
+			return nil, err
 		}
 		attrs[key] = decoded
 	}
@@ -76,3 +110,79 @@ func GetAttributes(d *sql.DB, interactionID int64) (map[string]any, error) {
 
 	return attrs, nil
 }
+
+// attributeBatchSize bounds how many interactions' attributes are read per
+// query, keeping well under SQLite's limit on bound parameters.
+const attributeBatchSize = 500
+
+// getAttributesByIDs is getAttributes for many interactions at once, keyed
+// by interaction ID. Interactions without attributes have no entry.
+func getAttributesByIDs(d *sql.DB, c codec, interactionIDs []int64) (map[int64]map[string]any, error) {
+	attrs := make(map[int64]map[string]any)
+	for batch := range slices.Chunk(interactionIDs, attributeBatchSize) {
+		args := make([]any, len(batch))
+		for n, id := range batch {
+			args[n] = id
+		}
+		placeholders := strings.Repeat(", ?", len(batch))[2:]
+		rows, err := d.Query(
+			"SELECT interaction_id, key, value, flags FROM interaction_attributes WHERE interaction_id IN ("+placeholders+")",
+			args...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("query attributes: %w", err)
+		}
+		for rows.Next() {
+			var interactionID int64
+			var key string
+			var value []byte
+			var flags int
+			if err := rows.Scan(&interactionID, &key, &value, &flags); err != nil {
+				_ = rows.Close()
+				return nil, fmt.Errorf("scan attribute: %w", err)
+			}
+			decoded, err := decodeAttribute(c, interactionID, key, value, flags)
+			if err != nil {
+				_ = rows.Close()
+				return nil, err
+			}
+			if attrs[interactionID] == nil {
+				attrs[interactionID] = make(map[string]any)
+			}
+			attrs[interactionID][key] = decoded
+		}
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("iterate attributes: %w", err)
+		}
+	}
+	return attrs, nil
+}
+
+// decodeAttribute decrypts and unmarshals a stored attribute value.
+func decodeAttribute(c codec, interactionID int64, key string, value []byte, flags int) (any, error) {
+	plain, err := c.decode(value, flags, attributeAAD(interactionID, key))
+	if err != nil {
+		return nil, fmt.Errorf("decode value for key %q: %w", key, err)
+	}
+	var decoded any
+	if err := json.Unmarshal(plain, &decoded); err != nil {
+		return nil, fmt.Errorf("decode value for key %q: %w", key, err)
+	}
+	return decoded, nil
+}
+
+// IncrementAttribute adds one to an integer attribute of an interaction,
+// creating it with the value 1 if absent. Counters are never encrypted.
+func IncrementAttribute(d Execer, interactionID int64, key string) error {
+	_, err := d.Exec(`
+		INSERT INTO interaction_attributes (interaction_id, key, value)
+		VALUES (?, ?, '1')
+		ON CONFLICT (interaction_id, key) DO UPDATE SET value = CAST(value AS INTEGER) + 1
+	`, interactionID, key)
+	if err != nil {
+		return fmt.Errorf("increment attribute %q: %w", key, err)
+	}
+	return nil
+}
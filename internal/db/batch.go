@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultBatchSize is the default maximum number of writes a Batcher
+// commits in one transaction.
+const DefaultBatchSize = 256
+
+// ErrBatcherClosed is returned by Batcher.Do after Close.
+var ErrBatcherClosed = errors.New("batcher closed")
+
+// Execer is satisfied by both *sql.DB and *sql.Tx, so write helpers can run
+// on their own or as part of a Batcher's transaction.
+type Execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// Batcher coalesces writes arriving within a short window into a single
+// transaction, so a burst of interactions costs one commit rather than one
+// each. Each write runs in its own savepoint: one that fails is rolled back
+// without affecting the others in its batch.
+type Batcher struct {
+	db     *sql.DB
+	window time.Duration
+	size   int
+
+	mu     sync.RWMutex
+	closed bool
+	writes chan batchWrite
+	done   chan struct{}
+}
+
+type batchWrite struct {
+	done   <-chan struct{} // the write is skipped if closed before its turn
+	fn     func(*sql.Tx) error
+	result chan error
+}
+
+// errWriteSkipped is the result of a write whose context was done before
+// its turn in the batch came; Do reports the context's error instead.
+var errWriteSkipped = errors.New("write skipped")
+
+// NewBatcher starts a Batcher that waits up to window after a write for
+// others to join it, committing at most size writes at once.
+func NewBatcher(d *sql.DB, window time.Duration, size int) *Batcher {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	b := &Batcher{
+		db:     d,
+		window: window,
+		size:   size,
+		writes: make(chan batchWrite),
+		done:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Do runs fn in the next batch's transaction and returns once that has been
+// committed. fn's error, or the batch's if it could not be committed, is
+// returned. fn is not run if ctx is done before its turn in the batch comes,
+// and ctx's error is returned instead.
+func (b *Batcher) Do(ctx context.Context, fn func(*sql.Tx) error) error {
+	w := batchWrite{done: ctx.Done(), fn: fn, result: make(chan error, 1)}
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrBatcherClosed
+	}
+	select {
+	case b.writes <- w:
+	case <-ctx.Done():
+		b.mu.RUnlock()
+		return ctx.Err()
+	}
+	b.mu.RUnlock()
+	if err := <-w.result; err != errWriteSkipped {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Close commits pending writes and stops the Batcher.
+func (b *Batcher) Close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.writes)
+	}
+	b.mu.Unlock()
+	<-b.done
+}
+
+func (b *Batcher) run() {
+	defer close(b.done)
+	for w := range b.writes {
+		batch := []batchWrite{w}
+		timer := time.NewTimer(b.window)
+	collect:
+		for len(batch) < b.size {
+			select {
+			case w, ok := <-b.writes:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, w)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+		b.commit(batch)
+	}
+}
+
+// commit runs batch in one transaction and reports each write's outcome.
+func (b *Batcher) commit(batch []batchWrite) {
+	errs := make([]error, len(batch))
+	err := func() error {
+		tx, err := b.db.Begin()
+		if err != nil {
+			return fmt.Errorf("begin transaction: %w", err)
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		for i, w := range batch {
+			select {
+			case <-w.done:
+				errs[i] = errWriteSkipped
+				continue
+			default:
+			}
+			if _, err := tx.Exec("SAVEPOINT batch_write"); err != nil {
+				return fmt.Errorf("savepoint: %w", err)
+			}
+			if errs[i] = w.fn(tx); errs[i] != nil {
+				if _, err := tx.Exec("ROLLBACK TO batch_write"); err != nil {
+					return fmt.Errorf("rollback to savepoint: %w", err)
+				}
+			}
+			if _, err := tx.Exec("RELEASE batch_write"); err != nil {
+				return fmt.Errorf("release savepoint: %w", err)
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit transaction: %w", err)
+		}
+		return nil
+	}()
+
+	for i, w := range batch {
+		if err != nil {
+			w.result <- err
+		} else {
+			w.result <- errs[i]
+		}
+	}
+}
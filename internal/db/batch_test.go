@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBatcherAssignsDistinctIDs(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	tokenID, err := CreateToken(db, "batch-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	b := NewBatcher(db, 5*time.Millisecond, 8)
+	const n = 50
+	ids := make([]int64, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := b.Do(context.Background(), func(tx *sql.Tx) error {
+				id, err := CreateInteraction(tx, tokenID, "dns", "192.0.2.1", 53, false, fmt.Sprintf("q%d", i))
+				if err != nil {
+					return err
+				}
+				ids[i] = id
+				return CreateDNSInteraction(tx, id, fmt.Sprintf("q%d.example.com", i), 1, 1, 0, 0, i, "udp")
+			})
+			if err != nil {
+				t.Errorf("Do %d: %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+	b.Close()
+
+	seen := make(map[int64]bool)
+	for i, id := range ids {
+		if id == 0 || seen[id] {
+			t.Fatalf("write %d got ID %d, want a distinct non-zero ID", i, id)
+		}
+		seen[id] = true
+
+		// Each ID belongs to the interaction its write inserted.
+		interaction, err := GetInteraction(db, id)
+		if err != nil || interaction == nil {
+			t.Fatalf("GetInteraction(%d) = %v, %v", id, interaction, err)
+		}
+		if want := fmt.Sprintf("q%d", i); interaction.Summary != want {
+			t.Errorf("interaction %d summary = %q, want %q", id, interaction.Summary, want)
+		}
+		d, err := GetDNSInteraction(db, id)
+		if err != nil || d == nil || d.DNSID != i {
+			t.Errorf("GetDNSInteraction(%d) = %+v, %v, want DNS ID %d", id, d, err, i)
+		}
+	}
+}
+
+func TestBatcherIsolatesFailedWrites(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	tokenID, err := CreateToken(db, "batch-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	// A long window puts all three writes in one batch.
+	b := NewBatcher(db, time.Second, 3)
+	defer b.Close()
+
+	boom := errors.New("boom")
+	errs := make([]error, 3)
+	var wg sync.WaitGroup
+	for i := range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = b.Do(context.Background(), func(tx *sql.Tx) error {
+				if _, err := CreateInteraction(tx, tokenID, "http", "192.0.2.1", 80, false, fmt.Sprintf("w%d", i)); err != nil {
+					return err
+				}
+				if i == 1 {
+					return boom
+				}
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i == 1 && !errors.Is(err, boom) {
+			t.Errorf("write 1 error = %v, want boom", err)
+		}
+		if i != 1 && err != nil {
+			t.Errorf("write %d error = %v", i, err)
+		}
+	}
+	interactions, err := GetInteractionsByToken(db, tokenID)
+	if err != nil {
+		t.Fatalf("GetInteractionsByToken: %v", err)
+	}
+	if len(interactions) != 2 {
+		t.Fatalf("got %d interactions, want 2 without the failed write", len(interactions))
+	}
+	for _, i := range interactions {
+		if i.Summary == "w1" {
+			t.Error("failed write's interaction was committed")
+		}
+	}
+}
+
+func TestBatcherClosed(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	b := NewBatcher(db, time.Millisecond, 0)
+	b.Close()
+	b.Close()
+	if err := b.Do(context.Background(), func(*sql.Tx) error { return nil }); !errors.Is(err, ErrBatcherClosed) {
+		t.Errorf("Do after Close = %v, want ErrBatcherClosed", err)
+	}
+}
+
+func TestBatcherSkipsWritesPastDeadline(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	tokenID, err := CreateToken(db, "batch-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	// The write's deadline passes while it waits for the batch window.
+	b := NewBatcher(db, 100*time.Millisecond, 8)
+	defer b.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ran := false
+	err = b.Do(ctx, func(tx *sql.Tx) error {
+		ran = true
+		_, err := CreateInteraction(tx, tokenID, "http", "192.0.2.1", 80, false, "late")
+		return err
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Do error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if ran {
+		t.Error("write ran after its deadline")
+	}
+}
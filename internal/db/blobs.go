@@ -0,0 +1,174 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNoBlobStore is returned when reading a body that was spilled to a blob
+// store while none is configured.
+var ErrNoBlobStore = errors.New("body is in a blob store and none is configured")
+
+// BlobStore holds bodies too large to keep in the database. Blobs are
+// content-addressed: each is named by the hex SHA-256 of its content, which
+// the database stores in place of the body.
+type BlobStore interface {
+	Put(ref string, data []byte) error
+	Get(ref string) ([]byte, error)
+	Delete(ref string) error
+	// List returns the references of the blobs stored before the time.
+	List(before time.Time) ([]string, error)
+}
+
+// DefaultSpillAbove is the stored body size in bytes beyond which bodies are
+// spilled to a blob store by default.
+const DefaultSpillAbove = 256 << 10
+
+// BlobRef returns the reference data is stored under.
+func BlobRef(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// DirBlobStore is a BlobStore keeping each blob in a file under Dir, fanned
+// out into subdirectories by the first two characters of its reference.
+type DirBlobStore struct {
+	Dir string
+}
+
+var _ BlobStore = DirBlobStore{}
+
+func (s DirBlobStore) path(ref string) (string, error) {
+	if len(ref) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid blob reference %q", ref)
+	}
+	if _, err := hex.DecodeString(ref); err != nil {
+		return "", fmt.Errorf("invalid blob reference %q", ref)
+	}
+	return filepath.Join(s.Dir, ref[:2], ref), nil
+}
+
+// Put writes the blob, unless one with the same reference already exists.
+func (s DirBlobStore) Put(ref string, data []byte) error {
+	path, err := s.path(ref)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		// Refresh the time so a collection racing this write keeps it.
+		now := time.Now()
+		return os.Chtimes(path, now, now)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename it into place, so a blob is never
+	// seen half written.
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (s DirBlobStore) Get(ref string) ([]byte, error) {
+	path, err := s.path(ref)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (s DirBlobStore) Delete(ref string) error {
+	path, err := s.path(ref)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s DirBlobStore) List(before time.Time) ([]string, error) {
+	var refs []string
+	err := filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == s.Dir {
+			return fs.SkipAll
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if _, err := s.path(d.Name()); err != nil {
+			return nil // temporary or foreign file
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(before) {
+			refs = append(refs, d.Name())
+		}
+		return nil
+	})
+	return refs, err
+}
+
+// CollectBlobs deletes the blobs stored before the time that no interaction
+// references any longer, such as those of purged interactions, and returns
+// how many it deleted. Newer blobs are kept, as the interaction referencing
+// them may not be committed yet.
+func CollectBlobs(d *sql.DB, blobs BlobStore, before time.Time) (int, error) {
+	refs, err := blobs.List(before)
+	if err != nil {
+		return 0, fmt.Errorf("list blobs: %w", err)
+	}
+
+	used := make(map[string]bool)
+	rows, err := d.Query(`
+		SELECT request_body FROM http_interactions WHERE request_body_flags & ? != 0
+		UNION SELECT raw FROM protocol_interactions WHERE raw_flags & ? != 0
+	`, flagBlob, flagBlob)
+	if err != nil {
+		return 0, fmt.Errorf("query blob references: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var ref []byte
+		if err := rows.Scan(&ref); err != nil {
+			return 0, fmt.Errorf("scan blob reference: %w", err)
+		}
+		used[string(ref)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("query blob references: %w", err)
+	}
+
+	deleted := 0
+	for _, ref := range refs {
+		if used[ref] {
+			continue
+		}
+		if err := blobs.Delete(ref); err != nil {
+			return deleted, fmt.Errorf("delete blob %s: %w", ref, err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
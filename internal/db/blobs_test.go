@@ -0,0 +1,65 @@
+package db
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollectBlobs(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = d.Close() }()
+
+	s := NewSQLite(d)
+	s.Blobs = DirBlobStore{Dir: filepath.Join(t.TempDir(), "blobs")}
+	s.SpillAbove = 1024
+
+	tokenID, err := s.CreateToken("blob-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	bodies := make([][]byte, 2)
+	ids := make([]int64, 2)
+	for n := range bodies {
+		bodies[n] = make([]byte, 4096)
+		_, _ = rand.Read(bodies[n])
+		if ids[n], err = s.CreateInteraction(tokenID, "http", "192.0.2.1", 1234, false, "POST /upload"); err != nil {
+			t.Fatalf("CreateInteraction failed: %v", err)
+		}
+		if err := s.CreateHTTPInteraction(ids[n], "POST", "http", "example.com", "/upload", "", "HTTP/1.1", "{}", bodies[n]); err != nil {
+			t.Fatalf("CreateHTTPInteraction failed: %v", err)
+		}
+	}
+
+	h, err := s.GetHTTPInteraction(ids[0])
+	if err != nil || h == nil || !bytes.Equal(h.RequestBody, bodies[0]) {
+		t.Fatalf("GetHTTPInteraction = %v; want the spilled body read back", err)
+	}
+	if _, err := GetHTTPInteraction(d, ids[0]); !errors.Is(err, ErrNoBlobStore) {
+		t.Errorf("GetHTTPInteraction without a blob store: %v, want ErrNoBlobStore", err)
+	}
+
+	if _, err := d.Exec("DELETE FROM interactions WHERE id = ?", ids[0]); err != nil {
+		t.Fatalf("delete interaction: %v", err)
+	}
+	if n, err := s.CollectBlobs(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+		t.Errorf("CollectBlobs within the grace period = %d, %v; want 0", n, err)
+	}
+	if n, err := s.CollectBlobs(time.Now().Add(time.Second)); err != nil || n != 1 {
+		t.Errorf("CollectBlobs = %d, %v; want 1", n, err)
+	}
+
+	if _, err := s.Blobs.Get(BlobRef(bodies[0])); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("collected blob still readable: %v", err)
+	}
+	if h, err := s.GetHTTPInteraction(ids[1]); err != nil || h == nil || !bytes.Equal(h.RequestBody, bodies[1]) {
+		t.Errorf("GetHTTPInteraction after collection = %v; want the referenced body kept", err)
+	}
+}
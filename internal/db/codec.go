@@ -0,0 +1,152 @@
+package db
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// DefaultCompressAbove is the body size in bytes beyond which bodies are
+// compressed by default.
+const DefaultCompressAbove = 4096
+
+// Value flags record how a stored body or attribute value was transformed,
+// so it reads back whatever the current configuration.
+const (
+	flagEncrypted = 1 << iota
+	flagCompressed
+	flagBlob
+)
+
+// codec transforms the bodies and attribute values stored for interactions.
+// The zero codec stores them as given.
+type codec struct {
+	cipher *Cipher
+
+	// compressAbove is the size beyond which bodies are compressed; zero
+	// disables compression.
+	compressAbove int
+
+	// blobs, if set, holds bodies still larger than spillAbove once
+	// compressed and encrypted.
+	blobs      BlobStore
+	spillAbove int
+}
+
+// encrypts reports whether values are sealed, and so cannot be matched in
+// SQL.
+func (c codec) encrypts() bool {
+	return c.cipher != nil
+}
+
+// encode returns a body as it is to be stored, with the flags recording how.
+// Bodies are compressed before they are encrypted, while they still
+// compress, and spilled to the blob store last, so blobs are never plain
+// when the database is not.
+func (c codec) encode(data []byte, aad string) ([]byte, int, error) {
+	flags := 0
+	if c.compressAbove > 0 && len(data) > c.compressAbove {
+		if compressed, ok := compress(data); ok {
+			data = compressed
+			flags |= flagCompressed
+		}
+	}
+	data, encrypted := c.encrypt(data, aad)
+	flags |= encrypted
+	if c.blobs != nil && len(data) > c.spillAbove {
+		ref := BlobRef(data)
+		if err := c.blobs.Put(ref, data); err != nil {
+			return nil, 0, fmt.Errorf("store blob for %s: %w", aad, err)
+		}
+		data = []byte(ref)
+		flags |= flagBlob
+	}
+	return data, flags, nil
+}
+
+// encrypt returns an attribute value as it is to be stored, with the flags
+// recording how. Values are not compressed, so that plain ones stay
+// comparable in SQL.
+func (c codec) encrypt(data []byte, aad string) ([]byte, int) {
+	if c.cipher == nil || len(data) == 0 {
+		return data, 0
+	}
+	return seal(c.cipher.aead, data, aad), flagEncrypted
+}
+
+// decode reverses encode or encrypt for a value stored with flags.
+func (c codec) decode(data []byte, flags int, aad string) ([]byte, error) {
+	if flags&flagBlob != 0 {
+		if c.blobs == nil {
+			return nil, ErrNoBlobStore
+		}
+		ref := string(data)
+		blob, err := c.blobs.Get(ref)
+		if err != nil {
+			return nil, fmt.Errorf("read blob for %s: %w", aad, err)
+		}
+		if BlobRef(blob) != ref {
+			return nil, fmt.Errorf("blob for %s does not match its hash", aad)
+		}
+		data = blob
+	}
+	if flags&flagEncrypted != 0 {
+		if c.cipher == nil {
+			return nil, ErrEncrypted
+		}
+		plaintext, err := open(c.cipher.aead, data, aad)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt %s: %w", aad, err)
+		}
+		data = plaintext
+	}
+	if flags&flagCompressed != 0 {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("decompress %s: %w", aad, err)
+		}
+		if data, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("decompress %s: %w", aad, err)
+		}
+	}
+	return data, nil
+}
+
+// compress gzips data, reporting whether that made it smaller.
+func compress(data []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, false
+	}
+	if err := zw.Close(); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), buf.Len() < len(data)
+}
+
+// AAD labels for the values a codec stores.
+func requestBodyAAD(interactionID int64) string {
+	return fmt.Sprintf("request_body:%d", interactionID)
+}
+
+func requestHeadersAAD(interactionID int64) string {
+	return fmt.Sprintf("request_headers:%d", interactionID)
+}
+
+func requestQueryAAD(interactionID int64) string {
+	return fmt.Sprintf("request_query:%d", interactionID)
+}
+
+func protocolRawAAD(interactionID int64) string {
+	return fmt.Sprintf("protocol_raw:%d", interactionID)
+}
+
+func attributeAAD(interactionID int64, key string) string {
+	return fmt.Sprintf("attribute:%d:%s", interactionID, key)
+}
+
+func webhookPayloadAAD(endpoint string, interactionID int64) string {
+	return fmt.Sprintf("webhook_payload:%s:%d", endpoint, interactionID)
+}
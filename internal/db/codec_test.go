@@ -0,0 +1,63 @@
+package db
+
+import (
+	"bytes"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = d.Close() }()
+	c, err := LoadCipher(d, bytes.Repeat([]byte{1}, KeySize))
+	if err != nil {
+		t.Fatalf("LoadCipher failed: %v", err)
+	}
+
+	blobs := DirBlobStore{Dir: filepath.Join(t.TempDir(), "blobs")}
+	repetitive := bytes.Repeat([]byte("exfiltrated row,"), 1000)
+	random := make([]byte, 8192)
+	_, _ = rand.Read(random)
+
+	tests := []struct {
+		name  string
+		codec codec
+		data  []byte
+		flags int
+	}{
+		{"plain", codec{}, repetitive, 0},
+		{"small body", codec{compressAbove: 4096}, []byte("short"), 0},
+		{"compressed", codec{compressAbove: 4096}, repetitive, flagCompressed},
+		{"incompressible", codec{compressAbove: 4096}, random, 0},
+		{"encrypted", codec{cipher: c}, repetitive, flagEncrypted},
+		{"compressed and encrypted", codec{cipher: c, compressAbove: 4096}, repetitive, flagCompressed | flagEncrypted},
+		{"under the spill size", codec{blobs: blobs, spillAbove: 1 << 20}, random, 0},
+		{"spilled", codec{blobs: blobs, spillAbove: 1024}, random, flagBlob},
+		{"compressed, encrypted and spilled", codec{cipher: c, compressAbove: 4096, blobs: blobs, spillAbove: 64}, repetitive, flagCompressed | flagEncrypted | flagBlob},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, flags, err := tt.codec.encode(tt.data, "test")
+			if err != nil {
+				t.Fatalf("encode failed: %v", err)
+			}
+			if flags != tt.flags {
+				t.Errorf("flags = %d, want %d", flags, tt.flags)
+			}
+			if flags&flagBlob != 0 && len(stored) != 64 {
+				t.Errorf("stored %d bytes, want a 64-character blob reference", len(stored))
+			}
+			if flags&(flagCompressed|flagBlob) == flagCompressed && len(stored) >= len(tt.data) {
+				t.Errorf("stored %d bytes of %d, want fewer", len(stored), len(tt.data))
+			}
+			got, err := tt.codec.decode(stored, flags, "test")
+			if err != nil || !bytes.Equal(got, tt.data) {
+				t.Errorf("decode = %d bytes, %v; want the original %d bytes", len(got), err, len(tt.data))
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// CreateCollaboratorSession binds a token to the Burp Collaborator biid whose
+// SHA-256 is biidHash.
+func CreateCollaboratorSession(d Execer, tokenID int64, biidHash []byte) error {
+	_, err := d.Exec(
+		"INSERT INTO collaborator_sessions (token_id, biid_hash, last_polled_id, created_at) VALUES (?, ?, 0, ?)",
+		tokenID, biidHash, time.Now().Unix(),
+	)
+	return err
+}
+
+// GetCollaboratorSession returns a token's Burp Collaborator session, or nil
+// if it has none.
+func GetCollaboratorSession(d Querier, tokenID int64) (*models.CollaboratorSession, error) {
+	var sess models.CollaboratorSession
+	err := d.QueryRow(
+		"SELECT token_id, biid_hash, last_polled_id, created_at FROM collaborator_sessions WHERE token_id = ?",
+		tokenID,
+	).Scan(&sess.TokenID, &sess.BIIDHash, &sess.LastPolledID, &sess.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// SetCollaboratorPolled records the newest interaction a session's poll
+// returned.
+func SetCollaboratorPolled(d Execer, tokenID, lastPolledID int64) error {
+	_, err := d.Exec("UPDATE collaborator_sessions SET last_polled_id = ? WHERE token_id = ?", lastPolledID, tokenID)
+	return err
+}
+
+// DeleteCollaboratorSession unbinds a token from its biid, reporting whether
+// it had one.
+func DeleteCollaboratorSession(d Execer, tokenID int64) (bool, error) {
+	res, err := d.Exec("DELETE FROM collaborator_sessions WHERE token_id = ?", tokenID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,43 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCollaboratorSessions(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = d.Close() }()
+	s := NewSQLite(d)
+
+	tokenID, err := s.CreateToken("collabtoken1", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if sess, err := s.GetCollaboratorSession(tokenID); sess != nil || err != nil {
+		t.Fatalf("GetCollaboratorSession before binding = %v, %v, want nil", sess, err)
+	}
+	if err := s.CreateCollaboratorSession(tokenID, []byte{1, 2}); err != nil {
+		t.Fatalf("CreateCollaboratorSession failed: %v", err)
+	}
+	if err := s.CreateCollaboratorSession(tokenID, []byte{3}); err == nil {
+		t.Error("CreateCollaboratorSession bound a token twice")
+	}
+	if err := s.SetCollaboratorPolled(tokenID, 7); err != nil {
+		t.Fatalf("SetCollaboratorPolled failed: %v", err)
+	}
+	sess, err := s.GetCollaboratorSession(tokenID)
+	if err != nil || sess == nil || sess.LastPolledID != 7 || len(sess.BIIDHash) != 2 {
+		t.Fatalf("GetCollaboratorSession = %+v, %v", sess, err)
+	}
+
+	if deleted, err := s.DeleteCollaboratorSession(tokenID); !deleted || err != nil {
+		t.Errorf("DeleteCollaboratorSession = %v, %v, want deleted", deleted, err)
+	}
+	if deleted, err := s.DeleteCollaboratorSession(tokenID); deleted || err != nil {
+		t.Errorf("DeleteCollaboratorSession again = %v, %v, want nothing deleted", deleted, err)
+	}
+}
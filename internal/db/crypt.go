@@ -0,0 +1,118 @@
+package db
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// KeySize is the length in bytes of an encryption key.
+const KeySize = 32
+
+// ErrEncrypted is returned when reading a value that was stored encrypted
+// while no encryption key is configured.
+var ErrEncrypted = errors.New("value is encrypted and no encryption key is configured")
+
+// dataKeyAAD binds a wrapped data key to its purpose.
+const dataKeyAAD = "oastrix data key"
+
+// ParseKey decodes a base64 encryption key, such as the output of
+// `openssl rand -base64 32`.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("decode encryption key: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key is %d bytes, want %d", len(key), KeySize)
+	}
+	return key, nil
+}
+
+// Cipher seals request bodies and attribute values with the database's data
+// key. The data key is stored in the database wrapped by the operator's key,
+// so the database file alone does not reveal what it holds.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// LoadCipher returns the Cipher for the database's data key, unwrapping it
+// with kek. On first use it generates a data key and stores it wrapped by kek.
+func LoadCipher(d *sql.DB, kek []byte) (*Cipher, error) {
+	wrapper, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+
+	var wrapped []byte
+	err = d.QueryRow("SELECT wrapped FROM encryption_keys ORDER BY id LIMIT 1").Scan(&wrapped)
+	if errors.Is(err, sql.ErrNoRows) {
+		dek := make([]byte, KeySize)
+		if _, err := rand.Read(dek); err != nil {
+			return nil, fmt.Errorf("generate data key: %w", err)
+		}
+		wrapped = seal(wrapper, dek, dataKeyAAD)
+		if _, err := d.Exec("INSERT INTO encryption_keys (wrapped, created_at) VALUES (?, ?)", wrapped, time.Now().Unix()); err != nil {
+			return nil, fmt.Errorf("store data key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("read data key: %w", err)
+	}
+
+	dek, err := open(wrapper, wrapped, dataKeyAAD)
+	if err != nil {
+		return nil, errors.New("encryption key does not match the one the database was encrypted with")
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// HasDataKey reports whether the database has a data key, and so may hold
+// values that can only be read with the encryption key.
+func HasDataKey(d *sql.DB) (bool, error) {
+	var n int
+	if err := d.QueryRow("SELECT COUNT(*) FROM encryption_keys").Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key is %d bytes, want %d", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext under a random nonce, which it prefixes to the
+// result. aad names where the value is stored, so it cannot be moved to
+// another row or column and still decrypt.
+func seal(aead cipher.AEAD, plaintext []byte, aad string) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return aead.Seal(nonce, nonce, plaintext, []byte(aad))
+}
+
+// open reverses seal.
+func open(aead cipher.AEAD, data []byte, aad string) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("encrypted value too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(aad))
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseKey(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+	got, err := ParseKey(base64.StdEncoding.EncodeToString(key) + "\n")
+	if err != nil || !bytes.Equal(got, key) {
+		t.Errorf("ParseKey = %x, %v; want %x", got, err, key)
+	}
+
+	for _, s := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(key[:16])} {
+		if _, err := ParseKey(s); err == nil {
+			t.Errorf("ParseKey(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestSQLiteEncryption(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	kek := bytes.Repeat([]byte{1}, KeySize)
+	c, err := LoadCipher(db, kek)
+	if err != nil {
+		t.Fatalf("LoadCipher failed: %v", err)
+	}
+	s := NewSQLite(db)
+	s.Cipher = c
+
+	tokenID, err := s.CreateToken("crypt-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	id, err := s.CreateInteraction(tokenID, "http", "192.0.2.1", 1234, false, "POST /login")
+	if err != nil {
+		t.Fatalf("CreateInteraction failed: %v", err)
+	}
+	headers := `{"Authorization":["Bearer s3cret"]}`
+	if err := s.CreateHTTPInteraction(id, "POST", "http", "example.com", "/login", "api_key=k3y", "HTTP/1.1", headers, []byte("password=hunter2")); err != nil {
+		t.Fatalf("CreateHTTPInteraction failed: %v", err)
+	}
+	if err := s.SaveAttributes(id, map[string]any{"user": "admin", "tags": []string{"a", "b"}}); err != nil {
+		t.Fatalf("SaveAttributes failed: %v", err)
+	}
+
+	var stored []byte
+	var flags int
+	if err := db.QueryRow("SELECT request_body, request_body_flags FROM http_interactions WHERE interaction_id = ?", id).Scan(&stored, &flags); err != nil {
+		t.Fatalf("query body: %v", err)
+	}
+	if flags != flagEncrypted || bytes.Contains(stored, []byte("hunter2")) {
+		t.Errorf("stored body %q with flags %d, want it encrypted", stored, flags)
+	}
+
+	var storedHeaders, storedQuery []byte
+	if err := db.QueryRow("SELECT request_headers, query, request_flags FROM http_interactions WHERE interaction_id = ?", id).Scan(&storedHeaders, &storedQuery, &flags); err != nil {
+		t.Fatalf("query headers: %v", err)
+	}
+	if flags != flagEncrypted || bytes.Contains(storedHeaders, []byte("s3cret")) || bytes.Contains(storedQuery, []byte("k3y")) {
+		t.Errorf("stored headers %q and query %q with flags %d, want them encrypted", storedHeaders, storedQuery, flags)
+	}
+
+	h, err := s.GetHTTPInteraction(id)
+	if err != nil || h == nil || string(h.RequestBody) != "password=hunter2" || h.RequestHeaders != headers || h.Query != "api_key=k3y" {
+		t.Errorf("GetHTTPInteraction = %+v, %v; want the request decrypted", h, err)
+	}
+	details, err := s.ListInteractionDetails(tokenID, InteractionFilter{})
+	if err != nil || len(details) != 1 || details[0].HTTP == nil || details[0].HTTP.RequestHeaders != headers || details[0].HTTP.Query != "api_key=k3y" {
+		t.Errorf("ListInteractionDetails = %+v, %v; want the request decrypted", details, err)
+	}
+	attrs, err := s.GetAttributes(id)
+	if err != nil || attrs["user"] != "admin" {
+		t.Errorf("GetAttributes = %v, %v; want the values decrypted", attrs, err)
+	}
+
+	filters := []struct {
+		key, value string
+		want       int
+	}{
+		{"user", "admin", 1},
+		{"tags", "b", 1},
+		{"user", "root", 0},
+	}
+	for _, f := range filters {
+		list, err := s.ListInteractions(tokenID, InteractionFilter{Attributes: map[string]string{f.key: f.value}})
+		if err != nil || len(list) != f.want {
+			t.Errorf("ListInteractions(%s=%s) = %d interactions, %v; want %d", f.key, f.value, len(list), err, f.want)
+		}
+	}
+
+	if _, err := GetHTTPInteraction(db, id); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("GetHTTPInteraction without a key: %v, want ErrEncrypted", err)
+	}
+	if _, err := LoadCipher(db, bytes.Repeat([]byte{2}, KeySize)); err == nil {
+		t.Error("LoadCipher with another key succeeded, want an error")
+	}
+	if ok, err := HasDataKey(db); err != nil || !ok {
+		t.Errorf("HasDataKey = %v, %v; want true", ok, err)
+	}
+}
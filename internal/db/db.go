@@ -4,8 +4,10 @@ package db
 import (
 	"database/sql"
 	"embed"
+	"encoding/json"
 	"fmt"
-	"path/filepath"
+	"io/fs"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -17,18 +19,126 @@ import (
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
+// Options tunes the SQLite connections Open makes and the pool holding them.
+// Zero fields keep the defaults.
+type Options struct {
+	// BusyTimeout is how long a statement waits for another connection's
+	// lock before failing with SQLITE_BUSY. Defaults to DefaultBusyTimeout.
+	BusyTimeout time.Duration
+
+	// CacheSize is each connection's page cache, as for PRAGMA cache_size: a
+	// number of pages if positive, or of KiB if negative. Zero keeps
+	// SQLite's default.
+	CacheSize int
+
+	// MmapSize is how many bytes of the database file each connection may
+	// memory-map, as for PRAGMA mmap_size. Zero disables memory-mapping.
+	MmapSize int64
+
+	// Synchronous is the PRAGMA synchronous level: OFF, NORMAL, FULL or
+	// EXTRA. Defaults to NORMAL, which is durable in WAL mode except across
+	// power loss.
+	Synchronous string
+
+	// MaxOpenConns, MaxIdleConns, ConnMaxLifetime and ConnMaxIdleTime
+	// configure the sql.DB connection pool; zero keeps the database/sql
+	// defaults.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// DefaultBusyTimeout is the busy timeout of connections opened without one.
+const DefaultBusyTimeout = 5 * time.Second
+
+// connectionPragmas returns the pragmas each new connection runs. They are
+// passed in the DSN rather than executed once, as they only apply to the
+// connection that runs them.
+func (o Options) connectionPragmas() ([]string, error) {
+	busyTimeout := o.BusyTimeout
+	if busyTimeout <= 0 {
+		busyTimeout = DefaultBusyTimeout
+	}
+	synchronous := strings.ToUpper(o.Synchronous)
+	switch synchronous {
+	case "":
+		synchronous = "NORMAL"
+	case "OFF", "NORMAL", "FULL", "EXTRA":
+	default:
+		return nil, fmt.Errorf("invalid synchronous level %q: want OFF, NORMAL, FULL or EXTRA", o.Synchronous)
+	}
+	if o.MmapSize < 0 {
+		return nil, fmt.Errorf("invalid mmap size %d", o.MmapSize)
+	}
+
+	pragmas := []string{
+		fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()),
+		"foreign_keys(1)",
+		"synchronous(" + synchronous + ")",
+		fmt.Sprintf("mmap_size(%d)", o.MmapSize),
+	}
+	if o.CacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("cache_size(%d)", o.CacheSize))
+	}
+	return pragmas, nil
+}
+
 // Open opens a SQLite database at the given path and applies pending migrations.
 func Open(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	return OpenWithOptions(dbPath, Options{})
+}
+
+// OpenWithOptions is Open with the connections and pool tuned by o.
+func OpenWithOptions(dbPath string, o Options) (*sql.DB, error) {
+	db, err := openDB(dbPath, o)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyMigrations(db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("apply migrations: %w", err)
+	}
+
+	return db, nil
+}
+
+// OpenWithoutMigrations opens a SQLite database at the given path as Open
+// does, but leaves its schema as it is.
+func OpenWithoutMigrations(dbPath string) (*sql.DB, error) {
+	return openDB(dbPath, Options{})
+}
+
+func openDB(dbPath string, o Options) (*sql.DB, error) {
+	pragmas, err := o.connectionPragmas()
+	if err != nil {
+		return nil, err
+	}
+	query := url.Values{"_pragma": pragmas}
+	db, err := sql.Open("sqlite", dbPath+"?"+query.Encode())
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
+	if o.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(o.MaxOpenConns)
+	}
+	if o.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(o.MaxIdleConns)
+	}
+	if o.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(o.ConnMaxLifetime)
+	}
+	if o.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(o.ConnMaxIdleTime)
+	}
 
-	pragmas := []string{
+	// These are properties of the database file, so setting them on one
+	// connection is enough.
+	pragmas = []string{
+		// Only takes effect on a new database; existing ones need a VACUUM.
+		"PRAGMA auto_vacuum=INCREMENTAL;",
 		"PRAGMA journal_mode=WAL;",
-		"PRAGMA foreign_keys=ON;",
-		"PRAGMA busy_timeout=5000;",
-		"PRAGMA synchronous=NORMAL;",
 	}
 	for _, pragma := range pragmas {
 		if _, err := db.Exec(pragma); err != nil {
@@ -37,14 +147,14 @@ func Open(dbPath string) (*sql.DB, error) {
 		}
 	}
 
-	if err := applyMigrations(db); err != nil {
-		_ = db.Close()
-		return nil, fmt.Errorf("apply migrations: %w", err)
-	}
-
 	return db, nil
 }
 
+// Migrate applies the server's pending schema migrations.
+func Migrate(d *sql.DB) error {
+	return applyMigrations(d)
+}
+
 func applyMigrations(db *sql.DB) error {
 	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
 		version INTEGER PRIMARY KEY,
@@ -54,7 +164,31 @@ func applyMigrations(db *sql.DB) error {
 		return fmt.Errorf("create schema_migrations: %w", err)
 	}
 
-	entries, err := migrationsFS.ReadDir("migrations")
+	migrations, err := fs.Sub(migrationsFS, "migrations")
+	if err != nil {
+		return fmt.Errorf("read migrations dir: %w", err)
+	}
+	return migrate(db, migrations,
+		"SELECT COUNT(*) FROM schema_migrations WHERE version = ?",
+		"INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)")
+}
+
+// ApplyPluginMigrations applies the migrations in the root of fsys that have
+// not yet been applied for pluginID. Files are named like the server's own,
+// NNN_description.sql, and versioned separately for each plugin.
+func ApplyPluginMigrations(d *sql.DB, pluginID string, fsys fs.FS) error {
+	return migrate(d, fsys,
+		"SELECT COUNT(*) FROM plugin_migrations WHERE version = ? AND plugin_id = ?",
+		"INSERT INTO plugin_migrations (version, applied_at, plugin_id) VALUES (?, ?, ?)",
+		pluginID)
+}
+
+// migrate applies the .sql files in the root of fsys in version order. Each
+// is skipped if checkQuery counts it as applied, and otherwise run in a
+// transaction with recordQuery. Both queries take the version, recordQuery
+// then the time applied, followed by args.
+func migrate(db *sql.DB, fsys fs.FS, checkQuery, recordQuery string, args ...any) error {
+	entries, err := fs.ReadDir(fsys, ".")
 	if err != nil {
 		return fmt.Errorf("read migrations dir: %w", err)
 	}
@@ -74,7 +208,7 @@ func applyMigrations(db *sql.DB) error {
 		}
 
 		var count int
-		err = db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = ?", version).Scan(&count)
+		err = db.QueryRow(checkQuery, append([]any{version}, args...)...).Scan(&count)
 		if err != nil {
 			return fmt.Errorf("check migration %d: %w", version, err)
 		}
@@ -82,19 +216,26 @@ func applyMigrations(db *sql.DB) error {
 			continue
 		}
 
-		content, err := migrationsFS.ReadFile(filepath.Join("migrations", name))
+		content, err := fs.ReadFile(fsys, name)
 		if err != nil {
 			return fmt.Errorf("read migration %s: %w", name, err)
 		}
 
-		if _, err := db.Exec(string(content)); err != nil {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(string(content)); err != nil {
+			_ = tx.Rollback()
 			return fmt.Errorf("exec migration %s: %w", name, err)
 		}
-
-		if _, err := db.Exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)",
-			version, time.Now().Unix()); err != nil {
+		if _, err := tx.Exec(recordQuery, append([]any{version, time.Now().Unix()}, args...)...); err != nil {
+			_ = tx.Rollback()
 			return fmt.Errorf("record migration %d: %w", version, err)
 		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit migration %s: %w", name, err)
+		}
 	}
 
 	return nil
@@ -117,19 +258,64 @@ type TokenWithCount struct {
 	Token            string
 	Label            *string
 	CreatedAt        int64
+	ExpiresAt        *int64
+	Enabled          bool
+	Tags             []string
+	Aliases          []string
 	InteractionCount int
 }
 
-// ListTokensByAPIKey retrieves all tokens for an API key with their interaction counts.
-func ListTokensByAPIKey(d *sql.DB, apiKeyID int64) ([]TokenWithCount, error) {
-	rows, err := d.Query(`
-		SELECT t.token, t.label, t.created_at, COUNT(i.id) as interaction_count
+// TokenFilter narrows the tokens returned by ListTokensByAPIKey. Zero-valued
+// fields do not filter.
+type TokenFilter struct {
+	Tags  []string // only tokens carrying all of these tags
+	Label string   // only tokens whose label contains this, case-insensitively
+}
+
+// tokenWithCountQuery selects tokens with their tags, aliases and interaction counts;
+// callers append a WHERE clause on t.
+const tokenWithCountQuery = `
+		SELECT t.token, t.label, t.created_at, t.expires_at, t.enabled,
+			(SELECT json_group_array(tag) FROM token_tags WHERE token_id = t.id) AS tags,
+			(SELECT json_group_array(alias) FROM token_aliases WHERE token_id = t.id) AS aliases,
+			COUNT(i.id) as interaction_count
 		FROM tokens t
 		LEFT JOIN interactions i ON i.token_id = t.id
-		WHERE t.api_key_id = ?
-		GROUP BY t.id
-		ORDER BY t.created_at DESC
-	`, apiKeyID)
+`
+
+func scanTokenWithCount(row rowScanner) (TokenWithCount, error) {
+	var t TokenWithCount
+	var tags, aliases string
+	if err := row.Scan(&t.Token, &t.Label, &t.CreatedAt, &t.ExpiresAt, &t.Enabled, &tags, &aliases, &t.InteractionCount); err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal([]byte(tags), &t.Tags); err != nil {
+		return t, fmt.Errorf("decode tags: %w", err)
+	}
+	if err := json.Unmarshal([]byte(aliases), &t.Aliases); err != nil {
+		return t, fmt.Errorf("decode aliases: %w", err)
+	}
+	sort.Strings(t.Tags)
+	sort.Strings(t.Aliases)
+	return t, nil
+}
+
+// ListTokensByAPIKey retrieves the tokens for an API key matching f with their
+// interaction counts.
+func ListTokensByAPIKey(d *sql.DB, apiKeyID int64, f TokenFilter) ([]TokenWithCount, error) {
+	query := tokenWithCountQuery + " WHERE t.api_key_id = ?"
+	args := []any{apiKeyID}
+	for _, tag := range f.Tags {
+		query += " AND EXISTS (SELECT 1 FROM token_tags tt WHERE tt.token_id = t.id AND tt.tag = ?)"
+		args = append(args, tag)
+	}
+	if f.Label != "" {
+		query += " AND instr(lower(t.label), lower(?)) > 0"
+		args = append(args, f.Label)
+	}
+	query += " GROUP BY t.id ORDER BY t.created_at DESC"
+
+	rows, err := d.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -137,11 +323,26 @@ func ListTokensByAPIKey(d *sql.DB, apiKeyID int64) ([]TokenWithCount, error) {
 
 	var tokens []TokenWithCount
 	for rows.Next() {
-		var t TokenWithCount
-		if err := rows.Scan(&t.Token, &t.Label, &t.CreatedAt, &t.InteractionCount); err != nil {
+		t, err := scanTokenWithCount(rows)
+		if err != nil {
 			return nil, err
 		}
 		tokens = append(tokens, t)
 	}
 	return tokens, rows.Err()
 }
+
+// GetTokenWithCount retrieves a single token by ID with its interaction count.
+func GetTokenWithCount(d *sql.DB, tokenID int64) (*TokenWithCount, error) {
+	t, err := scanTokenWithCount(d.QueryRow(tokenWithCountQuery+`
+		WHERE t.id = ?
+		GROUP BY t.id
+	`, tokenID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
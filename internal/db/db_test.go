@@ -1,9 +1,12 @@
 package db
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestOpenCreatesDatabase(t *testing.T) {
@@ -31,7 +34,7 @@ func TestMigrationsApplied(t *testing.T) {
 	}
 	defer func() { _ = db.Close() }()
 
-	tables := []string{"schema_migrations", "api_keys", "tokens", "interactions", "http_interactions", "dns_interactions", "interaction_attributes", "token_plugin_config"}
+	tables := []string{"schema_migrations", "api_keys", "tokens", "interactions", "http_interactions", "dns_interactions", "interaction_attributes", "token_plugin_config", "plugin_config", "plugin_migrations"}
 	for _, table := range tables {
 		var name string
 		err := db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name=?", table).Scan(&name)
@@ -61,6 +64,55 @@ func TestForeignKeysEnabled(t *testing.T) {
 	}
 }
 
+func TestOpenWithOptions(t *testing.T) {
+	db, err := OpenWithOptions(filepath.Join(t.TempDir(), "test.db"), Options{
+		BusyTimeout:  time.Second,
+		CacheSize:    -4096,
+		MmapSize:     1 << 20,
+		Synchronous:  "full",
+		MaxOpenConns: 2,
+	})
+	if err != nil {
+		t.Fatalf("OpenWithOptions failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	// Hold two connections at once, so the settings are seen to apply to
+	// every connection in the pool rather than only the first.
+	ctx := context.Background()
+	for range 2 {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("Conn failed: %v", err)
+		}
+		defer func() { _ = conn.Close() }()
+
+		pragmas := []struct {
+			name string
+			want int64
+		}{
+			{"busy_timeout", 1000},
+			{"cache_size", -4096},
+			{"mmap_size", 1 << 20},
+			{"synchronous", 2}, // FULL
+			{"foreign_keys", 1},
+		}
+		for _, p := range pragmas {
+			var got int64
+			if err := conn.QueryRowContext(ctx, "PRAGMA "+p.name).Scan(&got); err != nil {
+				t.Fatalf("PRAGMA %s failed: %v", p.name, err)
+			}
+			if got != p.want {
+				t.Errorf("PRAGMA %s = %d, want %d", p.name, got, p.want)
+			}
+		}
+	}
+
+	if _, err := OpenWithOptions(filepath.Join(t.TempDir(), "test.db"), Options{Synchronous: "sometimes"}); err == nil {
+		t.Error("OpenWithOptions accepted an invalid synchronous level")
+	}
+}
+
 func TestCascadeDelete(t *testing.T) {
 	tmpDir := t.TempDir()
 	dbPath := filepath.Join(tmpDir, "test.db")
@@ -130,3 +182,72 @@ func TestParseVersion(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyPluginMigrations(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	geo := fstest.MapFS{
+		"001_create.sql": {Data: []byte("CREATE TABLE geoip_cache (ip TEXT PRIMARY KEY, country TEXT)")},
+		"002_index.sql":  {Data: []byte("CREATE INDEX idx_geoip_cache_country ON geoip_cache(country)")},
+		"README.md":      {Data: []byte("not a migration")},
+	}
+	smtp := fstest.MapFS{
+		"001_create.sql": {Data: []byte("CREATE TABLE smtp_messages (id INTEGER PRIMARY KEY, body BLOB)")},
+	}
+
+	for range 2 {
+		if err := ApplyPluginMigrations(db, "geoip", geo); err != nil {
+			t.Fatalf("ApplyPluginMigrations(geoip) failed: %v", err)
+		}
+	}
+	if err := ApplyPluginMigrations(db, "smtp", smtp); err != nil {
+		t.Fatalf("ApplyPluginMigrations(smtp) failed: %v", err)
+	}
+
+	for _, table := range []string{"geoip_cache", "smtp_messages"} {
+		var name string
+		if err := db.QueryRow("SELECT name FROM sqlite_master WHERE type='table' AND name=?", table).Scan(&name); err != nil {
+			t.Errorf("table %s not found: %v", table, err)
+		}
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM plugin_migrations").Scan(&count); err != nil {
+		t.Fatalf("count plugin_migrations: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("plugin_migrations has %d rows, want 3", count)
+	}
+}
+
+func TestApplyPluginMigrationsRollsBack(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	broken := fstest.MapFS{
+		"001_create.sql": {Data: []byte("CREATE TABLE broken_a (id INTEGER); CREATE TABLE broken_a (id INTEGER);")},
+	}
+	if err := ApplyPluginMigrations(db, "broken", broken); err == nil {
+		t.Fatal("expected an error from a failing migration")
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'broken_a'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("failed migration left its table behind")
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM plugin_migrations WHERE plugin_id = 'broken'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Error("failed migration was recorded")
+	}
+}
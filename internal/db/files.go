@@ -0,0 +1,80 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// PutTokenFile stores content at path for a token, replacing any existing file.
+func PutTokenFile(d *sql.DB, tokenID int64, path, contentType string, content []byte) error {
+	_, err := d.Exec(`
+		INSERT INTO token_files (token_id, path, content_type, content, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (token_id, path) DO UPDATE SET
+			content_type = excluded.content_type,
+			content = excluded.content,
+			created_at = excluded.created_at
+	`, tokenID, path, contentType, content, time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("put token file: %w", err)
+	}
+	return nil
+}
+
+// GetTokenFile retrieves a token's file at path, including its content. It
+// returns nil if there is none.
+func GetTokenFile(d *sql.DB, tokenID int64, path string) (*models.TokenFile, error) {
+	f := models.TokenFile{TokenID: tokenID, Path: path}
+	err := d.QueryRow(`
+		SELECT content_type, content, created_at FROM token_files
+		WHERE token_id = ? AND path = ?
+	`, tokenID, path).Scan(&f.ContentType, &f.Content, &f.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Content == nil {
+		f.Content = []byte{}
+	}
+	f.Size = int64(len(f.Content))
+	return &f, nil
+}
+
+// ListTokenFiles retrieves a token's files ordered by path, without content.
+func ListTokenFiles(d *sql.DB, tokenID int64) ([]models.TokenFile, error) {
+	rows, err := d.Query(`
+		SELECT path, content_type, length(content), created_at FROM token_files
+		WHERE token_id = ?
+		ORDER BY path
+	`, tokenID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var files []models.TokenFile
+	for rows.Next() {
+		f := models.TokenFile{TokenID: tokenID}
+		if err := rows.Scan(&f.Path, &f.ContentType, &f.Size, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// DeleteTokenFile removes a token's file at path, reporting whether it existed.
+func DeleteTokenFile(d *sql.DB, tokenID int64, path string) (bool, error) {
+	res, err := d.Exec("DELETE FROM token_files WHERE token_id = ? AND path = ?", tokenID, path)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestTokenFiles(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	tokenID, err := CreateToken(db, "filetoken", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	if err := PutTokenFile(db, tokenID, "/x.dtd", "application/xml-dtd", []byte("<!ENTITY a 'b'>")); err != nil {
+		t.Fatalf("put file: %v", err)
+	}
+	if err := PutTokenFile(db, tokenID, "/a.svg", "image/svg+xml", []byte("<svg/>")); err != nil {
+		t.Fatalf("put file: %v", err)
+	}
+	if err := PutTokenFile(db, tokenID, "/x.dtd", "text/plain", []byte("replaced")); err != nil {
+		t.Fatalf("replace file: %v", err)
+	}
+
+	f, err := GetTokenFile(db, tokenID, "/x.dtd")
+	if err != nil || f == nil {
+		t.Fatalf("get file: %v, %v", f, err)
+	}
+	if string(f.Content) != "replaced" || f.ContentType != "text/plain" || f.Size != 8 {
+		t.Errorf("file = %+v", f)
+	}
+	if f, err := GetTokenFile(db, tokenID, "/missing"); err != nil || f != nil {
+		t.Errorf("get missing file = %v, %v; want nil, nil", f, err)
+	}
+
+	files, err := ListTokenFiles(db, tokenID)
+	if err != nil {
+		t.Fatalf("list files: %v", err)
+	}
+	if len(files) != 2 || files[0].Path != "/a.svg" || files[1].Path != "/x.dtd" {
+		t.Fatalf("files = %+v", files)
+	}
+	if files[0].Size != 6 || files[0].Content != nil {
+		t.Errorf("listed file = %+v, want size 6 without content", files[0])
+	}
+
+	if ok, err := DeleteTokenFile(db, tokenID, "/a.svg"); err != nil || !ok {
+		t.Errorf("delete file = %v, %v", ok, err)
+	}
+	if ok, err := DeleteTokenFile(db, tokenID, "/a.svg"); err != nil || ok {
+		t.Errorf("delete missing file = %v, %v", ok, err)
+	}
+
+	if err := DeleteToken(db, "filetoken"); err != nil {
+		t.Fatalf("delete token: %v", err)
+	}
+	if f, err := GetTokenFile(db, tokenID, "/x.dtd"); err != nil || f != nil {
+		t.Errorf("file survived token deletion: %v, %v", f, err)
+	}
+}
@@ -1,21 +1,32 @@
 package db
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"slices"
 	"time"
 
-	"github.com/rsclarke/oastrix/internal/models"
+	"github.com/rsclarke/oastrix/pkg/models"
 )
 
 // CreateInteraction inserts a new interaction record and returns its ID.
-func CreateInteraction(d *sql.DB, tokenID int64, kind string, remoteIP string, remotePort int, tls bool, summary string) (int64, error) {
+func CreateInteraction(d Execer, tokenID int64, kind string, remoteIP string, remotePort int, tls bool, summary string) (int64, error) {
+	return CreateInteractionAt(d, time.Now().Unix(), tokenID, kind, remoteIP, remotePort, tls, summary)
+}
+
+// CreateInteractionAt is CreateInteraction for an interaction that occurred
+// at the Unix timestamp occurredAt, such as one being imported.
+func CreateInteractionAt(d Execer, occurredAt int64, tokenID int64, kind string, remoteIP string, remotePort int, tls bool, summary string) (int64, error) {
 	tlsVal := 0
 	if tls {
 		tlsVal = 1
 	}
 	result, err := d.Exec(
 		"INSERT INTO interactions (token_id, kind, occurred_at, remote_ip, remote_port, tls, summary) VALUES (?, ?, ?, ?, ?, ?, ?)",
-		tokenID, kind, time.Now().Unix(), remoteIP, remotePort, tlsVal, summary,
+		tokenID, kind, occurredAt, remoteIP, remotePort, tlsVal, summary,
 	)
 	if err != nil {
 		return 0, err
@@ -24,20 +35,135 @@ func CreateInteraction(d *sql.DB, tokenID int64, kind string, remoteIP string, r
 }
 
 // CreateHTTPInteraction inserts HTTP-specific details for an interaction.
-func CreateHTTPInteraction(d *sql.DB, interactionID int64, method, scheme, host, path, query, httpVersion string, headers string, body []byte) error {
-	_, err := d.Exec(
-		"INSERT INTO http_interactions (interaction_id, method, scheme, host, path, query, http_version, request_headers, request_body) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		interactionID, method, scheme, host, path, query, httpVersion, headers, body,
+func CreateHTTPInteraction(d Execer, interactionID int64, method, scheme, host, path, query, httpVersion string, headers string, body []byte) error {
+	return createHTTPInteraction(d, codec{}, interactionID, method, scheme, host, path, query, httpVersion, headers, body)
+}
+
+func createHTTPInteraction(d Execer, c codec, interactionID int64, method, scheme, host, path, query, httpVersion string, headers string, body []byte) error {
+	body, flags, err := c.encode(body, requestBodyAAD(interactionID))
+	if err != nil {
+		return err
+	}
+	// Headers and query strings are where credentials usually are, so they
+	// are sealed like the body. Both are sealed or neither, under one flag.
+	var storedHeaders, storedQuery any = headers, query
+	requestFlags := 0
+	if c.encrypts() {
+		storedHeaders, _ = c.encrypt([]byte(headers), requestHeadersAAD(interactionID))
+		storedQuery, _ = c.encrypt([]byte(query), requestQueryAAD(interactionID))
+		requestFlags = flagEncrypted
+	}
+	_, err = d.Exec(
+		"INSERT INTO http_interactions (interaction_id, method, scheme, host, path, query, http_version, request_headers, request_body, request_body_flags, request_flags) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		interactionID, method, scheme, host, path, storedQuery, httpVersion, storedHeaders, body, flags, requestFlags,
 	)
 	return err
 }
 
+// Cursor is the position of an interaction in the newest-first order
+// ListInteractions returns. Imported interactions keep their original time
+// but get new IDs, so the order cannot be resumed from an ID alone.
+type Cursor struct {
+	OccurredAt int64
+	ID         int64
+}
+
+// InteractionFilter narrows the interactions returned by ListInteractions.
+// Zero-valued fields do not filter.
+type InteractionFilter struct {
+	SinceID int64   // only interactions with an ID greater than this
+	After   *Cursor // only interactions listed after this position
+	Since   int64   // only interactions that occurred at or after this Unix timestamp
+	Limit   int     // maximum number of interactions to return
+
+	// Ascending lists interactions in ID order, the order they were stored
+	// in, so a limited poll from SinceID returns the next ones to deliver
+	// rather than the newest.
+	Ascending bool
+
+	// Attributes, keyed by attribute key, only matches interactions whose
+	// attribute equals the value, or is a list containing it.
+	Attributes map[string]string
+}
+
+// attributeCondition matches interactions by one attribute, using the
+// (key, value) index for values stored as a JSON string or as the literal
+// JSON, such as a number. Encrypted values never match.
+const attributeCondition = ` AND interactions.id IN (
+	SELECT interaction_id FROM interaction_attributes
+	WHERE key = ? AND flags = 0 AND (value IN (?, ?)
+		OR (json_type(value) = 'array' AND EXISTS (SELECT 1 FROM json_each(interaction_attributes.value) WHERE json_each.value = ?)))
+)`
+
+// attributeKeyCondition matches interactions that have an attribute,
+// whatever its value.
+const attributeKeyCondition = ` AND interactions.id IN (SELECT interaction_id FROM interaction_attributes WHERE key = ?)`
+
 // GetInteractionsByToken retrieves all interactions for a given token ID.
 func GetInteractionsByToken(d *sql.DB, tokenID int64) ([]models.Interaction, error) {
-	rows, err := d.Query(
-		"SELECT id, token_id, kind, occurred_at, remote_ip, remote_port, tls, summary FROM interactions WHERE token_id = ? ORDER BY occurred_at DESC",
-		tokenID,
-	)
+	return ListInteractions(d, tokenID, InteractionFilter{})
+}
+
+// ListInteractions retrieves the interactions for a given token ID that match the filter.
+func ListInteractions(d *sql.DB, tokenID int64, f InteractionFilter) ([]models.Interaction, error) {
+	return listInteractions(d, codec{}, tokenID, f)
+}
+
+// interactionConditions returns the WHERE clause, ORDER BY and LIMIT selecting
+// the interactions that match f, qualifying columns so the interactions table
+// can be joined. Encrypted values cannot be compared in SQL, so when
+// attributes may be encrypted the query only requires the filtered keys and
+// matchInSQL is false: the caller must match the values once decrypted, and
+// apply the limit itself.
+func interactionConditions(c codec, tokenID int64, f InteractionFilter) (clause string, args []any, matchInSQL bool, err error) {
+	matchInSQL = !c.encrypts() || len(f.Attributes) == 0
+
+	clause = " WHERE interactions.token_id = ?"
+	args = []any{tokenID}
+	if f.SinceID > 0 {
+		clause += " AND interactions.id > ?"
+		args = append(args, f.SinceID)
+	}
+	if f.After != nil {
+		clause += " AND (interactions.occurred_at, interactions.id) < (?, ?)"
+		args = append(args, f.After.OccurredAt, f.After.ID)
+	}
+	if f.Since > 0 {
+		clause += " AND interactions.occurred_at >= ?"
+		args = append(args, f.Since)
+	}
+	for _, key := range slices.Sorted(maps.Keys(f.Attributes)) {
+		if !matchInSQL {
+			clause += attributeKeyCondition
+			args = append(args, key)
+			continue
+		}
+		value := f.Attributes[key]
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", nil, false, err
+		}
+		clause += attributeCondition
+		args = append(args, key, string(encoded), value, value)
+	}
+	if f.Ascending {
+		clause += " ORDER BY interactions.id"
+	} else {
+		clause += " ORDER BY interactions.occurred_at DESC, interactions.id DESC"
+	}
+	if f.Limit > 0 && matchInSQL {
+		clause += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+	return clause, args, matchInSQL, nil
+}
+
+func listInteractions(d *sql.DB, c codec, tokenID int64, f InteractionFilter) ([]models.Interaction, error) {
+	clause, args, matchInSQL, err := interactionConditions(c, tokenID, f)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := d.Query("SELECT id, token_id, kind, occurred_at, remote_ip, remote_port, tls, summary FROM interactions"+clause, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -54,28 +180,240 @@ func GetInteractionsByToken(d *sql.DB, tokenID int64) ([]models.Interaction, err
 		i.TLS = tlsVal != 0
 		interactions = append(interactions, i)
 	}
-	return interactions, rows.Err()
+	if err := rows.Err(); err != nil || matchInSQL {
+		return interactions, err
+	}
+	return filterByAttributes(d, c, interactions, f)
+}
+
+// filterByAttributes returns the interactions whose decrypted attributes
+// match f, up to f.Limit.
+func filterByAttributes(d *sql.DB, c codec, interactions []models.Interaction, f InteractionFilter) ([]models.Interaction, error) {
+	var matched []models.Interaction
+	for _, i := range interactions {
+		attrs, err := getAttributes(d, c, i.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !attributesMatch(attrs, f.Attributes) {
+			continue
+		}
+		matched = append(matched, i)
+		if f.Limit > 0 && len(matched) == f.Limit {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// ListInteractionDetails is ListInteractions returning each interaction with
+// its HTTP or DNS details and its attributes. The details are read in the
+// same query as the interactions, and the attributes in batches, rather
+// than with a query per interaction.
+func ListInteractionDetails(d *sql.DB, tokenID int64, f InteractionFilter) ([]models.InteractionDetails, error) {
+	return listInteractionDetails(d, codec{}, tokenID, f)
+}
+
+func listInteractionDetails(d *sql.DB, c codec, tokenID int64, f InteractionFilter) ([]models.InteractionDetails, error) {
+	clause, args, matchInSQL, err := interactionConditions(c, tokenID, f)
+	if err != nil {
+		return nil, err
+	}
+	// The details are left joined, so the columns declared NOT NULL may
+	// still be NULL for interactions of other kinds.
+	rows, err := d.Query(`
+		SELECT interactions.id, interactions.token_id, interactions.kind, interactions.occurred_at,
+			interactions.remote_ip, interactions.remote_port, interactions.tls, interactions.summary,
+			h.interaction_id, COALESCE(h.method, ''), COALESCE(h.scheme, ''), COALESCE(h.host, ''),
+			COALESCE(h.path, ''), COALESCE(h.query, ''), COALESCE(h.http_version, ''),
+			COALESCE(h.request_headers, ''), h.request_body, COALESCE(h.request_body_flags, 0), COALESCE(h.request_flags, 0),
+			h.response_status, h.response_headers, h.response_body, h.response_body_size, h.response_body_sha256,
+			n.interaction_id, COALESCE(n.qname, ''), COALESCE(n.qtype, 0), COALESCE(n.qclass, 0),
+			COALESCE(n.rd, 0), COALESCE(n.opcode, 0), COALESCE(n.dns_id, 0), COALESCE(n.protocol, ''),
+			n.response_rcode, n.response_answers
+		FROM interactions
+		LEFT JOIN http_interactions h ON h.interaction_id = interactions.id
+		LEFT JOIN dns_interactions n ON n.interaction_id = interactions.id`+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var details []models.InteractionDetails
+	for rows.Next() {
+		var i models.InteractionDetails
+		var h models.HTTPInteraction
+		var dns models.DNSInteraction
+		var tlsVal, bodyFlags, requestFlags int
+		var httpID, dnsID *int64
+		err := rows.Scan(&i.ID, &i.TokenID, &i.Kind, &i.OccurredAt, &i.RemoteIP, &i.RemotePort, &tlsVal, &i.Summary,
+			&httpID, &h.Method, &h.Scheme, &h.Host, &h.Path, &h.Query, &h.HTTPVersion, &h.RequestHeaders, &h.RequestBody, &bodyFlags, &requestFlags,
+			&h.ResponseStatus, &h.ResponseHeaders, &h.ResponseBody, &h.ResponseBodySize, &h.ResponseBodySHA256,
+			&dnsID, &dns.QName, &dns.QType, &dns.QClass, &dns.RD, &dns.Opcode, &dns.DNSID, &dns.Protocol,
+			&dns.ResponseRCode, &dns.ResponseAnswers)
+		if err != nil {
+			return nil, err
+		}
+		i.TLS = tlsVal != 0
+		if httpID != nil {
+			h.InteractionID = *httpID
+			if err := decodeRequest(c, &h, i.ID, bodyFlags, requestFlags); err != nil {
+				return nil, err
+			}
+			i.HTTP = &h
+		}
+		if dnsID != nil {
+			dns.InteractionID = *dnsID
+			i.DNS = &dns
+		}
+		details = append(details, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, len(details))
+	for n, i := range details {
+		ids[n] = i.ID
+	}
+	attrs, err := getAttributesByIDs(d, c, ids)
+	if err != nil {
+		return nil, err
+	}
+	matched := details[:0]
+	for _, i := range details {
+		i.Attributes = attrs[i.ID]
+		if i.Attributes == nil {
+			i.Attributes = make(map[string]any)
+		}
+		if !matchInSQL && !attributesMatch(i.Attributes, f.Attributes) {
+			continue
+		}
+		matched = append(matched, i)
+		if !matchInSQL && f.Limit > 0 && len(matched) == f.Limit {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// attributesMatch reports whether every filtered attribute matches.
+func attributesMatch(attrs map[string]any, filter map[string]string) bool {
+	for key, want := range filter {
+		if !attributeMatches(attrs[key], want) {
+			return false
+		}
+	}
+	return true
+}
+
+// attributeMatches is attributeCondition for a decoded attribute value.
+func attributeMatches(value any, want string) bool {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	wantEncoded, err := json.Marshal(want)
+	if err != nil {
+		return false
+	}
+	if string(encoded) == want || string(encoded) == string(wantEncoded) {
+		return true
+	}
+	list, ok := value.([]any)
+	return ok && slices.Contains(list, any(want))
+}
+
+// GetInteraction retrieves a single interaction by its ID.
+func GetInteraction(d Querier, id int64) (*models.Interaction, error) {
+	row := d.QueryRow(
+		"SELECT id, token_id, kind, occurred_at, remote_ip, remote_port, tls, summary FROM interactions WHERE id = ?",
+		id,
+	)
+	var i models.Interaction
+	var tlsVal int
+	err := row.Scan(&i.ID, &i.TokenID, &i.Kind, &i.OccurredAt, &i.RemoteIP, &i.RemotePort, &tlsVal, &i.Summary)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	i.TLS = tlsVal != 0
+	return &i, nil
 }
 
 // GetHTTPInteraction retrieves HTTP-specific details for an interaction.
 func GetHTTPInteraction(d *sql.DB, interactionID int64) (*models.HTTPInteraction, error) {
+	return getHTTPInteraction(d, codec{}, interactionID)
+}
+
+func getHTTPInteraction(d Querier, c codec, interactionID int64) (*models.HTTPInteraction, error) {
 	row := d.QueryRow(
-		"SELECT interaction_id, method, scheme, host, path, query, http_version, request_headers, request_body FROM http_interactions WHERE interaction_id = ?",
+		"SELECT interaction_id, method, scheme, host, path, query, http_version, request_headers, request_body, request_body_flags, request_flags, response_status, response_headers, response_body, response_body_size, response_body_sha256 FROM http_interactions WHERE interaction_id = ?",
 		interactionID,
 	)
 	var h models.HTTPInteraction
-	err := row.Scan(&h.InteractionID, &h.Method, &h.Scheme, &h.Host, &h.Path, &h.Query, &h.HTTPVersion, &h.RequestHeaders, &h.RequestBody)
+	var bodyFlags, requestFlags int
+	err := row.Scan(&h.InteractionID, &h.Method, &h.Scheme, &h.Host, &h.Path, &h.Query, &h.HTTPVersion, &h.RequestHeaders, &h.RequestBody, &bodyFlags, &requestFlags,
+		&h.ResponseStatus, &h.ResponseHeaders, &h.ResponseBody, &h.ResponseBodySize, &h.ResponseBodySHA256)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
+	if err := decodeRequest(c, &h, interactionID, bodyFlags, requestFlags); err != nil {
+		return nil, err
+	}
 	return &h, nil
 }
 
+// decodeRequest reverses how createHTTPInteraction stored h's request body,
+// with bodyFlags, and its headers and query string, with requestFlags.
+func decodeRequest(c codec, h *models.HTTPInteraction, interactionID int64, bodyFlags, requestFlags int) error {
+	var err error
+	if h.RequestBody, err = c.decode(h.RequestBody, bodyFlags, requestBodyAAD(interactionID)); err != nil {
+		return err
+	}
+	if requestFlags == 0 {
+		return nil
+	}
+	// Empty values are stored as they are, even when sealing.
+	if h.RequestHeaders != "" {
+		headers, err := c.decode([]byte(h.RequestHeaders), requestFlags, requestHeadersAAD(interactionID))
+		if err != nil {
+			return err
+		}
+		h.RequestHeaders = string(headers)
+	}
+	if h.Query != "" {
+		query, err := c.decode([]byte(h.Query), requestFlags, requestQueryAAD(interactionID))
+		if err != nil {
+			return err
+		}
+		h.Query = string(query)
+	}
+	return nil
+}
+
+// ResponseSnippetSize is how much of each response body sent is kept; its
+// full size and SHA-256 are recorded alongside.
+const ResponseSnippetSize = 4096
+
+// SetHTTPResponse records the response sent for an HTTP interaction.
+func SetHTTPResponse(d Execer, interactionID int64, status int, headers string, body []byte) error {
+	sum := sha256.Sum256(body)
+	snippet := body[:min(len(body), ResponseSnippetSize)]
+	_, err := d.Exec(
+		"UPDATE http_interactions SET response_status = ?, response_headers = ?, response_body = ?, response_body_size = ?, response_body_sha256 = ? WHERE interaction_id = ?",
+		status, headers, snippet, len(body), hex.EncodeToString(sum[:]), interactionID,
+	)
+	return err
+}
+
 // CreateDNSInteraction inserts DNS-specific details for an interaction.
-func CreateDNSInteraction(d *sql.DB, interactionID int64, qname string, qtype, qclass, rd, opcode, dnsID int, protocol string) error {
+func CreateDNSInteraction(d Execer, interactionID int64, qname string, qtype, qclass, rd, opcode, dnsID int, protocol string) error {
 	_, err := d.Exec(
 		"INSERT INTO dns_interactions (interaction_id, qname, qtype, qclass, rd, opcode, dns_id, protocol) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
 		interactionID, qname, qtype, qclass, rd, opcode, dnsID, protocol,
@@ -84,13 +422,14 @@ func CreateDNSInteraction(d *sql.DB, interactionID int64, qname string, qtype, q
 }
 
 // GetDNSInteraction retrieves DNS-specific details for an interaction.
-func GetDNSInteraction(d *sql.DB, interactionID int64) (*models.DNSInteraction, error) {
+func GetDNSInteraction(d Querier, interactionID int64) (*models.DNSInteraction, error) {
 	row := d.QueryRow(
-		"SELECT interaction_id, qname, qtype, qclass, rd, opcode, dns_id, protocol FROM dns_interactions WHERE interaction_id = ?",
+		"SELECT interaction_id, qname, qtype, qclass, rd, opcode, dns_id, protocol, response_rcode, response_answers FROM dns_interactions WHERE interaction_id = ?",
 		interactionID,
 	)
 	var dns models.DNSInteraction
-	err := row.Scan(&dns.InteractionID, &dns.QName, &dns.QType, &dns.QClass, &dns.RD, &dns.Opcode, &dns.DNSID, &dns.Protocol)
+	err := row.Scan(&dns.InteractionID, &dns.QName, &dns.QType, &dns.QClass, &dns.RD, &dns.Opcode, &dns.DNSID, &dns.Protocol,
+		&dns.ResponseRCode, &dns.ResponseAnswers)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -99,3 +438,149 @@ func GetDNSInteraction(d *sql.DB, interactionID int64) (*models.DNSInteraction,
 	}
 	return &dns, nil
 }
+
+// SetDNSResponse records the response sent for a DNS interaction.
+func SetDNSResponse(d Execer, interactionID int64, rcode int, answers string) error {
+	_, err := d.Exec(
+		"UPDATE dns_interactions SET response_rcode = ?, response_answers = ? WHERE interaction_id = ?",
+		rcode, answers, interactionID,
+	)
+	return err
+}
+
+// CreateProtocolInteraction inserts the raw bytes and parsed fields (a JSON
+// object) of an interaction over a protocol without a dedicated table.
+func CreateProtocolInteraction(d Execer, interactionID int64, raw []byte, fields string) error {
+	return createProtocolInteraction(d, codec{}, interactionID, raw, fields)
+}
+
+func createProtocolInteraction(d Execer, c codec, interactionID int64, raw []byte, fields string) error {
+	raw, flags, err := c.encode(raw, protocolRawAAD(interactionID))
+	if err != nil {
+		return err
+	}
+	_, err = d.Exec(
+		"INSERT INTO protocol_interactions (interaction_id, raw, raw_flags, fields) VALUES (?, ?, ?, ?)",
+		interactionID, raw, flags, fields,
+	)
+	return err
+}
+
+// GetProtocolInteraction retrieves the details of an interaction over a
+// protocol without a dedicated table.
+func GetProtocolInteraction(d *sql.DB, interactionID int64) (*models.ProtocolInteraction, error) {
+	return getProtocolInteraction(d, codec{}, interactionID)
+}
+
+func getProtocolInteraction(d Querier, c codec, interactionID int64) (*models.ProtocolInteraction, error) {
+	row := d.QueryRow("SELECT interaction_id, raw, raw_flags, fields FROM protocol_interactions WHERE interaction_id = ?", interactionID)
+	var p models.ProtocolInteraction
+	var rawFlags int
+	err := row.Scan(&p.InteractionID, &p.Raw, &rawFlags, &p.Fields)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.Raw, err = c.decode(p.Raw, rawFlags, protocolRawAAD(interactionID)); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// purgeBatchSize bounds how many interactions a single purge statement deletes,
+// keeping each write transaction short on large databases.
+const purgeBatchSize = 500
+
+// PurgeInteractions deletes interactions for a token that occurred before the
+// given Unix timestamp and returns the number of interactions removed.
+func PurgeInteractions(d *sql.DB, tokenID int64, before int64) (int64, error) {
+	return purgeInBatches(d, `
+		DELETE FROM interactions WHERE id IN (
+			SELECT id FROM interactions WHERE token_id = ? AND occurred_at < ? LIMIT ?
+		)
+	`, tokenID, before)
+}
+
+// CountInteractions returns the number of interactions for a token that
+// occurred at or after the given Unix timestamp. A zero since counts all.
+func CountInteractions(d *sql.DB, tokenID int64, since int64) (int, error) {
+	var n int
+	err := d.QueryRow(
+		"SELECT COUNT(*) FROM interactions WHERE token_id = ? AND occurred_at >= ?",
+		tokenID, since,
+	).Scan(&n)
+	return n, err
+}
+
+// LatestInteractionID returns the ID of a token's most recent interaction, or
+// zero if it has none.
+func LatestInteractionID(d *sql.DB, tokenID int64) (int64, error) {
+	var id int64
+	err := d.QueryRow(
+		"SELECT id FROM interactions WHERE token_id = ? ORDER BY id DESC LIMIT 1",
+		tokenID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return id, err
+}
+
+// TrimInteractions deletes all but a token's newest keep interactions and
+// returns the number removed.
+func TrimInteractions(d *sql.DB, tokenID int64, keep int) (int64, error) {
+	result, err := d.Exec(`
+		DELETE FROM interactions WHERE token_id = ? AND id NOT IN (
+			SELECT id FROM interactions WHERE token_id = ? ORDER BY id DESC LIMIT ?
+		)
+	`, tokenID, tokenID, keep)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// PurgeInteractionsByAPIKey deletes interactions across every token owned by an
+// API key that occurred before the given Unix timestamp.
+func PurgeInteractionsByAPIKey(d *sql.DB, apiKeyID int64, before int64) (int64, error) {
+	return purgeInBatches(d, `
+		DELETE FROM interactions WHERE id IN (
+			SELECT i.id FROM interactions i
+			JOIN tokens t ON t.id = i.token_id
+			WHERE t.api_key_id = ? AND i.occurred_at < ? LIMIT ?
+		)
+	`, apiKeyID, before)
+}
+
+// PurgeAllInteractions deletes interactions across every token that occurred
+// before the given Unix timestamp.
+func PurgeAllInteractions(d *sql.DB, before int64) (int64, error) {
+	return purgeInBatches(d, `
+		DELETE FROM interactions WHERE id IN (
+			SELECT id FROM interactions WHERE occurred_at < ? LIMIT ?
+		)
+	`, before)
+}
+
+// purgeInBatches repeatedly executes a batched delete until it affects no rows.
+// The query must accept args followed by a batch limit.
+func purgeInBatches(d *sql.DB, query string, args ...any) (int64, error) {
+	args = append(args, purgeBatchSize)
+	var total int64
+	for {
+		result, err := d.Exec(query, args...)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
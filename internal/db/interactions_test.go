@@ -0,0 +1,330 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPurgeInteractions(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	apiKeyID, err := CreateAPIKey(db, "prefix123456", []byte("hash"), "full", nil)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	tokenID, err := CreateToken(db, "purge-token", &apiKeyID, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	// Spread old interactions over more than one batch.
+	oldCount := purgeBatchSize + 10
+	for i := 0; i < oldCount; i++ {
+		_, err := db.Exec("INSERT INTO interactions (token_id, kind, occurred_at, remote_ip, remote_port, summary) VALUES (?, 'dns', 1000, '127.0.0.1', 0, 'old')", tokenID)
+		if err != nil {
+			t.Fatalf("insert old interaction: %v", err)
+		}
+	}
+	recentID, err := CreateInteraction(db, tokenID, "http", "127.0.0.1", 1234, false, "recent")
+	if err != nil {
+		t.Fatalf("create recent interaction: %v", err)
+	}
+
+	deleted, err := PurgeInteractions(db, tokenID, 2000)
+	if err != nil {
+		t.Fatalf("PurgeInteractions failed: %v", err)
+	}
+	if deleted != int64(oldCount) {
+		t.Errorf("expected %d deleted, got %d", oldCount, deleted)
+	}
+
+	interactions, err := GetInteractionsByToken(db, tokenID)
+	if err != nil {
+		t.Fatalf("get interactions: %v", err)
+	}
+	if len(interactions) != 1 || interactions[0].ID != recentID {
+		t.Errorf("expected only recent interaction to remain, got %v", interactions)
+	}
+}
+
+func TestPurgeInteractionsByAPIKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	key1, err := CreateAPIKey(db, "prefix111111", []byte("hash1"), "full", nil)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	key2, err := CreateAPIKey(db, "prefix222222", []byte("hash2"), "full", nil)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	tokenIDs := make(map[int64]int64)
+	for _, keyID := range []int64{key1, key2} {
+		keyID := keyID
+		tokenID, err := CreateToken(db, fmt.Sprintf("token-%d", keyID), &keyID, nil, nil)
+		if err != nil {
+			t.Fatalf("create token: %v", err)
+		}
+		tokenIDs[keyID] = tokenID
+		_, err = db.Exec("INSERT INTO interactions (token_id, kind, occurred_at, remote_ip, remote_port, summary) VALUES (?, 'dns', 1000, '127.0.0.1', 0, 'old')", tokenID)
+		if err != nil {
+			t.Fatalf("insert interaction: %v", err)
+		}
+	}
+
+	deleted, err := PurgeInteractionsByAPIKey(db, key1, 2000)
+	if err != nil {
+		t.Fatalf("PurgeInteractionsByAPIKey failed: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("expected 1 deleted, got %d", deleted)
+	}
+
+	remaining, err := GetInteractionsByToken(db, tokenIDs[key2])
+	if err != nil {
+		t.Fatalf("get interactions: %v", err)
+	}
+	if len(remaining) != 1 {
+		t.Errorf("expected other key's interaction to remain, got %d", len(remaining))
+	}
+}
+
+func TestListInteractionsFilter(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+
+	db, err := Open(dbPath)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	tokenID, err := CreateToken(db, "filter-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	var ids []int64
+	for _, occurredAt := range []int64{1000, 2000, 3000} {
+		result, err := db.Exec("INSERT INTO interactions (token_id, kind, occurred_at, remote_ip, remote_port, summary) VALUES (?, 'dns', ?, '127.0.0.1', 0, '')", tokenID, occurredAt)
+		if err != nil {
+			t.Fatalf("insert interaction: %v", err)
+		}
+		id, _ := result.LastInsertId()
+		ids = append(ids, id)
+	}
+	if err := SaveAttributes(db, ids[0], map[string]any{"geo.country": "GB", "intel_tags": []string{"tor", "vpn"}}); err != nil {
+		t.Fatalf("save attributes: %v", err)
+	}
+	if err := SaveAttributes(db, ids[1], map[string]any{"geo.country": "US", "repeat_count": 3}); err != nil {
+		t.Fatalf("save attributes: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		filter InteractionFilter
+		want   []int64
+	}{
+		{"no filter", InteractionFilter{}, []int64{ids[2], ids[1], ids[0]}},
+		{"since id", InteractionFilter{SinceID: ids[0]}, []int64{ids[2], ids[1]}},
+		{"since timestamp", InteractionFilter{Since: 3000}, []int64{ids[2]}},
+		{"since id past end", InteractionFilter{SinceID: ids[2]}, nil},
+		{"ascending since id", InteractionFilter{SinceID: ids[0], Limit: 1, Ascending: true}, []int64{ids[1]}},
+		{"attribute", InteractionFilter{Attributes: map[string]string{"geo.country": "GB"}}, []int64{ids[0]}},
+		{"number attribute", InteractionFilter{Attributes: map[string]string{"repeat_count": "3"}}, []int64{ids[1]}},
+		{"list attribute", InteractionFilter{Attributes: map[string]string{"intel_tags": "vpn"}}, []int64{ids[0]}},
+		{"all attributes", InteractionFilter{Attributes: map[string]string{"geo.country": "US", "intel_tags": "tor"}}, nil},
+		{"attribute and since", InteractionFilter{SinceID: ids[0], Attributes: map[string]string{"geo.country": "US"}}, []int64{ids[1]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ListInteractions(db, tokenID, tt.filter)
+			if err != nil {
+				t.Fatalf("ListInteractions failed: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d interactions, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].ID != tt.want[i] {
+					t.Errorf("interaction %d: got ID %d, want %d", i, got[i].ID, tt.want[i])
+				}
+			}
+
+			details, err := ListInteractionDetails(db, tokenID, tt.filter)
+			if err != nil {
+				t.Fatalf("ListInteractionDetails failed: %v", err)
+			}
+			if len(details) != len(tt.want) {
+				t.Fatalf("got %d interaction details, want %d", len(details), len(tt.want))
+			}
+			for i := range details {
+				if details[i].ID != tt.want[i] {
+					t.Errorf("interaction details %d: got ID %d, want %d", i, details[i].ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestListInteractionDetails(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	tokenID, err := CreateToken(db, "details-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	httpID, err := CreateInteractionAt(db, 1000, tokenID, "http", "127.0.0.1", 1234, false, "GET /")
+	if err != nil {
+		t.Fatalf("create interaction: %v", err)
+	}
+	if err := CreateHTTPInteraction(db, httpID, "GET", "http", "example.com", "/", "a=1", "HTTP/1.1", `{"Accept":["*/*"]}`, []byte("body")); err != nil {
+		t.Fatalf("create http interaction: %v", err)
+	}
+	if err := SetHTTPResponse(db, httpID, 200, "{}", []byte("ok")); err != nil {
+		t.Fatalf("set http response: %v", err)
+	}
+	if err := SaveAttributes(db, httpID, map[string]any{"geo.country": "GB"}); err != nil {
+		t.Fatalf("save attributes: %v", err)
+	}
+	dnsID, err := CreateInteractionAt(db, 2000, tokenID, "dns", "127.0.0.1", 53, false, "A example.com")
+	if err != nil {
+		t.Fatalf("create interaction: %v", err)
+	}
+	if err := CreateDNSInteraction(db, dnsID, "example.com.", 1, 1, 1, 0, 42, "udp"); err != nil {
+		t.Fatalf("create dns interaction: %v", err)
+	}
+	smtpID, err := CreateInteractionAt(db, 3000, tokenID, "smtp", "127.0.0.1", 25, false, "MAIL FROM")
+	if err != nil {
+		t.Fatalf("create interaction: %v", err)
+	}
+
+	details, err := ListInteractionDetails(db, tokenID, InteractionFilter{})
+	if err != nil {
+		t.Fatalf("ListInteractionDetails failed: %v", err)
+	}
+	if len(details) != 3 || details[0].ID != smtpID || details[1].ID != dnsID || details[2].ID != httpID {
+		t.Fatalf("ListInteractionDetails = %+v, want the smtp, dns and http interactions", details)
+	}
+
+	if details[0].HTTP != nil || details[0].DNS != nil || len(details[0].Attributes) != 0 {
+		t.Errorf("smtp interaction has details %+v", details[0])
+	}
+
+	wantDNS, err := GetDNSInteraction(db, dnsID)
+	if err != nil {
+		t.Fatalf("GetDNSInteraction failed: %v", err)
+	}
+	if details[1].HTTP != nil || !reflect.DeepEqual(details[1].DNS, wantDNS) {
+		t.Errorf("dns interaction details = %+v, %+v; want %+v", details[1].HTTP, details[1].DNS, wantDNS)
+	}
+
+	wantHTTP, err := GetHTTPInteraction(db, httpID)
+	if err != nil {
+		t.Fatalf("GetHTTPInteraction failed: %v", err)
+	}
+	if details[2].DNS != nil || !reflect.DeepEqual(details[2].HTTP, wantHTTP) {
+		t.Errorf("http interaction details = %+v, %+v; want %+v", details[2].HTTP, details[2].DNS, wantHTTP)
+	}
+	if got := details[2].Attributes["geo.country"]; got != "GB" {
+		t.Errorf("http interaction geo.country = %v, want GB", got)
+	}
+}
+
+func TestSetHTTPResponseSnippet(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	tokenID, err := CreateToken(db, "response-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	id, err := CreateInteraction(db, tokenID, "http", "127.0.0.1", 1234, false, "GET /")
+	if err != nil {
+		t.Fatalf("create interaction: %v", err)
+	}
+	if err := CreateHTTPInteraction(db, id, "GET", "http", "example.com", "/", "", "HTTP/1.1", "{}", nil); err != nil {
+		t.Fatalf("create http interaction: %v", err)
+	}
+
+	body := bytes.Repeat([]byte("x"), ResponseSnippetSize+100)
+	if err := SetHTTPResponse(db, id, 200, "{}", body); err != nil {
+		t.Fatalf("SetHTTPResponse failed: %v", err)
+	}
+
+	h, err := GetHTTPInteraction(db, id)
+	if err != nil || h == nil {
+		t.Fatalf("GetHTTPInteraction = %v, %v", h, err)
+	}
+	if len(h.ResponseBody) != ResponseSnippetSize {
+		t.Errorf("kept %d bytes of the body, want %d", len(h.ResponseBody), ResponseSnippetSize)
+	}
+	sum := sha256.Sum256(body)
+	if h.ResponseBodySize == nil || *h.ResponseBodySize != len(body) {
+		t.Errorf("body size = %v, want %d", h.ResponseBodySize, len(body))
+	}
+	if h.ResponseBodySHA256 == nil || *h.ResponseBodySHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("body hash = %v, want %x", h.ResponseBodySHA256, sum)
+	}
+}
+
+func TestPurgeAllInteractions(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	for i, occurredAt := range []int64{1000, 1000, 3000} {
+		tokenID, err := CreateToken(db, fmt.Sprintf("token-%d", i), nil, nil, nil)
+		if err != nil {
+			t.Fatalf("create token: %v", err)
+		}
+		if _, err := db.Exec("INSERT INTO interactions (token_id, kind, occurred_at, remote_ip, remote_port, summary) VALUES (?, 'dns', ?, '127.0.0.1', 0, 'x')", tokenID, occurredAt); err != nil {
+			t.Fatalf("insert interaction: %v", err)
+		}
+	}
+
+	deleted, err := PurgeAllInteractions(db, 2000)
+	if err != nil {
+		t.Fatalf("PurgeAllInteractions failed: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("expected 2 deleted, got %d", deleted)
+	}
+	var remaining int
+	if err := db.QueryRow("SELECT COUNT(*) FROM interactions").Scan(&remaining); err != nil {
+		t.Fatalf("count interactions: %v", err)
+	}
+	if remaining != 1 {
+		t.Errorf("expected the newer interaction to remain, got %d", remaining)
+	}
+}
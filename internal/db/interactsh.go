@@ -0,0 +1,48 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// CreateInteractshSession records an interactsh client's registration.
+func CreateInteractshSession(d Execer, sess models.InteractshSession) error {
+	_, err := d.Exec(
+		"INSERT INTO interactsh_sessions (correlation_id, token_id, secret_hash, public_key, last_polled_id, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		sess.CorrelationID, sess.TokenID, sess.SecretHash, sess.PublicKey, sess.LastPolledID, time.Now().Unix(),
+	)
+	return err
+}
+
+// GetInteractshSession returns the session registered with correlationID,
+// or nil if there is none.
+func GetInteractshSession(d Querier, correlationID string) (*models.InteractshSession, error) {
+	var sess models.InteractshSession
+	err := d.QueryRow(
+		"SELECT correlation_id, token_id, secret_hash, public_key, last_polled_id, created_at FROM interactsh_sessions WHERE correlation_id = ?",
+		correlationID,
+	).Scan(&sess.CorrelationID, &sess.TokenID, &sess.SecretHash, &sess.PublicKey, &sess.LastPolledID, &sess.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// SetInteractshPolled records the newest interaction a session's poll
+// returned.
+func SetInteractshPolled(d Execer, correlationID string, lastPolledID int64) error {
+	_, err := d.Exec("UPDATE interactsh_sessions SET last_polled_id = ? WHERE correlation_id = ?", lastPolledID, correlationID)
+	return err
+}
+
+// DeleteInteractshSession removes a session, leaving its token.
+func DeleteInteractshSession(d Execer, correlationID string) error {
+	_, err := d.Exec("DELETE FROM interactsh_sessions WHERE correlation_id = ?", correlationID)
+	return err
+}
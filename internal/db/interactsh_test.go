@@ -0,0 +1,52 @@
+package db
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+func TestInteractshSessions(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = d.Close() }()
+	s := NewSQLite(d)
+
+	const cid = "cn1ljpdg6sh7fv3e1ha0"
+	tokenID, err := s.CreateToken(cid, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	err = s.CreateInteractshSession(models.InteractshSession{
+		CorrelationID: cid, TokenID: tokenID, SecretHash: []byte{1, 2}, PublicKey: []byte("-----BEGIN PUBLIC KEY-----"),
+	})
+	if err != nil {
+		t.Fatalf("CreateInteractshSession failed: %v", err)
+	}
+	if err := s.SetInteractshPolled(cid, 42); err != nil {
+		t.Fatalf("SetInteractshPolled failed: %v", err)
+	}
+
+	sess, err := s.GetInteractshSession(cid)
+	if err != nil || sess == nil {
+		t.Fatalf("GetInteractshSession = %v, %v", sess, err)
+	}
+	if sess.TokenID != tokenID || !bytes.Equal(sess.SecretHash, []byte{1, 2}) || sess.LastPolledID != 42 || sess.CreatedAt == 0 {
+		t.Errorf("session = %+v", sess)
+	}
+	if sess, err := s.GetInteractshSession("unknown"); sess != nil || err != nil {
+		t.Errorf("GetInteractshSession(unknown) = %v, %v, want nil", sess, err)
+	}
+
+	// Deleting the token ends its session.
+	if err := s.DeleteToken(cid); err != nil {
+		t.Fatalf("DeleteToken failed: %v", err)
+	}
+	if sess, err := s.GetInteractshSession(cid); sess != nil || err != nil {
+		t.Errorf("GetInteractshSession after deleting the token = %v, %v, want nil", sess, err)
+	}
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// MaintenanceResult describes what Maintain did.
+type MaintenanceResult struct {
+	// WALPages is how many pages the write-ahead log held, and Checkpointed
+	// how many of them were written back to the database. Busy is set when
+	// readers or writers kept the checkpoint from completing.
+	WALPages     int
+	Checkpointed int
+	Busy         bool
+
+	// FreedPages is how many free pages were returned to the file system.
+	FreedPages int
+}
+
+// Maintain checkpoints the write-ahead log and truncates it, refreshes the
+// query planner's statistics with PRAGMA optimize and, if the database uses
+// incremental auto-vacuum, returns its free pages to the file system.
+func Maintain(d *sql.DB) (MaintenanceResult, error) {
+	var res MaintenanceResult
+	var busy int
+	if err := d.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &res.WALPages, &res.Checkpointed); err != nil {
+		return res, fmt.Errorf("checkpoint: %w", err)
+	}
+	res.Busy = busy != 0
+
+	if _, err := d.Exec("PRAGMA optimize"); err != nil {
+		return res, fmt.Errorf("optimize: %w", err)
+	}
+
+	var autoVacuum int
+	if err := d.QueryRow("PRAGMA auto_vacuum").Scan(&autoVacuum); err != nil {
+		return res, fmt.Errorf("read auto_vacuum: %w", err)
+	}
+	if autoVacuum != autoVacuumIncremental {
+		return res, nil
+	}
+	before, err := freelistCount(d)
+	if err != nil {
+		return res, err
+	}
+	if err := incrementalVacuum(d); err != nil {
+		return res, fmt.Errorf("incremental vacuum: %w", err)
+	}
+	after, err := freelistCount(d)
+	if err != nil {
+		return res, err
+	}
+	res.FreedPages = before - after
+	return res, nil
+}
+
+// autoVacuumIncremental is the PRAGMA auto_vacuum value of databases that
+// free pages with PRAGMA incremental_vacuum.
+const autoVacuumIncremental = 2
+
+// incrementalVacuum frees every free page. The pragma frees one page per row
+// stepped, so its rows must be read to the end rather than executed.
+func incrementalVacuum(d *sql.DB) error {
+	rows, err := d.Query("PRAGMA incremental_vacuum")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+func freelistCount(d *sql.DB) (int, error) {
+	var n int
+	if err := d.QueryRow("PRAGMA freelist_count").Scan(&n); err != nil {
+		return 0, fmt.Errorf("read freelist_count: %w", err)
+	}
+	return n, nil
+}
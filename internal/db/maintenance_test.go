@@ -0,0 +1,42 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaintain(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	tokenID, err := CreateToken(db, "maintain-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	for i := 0; i < 200; i++ {
+		if _, err := CreateInteraction(db, tokenID, "dns", "127.0.0.1", 0, false, strings.Repeat("padding ", 128)); err != nil {
+			t.Fatalf("create interaction: %v", err)
+		}
+	}
+	if _, err := PurgeInteractions(db, tokenID, 1<<62); err != nil {
+		t.Fatalf("purge interactions: %v", err)
+	}
+
+	res, err := Maintain(db)
+	if err != nil {
+		t.Fatalf("Maintain failed: %v", err)
+	}
+	if res.Busy || res.Checkpointed != res.WALPages {
+		t.Errorf("checkpoint = %+v, want the whole WAL checkpointed", res)
+	}
+	if res.FreedPages == 0 {
+		t.Errorf("freed no pages after a purge: %+v", res)
+	}
+	if n, err := freelistCount(db); err != nil || n != 0 {
+		t.Errorf("freelist_count = %d, %v; want 0", n, err)
+	}
+}
@@ -0,0 +1,2 @@
+-- Restrict what an API key may do; existing keys keep full access
+ALTER TABLE api_keys ADD COLUMN scope TEXT NOT NULL DEFAULT 'full';
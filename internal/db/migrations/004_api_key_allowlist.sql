@@ -0,0 +1,2 @@
+-- Optional JSON array of CIDR ranges an API key may be used from
+ALTER TABLE api_keys ADD COLUMN allowed_cidrs TEXT;
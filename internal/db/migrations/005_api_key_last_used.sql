@@ -0,0 +1,3 @@
+-- Track when and from where each API key was last used
+ALTER TABLE api_keys ADD COLUMN last_used_at INTEGER;
+ALTER TABLE api_keys ADD COLUMN last_used_ip TEXT;
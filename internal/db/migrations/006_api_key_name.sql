@@ -0,0 +1,2 @@
+-- Human-readable name to tell API keys apart
+ALTER TABLE api_keys ADD COLUMN name TEXT;
@@ -0,0 +1,2 @@
+-- Existing hashes are unpeppered SHA-256 (version 1); new keys use HMAC-SHA256 (version 2)
+ALTER TABLE api_keys ADD COLUMN hash_version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,4 @@
+-- Client certificate subject that authenticates as an API key under mutual TLS
+ALTER TABLE api_keys ADD COLUMN client_cert_subject TEXT;
+
+CREATE UNIQUE INDEX idx_api_keys_client_cert_subject ON api_keys(client_cert_subject);
@@ -0,0 +1,7 @@
+-- Record the response sent for each interaction
+ALTER TABLE http_interactions ADD COLUMN response_status INTEGER;
+ALTER TABLE http_interactions ADD COLUMN response_headers TEXT;
+ALTER TABLE http_interactions ADD COLUMN response_body BLOB;
+
+ALTER TABLE dns_interactions ADD COLUMN response_rcode INTEGER;
+ALTER TABLE dns_interactions ADD COLUMN response_answers TEXT;
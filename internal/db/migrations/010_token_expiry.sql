@@ -0,0 +1,4 @@
+-- Optional token expiry as a Unix timestamp; NULL never expires
+ALTER TABLE tokens ADD COLUMN expires_at INTEGER;
+
+CREATE INDEX idx_tokens_expires_at ON tokens(expires_at) WHERE expires_at IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Disabled tokens keep their history but new interactions are dropped or marked
+ALTER TABLE tokens ADD COLUMN enabled INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,9 @@
+-- Free-form tags for organizing tokens
+CREATE TABLE token_tags (
+    token_id INTEGER NOT NULL,
+    tag      TEXT NOT NULL,
+    PRIMARY KEY (token_id, tag),
+    FOREIGN KEY (token_id) REFERENCES tokens(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_token_tags_tag ON token_tags(tag);
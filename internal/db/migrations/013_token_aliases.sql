@@ -0,0 +1,9 @@
+-- Additional subdomain names that resolve to a token
+CREATE TABLE token_aliases (
+    alias      TEXT PRIMARY KEY,
+    token_id   INTEGER NOT NULL,
+    created_at INTEGER NOT NULL,
+    FOREIGN KEY (token_id) REFERENCES tokens(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_token_aliases_token_id ON token_aliases(token_id);
@@ -0,0 +1,10 @@
+-- Files served under a token's host by the files plugin
+CREATE TABLE token_files (
+    token_id     INTEGER NOT NULL,
+    path         TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    content      BLOB NOT NULL,
+    created_at   INTEGER NOT NULL,
+    PRIMARY KEY (token_id, path),
+    FOREIGN KEY (token_id) REFERENCES tokens(id) ON DELETE CASCADE
+);
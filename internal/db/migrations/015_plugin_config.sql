@@ -0,0 +1,6 @@
+-- Server-wide plugin configuration, keyed by plugin ID
+CREATE TABLE plugin_config (
+    plugin_id  TEXT PRIMARY KEY,
+    config     TEXT NOT NULL,
+    updated_at INTEGER NOT NULL
+);
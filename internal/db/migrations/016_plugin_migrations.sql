@@ -0,0 +1,7 @@
+-- Migrations applied from plugins' own migration files, versioned per plugin
+CREATE TABLE plugin_migrations (
+    plugin_id  TEXT NOT NULL,
+    version    INTEGER NOT NULL,
+    applied_at INTEGER NOT NULL,
+    PRIMARY KEY (plugin_id, version)
+);
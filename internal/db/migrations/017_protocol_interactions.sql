@@ -0,0 +1,7 @@
+-- Details of interactions over protocols without a dedicated table
+CREATE TABLE protocol_interactions (
+    interaction_id INTEGER PRIMARY KEY,
+    raw            BLOB,
+    fields         TEXT,
+    FOREIGN KEY (interaction_id) REFERENCES interactions(id) ON DELETE CASCADE
+);
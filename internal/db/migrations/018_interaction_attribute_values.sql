@@ -0,0 +1,4 @@
+-- Index attribute values so interactions can be filtered by them; the
+-- (key, value) index also serves lookups by key alone
+DROP INDEX idx_interaction_attributes_key;
+CREATE INDEX idx_interaction_attributes_key_value ON interaction_attributes(key, value);
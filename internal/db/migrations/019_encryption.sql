@@ -0,0 +1,11 @@
+-- Encryption at rest: the data key sealing request bodies and attribute
+-- values, wrapped by the operator's key, and flags recording how each value
+-- was stored
+CREATE TABLE encryption_keys (
+    id         INTEGER PRIMARY KEY,
+    wrapped    BLOB NOT NULL,
+    created_at INTEGER NOT NULL
+);
+ALTER TABLE http_interactions ADD COLUMN request_body_flags INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE protocol_interactions ADD COLUMN raw_flags INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE interaction_attributes ADD COLUMN flags INTEGER NOT NULL DEFAULT 0;
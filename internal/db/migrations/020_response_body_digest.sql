@@ -0,0 +1,3 @@
+-- Describe the whole response body sent, as only a snippet of it is kept
+ALTER TABLE http_interactions ADD COLUMN response_body_size INTEGER;
+ALTER TABLE http_interactions ADD COLUMN response_body_sha256 TEXT;
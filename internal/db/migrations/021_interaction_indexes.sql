@@ -0,0 +1,6 @@
+-- Cover the listing order, which breaks ties on id, and index the columns
+-- interactions are looked up by kind and DNS query name
+DROP INDEX idx_interactions_token_time;
+CREATE INDEX idx_interactions_token_time ON interactions(token_id, occurred_at DESC, id DESC);
+CREATE INDEX idx_interactions_kind ON interactions(kind);
+CREATE INDEX idx_dns_interactions_qname ON dns_interactions(qname);
@@ -0,0 +1,18 @@
+-- Traffic to the domain that carried no token, or one that does not exist,
+-- recorded in honeypot mode. token is NULL when there was none; details is a
+-- JSON object of the request's protocol fields, and body holds at most the
+-- first bytes of its body or raw capture
+CREATE TABLE stray_interactions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  kind TEXT NOT NULL,
+  occurred_at INTEGER NOT NULL,
+  remote_ip TEXT NOT NULL,
+  remote_port INTEGER NOT NULL,
+  tls INTEGER NOT NULL DEFAULT 0,
+  token TEXT,
+  summary TEXT NOT NULL,
+  details TEXT NOT NULL,
+  body BLOB
+);
+
+CREATE INDEX idx_stray_interactions_occurred_at ON stray_interactions(occurred_at);
@@ -0,0 +1,17 @@
+-- Interactions queued for delivery to a webhook endpoint, kept until the
+-- endpoint accepts them or the attempts run out. endpoint is the endpoint's
+-- name in the webhook plugin's configuration, and payload the JSON posted,
+-- sealed as flags records
+CREATE TABLE webhook_deliveries (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  endpoint TEXT NOT NULL,
+  interaction_id INTEGER NOT NULL,
+  payload BLOB NOT NULL,
+  flags INTEGER NOT NULL DEFAULT 0,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at INTEGER NOT NULL,
+  last_error TEXT,
+  created_at INTEGER NOT NULL
+);
+
+CREATE INDEX idx_webhook_deliveries_next_attempt_at ON webhook_deliveries(next_attempt_at);
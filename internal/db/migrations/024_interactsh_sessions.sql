@@ -0,0 +1,16 @@
+-- Sessions of interactsh clients, each mapped onto the token created when it
+-- registered. correlation_id is the token's value, secret_hash the SHA-256 of
+-- the client's secret key, and public_key the PEM RSA key poll responses
+-- are encrypted to. last_polled_id is the newest interaction returned by a
+-- poll, so each is returned once.
+CREATE TABLE interactsh_sessions (
+  correlation_id TEXT PRIMARY KEY,
+  token_id INTEGER NOT NULL,
+  secret_hash BLOB NOT NULL,
+  public_key BLOB NOT NULL,
+  last_polled_id INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL,
+  FOREIGN KEY(token_id) REFERENCES tokens(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_interactsh_sessions_token_id ON interactsh_sessions(token_id);
@@ -0,0 +1,11 @@
+-- Burp Collaborator polling sessions, one per token. biid_hash is the SHA-256
+-- of the biid of the Burp project that first polled the token, which is the
+-- only one that may poll it after, and last_polled_id the newest interaction
+-- a poll returned, so each is returned once.
+CREATE TABLE collaborator_sessions (
+  token_id INTEGER PRIMARY KEY,
+  biid_hash BLOB NOT NULL,
+  last_polled_id INTEGER NOT NULL DEFAULT 0,
+  created_at INTEGER NOT NULL,
+  FOREIGN KEY(token_id) REFERENCES tokens(id) ON DELETE CASCADE
+);
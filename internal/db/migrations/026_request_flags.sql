@@ -0,0 +1,3 @@
+-- Flags recording how request headers and query strings were stored, which
+-- are encrypted like bodies as they often carry credentials
+ALTER TABLE http_interactions ADD COLUMN request_flags INTEGER NOT NULL DEFAULT 0;
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 )
 
 // SetTokenPluginConfig stores plugin configuration for a specific token.
@@ -63,3 +64,52 @@ func DeleteTokenPluginConfig(d *sql.DB, tokenID int64, pluginID string) error {
 
 	return nil
 }
+
+// SetPluginConfig stores server-wide configuration for a plugin.
+// The config value is JSON-encoded before storage.
+func SetPluginConfig(d *sql.DB, pluginID string, config any) error {
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("encode config: %w", err)
+	}
+
+	_, err = d.Exec(`
+		INSERT INTO plugin_config (plugin_id, config, updated_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (plugin_id) DO UPDATE SET config = excluded.config, updated_at = excluded.updated_at
+	`, pluginID, string(encoded), time.Now().Unix())
+	if err != nil {
+		return fmt.Errorf("upsert plugin config: %w", err)
+	}
+
+	return nil
+}
+
+// GetPluginConfig retrieves server-wide configuration for a plugin.
+// Returns (true, nil) if found and successfully decoded into out.
+// Returns (false, nil) if no configuration exists.
+func GetPluginConfig(d *sql.DB, pluginID string, out any) (bool, error) {
+	var config string
+	err := d.QueryRow("SELECT config FROM plugin_config WHERE plugin_id = ?", pluginID).Scan(&config)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("query plugin config: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(config), out); err != nil {
+		return false, fmt.Errorf("decode config: %w", err)
+	}
+
+	return true, nil
+}
+
+// DeletePluginConfig removes server-wide configuration for a plugin.
+func DeletePluginConfig(d *sql.DB, pluginID string) error {
+	if _, err := d.Exec("DELETE FROM plugin_config WHERE plugin_id = ?", pluginID); err != nil {
+		return fmt.Errorf("delete plugin config: %w", err)
+	}
+	return nil
+}
@@ -255,3 +255,43 @@ func TestMultiplePluginConfigs(t *testing.T) {
 		t.Errorf("plugin2 config mismatch: found=%v, out=%v", found2, out2)
 	}
 }
+
+func TestGlobalPluginConfig(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	type config struct {
+		Encodings []string `json:"encodings"`
+	}
+
+	var out config
+	found, err := GetPluginConfig(db, "dnsexfil", &out)
+	if err != nil || found {
+		t.Fatalf("GetPluginConfig before set = %v, %v", found, err)
+	}
+
+	if err := SetPluginConfig(db, "dnsexfil", config{Encodings: []string{"hex"}}); err != nil {
+		t.Fatalf("SetPluginConfig failed: %v", err)
+	}
+	if err := SetPluginConfig(db, "dnsexfil", config{Encodings: []string{"base32", "hex"}}); err != nil {
+		t.Fatalf("SetPluginConfig upsert failed: %v", err)
+	}
+
+	found, err = GetPluginConfig(db, "dnsexfil", &out)
+	if err != nil || !found {
+		t.Fatalf("GetPluginConfig = %v, %v", found, err)
+	}
+	if len(out.Encodings) != 2 || out.Encodings[0] != "base32" {
+		t.Errorf("config = %+v", out)
+	}
+
+	if err := DeletePluginConfig(db, "dnsexfil"); err != nil {
+		t.Fatalf("DeletePluginConfig failed: %v", err)
+	}
+	if found, err := GetPluginConfig(db, "dnsexfil", &out); err != nil || found {
+		t.Errorf("GetPluginConfig after delete = %v, %v", found, err)
+	}
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// Querier is satisfied by both *sql.DB and *sql.Tx, so read helpers can run
+// on either, or through a statement cache.
+type Querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// stmtCache prepares each query it is given once and reuses the statement
+// for later calls, so the hot paths recording and reading interactions do
+// not parse the same SQL for every interaction. Statements are kept for the
+// life of the database and released when it is closed.
+type stmtCache struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func newStmtCache(d *sql.DB) *stmtCache {
+	return &stmtCache{db: d, stmts: make(map[string]*sql.Stmt)}
+}
+
+// prepare returns the cached statement for query, preparing it on first use.
+func (c *stmtCache) prepare(query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := c.db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// cachedDB is an Execer and Querier running its queries through the cache,
+// within tx if it is set.
+type cachedDB struct {
+	cache *stmtCache
+	tx    *sql.Tx
+}
+
+var (
+	_ Execer  = cachedDB{}
+	_ Querier = cachedDB{}
+)
+
+// stmt returns the cached statement for query, bound to the transaction if
+// there is one. A statement bound with Tx.Stmt is closed with the
+// transaction, and reuses the cached one's preparation on its connection.
+func (c cachedDB) stmt(query string) (*sql.Stmt, error) {
+	stmt, err := c.cache.prepare(query)
+	if err != nil || c.tx == nil {
+		return stmt, err
+	}
+	return c.tx.Stmt(stmt), nil
+}
+
+func (c cachedDB) Exec(query string, args ...any) (sql.Result, error) {
+	stmt, err := c.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
+func (c cachedDB) Query(query string, args ...any) (*sql.Rows, error) {
+	stmt, err := c.stmt(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Query(args...)
+}
+
+func (c cachedDB) QueryRow(query string, args ...any) *sql.Row {
+	stmt, err := c.stmt(query)
+	if err != nil {
+		// A Row cannot carry an error of our own, so let an unprepared
+		// query report it.
+		if c.tx != nil {
+			return c.tx.QueryRow(query, args...)
+		}
+		return c.cache.db.QueryRow(query, args...)
+	}
+	return stmt.QueryRow(args...)
+}
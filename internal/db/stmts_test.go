@@ -0,0 +1,73 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteReusesPreparedStatements(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = d.Close() }()
+
+	s := NewSQLite(d)
+	s.Batcher = NewBatcher(d, time.Millisecond, 0)
+	defer s.Batcher.Close()
+
+	tokenID, err := s.CreateToken("stmt-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	record := func(n int, w Writer) error {
+		id, err := w.CreateInteraction(tokenID, "dns", "192.0.2.1", 53, false, fmt.Sprintf("q%d", n))
+		if err != nil {
+			return err
+		}
+		if err := w.CreateDNSInteraction(id, fmt.Sprintf("q%d.example.com", n), 1, 1, 0, 0, n, "udp"); err != nil {
+			return err
+		}
+		return w.SaveAttributes(id, map[string]any{"n": n})
+	}
+	for n := range 3 {
+		// Alternate between direct writes and batched ones, which bind the
+		// cached statements to the batch's transaction.
+		if n%2 == 0 {
+			err = record(n, s)
+		} else {
+			err = s.Write(context.Background(), func(w Writer) error { return record(n, w) })
+		}
+		if err != nil {
+			t.Fatalf("record interaction %d: %v", n, err)
+		}
+	}
+	prepared := len(s.stmtCache().stmts)
+
+	interactions, err := s.ListInteractions(tokenID, InteractionFilter{})
+	if err != nil || len(interactions) != 3 {
+		t.Fatalf("ListInteractions = %d interactions, %v; want 3", len(interactions), err)
+	}
+	for _, i := range interactions {
+		if err := record(int(i.ID)+10, s); err != nil {
+			t.Fatalf("record interaction: %v", err)
+		}
+		dns, err := s.GetDNSInteraction(i.ID)
+		if err != nil || dns == nil {
+			t.Fatalf("GetDNSInteraction(%d) = %v, %v", i.ID, dns, err)
+		}
+		attrs, err := s.GetAttributes(i.ID)
+		if err != nil || attrs["n"] == nil {
+			t.Fatalf("GetAttributes(%d) = %v, %v", i.ID, attrs, err)
+		}
+	}
+
+	// Reads add their own statements, but further writes add none.
+	if got := len(s.stmtCache().stmts); got != prepared+2 {
+		t.Errorf("cache holds %d statements, want %d", got, prepared+2)
+	}
+}
@@ -0,0 +1,556 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// Store is the repository the servers and plugins persist through, so the
+// backend behind it can be swapped without touching them. SQLite is the
+// implementation oastrix ships.
+type Store interface {
+	TokenStore
+	APIKeyStore
+	InteractionStore
+	FileStore
+	ConfigStore
+	StrayStore
+	WebhookStore
+	InteractshStore
+	CollaboratorStore
+
+	// Write runs fn with a Writer whose writes are applied together, so an
+	// interaction and its protocol details are stored as one. The writes are
+	// abandoned if ctx is done before they are made.
+	Write(ctx context.Context, fn func(Writer) error) error
+}
+
+// TokenStore manages tokens and their aliases, tags and expiry.
+type TokenStore interface {
+	CreateToken(token string, apiKeyID *int64, label *string, expiresAt *int64) (int64, error)
+	GetTokenByValue(token string) (*models.Token, error)
+	ResolveToken(value string) (*models.Token, error)
+	TokenValueInUse(value string) (bool, error)
+	ListTokensByAPIKey(apiKeyID int64, f TokenFilter) ([]TokenWithCount, error)
+	GetTokenWithCount(tokenID int64) (*TokenWithCount, error)
+	SetTokenLabel(id int64, label *string) error
+	SetTokenExpiry(id int64, expiresAt *int64) error
+	GetTokenTags(id int64) ([]string, error)
+	SetTokenTags(id int64, tags []string) error
+	SetTokenAliases(id int64, aliases []string) error
+	SetTokenEnabled(id int64, enabled bool) error
+	DeleteToken(token string) error
+	PurgeExpiredTokens(before int64) (int64, error)
+}
+
+// APIKeyStore manages API keys.
+type APIKeyStore interface {
+	CreateAPIKey(prefix string, hash []byte, scope string, name *string) (int64, error)
+	GetAPIKeyByPrefix(prefix string) (*models.APIKey, error)
+	GetAPIKeyByClientCert(subject string) (*models.APIKey, error)
+	ListAPIKeys() ([]models.APIKey, error)
+	CountAPIKeys() (int, error)
+	SetAPIKeyAllowlist(id int64, cidrs []string) error
+	SetAPIKeyClientCert(id int64, subject *string) error
+	UpgradeAPIKeyHash(id int64, hash []byte) error
+	TouchAPIKey(id int64, usedAt int64, ip string) error
+	RevokeAPIKey(id int64) (bool, error)
+}
+
+// Writer holds the interaction writes that can be grouped with Store.Write.
+type Writer interface {
+	CreateInteraction(tokenID int64, kind string, remoteIP string, remotePort int, tls bool, summary string) (int64, error)
+	CreateInteractionAt(occurredAt int64, tokenID int64, kind string, remoteIP string, remotePort int, tls bool, summary string) (int64, error)
+	CreateHTTPInteraction(interactionID int64, method, scheme, host, path, query, httpVersion string, headers string, body []byte) error
+	CreateDNSInteraction(interactionID int64, qname string, qtype, qclass, rd, opcode, dnsID int, protocol string) error
+	CreateProtocolInteraction(interactionID int64, raw []byte, fields string) error
+	SetHTTPResponse(interactionID int64, status int, headers string, body []byte) error
+	SetDNSResponse(interactionID int64, rcode int, answers string) error
+	SaveAttributes(interactionID int64, attrs map[string]any) error
+}
+
+// InteractionStore records and queries interactions and their attributes.
+type InteractionStore interface {
+	Writer
+	ListInteractions(tokenID int64, f InteractionFilter) ([]models.Interaction, error)
+	ListInteractionDetails(tokenID int64, f InteractionFilter) ([]models.InteractionDetails, error)
+	GetInteraction(id int64) (*models.Interaction, error)
+	GetHTTPInteraction(interactionID int64) (*models.HTTPInteraction, error)
+	GetDNSInteraction(interactionID int64) (*models.DNSInteraction, error)
+	GetProtocolInteraction(interactionID int64) (*models.ProtocolInteraction, error)
+	CountInteractions(tokenID int64, since int64) (int, error)
+	LatestInteractionID(tokenID int64) (int64, error)
+	TrimInteractions(tokenID int64, keep int) (int64, error)
+	PurgeInteractions(tokenID int64, before int64) (int64, error)
+	PurgeInteractionsByAPIKey(apiKeyID int64, before int64) (int64, error)
+	PurgeAllInteractions(before int64) (int64, error)
+	GetAttributes(interactionID int64) (map[string]any, error)
+	IncrementAttribute(interactionID int64, key string) error
+}
+
+// StrayStore records and queries the traffic kept in honeypot mode that
+// matched no token.
+type StrayStore interface {
+	CreateStrayInteraction(s models.StrayInteraction) (int64, error)
+	ListStrayInteractions(f StrayFilter) ([]models.StrayInteraction, error)
+	PurgeStrayInteractions(before int64) (int64, error)
+}
+
+// WebhookStore queues interactions for delivery to webhook endpoints.
+type WebhookStore interface {
+	EnqueueWebhookDelivery(w models.WebhookDelivery) (int64, error)
+	DueWebhookDeliveries(now int64, limit int) ([]models.WebhookDelivery, error)
+	RetryWebhookDelivery(id int64, nextAttemptAt int64, lastError string) error
+	DeleteWebhookDelivery(id int64) error
+}
+
+// InteractshStore manages the sessions of interactsh clients.
+type InteractshStore interface {
+	CreateInteractshSession(sess models.InteractshSession) error
+	GetInteractshSession(correlationID string) (*models.InteractshSession, error)
+	SetInteractshPolled(correlationID string, lastPolledID int64) error
+	DeleteInteractshSession(correlationID string) error
+}
+
+// CollaboratorStore manages the Burp Collaborator polling sessions of tokens.
+type CollaboratorStore interface {
+	CreateCollaboratorSession(tokenID int64, biidHash []byte) error
+	GetCollaboratorSession(tokenID int64) (*models.CollaboratorSession, error)
+	SetCollaboratorPolled(tokenID, lastPolledID int64) error
+	DeleteCollaboratorSession(tokenID int64) (bool, error)
+}
+
+// FileStore manages the files tokens serve.
+type FileStore interface {
+	PutTokenFile(tokenID int64, path, contentType string, content []byte) error
+	GetTokenFile(tokenID int64, path string) (*models.TokenFile, error)
+	ListTokenFiles(tokenID int64) ([]models.TokenFile, error)
+	DeleteTokenFile(tokenID int64, path string) (bool, error)
+}
+
+// ConfigStore manages server-wide and per-token plugin configuration.
+type ConfigStore interface {
+	SetPluginConfig(pluginID string, config any) error
+	GetPluginConfig(pluginID string, out any) (bool, error)
+	DeletePluginConfig(pluginID string) error
+	SetTokenPluginConfig(tokenID int64, pluginID string, config any) error
+	GetTokenPluginConfig(tokenID int64, pluginID string, out any) (bool, error)
+	DeleteTokenPluginConfig(tokenID int64, pluginID string) error
+}
+
+// SQLite is the Store backed by an SQLite database opened with Open.
+type SQLite struct {
+	DB *sql.DB
+
+	// Batcher, if set, coalesces the writes made through Write into shared
+	// transactions.
+	Batcher *Batcher
+
+	// Cipher, if set, encrypts the request bodies, raw protocol captures and
+	// attribute values stored from then on. Values are decrypted on read
+	// however they were stored.
+	Cipher *Cipher
+
+	// CompressAbove is the size in bytes beyond which request bodies and raw
+	// protocol captures are stored gzipped; zero disables compression.
+	CompressAbove int
+
+	// Blobs, if set, holds the request bodies and raw protocol captures
+	// still larger than SpillAbove bytes once compressed, leaving only their
+	// hash in the database.
+	Blobs      BlobStore
+	SpillAbove int
+
+	stmtsOnce sync.Once
+	stmts     *stmtCache
+}
+
+var _ Store = (*SQLite)(nil)
+
+// NewSQLite creates a Store backed by d, compressing bodies larger than
+// DefaultCompressAbove.
+func NewSQLite(d *sql.DB) *SQLite {
+	return &SQLite{DB: d, CompressAbove: DefaultCompressAbove}
+}
+
+// Write runs fn in a transaction of its own, or in the next batch's if a
+// Batcher is set. Nothing fn wrote is kept if it returns an error. When ctx
+// is done, fn's transaction is rolled back and its later statements fail,
+// unless it is a batch's that fn has already started writing to.
+func (s *SQLite) Write(ctx context.Context, fn func(Writer) error) error {
+	write := func(tx *sql.Tx) error { return fn(sqliteTx{cachedDB{s.stmtCache(), tx}, s.codec()}) }
+	if s.Batcher != nil {
+		return s.Batcher.Do(ctx, write)
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := write(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// stmtCache returns the cache of the statements prepared on s.DB.
+func (s *SQLite) stmtCache() *stmtCache {
+	s.stmtsOnce.Do(func() { s.stmts = newStmtCache(s.DB) })
+	return s.stmts
+}
+
+// prepared returns s.DB running its queries through the statement cache,
+// for the paths taken for every interaction.
+func (s *SQLite) prepared() cachedDB {
+	return cachedDB{cache: s.stmtCache()}
+}
+
+func (s *SQLite) codec() codec {
+	return codec{cipher: s.Cipher, compressAbove: s.CompressAbove, blobs: s.Blobs, spillAbove: s.SpillAbove}
+}
+
+// CollectBlobs deletes the blobs stored before the time that no interaction
+// references any longer.
+func (s *SQLite) CollectBlobs(before time.Time) (int, error) {
+	if s.Blobs == nil {
+		return 0, nil
+	}
+	return CollectBlobs(s.DB, s.Blobs, before)
+}
+
+// The remaining SQLite methods call the package function of the same name on
+// s.DB, or its unexported form taking the codec for interaction bodies and
+// attributes. Those recording and reading single interactions run through
+// the statement cache instead.
+
+func (s *SQLite) CreateToken(token string, apiKeyID *int64, label *string, expiresAt *int64) (int64, error) {
+	return CreateToken(s.DB, token, apiKeyID, label, expiresAt)
+}
+
+func (s *SQLite) GetTokenByValue(token string) (*models.Token, error) {
+	return GetTokenByValue(s.DB, token)
+}
+
+func (s *SQLite) ResolveToken(value string) (*models.Token, error) {
+	return ResolveToken(s.DB, value)
+}
+
+func (s *SQLite) TokenValueInUse(value string) (bool, error) {
+	return TokenValueInUse(s.DB, value)
+}
+
+func (s *SQLite) ListTokensByAPIKey(apiKeyID int64, f TokenFilter) ([]TokenWithCount, error) {
+	return ListTokensByAPIKey(s.DB, apiKeyID, f)
+}
+
+func (s *SQLite) GetTokenWithCount(tokenID int64) (*TokenWithCount, error) {
+	return GetTokenWithCount(s.DB, tokenID)
+}
+
+func (s *SQLite) SetTokenLabel(id int64, label *string) error {
+	return SetTokenLabel(s.DB, id, label)
+}
+
+func (s *SQLite) SetTokenExpiry(id int64, expiresAt *int64) error {
+	return SetTokenExpiry(s.DB, id, expiresAt)
+}
+
+func (s *SQLite) GetTokenTags(id int64) ([]string, error) {
+	return GetTokenTags(s.DB, id)
+}
+
+func (s *SQLite) SetTokenTags(id int64, tags []string) error {
+	return SetTokenTags(s.DB, id, tags)
+}
+
+func (s *SQLite) SetTokenAliases(id int64, aliases []string) error {
+	return SetTokenAliases(s.DB, id, aliases)
+}
+
+func (s *SQLite) SetTokenEnabled(id int64, enabled bool) error {
+	return SetTokenEnabled(s.DB, id, enabled)
+}
+
+func (s *SQLite) DeleteToken(token string) error {
+	return DeleteToken(s.DB, token)
+}
+
+func (s *SQLite) PurgeExpiredTokens(before int64) (int64, error) {
+	return PurgeExpiredTokens(s.DB, before)
+}
+
+func (s *SQLite) CreateAPIKey(prefix string, hash []byte, scope string, name *string) (int64, error) {
+	return CreateAPIKey(s.DB, prefix, hash, scope, name)
+}
+
+func (s *SQLite) GetAPIKeyByPrefix(prefix string) (*models.APIKey, error) {
+	return GetAPIKeyByPrefix(s.DB, prefix)
+}
+
+func (s *SQLite) GetAPIKeyByClientCert(subject string) (*models.APIKey, error) {
+	return GetAPIKeyByClientCert(s.DB, subject)
+}
+
+func (s *SQLite) ListAPIKeys() ([]models.APIKey, error) {
+	return ListAPIKeys(s.DB)
+}
+
+func (s *SQLite) CountAPIKeys() (int, error) {
+	return CountAPIKeys(s.DB)
+}
+
+func (s *SQLite) SetAPIKeyAllowlist(id int64, cidrs []string) error {
+	return SetAPIKeyAllowlist(s.DB, id, cidrs)
+}
+
+func (s *SQLite) SetAPIKeyClientCert(id int64, subject *string) error {
+	return SetAPIKeyClientCert(s.DB, id, subject)
+}
+
+func (s *SQLite) UpgradeAPIKeyHash(id int64, hash []byte) error {
+	return UpgradeAPIKeyHash(s.DB, id, hash)
+}
+
+func (s *SQLite) TouchAPIKey(id int64, usedAt int64, ip string) error {
+	return TouchAPIKey(s.DB, id, usedAt, ip)
+}
+
+func (s *SQLite) RevokeAPIKey(id int64) (bool, error) {
+	return RevokeAPIKey(s.DB, id)
+}
+
+func (s *SQLite) CreateInteraction(tokenID int64, kind string, remoteIP string, remotePort int, tls bool, summary string) (int64, error) {
+	return CreateInteraction(s.prepared(), tokenID, kind, remoteIP, remotePort, tls, summary)
+}
+
+func (s *SQLite) CreateInteractionAt(occurredAt int64, tokenID int64, kind string, remoteIP string, remotePort int, tls bool, summary string) (int64, error) {
+	return CreateInteractionAt(s.prepared(), occurredAt, tokenID, kind, remoteIP, remotePort, tls, summary)
+}
+
+func (s *SQLite) CreateHTTPInteraction(interactionID int64, method, scheme, host, path, query, httpVersion string, headers string, body []byte) error {
+	return createHTTPInteraction(s.prepared(), s.codec(), interactionID, method, scheme, host, path, query, httpVersion, headers, body)
+}
+
+func (s *SQLite) CreateDNSInteraction(interactionID int64, qname string, qtype, qclass, rd, opcode, dnsID int, protocol string) error {
+	return CreateDNSInteraction(s.prepared(), interactionID, qname, qtype, qclass, rd, opcode, dnsID, protocol)
+}
+
+func (s *SQLite) CreateProtocolInteraction(interactionID int64, raw []byte, fields string) error {
+	return createProtocolInteraction(s.prepared(), s.codec(), interactionID, raw, fields)
+}
+
+func (s *SQLite) SetHTTPResponse(interactionID int64, status int, headers string, body []byte) error {
+	return SetHTTPResponse(s.prepared(), interactionID, status, headers, body)
+}
+
+func (s *SQLite) SetDNSResponse(interactionID int64, rcode int, answers string) error {
+	return SetDNSResponse(s.prepared(), interactionID, rcode, answers)
+}
+
+func (s *SQLite) SaveAttributes(interactionID int64, attrs map[string]any) error {
+	return saveAttributes(s.DB, s.stmtCache(), s.codec(), interactionID, attrs)
+}
+
+func (s *SQLite) ListInteractions(tokenID int64, f InteractionFilter) ([]models.Interaction, error) {
+	return listInteractions(s.DB, s.codec(), tokenID, f)
+}
+
+func (s *SQLite) ListInteractionDetails(tokenID int64, f InteractionFilter) ([]models.InteractionDetails, error) {
+	return listInteractionDetails(s.DB, s.codec(), tokenID, f)
+}
+
+func (s *SQLite) GetInteraction(id int64) (*models.Interaction, error) {
+	return GetInteraction(s.prepared(), id)
+}
+
+func (s *SQLite) GetHTTPInteraction(interactionID int64) (*models.HTTPInteraction, error) {
+	return getHTTPInteraction(s.prepared(), s.codec(), interactionID)
+}
+
+func (s *SQLite) GetDNSInteraction(interactionID int64) (*models.DNSInteraction, error) {
+	return GetDNSInteraction(s.prepared(), interactionID)
+}
+
+func (s *SQLite) GetProtocolInteraction(interactionID int64) (*models.ProtocolInteraction, error) {
+	return getProtocolInteraction(s.prepared(), s.codec(), interactionID)
+}
+
+func (s *SQLite) CountInteractions(tokenID int64, since int64) (int, error) {
+	return CountInteractions(s.DB, tokenID, since)
+}
+
+func (s *SQLite) LatestInteractionID(tokenID int64) (int64, error) {
+	return LatestInteractionID(s.DB, tokenID)
+}
+
+func (s *SQLite) TrimInteractions(tokenID int64, keep int) (int64, error) {
+	return TrimInteractions(s.DB, tokenID, keep)
+}
+
+func (s *SQLite) PurgeInteractions(tokenID int64, before int64) (int64, error) {
+	return PurgeInteractions(s.DB, tokenID, before)
+}
+
+func (s *SQLite) PurgeInteractionsByAPIKey(apiKeyID int64, before int64) (int64, error) {
+	return PurgeInteractionsByAPIKey(s.DB, apiKeyID, before)
+}
+
+func (s *SQLite) PurgeAllInteractions(before int64) (int64, error) {
+	return PurgeAllInteractions(s.DB, before)
+}
+
+func (s *SQLite) GetAttributes(interactionID int64) (map[string]any, error) {
+	return getAttributes(s.prepared(), s.codec(), interactionID)
+}
+
+func (s *SQLite) IncrementAttribute(interactionID int64, key string) error {
+	return IncrementAttribute(s.prepared(), interactionID, key)
+}
+
+func (s *SQLite) CreateStrayInteraction(stray models.StrayInteraction) (int64, error) {
+	return CreateStrayInteraction(s.DB, stray)
+}
+
+func (s *SQLite) ListStrayInteractions(f StrayFilter) ([]models.StrayInteraction, error) {
+	return ListStrayInteractions(s.DB, f)
+}
+
+func (s *SQLite) PurgeStrayInteractions(before int64) (int64, error) {
+	return PurgeStrayInteractions(s.DB, before)
+}
+
+func (s *SQLite) EnqueueWebhookDelivery(w models.WebhookDelivery) (int64, error) {
+	return enqueueWebhookDelivery(s.DB, s.codec(), w)
+}
+
+func (s *SQLite) DueWebhookDeliveries(now int64, limit int) ([]models.WebhookDelivery, error) {
+	return dueWebhookDeliveries(s.DB, s.codec(), now, limit)
+}
+
+func (s *SQLite) RetryWebhookDelivery(id int64, nextAttemptAt int64, lastError string) error {
+	return RetryWebhookDelivery(s.DB, id, nextAttemptAt, lastError)
+}
+
+func (s *SQLite) DeleteWebhookDelivery(id int64) error {
+	return DeleteWebhookDelivery(s.DB, id)
+}
+
+func (s *SQLite) CreateInteractshSession(sess models.InteractshSession) error {
+	return CreateInteractshSession(s.DB, sess)
+}
+
+func (s *SQLite) GetInteractshSession(correlationID string) (*models.InteractshSession, error) {
+	return GetInteractshSession(s.DB, correlationID)
+}
+
+func (s *SQLite) SetInteractshPolled(correlationID string, lastPolledID int64) error {
+	return SetInteractshPolled(s.DB, correlationID, lastPolledID)
+}
+
+func (s *SQLite) DeleteInteractshSession(correlationID string) error {
+	return DeleteInteractshSession(s.DB, correlationID)
+}
+
+func (s *SQLite) CreateCollaboratorSession(tokenID int64, biidHash []byte) error {
+	return CreateCollaboratorSession(s.DB, tokenID, biidHash)
+}
+
+func (s *SQLite) GetCollaboratorSession(tokenID int64) (*models.CollaboratorSession, error) {
+	return GetCollaboratorSession(s.DB, tokenID)
+}
+
+func (s *SQLite) SetCollaboratorPolled(tokenID, lastPolledID int64) error {
+	return SetCollaboratorPolled(s.DB, tokenID, lastPolledID)
+}
+
+func (s *SQLite) DeleteCollaboratorSession(tokenID int64) (bool, error) {
+	return DeleteCollaboratorSession(s.DB, tokenID)
+}
+
+func (s *SQLite) PutTokenFile(tokenID int64, path, contentType string, content []byte) error {
+	return PutTokenFile(s.DB, tokenID, path, contentType, content)
+}
+
+func (s *SQLite) GetTokenFile(tokenID int64, path string) (*models.TokenFile, error) {
+	return GetTokenFile(s.DB, tokenID, path)
+}
+
+func (s *SQLite) ListTokenFiles(tokenID int64) ([]models.TokenFile, error) {
+	return ListTokenFiles(s.DB, tokenID)
+}
+
+func (s *SQLite) DeleteTokenFile(tokenID int64, path string) (bool, error) {
+	return DeleteTokenFile(s.DB, tokenID, path)
+}
+
+func (s *SQLite) SetPluginConfig(pluginID string, config any) error {
+	return SetPluginConfig(s.DB, pluginID, config)
+}
+
+func (s *SQLite) GetPluginConfig(pluginID string, out any) (bool, error) {
+	return GetPluginConfig(s.DB, pluginID, out)
+}
+
+func (s *SQLite) DeletePluginConfig(pluginID string) error {
+	return DeletePluginConfig(s.DB, pluginID)
+}
+
+func (s *SQLite) SetTokenPluginConfig(tokenID int64, pluginID string, config any) error {
+	return SetTokenPluginConfig(s.DB, tokenID, pluginID, config)
+}
+
+func (s *SQLite) GetTokenPluginConfig(tokenID int64, pluginID string, out any) (bool, error) {
+	return GetTokenPluginConfig(s.DB, tokenID, pluginID, out)
+}
+
+func (s *SQLite) DeleteTokenPluginConfig(tokenID int64, pluginID string) error {
+	return DeleteTokenPluginConfig(s.DB, tokenID, pluginID)
+}
+
+// sqliteTx is the Writer for a Write's transaction.
+type sqliteTx struct {
+	tx cachedDB
+	c  codec
+}
+
+func (t sqliteTx) CreateInteraction(tokenID int64, kind string, remoteIP string, remotePort int, tls bool, summary string) (int64, error) {
+	return CreateInteraction(t.tx, tokenID, kind, remoteIP, remotePort, tls, summary)
+}
+
+func (t sqliteTx) CreateInteractionAt(occurredAt int64, tokenID int64, kind string, remoteIP string, remotePort int, tls bool, summary string) (int64, error) {
+	return CreateInteractionAt(t.tx, occurredAt, tokenID, kind, remoteIP, remotePort, tls, summary)
+}
+
+func (t sqliteTx) CreateHTTPInteraction(interactionID int64, method, scheme, host, path, query, httpVersion string, headers string, body []byte) error {
+	return createHTTPInteraction(t.tx, t.c, interactionID, method, scheme, host, path, query, httpVersion, headers, body)
+}
+
+func (t sqliteTx) CreateDNSInteraction(interactionID int64, qname string, qtype, qclass, rd, opcode, dnsID int, protocol string) error {
+	return CreateDNSInteraction(t.tx, interactionID, qname, qtype, qclass, rd, opcode, dnsID, protocol)
+}
+
+func (t sqliteTx) CreateProtocolInteraction(interactionID int64, raw []byte, fields string) error {
+	return createProtocolInteraction(t.tx, t.c, interactionID, raw, fields)
+}
+
+func (t sqliteTx) SetHTTPResponse(interactionID int64, status int, headers string, body []byte) error {
+	return SetHTTPResponse(t.tx, interactionID, status, headers, body)
+}
+
+func (t sqliteTx) SetDNSResponse(interactionID int64, rcode int, answers string) error {
+	return SetDNSResponse(t.tx, interactionID, rcode, answers)
+}
+
+func (t sqliteTx) SaveAttributes(interactionID int64, attrs map[string]any) error {
+	return saveAttributesTx(t.tx, t.c, interactionID, attrs)
+}
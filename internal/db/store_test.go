@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteWrite(t *testing.T) {
+	for _, batched := range []bool{false, true} {
+		name := "direct"
+		if batched {
+			name = "batched"
+		}
+		t.Run(name, func(t *testing.T) {
+			db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			defer func() { _ = db.Close() }()
+
+			s := NewSQLite(db)
+			if batched {
+				s.Batcher = NewBatcher(db, time.Millisecond, 0)
+				defer s.Batcher.Close()
+			}
+
+			tokenID, err := s.CreateToken("store-token", nil, nil, nil)
+			if err != nil {
+				t.Fatalf("CreateToken failed: %v", err)
+			}
+
+			var id int64
+			err = s.Write(context.Background(), func(w Writer) error {
+				var err error
+				if id, err = w.CreateInteraction(tokenID, "dns", "192.0.2.1", 53, false, "q"); err != nil {
+					return err
+				}
+				if err := w.CreateDNSInteraction(id, "q.example.com", 1, 1, 0, 0, 7, "udp"); err != nil {
+					return err
+				}
+				return w.SaveAttributes(id, map[string]any{"k": "v"})
+			})
+			if err != nil {
+				t.Fatalf("Write failed: %v", err)
+			}
+
+			d, err := s.GetDNSInteraction(id)
+			if err != nil || d == nil || d.QName != "q.example.com" {
+				t.Fatalf("GetDNSInteraction = %+v, %v", d, err)
+			}
+			attrs, err := s.GetAttributes(id)
+			if err != nil || attrs["k"] != "v" {
+				t.Fatalf("GetAttributes = %v, %v", attrs, err)
+			}
+
+			wantErr := errors.New("boom")
+			err = s.Write(context.Background(), func(w Writer) error {
+				if _, err := w.CreateInteraction(tokenID, "dns", "192.0.2.1", 53, false, "failed"); err != nil {
+					return err
+				}
+				return wantErr
+			})
+			if !errors.Is(err, wantErr) {
+				t.Errorf("Write error = %v, want %v", err, wantErr)
+			}
+			interactions, err := s.ListInteractions(tokenID, InteractionFilter{})
+			if err != nil {
+				t.Fatalf("ListInteractions failed: %v", err)
+			}
+			if len(interactions) != 1 {
+				t.Errorf("got %d interactions, want 1 without the failed write's", len(interactions))
+			}
+		})
+	}
+}
+
+func TestSQLiteWriteContextDone(t *testing.T) {
+	for _, batched := range []bool{false, true} {
+		name := "direct"
+		if batched {
+			name = "batched"
+		}
+		t.Run(name, func(t *testing.T) {
+			db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			defer func() { _ = db.Close() }()
+
+			s := NewSQLite(db)
+			if batched {
+				s.Batcher = NewBatcher(db, time.Millisecond, 0)
+				defer s.Batcher.Close()
+			}
+
+			tokenID, err := s.CreateToken("store-token", nil, nil, nil)
+			if err != nil {
+				t.Fatalf("CreateToken failed: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+			defer cancel()
+			err = s.Write(ctx, func(w Writer) error {
+				_, err := w.CreateInteraction(tokenID, "dns", "192.0.2.1", 53, false, "late")
+				return err
+			})
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Write error = %v, want %v", err, context.DeadlineExceeded)
+			}
+			interactions, err := s.ListInteractions(tokenID, InteractionFilter{})
+			if err != nil {
+				t.Fatalf("ListInteractions failed: %v", err)
+			}
+			if len(interactions) != 0 {
+				t.Errorf("got %d interactions after the deadline, want 0", len(interactions))
+			}
+		})
+	}
+}
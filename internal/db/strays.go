@@ -0,0 +1,100 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// CreateStrayInteraction records traffic that matched no token and returns
+// its ID.
+func CreateStrayInteraction(d Execer, s models.StrayInteraction) (int64, error) {
+	tlsVal := 0
+	if s.TLS {
+		tlsVal = 1
+	}
+	result, err := d.Exec(
+		"INSERT INTO stray_interactions (kind, occurred_at, remote_ip, remote_port, tls, token, summary, details, body) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		s.Kind, s.OccurredAt, s.RemoteIP, s.RemotePort, tlsVal, s.Token, s.Summary, s.Details, s.Body,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// StrayFilter narrows the stray interactions returned by
+// ListStrayInteractions. Zero-valued fields do not filter.
+type StrayFilter struct {
+	BeforeID int64  // only stray interactions with an ID less than this
+	Since    int64  // only stray interactions that occurred at or after this Unix timestamp
+	Kind     string // only stray interactions of this kind
+	Limit    int    // maximum number of stray interactions to return
+}
+
+// ListStrayInteractions retrieves the stray interactions matching the filter,
+// newest first.
+func ListStrayInteractions(d *sql.DB, f StrayFilter) ([]models.StrayInteraction, error) {
+	query := "SELECT id, kind, occurred_at, remote_ip, remote_port, tls, token, summary, details, body FROM stray_interactions WHERE 1 = 1"
+	var args []any
+	if f.BeforeID > 0 {
+		query += " AND id < ?"
+		args = append(args, f.BeforeID)
+	}
+	if f.Since > 0 {
+		query += " AND occurred_at >= ?"
+		args = append(args, f.Since)
+	}
+	if f.Kind != "" {
+		query += " AND kind = ?"
+		args = append(args, f.Kind)
+	}
+	query += " ORDER BY id DESC"
+	if f.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, f.Limit)
+	}
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var strays []models.StrayInteraction
+	for rows.Next() {
+		var s models.StrayInteraction
+		var tlsVal int
+		err := rows.Scan(&s.ID, &s.Kind, &s.OccurredAt, &s.RemoteIP, &s.RemotePort, &tlsVal, &s.Token, &s.Summary, &s.Details, &s.Body)
+		if err != nil {
+			return nil, err
+		}
+		s.TLS = tlsVal != 0
+		strays = append(strays, s)
+	}
+	return strays, rows.Err()
+}
+
+// PurgeStrayInteractions deletes the stray interactions that occurred before
+// the given Unix timestamp and returns the number removed.
+func PurgeStrayInteractions(d *sql.DB, before int64) (int64, error) {
+	var total int64
+	for {
+		result, err := d.Exec(`
+			DELETE FROM stray_interactions WHERE id IN (
+				SELECT id FROM stray_interactions WHERE occurred_at < ? LIMIT ?
+			)
+		`, before, purgeBatchSize)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+func TestStrayInteractions(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = d.Close() }()
+
+	token := "unknown"
+	var ids []int64
+	for n, s := range []models.StrayInteraction{
+		{Kind: "http", OccurredAt: 1000, RemoteIP: "192.0.2.1", RemotePort: 1234, Summary: "GET / HTTP/1.1", Details: "{}"},
+		{Kind: "dns", OccurredAt: 2000, RemoteIP: "192.0.2.2", RemotePort: 53, Token: &token, Summary: "A unknown.example.com udp", Details: "{}"},
+		{Kind: "http", OccurredAt: 3000, RemoteIP: "192.0.2.3", RemotePort: 443, TLS: true, Summary: "POST /login HTTP/1.1", Details: "{}", Body: []byte("user=admin")},
+	} {
+		id, err := CreateStrayInteraction(d, s)
+		if err != nil {
+			t.Fatalf("CreateStrayInteraction %d failed: %v", n, err)
+		}
+		ids = append(ids, id)
+	}
+
+	tests := []struct {
+		name   string
+		filter StrayFilter
+		want   []int64
+	}{
+		{"no filter", StrayFilter{}, []int64{ids[2], ids[1], ids[0]}},
+		{"kind", StrayFilter{Kind: "http"}, []int64{ids[2], ids[0]}},
+		{"before id", StrayFilter{BeforeID: ids[2]}, []int64{ids[1], ids[0]}},
+		{"since", StrayFilter{Since: 2000}, []int64{ids[2], ids[1]}},
+		{"limit", StrayFilter{Limit: 1}, []int64{ids[2]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ListStrayInteractions(d, tt.filter)
+			if err != nil {
+				t.Fatalf("ListStrayInteractions failed: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d stray interactions, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].ID != tt.want[i] {
+					t.Errorf("stray interaction %d: got ID %d, want %d", i, got[i].ID, tt.want[i])
+				}
+			}
+		})
+	}
+
+	all, _ := ListStrayInteractions(d, StrayFilter{})
+	if all[0].TLS != true || string(all[0].Body) != "user=admin" || all[1].Token == nil || *all[1].Token != token || all[2].Token != nil {
+		t.Errorf("stray interactions = %+v", all)
+	}
+
+	deleted, err := PurgeStrayInteractions(d, 2500)
+	if err != nil || deleted != 2 {
+		t.Fatalf("PurgeStrayInteractions = %d, %v; want 2", deleted, err)
+	}
+	if remaining, _ := ListStrayInteractions(d, StrayFilter{}); len(remaining) != 1 || remaining[0].ID != ids[2] {
+		t.Errorf("remaining stray interactions = %+v, want only the newest", remaining)
+	}
+}
@@ -4,14 +4,15 @@ import (
 	"database/sql"
 	"time"
 
-	"github.com/rsclarke/oastrix/internal/models"
+	"github.com/rsclarke/oastrix/pkg/models"
 )
 
 // CreateToken inserts a new token into the database and returns its ID.
-func CreateToken(d *sql.DB, token string, apiKeyID *int64, label *string) (int64, error) {
+// A nil expiresAt creates a token that never expires.
+func CreateToken(d *sql.DB, token string, apiKeyID *int64, label *string, expiresAt *int64) (int64, error) {
 	result, err := d.Exec(
-		"INSERT INTO tokens (token, api_key_id, created_at, label) VALUES (?, ?, ?, ?)",
-		token, apiKeyID, time.Now().Unix(), label,
+		"INSERT INTO tokens (token, api_key_id, created_at, label, expires_at) VALUES (?, ?, ?, ?, ?)",
+		token, apiKeyID, time.Now().Unix(), label, expiresAt,
 	)
 	if err != nil {
 		return 0, err
@@ -22,11 +23,11 @@ func CreateToken(d *sql.DB, token string, apiKeyID *int64, label *string) (int64
 // GetTokenByValue retrieves a token by its value.
 func GetTokenByValue(d *sql.DB, token string) (*models.Token, error) {
 	row := d.QueryRow(
-		"SELECT id, token, api_key_id, created_at, label FROM tokens WHERE token = ?",
+		"SELECT id, token, api_key_id, created_at, label, expires_at, enabled FROM tokens WHERE token = ?",
 		token,
 	)
 	var t models.Token
-	err := row.Scan(&t.ID, &t.Token, &t.APIKeyID, &t.CreatedAt, &t.Label)
+	err := row.Scan(&t.ID, &t.Token, &t.APIKeyID, &t.CreatedAt, &t.Label, &t.ExpiresAt, &t.Enabled)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -41,3 +42,71 @@ func DeleteToken(d *sql.DB, token string) error {
 	_, err := d.Exec("DELETE FROM tokens WHERE token = ?", token)
 	return err
 }
+
+// SetTokenLabel replaces a token's label. A nil label clears it.
+func SetTokenLabel(d *sql.DB, id int64, label *string) error {
+	_, err := d.Exec("UPDATE tokens SET label = ? WHERE id = ?", label, id)
+	return err
+}
+
+// SetTokenExpiry replaces a token's expiry. A nil expiresAt means the token
+// never expires.
+func SetTokenExpiry(d *sql.DB, id int64, expiresAt *int64) error {
+	_, err := d.Exec("UPDATE tokens SET expires_at = ? WHERE id = ?", expiresAt, id)
+	return err
+}
+
+// SetTokenTags replaces a token's tags. An empty tags clears them.
+func SetTokenTags(d *sql.DB, id int64, tags []string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec("DELETE FROM token_tags WHERE token_id = ?", id); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO token_tags (token_id, tag) VALUES (?, ?)", id, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetTokenTags returns a token's tags, sorted.
+func GetTokenTags(d Querier, id int64) ([]string, error) {
+	rows, err := d.Query("SELECT tag FROM token_tags WHERE token_id = ? ORDER BY tag", id)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// SetTokenEnabled enables or disables a token.
+func SetTokenEnabled(d *sql.DB, id int64, enabled bool) error {
+	_, err := d.Exec("UPDATE tokens SET enabled = ? WHERE id = ?", enabled, id)
+	return err
+}
+
+// PurgeExpiredTokens deletes tokens, and with them their interactions, that
+// expired before the given Unix timestamp. It returns the number of tokens
+// removed.
+func PurgeExpiredTokens(d *sql.DB, before int64) (int64, error) {
+	result, err := d.Exec("DELETE FROM tokens WHERE expires_at IS NOT NULL AND expires_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
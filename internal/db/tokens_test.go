@@ -0,0 +1,130 @@
+package db
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestTokenExpiry(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	expiresAt := int64(2000)
+	if _, err := CreateToken(db, "expiring", nil, nil, &expiresAt); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if _, err := CreateToken(db, "forever", nil, nil, nil); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	tok, err := GetTokenByValue(db, "expiring")
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+	if tok.ExpiresAt == nil || *tok.ExpiresAt != expiresAt {
+		t.Errorf("ExpiresAt = %v, want %d", tok.ExpiresAt, expiresAt)
+	}
+	if tok.Expired(1999) || !tok.Expired(2000) {
+		t.Error("Expired should flip at the expiry timestamp")
+	}
+
+	deleted, err := PurgeExpiredTokens(db, 2000)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if deleted != 0 {
+		t.Errorf("purged %d tokens before retention elapsed, want 0", deleted)
+	}
+
+	deleted, err = PurgeExpiredTokens(db, 2001)
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("purged %d tokens, want 1", deleted)
+	}
+
+	if tok, _ := GetTokenByValue(db, "expiring"); tok != nil {
+		t.Error("expected expired token to be purged")
+	}
+	if tok, _ := GetTokenByValue(db, "forever"); tok == nil {
+		t.Error("expected token without expiry to remain")
+	}
+}
+
+func TestListTokensByTagAndLabel(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	keyID, err := CreateAPIKey(db, "prefix", []byte("hash"), "full", nil)
+	if err != nil {
+		t.Fatalf("create API key: %v", err)
+	}
+
+	create := func(value, label string, tags ...string) {
+		t.Helper()
+		id, err := CreateToken(db, value, &keyID, &label, nil)
+		if err != nil {
+			t.Fatalf("create token: %v", err)
+		}
+		if err := SetTokenTags(db, id, tags); err != nil {
+			t.Fatalf("set tags: %v", err)
+		}
+	}
+	create("a", "Login form", "acme", "xss")
+	create("b", "Search box", "acme", "sqli")
+	create("c", "login API", "globex", "xss")
+
+	tests := []struct {
+		name   string
+		filter TokenFilter
+		want   []string
+	}{
+		{"all", TokenFilter{}, []string{"a", "b", "c"}},
+		{"one tag", TokenFilter{Tags: []string{"acme"}}, []string{"a", "b"}},
+		{"all tags", TokenFilter{Tags: []string{"acme", "xss"}}, []string{"a"}},
+		{"label", TokenFilter{Label: "LOGIN"}, []string{"a", "c"}},
+		{"tag and label", TokenFilter{Tags: []string{"globex"}, Label: "login"}, []string{"c"}},
+		{"no match", TokenFilter{Tags: []string{"initech"}}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := ListTokensByAPIKey(db, keyID, tt.filter)
+			if err != nil {
+				t.Fatalf("list tokens: %v", err)
+			}
+			var got []string
+			for _, tok := range tokens {
+				got = append(got, tok.Token)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	tokens, err := ListTokensByAPIKey(db, keyID, TokenFilter{Label: "search"})
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("list tokens: %v, %d results", err, len(tokens))
+	}
+	if !slices.Equal(tokens[0].Tags, []string{"acme", "sqli"}) {
+		t.Errorf("Tags = %v, want [acme sqli]", tokens[0].Tags)
+	}
+
+	tok, err := GetTokenByValue(db, "b")
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+	if tags, err := GetTokenTags(db, tok.ID); err != nil || !slices.Equal(tags, []string{"acme", "sqli"}) {
+		t.Errorf("GetTokenTags = %v, %v; want [acme sqli]", tags, err)
+	}
+}
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// EnqueueWebhookDelivery queues w's payload for delivery to its endpoint,
+// first at w.NextAttemptAt, and returns the delivery's ID.
+func EnqueueWebhookDelivery(d Execer, w models.WebhookDelivery) (int64, error) {
+	return enqueueWebhookDelivery(d, codec{}, w)
+}
+
+func enqueueWebhookDelivery(d Execer, c codec, w models.WebhookDelivery) (int64, error) {
+	payload, flags := c.encrypt(w.Payload, webhookPayloadAAD(w.Endpoint, w.InteractionID))
+	result, err := d.Exec(
+		"INSERT INTO webhook_deliveries (endpoint, interaction_id, payload, flags, next_attempt_at, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		w.Endpoint, w.InteractionID, payload, flags, w.NextAttemptAt, time.Now().Unix(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// DueWebhookDeliveries returns at most limit deliveries whose next attempt
+// is due at now, earliest first.
+func DueWebhookDeliveries(d *sql.DB, now int64, limit int) ([]models.WebhookDelivery, error) {
+	return dueWebhookDeliveries(d, codec{}, now, limit)
+}
+
+func dueWebhookDeliveries(d *sql.DB, c codec, now int64, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := d.Query(`
+		SELECT id, endpoint, interaction_id, payload, flags, attempts, next_attempt_at, last_error, created_at
+		FROM webhook_deliveries WHERE next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?
+	`, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var w models.WebhookDelivery
+		var flags int
+		err := rows.Scan(&w.ID, &w.Endpoint, &w.InteractionID, &w.Payload, &flags, &w.Attempts, &w.NextAttemptAt, &w.LastError, &w.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if w.Payload, err = c.decode(w.Payload, flags, webhookPayloadAAD(w.Endpoint, w.InteractionID)); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, w)
+	}
+	return deliveries, rows.Err()
+}
+
+// RetryWebhookDelivery records a failed attempt at a delivery and schedules
+// the next.
+func RetryWebhookDelivery(d Execer, id int64, nextAttemptAt int64, lastError string) error {
+	_, err := d.Exec(
+		"UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = ?, last_error = ? WHERE id = ?",
+		nextAttemptAt, lastError, id,
+	)
+	return err
+}
+
+// DeleteWebhookDelivery removes a delivery from the queue, once delivered or
+// abandoned.
+func DeleteWebhookDelivery(d Execer, id int64) error {
+	_, err := d.Exec("DELETE FROM webhook_deliveries WHERE id = ?", id)
+	return err
+}
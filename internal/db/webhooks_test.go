@@ -0,0 +1,61 @@
+package db
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+func TestWebhookDeliveries(t *testing.T) {
+	d, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = d.Close() }()
+	s := NewSQLite(d)
+	if s.Cipher, err = LoadCipher(d, bytes.Repeat([]byte{1}, KeySize)); err != nil {
+		t.Fatalf("LoadCipher failed: %v", err)
+	}
+
+	var ids []int64
+	for _, w := range []models.WebhookDelivery{
+		{Endpoint: "siem", InteractionID: 1, Payload: []byte(`{"id":1}`), NextAttemptAt: 2000},
+		{Endpoint: "siem", InteractionID: 2, Payload: []byte(`{"id":2}`), NextAttemptAt: 1000},
+		{Endpoint: "chat", InteractionID: 2, Payload: []byte(`{"id":2}`), NextAttemptAt: 3000},
+	} {
+		id, err := s.EnqueueWebhookDelivery(w)
+		if err != nil {
+			t.Fatalf("EnqueueWebhookDelivery failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	var stored []byte
+	if err := d.QueryRow("SELECT payload FROM webhook_deliveries WHERE id = ?", ids[0]).Scan(&stored); err != nil || bytes.Contains(stored, []byte(`"id"`)) {
+		t.Errorf("payload stored as %q, %v; want it sealed", stored, err)
+	}
+
+	due, err := s.DueWebhookDeliveries(2000, 10)
+	if err != nil {
+		t.Fatalf("DueWebhookDeliveries failed: %v", err)
+	}
+	if len(due) != 2 || due[0].ID != ids[1] || due[1].ID != ids[0] || string(due[0].Payload) != `{"id":2}` {
+		t.Fatalf("due = %+v, want the first two, earliest first", due)
+	}
+
+	if err := s.RetryWebhookDelivery(ids[1], 4000, "503 Service Unavailable"); err != nil {
+		t.Fatalf("RetryWebhookDelivery failed: %v", err)
+	}
+	if err := s.DeleteWebhookDelivery(ids[0]); err != nil {
+		t.Fatalf("DeleteWebhookDelivery failed: %v", err)
+	}
+	if due, _ := s.DueWebhookDeliveries(3000, 10); len(due) != 1 || due[0].ID != ids[2] {
+		t.Errorf("due = %+v, want only the third", due)
+	}
+	due, _ = s.DueWebhookDeliveries(4000, 10)
+	if len(due) != 2 || due[1].ID != ids[1] || due[1].Attempts != 1 || due[1].LastError == nil || *due[1].LastError != "503 Service Unavailable" {
+		t.Errorf("due = %+v, want the retried delivery with its attempt recorded", due)
+	}
+}
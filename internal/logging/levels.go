@@ -0,0 +1,129 @@
+package logging
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Levels holds the minimum level of each named logger, and of loggers with
+// no level of their own. A logger without one takes its nearest parent's,
+// e.g. "http.access" takes "http"'s. Levels may be changed at runtime.
+type Levels struct {
+	mu     sync.RWMutex
+	def    zapcore.Level
+	byName map[string]zapcore.Level
+}
+
+// ParseLevels parses a level spec: a default level followed by
+// comma-separated name=level overrides, e.g. "info,dns=debug,certmagic=warn".
+// The default may be omitted, leaving it at info.
+func ParseLevels(spec string) (*Levels, error) {
+	l := &Levels{}
+	if err := l.Set(spec); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Set replaces all levels with those of spec, in the form ParseLevels takes.
+func (l *Levels) Set(spec string) error {
+	def := zapcore.InfoLevel
+	byName := make(map[string]zapcore.Level)
+	for part := range strings.SplitSeq(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, level, named := strings.Cut(part, "=")
+		if !named {
+			level, name = name, ""
+		}
+		var lvl zapcore.Level
+		if err := lvl.Set(strings.ToLower(strings.TrimSpace(level))); err != nil {
+			return fmt.Errorf("invalid log level %q: %w", part, err)
+		}
+		if !named {
+			def = lvl
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("invalid log level %q: want name=level", part)
+		}
+		byName[name] = lvl
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.def, l.byName = def, byName
+	return nil
+}
+
+// String returns the levels as a spec, with overrides sorted by name.
+func (l *Levels) String() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	parts := []string{l.def.String()}
+	for _, name := range slices.Sorted(maps.Keys(l.byName)) {
+		parts = append(parts, name+"="+l.byName[name].String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// Level returns the minimum level of the logger named name.
+func (l *Levels) Level(name string) zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for {
+		if lvl, ok := l.byName[name]; ok {
+			return lvl
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return l.def
+		}
+		name = name[:i]
+	}
+}
+
+// min returns the lowest level any logger is enabled at.
+func (l *Levels) min() zapcore.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	lowest := l.def
+	for _, lvl := range l.byName {
+		lowest = min(lowest, lvl)
+	}
+	return lowest
+}
+
+// levelCore filters the entries written to a core by the level of the logger
+// that wrote them.
+type levelCore struct {
+	zapcore.Core
+	levels *Levels
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return lvl >= c.levels.min()
+}
+
+func (c *levelCore) Level() zapcore.Level {
+	return c.levels.min()
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level < c.levels.Level(ent.LoggerName) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestParseLevels(t *testing.T) {
+	l, err := ParseLevels("info, dns=debug ,certmagic=WARN,http.access=error")
+	if err != nil {
+		t.Fatalf("ParseLevels failed: %v", err)
+	}
+	tests := []struct {
+		name string
+		want zapcore.Level
+	}{
+		{"", zapcore.InfoLevel},
+		{"api", zapcore.InfoLevel},
+		{"dns", zapcore.DebugLevel},
+		{"certmagic", zapcore.WarnLevel},
+		{"http", zapcore.InfoLevel},
+		{"http.access", zapcore.ErrorLevel},
+		{"http.access.extra", zapcore.ErrorLevel},
+		{"dnsx", zapcore.InfoLevel},
+	}
+	for _, tt := range tests {
+		if got := l.Level(tt.name); got != tt.want {
+			t.Errorf("Level(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if got, want := l.String(), "info,certmagic=warn,dns=debug,http.access=error"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	if l, err := ParseLevels("dns=debug"); err != nil || l.Level("api") != zapcore.InfoLevel {
+		t.Errorf("without a default: %v, %v", l, err)
+	}
+	for _, spec := range []string{"loud", "dns=loud", "=debug"} {
+		if _, err := ParseLevels(spec); err == nil {
+			t.Errorf("ParseLevels(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestLevelCore(t *testing.T) {
+	levels, _ := ParseLevels("warn")
+	obs, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(&levelCore{Core: obs, levels: levels}).With(zap.String("service", "oastrix"))
+
+	logger.Named("dns").Debug("query")
+	if err := levels.Set("warn,dns=debug"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	logger.Named("dns").Debug("query")
+	logger.Named("http").Info("request")
+
+	entries := logs.All()
+	if len(entries) != 1 || entries[0].LoggerName != "dns" || entries[0].ContextMap()["service"] != "oastrix" {
+		t.Errorf("entries = %+v, want the dns debug entry logged after the change", entries)
+	}
+}
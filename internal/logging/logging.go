@@ -11,15 +11,28 @@ import (
 
 // Config holds logging configuration options.
 type Config struct {
-	Level  string // debug|info|warn|error
+	Level  string // debug|info|warn|error, optionally with per-logger overrides; see ParseLevels
 	Format string // json|console
+
+	// Levels, if set, is used instead of parsing Level, so that the caller
+	// can change levels at runtime.
+	Levels *Levels
+
+	// OTLPEndpoint is an OTLP/HTTP endpoint URL, e.g. http://localhost:4318,
+	// that log entries are also exported to; without a path, entries go to
+	// /v1/logs. Empty disables export.
+	OTLPEndpoint string
+	// OTLPHeaders are sent with each export, as comma-separated key=value
+	// pairs in the OTEL_EXPORTER_OTLP_HEADERS form.
+	OTLPHeaders string
 }
 
 // New creates a new configured zap logger.
 func New(cfg Config) (*zap.Logger, error) {
-	level := zapcore.InfoLevel
-	if cfg.Level != "" {
-		if err := level.Set(strings.ToLower(cfg.Level)); err != nil {
+	levels := cfg.Levels
+	if levels == nil {
+		var err error
+		if levels, err = ParseLevels(cfg.Level); err != nil {
 			return nil, err
 		}
 	}
@@ -36,7 +49,8 @@ func New(cfg Config) (*zap.Logger, error) {
 		zcfg = zap.NewProductionConfig()
 	}
 
-	zcfg.Level = zap.NewAtomicLevelAt(level)
+	// Entries are filtered by levels, per logger, once built.
+	zcfg.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
 	zcfg.EncoderConfig.TimeKey = "ts"
 	zcfg.EncoderConfig.LevelKey = "level"
 	zcfg.EncoderConfig.MessageKey = "msg"
@@ -48,12 +62,26 @@ func New(cfg Config) (*zap.Logger, error) {
 		return nil, err
 	}
 
+	if cfg.OTLPEndpoint != "" {
+		otlp, err := newOTLPCore(cfg, zcfg.Level)
+		if err != nil {
+			return nil, err
+		}
+		logger = logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, otlp)
+		}))
+	}
+	logger = logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &levelCore{Core: core, levels: levels}
+	}))
+
 	logger = logger.With(zap.String("service", "oastrix"))
 
 	return logger, nil
 }
 
-// Sync flushes any buffered log entries.
+// Sync flushes any buffered log entries, including those not yet exported
+// over OTLP.
 func Sync(logger *zap.Logger) {
 	_ = logger.Sync()
 }
@@ -63,6 +91,9 @@ func FromEnv() Config {
 	return Config{
 		Level:  getenv("OASTRIX_LOG_LEVEL", "info"),
 		Format: getenv("OASTRIX_LOG_FORMAT", "json"),
+
+		OTLPEndpoint: os.Getenv("OASTRIX_OTLP_LOGS_ENDPOINT"),
+		OTLPHeaders:  os.Getenv("OASTRIX_OTLP_LOGS_HEADERS"),
 	}
 }
 
@@ -82,9 +113,15 @@ func Port(port int) zap.Field { return zap.Int("port", port) }
 // Addr returns a zap field for an address.
 func Addr(addr string) zap.Field { return zap.String("addr", addr) }
 
+// Addrs returns a zap field for several addresses.
+func Addrs(addrs []string) zap.Field { return zap.Strings("addrs", addrs) }
+
 // Domain returns a zap field for a domain name.
 func Domain(domain string) zap.Field { return zap.String("domain", domain) }
 
+// Domains returns a zap field for several domain names.
+func Domains(domains []string) zap.Field { return zap.Strings("domains", domains) }
+
 // Token returns a zap field for a token value.
 func Token(token string) zap.Field { return zap.String("token", token) }
 
@@ -120,3 +157,6 @@ func QName(qname string) zap.Field { return zap.String("qname", qname) }
 
 // QType returns a zap field for a DNS query type.
 func QType(qtype string) zap.Field { return zap.String("qtype", qtype) }
+
+// RequestID returns a zap field for an HTTP request ID.
+func RequestID(id string) zap.Field { return zap.String("request_id", id) }
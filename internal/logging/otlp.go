@@ -0,0 +1,230 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	otellog "go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.uber.org/zap/zapcore"
+)
+
+// instrumentationName identifies log records emitted by oastrix itself.
+const instrumentationName = "github.com/rsclarke/oastrix"
+
+// newOTLPCore returns a core exporting entries at or above level to the
+// OTLP/HTTP logs endpoint of cfg. Syncing the core flushes buffered records.
+func newOTLPCore(cfg Config, level zapcore.LevelEnabler) (zapcore.Core, error) {
+	// The exporter silently ignores malformed URLs, so validate up front.
+	u, err := url.Parse(cfg.OTLPEndpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid otlp logs endpoint %q: want http(s)://host[:port]", cfg.OTLPEndpoint)
+	}
+	// The URL is used as is, so point a collector's base URL at its logs path.
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/logs"
+	}
+
+	headers, err := parseHeaders(cfg.OTLPHeaders)
+	if err != nil {
+		return nil, err
+	}
+	opts := []otlploghttp.Option{otlploghttp.WithEndpointURL(u.String())}
+	if len(headers) > 0 {
+		opts = append(opts, otlploghttp.WithHeaders(headers))
+	}
+	exporter, err := otlploghttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create otlp logs exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("oastrix"),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("build resource: %w", err)
+	}
+
+	provider := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)),
+		sdklog.WithResource(res),
+	)
+	return &otlpCore{
+		LevelEnabler: level,
+		logger:       provider.Logger(instrumentationName),
+		flush:        provider.ForceFlush,
+	}, nil
+}
+
+// parseHeaders parses exporter headers in the OTEL_EXPORTER_OTLP_HEADERS form,
+// comma-separated key=value pairs with URL-encoded values.
+func parseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for pair := range strings.SplitSeq(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid otlp logs header %q: want key=value", pair)
+		}
+		v, err := url.PathUnescape(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid otlp logs header %q: %w", k, err)
+		}
+		headers[k] = v
+	}
+	return headers, nil
+}
+
+// otlpCore is a zapcore.Core that emits entries as OpenTelemetry log records.
+type otlpCore struct {
+	zapcore.LevelEnabler
+	logger otellog.Logger
+	flush  func(context.Context) error
+	attrs  []otellog.KeyValue // from With
+}
+
+func (c *otlpCore) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.attrs = append(slices.Clip(c.attrs), attributes(fields)...)
+	return &clone
+}
+
+func (c *otlpCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *otlpCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	var r otellog.Record
+	r.SetTimestamp(ent.Time)
+	r.SetObservedTimestamp(time.Now())
+	r.SetSeverity(severity(ent.Level))
+	r.SetSeverityText(ent.Level.String())
+	r.SetBody(otellog.StringValue(ent.Message))
+	r.AddAttributes(c.attrs...)
+	if ent.LoggerName != "" {
+		r.AddAttributes(otellog.String("logger", ent.LoggerName))
+	}
+	if ent.Caller.Defined {
+		r.AddAttributes(
+			otellog.String(string(semconv.CodeFilePathKey), ent.Caller.File),
+			otellog.Int(string(semconv.CodeLineNumberKey), ent.Caller.Line),
+		)
+	}
+	r.AddAttributes(attributes(fields)...)
+	c.logger.Emit(context.Background(), r)
+	return nil
+}
+
+func (c *otlpCore) Sync() error {
+	return c.flush(context.Background())
+}
+
+// severity maps a zap level to its OpenTelemetry severity.
+func severity(l zapcore.Level) otellog.Severity {
+	switch l {
+	case zapcore.DebugLevel:
+		return otellog.SeverityDebug
+	case zapcore.InfoLevel:
+		return otellog.SeverityInfo
+	case zapcore.WarnLevel:
+		return otellog.SeverityWarn
+	case zapcore.ErrorLevel:
+		return otellog.SeverityError
+	case zapcore.DPanicLevel:
+		return otellog.SeverityFatal1
+	case zapcore.PanicLevel:
+		return otellog.SeverityFatal2
+	case zapcore.FatalLevel:
+		return otellog.SeverityFatal3
+	default:
+		return otellog.SeverityUndefined
+	}
+}
+
+// attributes converts zap fields to log attributes, by way of the values they
+// encode to.
+func attributes(fields []zapcore.Field) []otellog.KeyValue {
+	if len(fields) == 0 {
+		return nil
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	keys := make([]string, 0, len(fields))
+	for _, f := range fields {
+		f.AddTo(enc)
+		if _, ok := enc.Fields[f.Key]; ok && !slices.Contains(keys, f.Key) {
+			keys = append(keys, f.Key)
+		}
+	}
+	kvs := make([]otellog.KeyValue, 0, len(keys))
+	for _, k := range keys {
+		kvs = append(kvs, otellog.KeyValue{Key: k, Value: value(enc.Fields[k])})
+	}
+	return kvs
+}
+
+// value converts a value produced by zapcore.MapObjectEncoder.
+func value(v any) otellog.Value {
+	switch v := v.(type) {
+	case string:
+		return otellog.StringValue(v)
+	case bool:
+		return otellog.BoolValue(v)
+	case int:
+		return otellog.IntValue(v)
+	case int8:
+		return otellog.Int64Value(int64(v))
+	case int16:
+		return otellog.Int64Value(int64(v))
+	case int32:
+		return otellog.Int64Value(int64(v))
+	case int64:
+		return otellog.Int64Value(v)
+	case uint8:
+		return otellog.Int64Value(int64(v))
+	case uint16:
+		return otellog.Int64Value(int64(v))
+	case uint32:
+		return otellog.Int64Value(int64(v))
+	case float32:
+		return otellog.Float64Value(float64(v))
+	case float64:
+		return otellog.Float64Value(v)
+	case []byte:
+		return otellog.BytesValue(v)
+	case time.Time:
+		return otellog.StringValue(v.Format(time.RFC3339Nano))
+	case time.Duration:
+		return otellog.StringValue(v.String())
+	case []any:
+		vals := make([]otellog.Value, len(v))
+		for i, e := range v {
+			vals[i] = value(e)
+		}
+		return otellog.SliceValue(vals...)
+	case map[string]any:
+		kvs := make([]otellog.KeyValue, 0, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			kvs = append(kvs, otellog.KeyValue{Key: k, Value: value(v[k])})
+		}
+		return otellog.MapValue(kvs...)
+	case nil:
+		return otellog.Value{}
+	default:
+		return otellog.StringValue(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestNewExportsOverOTLP(t *testing.T) {
+	bodies := make(chan []byte, 4)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" || r.Header.Get("X-Api-Key") != "s3cret" {
+			t.Errorf("export to %s with key %q", r.URL.Path, r.Header.Get("X-Api-Key"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	logger, err := New(Config{Level: "info", OTLPEndpoint: srv.URL, OTLPHeaders: "x-api-key=s3cret"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	logger.Named("dns").Info("listening", zap.String("addr", ":53"))
+	logger.Debug("not exported")
+	Sync(logger)
+
+	select {
+	case body := <-bodies:
+		// The body is protobuf, which stores strings verbatim.
+		for _, want := range []string{"listening", "addr", ":53", "logger", "dns", "service", "oastrix"} {
+			if !bytes.Contains(body, []byte(want)) {
+				t.Errorf("export lacks %q", want)
+			}
+		}
+		if bytes.Contains(body, []byte("not exported")) {
+			t.Error("entry below the level exported")
+		}
+	default:
+		t.Fatal("Sync did not export")
+	}
+}
+
+func TestNewInvalidOTLP(t *testing.T) {
+	for _, cfg := range []Config{
+		{OTLPEndpoint: "localhost:4318"},
+		{OTLPEndpoint: "http://localhost:4318", OTLPHeaders: "novalue"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) succeeded", cfg)
+		}
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	got, err := parseHeaders("a=1, b = x%20y ,,")
+	if err != nil {
+		t.Fatalf("parseHeaders failed: %v", err)
+	}
+	if len(got) != 2 || got["a"] != "1" || got["b"] != "x y" {
+		t.Errorf("parseHeaders = %v", got)
+	}
+}
@@ -0,0 +1,126 @@
+// Package anomaly implements a feature plugin that records signs of request
+// smuggling and other malformed forwarding in HTTP interactions, so oastrix
+// can act as a sensor at the end of a proxy chain.
+package anomaly
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier.
+const ID = "anomaly"
+
+// Attribute holds the sorted anomalies found in an HTTP request.
+const Attribute = "http_anomalies"
+
+// MaxHeaders is the number of header fields beyond which a request is
+// recorded with "excessive_headers".
+const MaxHeaders = 100
+
+// Anomalies.
+const (
+	DuplicateContentLength   = "duplicate_content_length"
+	ContentLengthWithChunked = "content_length_with_transfer_encoding"
+	UnusualTransferEncoding  = "unusual_transfer_encoding"
+	ExcessiveHeaders         = "excessive_headers"
+	DuplicateHeader          = "duplicate_header"
+	UnderscoreHeaderName     = "underscore_header_name"
+	NonASCIIHeader           = "non_ascii_header"
+)
+
+// singletons are headers a well-behaved client sends at most once.
+var singletons = []string{"Authorization", "Content-Type", "User-Agent", "Origin", "Referer"}
+
+// Inspect returns the sorted anomalies in an HTTP request. Requests net/http
+// rejects outright, such as those with conflicting Content-Length values or
+// control characters in headers, never reach it.
+func Inspect(h *events.HTTPDraft) []string {
+	var found []string
+	add := func(a string) {
+		if !slices.Contains(found, a) {
+			found = append(found, a)
+		}
+	}
+
+	if len(h.Headers["Content-Length"]) > 1 {
+		add(DuplicateContentLength)
+	}
+	if len(h.TransferEncoding) > 0 {
+		if len(h.Headers["Content-Length"]) > 0 {
+			add(ContentLengthWithChunked)
+		}
+		if len(h.TransferEncoding) != 1 || h.TransferEncoding[0] != "chunked" {
+			add(UnusualTransferEncoding)
+		}
+	}
+
+	fields := 0
+	for name, values := range h.Headers {
+		fields += len(values)
+		if strings.Contains(name, "_") {
+			add(UnderscoreHeaderName)
+		}
+		if len(values) > 1 && slices.Contains(singletons, name) {
+			add(DuplicateHeader)
+		}
+		for _, v := range values {
+			if !isASCII(v) {
+				add(NonASCIIHeader)
+			}
+		}
+	}
+	if fields > MaxHeaders {
+		add(ExcessiveHeaders)
+	}
+
+	slices.Sort(found)
+	return found
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// Plugin records the anomalies in stored HTTP interactions in the Attribute
+// attribute.
+type Plugin struct{}
+
+// New creates a new anomaly Plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Priority inspects interactions alongside the other enrichment plugins.
+func (p *Plugin) Priority() int { return 20 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(plugins.InitContext) error { return nil }
+
+// OnPreStore records the anomalies in an HTTP request.
+func (p *Plugin) OnPreStore(_ context.Context, e *events.Event) error {
+	if e.Draft.Drop || e.Draft.TokenID == 0 || e.Draft.HTTP == nil {
+		return nil
+	}
+	found := Inspect(e.Draft.HTTP)
+	if len(found) == 0 {
+		return nil
+	}
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes[Attribute] = found
+	return nil
+}
@@ -0,0 +1,68 @@
+package anomaly
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func TestInspect(t *testing.T) {
+	many := make(map[string][]string)
+	for i := range MaxHeaders + 1 {
+		many[fmt.Sprintf("X-Header-%d", i)] = []string{"v"}
+	}
+
+	tests := []struct {
+		name string
+		h    events.HTTPDraft
+		want []string
+	}{
+		{"clean", events.HTTPDraft{Headers: map[string][]string{"Content-Length": {"2"}, "User-Agent": {"curl/8"}}, Body: []byte("hi")}, nil},
+		{"duplicate content length", events.HTTPDraft{Headers: map[string][]string{"Content-Length": {"2", "2"}}}, []string{DuplicateContentLength}},
+		{
+			"content length with chunked",
+			events.HTTPDraft{Headers: map[string][]string{"Content-Length": {"2"}}, TransferEncoding: []string{"chunked"}},
+			[]string{ContentLengthWithChunked},
+		},
+		{"chunked twice", events.HTTPDraft{TransferEncoding: []string{"chunked", "chunked"}}, []string{UnusualTransferEncoding}},
+		{"excessive headers", events.HTTPDraft{Headers: many}, []string{ExcessiveHeaders}},
+		{"duplicate authorization", events.HTTPDraft{Headers: map[string][]string{"Authorization": {"a", "b"}}}, []string{DuplicateHeader}},
+		{"repeated accept", events.HTTPDraft{Headers: map[string][]string{"Accept": {"a", "b"}}}, nil},
+		{
+			"underscore and non-ASCII",
+			events.HTTPDraft{Headers: map[string][]string{"X_forwarded_for": {"127.0.0.1"}, "X-Name": {"caf\xc3\xa9"}}},
+			[]string{NonASCIIHeader, UnderscoreHeaderName},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Inspect(&tt.h); !slices.Equal(got, tt.want) {
+				t.Errorf("Inspect = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnPreStore(t *testing.T) {
+	p := New()
+	e := &events.Event{Draft: &events.InteractionDraft{TokenID: 1, HTTP: &events.HTTPDraft{
+		Headers: map[string][]string{"Content-Length": {"0", "0"}},
+	}}}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if got, _ := e.Draft.Attributes[Attribute].([]string); !slices.Equal(got, []string{DuplicateContentLength}) {
+		t.Errorf("attribute = %v", e.Draft.Attributes[Attribute])
+	}
+
+	e = &events.Event{Draft: &events.InteractionDraft{TokenID: 1, HTTP: &events.HTTPDraft{}}}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if _, ok := e.Draft.Attributes[Attribute]; ok {
+		t.Error("attribute recorded for a clean request")
+	}
+}
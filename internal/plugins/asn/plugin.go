@@ -0,0 +1,206 @@
+// Package asn implements a feature plugin that records the autonomous system
+// announcing each interaction's remote IP, telling cloud-provider egress
+// apart from a target's own networks.
+package asn
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier.
+const ID = "asn"
+
+// Attribute holds the Info of the interaction's remote IP.
+const Attribute = "asn"
+
+// InfoKey is the event data key other hooks read the Info from with
+// events.Get[Info].
+const InfoKey = ID + ".info"
+
+// Info describes the autonomous system announcing an address.
+type Info struct {
+	Number  uint32 `json:"number"`
+	Org     string `json:"org"`
+	Country string `json:"country,omitempty"`
+}
+
+// ipRange is a range of addresses announced by one autonomous system.
+type ipRange struct {
+	start, end netip.Addr
+	info       Info
+}
+
+// Table maps addresses to the autonomous system announcing them.
+type Table struct {
+	ranges []ipRange // sorted by start, not overlapping
+}
+
+// Lookup returns the Info of the range containing addr.
+func (t *Table) Lookup(addr netip.Addr) (Info, bool) {
+	addr = addr.Unmap()
+	i, found := slices.BinarySearchFunc(t.ranges, addr, func(r ipRange, a netip.Addr) int {
+		return r.start.Compare(a)
+	})
+	if !found {
+		// The candidate is the range starting before addr.
+		if i == 0 {
+			return Info{}, false
+		}
+		i--
+	}
+	r := t.ranges[i]
+	if addr.Less(r.start) || r.end.Less(addr) {
+		return Info{}, false
+	}
+	return r.info, true
+}
+
+// Len returns the number of ranges in t.
+func (t *Table) Len() int { return len(t.ranges) }
+
+// LoadTable reads a table in the tab-separated format published by
+// iptoasn.com: range start, range end, AS number, country code and AS
+// description per line. A path ending in .gz is decompressed. Ranges with AS
+// number 0 are not routed and are skipped.
+func LoadTable(path string) (*Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("decompress %s: %w", path, err)
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	}
+	t, err := ReadTable(r)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// ReadTable reads a table in the format described by LoadTable.
+func ReadTable(r io.Reader) (*Table, error) {
+	t := &Table{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, "\t", 5)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: want at least 3 tab-separated fields", line)
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		start, end = start.Unmap(), end.Unmap()
+		if start.Is4() != end.Is4() || end.Less(start) {
+			return nil, fmt.Errorf("line %d: invalid range %s-%s", line, start, end)
+		}
+		number, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid AS number %q", line, fields[2])
+		}
+		if number == 0 {
+			continue
+		}
+		info := Info{Number: uint32(number)}
+		if len(fields) > 3 && fields[3] != "None" {
+			info.Country = fields[3]
+		}
+		if len(fields) > 4 {
+			info.Org = fields[4]
+		}
+		t.ranges = append(t.ranges, ipRange{start: start, end: end, info: info})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(t.ranges, func(a, b ipRange) int { return a.start.Compare(b.start) })
+	for i := 1; i < len(t.ranges); i++ {
+		if !t.ranges[i-1].end.Less(t.ranges[i].start) {
+			return nil, fmt.Errorf("range starting %s overlaps the one before it", t.ranges[i].start)
+		}
+	}
+	return t, nil
+}
+
+// Plugin records the Info of each stored interaction's remote IP in the
+// Attribute attribute and sets it on the event under InfoKey. Its Priority
+// runs it after quotas have dropped what they will.
+type Plugin struct {
+	table  *Table
+	logger *zap.Logger
+}
+
+// New creates a new asn Plugin looking addresses up in table.
+func New(table *Table) *Plugin {
+	return &Plugin{table: table}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Priority enriches interactions before feature plugins that might use it.
+func (p *Plugin) Priority() int { return 20 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	return nil
+}
+
+// Config returns the plugin's settings.
+func (p *Plugin) Config() map[string]any {
+	return map[string]any{"ranges": p.table.Len()}
+}
+
+// OnPreStore records the autonomous system announcing the remote IP.
+func (p *Plugin) OnPreStore(_ context.Context, e *events.Event) error {
+	if e.Draft.Drop || e.Draft.TokenID == 0 {
+		return nil
+	}
+	addr, err := netip.ParseAddr(e.Draft.RemoteIP)
+	if err != nil {
+		return nil
+	}
+	info, ok := p.table.Lookup(addr)
+	if !ok {
+		return nil
+	}
+
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes[Attribute] = info
+	e.Set(InfoKey, info)
+	return nil
+}
@@ -0,0 +1,104 @@
+package asn
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+const testTable = `1.0.0.0	1.0.0.255	13335	US	CLOUDFLARENET
+3.0.0.0	3.127.255.255	16509	US	AMAZON-02
+3.128.0.0	3.128.255.255	0	None	Not routed
+2001:db8::	2001:db8:ffff:ffff:ffff:ffff:ffff:ffff	64496	None	DOC-EXAMPLE
+`
+
+func TestLookup(t *testing.T) {
+	table, err := ReadTable(strings.NewReader(testTable))
+	if err != nil {
+		t.Fatalf("ReadTable failed: %v", err)
+	}
+	if table.Len() != 3 {
+		t.Errorf("Len = %d, want 3 without the unrouted range", table.Len())
+	}
+
+	tests := []struct {
+		addr string
+		want Info
+		ok   bool
+	}{
+		{"1.0.0.0", Info{13335, "CLOUDFLARENET", "US"}, true},
+		{"1.0.0.255", Info{13335, "CLOUDFLARENET", "US"}, true},
+		{"::ffff:3.5.140.2", Info{16509, "AMAZON-02", "US"}, true},
+		{"2001:db8::1", Info{64496, "DOC-EXAMPLE", ""}, true},
+		{"0.255.255.255", Info{}, false},
+		{"1.0.1.0", Info{}, false},
+		{"3.128.0.1", Info{}, false},
+		{"2001:db9::1", Info{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := table.Lookup(netip.MustParseAddr(tt.addr))
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Lookup(%s) = %+v, %v, want %+v, %v", tt.addr, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestReadTableRejectsInvalidLines(t *testing.T) {
+	tests := map[string]string{
+		"too few fields": "1.0.0.0\t1.0.0.255\n",
+		"bad address":    "1.0.0\t1.0.0.255\t1\tUS\tX\n",
+		"reversed range": "1.0.0.255\t1.0.0.0\t1\tUS\tX\n",
+		"mixed families": "1.0.0.0\t2001:db8::\t1\tUS\tX\n",
+		"bad AS number":  "1.0.0.0\t1.0.0.255\tAS1\tUS\tX\n",
+		"overlap":        "1.0.0.0\t1.0.0.255\t1\tUS\tX\n1.0.0.128\t1.0.1.0\t2\tUS\tY\n",
+	}
+	for name, table := range tests {
+		if _, err := ReadTable(strings.NewReader(table)); err == nil {
+			t.Errorf("%s: ReadTable succeeded", name)
+		}
+	}
+}
+
+func TestOnPreStore(t *testing.T) {
+	table, err := ReadTable(strings.NewReader(testTable))
+	if err != nil {
+		t.Fatalf("ReadTable failed: %v", err)
+	}
+	p := New(table)
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop()}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	e := &events.Event{Draft: &events.InteractionDraft{TokenID: 1, RemoteIP: "3.5.140.2"}}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	want := Info{16509, "AMAZON-02", "US"}
+	if got := e.Draft.Attributes[Attribute]; got != want {
+		t.Errorf("attribute = %+v, want %+v", got, want)
+	}
+	if got, ok := events.Get[Info](e, InfoKey); !ok || got != want {
+		t.Errorf("event data = %+v, %v, want %+v", got, ok, want)
+	}
+
+	for _, draft := range []*events.InteractionDraft{
+		{TokenID: 1, RemoteIP: "192.0.2.1"},
+		{TokenID: 1, RemoteIP: "not an ip"},
+		{TokenID: 0, RemoteIP: "3.5.140.2"},
+		{TokenID: 1, RemoteIP: "3.5.140.2", Drop: true},
+	} {
+		e := &events.Event{Draft: draft}
+		if err := p.OnPreStore(context.Background(), e); err != nil {
+			t.Fatalf("OnPreStore failed: %v", err)
+		}
+		if _, ok := e.Draft.Attributes[Attribute]; ok {
+			t.Errorf("unexpected attribute for %+v", draft)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package plugins
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/requestid"
+)
+
+// DefaultQueueSize is the default capacity of the asynchronous pipeline's
+// queue.
+const DefaultQueueSize = 1024
+
+// queueMetrics publishes the asynchronous pipeline's queue depth, how many
+// events were queued and how many were stored inline because the queue was
+// full, under /debug/vars.
+var queueMetrics = expvar.NewMap("pipeline_queue")
+
+// StartWorkers switches the pipeline to asynchronous mode. Listeners still
+// run PreStore and response hooks inline, so response hooks run before the
+// interaction is stored and see a zero InteractionID; storage, PostStore
+// hooks and saving the response are queued for one of workers goroutines.
+// When the queue of queueSize events is full, they run inline instead.
+func (p *Pipeline) StartWorkers(workers, queueSize int) {
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+	if p.queue != nil || workers <= 0 {
+		return
+	}
+	p.queue = make(chan func(), queueSize)
+	for range workers {
+		p.workers.Add(1)
+		go p.work(p.queue)
+	}
+}
+
+// StopWorkers waits for queued events to be stored and switches the pipeline
+// back to synchronous mode.
+func (p *Pipeline) StopWorkers() {
+	_ = p.Drain(context.Background())
+}
+
+// Drain switches the pipeline back to synchronous mode and waits for queued
+// events to be stored, until ctx is done. It then reports how many were left
+// queued; the workers carry on storing them until the process exits.
+func (p *Pipeline) Drain(ctx context.Context) error {
+	p.queueMu.Lock()
+	queue := p.queue
+	if queue != nil {
+		close(queue)
+		p.queue = nil
+	}
+	p.queueMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d queued events not stored: %w", len(queue), ctx.Err())
+	}
+}
+
+func (p *Pipeline) async() bool {
+	p.queueMu.RLock()
+	defer p.queueMu.RUnlock()
+	return p.queue != nil
+}
+
+// enqueue queues fn to run on a worker, or runs it inline if the queue is
+// full or the pipeline is no longer asynchronous. fn runs without ctx's
+// cancellation, since the listener has usually responded by then.
+func (p *Pipeline) enqueue(ctx context.Context, fn func(context.Context) error) {
+	ctx = context.WithoutCancel(ctx)
+	store := func() {
+		if err := fn(ctx); err != nil {
+			requestid.Logger(ctx, p.logger).Error("failed to store interaction", zap.Error(err))
+		}
+	}
+
+	p.queueMu.RLock()
+	if p.queue != nil {
+		queueMetrics.Add("depth", 1)
+		select {
+		case p.queue <- store:
+			p.queueMu.RUnlock()
+			queueMetrics.Add("queued", 1)
+			return
+		default:
+			queueMetrics.Add("depth", -1)
+		}
+	}
+	p.queueMu.RUnlock()
+
+	queueMetrics.Add("inline", 1)
+	store()
+}
+
+// work runs the storage half of queued events, each a closure over the
+// event's context, until queue is closed.
+func (p *Pipeline) work(queue <-chan func()) {
+	defer p.workers.Done()
+	for store := range queue {
+		queueMetrics.Add("depth", -1)
+		store()
+	}
+}
@@ -0,0 +1,160 @@
+// Package basicauth implements a feature plugin that challenges requests for
+// HTTP Basic credentials and records those presented.
+package basicauth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "basicauth"
+
+// CredentialsAttribute holds the Credentials presented with a request.
+const CredentialsAttribute = "basic_auth"
+
+// DefaultRealm is used when a token's Config has no realm.
+const DefaultRealm = "Restricted"
+
+// Config enables the challenge for a token. With Accept, requests presenting
+// credentials get the token's usual response instead of another challenge.
+type Config struct {
+	Realm  string `json:"realm,omitempty"`
+	Accept bool   `json:"accept,omitempty"`
+}
+
+// Validate checks that the realm can be quoted in a WWW-Authenticate header.
+func (c Config) Validate() error {
+	if len(c.Realm) > 128 {
+		return errors.New("realm exceeds 128 characters")
+	}
+	for _, r := range c.Realm {
+		if r < 0x20 || r == 0x7f || r == '"' || r == '\\' {
+			return fmt.Errorf("realm contains invalid character %q", r)
+		}
+	}
+	return nil
+}
+
+// Credentials are the user name and password from a Basic Authorization
+// header.
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Plugin answers HTTP interactions for enabled tokens with a 401 Basic
+// challenge and records credentials presented on the retry in the
+// CredentialsAttribute attribute. Its Priority runs it after the storage
+// plugin and before any other plugin that handles responses.
+type Plugin struct {
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+}
+
+// New creates a new basicauth Plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Priority places the challenge before any other plugin answers the token.
+func (p *Plugin) Priority() int { return 40 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.tokens = ctx.Tokens
+	return nil
+}
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnPreStore records the credentials presented to an enabled token.
+func (p *Plugin) OnPreStore(ctx context.Context, e *events.Event) error {
+	if e.Draft.Drop || e.Draft.TokenID == 0 || e.Draft.HTTP == nil {
+		return nil
+	}
+	creds, ok := parseBasic(e.Draft.HTTP.Headers)
+	if !ok {
+		return nil
+	}
+	if _, enabled, err := p.config(ctx, e.Draft.TokenID); err != nil || !enabled {
+		return err
+	}
+
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes[CredentialsAttribute] = creds
+	return nil
+}
+
+// OnHTTPResponse challenges requests to enabled tokens.
+func (p *Plugin) OnHTTPResponse(ctx context.Context, e *events.HTTPEvent) error {
+	if e.Resp == nil || e.Resp.Handled || e.Draft == nil || e.Draft.TokenID == 0 || e.Draft.HTTP == nil {
+		return nil
+	}
+	cfg, enabled, err := p.config(ctx, e.Draft.TokenID)
+	if err != nil || !enabled {
+		return err
+	}
+	if _, presented := parseBasic(e.Draft.HTTP.Headers); presented && cfg.Accept {
+		return nil
+	}
+
+	realm := cfg.Realm
+	if realm == "" {
+		realm = DefaultRealm
+	}
+	e.Resp.Status = http.StatusUnauthorized
+	if e.Resp.Headers == nil {
+		e.Resp.Headers = make(map[string]string)
+	}
+	e.Resp.Headers["WWW-Authenticate"] = `Basic realm="` + realm + `", charset="UTF-8"`
+	e.Resp.Body = []byte("Unauthorized")
+	e.Resp.Handled = true
+	return nil
+}
+
+func (p *Plugin) config(ctx context.Context, tokenID int64) (Config, bool, error) {
+	var cfg Config
+	ok, err := p.tokens.Get(ctx, tokenID, ID, &cfg)
+	if err != nil {
+		return cfg, false, fmt.Errorf("load basic auth: %w", err)
+	}
+	return cfg, ok, nil
+}
+
+// parseBasic returns the credentials in a Basic Authorization header.
+func parseBasic(headers map[string][]string) (Credentials, bool) {
+	for _, v := range headers["Authorization"] {
+		scheme, encoded, ok := strings.Cut(strings.TrimSpace(v), " ")
+		if !ok || !strings.EqualFold(scheme, "Basic") {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			continue
+		}
+		user, pass, _ := strings.Cut(string(decoded), ":")
+		return Credentials{Username: user, Password: pass}, true
+	}
+	return Credentials{}, false
+}
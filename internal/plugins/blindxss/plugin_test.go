@@ -0,0 +1,143 @@
+package blindxss
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func newPlugin(t *testing.T) *Plugin {
+	t.Helper()
+	p := New()
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop()}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p
+}
+
+func newEvent(method, path, body string) *events.HTTPEvent {
+	return &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{
+			TokenValue: "xsstoken",
+			TokenID:    1,
+			HTTP: &events.HTTPDraft{
+				Method: method,
+				Scheme: "https",
+				Host:   "xsstoken.oastrix.example.com",
+				Path:   path,
+				Body:   []byte(body),
+			},
+		}},
+		Resp: &events.HTTPResponsePlan{Status: 200, Headers: make(map[string]string), Body: []byte("ok")},
+	}
+}
+
+func TestServesProbe(t *testing.T) {
+	p := newPlugin(t)
+
+	e := newEvent("GET", "/bx.js", "")
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if !e.Resp.Handled || e.Resp.Headers["Content-Type"] != "application/javascript" {
+		t.Fatalf("response = %+v", e.Resp)
+	}
+	body := string(e.Resp.Body)
+	if !strings.Contains(body, `"https://xsstoken.oastrix.example.com/bx.js"`) {
+		t.Errorf("probe does not report to its own URL:\n%s", body)
+	}
+	if strings.Contains(body, "html2canvas") {
+		t.Error("probe loads html2canvas without a screenshot script configured")
+	}
+
+	p.ScreenshotScript = "https://cdn.example.com/html2canvas.min.js"
+	e = newEvent("GET", "/oast/xsstoken/bx.js", "")
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if !strings.Contains(string(e.Resp.Body), `"https://cdn.example.com/html2canvas.min.js"`) {
+		t.Errorf("probe does not load the screenshot script:\n%s", e.Resp.Body)
+	}
+}
+
+func TestRecordsCapture(t *testing.T) {
+	p := newPlugin(t)
+
+	e := newEvent("POST", "/bx.js", `{"url":"https://admin.example.com/tickets/7","cookies":"sid=abc","dom":"<html></html>","screenshot":"javascript:alert(1)"}`)
+	if err := p.OnPreStore(context.Background(), &e.Event); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	c, ok := e.Draft.Attributes[CaptureAttribute].(Capture)
+	if !ok {
+		t.Fatalf("attributes = %v", e.Draft.Attributes)
+	}
+	want := Capture{URL: "https://admin.example.com/tickets/7", Cookies: "sid=abc", DOM: "<html></html>"}
+	if c != want {
+		t.Errorf("capture = %+v, want %+v", c, want)
+	}
+
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if !e.Resp.Handled || e.Resp.Status != 204 || e.Resp.Headers["Access-Control-Allow-Origin"] != "*" {
+		t.Errorf("response = %+v", e.Resp)
+	}
+}
+
+func TestIgnoresOtherRequests(t *testing.T) {
+	p := newPlugin(t)
+
+	tests := []struct {
+		name string
+		e    *events.HTTPEvent
+	}{
+		{"other path", newEvent("POST", "/submit", `{"url":"x"}`)},
+		{"malformed", newEvent("POST", "/bx.js", `not json`)},
+		{"empty capture", newEvent("POST", "/bx.js", `{}`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.OnPreStore(context.Background(), &tt.e.Event); err != nil {
+				t.Fatalf("OnPreStore failed: %v", err)
+			}
+			if _, ok := tt.e.Draft.Attributes[CaptureAttribute]; ok {
+				t.Error("unexpected capture attribute")
+			}
+		})
+	}
+
+	e := newEvent("GET", "/other.js", "")
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if e.Resp.Handled {
+		t.Error("handled a request for another path")
+	}
+}
+
+func TestPayloads(t *testing.T) {
+	p := newPlugin(t)
+	payloads := p.Payloads(plugins.PayloadContext{Token: "xsstoken", Domain: "oastrix.example.com"})
+	if len(payloads) == 0 {
+		t.Fatal("no payloads")
+	}
+	for _, pl := range payloads {
+		if pl.Category != "xss" || !strings.Contains(pl.Value, "https://xsstoken.oastrix.example.com/bx.js") {
+			t.Errorf("payload %s = %q", pl.Name, pl.Value)
+		}
+	}
+}
+
+func TestInitRejectsRelativePath(t *testing.T) {
+	p := New()
+	p.Path = "bx.js"
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop()}); err == nil {
+		t.Error("expected an error for a path without a leading slash")
+	}
+}
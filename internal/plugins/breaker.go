@@ -0,0 +1,70 @@
+package plugins
+
+import (
+	"sync"
+	"time"
+)
+
+// Defaults for hook timeouts and circuit breaking.
+const (
+	DefaultHookTimeout      = 5 * time.Second
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// breakers tracks consecutive hook failures per plugin. After threshold
+// failures a plugin's breaker opens and its hooks are skipped until cooldown
+// has passed. The next call is then let through: success closes the breaker,
+// failure opens it again.
+type breakers struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*breakerState
+}
+
+type breakerState struct {
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether the plugin's hooks may run.
+func (b *breakers) allow(id string) bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.states[id]
+	return !ok || !b.now().Before(st.openUntil)
+}
+
+// record records the outcome of a hook call, reporting whether it opened the
+// plugin's breaker.
+func (b *breakers) record(id string, err error) bool {
+	if b.threshold <= 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.states, id)
+		return false
+	}
+	if b.states == nil {
+		b.states = make(map[string]*breakerState)
+	}
+	st, ok := b.states[id]
+	if !ok {
+		st = &breakerState{}
+		b.states[id] = st
+	}
+	st.failures++
+	if st.failures < b.threshold {
+		return false
+	}
+	st.openUntil = b.now().Add(b.cooldown)
+	return true
+}
@@ -0,0 +1,138 @@
+// Package bulk holds what the outputs that index interactions in bulk share:
+// a queue that batches encoded interactions and retries failed batches with
+// backoff.
+package bulk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Defaults for the outputs' configuration.
+const (
+	DefaultBatchSize   = 100
+	DefaultMaxAttempts = 8
+)
+
+// MaxQueued bounds the items a queue holds; items added beyond it are
+// dropped.
+const MaxQueued = 10000
+
+// FlushInterval is how often outputs send what they have queued, however
+// little.
+const FlushInterval = 5 * time.Second
+
+// Backoff between attempts at sending a batch, doubling from minBackoff.
+const (
+	minBackoff = 5 * time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+// PermanentError wraps an error the endpoint will give for the batch however
+// often it is sent, e.g. because it rejected the batch's contents.
+type PermanentError struct{ Err error }
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Queue holds encoded items until they are sent in batches. It is held in
+// memory, so items not yet sent when the server stops are lost. The zero
+// value is an empty queue.
+type Queue struct {
+	mu       sync.Mutex
+	items    [][]byte
+	attempts int       // failed attempts at sending the batch at the head
+	next     time.Time // when the batch at the head may be retried
+	dropped  int       // items dropped since last reported
+
+	sending sync.Mutex
+}
+
+// Add queues item and returns how many items are queued. If MaxQueued are
+// already, item is dropped instead.
+func (q *Queue) Add(item []byte) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) >= MaxQueued {
+		q.dropped++
+		return len(q.items)
+	}
+	q.items = append(q.items, item)
+	return len(q.items)
+}
+
+// Len returns how many items are queued.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// Flush sends the queued items with send, in batches of at most size, until
+// the queue is empty or a batch fails. A failed batch is retried by later
+// flushes with exponential backoff, and dropped after maxAttempts attempts or
+// a PermanentError. Only one flush runs at a time; a flush while another is
+// running returns at once. The error reports the batches that failed and the
+// items dropped.
+func (q *Queue) Flush(ctx context.Context, now time.Time, size, maxAttempts int, send func(ctx context.Context, batch [][]byte) error) error {
+	if !q.sending.TryLock() {
+		return nil
+	}
+	defer q.sending.Unlock()
+
+	var errs []error
+	q.mu.Lock()
+	if q.dropped > 0 {
+		errs = append(errs, fmt.Errorf("dropped %d items: queue full", q.dropped))
+		q.dropped = 0
+	}
+	q.mu.Unlock()
+
+	for {
+		// Only flushes remove items, so the head batch cannot change while
+		// it is sent.
+		q.mu.Lock()
+		if len(q.items) == 0 || now.Before(q.next) {
+			q.mu.Unlock()
+			break
+		}
+		batch := slices.Clone(q.items[:min(size, len(q.items))])
+		q.mu.Unlock()
+
+		err := send(ctx, batch)
+
+		q.mu.Lock()
+		var permanent *PermanentError
+		switch {
+		case err == nil:
+		case errors.As(err, &permanent) || q.attempts+1 >= maxAttempts:
+			errs = append(errs, fmt.Errorf("dropped batch of %d items after %d attempts: %w", len(batch), q.attempts+1, err))
+		default:
+			q.attempts++
+			wait := backoff(q.attempts)
+			q.next = now.Add(wait)
+			q.mu.Unlock()
+			errs = append(errs, fmt.Errorf("send batch of %d items, retrying in %s: %w", len(batch), wait, err))
+			return errors.Join(errs...)
+		}
+		q.items = slices.Delete(q.items, 0, len(batch))
+		q.attempts, q.next = 0, time.Time{}
+		q.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// backoff returns how long to wait after the nth failed attempt at sending a
+// batch.
+func backoff(n int) time.Duration {
+	d := minBackoff
+	for i := 1; i < n && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
@@ -0,0 +1,113 @@
+package bulk
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func items(q *Queue, n int) {
+	for i := range n {
+		q.Add([]byte{byte('a' + i)})
+	}
+}
+
+func TestFlushBatches(t *testing.T) {
+	var q Queue
+	items(&q, 5)
+	var batches []string
+	err := q.Flush(context.Background(), time.Now(), 2, 3, func(_ context.Context, batch [][]byte) error {
+		var b strings.Builder
+		for _, item := range batch {
+			b.Write(item)
+		}
+		batches = append(batches, b.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if got := strings.Join(batches, ","); got != "ab,cd,e" {
+		t.Errorf("batches = %s, want ab,cd,e", got)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len = %d after flushing", q.Len())
+	}
+}
+
+func TestFlushRetries(t *testing.T) {
+	var q Queue
+	items(&q, 3)
+	now := time.Unix(1700000000, 0)
+	calls := 0
+	failing := func(context.Context, [][]byte) error {
+		calls++
+		return errors.New("unavailable")
+	}
+
+	if err := q.Flush(context.Background(), now, 2, 3, failing); err == nil {
+		t.Fatal("Flush succeeded, want the batch's error")
+	}
+	// Not due until the backoff has passed.
+	_ = q.Flush(context.Background(), now.Add(minBackoff-time.Second), 2, 3, failing)
+	if calls != 1 {
+		t.Fatalf("send called %d times before the backoff passed, want 1", calls)
+	}
+	_ = q.Flush(context.Background(), now.Add(minBackoff), 2, 3, failing)
+	if calls != 2 || q.Len() != 3 {
+		t.Fatalf("after a retry: %d calls and %d queued, want 2 and 3", calls, q.Len())
+	}
+
+	// The third attempt is the last, after which the batch is dropped and
+	// the rest sent.
+	var sent int
+	err := q.Flush(context.Background(), now.Add(time.Hour), 2, 3, func(_ context.Context, batch [][]byte) error {
+		calls++
+		if calls == 3 {
+			return errors.New("unavailable")
+		}
+		sent += len(batch)
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "dropped batch of 2 items after 3 attempts") {
+		t.Errorf("Flush error = %v, want the batch reported dropped", err)
+	}
+	if sent != 1 || q.Len() != 0 {
+		t.Errorf("sent %d and %d queued, want 1 and 0", sent, q.Len())
+	}
+}
+
+func TestFlushPermanent(t *testing.T) {
+	var q Queue
+	items(&q, 1)
+	err := q.Flush(context.Background(), time.Now(), 10, 5, func(context.Context, [][]byte) error {
+		return &PermanentError{errors.New("bad request")}
+	})
+	if err == nil || q.Len() != 0 {
+		t.Errorf("Flush error = %v with %d queued, want the batch dropped", err, q.Len())
+	}
+}
+
+func TestAddFull(t *testing.T) {
+	var q Queue
+	for range MaxQueued + 2 {
+		q.Add([]byte("x"))
+	}
+	if q.Len() != MaxQueued {
+		t.Errorf("Len = %d, want %d", q.Len(), MaxQueued)
+	}
+	err := q.Flush(context.Background(), time.Now(), MaxQueued, 1, func(context.Context, [][]byte) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "dropped 2 items") {
+		t.Errorf("Flush error = %v, want the dropped items reported", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for n, want := range map[int]time.Duration{1: 5 * time.Second, 2: 10 * time.Second, 4: 40 * time.Second, 20: 5 * time.Minute} {
+		if got := backoff(n); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
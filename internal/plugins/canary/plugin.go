@@ -0,0 +1,172 @@
+// Package canary implements a feature plugin that turns tokens into canary
+// tokens: artifacts planted for defenders, each trigger of which is an alert
+// carrying the memo it was created with.
+package canary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "canary"
+
+// AlertAttribute holds the Alert recorded on each trigger of a canary token.
+const AlertAttribute = "canary"
+
+// Canary types, named after the artifact planted.
+const (
+	TypeWeb   = "web"   // tracking URL
+	TypeDNS   = "dns"   // hostname
+	TypeEmail = "email" // email address, triggered by mail servers looking up its domain
+)
+
+// Limits on a canary's metadata.
+const (
+	maxMemo    = 1024
+	maxContext = 32
+)
+
+// Config makes a token a canary. Memo says where the artifact was planted,
+// so an alert can be acted on; Context holds whatever else was known when it
+// was created, e.g. the host or document it was planted in and who planted it.
+type Config struct {
+	Type    string            `json:"type"`
+	Memo    string            `json:"memo"`
+	Context map[string]string `json:"context,omitempty"`
+}
+
+// Validate checks the type and the size of the metadata.
+func (c Config) Validate() error {
+	switch c.Type {
+	case TypeWeb, TypeDNS, TypeEmail:
+	default:
+		return fmt.Errorf("invalid type %q: want web, dns or email", c.Type)
+	}
+	if strings.TrimSpace(c.Memo) == "" {
+		return errors.New("memo required")
+	}
+	if len(c.Memo) > maxMemo {
+		return fmt.Errorf("memo exceeds %d bytes", maxMemo)
+	}
+	if len(c.Context) > maxContext {
+		return fmt.Errorf("context has more than %d entries", maxContext)
+	}
+	for k, v := range c.Context {
+		if k == "" || len(k) > 64 || len(v) > maxMemo {
+			return fmt.Errorf("invalid context entry %q", k)
+		}
+	}
+	return nil
+}
+
+// Alert is the AlertAttribute recorded on a trigger.
+type Alert struct {
+	Type    string            `json:"type"`
+	Memo    string            `json:"memo"`
+	Context map[string]string `json:"context,omitempty"`
+}
+
+// Plugin records an Alert on every interaction with a canary token and
+// contributes the canary artifacts to the payload catalog. Tracking URLs
+// take the Canarytokens form http://<domain>/<dir>/<dir>/<token>/<page>,
+// which the catcher resolves when serving canaries; see
+// server.HTTPServer.CanaryPaths.
+type Plugin struct {
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+}
+
+// New creates a new canary Plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Priority returns 20 so alerts are recorded after the token is resolved and
+// before notifications go out.
+func (p *Plugin) Priority() int { return 20 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.tokens = ctx.Tokens
+	return nil
+}
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnPreStore records the Alert of a canary token's trigger.
+func (p *Plugin) OnPreStore(ctx context.Context, e *events.Event) error {
+	if e.Draft.Drop || e.Draft.TokenID == 0 {
+		return nil
+	}
+	var cfg Config
+	ok, err := p.tokens.Get(ctx, e.Draft.TokenID, ID, &cfg)
+	if err != nil {
+		return fmt.Errorf("load canary: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes[AlertAttribute] = Alert(cfg)
+	return nil
+}
+
+// Payloads returns the canary artifacts of the token.
+func (p *Plugin) Payloads(ctx plugins.PayloadContext) []plugins.Payload {
+	host := ctx.Token + "." + ctx.Domain
+	return []plugins.Payload{
+		{Name: "canary_web", Category: ID, Description: "Canary tracking URL; any request is an alert", Value: TrackingURL(ctx.Domain, ctx.Token)},
+		{Name: "canary_dns", Category: ID, Description: "Canary hostname; any lookup is an alert", Value: host},
+		{Name: "canary_email", Category: ID, Description: "Canary email address; mail sent to it is an alert when the sender's server looks up its domain", Value: "alert@" + host},
+	}
+}
+
+// Words the paths of tracking URLs are made from, so they pass for an
+// ordinary site's.
+var (
+	dirs  = []string{"about", "articles", "feedback", "images", "static", "tags", "terms", "traffic", "u", "stuff"}
+	pages = []string{"index.html", "contact.php", "post.jsp", "submit.aspx", "view.htm", "payments.js"}
+)
+
+// TrackingURL returns the tracking URL of token on domain. The path is
+// derived from the token, so it is the same each time it is listed.
+func TrackingURL(domain, token string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(token))
+	n := h.Sum32()
+	d1 := dirs[n%uint32(len(dirs))]
+	d2 := dirs[(n/16)%uint32(len(dirs))]
+	page := pages[(n/256)%uint32(len(pages))]
+	return fmt.Sprintf("http://%s/%s/%s/%s/%s", domain, d1, d2, token, page)
+}
+
+// PathToken returns the token of a tracking URL's path, the segment before
+// the page, or "" if the path has no such segment.
+func PathToken(path string) string {
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segs) < 2 {
+		return ""
+	}
+	return segs[len(segs)-2]
+}
@@ -0,0 +1,89 @@
+package canary
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/core/storage"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func TestOnPreStore(t *testing.T) {
+	database, err := db.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	canaryID, err := db.CreateToken(database, "canarytoken1", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	plainID, err := db.CreateToken(database, "plaintoken1", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	cfg := Config{Type: TypeWeb, Memo: "HR share, salaries.xlsx", Context: map[string]string{"host": "fs01"}}
+	if err := db.SetTokenPluginConfig(database, canaryID, ID, cfg); err != nil {
+		t.Fatalf("SetTokenPluginConfig failed: %v", err)
+	}
+
+	p := New()
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Tokens: storage.NewTokenConfig(db.NewSQLite(database))}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	e := &events.Event{Draft: &events.InteractionDraft{TokenID: canaryID, Kind: events.KindHTTP}}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	alert, ok := e.Draft.Attributes[AlertAttribute].(Alert)
+	if !ok || alert.Memo != cfg.Memo || alert.Type != TypeWeb || alert.Context["host"] != "fs01" {
+		t.Errorf("attributes = %v, want the canary's alert", e.Draft.Attributes)
+	}
+
+	e = &events.Event{Draft: &events.InteractionDraft{TokenID: plainID, Kind: events.KindHTTP}}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if _, ok := e.Draft.Attributes[AlertAttribute]; ok {
+		t.Error("alert recorded for a token that is not a canary")
+	}
+}
+
+func TestTrackingURL(t *testing.T) {
+	u := TrackingURL("oastrix.example.com", "canarytoken1")
+	if u != TrackingURL("oastrix.example.com", "canarytoken1") {
+		t.Error("tracking URL changes between calls")
+	}
+	path, ok := strings.CutPrefix(u, "http://oastrix.example.com")
+	if !ok || strings.Count(path, "/") != 4 {
+		t.Fatalf("tracking URL = %s", u)
+	}
+	if got := PathToken(path); got != "canarytoken1" {
+		t.Errorf("PathToken(%s) = %q", path, got)
+	}
+	if got := PathToken("/index.html"); got != "" {
+		t.Errorf("PathToken(/index.html) = %q, want none", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := (Config{Type: TypeEmail, Memo: "finance mailing list"}).Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	for name, c := range map[string]Config{
+		"type":    {Type: "pdf", Memo: "m"},
+		"memo":    {Type: TypeDNS, Memo: " "},
+		"context": {Type: TypeDNS, Memo: "m", Context: map[string]string{"": "v"}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted %+v", name, c)
+		}
+	}
+}
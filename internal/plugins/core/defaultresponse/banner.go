@@ -0,0 +1,93 @@
+package defaultresponse
+
+import "sort"
+
+// Banner is the Server header and default page of a common web server.
+type Banner struct {
+	Server      string
+	ContentType string
+	Body        string
+}
+
+// Banners holds the web servers the default response can mimic, by name.
+var Banners = map[string]Banner{
+	"nginx": {
+		Server:      "nginx",
+		ContentType: "text/html",
+		Body: `<!DOCTYPE html>
+<html>
+<head>
+<title>Welcome to nginx!</title>
+<style>
+html { color-scheme: light dark; }
+body { width: 35em; margin: 0 auto;
+font-family: Tahoma, Verdana, Arial, sans-serif; }
+</style>
+</head>
+<body>
+<h1>Welcome to nginx!</h1>
+<p>If you see this page, the nginx web server is successfully installed and
+working. Further configuration is required.</p>
+
+<p>For online documentation and support please refer to
+<a href="http://nginx.org/">nginx.org</a>.<br/>
+Commercial support is available at
+<a href="http://nginx.com/">nginx.com</a>.</p>
+
+<p><em>Thank you for using nginx.</em></p>
+</body>
+</html>
+`,
+	},
+	"apache": {
+		Server:      "Apache",
+		ContentType: "text/html",
+		Body:        "<html><body><h1>It works!</h1></body></html>\n",
+	},
+	"iis": {
+		Server:      "Microsoft-IIS/10.0",
+		ContentType: "text/html",
+		Body: `<!DOCTYPE html PUBLIC "-//W3C//DTD XHTML 1.0 Strict//EN" "http://www.w3.org/TR/xhtml1/DTD/xhtml1-strict.dtd">
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head>
+<meta http-equiv="Content-Type" content="text/html; charset=iso-8859-1" />
+<title>IIS Windows Server</title>
+<style type="text/css">
+<!--
+body {
+	color:#000000;
+	background-color:#0072C6;
+	margin:0;
+}
+
+#container {
+	margin-left:auto;
+	margin-right:auto;
+	text-align:center;
+	}
+
+a img {
+	border:none;
+}
+
+-->
+</style>
+</head>
+<body>
+<div id="container">
+<a href="http://go.microsoft.com/fwlink/?linkid=66138&amp;clcid=0x409"><img src="iisstart.png" alt="IIS" width="960" height="600" /></a>
+</div>
+</body>
+</html>`,
+	},
+}
+
+// BannerNames returns the names of Banners in sorted order.
+func BannerNames() []string {
+	names := make([]string, 0, len(Banners))
+	for name := range Banners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -3,17 +3,52 @@ package defaultresponse
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"net/http"
+	"strings"
 
 	"github.com/miekg/dns"
 	"go.uber.org/zap"
 
-	"github.com/rsclarke/oastrix/internal/events"
 	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// DefaultBody is the HTTP body sent when neither Body nor a banner sets one.
+const DefaultBody = "ok"
+
+// DefaultDNSTTL is the TTL of DNS answers unless configured otherwise.
+const DefaultDNSTTL = 300
+
+// DNSAnswer controls how DNS queries are answered.
+type DNSAnswer string
+
+// DNS answer modes.
+const (
+	DNSAnswerA        DNSAnswer = "a"        // answer A queries with the public IP
+	DNSAnswerNoData   DNSAnswer = "nodata"   // answer every query without records
+	DNSAnswerNXDomain DNSAnswer = "nxdomain" // answer every query with NXDOMAIN
 )
 
 // Plugin provides default responses for HTTP and DNS when no other plugin has handled them.
 type Plugin struct {
+	// Status is the HTTP status of default responses; 0 uses 200.
+	Status int
+	// Body is the HTTP body; empty uses the banner's page or DefaultBody.
+	Body string
+	// ContentType, if set, is sent unless an earlier plugin set one;
+	// empty uses the banner's.
+	ContentType string
+	// Server, if set, is sent as the Server header; empty uses the banner's.
+	Server string
+	// Banner names a web server to mimic, one of Banners; empty mimics none.
+	Banner string
+	// DNSAnswer is how queries are answered; empty uses DNSAnswerA.
+	DNSAnswer DNSAnswer
+	// DNSTTL is the TTL of A answers.
+	DNSTTL uint32
+
 	publicIP net.IP
 	logger   *zap.Logger
 }
@@ -24,7 +59,7 @@ func New(publicIP string) *Plugin {
 	if ip == nil {
 		ip = net.IPv4(127, 0, 0, 1)
 	}
-	return &Plugin{publicIP: ip}
+	return &Plugin{publicIP: ip, DNSAnswer: DNSAnswerA, DNSTTL: DefaultDNSTTL}
 }
 
 // ID returns the plugin identifier.
@@ -36,24 +71,117 @@ func (p *Plugin) IsCore() bool { return true }
 // Init initializes the plugin with the given context.
 func (p *Plugin) Init(ctx plugins.InitContext) error {
 	p.logger = ctx.Logger.Named("defaultresponse")
+	if p.Status != 0 && (p.Status < 200 || p.Status > 599) {
+		return fmt.Errorf("invalid status %d: want 200-599", p.Status)
+	}
+	if _, ok := Banners[p.Banner]; p.Banner != "" && !ok {
+		return fmt.Errorf("unknown banner %q: want %s", p.Banner, strings.Join(BannerNames(), ", "))
+	}
+	switch p.DNSAnswer {
+	case "", DNSAnswerA, DNSAnswerNoData, DNSAnswerNXDomain:
+	default:
+		return fmt.Errorf("invalid DNS answer %q: want a, nodata or nxdomain", p.DNSAnswer)
+	}
 	return nil
 }
 
+// Config returns the plugin's settings.
+func (p *Plugin) Config() map[string]any {
+	return map[string]any{
+		"status":       p.status(),
+		"content_type": p.contentType(),
+		"server":       p.server(),
+		"banner":       p.Banner,
+		"dns_answer":   p.dnsAnswer(),
+		"dns_ttl":      p.DNSTTL,
+	}
+}
+
 // Priority returns a high value so this plugin runs last.
 func (p *Plugin) Priority() int { return 999 }
 
-// OnHTTPResponse sets a default 200 OK response if not already handled.
+// OnHTTPResponse sets the configured default response if not already handled.
+// A status other than 200 already set by an earlier plugin is kept, as are
+// Content-Type and Server headers it set.
 func (p *Plugin) OnHTTPResponse(_ context.Context, e *events.HTTPEvent) error {
 	if e.Resp == nil || e.Resp.Handled {
 		return nil
 	}
-	e.Resp.Status = 200
-	e.Resp.Body = []byte("ok")
+	if e.Resp.Status == 0 || e.Resp.Status == http.StatusOK {
+		e.Resp.Status = p.status()
+	}
+	e.Resp.Body = nil
+	if bodyAllowed(e.Resp.Status) {
+		e.Resp.Body = []byte(p.body())
+		setDefaultHeader(e.Resp, "Content-Type", p.contentType())
+	}
+	setDefaultHeader(e.Resp, "Server", p.server())
 	e.Resp.Handled = true
 	return nil
 }
 
-// OnDNSResponse adds an A record pointing to publicIP if not already handled and query is type A.
+func (p *Plugin) status() int {
+	if p.Status == 0 {
+		return http.StatusOK
+	}
+	return p.Status
+}
+
+func (p *Plugin) body() string {
+	switch {
+	case p.Body != "":
+		return p.Body
+	case p.Banner != "":
+		return Banners[p.Banner].Body
+	}
+	return DefaultBody
+}
+
+func (p *Plugin) contentType() string {
+	if p.ContentType == "" && p.Body == "" {
+		return Banners[p.Banner].ContentType
+	}
+	return p.ContentType
+}
+
+func (p *Plugin) server() string {
+	if p.Server == "" {
+		return Banners[p.Banner].Server
+	}
+	return p.Server
+}
+
+func (p *Plugin) dnsAnswer() DNSAnswer {
+	if p.DNSAnswer == "" {
+		return DNSAnswerA
+	}
+	return p.DNSAnswer
+}
+
+// setDefaultHeader sets header k to v unless v is empty or k is already set.
+func setDefaultHeader(resp *events.HTTPResponsePlan, k, v string) {
+	if v == "" {
+		return
+	}
+	for existing := range resp.Headers {
+		if strings.EqualFold(existing, k) {
+			return
+		}
+	}
+	if resp.Headers == nil {
+		resp.Headers = make(map[string]string)
+	}
+	resp.Headers[k] = v
+}
+
+// bodyAllowed reports whether an HTTP response with status may have a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// OnDNSResponse answers queries not already handled according to DNSAnswer.
+// In the default mode, A queries get a record pointing to publicIP and other
+// queries are left unanswered.
 func (p *Plugin) OnDNSResponse(_ context.Context, e *events.DNSEvent) error {
 	if e.Resp == nil || e.Resp.Handled {
 		return nil
@@ -61,6 +189,17 @@ func (p *Plugin) OnDNSResponse(_ context.Context, e *events.DNSEvent) error {
 	if e.Draft == nil || e.Draft.DNS == nil {
 		return nil
 	}
+
+	switch p.dnsAnswer() {
+	case DNSAnswerNoData:
+		e.Resp.Handled = true
+		return nil
+	case DNSAnswerNXDomain:
+		e.Resp.RCode = dns.RcodeNameError
+		e.Resp.Handled = true
+		return nil
+	}
+
 	if e.Draft.DNS.QType != int(dns.TypeA) {
 		return nil
 	}
@@ -75,7 +214,7 @@ func (p *Plugin) OnDNSResponse(_ context.Context, e *events.DNSEvent) error {
 			Name:   qname,
 			Rrtype: dns.TypeA,
 			Class:  dns.ClassINET,
-			Ttl:    300,
+			Ttl:    p.DNSTTL,
 		},
 		A: p.publicIP,
 	}
@@ -7,8 +7,8 @@ import (
 	"github.com/miekg/dns"
 	"go.uber.org/zap"
 
-	"github.com/rsclarke/oastrix/internal/events"
 	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
 )
 
 func TestPluginID(t *testing.T) {
@@ -336,3 +336,161 @@ func TestOnDNSResponsePreservesTrailingDot(t *testing.T) {
 		t.Errorf("A record name = %q, want %q", aRecord.Hdr.Name, "test.example.com.")
 	}
 }
+
+func TestOnHTTPResponseKeepsStatus(t *testing.T) {
+	p := New("1.2.3.4")
+	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+
+	tests := []struct {
+		status   int
+		wantBody string
+	}{
+		{401, "ok"},
+		{204, ""},
+		{304, ""},
+	}
+
+	for _, tt := range tests {
+		e := &events.HTTPEvent{Resp: &events.HTTPResponsePlan{Status: tt.status}}
+		if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+			t.Fatalf("OnHTTPResponse failed: %v", err)
+		}
+		if e.Resp.Status != tt.status {
+			t.Errorf("Status = %d, want %d", e.Resp.Status, tt.status)
+		}
+		if string(e.Resp.Body) != tt.wantBody {
+			t.Errorf("status %d: Body = %q, want %q", tt.status, e.Resp.Body, tt.wantBody)
+		}
+	}
+}
+
+func TestOnHTTPResponseConfigured(t *testing.T) {
+	tests := []struct {
+		name       string
+		configure  func(*Plugin)
+		headers    map[string]string
+		wantStatus int
+		wantBody   string
+		wantType   string
+		wantServer string
+	}{
+		{
+			name:       "status and body",
+			configure:  func(p *Plugin) { p.Status = 404; p.Body = "not found"; p.ContentType = "text/plain" },
+			wantStatus: 404, wantBody: "not found", wantType: "text/plain",
+		},
+		{
+			name:       "banner",
+			configure:  func(p *Plugin) { p.Banner = "apache" },
+			wantStatus: 200, wantBody: Banners["apache"].Body, wantType: "text/html", wantServer: "Apache",
+		},
+		{
+			name:       "banner with own body",
+			configure:  func(p *Plugin) { p.Banner = "nginx"; p.Body = "{}"; p.ContentType = "application/json" },
+			wantStatus: 200, wantBody: "{}", wantType: "application/json", wantServer: "nginx",
+		},
+		{
+			name:       "earlier headers kept",
+			configure:  func(p *Plugin) { p.Banner = "iis" },
+			headers:    map[string]string{"Content-Type": "text/plain", "Server": "custom"},
+			wantStatus: 200, wantBody: Banners["iis"].Body, wantType: "text/plain", wantServer: "custom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New("1.2.3.4")
+			tt.configure(p)
+			if err := p.Init(plugins.InitContext{Logger: zap.NewNop()}); err != nil {
+				t.Fatalf("Init() error = %v", err)
+			}
+
+			headers := make(map[string]string)
+			for k, v := range tt.headers {
+				headers[k] = v
+			}
+			e := &events.HTTPEvent{Resp: &events.HTTPResponsePlan{Status: 200, Headers: headers}}
+			if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+				t.Fatalf("OnHTTPResponse failed: %v", err)
+			}
+			if e.Resp.Status != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", e.Resp.Status, tt.wantStatus)
+			}
+			if string(e.Resp.Body) != tt.wantBody {
+				t.Errorf("Body = %q, want %q", e.Resp.Body, tt.wantBody)
+			}
+			if got := e.Resp.Headers["Content-Type"]; got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := e.Resp.Headers["Server"]; got != tt.wantServer {
+				t.Errorf("Server = %q, want %q", got, tt.wantServer)
+			}
+		})
+	}
+}
+
+func TestOnDNSResponseModes(t *testing.T) {
+	tests := []struct {
+		mode        DNSAnswer
+		qtype       uint16
+		wantRCode   int
+		wantAnswers int
+		wantHandled bool
+	}{
+		{DNSAnswerA, dns.TypeA, dns.RcodeSuccess, 1, true},
+		{DNSAnswerA, dns.TypeTXT, dns.RcodeSuccess, 0, false},
+		{DNSAnswerNoData, dns.TypeA, dns.RcodeSuccess, 0, true},
+		{DNSAnswerNXDomain, dns.TypeA, dns.RcodeNameError, 0, true},
+		{DNSAnswerNXDomain, dns.TypeMX, dns.RcodeNameError, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode)+"/"+dns.TypeToString[tt.qtype], func(t *testing.T) {
+			p := New("1.2.3.4")
+			p.DNSAnswer = tt.mode
+			p.DNSTTL = 60
+			_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+
+			e := &events.DNSEvent{
+				Event: events.Event{Draft: &events.InteractionDraft{
+					DNS: &events.DNSDraft{QName: "test.example.com", QType: int(tt.qtype)},
+				}},
+				Resp: &events.DNSResponsePlan{RCode: dns.RcodeSuccess},
+			}
+			if err := p.OnDNSResponse(context.Background(), e); err != nil {
+				t.Fatalf("OnDNSResponse failed: %v", err)
+			}
+			if e.Resp.RCode != tt.wantRCode || len(e.Resp.Answers) != tt.wantAnswers || e.Resp.Handled != tt.wantHandled {
+				t.Errorf("rcode = %d, answers = %d, handled = %v; want %d, %d, %v",
+					e.Resp.RCode, len(e.Resp.Answers), e.Resp.Handled, tt.wantRCode, tt.wantAnswers, tt.wantHandled)
+			}
+			if len(e.Resp.Answers) == 1 && e.Resp.Answers[0].Header().Ttl != 60 {
+				t.Errorf("TTL = %d, want 60", e.Resp.Answers[0].Header().Ttl)
+			}
+		})
+	}
+}
+
+func TestInitValidates(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(*Plugin)
+		wantErr   bool
+	}{
+		{"defaults", func(*Plugin) {}, false},
+		{"status", func(p *Plugin) { p.Status = 503 }, false},
+		{"informational status", func(p *Plugin) { p.Status = 101 }, true},
+		{"unknown banner", func(p *Plugin) { p.Banner = "lighttpd" }, true},
+		{"unknown dns answer", func(p *Plugin) { p.DNSAnswer = "refused" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New("1.2.3.4")
+			tt.configure(p)
+			if err := p.Init(plugins.InitContext{Logger: zap.NewNop()}); (err != nil) != tt.wantErr {
+				t.Errorf("Init() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
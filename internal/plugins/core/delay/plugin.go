@@ -0,0 +1,169 @@
+// Package delay implements the core plugin that holds back HTTP and DNS
+// responses for individual tokens.
+package delay
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "delay"
+
+// MaxDelay is the longest delay, including jitter, that may be configured.
+const MaxDelay = 5 * time.Minute
+
+// Attributes recorded on delayed interactions.
+const (
+	DelayAttribute   = "response_delay_ms"      // time actually waited
+	AbortedAttribute = "response_delay_aborted" // the client went away first
+)
+
+// Config is a token's response delay. Each response waits Delay plus a random
+// duration of up to Jitter. Protocols limits the delay to "http" or "dns"
+// interactions; empty applies it to both.
+type Config struct {
+	Delay     string   `json:"delay"`            // Go duration, e.g. "10s"
+	Jitter    string   `json:"jitter,omitempty"` // Go duration
+	Protocols []string `json:"protocols,omitempty"`
+}
+
+// Validate checks that c is a usable delay.
+func (c Config) Validate() error {
+	d, err := time.ParseDuration(c.Delay)
+	if err != nil || d < 0 {
+		return fmt.Errorf("invalid delay %q: want a non-negative duration", c.Delay)
+	}
+	var j time.Duration
+	if c.Jitter != "" {
+		if j, err = time.ParseDuration(c.Jitter); err != nil || j < 0 {
+			return fmt.Errorf("invalid jitter %q: want a non-negative duration", c.Jitter)
+		}
+	}
+	if d+j > MaxDelay {
+		return fmt.Errorf("delay plus jitter exceeds %s", MaxDelay)
+	}
+	for _, p := range c.Protocols {
+		if p != string(events.KindHTTP) && p != string(events.KindDNS) {
+			return fmt.Errorf("invalid protocol %q: want http or dns", p)
+		}
+	}
+	return nil
+}
+
+// duration returns the delay to apply, with jitter.
+func (c Config) duration() time.Duration {
+	d, _ := time.ParseDuration(c.Delay)
+	if j, _ := time.ParseDuration(c.Jitter); j > 0 {
+		d += rand.N(j + 1)
+	}
+	return d
+}
+
+func (c Config) applies(kind events.Kind) bool {
+	return len(c.Protocols) == 0 || slices.Contains(c.Protocols, string(kind))
+}
+
+// Plugin delays responses for tokens with a configured delay, holding HTTP
+// connections open until the delay elapses or the client disconnects. The
+// time actually waited is recorded on the interaction so target-side timeouts
+// can be measured. Its Priority runs it after the storage plugin and before
+// any plugin that handles responses.
+type Plugin struct {
+	store  db.Store
+	logger *zap.Logger
+	now    func() time.Time
+	after  func(time.Duration) <-chan time.Time
+}
+
+// New creates a new delay Plugin backed by store.
+func New(store db.Store) *Plugin {
+	return &Plugin{store: store, now: time.Now, after: time.After}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// IsCore returns true to identify this as a core plugin.
+func (p *Plugin) IsCore() bool { return true }
+
+// Priority places the delay before any plugin that handles responses, which
+// would end the response hooks before it applies.
+func (p *Plugin) Priority() int { return 30 }
+
+// HookTimeout disables the pipeline's hook timeout, which is shorter than
+// the delays the plugin is configured to add; they are bounded by MaxDelay.
+func (p *Plugin) HookTimeout() time.Duration { return 0 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	return nil
+}
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnHTTPResponse delays the HTTP response without handling it.
+func (p *Plugin) OnHTTPResponse(ctx context.Context, e *events.HTTPEvent) error {
+	return p.wait(ctx, &e.Event, events.KindHTTP)
+}
+
+// OnDNSResponse delays the DNS response without handling it.
+func (p *Plugin) OnDNSResponse(ctx context.Context, e *events.DNSEvent) error {
+	return p.wait(ctx, &e.Event, events.KindDNS)
+}
+
+func (p *Plugin) wait(ctx context.Context, e *events.Event, kind events.Kind) error {
+	if e.Draft == nil || e.Draft.TokenID == 0 {
+		return nil
+	}
+
+	var cfg Config
+	ok, err := p.store.GetTokenPluginConfig(e.Draft.TokenID, ID, &cfg)
+	if err != nil {
+		return fmt.Errorf("load delay: %w", err)
+	}
+	if !ok || !cfg.applies(kind) {
+		return nil
+	}
+	d := cfg.duration()
+	if d <= 0 {
+		return nil
+	}
+
+	start := p.now()
+	aborted := false
+	select {
+	case <-p.after(d):
+	case <-ctx.Done():
+		aborted = true
+	}
+
+	attrs := map[string]any{DelayAttribute: p.now().Sub(start).Milliseconds()}
+	if aborted {
+		attrs[AbortedAttribute] = true
+	}
+	if e.InteractionID == 0 {
+		// Not stored yet in an asynchronous pipeline, which stores the
+		// draft's attributes with it.
+		if e.Draft.Attributes == nil {
+			e.Draft.Attributes = make(map[string]any)
+		}
+		for k, v := range attrs {
+			e.Draft.Attributes[k] = v
+		}
+		return nil
+	}
+	return p.store.SaveAttributes(e.InteractionID, attrs)
+}
@@ -0,0 +1,184 @@
+package delay
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func setupTest(t *testing.T, cfg *Config) (*Plugin, *sql.DB, int64) {
+	t.Helper()
+	database, err := db.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	tokenID, err := db.CreateToken(database, "delay-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if cfg != nil {
+		if err := db.SetTokenPluginConfig(database, tokenID, ID, cfg); err != nil {
+			t.Fatalf("SetTokenPluginConfig failed: %v", err)
+		}
+	}
+
+	p := New(db.NewSQLite(database))
+	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+	return p, database, tokenID
+}
+
+// fakeClock advances by each waited duration instead of sleeping.
+func fakeClock(p *Plugin) *[]time.Duration {
+	var waited []time.Duration
+	now := time.Unix(1700000000, 0)
+	p.now = func() time.Time { return now }
+	p.after = func(d time.Duration) <-chan time.Time {
+		waited = append(waited, d)
+		now = now.Add(d)
+		ch := make(chan time.Time, 1)
+		ch <- now
+		return ch
+	}
+	return &waited
+}
+
+func newInteraction(t *testing.T, database *sql.DB, tokenID int64) int64 {
+	t.Helper()
+	id, err := db.CreateInteraction(database, tokenID, "http", "192.0.2.1", 1234, false, "test")
+	if err != nil {
+		t.Fatalf("CreateInteraction failed: %v", err)
+	}
+	return id
+}
+
+func TestDelayHTTP(t *testing.T) {
+	p, database, tokenID := setupTest(t, &Config{Delay: "3s"})
+	waited := fakeClock(p)
+
+	e := &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{TokenID: tokenID}, InteractionID: newInteraction(t, database, tokenID)},
+		Resp:  &events.HTTPResponsePlan{},
+	}
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if len(*waited) != 1 || (*waited)[0] != 3*time.Second {
+		t.Errorf("waited %v, want [3s]", *waited)
+	}
+	if e.Resp.Handled {
+		t.Error("delay must not handle the response")
+	}
+
+	attrs, err := db.GetAttributes(database, e.InteractionID)
+	if err != nil {
+		t.Fatalf("GetAttributes failed: %v", err)
+	}
+	if got := attrs[DelayAttribute]; got != float64(3000) {
+		t.Errorf("%s = %v, want 3000", DelayAttribute, got)
+	}
+	if _, ok := attrs[AbortedAttribute]; ok {
+		t.Errorf("unexpected %s", AbortedAttribute)
+	}
+}
+
+func TestDelayAbortedByClient(t *testing.T) {
+	p, database, tokenID := setupTest(t, &Config{Delay: "1m"})
+	p.after = func(time.Duration) <-chan time.Time { return nil }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	e := &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{TokenID: tokenID}, InteractionID: newInteraction(t, database, tokenID)},
+		Resp:  &events.HTTPResponsePlan{},
+	}
+	if err := p.OnHTTPResponse(ctx, e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+
+	attrs, err := db.GetAttributes(database, e.InteractionID)
+	if err != nil {
+		t.Fatalf("GetAttributes failed: %v", err)
+	}
+	if attrs[AbortedAttribute] != true {
+		t.Errorf("%s = %v, want true", AbortedAttribute, attrs[AbortedAttribute])
+	}
+}
+
+func TestDelayProtocols(t *testing.T) {
+	p, _, tokenID := setupTest(t, &Config{Delay: "1s", Protocols: []string{"dns"}})
+	waited := fakeClock(p)
+
+	h := &events.HTTPEvent{Event: events.Event{Draft: &events.InteractionDraft{TokenID: tokenID}}}
+	if err := p.OnHTTPResponse(context.Background(), h); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if len(*waited) != 0 {
+		t.Errorf("HTTP response delayed by %v, want no delay", *waited)
+	}
+
+	d := &events.DNSEvent{Event: events.Event{Draft: &events.InteractionDraft{TokenID: tokenID}}}
+	if err := p.OnDNSResponse(context.Background(), d); err != nil {
+		t.Fatalf("OnDNSResponse failed: %v", err)
+	}
+	if len(*waited) != 1 {
+		t.Errorf("DNS response waited %v, want one delay", *waited)
+	}
+}
+
+func TestNoDelay(t *testing.T) {
+	p, _, tokenID := setupTest(t, nil)
+	waited := fakeClock(p)
+
+	for _, id := range []int64{tokenID, 0} {
+		e := &events.HTTPEvent{Event: events.Event{Draft: &events.InteractionDraft{TokenID: id}}}
+		if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+			t.Fatalf("OnHTTPResponse failed: %v", err)
+		}
+	}
+	if len(*waited) != 0 {
+		t.Errorf("waited %v, want no delay", *waited)
+	}
+}
+
+func TestConfigDuration(t *testing.T) {
+	cfg := Config{Delay: "1s", Jitter: "500ms"}
+	for range 100 {
+		if d := cfg.duration(); d < time.Second || d > 1500*time.Millisecond {
+			t.Fatalf("duration() = %v, want between 1s and 1.5s", d)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"delay", Config{Delay: "10s"}, false},
+		{"jitter", Config{Delay: "1s", Jitter: "2s"}, false},
+		{"dns only", Config{Delay: "1s", Protocols: []string{"dns"}}, false},
+		{"missing delay", Config{}, true},
+		{"negative", Config{Delay: "-1s"}, true},
+		{"bad jitter", Config{Delay: "1s", Jitter: "soon"}, true},
+		{"too long", Config{Delay: "5m", Jitter: "1s"}, true},
+		{"bad protocol", Config{Delay: "1s", Protocols: []string{"smtp"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Package files implements the core plugin that serves operator-uploaded
+// files under a token's host.
+package files
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier.
+const ID = "files"
+
+// ServedAttribute records the path of the file served for an interaction.
+const ServedAttribute = "file_served"
+
+// Limits on uploaded files.
+const (
+	MaxFileSize   = 10 << 20
+	MaxPathLength = 512
+)
+
+// CleanPath returns the canonical form of a file path, which always begins
+// with a slash, e.g. "x/../a.dtd" becomes "/a.dtd".
+func CleanPath(p string) (string, error) {
+	if strings.ContainsAny(p, "\x00?#") {
+		return "", errors.New("path contains invalid characters")
+	}
+	p = path.Clean("/" + p)
+	if len(p) > MaxPathLength {
+		return "", fmt.Errorf("path exceeds %d characters", MaxPathLength)
+	}
+	return p, nil
+}
+
+// Plugin answers GET and HEAD requests for paths with an uploaded file, so
+// payload stagers, SVGs and DTDs are fetched from the host that records the
+// fetch. Its Priority runs it after the storage plugin and before any other
+// plugin that handles responses.
+type Plugin struct {
+	store  db.Store
+	logger *zap.Logger
+}
+
+// New creates a new files Plugin backed by store.
+func New(store db.Store) *Plugin {
+	return &Plugin{store: store}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// IsCore returns true to identify this as a core plugin.
+func (p *Plugin) IsCore() bool { return true }
+
+// Priority serves hosted files ahead of a token's redirect or response.
+func (p *Plugin) Priority() int { return 60 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	return nil
+}
+
+// OnHTTPResponse serves the token's file at the request path, if any.
+func (p *Plugin) OnHTTPResponse(_ context.Context, e *events.HTTPEvent) error {
+	if e.Resp == nil || e.Resp.Handled || e.Draft == nil || e.Draft.TokenID == 0 || e.Draft.HTTP == nil {
+		return nil
+	}
+	if m := e.Draft.HTTP.Method; m != http.MethodGet && m != http.MethodHead {
+		return nil
+	}
+
+	f, err := p.store.GetTokenFile(e.Draft.TokenID, requestPath(e.Draft))
+	if err != nil {
+		return fmt.Errorf("load file: %w", err)
+	}
+	if f == nil {
+		return nil
+	}
+
+	e.Resp.Status = http.StatusOK
+	if e.Resp.Headers == nil {
+		e.Resp.Headers = make(map[string]string)
+	}
+	e.Resp.Headers["Content-Type"] = f.ContentType
+	e.Resp.Body = f.Content
+	e.Resp.Handled = true
+
+	if e.InteractionID == 0 {
+		// Not stored yet in an asynchronous pipeline, which stores the
+		// draft's attributes with it.
+		if e.Draft.Attributes == nil {
+			e.Draft.Attributes = make(map[string]any)
+		}
+		e.Draft.Attributes[ServedAttribute] = f.Path
+		return nil
+	}
+	return p.store.SaveAttributes(e.InteractionID, map[string]any{ServedAttribute: f.Path})
+}
+
+// requestPath returns the file path requested, without the /oast/<token>
+// prefix used when the listener is reached by IP address.
+func requestPath(d *events.InteractionDraft) string {
+	p := d.HTTP.Path
+	if rest, ok := strings.CutPrefix(p, "/oast/"+d.TokenValue); ok && (rest == "" || rest[0] == '/') {
+		p = rest
+	}
+	if cleaned, err := CleanPath(p); err == nil {
+		return cleaned
+	}
+	return p
+}
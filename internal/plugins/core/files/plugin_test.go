@@ -0,0 +1,138 @@
+package files
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func setupTest(t *testing.T) (*Plugin, *sql.DB, int64) {
+	t.Helper()
+	database, err := db.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	tokenID, err := db.CreateToken(database, "filestoken", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if err := db.PutTokenFile(database, tokenID, "/x.dtd", "application/xml-dtd", []byte(`<!ENTITY % a "b">`)); err != nil {
+		t.Fatalf("PutTokenFile failed: %v", err)
+	}
+
+	p := New(db.NewSQLite(database))
+	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+	return p, database, tokenID
+}
+
+func newEvent(tokenID int64, method, path string) *events.HTTPEvent {
+	return &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{
+			TokenValue: "filestoken",
+			TokenID:    tokenID,
+			HTTP:       &events.HTTPDraft{Method: method, Path: path},
+		}},
+		Resp: &events.HTTPResponsePlan{Status: 200, Headers: make(map[string]string), Body: []byte("ok")},
+	}
+}
+
+func TestServesFile(t *testing.T) {
+	p, database, tokenID := setupTest(t)
+
+	for _, path := range []string{"/x.dtd", "/oast/filestoken/x.dtd", "/a/../x.dtd"} {
+		t.Run(path, func(t *testing.T) {
+			id, err := db.CreateInteraction(database, tokenID, "http", "192.0.2.1", 1234, false, "test")
+			if err != nil {
+				t.Fatalf("CreateInteraction failed: %v", err)
+			}
+			e := newEvent(tokenID, "GET", path)
+			e.InteractionID = id
+			if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+				t.Fatalf("OnHTTPResponse failed: %v", err)
+			}
+			if !e.Resp.Handled {
+				t.Fatal("expected response to be handled")
+			}
+			if got := e.Resp.Headers["Content-Type"]; got != "application/xml-dtd" {
+				t.Errorf("Content-Type = %q", got)
+			}
+			if string(e.Resp.Body) != `<!ENTITY % a "b">` {
+				t.Errorf("Body = %q", e.Resp.Body)
+			}
+
+			attrs, err := db.GetAttributes(database, id)
+			if err != nil {
+				t.Fatalf("GetAttributes failed: %v", err)
+			}
+			if attrs[ServedAttribute] != "/x.dtd" {
+				t.Errorf("%s = %v, want /x.dtd", ServedAttribute, attrs[ServedAttribute])
+			}
+		})
+	}
+}
+
+func TestServesFileBeforeStorage(t *testing.T) {
+	p, _, tokenID := setupTest(t)
+
+	e := newEvent(tokenID, "GET", "/x.dtd")
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if got := e.Draft.Attributes[ServedAttribute]; got != "/x.dtd" {
+		t.Errorf("draft %s = %v, want /x.dtd", ServedAttribute, got)
+	}
+}
+
+func TestSkips(t *testing.T) {
+	p, _, tokenID := setupTest(t)
+
+	tests := []struct {
+		name string
+		e    *events.HTTPEvent
+	}{
+		{"missing file", newEvent(tokenID, "GET", "/other")},
+		{"post", newEvent(tokenID, "POST", "/x.dtd")},
+		{"unresolved token", newEvent(0, "GET", "/x.dtd")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := p.OnHTTPResponse(context.Background(), tt.e); err != nil {
+				t.Fatalf("OnHTTPResponse failed: %v", err)
+			}
+			if tt.e.Resp.Handled || string(tt.e.Resp.Body) != "ok" {
+				t.Errorf("response changed: %+v", tt.e.Resp)
+			}
+		})
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"x.dtd", "/x.dtd", false},
+		{"/a/b.svg", "/a/b.svg", false},
+		{"/a/../../b", "/b", false},
+		{"", "/", false},
+		{"/a?b", "", true},
+		{"/a\x00", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := CleanPath(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("CleanPath(%q) = %q, %v; want %q, wantErr %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package httpresponse implements the core plugin that serves operator
+// configured HTTP responses for individual tokens.
+package httpresponse
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "httpresponse"
+
+// MaxBodySize is the largest response body that may be configured.
+const MaxBodySize = 1 << 20
+
+// Config is the response served for a token's HTTP interactions. Body holds
+// text; binary bodies are given base64 encoded in BodyBase64 instead. With
+// Template set, Body is a text/template executed against the Request.
+type Config struct {
+	Status     int               `json:"status,omitempty"` // defaults to 200
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	BodyBase64 string            `json:"body_base64,omitempty"`
+	Template   bool              `json:"template,omitempty"`
+}
+
+// Validate checks that c can be written as an HTTP response.
+func (c Config) Validate() error {
+	if c.Status != 0 && (c.Status < 100 || c.Status > 599) {
+		return fmt.Errorf("invalid status %d", c.Status)
+	}
+	if err := ValidateHeaders(c.Headers); err != nil {
+		return err
+	}
+	if c.Body != "" && c.BodyBase64 != "" {
+		return errors.New("body and body_base64 are mutually exclusive")
+	}
+	if c.Template {
+		if c.BodyBase64 != "" {
+			return errors.New("body_base64 cannot be templated")
+		}
+		if _, err := parseTemplate(c.Body); err != nil {
+			return err
+		}
+	}
+	if c.Template {
+		if len(c.Body) > MaxBodySize {
+			return fmt.Errorf("body exceeds %d bytes", MaxBodySize)
+		}
+		return nil
+	}
+	body, err := c.body(nil)
+	if err != nil {
+		return err
+	}
+	if len(body) > MaxBodySize {
+		return fmt.Errorf("body exceeds %d bytes", MaxBodySize)
+	}
+	return nil
+}
+
+// body returns the decoded response body, rendering it for d if templated.
+func (c Config) body(d *events.InteractionDraft) ([]byte, error) {
+	if c.Template {
+		return render(c.Body, newRequest(d))
+	}
+	if c.BodyBase64 == "" {
+		return []byte(c.Body), nil
+	}
+	b, err := base64.StdEncoding.DecodeString(c.BodyBase64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid body_base64: %w", err)
+	}
+	return b, nil
+}
+
+// Plugin answers HTTP interactions with the response configured for their
+// token. Its Priority runs it before defaultresponse, and after the storage
+// plugin so that token IDs are resolved.
+type Plugin struct {
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+}
+
+// New creates a new httpresponse Plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// IsCore returns true to identify this as a core plugin.
+func (p *Plugin) IsCore() bool { return true }
+
+// Priority places the configured response after files and redirects.
+func (p *Plugin) Priority() int { return 80 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.tokens = ctx.Tokens
+	return nil
+}
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnHTTPResponse serves the token's configured response, if any. A template
+// that fails to render leaves the response to later plugins.
+func (p *Plugin) OnHTTPResponse(ctx context.Context, e *events.HTTPEvent) error {
+	if e.Resp == nil || e.Resp.Handled || e.Draft == nil || e.Draft.TokenID == 0 {
+		return nil
+	}
+
+	var cfg Config
+	ok, err := p.tokens.Get(ctx, e.Draft.TokenID, ID, &cfg)
+	if err != nil {
+		return fmt.Errorf("load http response: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+	body, err := cfg.body(e.Draft)
+	if err != nil {
+		return err
+	}
+
+	e.Resp.Status = cfg.Status
+	if e.Resp.Status == 0 {
+		e.Resp.Status = http.StatusOK
+	}
+	if e.Resp.Headers == nil {
+		e.Resp.Headers = make(map[string]string, len(cfg.Headers))
+	}
+	for k, v := range cfg.Headers {
+		e.Resp.Headers[http.CanonicalHeaderKey(k)] = v
+	}
+	e.Resp.Body = body
+	e.Resp.Handled = true
+	return nil
+}
+
+// ValidateHeaders checks that headers can be written to an HTTP response
+// without corrupting it.
+func ValidateHeaders(headers map[string]string) error {
+	for k, v := range headers {
+		if !validHeaderName(k) {
+			return fmt.Errorf("invalid header name %q", k)
+		}
+		if strings.ContainsAny(v, "\r\n\x00") {
+			return fmt.Errorf("invalid value for header %q", k)
+		}
+	}
+	return nil
+}
+
+// validHeaderName reports whether name is an RFC 9110 field name token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
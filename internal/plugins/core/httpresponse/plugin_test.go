@@ -0,0 +1,184 @@
+package httpresponse
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/core/storage"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func setupTest(t *testing.T, cfg *Config) (*Plugin, *sql.DB, int64) {
+	t.Helper()
+	database, err := db.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	tokenID, err := db.CreateToken(database, "response-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if cfg != nil {
+		if err := db.SetTokenPluginConfig(database, tokenID, ID, cfg); err != nil {
+			t.Fatalf("SetTokenPluginConfig failed: %v", err)
+		}
+	}
+
+	p := New()
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Tokens: storage.NewTokenConfig(db.NewSQLite(database))}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, database, tokenID
+}
+
+func newEvent(tokenID int64) *events.HTTPEvent {
+	return &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{TokenID: tokenID}},
+		Resp:  &events.HTTPResponsePlan{Headers: make(map[string]string)},
+	}
+}
+
+func TestOnHTTPResponse(t *testing.T) {
+	p, _, tokenID := setupTest(t, &Config{
+		Status:  201,
+		Headers: map[string]string{"content-type": "application/javascript"},
+		Body:    "alert(1)",
+	})
+
+	e := newEvent(tokenID)
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if !e.Resp.Handled {
+		t.Fatal("expected response to be handled")
+	}
+	if e.Resp.Status != 201 {
+		t.Errorf("Status = %d, want 201", e.Resp.Status)
+	}
+	if got := e.Resp.Headers["Content-Type"]; got != "application/javascript" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if string(e.Resp.Body) != "alert(1)" {
+		t.Errorf("Body = %q", e.Resp.Body)
+	}
+}
+
+func TestOnHTTPResponseBase64Body(t *testing.T) {
+	p, _, tokenID := setupTest(t, &Config{BodyBase64: "AAEC/w=="})
+
+	e := newEvent(tokenID)
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if e.Resp.Status != 200 {
+		t.Errorf("Status = %d, want 200", e.Resp.Status)
+	}
+	if string(e.Resp.Body) != "\x00\x01\x02\xff" {
+		t.Errorf("Body = %q", e.Resp.Body)
+	}
+}
+
+func TestOnHTTPResponseSkips(t *testing.T) {
+	p, _, tokenID := setupTest(t, nil)
+
+	tests := []struct {
+		name string
+		e    *events.HTTPEvent
+	}{
+		{"not configured", newEvent(tokenID)},
+		{"unresolved token", newEvent(0)},
+		{"no draft", &events.HTTPEvent{Resp: &events.HTTPResponsePlan{}}},
+		{"already handled", &events.HTTPEvent{
+			Event: events.Event{Draft: &events.InteractionDraft{TokenID: tokenID}},
+			Resp:  &events.HTTPResponsePlan{Status: 302, Handled: true},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := *tt.e.Resp
+			if err := p.OnHTTPResponse(context.Background(), tt.e); err != nil {
+				t.Fatalf("OnHTTPResponse failed: %v", err)
+			}
+			if tt.e.Resp.Status != before.Status || tt.e.Resp.Handled != before.Handled {
+				t.Errorf("response changed: %+v", tt.e.Resp)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"empty", Config{}, false},
+		{"full", Config{Status: 404, Headers: map[string]string{"X-Test": "1"}, Body: "nope"}, false},
+		{"base64", Config{BodyBase64: "aGk="}, false},
+		{"status too low", Config{Status: 99}, true},
+		{"status too high", Config{Status: 600}, true},
+		{"bad header name", Config{Headers: map[string]string{"X Test": "1"}}, true},
+		{"header injection", Config{Headers: map[string]string{"X-Test": "1\r\nSet-Cookie: a=b"}}, true},
+		{"both bodies", Config{Body: "a", BodyBase64: "YQ=="}, true},
+		{"bad base64", Config{BodyBase64: "!!"}, true},
+		{"template", Config{Body: `{{.Query.Get "cb"}}`, Template: true}, false},
+		{"bad template", Config{Body: `{{.Query.Get`, Template: true}, true},
+		{"base64 template", Config{BodyBase64: "YQ==", Template: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOnHTTPResponseTemplate(t *testing.T) {
+	p, _, tokenID := setupTest(t, &Config{
+		Headers:  map[string]string{"Content-Type": "application/javascript"},
+		Body:     `{{.Query.Get "callback"}}({"token":"{{.Token}}","id":"{{.Headers.Get "X-Request-Id"}}","ip":"{{.RemoteIP}}","path":"{{.Path}}"})`,
+		Template: true,
+	})
+
+	e := newEvent(tokenID)
+	e.Draft.TokenValue = "response-token"
+	e.Draft.RemoteIP = "192.0.2.1"
+	e.Draft.HTTP = &events.HTTPDraft{
+		Method:  "GET",
+		Path:    "/x.js",
+		Query:   "callback=cb",
+		Headers: map[string][]string{"X-Request-Id": {"abc"}},
+	}
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	want := `cb({"token":"response-token","id":"abc","ip":"192.0.2.1","path":"/x.js"})`
+	if string(e.Resp.Body) != want {
+		t.Errorf("Body = %q, want %q", e.Resp.Body, want)
+	}
+}
+
+func TestOnHTTPResponseTemplateTooLarge(t *testing.T) {
+	p, _, tokenID := setupTest(t, &Config{
+		Body:     `{{range 2000000}}x{{end}}`,
+		Template: true,
+	})
+
+	e := newEvent(tokenID)
+	if err := p.OnHTTPResponse(context.Background(), e); err == nil {
+		t.Fatal("expected an error for an oversized body")
+	}
+	if e.Resp.Handled {
+		t.Error("expected the response to be left unhandled")
+	}
+}
@@ -0,0 +1,90 @@
+package httpresponse
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"text/template"
+	"time"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+var errBodyTooLarge = fmt.Errorf("rendered body exceeds %d bytes", MaxBodySize)
+
+// Request is the data available to a templated response body, e.g.
+// {{.Query.Get "callback"}} or {{.Headers.Get "X-Request-Id"}}.
+type Request struct {
+	Token    string // token value as requested, which may be an alias
+	Method   string
+	Scheme   string
+	Host     string
+	Path     string
+	RawQuery string
+	Query    url.Values
+	Headers  http.Header
+	Body     string
+	RemoteIP string
+	Time     time.Time
+}
+
+// newRequest builds the template data for an interaction.
+func newRequest(d *events.InteractionDraft) Request {
+	req := Request{
+		Token:    d.TokenValue,
+		RemoteIP: d.RemoteIP,
+		Time:     time.Unix(d.OccurredAt, 0).UTC(),
+		Query:    url.Values{},
+		Headers:  http.Header{},
+	}
+	if h := d.HTTP; h != nil {
+		req.Method = h.Method
+		req.Scheme = h.Scheme
+		req.Host = h.Host
+		req.Path = h.Path
+		req.RawQuery = h.Query
+		req.Query, _ = url.ParseQuery(h.Query)
+		req.Headers = http.Header(h.Headers)
+		req.Body = string(h.Body)
+	}
+	return req
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	t, err := template.New("body").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return t, nil
+}
+
+// render executes the body template against req, failing rather than
+// producing more than MaxBodySize bytes.
+func render(text string, req Request) ([]byte, error) {
+	t, err := parseTemplate(text)
+	if err != nil {
+		return nil, err
+	}
+	w := &limitedBuffer{max: MaxBodySize}
+	if err := t.Execute(w, req); err != nil {
+		if errors.Is(err, errBodyTooLarge) {
+			return nil, errBodyTooLarge
+		}
+		return nil, fmt.Errorf("render template: %w", err)
+	}
+	return w.Bytes(), nil
+}
+
+type limitedBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.max {
+		return 0, errBodyTooLarge
+	}
+	return b.Buffer.Write(p)
+}
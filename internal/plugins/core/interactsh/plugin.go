@@ -0,0 +1,85 @@
+// Package interactsh implements the core plugin that maps the payload hosts
+// of interactsh clients onto the tokens registered for them.
+package interactsh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier.
+const ID = "interactsh"
+
+// Lengths of the parts of an interactsh payload label: the client's
+// correlation ID, followed by a random nonce unique to each payload.
+const (
+	CorrelationIDLength = 20
+	NonceLength         = 13
+)
+
+// Attribute records the full payload label an interaction was sent to, which
+// interactsh clients report as its unique ID.
+const Attribute = "interactsh_id"
+
+// Plugin resolves interactions with an interactsh payload label, the
+// correlation ID of a registered session followed by a nonce, to the session's
+// token. Interactsh sessions are registered through the catcher's /register
+// endpoint; see server.InteractshHandler.
+type Plugin struct {
+	store  db.Store
+	logger *zap.Logger
+}
+
+// New creates a new interactsh Plugin looking sessions up in store.
+func New(store db.Store) *Plugin {
+	return &Plugin{store: store}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// IsCore returns true to identify this as a core plugin.
+func (p *Plugin) IsCore() bool { return true }
+
+// Priority returns -10 so the token value is rewritten before the storage
+// plugin resolves it.
+func (p *Plugin) Priority() int { return -10 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	return nil
+}
+
+// OnPreStore replaces a payload label's token value with its correlation ID
+// when a session is registered for it, recording the label with Attribute.
+func (p *Plugin) OnPreStore(_ context.Context, e *events.Event) error {
+	if e.Draft.TokenID != 0 {
+		return nil
+	}
+	label := strings.ToLower(e.Draft.TokenValue)
+	if len(label) != CorrelationIDLength+NonceLength {
+		return nil
+	}
+
+	sess, err := p.store.GetInteractshSession(label[:CorrelationIDLength])
+	if err != nil {
+		return fmt.Errorf("get interactsh session: %w", err)
+	}
+	if sess == nil {
+		return nil
+	}
+	e.Draft.TokenValue = sess.CorrelationID
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes[Attribute] = label
+	return nil
+}
@@ -0,0 +1,57 @@
+package interactsh
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+func TestOnPreStore(t *testing.T) {
+	database, err := db.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	const cid = "cn5g2hbc9jmp0s2vq7a0"
+	tokenID, err := db.CreateToken(database, cid, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if err := db.CreateInteractshSession(database, models.InteractshSession{CorrelationID: cid, TokenID: tokenID, SecretHash: []byte{1}, PublicKey: []byte("pem")}); err != nil {
+		t.Fatalf("CreateInteractshSession failed: %v", err)
+	}
+
+	p := New(db.NewSQLite(database))
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop()}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	tests := []struct {
+		value     string
+		wantToken string
+	}{
+		{cid + "ABCDEFGHIJKLM", cid},
+		{"xxxxxxxxxxxxxxxxxxxxabcdefghijklm", "xxxxxxxxxxxxxxxxxxxxabcdefghijklm"}, // no session
+		{cid + "abc", cid + "abc"}, // not a payload label
+	}
+	for _, tt := range tests {
+		e := &events.Event{Draft: &events.InteractionDraft{TokenValue: tt.value}}
+		if err := p.OnPreStore(context.Background(), e); err != nil {
+			t.Fatalf("OnPreStore(%s) failed: %v", tt.value, err)
+		}
+		if e.Draft.TokenValue != tt.wantToken {
+			t.Errorf("OnPreStore(%s): token %q, want %q", tt.value, e.Draft.TokenValue, tt.wantToken)
+		}
+		_, mapped := e.Draft.Attributes[Attribute]
+		if want := tt.wantToken != tt.value; mapped != want {
+			t.Errorf("OnPreStore(%s): attributes %v", tt.value, e.Draft.Attributes)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package overrides implements the core plugin that replaces the status code
+// and headers of the default HTTP response for individual tokens.
+package overrides
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/core/httpresponse"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "overrides"
+
+// Config is a token's status code and header overrides. The default response
+// body is kept, except for status codes that do not allow one.
+type Config struct {
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// Validate checks that c overrides something and can be written as an HTTP
+// response.
+func (c Config) Validate() error {
+	if c.Status == 0 && len(c.Headers) == 0 {
+		return errors.New("status or headers required")
+	}
+	if c.Status != 0 && (c.Status < 200 || c.Status > 599) {
+		return fmt.Errorf("invalid status %d: want 200-599", c.Status)
+	}
+	return httpresponse.ValidateHeaders(c.Headers)
+}
+
+// Plugin applies status code and header overrides to tokens' default HTTP
+// responses, e.g. a 401 with WWW-Authenticate or an empty 204. Tokens with a
+// redirect or custom response are answered by those plugins instead. Its
+// Priority runs it after them and immediately before defaultresponse.
+type Plugin struct {
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+}
+
+// New creates a new overrides Plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// IsCore returns true to identify this as a core plugin.
+func (p *Plugin) IsCore() bool { return true }
+
+// Priority adjusts the response just before defaultresponse answers it.
+func (p *Plugin) Priority() int { return 90 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.tokens = ctx.Tokens
+	return nil
+}
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnHTTPResponse applies the token's overrides without handling the
+// response, leaving the body to defaultresponse.
+func (p *Plugin) OnHTTPResponse(ctx context.Context, e *events.HTTPEvent) error {
+	if e.Resp == nil || e.Resp.Handled || e.Draft == nil || e.Draft.TokenID == 0 {
+		return nil
+	}
+
+	var cfg Config
+	ok, err := p.tokens.Get(ctx, e.Draft.TokenID, ID, &cfg)
+	if err != nil {
+		return fmt.Errorf("load overrides: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	if cfg.Status != 0 {
+		e.Resp.Status = cfg.Status
+	}
+	if e.Resp.Headers == nil {
+		e.Resp.Headers = make(map[string]string, len(cfg.Headers))
+	}
+	for k, v := range cfg.Headers {
+		e.Resp.Headers[http.CanonicalHeaderKey(k)] = v
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package overrides
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/core/defaultresponse"
+	"github.com/rsclarke/oastrix/internal/plugins/core/storage"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func setupTest(t *testing.T, cfg *Config) (*Plugin, int64) {
+	t.Helper()
+	database, err := db.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	tokenID, err := db.CreateToken(database, "overrides-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if cfg != nil {
+		if err := db.SetTokenPluginConfig(database, tokenID, ID, cfg); err != nil {
+			t.Fatalf("SetTokenPluginConfig failed: %v", err)
+		}
+	}
+
+	p := New()
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Tokens: storage.NewTokenConfig(db.NewSQLite(database))}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, tokenID
+}
+
+// respond runs the overrides and defaultresponse hooks in registration order.
+func respond(t *testing.T, p *Plugin, tokenID int64) *events.HTTPResponsePlan {
+	t.Helper()
+	e := &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{TokenID: tokenID}},
+		Resp:  &events.HTTPResponsePlan{Status: 200, Headers: make(map[string]string)},
+	}
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if e.Resp.Handled {
+		t.Fatal("overrides must not handle the response")
+	}
+	fallback := defaultresponse.New("")
+	_ = fallback.Init(plugins.InitContext{Logger: zap.NewNop()})
+	if err := fallback.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("defaultresponse failed: %v", err)
+	}
+	return e.Resp
+}
+
+func TestOverrides(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        *Config
+		wantStatus int
+		wantHeader string
+		wantBody   string
+	}{
+		{"none", nil, 200, "", "ok"},
+		{"status and header", &Config{Status: 401, Headers: map[string]string{"www-authenticate": `Basic realm="x"`}}, 401, `Basic realm="x"`, "ok"},
+		{"headers only", &Config{Headers: map[string]string{"WWW-Authenticate": "Bearer"}}, 200, "Bearer", "ok"},
+		{"no content", &Config{Status: 204}, 204, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, tokenID := setupTest(t, tt.cfg)
+			resp := respond(t, p, tokenID)
+			if resp.Status != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", resp.Status, tt.wantStatus)
+			}
+			if got := resp.Headers["Www-Authenticate"]; got != tt.wantHeader {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantHeader)
+			}
+			if string(resp.Body) != tt.wantBody {
+				t.Errorf("Body = %q, want %q", resp.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"status", Config{Status: 500}, false},
+		{"headers", Config{Headers: map[string]string{"X-Test": "1"}}, false},
+		{"empty", Config{}, true},
+		{"informational", Config{Status: 101}, true},
+		{"bad header", Config{Headers: map[string]string{"X-Test": "a\nb"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+// Package quota implements the core plugin that caps how many interactions a
+// token may record.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "quota"
+
+// OverflowAttribute counts the interactions coalesced into the newest stored
+// interaction once a token's quota is reached.
+const OverflowAttribute = "quota_overflow"
+
+// Policy controls what happens to interactions beyond a token's quota.
+type Policy string
+
+// Overflow policies.
+const (
+	PolicyDrop       Policy = "drop"        // discard further interactions
+	PolicyCoalesce   Policy = "coalesce"    // discard them, counting them on the newest stored interaction
+	PolicyKeepNewest Policy = "keep_newest" // store them, deleting the oldest beyond Max
+)
+
+// Config is a token's quota. Without a Window, Max caps the total number of
+// stored interactions; with one, it caps interactions per rolling window.
+type Config struct {
+	Max    int    `json:"max"`
+	Window string `json:"window,omitempty"` // Go duration, e.g. "1m"
+	Policy Policy `json:"policy"`
+}
+
+// Validate checks that c is a usable quota.
+func (c Config) Validate() error {
+	if c.Max < 1 {
+		return errors.New("max must be at least 1")
+	}
+	switch c.Policy {
+	case PolicyDrop, PolicyCoalesce:
+	case PolicyKeepNewest:
+		if c.Window != "" {
+			return errors.New("keep_newest cannot be combined with a window")
+		}
+	default:
+		return fmt.Errorf("invalid policy %q: want drop, coalesce or keep_newest", c.Policy)
+	}
+	if c.Window != "" {
+		if d, err := time.ParseDuration(c.Window); err != nil || d < time.Second {
+			return fmt.Errorf("invalid window %q: want a duration of at least 1s", c.Window)
+		}
+	}
+	return nil
+}
+
+// window returns the rolling window, or zero when the quota is a total.
+func (c Config) window() time.Duration {
+	d, _ := time.ParseDuration(c.Window)
+	return d
+}
+
+// Plugin enforces per-token interaction quotas. Its Priority runs it after
+// the storage plugin so that token IDs are resolved before OnPreStore runs.
+type Plugin struct {
+	store  db.Store
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// New creates a new quota Plugin backed by store.
+func New(store db.Store) *Plugin {
+	return &Plugin{store: store, now: time.Now}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// IsCore returns true to identify this as a core plugin.
+func (p *Plugin) IsCore() bool { return true }
+
+// Priority places quota checks straight after the storage plugin.
+func (p *Plugin) Priority() int { return 10 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	return nil
+}
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnPreStore drops or coalesces interactions for tokens that have reached a
+// drop or coalesce quota.
+func (p *Plugin) OnPreStore(_ context.Context, e *events.Event) error {
+	if e.Draft.Drop || e.Draft.TokenID == 0 {
+		return nil
+	}
+
+	cfg, ok, err := p.config(e.Draft.TokenID)
+	if err != nil || !ok || cfg.Policy == PolicyKeepNewest {
+		return err
+	}
+
+	var since int64
+	if w := cfg.window(); w > 0 {
+		since = p.now().Add(-w).Unix()
+	}
+	n, err := p.store.CountInteractions(e.Draft.TokenID, since)
+	if err != nil {
+		return fmt.Errorf("count interactions: %w", err)
+	}
+	if n < cfg.Max {
+		return nil
+	}
+
+	e.Draft.Drop = true
+	if cfg.Policy != PolicyCoalesce {
+		return nil
+	}
+	latest, err := p.store.LatestInteractionID(e.Draft.TokenID)
+	if err != nil || latest == 0 {
+		return err
+	}
+	return p.store.IncrementAttribute(latest, OverflowAttribute)
+}
+
+// OnPostStore trims tokens with a keep_newest quota back to their newest Max
+// interactions.
+func (p *Plugin) OnPostStore(_ context.Context, e *events.Event) error {
+	if e.InteractionID == 0 {
+		return nil
+	}
+
+	cfg, ok, err := p.config(e.Draft.TokenID)
+	if err != nil || !ok || cfg.Policy != PolicyKeepNewest {
+		return err
+	}
+
+	if _, err := p.store.TrimInteractions(e.Draft.TokenID, cfg.Max); err != nil {
+		return fmt.Errorf("trim interactions: %w", err)
+	}
+	return nil
+}
+
+func (p *Plugin) config(tokenID int64) (Config, bool, error) {
+	var cfg Config
+	ok, err := p.store.GetTokenPluginConfig(tokenID, ID, &cfg)
+	if err != nil {
+		return cfg, false, fmt.Errorf("load quota: %w", err)
+	}
+	return cfg, ok, nil
+}
@@ -0,0 +1,186 @@
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func setupTest(t *testing.T, cfg *Config) (*Plugin, *sql.DB, int64) {
+	t.Helper()
+	database, err := db.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	tokenID, err := db.CreateToken(database, "quota-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if cfg != nil {
+		if err := db.SetTokenPluginConfig(database, tokenID, ID, cfg); err != nil {
+			t.Fatalf("SetTokenPluginConfig failed: %v", err)
+		}
+	}
+
+	p := New(db.NewSQLite(database))
+	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+	return p, database, tokenID
+}
+
+// record runs an interaction through the plugin's hooks the way the pipeline
+// does, returning the stored interaction ID or zero if it was dropped.
+func record(t *testing.T, p *Plugin, database *sql.DB, tokenID int64) int64 {
+	t.Helper()
+	e := &events.Event{Draft: &events.InteractionDraft{TokenID: tokenID}}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if !e.Draft.Drop {
+		id, err := db.CreateInteraction(database, tokenID, "dns", "192.0.2.1", 53, false, "test")
+		if err != nil {
+			t.Fatalf("CreateInteraction failed: %v", err)
+		}
+		e.InteractionID = id
+	}
+	if err := p.OnPostStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPostStore failed: %v", err)
+	}
+	return e.InteractionID
+}
+
+func count(t *testing.T, database *sql.DB, tokenID int64) int {
+	t.Helper()
+	n, err := db.CountInteractions(database, tokenID, 0)
+	if err != nil {
+		t.Fatalf("CountInteractions failed: %v", err)
+	}
+	return n
+}
+
+func TestNoQuota(t *testing.T) {
+	p, database, tokenID := setupTest(t, nil)
+	for range 5 {
+		record(t, p, database, tokenID)
+	}
+	if n := count(t, database, tokenID); n != 5 {
+		t.Errorf("stored %d interactions, want 5", n)
+	}
+}
+
+func TestPolicyDrop(t *testing.T) {
+	p, database, tokenID := setupTest(t, &Config{Max: 2, Policy: PolicyDrop})
+	for range 5 {
+		record(t, p, database, tokenID)
+	}
+	if n := count(t, database, tokenID); n != 2 {
+		t.Errorf("stored %d interactions, want 2", n)
+	}
+}
+
+func TestPolicyCoalesce(t *testing.T) {
+	p, database, tokenID := setupTest(t, &Config{Max: 2, Policy: PolicyCoalesce})
+	var last int64
+	for range 5 {
+		if id := record(t, p, database, tokenID); id != 0 {
+			last = id
+		}
+	}
+	if n := count(t, database, tokenID); n != 2 {
+		t.Errorf("stored %d interactions, want 2", n)
+	}
+
+	attrs, err := db.GetAttributes(database, last)
+	if err != nil {
+		t.Fatalf("GetAttributes failed: %v", err)
+	}
+	if got, ok := attrs[OverflowAttribute].(float64); !ok || got != 3 {
+		t.Errorf("%s = %v, want 3", OverflowAttribute, attrs[OverflowAttribute])
+	}
+}
+
+func TestPolicyKeepNewest(t *testing.T) {
+	p, database, tokenID := setupTest(t, &Config{Max: 2, Policy: PolicyKeepNewest})
+	var ids []int64
+	for range 5 {
+		ids = append(ids, record(t, p, database, tokenID))
+	}
+
+	interactions, err := db.GetInteractionsByToken(database, tokenID)
+	if err != nil {
+		t.Fatalf("GetInteractionsByToken failed: %v", err)
+	}
+	if len(interactions) != 2 {
+		t.Fatalf("stored %d interactions, want 2", len(interactions))
+	}
+	for _, i := range interactions {
+		if i.ID != ids[3] && i.ID != ids[4] {
+			t.Errorf("kept interaction %d, want only the newest %v", i.ID, ids[3:])
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	p, database, tokenID := setupTest(t, &Config{Max: 2, Window: "1m", Policy: PolicyDrop})
+	for range 3 {
+		record(t, p, database, tokenID)
+	}
+	if n := count(t, database, tokenID); n != 2 {
+		t.Fatalf("stored %d interactions, want 2", n)
+	}
+
+	// Once the window has moved past the earlier interactions, new ones are
+	// stored again.
+	p.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	record(t, p, database, tokenID)
+	if n := count(t, database, tokenID); n != 3 {
+		t.Errorf("stored %d interactions after window elapsed, want 3", n)
+	}
+}
+
+func TestSkipsDroppedAndUnresolved(t *testing.T) {
+	p, _, tokenID := setupTest(t, &Config{Max: 1, Policy: PolicyDrop})
+
+	e := &events.Event{Draft: &events.InteractionDraft{}}
+	if err := p.OnPreStore(context.Background(), e); err != nil || e.Draft.Drop {
+		t.Errorf("unresolved token: drop = %v, err = %v", e.Draft.Drop, err)
+	}
+
+	e = &events.Event{Draft: &events.InteractionDraft{TokenID: tokenID, Drop: true}}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Errorf("already dropped: %v", err)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"drop", Config{Max: 10, Policy: PolicyDrop}, false},
+		{"coalesce per minute", Config{Max: 10, Window: "1m", Policy: PolicyCoalesce}, false},
+		{"keep newest", Config{Max: 10, Policy: PolicyKeepNewest}, false},
+		{"zero max", Config{Max: 0, Policy: PolicyDrop}, true},
+		{"unknown policy", Config{Max: 10, Policy: "ignore"}, true},
+		{"keep newest with window", Config{Max: 10, Window: "1m", Policy: PolicyKeepNewest}, true},
+		{"bad window", Config{Max: 10, Window: "soon", Policy: PolicyDrop}, true},
+		{"tiny window", Config{Max: 10, Window: "10ms", Policy: PolicyDrop}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
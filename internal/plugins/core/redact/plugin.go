@@ -0,0 +1,226 @@
+// Package redact implements the core plugin that replaces sensitive values
+// captured with interactions, such as credentials in headers, query
+// parameters and bodies, with keyed hashes.
+package redact
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"maps"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier.
+const ID = "redact"
+
+// Prefix starts every replacement, so redacted values are recognisable.
+const Prefix = "redacted:"
+
+// Rules select the values to redact.
+type Rules struct {
+	Headers []string         // HTTP header names, ignoring case
+	Query   []string         // HTTP query parameter names, ignoring case
+	Body    []*regexp.Regexp // matches in HTTP bodies, raw captures and parsed protocol fields; only capture groups are replaced when a regexp has any
+}
+
+// Empty reports whether r redacts nothing.
+func (r Rules) Empty() bool {
+	return len(r.Headers) == 0 && len(r.Query) == 0 && len(r.Body) == 0
+}
+
+// Plugin redacts interactions before they are forwarded by PostStore hooks,
+// e.g. to syslog, Splunk or notifications, and, when Storage is set, before
+// they are stored. Each value is replaced by Prefix and a truncated HMAC of
+// it, so repeated values can still be matched up without being revealed.
+type Plugin struct {
+	// Storage redacts interactions in the last PreStore hook, so they are
+	// stored redacted. Otherwise they are redacted in the first PostStore
+	// hook, after storage.
+	Storage bool
+
+	rules   Rules
+	key     []byte
+	headers map[string]bool
+	query   map[string]bool
+	logger  *zap.Logger
+}
+
+// New creates a new redact Plugin applying rules. Values are hashed with a
+// key derived from secret, e.g. the server's pepper.
+func New(rules Rules, secret []byte) *Plugin {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("oastrix redaction"))
+	p := &Plugin{
+		rules:   rules,
+		key:     mac.Sum(nil),
+		headers: make(map[string]bool),
+		query:   make(map[string]bool),
+	}
+	for _, h := range rules.Headers {
+		p.headers[strings.ToLower(h)] = true
+	}
+	for _, q := range rules.Query {
+		p.query[strings.ToLower(q)] = true
+	}
+	return p
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// IsCore returns true so the circuit breaker never skips redaction.
+func (p *Plugin) IsCore() bool { return true }
+
+// Priority runs the PreStore hook after every enrichment plugin, which may
+// need the original values, when redacting before storage, and the
+// PostStore hook before any forwarder otherwise.
+func (p *Plugin) Priority() int {
+	if p.Storage {
+		return 500
+	}
+	return -100
+}
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	return nil
+}
+
+// OnPreStore redacts the interaction when redacting before storage.
+func (p *Plugin) OnPreStore(_ context.Context, e *events.Event) error {
+	if p.Storage && !e.Draft.Drop {
+		e.Draft = p.Redact(e.Draft)
+	}
+	return nil
+}
+
+// OnPostStore redacts the interaction before it is forwarded.
+func (p *Plugin) OnPostStore(_ context.Context, e *events.Event) error {
+	if !p.Storage {
+		e.Draft = p.Redact(e.Draft)
+	}
+	return nil
+}
+
+// Redact returns a copy of d with the values selected by the rules
+// replaced. d itself is left unchanged.
+func (p *Plugin) Redact(d *events.InteractionDraft) *events.InteractionDraft {
+	out := *d
+	if d.HTTP != nil {
+		h := *d.HTTP
+		h.Headers = p.redactHeaders(h.Headers)
+		h.Query = p.redactQuery(h.Query)
+		h.Body = p.redactBody(h.Body)
+		out.HTTP = &h
+	}
+	if d.Protocol != nil && len(p.rules.Body) > 0 {
+		pd := *d.Protocol
+		pd.Raw = p.redactBody(pd.Raw)
+		if pd.Fields != nil {
+			pd.Fields = maps.Clone(pd.Fields)
+			for k, v := range pd.Fields {
+				if s, ok := v.(string); ok {
+					pd.Fields[k] = string(p.redactBody([]byte(s)))
+				}
+			}
+		}
+		out.Protocol = &pd
+	}
+	return &out
+}
+
+func (p *Plugin) redactHeaders(headers map[string][]string) map[string][]string {
+	if len(p.headers) == 0 || headers == nil {
+		return headers
+	}
+	out := make(map[string][]string, len(headers))
+	for k, vs := range headers {
+		if p.headers[strings.ToLower(k)] {
+			redacted := make([]string, len(vs))
+			for i, v := range vs {
+				redacted[i] = p.hash([]byte(v))
+			}
+			vs = redacted
+		}
+		out[k] = vs
+	}
+	return out
+}
+
+// redactQuery replaces the values of selected parameters, leaving the rest of
+// the query, including its order and encoding, as sent.
+func (p *Plugin) redactQuery(query string) string {
+	if len(p.query) == 0 || query == "" {
+		return query
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		k, v, ok := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(k)
+		if err != nil {
+			name = k
+		}
+		if !ok || !p.query[strings.ToLower(name)] {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(v); err == nil {
+			v = unescaped
+		}
+		params[i] = k + "=" + p.hash([]byte(v))
+	}
+	return strings.Join(params, "&")
+}
+
+func (p *Plugin) redactBody(body []byte) []byte {
+	for _, re := range p.rules.Body {
+		body = p.replace(re, body)
+	}
+	return body
+}
+
+// replace redacts the matches of re in b, or just their capture groups when
+// re has any.
+func (p *Plugin) replace(re *regexp.Regexp, b []byte) []byte {
+	matches := re.FindAllSubmatchIndex(b, -1)
+	if matches == nil {
+		return b
+	}
+	var out bytes.Buffer
+	last := 0
+	for _, m := range matches {
+		spans := [][2]int{{m[0], m[1]}}
+		if re.NumSubexp() > 0 {
+			spans = spans[:0]
+			for g := 1; g <= re.NumSubexp(); g++ {
+				if start := m[2*g]; start >= last {
+					spans = append(spans, [2]int{start, m[2*g+1]})
+				}
+			}
+		}
+		for _, s := range spans {
+			out.Write(b[last:s[0]])
+			out.WriteString(p.hash(b[s[0]:s[1]]))
+			last = s[1]
+		}
+	}
+	out.Write(b[last:])
+	return out.Bytes()
+}
+
+// hash returns the replacement of a value.
+func (p *Plugin) hash(v []byte) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(v)
+	return Prefix + hex.EncodeToString(mac.Sum(nil))[:16]
+}
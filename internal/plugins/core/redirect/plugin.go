@@ -0,0 +1,126 @@
+// Package redirect implements the core plugin that answers HTTP interactions
+// for individual tokens with a redirect.
+package redirect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "redirect"
+
+// Config is a token's redirect. URL may use any scheme and port, e.g.
+// gopher://127.0.0.1:6379/_ for SSRF pivots. With AppendPath, the request's
+// path and query are appended to URL.
+type Config struct {
+	URL        string `json:"url"`
+	Status     int    `json:"status,omitempty"` // 301, 302, 303, 307 or 308; defaults to 302
+	AppendPath bool   `json:"append_path,omitempty"`
+}
+
+// Validate checks that c is a usable redirect.
+func (c Config) Validate() error {
+	switch c.Status {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return fmt.Errorf("invalid status %d: want 301, 302, 303, 307 or 308", c.Status)
+	}
+	if strings.ContainsAny(c.URL, "\r\n\x00") {
+		return errors.New("url contains control characters")
+	}
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme == "" {
+		return errors.New("url must be absolute")
+	}
+	return nil
+}
+
+// location returns the Location header for the request h.
+func (c Config) location(h *events.HTTPDraft) string {
+	if !c.AppendPath || h == nil {
+		return c.URL
+	}
+	loc := strings.TrimSuffix(c.URL, "/") + h.Path
+	if h.Query != "" {
+		loc += "?" + h.Query
+	}
+	return loc
+}
+
+// Plugin redirects HTTP interactions for tokens with a configured redirect.
+// The interaction is recorded as usual. Its Priority runs it after the
+// storage plugin and before defaultresponse.
+type Plugin struct {
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+}
+
+// New creates a new redirect Plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// IsCore returns true to identify this as a core plugin.
+func (p *Plugin) IsCore() bool { return true }
+
+// Priority places redirects ahead of a token's configured response.
+func (p *Plugin) Priority() int { return 70 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.tokens = ctx.Tokens
+	return nil
+}
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnHTTPResponse answers with the token's redirect, if any.
+func (p *Plugin) OnHTTPResponse(ctx context.Context, e *events.HTTPEvent) error {
+	if e.Resp == nil || e.Resp.Handled || e.Draft == nil || e.Draft.TokenID == 0 {
+		return nil
+	}
+
+	var cfg Config
+	ok, err := p.tokens.Get(ctx, e.Draft.TokenID, ID, &cfg)
+	if err != nil {
+		return fmt.Errorf("load redirect: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+
+	e.Resp.Status = cfg.Status
+	if e.Resp.Status == 0 {
+		e.Resp.Status = http.StatusFound
+	}
+	if e.Resp.Headers == nil {
+		e.Resp.Headers = make(map[string]string)
+	}
+	e.Resp.Headers["Location"] = cfg.location(e.Draft.HTTP)
+	e.Resp.Body = nil
+	e.Resp.Handled = true
+	return nil
+}
@@ -0,0 +1,123 @@
+package redirect
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/core/storage"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func setupTest(t *testing.T, cfg *Config) (*Plugin, int64) {
+	t.Helper()
+	database, err := db.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	tokenID, err := db.CreateToken(database, "redirect-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if cfg != nil {
+		if err := db.SetTokenPluginConfig(database, tokenID, ID, cfg); err != nil {
+			t.Fatalf("SetTokenPluginConfig failed: %v", err)
+		}
+	}
+
+	p := New()
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Tokens: storage.NewTokenConfig(db.NewSQLite(database))}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, tokenID
+}
+
+func newEvent(tokenID int64) *events.HTTPEvent {
+	return &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{
+			TokenID: tokenID,
+			HTTP:    &events.HTTPDraft{Path: "/a/b", Query: "x=1"},
+		}},
+		Resp: &events.HTTPResponsePlan{Status: 200, Headers: make(map[string]string), Body: []byte("ok")},
+	}
+}
+
+func TestOnHTTPResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        Config
+		wantStatus int
+		wantLoc    string
+	}{
+		{"default status", Config{URL: "http://169.254.169.254/latest/meta-data/"}, 302, "http://169.254.169.254/latest/meta-data/"},
+		{"scheme change", Config{URL: "gopher://127.0.0.1:6379/_INFO", Status: 307}, 307, "gopher://127.0.0.1:6379/_INFO"},
+		{"append path", Config{URL: "https://example.com:8443/", Status: 301, AppendPath: true}, 301, "https://example.com:8443/a/b?x=1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, tokenID := setupTest(t, &tt.cfg)
+			e := newEvent(tokenID)
+			if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+				t.Fatalf("OnHTTPResponse failed: %v", err)
+			}
+			if !e.Resp.Handled {
+				t.Fatal("expected response to be handled")
+			}
+			if e.Resp.Status != tt.wantStatus {
+				t.Errorf("Status = %d, want %d", e.Resp.Status, tt.wantStatus)
+			}
+			if got := e.Resp.Headers["Location"]; got != tt.wantLoc {
+				t.Errorf("Location = %q, want %q", got, tt.wantLoc)
+			}
+			if len(e.Resp.Body) != 0 {
+				t.Errorf("Body = %q, want empty", e.Resp.Body)
+			}
+		})
+	}
+}
+
+func TestOnHTTPResponseNotConfigured(t *testing.T) {
+	p, tokenID := setupTest(t, nil)
+	e := newEvent(tokenID)
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if e.Resp.Handled || e.Resp.Status != 200 {
+		t.Errorf("response changed: %+v", e.Resp)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"http", Config{URL: "http://example.com/"}, false},
+		{"gopher with port", Config{URL: "gopher://127.0.0.1:11211/_stats", Status: 308}, false},
+		{"relative", Config{URL: "/somewhere"}, true},
+		{"empty", Config{}, true},
+		{"bad status", Config{URL: "http://example.com/", Status: 200}, true},
+		{"header injection", Config{URL: "http://example.com/\r\nSet-Cookie: a=b"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInitRequiresTokenConfig(t *testing.T) {
+	if err := New().Init(plugins.InitContext{Logger: zap.NewNop()}); err == nil {
+		t.Error("Init succeeded without a token config view")
+	}
+}
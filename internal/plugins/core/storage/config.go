@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/rsclarke/oastrix/internal/db"
+)
+
+// GlobalConfig is a plugins.GlobalConfigView backed by the plugin_config
+// table, keyed by plugin ID.
+type GlobalConfig struct {
+	store db.ConfigStore
+}
+
+// NewGlobalConfig creates a GlobalConfig reading from store.
+func NewGlobalConfig(store db.ConfigStore) *GlobalConfig {
+	return &GlobalConfig{store: store}
+}
+
+// Get decodes the configuration stored for plugin ID key into out, leaving
+// out unchanged when none is stored.
+func (c *GlobalConfig) Get(key string, out any) error {
+	_, err := c.store.GetPluginConfig(key, out)
+	return err
+}
+
+// TokenConfig is a plugins.TokenConfigView backed by the token_plugin_config
+// table.
+type TokenConfig struct {
+	store db.ConfigStore
+}
+
+// NewTokenConfig creates a TokenConfig reading from store.
+func NewTokenConfig(store db.ConfigStore) *TokenConfig {
+	return &TokenConfig{store: store}
+}
+
+// Get decodes the configuration stored for pluginID on the token into out,
+// reporting whether there is one.
+func (c *TokenConfig) Get(_ context.Context, tokenID int64, pluginID string, out any) (bool, error) {
+	return c.store.GetTokenPluginConfig(tokenID, pluginID, out)
+}
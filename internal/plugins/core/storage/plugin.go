@@ -1,28 +1,68 @@
-// Package storage implements the storage core plugin that persists interactions to SQLite.
+// Package storage implements the storage core plugin that persists interactions to a db.Store.
 package storage
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/rsclarke/oastrix/internal/db"
-	"github.com/rsclarke/oastrix/internal/events"
 	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/models"
 )
 
-// Plugin is the storage core plugin that persists interactions to SQLite.
+// TokenPolicy controls what happens to interactions with a token that is
+// expired or disabled.
+type TokenPolicy string
+
+// Token policies.
+const (
+	PolicyDrop   TokenPolicy = "drop"   // discard the interaction
+	PolicyRecord TokenPolicy = "record" // store it with a marker attribute
+)
+
+// ParseTokenPolicy validates a token policy name.
+func ParseTokenPolicy(s string) (TokenPolicy, error) {
+	switch p := TokenPolicy(s); p {
+	case PolicyDrop, PolicyRecord:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid token policy %q: want drop or record", s)
+	}
+}
+
+// Plugin is the storage core plugin that persists interactions to a db.Store.
 type Plugin struct {
-	db     *sql.DB
+	// ExpiredTokens is the policy for interactions with expired tokens,
+	// recorded with the "token_expired" attribute. The zero value drops them.
+	ExpiredTokens TokenPolicy
+
+	// DisabledTokens is the policy for interactions with disabled tokens,
+	// recorded with the "while_disabled" attribute. The zero value drops them.
+	DisabledTokens TokenPolicy
+
+	// RecordStrays, when set, records interactions whose token does not
+	// exist as stray interactions rather than discarding them.
+	RecordStrays bool
+
+	// RedactStrays, if set, returns the copy of a stray interaction to
+	// record. Strays are recorded before later PreStore hooks, such as
+	// redaction, run on them.
+	RedactStrays func(*events.InteractionDraft) *events.InteractionDraft
+
+	store  db.Store
 	logger *zap.Logger
+	now    func() time.Time
 }
 
-// New creates a new storage Plugin with the given database connection.
-func New(database *sql.DB) *Plugin {
-	return &Plugin{db: database}
+// New creates a new storage Plugin persisting to store.
+func New(store db.Store) *Plugin {
+	return &Plugin{store: store, now: time.Now}
 }
 
 // ID returns the plugin identifier.
@@ -31,13 +71,18 @@ func (p *Plugin) ID() string { return "storage" }
 // IsCore returns true to identify this as a core plugin.
 func (p *Plugin) IsCore() bool { return true }
 
+// Priority returns 0 so token IDs are resolved before any other hook runs.
+func (p *Plugin) Priority() int { return 0 }
+
 // Init initializes the plugin with the given context.
 func (p *Plugin) Init(ctx plugins.InitContext) error {
 	p.logger = ctx.Logger.Named("storage")
 	return nil
 }
 
-// OnPreStore resolves the token value to a token ID if not already set.
+// OnPreStore resolves the token value, or one of its aliases, to a token ID if
+// not already set, applying the expired and disabled token policies. Hits on
+// an alias are recorded with the "token_alias" attribute.
 func (p *Plugin) OnPreStore(ctx context.Context, e *events.Event) error {
 	if e.Draft.TokenID != 0 {
 		return nil
@@ -46,19 +91,47 @@ func (p *Plugin) OnPreStore(ctx context.Context, e *events.Event) error {
 		return nil
 	}
 
-	token, err := db.GetTokenByValue(p.db, e.Draft.TokenValue)
+	token, err := p.store.ResolveToken(e.Draft.TokenValue)
 	if err != nil {
 		return fmt.Errorf("resolve token: %w", err)
 	}
-	if token != nil {
-		e.Draft.TokenID = token.ID
+	if token == nil {
+		return nil
+	}
+	if alias := strings.ToLower(e.Draft.TokenValue); alias != token.Token {
+		if e.Draft.Attributes == nil {
+			e.Draft.Attributes = make(map[string]any)
+		}
+		e.Draft.Attributes["token_alias"] = alias
+	}
+
+	if token.Expired(p.now().Unix()) && !applyPolicy(e, p.ExpiredTokens, "token_expired") {
+		return nil
+	}
+	if !token.Enabled && !applyPolicy(e, p.DisabledTokens, "while_disabled") {
+		return nil
 	}
+	e.Draft.TokenID = token.ID
 	return nil
 }
 
-// ResolveTokenID looks up a token by its value and returns the ID.
+// applyPolicy drops the event or marks it with attr according to policy. It
+// reports whether the event should still be stored.
+func applyPolicy(e *events.Event, policy TokenPolicy, attr string) bool {
+	if policy != PolicyRecord {
+		e.Draft.Drop = true
+		return false
+	}
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes[attr] = true
+	return true
+}
+
+// ResolveTokenID looks up a token by its value or an alias and returns the ID.
 func (p *Plugin) ResolveTokenID(_ context.Context, tokenValue string) (int64, bool, error) {
-	token, err := db.GetTokenByValue(p.db, tokenValue)
+	token, err := p.store.ResolveToken(tokenValue)
 	if err != nil {
 		return 0, false, err
 	}
@@ -68,14 +141,31 @@ func (p *Plugin) ResolveTokenID(_ context.Context, tokenValue string) (int64, bo
 	return token.ID, true, nil
 }
 
+// TokenTags returns the tags of a token.
+func (p *Plugin) TokenTags(_ context.Context, tokenID int64) ([]string, error) {
+	return p.store.GetTokenTags(tokenID)
+}
+
 // CreateInteraction persists an interaction draft to the database and returns the interaction ID.
-func (p *Plugin) CreateInteraction(_ context.Context, draft *events.InteractionDraft) (int64, error) {
+func (p *Plugin) CreateInteraction(ctx context.Context, draft *events.InteractionDraft) (int64, error) {
 	if draft.TokenID == 0 {
+		if p.RecordStrays && draft.TokenValue != "" {
+			return 0, p.RecordStray(ctx, draft)
+		}
 		return 0, nil
 	}
+	var id int64
+	err := p.store.Write(ctx, func(w db.Writer) error {
+		var err error
+		id, err = createInteraction(w, draft)
+		return err
+	})
+	return id, err
+}
 
-	id, err := db.CreateInteraction(
-		p.db,
+// createInteraction inserts draft and its protocol details.
+func createInteraction(w db.Writer, draft *events.InteractionDraft) (int64, error) {
+	id, err := w.CreateInteraction(
 		draft.TokenID,
 		string(draft.Kind),
 		draft.RemoteIP,
@@ -94,8 +184,7 @@ func (p *Plugin) CreateInteraction(_ context.Context, draft *events.InteractionD
 			if err != nil {
 				return 0, fmt.Errorf("marshal headers: %w", err)
 			}
-			err = db.CreateHTTPInteraction(
-				p.db,
+			err = w.CreateHTTPInteraction(
 				id,
 				draft.HTTP.Method,
 				draft.HTTP.Scheme,
@@ -112,8 +201,7 @@ func (p *Plugin) CreateInteraction(_ context.Context, draft *events.InteractionD
 		}
 	case events.KindDNS:
 		if draft.DNS != nil {
-			err = db.CreateDNSInteraction(
-				p.db,
+			err = w.CreateDNSInteraction(
 				id,
 				draft.DNS.QName,
 				draft.DNS.QType,
@@ -127,12 +215,65 @@ func (p *Plugin) CreateInteraction(_ context.Context, draft *events.InteractionD
 				return 0, fmt.Errorf("create dns interaction: %w", err)
 			}
 		}
+	default:
+		if draft.Protocol != nil {
+			fields, err := json.Marshal(draft.Protocol.Fields)
+			if err != nil {
+				return 0, fmt.Errorf("marshal fields: %w", err)
+			}
+			err = w.CreateProtocolInteraction(id, draft.Protocol.Raw, string(fields))
+			if err != nil {
+				return 0, fmt.Errorf("create protocol interaction: %w", err)
+			}
+		}
 	}
 
 	return id, nil
 }
 
 // SaveAttributes persists plugin attributes for an interaction.
-func (p *Plugin) SaveAttributes(_ context.Context, interactionID int64, attrs map[string]any) error {
-	return db.SaveAttributes(p.db, interactionID, attrs)
+func (p *Plugin) SaveAttributes(ctx context.Context, interactionID int64, attrs map[string]any) error {
+	if len(attrs) == 0 {
+		return nil
+	}
+	return p.store.Write(ctx, func(w db.Writer) error {
+		return w.SaveAttributes(interactionID, attrs)
+	})
+}
+
+// GetInteractionsByToken returns a token's most recent interactions first,
+// at most limit of them unless limit is zero.
+func (p *Plugin) GetInteractionsByToken(_ context.Context, tokenID int64, limit int) ([]models.Interaction, error) {
+	return p.store.ListInteractions(tokenID, db.InteractionFilter{Limit: limit})
+}
+
+// GetAttributes returns the plugin attributes saved for an interaction.
+func (p *Plugin) GetAttributes(_ context.Context, interactionID int64) (map[string]any, error) {
+	return p.store.GetAttributes(interactionID)
+}
+
+// SaveHTTPResponse records the HTTP response sent for an interaction.
+func (p *Plugin) SaveHTTPResponse(ctx context.Context, interactionID int64, resp *events.HTTPResponsePlan) error {
+	headers, err := json.Marshal(resp.Headers)
+	if err != nil {
+		return fmt.Errorf("marshal response headers: %w", err)
+	}
+	return p.store.Write(ctx, func(w db.Writer) error {
+		return w.SetHTTPResponse(interactionID, resp.Status, string(headers), resp.Body)
+	})
+}
+
+// SaveDNSResponse records the DNS response sent for an interaction.
+func (p *Plugin) SaveDNSResponse(ctx context.Context, interactionID int64, resp *events.DNSResponsePlan) error {
+	answers := make([]string, 0, len(resp.Answers))
+	for _, rr := range resp.Answers {
+		answers = append(answers, rr.String())
+	}
+	encoded, err := json.Marshal(answers)
+	if err != nil {
+		return fmt.Errorf("marshal response answers: %w", err)
+	}
+	return p.store.Write(ctx, func(w db.Writer) error {
+		return w.SetDNSResponse(interactionID, resp.RCode, string(encoded))
+	})
 }
@@ -3,13 +3,17 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/miekg/dns"
 	"go.uber.org/zap"
 
 	"github.com/rsclarke/oastrix/internal/db"
-	"github.com/rsclarke/oastrix/internal/events"
 	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
 )
 
 func setupTestDB(t *testing.T) *sql.DB {
@@ -44,10 +48,10 @@ func TestPluginInit(t *testing.T) {
 
 func TestOnPreStoreResolvesToken(t *testing.T) {
 	database := setupTestDB(t)
-	p := New(database)
+	p := New(db.NewSQLite(database))
 	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
 
-	tokenID, err := db.CreateToken(database, "test-token", nil, nil)
+	tokenID, err := db.CreateToken(database, "test-token", nil, nil, nil)
 	if err != nil {
 		t.Fatalf("CreateToken failed: %v", err)
 	}
@@ -70,7 +74,7 @@ func TestOnPreStoreResolvesToken(t *testing.T) {
 
 func TestOnPreStoreSkipsWhenTokenIDSet(t *testing.T) {
 	database := setupTestDB(t)
-	p := New(database)
+	p := New(db.NewSQLite(database))
 	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
 
 	e := &events.Event{
@@ -112,7 +116,7 @@ func TestOnPreStoreSkipsEmptyTokenValue(t *testing.T) {
 
 func TestOnPreStoreUnknownToken(t *testing.T) {
 	database := setupTestDB(t)
-	p := New(database)
+	p := New(db.NewSQLite(database))
 	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
 
 	e := &events.Event{
@@ -133,10 +137,10 @@ func TestOnPreStoreUnknownToken(t *testing.T) {
 
 func TestResolveTokenID(t *testing.T) {
 	database := setupTestDB(t)
-	p := New(database)
+	p := New(db.NewSQLite(database))
 	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
 
-	tokenID, err := db.CreateToken(database, "test-token", nil, nil)
+	tokenID, err := db.CreateToken(database, "test-token", nil, nil, nil)
 	if err != nil {
 		t.Fatalf("CreateToken failed: %v", err)
 	}
@@ -166,7 +170,7 @@ func TestResolveTokenID(t *testing.T) {
 
 func TestCreateInteractionSkipsZeroTokenID(t *testing.T) {
 	database := setupTestDB(t)
-	p := New(database)
+	p := New(db.NewSQLite(database))
 	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
 
 	draft := &events.InteractionDraft{
@@ -187,12 +191,72 @@ func TestCreateInteractionSkipsZeroTokenID(t *testing.T) {
 	}
 }
 
+func TestCreateInteractionRecordsStrays(t *testing.T) {
+	database := setupTestDB(t)
+	p := New(db.NewSQLite(database))
+	p.RecordStrays = true
+	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+
+	draft := &events.InteractionDraft{
+		TokenValue: "no-such-token",
+		Kind:       events.KindHTTP,
+		RemoteIP:   "192.168.1.1",
+		RemotePort: 54321,
+		Summary:    "POST /login HTTP/1.1",
+		HTTP: &events.HTTPDraft{
+			Method:  "POST",
+			Host:    "no-such-token.example.com",
+			Path:    "/login",
+			Headers: map[string][]string{"User-Agent": {"scanner"}},
+			Body:    make([]byte, StrayBodySize+1),
+		},
+	}
+	id, err := p.CreateInteraction(context.Background(), draft)
+	if err != nil || id != 0 {
+		t.Fatalf("CreateInteraction = %d, %v; want 0, nil", id, err)
+	}
+
+	strays, err := db.ListStrayInteractions(database, db.StrayFilter{})
+	if err != nil {
+		t.Fatalf("ListStrayInteractions failed: %v", err)
+	}
+	if len(strays) != 1 {
+		t.Fatalf("got %d stray interactions, want 1", len(strays))
+	}
+	got := strays[0]
+	if got.Token == nil || *got.Token != "no-such-token" || got.Kind != "http" || got.Summary != draft.Summary {
+		t.Errorf("stray interaction = %+v", got)
+	}
+	if len(got.Body) != StrayBodySize {
+		t.Errorf("kept %d body bytes, want %d", len(got.Body), StrayBodySize)
+	}
+	var details map[string]any
+	if err := json.Unmarshal([]byte(got.Details), &details); err != nil || details["path"] != "/login" {
+		t.Errorf("details = %s, %v; want the request's path", got.Details, err)
+	}
+
+	// Interactions for tokens that exist are not strays.
+	if _, err := db.CreateToken(database, "real-token", nil, nil, nil); err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	e := &events.Event{Draft: &events.InteractionDraft{TokenValue: "real-token", Kind: events.KindDNS, RemoteIP: "192.168.1.1", Summary: "A"}}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if id, err := p.CreateInteraction(context.Background(), e.Draft); err != nil || id == 0 {
+		t.Fatalf("CreateInteraction = %d, %v; want an interaction", id, err)
+	}
+	if strays, _ := db.ListStrayInteractions(database, db.StrayFilter{}); len(strays) != 1 {
+		t.Errorf("got %d stray interactions, want 1", len(strays))
+	}
+}
+
 func TestStoreHTTPInteraction(t *testing.T) {
 	database := setupTestDB(t)
-	p := New(database)
+	p := New(db.NewSQLite(database))
 	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
 
-	tokenID, err := db.CreateToken(database, "test-token", nil, nil)
+	tokenID, err := db.CreateToken(database, "test-token", nil, nil, nil)
 	if err != nil {
 		t.Fatalf("CreateToken failed: %v", err)
 	}
@@ -250,10 +314,10 @@ func TestStoreHTTPInteraction(t *testing.T) {
 
 func TestStoreDNSInteraction(t *testing.T) {
 	database := setupTestDB(t)
-	p := New(database)
+	p := New(db.NewSQLite(database))
 	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
 
-	tokenID, err := db.CreateToken(database, "test-token", nil, nil)
+	tokenID, err := db.CreateToken(database, "test-token", nil, nil, nil)
 	if err != nil {
 		t.Fatalf("CreateToken failed: %v", err)
 	}
@@ -300,12 +364,54 @@ func TestStoreDNSInteraction(t *testing.T) {
 	}
 }
 
+func TestStoreProtocolInteraction(t *testing.T) {
+	database := setupTestDB(t)
+	p := New(db.NewSQLite(database))
+	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+
+	tokenID, err := db.CreateToken(database, "test-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+
+	draft := &events.InteractionDraft{
+		TokenID:    tokenID,
+		Kind:       events.KindSMTP,
+		RemoteIP:   "192.168.1.1",
+		RemotePort: 25,
+		Summary:    "MAIL FROM:<a@example.com>",
+		Protocol: &events.ProtocolDraft{
+			Raw:    []byte("HELO example.com\r\n"),
+			Fields: map[string]any{"helo": "example.com"},
+		},
+	}
+
+	id, err := p.CreateInteraction(context.Background(), draft)
+	if err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	pi, err := db.GetProtocolInteraction(database, id)
+	if err != nil {
+		t.Fatalf("GetProtocolInteraction failed: %v", err)
+	}
+	if pi == nil {
+		t.Fatal("expected protocol interaction to exist")
+	}
+	if string(pi.Raw) != "HELO example.com\r\n" {
+		t.Errorf("Raw = %q", pi.Raw)
+	}
+	if pi.Fields == nil || *pi.Fields != `{"helo":"example.com"}` {
+		t.Errorf("Fields = %v, want the JSON object", pi.Fields)
+	}
+}
+
 func TestSaveAttributes(t *testing.T) {
 	database := setupTestDB(t)
-	p := New(database)
+	p := New(db.NewSQLite(database))
 	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
 
-	tokenID, err := db.CreateToken(database, "test-token", nil, nil)
+	tokenID, err := db.CreateToken(database, "test-token", nil, nil, nil)
 	if err != nil {
 		t.Fatalf("CreateToken failed: %v", err)
 	}
@@ -356,12 +462,91 @@ func TestSaveAttributes(t *testing.T) {
 	}
 }
 
+func TestWritesHonourEventDeadline(t *testing.T) {
+	database := setupTestDB(t)
+	p := New(db.NewSQLite(database))
+	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+
+	tokenID, err := db.CreateToken(database, "test-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	draft := &events.InteractionDraft{TokenID: tokenID, Kind: events.KindDNS, RemoteIP: "192.168.1.1"}
+	id, err := p.CreateInteraction(context.Background(), draft)
+	if err != nil {
+		t.Fatalf("CreateInteraction failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	if _, err := p.CreateInteraction(ctx, draft); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("CreateInteraction after deadline error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if err := p.SaveAttributes(ctx, id, map[string]any{"k": "v"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("SaveAttributes after deadline error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	interactions, err := db.GetInteractionsByToken(database, tokenID)
+	if err != nil {
+		t.Fatalf("GetInteractionsByToken failed: %v", err)
+	}
+	if len(interactions) != 1 {
+		t.Errorf("got %d interactions, want 1 without the one past its deadline", len(interactions))
+	}
+	attrs, err := db.GetAttributes(database, id)
+	if err != nil {
+		t.Fatalf("GetAttributes failed: %v", err)
+	}
+	if len(attrs) != 0 {
+		t.Errorf("attributes saved after the deadline: %v", attrs)
+	}
+}
+
+func TestReadInteractions(t *testing.T) {
+	database := setupTestDB(t)
+	p := New(db.NewSQLite(database))
+	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+	ctx := context.Background()
+
+	tokenID, err := db.CreateToken(database, "test-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	var ids []int64
+	for range 3 {
+		id, err := p.CreateInteraction(ctx, &events.InteractionDraft{TokenID: tokenID, Kind: events.KindDNS, RemoteIP: "192.168.1.1"})
+		if err != nil {
+			t.Fatalf("CreateInteraction failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := p.SaveAttributes(ctx, ids[0], map[string]any{"seen": true}); err != nil {
+		t.Fatalf("SaveAttributes failed: %v", err)
+	}
+
+	got, err := p.GetInteractionsByToken(ctx, tokenID, 2)
+	if err != nil {
+		t.Fatalf("GetInteractionsByToken failed: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != ids[2] || got[1].ID != ids[1] {
+		t.Errorf("GetInteractionsByToken = %+v, want the 2 most recent", got)
+	}
+
+	attrs, err := p.GetAttributes(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("GetAttributes failed: %v", err)
+	}
+	if attrs["seen"] != true {
+		t.Errorf("attrs = %v, want seen=true", attrs)
+	}
+}
+
 func TestStoreHTTPWithoutHTTPDraft(t *testing.T) {
 	database := setupTestDB(t)
-	p := New(database)
+	p := New(db.NewSQLite(database))
 	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
 
-	tokenID, err := db.CreateToken(database, "test-token", nil, nil)
+	tokenID, err := db.CreateToken(database, "test-token", nil, nil, nil)
 	if err != nil {
 		t.Fatalf("CreateToken failed: %v", err)
 	}
@@ -396,10 +581,10 @@ func TestStoreHTTPWithoutHTTPDraft(t *testing.T) {
 
 func TestStoreDNSWithoutDNSDraft(t *testing.T) {
 	database := setupTestDB(t)
-	p := New(database)
+	p := New(db.NewSQLite(database))
 	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
 
-	tokenID, err := db.CreateToken(database, "test-token", nil, nil)
+	tokenID, err := db.CreateToken(database, "test-token", nil, nil, nil)
 	if err != nil {
 		t.Fatalf("CreateToken failed: %v", err)
 	}
@@ -431,3 +616,218 @@ func TestStoreDNSWithoutDNSDraft(t *testing.T) {
 		t.Error("expected no DNS interaction when DNSDraft is nil")
 	}
 }
+
+func TestSaveDNSResponse(t *testing.T) {
+	database := setupTestDB(t)
+	p := New(db.NewSQLite(database))
+	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+
+	tokenID, err := db.CreateToken(database, "test-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+
+	id, err := p.CreateInteraction(context.Background(), &events.InteractionDraft{
+		TokenID: tokenID,
+		Kind:    events.KindDNS,
+		DNS:     &events.DNSDraft{QName: "test.example.com", QType: 1, QClass: 1},
+	})
+	if err != nil {
+		t.Fatalf("CreateInteraction failed: %v", err)
+	}
+
+	rr, err := dns.NewRR("test.example.com. 60 IN A 192.0.2.1")
+	if err != nil {
+		t.Fatalf("NewRR failed: %v", err)
+	}
+	if err := p.SaveDNSResponse(context.Background(), id, &events.DNSResponsePlan{RCode: 0, Answers: []dns.RR{rr}}); err != nil {
+		t.Fatalf("SaveDNSResponse failed: %v", err)
+	}
+
+	got, err := db.GetDNSInteraction(database, id)
+	if err != nil {
+		t.Fatalf("GetDNSInteraction failed: %v", err)
+	}
+	if got.ResponseRCode == nil || *got.ResponseRCode != 0 {
+		t.Errorf("ResponseRCode = %v, want 0", got.ResponseRCode)
+	}
+	want := `["test.example.com.\t60\tIN\tA\t192.0.2.1"]`
+	if got.ResponseAnswers == nil || *got.ResponseAnswers != want {
+		t.Errorf("ResponseAnswers = %v, want %s", got.ResponseAnswers, want)
+	}
+}
+
+func TestOnPreStoreExpiredToken(t *testing.T) {
+	tests := []struct {
+		policy       TokenPolicy
+		wantDrop     bool
+		wantAttrFlag bool
+	}{
+		{"", true, false},
+		{PolicyDrop, true, false},
+		{PolicyRecord, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			database := setupTestDB(t)
+			p := New(db.NewSQLite(database))
+			p.ExpiredTokens = tt.policy
+			_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+
+			expiresAt := time.Now().Add(-time.Hour).Unix()
+			if _, err := db.CreateToken(database, "old-token", nil, nil, &expiresAt); err != nil {
+				t.Fatalf("CreateToken failed: %v", err)
+			}
+
+			e := &events.Event{Draft: &events.InteractionDraft{TokenValue: "old-token"}}
+			if err := p.OnPreStore(context.Background(), e); err != nil {
+				t.Fatalf("OnPreStore failed: %v", err)
+			}
+
+			if e.Draft.Drop != tt.wantDrop {
+				t.Errorf("Drop = %v, want %v", e.Draft.Drop, tt.wantDrop)
+			}
+			if got := e.Draft.Attributes["token_expired"] == true; got != tt.wantAttrFlag {
+				t.Errorf("token_expired attribute = %v, want %v", got, tt.wantAttrFlag)
+			}
+		})
+	}
+}
+
+func TestParseTokenPolicy(t *testing.T) {
+	for _, s := range []string{"drop", "record"} {
+		if _, err := ParseTokenPolicy(s); err != nil {
+			t.Errorf("ParseTokenPolicy(%q) failed: %v", s, err)
+		}
+	}
+	if _, err := ParseTokenPolicy("ignore"); err == nil {
+		t.Error("expected error for unknown policy")
+	}
+}
+
+func TestOnPreStoreDisabledToken(t *testing.T) {
+	tests := []struct {
+		policy       TokenPolicy
+		wantDrop     bool
+		wantAttrFlag bool
+	}{
+		{"", true, false},
+		{PolicyDrop, true, false},
+		{PolicyRecord, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			database := setupTestDB(t)
+			p := New(db.NewSQLite(database))
+			p.DisabledTokens = tt.policy
+			_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+
+			id, err := db.CreateToken(database, "paused-token", nil, nil, nil)
+			if err != nil {
+				t.Fatalf("CreateToken failed: %v", err)
+			}
+			if err := db.SetTokenEnabled(database, id, false); err != nil {
+				t.Fatalf("SetTokenEnabled failed: %v", err)
+			}
+
+			e := &events.Event{Draft: &events.InteractionDraft{TokenValue: "paused-token"}}
+			if err := p.OnPreStore(context.Background(), e); err != nil {
+				t.Fatalf("OnPreStore failed: %v", err)
+			}
+
+			if e.Draft.Drop != tt.wantDrop {
+				t.Errorf("Drop = %v, want %v", e.Draft.Drop, tt.wantDrop)
+			}
+			if got := e.Draft.Attributes["while_disabled"] == true; got != tt.wantAttrFlag {
+				t.Errorf("while_disabled attribute = %v, want %v", got, tt.wantAttrFlag)
+			}
+			if !tt.wantDrop && e.Draft.TokenID != id {
+				t.Errorf("TokenID = %d, want %d", e.Draft.TokenID, id)
+			}
+		})
+	}
+}
+
+func TestOnPreStoreAlias(t *testing.T) {
+	database := setupTestDB(t)
+	p := New(db.NewSQLite(database))
+	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+
+	id, err := db.CreateToken(database, "real-token", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if err := db.SetTokenAliases(database, id, []string{"img-cdn"}); err != nil {
+		t.Fatalf("SetTokenAliases failed: %v", err)
+	}
+
+	e := &events.Event{Draft: &events.InteractionDraft{TokenValue: "Img-Cdn"}}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if e.Draft.TokenID != id {
+		t.Errorf("TokenID = %d, want %d", e.Draft.TokenID, id)
+	}
+	if e.Draft.Attributes["token_alias"] != "img-cdn" {
+		t.Errorf("token_alias attribute = %v, want img-cdn", e.Draft.Attributes["token_alias"])
+	}
+}
+
+func TestGlobalConfigGet(t *testing.T) {
+	database := setupTestDB(t)
+	var view plugins.GlobalConfigView = NewGlobalConfig(db.NewSQLite(database))
+
+	type config struct {
+		Path string `json:"path"`
+		TTL  int    `json:"ttl"`
+	}
+
+	cfg := config{Path: "/default", TTL: 60}
+	if err := view.Get("geoip", &cfg); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if cfg != (config{Path: "/default", TTL: 60}) {
+		t.Errorf("unset config changed defaults: %+v", cfg)
+	}
+
+	if err := db.SetPluginConfig(database, "geoip", map[string]any{"path": "/data/geo.mmdb"}); err != nil {
+		t.Fatalf("SetPluginConfig failed: %v", err)
+	}
+	if err := view.Get("geoip", &cfg); err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	if cfg != (config{Path: "/data/geo.mmdb", TTL: 60}) {
+		t.Errorf("config = %+v", cfg)
+	}
+}
+
+func TestTokenConfigGet(t *testing.T) {
+	database := setupTestDB(t)
+	var view plugins.TokenConfigView = NewTokenConfig(db.NewSQLite(database))
+
+	tokenID, err := db.CreateToken(database, "configtoken", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+
+	var cfg struct {
+		Realm string `json:"realm"`
+	}
+	ok, err := view.Get(context.Background(), tokenID, "basicauth", &cfg)
+	if err != nil || ok {
+		t.Fatalf("Get unset = %v, %v; want false, nil", ok, err)
+	}
+
+	if err := db.SetTokenPluginConfig(database, tokenID, "basicauth", map[string]any{"realm": "Admin"}); err != nil {
+		t.Fatalf("SetTokenPluginConfig failed: %v", err)
+	}
+	ok, err = view.Get(context.Background(), tokenID, "basicauth", &cfg)
+	if err != nil || !ok {
+		t.Fatalf("Get = %v, %v; want true, nil", ok, err)
+	}
+	if cfg.Realm != "Admin" {
+		t.Errorf("realm = %q, want Admin", cfg.Realm)
+	}
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// StrayBodySize is how much of a stray interaction's request body or raw
+// capture is kept.
+const StrayBodySize = 4096
+
+// strayHTTP and strayDNS are the details recorded for stray HTTP requests
+// and DNS queries, keyed as in the v2 API.
+type strayHTTP struct {
+	Method  string              `json:"method"`
+	Scheme  string              `json:"scheme"`
+	Host    string              `json:"host"`
+	Path    string              `json:"path"`
+	Query   string              `json:"query"`
+	Proto   string              `json:"proto"`
+	Headers map[string][]string `json:"headers"`
+}
+
+type strayDNS struct {
+	QName    string `json:"qname"`
+	QType    int    `json:"qtype"`
+	QClass   int    `json:"qclass"`
+	RD       bool   `json:"rd"`
+	Opcode   int    `json:"opcode"`
+	DNSID    int    `json:"dns_id"`
+	Protocol string `json:"protocol"`
+}
+
+// RecordStray records draft, which carried no token or one that does not
+// exist, as a stray interaction. Only the start of its body is kept.
+func (p *Plugin) RecordStray(_ context.Context, draft *events.InteractionDraft) error {
+	if p.RedactStrays != nil {
+		draft = p.RedactStrays(draft)
+	}
+	var details any = map[string]any{}
+	var body []byte
+	switch {
+	case draft.HTTP != nil:
+		h := draft.HTTP
+		details = strayHTTP{Method: h.Method, Scheme: h.Scheme, Host: h.Host, Path: h.Path, Query: h.Query, Proto: h.Proto, Headers: h.Headers}
+		body = h.Body
+	case draft.DNS != nil:
+		d := draft.DNS
+		details = strayDNS{QName: d.QName, QType: d.QType, QClass: d.QClass, RD: d.RD != 0, Opcode: d.Opcode, DNSID: d.DNSID, Protocol: d.Protocol}
+	case draft.Protocol != nil:
+		if draft.Protocol.Fields != nil {
+			details = draft.Protocol.Fields
+		}
+		body = draft.Protocol.Raw
+	}
+	encoded, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("marshal stray details: %w", err)
+	}
+
+	stray := models.StrayInteraction{
+		Kind:       string(draft.Kind),
+		OccurredAt: p.now().Unix(),
+		RemoteIP:   draft.RemoteIP,
+		RemotePort: draft.RemotePort,
+		TLS:        draft.TLS,
+		Summary:    draft.Summary,
+		Details:    string(encoded),
+		Body:       body[:min(len(body), StrayBodySize)],
+	}
+	if draft.TokenValue != "" {
+		stray.Token = &draft.TokenValue
+	}
+	if _, err := p.store.CreateStrayInteraction(stray); err != nil {
+		return fmt.Errorf("create stray interaction: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Package stream implements the core plugin that fans out newly stored interactions to live subscribers.
+package stream
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// subscriberBuffer is the number of pending notifications a subscriber may
+// queue before further notifications are dropped for it.
+const subscriberBuffer = 64
+
+// Plugin publishes the ID of every stored interaction to subscribers of its token.
+type Plugin struct {
+	mu     sync.Mutex
+	subs   map[int64]map[chan int64]struct{}
+	logger *zap.Logger
+}
+
+// New creates a new stream Plugin.
+func New() *Plugin {
+	return &Plugin{
+		subs:   make(map[int64]map[chan int64]struct{}),
+		logger: zap.NewNop(),
+	}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return "stream" }
+
+// IsCore returns true to identify this as a core plugin.
+func (p *Plugin) IsCore() bool { return true }
+
+// Priority publishes interactions once quota trimming has run.
+func (p *Plugin) Priority() int { return 20 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named("stream")
+	return nil
+}
+
+// Subscribe registers interest in interactions for a token. The returned channel
+// receives interaction IDs as they are stored; call cancel to unsubscribe.
+func (p *Plugin) Subscribe(tokenID int64) (ids <-chan int64, cancel func()) {
+	ch := make(chan int64, subscriberBuffer)
+
+	p.mu.Lock()
+	if p.subs[tokenID] == nil {
+		p.subs[tokenID] = make(map[chan int64]struct{})
+	}
+	p.subs[tokenID][ch] = struct{}{}
+	p.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			p.mu.Lock()
+			delete(p.subs[tokenID], ch)
+			if len(p.subs[tokenID]) == 0 {
+				delete(p.subs, tokenID)
+			}
+			p.mu.Unlock()
+		})
+	}
+}
+
+// OnPostStore notifies subscribers of the interaction's token.
+// Slow subscribers never block the pipeline; notifications that do not fit in
+// their buffer are dropped.
+func (p *Plugin) OnPostStore(_ context.Context, e *events.Event) error {
+	if e.InteractionID == 0 || e.Draft == nil || e.Draft.TokenID == 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for ch := range p.subs[e.Draft.TokenID] {
+		select {
+		case ch <- e.InteractionID:
+		default:
+			p.logger.Warn("dropping stream notification for slow subscriber",
+				zap.Int64("token_id", e.Draft.TokenID),
+				zap.Int64("interaction_id", e.InteractionID))
+		}
+	}
+	return nil
+}
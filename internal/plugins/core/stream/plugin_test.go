@@ -0,0 +1,112 @@
+package stream
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func newTestPlugin(t *testing.T) *Plugin {
+	t.Helper()
+	p := New()
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop()}); err != nil {
+		t.Fatalf("Init() error = %v", err)
+	}
+	return p
+}
+
+func TestPluginID(t *testing.T) {
+	p := New()
+	if got := p.ID(); got != "stream" {
+		t.Errorf("ID() = %q, want %q", got, "stream")
+	}
+}
+
+func TestOnPostStorePublishesToTokenSubscribers(t *testing.T) {
+	p := newTestPlugin(t)
+
+	ids, cancel := p.Subscribe(1)
+	defer cancel()
+	otherIDs, otherCancel := p.Subscribe(2)
+	defer otherCancel()
+
+	e := &events.Event{
+		Draft:         &events.InteractionDraft{TokenID: 1},
+		InteractionID: 42,
+	}
+	if err := p.OnPostStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPostStore() error = %v", err)
+	}
+
+	select {
+	case id := <-ids:
+		if id != 42 {
+			t.Errorf("received id %d, want 42", id)
+		}
+	default:
+		t.Fatal("expected notification for subscribed token")
+	}
+
+	select {
+	case id := <-otherIDs:
+		t.Errorf("unexpected notification %d for other token", id)
+	default:
+	}
+}
+
+func TestOnPostStoreSkipsUnstoredInteractions(t *testing.T) {
+	p := newTestPlugin(t)
+
+	ids, cancel := p.Subscribe(1)
+	defer cancel()
+
+	e := &events.Event{Draft: &events.InteractionDraft{TokenID: 1}}
+	if err := p.OnPostStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPostStore() error = %v", err)
+	}
+
+	select {
+	case id := <-ids:
+		t.Errorf("unexpected notification %d for unstored interaction", id)
+	default:
+	}
+}
+
+func TestOnPostStoreDropsWhenSubscriberFull(t *testing.T) {
+	p := newTestPlugin(t)
+
+	ids, cancel := p.Subscribe(1)
+	defer cancel()
+
+	for i := 1; i <= subscriberBuffer+5; i++ {
+		e := &events.Event{
+			Draft:         &events.InteractionDraft{TokenID: 1},
+			InteractionID: int64(i),
+		}
+		if err := p.OnPostStore(context.Background(), e); err != nil {
+			t.Fatalf("OnPostStore() error = %v", err)
+		}
+	}
+
+	if got := len(ids); got != subscriberBuffer {
+		t.Errorf("buffered %d notifications, want %d", got, subscriberBuffer)
+	}
+}
+
+func TestCancelUnsubscribes(t *testing.T) {
+	p := newTestPlugin(t)
+
+	_, cancel := p.Subscribe(1)
+	cancel()
+	cancel()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.subs) != 0 {
+		t.Errorf("expected no subscriptions after cancel, got %d", len(p.subs))
+	}
+}
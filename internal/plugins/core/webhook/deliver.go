@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// Headers set on every delivery. The signature is only set for endpoints
+// with a secret.
+const (
+	HeaderDelivery  = "X-Oastrix-Delivery"
+	HeaderTimestamp = "X-Oastrix-Timestamp"
+	HeaderSignature = "X-Oastrix-Signature"
+)
+
+// Sign returns the signature header value of a delivery of body at the Unix
+// timestamp: "sha256=" and the hex HMAC-SHA256, keyed with secret, of the
+// timestamp, a ".", and body. Signing the timestamp lets receivers refuse
+// replayed deliveries.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// permanentError is a delivery the endpoint rejected in a way retrying will
+// not change.
+type permanentError struct{ error }
+
+// post sends a delivery to ep. When the endpoint asks for deliveries to be
+// held back, it also returns how long for.
+func (p *Plugin) post(ctx context.Context, ep Endpoint, w models.WebhookDelivery) (retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(w.Payload))
+	if err != nil {
+		return 0, permanentError{err}
+	}
+	now := p.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "oastrix-webhook")
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(w.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now, 10))
+	if ep.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(ep.Secret, now, w.Payload))
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("deliver to %s: %w", ep.Name, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return 0, nil
+	case code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable:
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retryAfter = time.Duration(secs) * time.Second
+		}
+	case code >= 400 && code < 500 && code != http.StatusRequestTimeout:
+		return 0, permanentError{fmt.Errorf("%s rejected delivery: %s", ep.Name, resp.Status)}
+	}
+	return retryAfter, fmt.Errorf("%s refused delivery: %s", ep.Name, resp.Status)
+}
@@ -0,0 +1,364 @@
+// Package webhook implements the core plugin that posts stored interactions
+// as signed JSON to configured endpoints, queueing the deliveries in the
+// database so that those an endpoint refuses are retried, with backoff, even
+// across restarts.
+package webhook
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/notify"
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "webhook"
+
+// DefaultMaxAttempts is how many times a delivery is attempted when the
+// GlobalConfig does not say.
+const DefaultMaxAttempts = 10
+
+// RetryInterval is how often deliveries due a retry are looked for.
+const RetryInterval = 15 * time.Second
+
+// retryBatch bounds the deliveries retried each RetryInterval.
+const retryBatch = 100
+
+// Backoff before the next attempt at a delivery doubles from minBackoff with
+// each failed attempt, up to maxBackoff.
+const (
+	minBackoff = 30 * time.Second
+	maxBackoff = time.Hour
+)
+
+// Endpoint is a URL interactions are posted to. With a Secret, each delivery
+// is signed with it.
+type Endpoint struct {
+	Name      string        `json:"name"`
+	URL       string        `json:"url"`
+	Secret    string        `json:"secret,omitempty" secret:"true"`
+	AllTokens bool          `json:"all_tokens"`      // deliver tokens that do not name the endpoint
+	Kinds     []string      `json:"kinds,omitempty"` // interaction kinds delivered; all when empty
+	Filter    notify.Filter `json:"filter"`
+}
+
+// GlobalConfig holds the endpoints interactions can be delivered to.
+type GlobalConfig struct {
+	Endpoints   []Endpoint `json:"endpoints"`
+	MaxAttempts int        `json:"max_attempts,omitempty"` // DefaultMaxAttempts when zero
+}
+
+// Validate checks that every endpoint has a unique name, an HTTP(S) URL and
+// a valid filter.
+func (c GlobalConfig) Validate() error {
+	if c.MaxAttempts < 0 {
+		return errors.New("max_attempts must not be negative")
+	}
+	seen := make(map[string]bool)
+	for _, e := range c.Endpoints {
+		if e.Name == "" {
+			return errors.New("endpoint name required")
+		}
+		if seen[e.Name] {
+			return fmt.Errorf("duplicate endpoint %q", e.Name)
+		}
+		seen[e.Name] = true
+		u, err := url.Parse(e.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("endpoint %q: invalid url %q: want an http or https URL", e.Name, e.URL)
+		}
+		if err := notify.ValidateKinds(e.Kinds); err != nil {
+			return fmt.Errorf("endpoint %q: %w", e.Name, err)
+		}
+		if err := e.Filter.Validate(); err != nil {
+			return fmt.Errorf("endpoint %q: %w", e.Name, err)
+		}
+	}
+	return nil
+}
+
+// endpoint returns the endpoint named name.
+func (c GlobalConfig) endpoint(name string) (Endpoint, bool) {
+	for _, e := range c.Endpoints {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Endpoint{}, false
+}
+
+func (c GlobalConfig) maxAttempts() int {
+	if c.MaxAttempts == 0 {
+		return DefaultMaxAttempts
+	}
+	return c.MaxAttempts
+}
+
+// Config names the endpoints a token's interactions are delivered to, besides
+// those delivering every token's.
+type Config struct {
+	Endpoints []string `json:"endpoints"`
+}
+
+// Plugin queues a delivery of each stored interaction to every endpoint that
+// wants it, and attempts it straight away. Deliveries an endpoint refuses are
+// retried from the queue with backoff until they succeed or MaxAttempts run
+// out; those it rejects outright with a 4xx status are dropped. Endpoints
+// are read from the GlobalConfig, so nothing is delivered until one is
+// configured.
+type Plugin struct {
+	// Client posts deliveries.
+	Client *http.Client
+
+	store  db.Store
+	config plugins.GlobalConfigView
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+	now    func() time.Time
+
+	// lookup resolves the tokens and tags endpoints' filters name.
+	lookup   plugins.Store
+	throttle notify.Throttle
+}
+
+// New creates a new webhook Plugin queueing deliveries in store.
+func New(store db.Store) *Plugin {
+	return &Plugin{
+		Client: &http.Client{Timeout: 10 * time.Second},
+		store:  store,
+		now:    time.Now,
+	}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// IsCore returns true to identify this as a core plugin.
+func (p *Plugin) IsCore() bool { return true }
+
+// Priority delivers interactions once they are stored and published.
+func (p *Plugin) Priority() int { return 25 }
+
+// Init initializes the plugin with the given context and schedules retries.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Config == nil {
+		return errors.New("global config view required")
+	}
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.lookup = ctx.Store
+	p.config = ctx.Config
+	p.tokens = ctx.Tokens
+	if ctx.Scheduler != nil {
+		ctx.Scheduler.Every(RetryInterval, p.retry)
+	}
+	return nil
+}
+
+// NewGlobalConfig returns a new GlobalConfig for the server-wide
+// configuration to be decoded into.
+func (p *Plugin) NewGlobalConfig() any { return new(GlobalConfig) }
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnPostStore queues the stored interaction for each endpoint that wants it
+// and whose filter it passes, and attempts the deliveries.
+func (p *Plugin) OnPostStore(ctx context.Context, e *events.Event) error {
+	if e.InteractionID == 0 {
+		return nil
+	}
+	var global GlobalConfig
+	if err := p.config.Get(ID, &global); err != nil {
+		return fmt.Errorf("load webhook global config: %w", err)
+	}
+	if len(global.Endpoints) == 0 {
+		return nil
+	}
+	var cfg Config
+	if _, err := p.tokens.Get(ctx, e.Draft.TokenID, ID, &cfg); err != nil {
+		return fmt.Errorf("load webhook: %w", err)
+	}
+
+	var targets []Endpoint
+	for _, ep := range global.Endpoints {
+		if (!ep.AllTokens && !slices.Contains(cfg.Endpoints, ep.Name)) || !notify.WantsKind(ep.Kinds, e.Draft.Kind) {
+			continue
+		}
+		ok, err := ep.Filter.Pass(ctx, p.lookup, e, &p.throttle, ep.Name, p.now(), p.logger)
+		if err != nil {
+			return fmt.Errorf("filter for %s: %w", ep.Name, err)
+		}
+		if ok {
+			targets = append(targets, ep)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(interaction(e))
+	if err != nil {
+		return fmt.Errorf("encode webhook payload: %w", err)
+	}
+
+	var errs []error
+	for _, ep := range targets {
+		// The first attempt is made here, so the queued delivery is not due
+		// until its first retry, keeping the scheduler from also making it.
+		w := models.WebhookDelivery{
+			Endpoint:      ep.Name,
+			InteractionID: e.InteractionID,
+			Payload:       payload,
+			NextAttemptAt: p.now().Add(backoff(1)).Unix(),
+		}
+		if w.ID, err = p.store.EnqueueWebhookDelivery(w); err != nil {
+			errs = append(errs, fmt.Errorf("queue delivery to %s: %w", ep.Name, err))
+			continue
+		}
+		if err := p.attempt(ctx, global, ep, w); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush attempts the deliveries due a retry, within ctx's deadline. Those
+// still failing stay queued in the database for the next start.
+func (p *Plugin) Flush(ctx context.Context) error {
+	if p.config == nil {
+		return nil
+	}
+	return p.retry(ctx)
+}
+
+// retry attempts the deliveries due a retry, dropping those whose endpoint
+// has since been removed.
+func (p *Plugin) retry(ctx context.Context) error {
+	var global GlobalConfig
+	if err := p.config.Get(ID, &global); err != nil {
+		return fmt.Errorf("load webhook global config: %w", err)
+	}
+	due, err := p.store.DueWebhookDeliveries(p.now().Unix(), retryBatch)
+	if err != nil {
+		return fmt.Errorf("list due webhook deliveries: %w", err)
+	}
+	for _, w := range due {
+		if ctx.Err() != nil {
+			return nil
+		}
+		ep, ok := global.endpoint(w.Endpoint)
+		if !ok {
+			p.logger.Info("dropping delivery to removed endpoint",
+				zap.String("endpoint", w.Endpoint), zap.Int64("interaction_id", w.InteractionID))
+			if err := p.store.DeleteWebhookDelivery(w.ID); err != nil {
+				return fmt.Errorf("delete webhook delivery: %w", err)
+			}
+			continue
+		}
+		if err := p.attempt(ctx, global, ep, w); err != nil {
+			p.logger.Debug("webhook delivery failed", zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// attempt posts a queued delivery to ep, then removes it from the queue if
+// it was delivered or can never be, or schedules its next attempt.
+func (p *Plugin) attempt(ctx context.Context, global GlobalConfig, ep Endpoint, w models.WebhookDelivery) error {
+	retryAfter, err := p.post(ctx, ep, w)
+	if err == nil {
+		if err := p.store.DeleteWebhookDelivery(w.ID); err != nil {
+			return fmt.Errorf("delete webhook delivery: %w", err)
+		}
+		return nil
+	}
+
+	attempts := w.Attempts + 1
+	var perr permanentError
+	if errors.As(err, &perr) || attempts >= global.maxAttempts() {
+		p.logger.Warn("giving up on webhook delivery",
+			zap.String("endpoint", ep.Name),
+			zap.Int64("interaction_id", w.InteractionID),
+			zap.Int("attempts", attempts),
+			zap.Error(err))
+		if derr := p.store.DeleteWebhookDelivery(w.ID); derr != nil {
+			return fmt.Errorf("delete webhook delivery: %w", derr)
+		}
+		return err
+	}
+	wait := max(backoff(attempts), retryAfter)
+	if rerr := p.store.RetryWebhookDelivery(w.ID, p.now().Add(wait).Unix(), err.Error()); rerr != nil {
+		return fmt.Errorf("reschedule webhook delivery: %w", rerr)
+	}
+	return err
+}
+
+// backoff returns how long to wait after a delivery's attempts-th failure.
+func backoff(attempts int) time.Duration {
+	d := minBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// interaction converts a stored interaction into the v2 representation the
+// API serves, so receivers can share one decoder. The response is not yet
+// known, so it is always null.
+func interaction(e *events.Event) apitypes.InteractionV2 {
+	d := e.Draft
+	iv := apitypes.InteractionV2{
+		ID:         e.InteractionID,
+		Token:      d.TokenValue,
+		Kind:       string(d.Kind),
+		OccurredAt: time.Unix(d.OccurredAt, 0).UTC().Format(time.RFC3339),
+		Remote:     apitypes.RemoteEndpoint{IP: d.RemoteIP, Port: d.RemotePort},
+		TLS:        d.TLS,
+		Summary:    d.Summary,
+		Attributes: d.Attributes,
+	}
+	if iv.Attributes == nil {
+		iv.Attributes = make(map[string]any)
+	}
+	if h := d.HTTP; h != nil {
+		iv.HTTP = &apitypes.HTTPDetailV2{Request: apitypes.HTTPRequestV2{
+			Method:  h.Method,
+			Scheme:  h.Scheme,
+			Host:    h.Host,
+			Path:    h.Path,
+			Query:   h.Query,
+			Proto:   h.Proto,
+			Headers: h.Headers,
+			Body:    base64.StdEncoding.EncodeToString(h.Body),
+		}}
+	}
+	if q := d.DNS; q != nil {
+		iv.DNS = &apitypes.DNSDetailV2{Query: apitypes.DNSQueryV2{
+			QName:    q.QName,
+			QType:    q.QType,
+			QClass:   q.QClass,
+			RD:       q.RD != 0,
+			Opcode:   q.Opcode,
+			DNSID:    q.DNSID,
+			Protocol: q.Protocol,
+		}}
+	}
+	return iv
+}
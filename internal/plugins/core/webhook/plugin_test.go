@@ -0,0 +1,294 @@
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/core/storage"
+	"github.com/rsclarke/oastrix/internal/plugins/notify"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// receiver records the deliveries posted to it, answering with status.
+type receiver struct {
+	status     int
+	retryAfter string
+	headers    []http.Header
+	bodies     [][]byte
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.headers = append(rc.headers, r.Header)
+	rc.bodies = append(rc.bodies, body)
+	if rc.retryAfter != "" {
+		w.Header().Set("Retry-After", rc.retryAfter)
+	}
+	w.WriteHeader(rc.status)
+}
+
+func setupTest(t *testing.T, rc *receiver, global GlobalConfig) (*Plugin, *sql.DB, *time.Time) {
+	t.Helper()
+	database, err := db.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	srv := httptest.NewServer(rc)
+	t.Cleanup(srv.Close)
+	for i := range global.Endpoints {
+		global.Endpoints[i].URL = srv.URL
+	}
+	if err := db.SetPluginConfig(database, ID, global); err != nil {
+		t.Fatalf("SetPluginConfig failed: %v", err)
+	}
+
+	store := db.NewSQLite(database)
+	now := time.Unix(1700000000, 0)
+	p := New(store)
+	p.now = func() time.Time { return now }
+	err = p.Init(plugins.InitContext{
+		Logger: zap.NewNop(),
+		Config: storage.NewGlobalConfig(store),
+		Tokens: storage.NewTokenConfig(store),
+	})
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, database, &now
+}
+
+func dnsEvent(tokenID int64) *events.Event {
+	return &events.Event{
+		InteractionID: 7,
+		Draft: &events.InteractionDraft{
+			TokenValue: "tok123",
+			TokenID:    tokenID,
+			Kind:       events.KindDNS,
+			OccurredAt: 1700000000,
+			RemoteIP:   "192.0.2.1",
+			RemotePort: 53,
+			Summary:    "A tok123.example.com udp",
+			DNS:        &events.DNSDraft{QName: "tok123.example.com", QType: 1, QClass: 1, RD: 1, Protocol: "udp"},
+			Attributes: map[string]any{"geo.country": "GB"},
+		},
+	}
+}
+
+func queued(t *testing.T, database *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := database.QueryRow("SELECT COUNT(*) FROM webhook_deliveries").Scan(&n); err != nil {
+		t.Fatalf("count deliveries: %v", err)
+	}
+	return n
+}
+
+func TestDelivery(t *testing.T) {
+	rc := &receiver{status: http.StatusNoContent}
+	p, database, _ := setupTest(t, rc, GlobalConfig{Endpoints: []Endpoint{{Name: "siem", Secret: "s3cret", AllTokens: true}}})
+
+	if err := p.OnPostStore(context.Background(), dnsEvent(1)); err != nil {
+		t.Fatalf("OnPostStore failed: %v", err)
+	}
+	if len(rc.bodies) != 1 {
+		t.Fatalf("delivered %d times, want once", len(rc.bodies))
+	}
+	var got apitypes.InteractionV2
+	if err := json.Unmarshal(rc.bodies[0], &got); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if got.ID != 7 || got.Token != "tok123" || got.OccurredAt != "2023-11-14T22:13:20Z" || got.DNS == nil || !got.DNS.Query.RD || got.Attributes["geo.country"] != "GB" {
+		t.Errorf("payload = %s", rc.bodies[0])
+	}
+
+	h := rc.headers[0]
+	ts, _ := strconv.ParseInt(h.Get(HeaderTimestamp), 10, 64)
+	if h.Get(HeaderSignature) != Sign("s3cret", ts, rc.bodies[0]) || h.Get(HeaderDelivery) == "" {
+		t.Errorf("headers = %v, want a valid signature", h)
+	}
+	if n := queued(t, database); n != 0 {
+		t.Errorf("%d deliveries left queued, want none", n)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		token    *Config
+		want     bool
+	}{
+		{"not named", Endpoint{Name: "siem"}, nil, false},
+		{"named by token", Endpoint{Name: "siem"}, &Config{Endpoints: []string{"siem"}}, true},
+		{"other named", Endpoint{Name: "siem"}, &Config{Endpoints: []string{"chat"}}, false},
+		{"all tokens", Endpoint{Name: "siem", AllTokens: true}, nil, true},
+		{"kind filtered out", Endpoint{Name: "siem", AllTokens: true, Kinds: []string{"http"}}, nil, false},
+		{"remote ignored", Endpoint{Name: "siem", AllTokens: true, Filter: notify.Filter{IgnoreIPs: []string{"192.0.2.0/24"}}}, nil, false},
+		{"attribute matched", Endpoint{Name: "siem", AllTokens: true, Filter: notify.Filter{Attributes: map[string]string{"geo.country": "GB"}}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{status: http.StatusOK}
+			p, database, _ := setupTest(t, rc, GlobalConfig{Endpoints: []Endpoint{tt.endpoint}})
+			tokenID, err := db.CreateToken(database, "tok123", nil, nil, nil)
+			if err != nil {
+				t.Fatalf("CreateToken failed: %v", err)
+			}
+			if tt.token != nil {
+				if err := db.SetTokenPluginConfig(database, tokenID, ID, tt.token); err != nil {
+					t.Fatalf("SetTokenPluginConfig failed: %v", err)
+				}
+			}
+			if err := p.OnPostStore(context.Background(), dnsEvent(tokenID)); err != nil {
+				t.Fatalf("OnPostStore failed: %v", err)
+			}
+			if got := len(rc.bodies) == 1; got != tt.want {
+				t.Errorf("delivered = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	rc := &receiver{status: http.StatusOK}
+	limit := notify.Filter{RateLimit: &notify.RateLimit{Max: 1, Per: "1m"}}
+	p, _, _ := setupTest(t, rc, GlobalConfig{Endpoints: []Endpoint{
+		{Name: "siem", AllTokens: true},
+		{Name: "chat", AllTokens: true, Filter: limit},
+	}})
+	for range 3 {
+		if err := p.OnPostStore(context.Background(), dnsEvent(1)); err != nil {
+			t.Fatalf("OnPostStore failed: %v", err)
+		}
+	}
+	if len(rc.bodies) != 4 {
+		t.Errorf("delivered %d times, want 3 to siem and 1 to the rate limited chat", len(rc.bodies))
+	}
+}
+
+func TestRetry(t *testing.T) {
+	rc := &receiver{status: http.StatusServiceUnavailable}
+	p, database, now := setupTest(t, rc, GlobalConfig{Endpoints: []Endpoint{{Name: "siem", AllTokens: true}}, MaxAttempts: 3})
+	ctx := context.Background()
+
+	if err := p.OnPostStore(ctx, dnsEvent(1)); err == nil {
+		t.Fatal("expected an error when the endpoint refuses the delivery")
+	}
+	if n := queued(t, database); n != 1 {
+		t.Fatalf("%d deliveries queued, want 1", n)
+	}
+
+	// Nothing is retried before the backoff has passed.
+	_ = p.retry(ctx)
+	if len(rc.bodies) != 1 {
+		t.Fatalf("retried before the backoff: %d attempts", len(rc.bodies))
+	}
+
+	// A Retry-After longer than the backoff is honored.
+	rc.retryAfter = "600"
+	*now = now.Add(backoff(1))
+	_ = p.retry(ctx)
+	*now = now.Add(backoff(2))
+	_ = p.retry(ctx)
+	if len(rc.bodies) != 2 {
+		t.Fatalf("%d attempts, want the Retry-After honored", len(rc.bodies))
+	}
+
+	// The third failure is the last.
+	*now = now.Add(10 * time.Minute)
+	_ = p.retry(ctx)
+	if len(rc.bodies) != 3 || queued(t, database) != 0 {
+		t.Fatalf("%d attempts, %d queued; want the delivery given up after 3", len(rc.bodies), queued(t, database))
+	}
+}
+
+func TestRetrySucceeds(t *testing.T) {
+	rc := &receiver{status: http.StatusBadGateway}
+	p, database, now := setupTest(t, rc, GlobalConfig{Endpoints: []Endpoint{{Name: "siem", AllTokens: true}}})
+	ctx := context.Background()
+	_ = p.OnPostStore(ctx, dnsEvent(1))
+
+	// The queue outlives the plugin, as across a restart.
+	restarted := New(p.store)
+	restarted.now = p.now
+	restarted.config, restarted.tokens, restarted.logger = p.config, p.tokens, p.logger
+
+	rc.status = http.StatusOK
+	*now = now.Add(backoff(1))
+	if err := restarted.retry(ctx); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if len(rc.bodies) != 2 || queued(t, database) != 0 {
+		t.Errorf("%d attempts, %d queued; want the retry delivered", len(rc.bodies), queued(t, database))
+	}
+	if rc.headers[0].Get(HeaderDelivery) != rc.headers[1].Get(HeaderDelivery) {
+		t.Error("the retry has a different delivery ID")
+	}
+}
+
+func TestRejected(t *testing.T) {
+	rc := &receiver{status: http.StatusGone}
+	p, database, _ := setupTest(t, rc, GlobalConfig{Endpoints: []Endpoint{{Name: "siem", AllTokens: true}}})
+	if err := p.OnPostStore(context.Background(), dnsEvent(1)); err == nil {
+		t.Fatal("expected an error when the endpoint rejects the delivery")
+	}
+	if n := queued(t, database); n != 0 {
+		t.Errorf("%d deliveries queued, want the rejected one dropped", n)
+	}
+}
+
+func TestRemovedEndpoint(t *testing.T) {
+	rc := &receiver{status: http.StatusInternalServerError}
+	p, database, now := setupTest(t, rc, GlobalConfig{Endpoints: []Endpoint{{Name: "siem", AllTokens: true}}})
+	_ = p.OnPostStore(context.Background(), dnsEvent(1))
+	if err := db.SetPluginConfig(database, ID, GlobalConfig{}); err != nil {
+		t.Fatalf("SetPluginConfig failed: %v", err)
+	}
+	*now = now.Add(backoff(1))
+	if err := p.retry(context.Background()); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	if len(rc.bodies) != 1 || queued(t, database) != 0 {
+		t.Errorf("%d attempts, %d queued; want the delivery dropped", len(rc.bodies), queued(t, database))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := GlobalConfig{Endpoints: []Endpoint{{Name: "siem", URL: "https://siem.example.com/hook", Kinds: []string{"dns"}}}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	for name, c := range map[string]GlobalConfig{
+		"no name":   {Endpoints: []Endpoint{{URL: "https://example.com"}}},
+		"duplicate": {Endpoints: []Endpoint{{Name: "a", URL: "https://example.com"}, {Name: "a", URL: "https://example.org"}}},
+		"scheme":    {Endpoints: []Endpoint{{Name: "a", URL: "ftp://example.com"}}},
+		"kind":      {Endpoints: []Endpoint{{Name: "a", URL: "https://example.com", Kinds: []string{"gopher"}}}},
+		"attempts":  {MaxAttempts: -1},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted %+v", name, c)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 4: 4 * time.Minute, 20: time.Hour} {
+		if got := backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package correlation implements a feature plugin that extracts a scanner's
+// correlation identifier from interactions, so each can be matched back to
+// the request that triggered it.
+package correlation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "correlation"
+
+// Attribute holds the extracted correlation identifier.
+const Attribute = "correlation_id"
+
+// maxLength is the longest correlation identifier recorded.
+const maxLength = 256
+
+// Config says where a token's interactions carry their correlation
+// identifier. Sources are tried in field order and the first one present is
+// used. PathSegment counts path segments from 1; DNSLabel counts labels from
+// 1 leftwards of the token's, in DNS query names and HTTP hosts alike, so 1
+// finds "abc123" in "abc123.<token>.example.com".
+type Config struct {
+	Header      string `json:"header,omitempty"`
+	Query       string `json:"query,omitempty"`
+	PathSegment int    `json:"path_segment,omitempty"`
+	DNSLabel    int    `json:"dns_label,omitempty"`
+}
+
+// Validate checks that c names at least one source.
+func (c Config) Validate() error {
+	if c.PathSegment < 0 || c.DNSLabel < 0 {
+		return errors.New("path_segment and dns_label must not be negative")
+	}
+	if c == (Config{}) {
+		return errors.New("at least one of header, query, path_segment or dns_label is required")
+	}
+	if strings.ContainsAny(c.Header, " :\t") {
+		return fmt.Errorf("invalid header name %q", c.Header)
+	}
+	return nil
+}
+
+// Extract returns the correlation identifier cfg finds in draft.
+func (c Config) Extract(draft *events.InteractionDraft) (string, bool) {
+	var found string
+	if h := draft.HTTP; h != nil {
+		switch {
+		case c.Header != "" && len(h.Headers[http.CanonicalHeaderKey(c.Header)]) > 0:
+			found = h.Headers[http.CanonicalHeaderKey(c.Header)][0]
+		case c.Query != "" && queryValue(h.Query, c.Query) != "":
+			found = queryValue(h.Query, c.Query)
+		case c.PathSegment > 0 && pathSegment(h.Path, c.PathSegment) != "":
+			found = pathSegment(h.Path, c.PathSegment)
+		case c.DNSLabel > 0:
+			host := h.Host
+			if hostname, _, err := net.SplitHostPort(host); err == nil {
+				host = hostname
+			}
+			found = label(host, draft.TokenValue, c.DNSLabel)
+		}
+	} else if d := draft.DNS; d != nil && c.DNSLabel > 0 {
+		found = label(d.QName, draft.TokenValue, c.DNSLabel)
+	}
+	found = strings.TrimSpace(found)
+	if found == "" {
+		return "", false
+	}
+	if len(found) > maxLength {
+		found = found[:maxLength]
+	}
+	return found, true
+}
+
+func queryValue(rawQuery, name string) string {
+	values, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return ""
+	}
+	return values.Get(name)
+}
+
+func pathSegment(path string, n int) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if n > len(segments) {
+		return ""
+	}
+	return segments[n-1]
+}
+
+// label returns the nth label leftwards of the token's in name.
+func label(name, token string, n int) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(name, ".")), ".")
+	i := -1
+	for j, l := range labels {
+		if l == strings.ToLower(token) {
+			i = j
+			break
+		}
+	}
+	if i-n < 0 {
+		return ""
+	}
+	return labels[i-n]
+}
+
+// Plugin records the correlation identifier of interactions with tokens that
+// configure one in the Attribute attribute.
+type Plugin struct {
+	tokens plugins.TokenConfigView
+}
+
+// New creates a new correlation Plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Priority extracts identifiers alongside the other enrichment plugins.
+func (p *Plugin) Priority() int { return 20 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.tokens = ctx.Tokens
+	return nil
+}
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnPreStore records the correlation identifier the token's Config finds.
+func (p *Plugin) OnPreStore(ctx context.Context, e *events.Event) error {
+	if e.Draft.Drop || e.Draft.TokenID == 0 {
+		return nil
+	}
+	var cfg Config
+	ok, err := p.tokens.Get(ctx, e.Draft.TokenID, ID, &cfg)
+	if err != nil {
+		return fmt.Errorf("load correlation: %w", err)
+	}
+	if !ok {
+		return nil
+	}
+	id, ok := cfg.Extract(e.Draft)
+	if !ok {
+		return nil
+	}
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes[Attribute] = id
+	return nil
+}
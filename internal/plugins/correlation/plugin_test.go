@@ -0,0 +1,86 @@
+package correlation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/plugintest"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func httpDraft(host, path, query string, headers map[string][]string) *events.InteractionDraft {
+	return &events.InteractionDraft{
+		TokenID:    1,
+		TokenValue: "tok123",
+		HTTP:       &events.HTTPDraft{Host: host, Path: path, Query: query, Headers: headers},
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   Config
+		draft *events.InteractionDraft
+		want  string
+	}{
+		{"header", Config{Header: "x-request-id"}, httpDraft("tok123.example.com", "/", "", map[string][]string{"X-Request-Id": {"req-1"}}), "req-1"},
+		{"query", Config{Query: "cid"}, httpDraft("tok123.example.com", "/", "a=1&cid=scan%2042", nil), "scan 42"},
+		{"path segment", Config{PathSegment: 2}, httpDraft("tok123.example.com", "/cb/abc/x", "", nil), "abc"},
+		{"http host label", Config{DNSLabel: 1}, httpDraft("ID9.TOK123.example.com:8080", "/", "", nil), "id9"},
+		{"fallback to query", Config{Header: "X-Request-Id", Query: "cid"}, httpDraft("tok123.example.com", "/", "cid=q", nil), "q"},
+		{
+			"dns label",
+			Config{DNSLabel: 2},
+			&events.InteractionDraft{TokenValue: "tok123", DNS: &events.DNSDraft{QName: "a.b.tok123.example.com."}},
+			"a",
+		},
+		{"missing", Config{Query: "cid"}, httpDraft("tok123.example.com", "/", "", nil), ""},
+		{"label beyond name", Config{DNSLabel: 1}, httpDraft("tok123.example.com", "/", "", nil), ""},
+		{"segment beyond path", Config{PathSegment: 3}, httpDraft("tok123.example.com", "/a/b", "", nil), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.cfg.Extract(tt.draft)
+			if got != tt.want || ok != (tt.want != "") {
+				t.Errorf("Extract = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, cfg := range []Config{{}, {PathSegment: -1}, {Header: "X Bad"}} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Validate(%+v) succeeded", cfg)
+		}
+	}
+	if err := (Config{Query: "cid"}).Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+}
+
+func TestOnPreStore(t *testing.T) {
+	p := New()
+	if err := p.Init(plugins.InitContext{Tokens: plugintest.TokenConfigs[Config]{1: {Query: "cid"}}}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	e := &events.Event{Draft: httpDraft("tok123.example.com", "/", "cid=abc", nil)}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if got := e.Draft.Attributes[Attribute]; got != "abc" {
+		t.Errorf("attribute = %v, want abc", got)
+	}
+
+	// Tokens without a Config record nothing.
+	e = &events.Event{Draft: httpDraft("tok123.example.com", "/", "cid=abc", nil)}
+	e.Draft.TokenID = 2
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if _, ok := e.Draft.Attributes[Attribute]; ok {
+		t.Error("attribute recorded for an unconfigured token")
+	}
+}
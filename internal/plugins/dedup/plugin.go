@@ -0,0 +1,203 @@
+// Package dedup implements a feature plugin that collapses repeated identical
+// interactions into the first, counting the repeats, so crawled tokens do not
+// produce thousands of identical rows.
+package dedup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "dedup"
+
+// RepeatAttribute counts the repeats collapsed into a stored interaction.
+const RepeatAttribute = "repeat_count"
+
+// pruneInterval is how often expired entries are forgotten.
+const pruneInterval = time.Minute
+
+// Config overrides the server's collapsing window for a token. A zero
+// window stores every interaction.
+type Config struct {
+	Window string `json:"window"` // Go duration, e.g. "10m"
+}
+
+// Validate checks that the window is a non-negative duration.
+func (c Config) Validate() error {
+	if d, err := time.ParseDuration(c.Window); err != nil || d < 0 {
+		return fmt.Errorf("invalid window %q: want a non-negative duration", c.Window)
+	}
+	return nil
+}
+
+// key identifies interactions considered identical.
+type key struct {
+	tokenID  int64
+	remoteIP string
+	kind     events.Kind
+	request  string // method and path, query name and type, or summary
+	body     uint64 // hash of an HTTP body
+}
+
+// entry is the stored interaction repeats of a key are collapsed into.
+type entry struct {
+	interactionID int64
+	repeats       int
+	expires       time.Time
+}
+
+// Plugin drops interactions identical to one stored within the window, by
+// token, remote IP and HTTP request line and body or DNS query, and records
+// how many were dropped in the RepeatAttribute attribute of the stored one.
+// HTTP requests presenting credentials are never collapsed, so the retries
+// that the basicauth and ntlm plugins capture from are stored. Its Priority
+// runs it after quotas and before enrichment.
+type Plugin struct {
+	window time.Duration
+	store  plugins.Store
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[key]*entry
+}
+
+// New creates a new dedup Plugin collapsing repeats within window, unless a
+// token's Config sets another.
+func New(window time.Duration) *Plugin {
+	return &Plugin{window: window, now: time.Now, entries: make(map[key]*entry)}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Priority collapses repeats before they are enriched.
+func (p *Plugin) Priority() int { return 15 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Store == nil {
+		return errors.New("store required")
+	}
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.store = ctx.Store
+	p.tokens = ctx.Tokens
+	if ctx.Scheduler != nil {
+		ctx.Scheduler.Every(pruneInterval, func(context.Context) error {
+			p.prune()
+			return nil
+		})
+	}
+	return nil
+}
+
+// Config returns the plugin's settings.
+func (p *Plugin) Config() map[string]any {
+	return map[string]any{"window": p.window.String()}
+}
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnPreStore drops a repeat of an interaction stored within the window and
+// updates the stored one's repeat count.
+func (p *Plugin) OnPreStore(ctx context.Context, e *events.Event) error {
+	if e.Draft.Drop || e.Draft.TokenID == 0 || hasCredentials(e.Draft) {
+		return nil
+	}
+	k := keyOf(e.Draft)
+
+	p.mu.Lock()
+	ent, ok := p.entries[k]
+	if !ok || !p.now().Before(ent.expires) {
+		p.mu.Unlock()
+		return nil
+	}
+	ent.repeats++
+	id, repeats := ent.interactionID, ent.repeats
+	p.mu.Unlock()
+
+	e.Draft.Drop = true
+	return p.store.SaveAttributes(ctx, id, map[string]any{RepeatAttribute: repeats})
+}
+
+// OnPostStore remembers a stored interaction for its repeats to be collapsed
+// into.
+func (p *Plugin) OnPostStore(ctx context.Context, e *events.Event) error {
+	if e.InteractionID == 0 || hasCredentials(e.Draft) {
+		return nil
+	}
+	window, err := p.windowFor(ctx, e.Draft.TokenID)
+	if err != nil || window <= 0 {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.entries[keyOf(e.Draft)] = &entry{interactionID: e.InteractionID, expires: p.now().Add(window)}
+	return nil
+}
+
+func (p *Plugin) windowFor(ctx context.Context, tokenID int64) (time.Duration, error) {
+	var cfg Config
+	ok, err := p.tokens.Get(ctx, tokenID, ID, &cfg)
+	if err != nil {
+		return 0, fmt.Errorf("load dedup: %w", err)
+	}
+	if !ok {
+		return p.window, nil
+	}
+	d, _ := time.ParseDuration(cfg.Window)
+	return d, nil
+}
+
+// prune forgets entries whose window has passed.
+func (p *Plugin) prune() {
+	now := p.now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for k, ent := range p.entries {
+		if !now.Before(ent.expires) {
+			delete(p.entries, k)
+		}
+	}
+}
+
+func keyOf(d *events.InteractionDraft) key {
+	k := key{tokenID: d.TokenID, remoteIP: d.RemoteIP, kind: d.Kind, request: d.Summary}
+	switch {
+	case d.HTTP != nil:
+		k.request = d.HTTP.Method + " " + d.HTTP.Path + "?" + d.HTTP.Query
+		h := fnv.New64a()
+		_, _ = h.Write(d.HTTP.Body)
+		k.body = h.Sum64()
+	case d.DNS != nil:
+		k.request = d.DNS.QName + " " + strconv.Itoa(d.DNS.QType)
+	}
+	return k
+}
+
+// hasCredentials reports whether d is an HTTP request with an Authorization
+// or Proxy-Authorization header.
+func hasCredentials(d *events.InteractionDraft) bool {
+	if d.HTTP == nil {
+		return false
+	}
+	return len(d.HTTP.Headers["Authorization"]) > 0 || len(d.HTTP.Headers["Proxy-Authorization"]) > 0
+}
@@ -0,0 +1,256 @@
+package dedup
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/basicauth"
+	"github.com/rsclarke/oastrix/internal/plugins/ntlm"
+	"github.com/rsclarke/oastrix/internal/plugins/plugintest"
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// memStore assigns interaction IDs and keeps attributes in memory.
+type memStore struct {
+	nextID int64
+	attrs  map[int64]map[string]any
+}
+
+func (m *memStore) ResolveTokenID(context.Context, string) (int64, bool, error) {
+	return 0, false, nil
+}
+
+func (m *memStore) CreateInteraction(context.Context, *events.InteractionDraft) (int64, error) {
+	m.nextID++
+	return m.nextID, nil
+}
+
+func (m *memStore) SaveAttributes(_ context.Context, id int64, attrs map[string]any) error {
+	if m.attrs[id] == nil {
+		m.attrs[id] = make(map[string]any)
+	}
+	for k, v := range attrs {
+		m.attrs[id][k] = v
+	}
+	return nil
+}
+
+func (m *memStore) GetInteractionsByToken(context.Context, int64, int) ([]models.Interaction, error) {
+	return nil, nil
+}
+
+func (m *memStore) GetAttributes(_ context.Context, id int64) (map[string]any, error) {
+	return m.attrs[id], nil
+}
+
+type fixture struct {
+	p     *Plugin
+	store *memStore
+	now   time.Time
+}
+
+func setup(t *testing.T, window time.Duration, tokens plugintest.TokenConfigs[Config]) *fixture {
+	t.Helper()
+	f := &fixture{store: &memStore{attrs: make(map[int64]map[string]any)}, now: time.Unix(1700000000, 0)}
+	f.p = New(window)
+	f.p.now = func() time.Time { return f.now }
+	if err := f.p.Init(plugins.InitContext{Logger: zap.NewNop(), Store: f.store, Tokens: tokens}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return f
+}
+
+// process runs draft through the plugin's hooks and the store, returning the
+// stored interaction's ID or zero if it was dropped.
+func (f *fixture) process(t *testing.T, draft *events.InteractionDraft) int64 {
+	t.Helper()
+	e := &events.Event{Draft: draft}
+	if err := f.p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if !draft.Drop {
+		e.InteractionID, _ = f.store.CreateInteraction(context.Background(), draft)
+	}
+	if err := f.p.OnPostStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPostStore failed: %v", err)
+	}
+	return e.InteractionID
+}
+
+func httpDraft(tokenID int64, ip, path, body string) *events.InteractionDraft {
+	return &events.InteractionDraft{
+		TokenID:  tokenID,
+		Kind:     events.KindHTTP,
+		RemoteIP: ip,
+		HTTP:     &events.HTTPDraft{Method: "GET", Path: path, Body: []byte(body)},
+	}
+}
+
+func TestCollapsesRepeats(t *testing.T) {
+	f := setup(t, time.Minute, plugintest.TokenConfigs[Config]{})
+
+	first := f.process(t, httpDraft(1, "192.0.2.1", "/", ""))
+	if first == 0 {
+		t.Fatal("first interaction dropped")
+	}
+	for range 3 {
+		if id := f.process(t, httpDraft(1, "192.0.2.1", "/", "")); id != 0 {
+			t.Fatalf("repeat stored as %d", id)
+		}
+	}
+	if got := f.store.attrs[first][RepeatAttribute]; got != 3 {
+		t.Errorf("repeat count = %v, want 3", got)
+	}
+
+	// Different IPs, paths, bodies and tokens are not repeats.
+	for _, d := range []*events.InteractionDraft{
+		httpDraft(1, "192.0.2.2", "/", ""),
+		httpDraft(1, "192.0.2.1", "/other", ""),
+		httpDraft(1, "192.0.2.1", "/", "body"),
+		httpDraft(2, "192.0.2.1", "/", ""),
+		{TokenID: 1, Kind: events.KindDNS, RemoteIP: "192.0.2.1", DNS: &events.DNSDraft{QName: "x.example.com", QType: 1}},
+	} {
+		if id := f.process(t, d); id == 0 {
+			t.Errorf("%+v dropped as a repeat", d)
+		}
+	}
+
+	// Once the window passes, the next one is stored and counted afresh.
+	f.now = f.now.Add(time.Minute)
+	second := f.process(t, httpDraft(1, "192.0.2.1", "/", ""))
+	if second == 0 {
+		t.Fatal("interaction after the window dropped")
+	}
+	f.process(t, httpDraft(1, "192.0.2.1", "/", ""))
+	if got := f.store.attrs[second][RepeatAttribute]; got != 1 {
+		t.Errorf("repeat count after the window = %v, want 1", got)
+	}
+}
+
+func TestTokenWindow(t *testing.T) {
+	f := setup(t, 0, plugintest.TokenConfigs[Config]{1: {Window: "1m"}, 2: {Window: "0s"}})
+
+	for tokenID, wantDropped := range map[int64]bool{1: true, 2: false, 3: false} {
+		f.process(t, httpDraft(tokenID, "192.0.2.1", "/", ""))
+		dropped := f.process(t, httpDraft(tokenID, "192.0.2.1", "/", "")) == 0
+		if dropped != wantDropped {
+			t.Errorf("token %d: repeat dropped = %v, want %v", tokenID, dropped, wantDropped)
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	f := setup(t, time.Minute, plugintest.TokenConfigs[Config]{})
+	f.process(t, httpDraft(1, "192.0.2.1", "/", ""))
+	f.now = f.now.Add(time.Minute)
+	f.p.prune()
+	if n := len(f.p.entries); n != 0 {
+		t.Errorf("%d entries left after prune, want 0", n)
+	}
+}
+
+// pluginConfigs serves every plugin's configuration for token 1 from memory.
+type pluginConfigs map[string]any
+
+func (c pluginConfigs) Get(_ context.Context, tokenID int64, pluginID string, out any) (bool, error) {
+	cfg, ok := c[pluginID]
+	if !ok || tokenID != 1 {
+		return false, nil
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(b, out)
+}
+
+// authenticateMsg builds an NTLMv1 authenticate message from alice.
+func authenticateMsg() []byte {
+	payloads := [][]byte{make([]byte, 24), make([]byte, 24), []byte("C\x00O\x00R\x00P\x00"), []byte("a\x00l\x00i\x00c\x00e\x00"), nil, nil}
+	msg := []byte("NTLMSSP\x00")
+	msg = binary.LittleEndian.AppendUint32(msg, 3)
+	offset := 64
+	for _, b := range payloads {
+		msg = binary.LittleEndian.AppendUint16(msg, uint16(len(b)))
+		msg = binary.LittleEndian.AppendUint16(msg, uint16(len(b)))
+		msg = binary.LittleEndian.AppendUint32(msg, uint32(offset))
+		offset += len(b)
+	}
+	msg = binary.LittleEndian.AppendUint32(msg, 0x201) // Unicode and NTLM
+	for _, b := range payloads {
+		msg = append(msg, b...)
+	}
+	return msg
+}
+
+func TestCredentialRetriesStored(t *testing.T) {
+	store := &memStore{attrs: make(map[int64]map[string]any)}
+	tokens := pluginConfigs{
+		ID:           Config{Window: "1m"},
+		basicauth.ID: basicauth.Config{},
+		ntlm.ID:      ntlm.Config{},
+	}
+	pipeline := plugins.NewPipeline(zap.NewNop())
+	pipeline.SetStore(store)
+	for _, p := range []plugins.Plugin{New(time.Minute), basicauth.New(), ntlm.New()} {
+		if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Store: store, Tokens: tokens}); err != nil {
+			t.Fatalf("%s: Init failed: %v", p.ID(), err)
+		}
+		pipeline.Register(p)
+	}
+
+	// process sends a GET / to token 1 presenting authorization, if any, and
+	// fails unless it is stored.
+	process := func(authorization string) *events.HTTPEvent {
+		t.Helper()
+		draft := httpDraft(1, "192.0.2.1", "/", "")
+		if authorization != "" {
+			draft.HTTP.Headers = map[string][]string{"Authorization": {authorization}}
+		}
+		e := &events.HTTPEvent{Event: events.Event{Draft: draft}, Resp: &events.HTTPResponsePlan{}}
+		if err := pipeline.ProcessHTTP(context.Background(), e); err != nil {
+			t.Fatalf("ProcessHTTP failed: %v", err)
+		}
+		if e.InteractionID == 0 {
+			t.Fatalf("request with authorization %q dropped as a repeat", authorization)
+		}
+		return e
+	}
+
+	first := process("")
+	e := process("Basic " + base64.StdEncoding.EncodeToString([]byte("alice:secret")))
+	if got, ok := store.attrs[e.InteractionID][basicauth.CredentialsAttribute].(basicauth.Credentials); !ok || got.Password != "secret" {
+		t.Errorf("basic auth retry attributes = %v", store.attrs[e.InteractionID])
+	}
+
+	negotiate := []byte("NTLMSSP\x00\x01\x00\x00\x00\x05\x02\x00\x00")
+	negotiate = append(negotiate, make([]byte, 16)...)
+	e = process("NTLM " + base64.StdEncoding.EncodeToString(negotiate))
+	if challenge := e.Resp.Headers["WWW-Authenticate"]; len(challenge) <= len("NTLM ") {
+		t.Errorf("negotiate answered with %q, want a challenge", challenge)
+	}
+	e = process("NTLM " + base64.StdEncoding.EncodeToString(authenticateMsg()))
+	if got, ok := store.attrs[e.InteractionID][ntlm.CaptureAttribute].(ntlm.Capture); !ok || got.Username != "alice" {
+		t.Errorf("ntlm retry attributes = %v", store.attrs[e.InteractionID])
+	}
+
+	// Repeats without credentials are still collapsed into the first.
+	e = &events.HTTPEvent{Event: events.Event{Draft: httpDraft(1, "192.0.2.1", "/", "")}, Resp: &events.HTTPResponsePlan{}}
+	if err := pipeline.ProcessHTTP(context.Background(), e); err != nil {
+		t.Fatalf("ProcessHTTP failed: %v", err)
+	}
+	if e.InteractionID != 0 {
+		t.Errorf("repeat without credentials stored as %d", e.InteractionID)
+	}
+	if got := store.attrs[first.InteractionID][RepeatAttribute]; got != 1 {
+		t.Errorf("repeat count = %v, want 1", got)
+	}
+}
@@ -0,0 +1,343 @@
+// Package discord implements a feature plugin that posts interactions to a
+// Discord channel through a webhook, as embeds summarizing each one.
+package discord
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/notify"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "discord"
+
+// Discord's limits on embed text, in characters.
+const (
+	maxTitle       = 256
+	maxDescription = 4096
+	maxFieldValue  = 1024
+)
+
+// kindColors are the embed colors of interaction kinds; other kinds are
+// grey.
+var kindColors = map[events.Kind]int{
+	events.KindHTTP:  0x5865f2,
+	events.KindDNS:   0x57f287,
+	events.KindSMTP:  0xfee75c,
+	events.KindFlood: 0xed4245,
+}
+
+// GlobalConfig sets which tokens are notified about server-wide.
+type GlobalConfig struct {
+	AllTokens bool          `json:"all_tokens"`      // notify about tokens without a Config
+	Kinds     []string      `json:"kinds,omitempty"` // interaction kinds notified; all when empty
+	Filter    notify.Filter `json:"filter"`          // applies to every token
+}
+
+// Validate checks the kinds and filter.
+func (c GlobalConfig) Validate() error {
+	if err := notify.ValidateKinds(c.Kinds); err != nil {
+		return err
+	}
+	return c.Filter.Validate()
+}
+
+// Config enables notifications for a token, overriding the server-wide
+// settings.
+type Config struct {
+	Enabled bool     `json:"enabled"`
+	Kinds   []string `json:"kinds,omitempty"` // interaction kinds notified; all when empty
+}
+
+// Validate checks that every kind is known.
+func (c Config) Validate() error { return notify.ValidateKinds(c.Kinds) }
+
+// Plugin posts stored interactions to WebhookURL, for tokens whose Config
+// enables it, or every token when the GlobalConfig's AllTokens is set.
+// Notifications are sent as the interaction is stored, so run the pipeline
+// with workers to keep them off the response path. While Discord rate limits
+// the webhook, notifications are dropped.
+type Plugin struct {
+	// WebhookURL is the Discord webhook notifications are posted to. The
+	// plugin does nothing when it is empty.
+	WebhookURL string
+	// Client posts notifications.
+	Client *http.Client
+
+	store  plugins.Store
+	config plugins.GlobalConfigView
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+	now    func() time.Time
+
+	limiter  notify.Limiter
+	throttle notify.Throttle
+}
+
+// New creates a new discord Plugin posting to webhookURL.
+func New(webhookURL string) *Plugin {
+	return &Plugin{
+		WebhookURL: webhookURL,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		now:        time.Now,
+	}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if p.WebhookURL != "" {
+		u, err := url.Parse(p.WebhookURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid webhook URL %q", p.WebhookURL)
+		}
+	}
+	if ctx.Config == nil {
+		return errors.New("global config view required")
+	}
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.store = ctx.Store
+	p.config = ctx.Config
+	p.tokens = ctx.Tokens
+	return nil
+}
+
+// Config returns the plugin's settings. The webhook URL is a credential, so
+// only whether one is set is reported.
+func (p *Plugin) Config() map[string]any {
+	return map[string]any{"webhook": p.WebhookURL != ""}
+}
+
+// NewGlobalConfig returns a new GlobalConfig for the server-wide
+// configuration to be decoded into.
+func (p *Plugin) NewGlobalConfig() any { return new(GlobalConfig) }
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnPostStore posts the stored interaction if its token and kind are
+// notified about and it passes the filter.
+func (p *Plugin) OnPostStore(ctx context.Context, e *events.Event) error {
+	if p.WebhookURL == "" || e.InteractionID == 0 {
+		return nil
+	}
+	wanted, err := p.notifies(ctx, e)
+	if err != nil || !wanted {
+		return err
+	}
+	ok, dropped := p.limiter.Allow(p.now())
+	if dropped > 0 {
+		p.logger.Warn("dropped notifications while rate limited", zap.Int("dropped", dropped))
+	}
+	if !ok {
+		return nil
+	}
+	return p.post(ctx, message{
+		Username:        "oastrix",
+		Embeds:          []embed{embedFor(e.Draft, p.now())},
+		AllowedMentions: allowedMentions{Parse: []string{}},
+	})
+}
+
+// notifies reports whether the token's or server-wide configuration notifies
+// about e, counting it against the filter's rate limit if so.
+func (p *Plugin) notifies(ctx context.Context, e *events.Event) (bool, error) {
+	d := e.Draft
+	var global GlobalConfig
+	if err := p.config.Get(ID, &global); err != nil {
+		return false, fmt.Errorf("load discord global config: %w", err)
+	}
+	enabled, ks := global.AllTokens, global.Kinds
+
+	var cfg Config
+	ok, err := p.tokens.Get(ctx, d.TokenID, ID, &cfg)
+	if err != nil {
+		return false, fmt.Errorf("load discord: %w", err)
+	}
+	if ok {
+		enabled = cfg.Enabled
+		if len(cfg.Kinds) > 0 {
+			ks = cfg.Kinds
+		}
+	}
+	if !enabled || !notify.WantsKind(ks, d.Kind) {
+		return false, nil
+	}
+	return global.Filter.Pass(ctx, p.store, e, &p.throttle, ID, p.now(), p.logger)
+}
+
+func (p *Plugin) post(ctx context.Context, msg message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post to discord: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		wait := retryAfter(resp.Header, respBody)
+		p.limiter.Limit(p.now().Add(wait))
+		return fmt.Errorf("discord rate limited the webhook for %s", wait)
+	case resp.StatusCode/100 != 2:
+		return fmt.Errorf("discord webhook returned %s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	return nil
+}
+
+// retryAfter returns how long Discord asked to wait before posting again,
+// from the Retry-After header or the response's retry_after, in seconds.
+func retryAfter(h http.Header, body []byte) time.Duration {
+	if s, err := strconv.ParseFloat(h.Get("Retry-After"), 64); err == nil && s > 0 {
+		return time.Duration(s * float64(time.Second))
+	}
+	var rl struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	if json.Unmarshal(body, &rl) == nil && rl.RetryAfter > 0 {
+		return time.Duration(rl.RetryAfter * float64(time.Second))
+	}
+	return time.Second
+}
+
+// message is the body of a webhook execution.
+type message struct {
+	Username        string          `json:"username,omitempty"`
+	Embeds          []embed         `json:"embeds"`
+	AllowedMentions allowedMentions `json:"allowed_mentions"`
+}
+
+// allowedMentions with no types to parse stops text sent by targets from
+// pinging anyone.
+type allowedMentions struct {
+	Parse []string `json:"parse"`
+}
+
+type embed struct {
+	Title       string       `json:"title"`
+	Description string       `json:"description,omitempty"`
+	Color       int          `json:"color"`
+	Timestamp   string       `json:"timestamp"`
+	Fields      []embedField `json:"fields,omitempty"`
+}
+
+type embedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline,omitempty"`
+}
+
+// embedFor builds the embed describing d, timestamped with when it occurred,
+// or now if that is unknown.
+func embedFor(d *events.InteractionDraft, now time.Time) embed {
+	at := now
+	if d.OccurredAt > 0 {
+		at = time.Unix(d.OccurredAt, 0)
+	}
+	color, ok := kindColors[d.Kind]
+	if !ok {
+		color = 0x95a5a6
+	}
+	e := embed{
+		Title:       notify.Truncate(fmt.Sprintf("%s interaction on %s", strings.ToUpper(string(d.Kind)), d.TokenValue), maxTitle),
+		Description: codeBlock(d.Summary, maxDescription),
+		Color:       color,
+		Timestamp:   at.UTC().Format(time.RFC3339),
+	}
+
+	remote := d.RemoteIP
+	if d.RemotePort > 0 {
+		remote = fmt.Sprintf("%s:%d", d.RemoteIP, d.RemotePort)
+	}
+	e.addField("Remote", remote, true)
+	if d.TLS {
+		e.addField("TLS", "yes", true)
+	}
+
+	switch {
+	case d.HTTP != nil:
+		e.addField("Request", d.HTTP.Method+" "+requestURI(d.HTTP), false)
+		e.addField("Host", d.HTTP.Host, true)
+		if ua := firstHeader(d.HTTP.Headers, "User-Agent"); ua != "" {
+			e.addField("User-Agent", ua, false)
+		}
+		if len(d.HTTP.Body) > 0 {
+			e.addField("Body", fmt.Sprintf("%d bytes", len(d.HTTP.Body)), true)
+		}
+	case d.DNS != nil:
+		e.addField("Query", d.DNS.QName, false)
+		e.addField("Type", dns.TypeToString[uint16(d.DNS.QType)], true)
+		e.addField("Protocol", d.DNS.Protocol, true)
+	case d.Protocol != nil:
+		for _, k := range slices.Sorted(maps.Keys(d.Protocol.Fields)) {
+			e.addField(k, fmt.Sprint(d.Protocol.Fields[k]), true)
+		}
+	}
+	return e
+}
+
+// addField adds a field unless value is empty, truncated to Discord's limit.
+func (e *embed) addField(name, value string, inline bool) {
+	if value == "" {
+		return
+	}
+	e.Fields = append(e.Fields, embedField{Name: name, Value: notify.Truncate(value, maxFieldValue), Inline: inline})
+}
+
+func requestURI(h *events.HTTPDraft) string {
+	if h.Query == "" {
+		return h.Path
+	}
+	return h.Path + "?" + h.Query
+}
+
+func firstHeader(headers map[string][]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// codeBlock formats s as a Markdown code block of at most limit characters,
+// so attacker-controlled text cannot mention users or render links.
+func codeBlock(s string, limit int) string {
+	if s == "" {
+		return ""
+	}
+	s = strings.ReplaceAll(s, "```", "`\u200b``")
+	return "```\n" + notify.Truncate(s, limit-8) + "\n```"
+}
@@ -0,0 +1,152 @@
+package discord
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/notify"
+	"github.com/rsclarke/oastrix/internal/plugins/plugintest"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// webhook records the messages posted to it, answering with status.
+type webhook struct {
+	status   int
+	messages []message
+}
+
+func (w *webhook) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var msg message
+	_ = json.Unmarshal(body, &msg)
+	w.messages = append(w.messages, msg)
+	if w.status == http.StatusTooManyRequests {
+		rw.Header().Set("Retry-After", "2.5")
+	}
+	rw.WriteHeader(w.status)
+}
+
+func newPlugin(t *testing.T, wh *webhook, global *GlobalConfig, tokens map[int64]Config) *Plugin {
+	t.Helper()
+	srv := httptest.NewServer(wh)
+	t.Cleanup(srv.Close)
+	p := New(srv.URL)
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Config: plugintest.GlobalConfig{Value: global}, Tokens: plugintest.TokenConfigs[Config](tokens)}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p
+}
+
+func httpEvent(tokenID int64) *events.Event {
+	return &events.Event{
+		InteractionID: 1,
+		Draft: &events.InteractionDraft{
+			TokenValue: "tok123",
+			TokenID:    tokenID,
+			Kind:       events.KindHTTP,
+			OccurredAt: 1700000000,
+			RemoteIP:   "192.0.2.1",
+			RemotePort: 40000,
+			Summary:    "GET /x?y=1 HTTP/1.1",
+			HTTP: &events.HTTPDraft{
+				Method: "GET", Host: "tok123.example.com", Path: "/x", Query: "y=1",
+				Headers: map[string][]string{"User-Agent": {"@everyone curl/8.0"}},
+			},
+		},
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	tests := []struct {
+		name    string
+		global  *GlobalConfig
+		tokens  map[int64]Config
+		tokenID int64
+		want    bool
+	}{
+		{"not enabled", nil, nil, 1, false},
+		{"enabled for token", nil, map[int64]Config{1: {Enabled: true}}, 1, true},
+		{"enabled for another token", nil, map[int64]Config{2: {Enabled: true}}, 1, false},
+		{"all tokens", &GlobalConfig{AllTokens: true}, nil, 1, true},
+		{"disabled for token", &GlobalConfig{AllTokens: true}, map[int64]Config{1: {}}, 1, false},
+		{"kind filtered out", &GlobalConfig{AllTokens: true, Kinds: []string{"dns"}}, nil, 1, false},
+		{"filtered out", &GlobalConfig{AllTokens: true, Filter: notify.Filter{RemoteIPs: []string{"10.0.0.0/8"}}}, nil, 1, false},
+		{"filter applies to tokens", &GlobalConfig{Filter: notify.Filter{IgnoreIPs: []string{"192.0.2.1"}}}, map[int64]Config{1: {Enabled: true}}, 1, false},
+		{"token kinds override", &GlobalConfig{Kinds: []string{"dns"}}, map[int64]Config{1: {Enabled: true, Kinds: []string{"http"}}}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wh := &webhook{status: http.StatusNoContent}
+			p := newPlugin(t, wh, tt.global, tt.tokens)
+			if err := p.OnPostStore(context.Background(), httpEvent(tt.tokenID)); err != nil {
+				t.Fatalf("OnPostStore failed: %v", err)
+			}
+			if got := len(wh.messages) == 1; got != tt.want {
+				t.Errorf("notified = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	wh := &webhook{status: http.StatusNoContent}
+	p := newPlugin(t, wh, &GlobalConfig{AllTokens: true}, nil)
+	if err := p.OnPostStore(context.Background(), httpEvent(1)); err != nil {
+		t.Fatalf("OnPostStore failed: %v", err)
+	}
+	if len(wh.messages) != 1 || len(wh.messages[0].Embeds) != 1 {
+		t.Fatalf("messages = %+v, want one embed", wh.messages)
+	}
+	msg := wh.messages[0]
+	if msg.AllowedMentions.Parse == nil || len(msg.AllowedMentions.Parse) != 0 {
+		t.Errorf("allowed mentions = %+v, want none", msg.AllowedMentions)
+	}
+	e := msg.Embeds[0]
+	if e.Title != "HTTP interaction on tok123" || e.Timestamp != "2023-11-14T22:13:20Z" || e.Color != kindColors[events.KindHTTP] {
+		t.Errorf("embed = %+v", e)
+	}
+	if !strings.Contains(e.Description, "GET /x?y=1 HTTP/1.1") {
+		t.Errorf("description = %q, want the summary", e.Description)
+	}
+	fields := map[string]string{}
+	for _, f := range e.Fields {
+		fields[f.Name] = f.Value
+	}
+	if fields["Remote"] != "192.0.2.1:40000" || fields["Request"] != "GET /x?y=1" || fields["User-Agent"] != "@everyone curl/8.0" {
+		t.Errorf("fields = %v", fields)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	wh := &webhook{status: http.StatusTooManyRequests}
+	p := newPlugin(t, wh, &GlobalConfig{AllTokens: true}, nil)
+	now := time.Unix(1700000000, 0)
+	p.now = func() time.Time { return now }
+
+	if err := p.OnPostStore(context.Background(), httpEvent(1)); err == nil {
+		t.Fatal("expected an error when rate limited")
+	}
+	wh.status = http.StatusNoContent
+	if err := p.OnPostStore(context.Background(), httpEvent(1)); err != nil || len(wh.messages) != 1 {
+		t.Fatalf("while limited: err = %v, %d posts; want the notification dropped", err, len(wh.messages))
+	}
+	now = now.Add(3 * time.Second)
+	if err := p.OnPostStore(context.Background(), httpEvent(1)); err != nil || len(wh.messages) != 2 {
+		t.Fatalf("after limit: err = %v, %d posts; want the notification posted", err, len(wh.messages))
+	}
+}
+
+func TestCodeBlock(t *testing.T) {
+	if got := codeBlock("a```b", 100); strings.Count(got, "```") != 2 {
+		t.Errorf("codeBlock = %q, want the fence escaped", got)
+	}
+}
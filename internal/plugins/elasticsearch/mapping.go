@@ -0,0 +1,55 @@
+package elasticsearch
+
+import "encoding/json"
+
+// DefaultMapping maps the fields of an interaction's document. Attributes
+// holding text are keywords, so they can be filtered and aggregated on;
+// request headers, bodies and responses are stored but not indexed, so
+// client-controlled names cannot grow the mapping.
+var DefaultMapping = json.RawMessage(`{
+	"dynamic_templates": [
+		{"attribute_strings": {
+			"path_match": "attributes.*",
+			"match_mapping_type": "string",
+			"mapping": {"type": "keyword", "ignore_above": 1024}
+		}}
+	],
+	"properties": {
+		"@timestamp": {"type": "date"},
+		"id": {"type": "long"},
+		"token": {"type": "keyword"},
+		"kind": {"type": "keyword"},
+		"occurred_at": {"type": "date"},
+		"remote": {"properties": {
+			"ip": {"type": "ip"},
+			"port": {"type": "integer"}
+		}},
+		"tls": {"type": "boolean"},
+		"summary": {"type": "text"},
+		"http": {"properties": {
+			"request": {"properties": {
+				"method": {"type": "keyword"},
+				"scheme": {"type": "keyword"},
+				"host": {"type": "keyword"},
+				"path": {"type": "keyword", "ignore_above": 2048},
+				"query": {"type": "keyword", "ignore_above": 2048},
+				"proto": {"type": "keyword"},
+				"headers": {"type": "object", "enabled": false},
+				"body": {"type": "binary"}
+			}},
+			"response": {"type": "object", "enabled": false}
+		}},
+		"dns": {"properties": {
+			"query": {"properties": {
+				"qname": {"type": "keyword"},
+				"qtype": {"type": "integer"},
+				"qclass": {"type": "integer"},
+				"rd": {"type": "boolean"},
+				"opcode": {"type": "integer"},
+				"dns_id": {"type": "integer"},
+				"protocol": {"type": "keyword"}
+			}},
+			"response": {"type": "object", "enabled": false}
+		}}
+	}
+}`)
@@ -0,0 +1,417 @@
+// Package elasticsearch implements a feature plugin that indexes stored
+// interactions into Elasticsearch or OpenSearch with the bulk API.
+package elasticsearch
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/bulk"
+	"github.com/rsclarke/oastrix/internal/siem"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the plugin_config key.
+const ID = "elasticsearch"
+
+// DefaultIndex is the index, or index prefix, written to when none is set.
+const DefaultIndex = "oastrix-interactions"
+
+// Index rotations, appending the interaction's date to the index name.
+const (
+	RotateDaily   = "daily"
+	RotateMonthly = "monthly"
+)
+
+// rotateLayouts are the date suffixes of each rotation.
+var rotateLayouts = map[string]string{
+	RotateDaily:   "2006.01.02",
+	RotateMonthly: "2006.01",
+}
+
+// GlobalConfig sets the cluster and index interactions are written to.
+// Nothing is written until URL is set.
+type GlobalConfig struct {
+	URL          string          `json:"url"` // e.g. https://es.example.com:9200
+	Username     string          `json:"username,omitempty"`
+	Password     string          `json:"password,omitempty" secret:"true"`
+	APIKey       string          `json:"api_key,omitempty" secret:"true"` // base64 API key, used instead of a username
+	Index        string          `json:"index,omitempty"`                 // DefaultIndex when empty
+	Rotate       string          `json:"rotate,omitempty"`                // RotateDaily or RotateMonthly; one index when empty
+	DataStream   bool            `json:"data_stream,omitempty"`           // Index is a data stream, written with create
+	SkipTemplate bool            `json:"skip_template,omitempty"`         // leave the index template to the cluster's operators
+	Mapping      json.RawMessage `json:"mapping,omitempty"`               // the template's mappings; DefaultMapping when empty
+	ILMPolicy    string          `json:"ilm_policy,omitempty"`            // set as the template's index.lifecycle.name
+	BatchSize    int             `json:"batch_size,omitempty"`            // bulk.DefaultBatchSize when zero
+	MaxAttempts  int             `json:"max_attempts,omitempty"`          // bulk.DefaultMaxAttempts when zero
+}
+
+// Validate checks the URL, credentials, index name, rotation, mapping and
+// batching limits.
+func (c GlobalConfig) Validate() error {
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid url %q: want an http or https URL", c.URL)
+		}
+	}
+	if c.APIKey != "" && c.Username != "" {
+		return errors.New("api_key and username are mutually exclusive")
+	}
+	if err := validateIndex(c.index()); err != nil {
+		return err
+	}
+	if c.Rotate != "" {
+		if _, ok := rotateLayouts[c.Rotate]; !ok {
+			return fmt.Errorf("invalid rotate %q: want %s or %s", c.Rotate, RotateDaily, RotateMonthly)
+		}
+		if c.DataStream {
+			return errors.New("rotate and data_stream are mutually exclusive: data streams roll over by ILM")
+		}
+	}
+	if len(c.Mapping) > 0 {
+		var m map[string]any
+		if err := json.Unmarshal(c.Mapping, &m); err != nil {
+			return fmt.Errorf("invalid mapping: want a JSON object: %w", err)
+		}
+	}
+	if c.BatchSize < 0 || c.BatchSize > bulk.MaxQueued {
+		return fmt.Errorf("invalid batch_size %d: want at most %d", c.BatchSize, bulk.MaxQueued)
+	}
+	if c.MaxAttempts < 0 {
+		return fmt.Errorf("invalid max_attempts %d", c.MaxAttempts)
+	}
+	return nil
+}
+
+// validateIndex checks name against the cluster's rules for index names,
+// leaving room for a rotation's suffix.
+func validateIndex(name string) error {
+	if len(name) > 200 || name != strings.ToLower(name) || strings.ContainsAny(name, `\/*?"<>| ,#:`) ||
+		strings.IndexAny(name, "-_+.") == 0 {
+		return fmt.Errorf("invalid index %q: want at most 200 lowercase characters, not starting with -, _, + or .", name)
+	}
+	return nil
+}
+
+func (c GlobalConfig) index() string {
+	return cmp.Or(c.Index, DefaultIndex)
+}
+
+// indexFor returns the index an interaction that occurred at t is written
+// to.
+func (c GlobalConfig) indexFor(t time.Time) string {
+	if layout, ok := rotateLayouts[c.Rotate]; ok {
+		return c.index() + "-" + t.UTC().Format(layout)
+	}
+	return c.index()
+}
+
+func (c GlobalConfig) batchSize() int {
+	return cmp.Or(c.BatchSize, bulk.DefaultBatchSize)
+}
+
+func (c GlobalConfig) maxAttempts() int {
+	return cmp.Or(c.MaxAttempts, bulk.DefaultMaxAttempts)
+}
+
+// Plugin indexes each stored interaction into the cluster in its
+// GlobalConfig, as its v2 representation with the attributes flattened to
+// dotted keys and an @timestamp. Each interaction's ID is its document ID,
+// so a batch that is retried does not index duplicates. Before the first
+// batch, the plugin installs an index template matching the index with the
+// configured mapping.
+//
+// Interactions are queued and sent in batches once BatchSize are queued or
+// every bulk.FlushInterval; a batch the cluster fails is retried with
+// backoff, up to MaxAttempts times. The queue is held in memory, so
+// interactions not yet sent when the server stops are lost.
+type Plugin struct {
+	// Client sends requests to the cluster.
+	Client *http.Client
+
+	config plugins.GlobalConfigView
+	logger *zap.Logger
+	now    func() time.Time
+
+	queue bulk.Queue
+
+	mu        sync.Mutex
+	templated string // the template last installed, as its URL and body
+}
+
+// New creates a new elasticsearch Plugin.
+func New() *Plugin {
+	return &Plugin{
+		Client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Init initializes the plugin with the given context and schedules flushing
+// the queue.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Config == nil {
+		return errors.New("global config view required")
+	}
+	p.config = ctx.Config
+	if ctx.Scheduler != nil {
+		ctx.Scheduler.Every(bulk.FlushInterval, p.flush)
+	}
+	return nil
+}
+
+// NewGlobalConfig returns a new GlobalConfig for the server-wide
+// configuration to be decoded into.
+func (p *Plugin) NewGlobalConfig() any { return new(GlobalConfig) }
+
+// OnPostStore queues the stored interaction, sending the queue if a batch is
+// ready.
+func (p *Plugin) OnPostStore(ctx context.Context, e *events.Event) error {
+	if e.InteractionID == 0 {
+		return nil
+	}
+	var cfg GlobalConfig
+	if err := p.config.Get(ID, &cfg); err != nil {
+		return fmt.Errorf("load elasticsearch global config: %w", err)
+	}
+	if cfg.URL == "" {
+		return nil
+	}
+
+	doc, err := document(e)
+	if err != nil {
+		return fmt.Errorf("encode document: %w", err)
+	}
+	op := "index"
+	if cfg.DataStream {
+		op = "create"
+	}
+	action, err := json.Marshal(map[string]any{op: map[string]string{
+		"_index": cfg.indexFor(time.Unix(e.Draft.OccurredAt, 0)),
+		"_id":    strconv.FormatInt(e.InteractionID, 10),
+	}})
+	if err != nil {
+		return fmt.Errorf("encode action: %w", err)
+	}
+	item := append(append(action, '\n'), doc...)
+	if p.queue.Add(append(item, '\n')) >= cfg.batchSize() {
+		return p.flush(ctx)
+	}
+	return nil
+}
+
+// document renders e as the JSON document indexed for it.
+func document(e *events.Event) ([]byte, error) {
+	b, err := json.Marshal(siem.Interaction(e))
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	attrs := make(map[string]any)
+	if m, ok := doc["attributes"].(map[string]any); ok {
+		for k, v := range m {
+			flatten(k, v, attrs)
+		}
+	}
+	doc["attributes"] = attrs
+	doc["@timestamp"] = doc["occurred_at"]
+	return json.Marshal(doc)
+}
+
+// flatten adds v to out under key, or each of its fields under key and the
+// field's name joined by a dot if it is an object.
+func flatten(key string, v any, out map[string]any) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) == 0 {
+		out[key] = v
+		return
+	}
+	for k, fv := range m {
+		flatten(key+"."+k, fv, out)
+	}
+}
+
+// flush sends the queued interactions, installing the index template first
+// if it has not been.
+func (p *Plugin) flush(ctx context.Context) error {
+	var cfg GlobalConfig
+	if err := p.config.Get(ID, &cfg); err != nil {
+		return fmt.Errorf("load elasticsearch global config: %w", err)
+	}
+	if cfg.URL == "" || p.queue.Len() == 0 {
+		return nil
+	}
+	if !cfg.SkipTemplate {
+		if err := p.ensureTemplate(ctx, cfg); err != nil {
+			return err
+		}
+	}
+	return p.queue.Flush(ctx, p.now(), cfg.batchSize(), cfg.maxAttempts(), func(ctx context.Context, batch [][]byte) error {
+		return p.post(ctx, cfg, batch)
+	})
+}
+
+// ensureTemplate installs the index template for cfg unless it already has
+// been.
+func (p *Plugin) ensureTemplate(ctx context.Context, cfg GlobalConfig) error {
+	mapping := cfg.Mapping
+	if len(mapping) == 0 {
+		mapping = DefaultMapping
+	}
+	tmpl := map[string]any{"mappings": mapping}
+	if cfg.ILMPolicy != "" {
+		tmpl["settings"] = map[string]any{"index.lifecycle.name": cfg.ILMPolicy}
+	}
+	body := map[string]any{
+		"index_patterns": []string{cfg.index() + "*"},
+		"template":       tmpl,
+	}
+	if cfg.DataStream {
+		body["data_stream"] = map[string]any{}
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encode index template: %w", err)
+	}
+	u := strings.TrimSuffix(cfg.URL, "/") + "/_index_template/" + url.PathEscape(cfg.index())
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.templated == u+" "+string(b) {
+		return nil
+	}
+	if _, err := p.do(ctx, cfg, http.MethodPut, u, "application/json", b); err != nil {
+		return fmt.Errorf("install index template: %w", err)
+	}
+	p.templated = u + " " + string(b)
+	return nil
+}
+
+// bulkResponse is the part of a bulk API response the plugin reads.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// post sends a batch with the bulk API. Documents the cluster already has,
+// from an earlier attempt at a data stream, count as sent. If any document
+// failed and could succeed on retry, the batch is retried; otherwise
+// rejected documents are reported and the batch is not retried.
+func (p *Plugin) post(ctx context.Context, cfg GlobalConfig, batch [][]byte) error {
+	body, err := p.do(ctx, cfg, http.MethodPost, strings.TrimSuffix(cfg.URL, "/")+"/_bulk", "application/x-ndjson", bytes.Join(batch, nil))
+	if err != nil {
+		return err
+	}
+	var resp bulkResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return fmt.Errorf("decode bulk response: %w", err)
+	}
+	if !resp.Errors {
+		return nil
+	}
+
+	var rejected int
+	var reason string
+	retry := false
+	for _, item := range resp.Items {
+		for _, r := range item {
+			switch {
+			case r.Status < 300 || r.Status == http.StatusConflict:
+			case r.Status == http.StatusTooManyRequests || r.Status >= 500:
+				retry = true
+			default:
+				rejected++
+				if reason == "" {
+					reason = r.Error.Type + ": " + r.Error.Reason
+				}
+			}
+		}
+	}
+	switch {
+	case retry:
+		return errors.New("cluster failed some documents")
+	case rejected > 0:
+		return &bulk.PermanentError{Err: fmt.Errorf("cluster rejected %d of %d documents: %s", rejected, len(batch), reason)}
+	}
+	return nil
+}
+
+// do sends a request to the cluster and returns the response body. Errors
+// retrying will not change are PermanentErrors.
+func (p *Plugin) do(ctx context.Context, cfg GlobalConfig, method, u, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, &bulk.PermanentError{Err: err}
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "oastrix-elasticsearch")
+	switch {
+	case cfg.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+cfg.APIKey)
+	case cfg.Username != "":
+		req.SetBasicAuth(cfg.Username, cfg.Password)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, req.URL.Path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: read response: %w", method, req.URL.Path, err)
+	}
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return respBody, nil
+	case code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500:
+		return nil, fmt.Errorf("%s %s: %s", method, req.URL.Path, resp.Status)
+	default:
+		return nil, &bulk.PermanentError{Err: fmt.Errorf("%s %s: %s: %s", method, req.URL.Path, resp.Status, bytes.TrimSpace(respBody[:min(len(respBody), 512)]))}
+	}
+}
+
+// Flush sends whatever is queued, within ctx's deadline.
+func (p *Plugin) Flush(ctx context.Context) error {
+	if p.config == nil || p.queue.Len() == 0 {
+		return nil
+	}
+	return p.flush(ctx)
+}
+
+// Close sends whatever is still queued, giving the cluster a few seconds to
+// take it.
+func (p *Plugin) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return p.Flush(ctx)
+}
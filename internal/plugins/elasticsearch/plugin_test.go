@@ -0,0 +1,198 @@
+package elasticsearch
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/asn"
+	"github.com/rsclarke/oastrix/internal/plugins/plugintest"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// cluster records templates and documents, failing bulk items with
+// itemStatus when it is set.
+type cluster struct {
+	mu         sync.Mutex
+	templates  map[string]map[string]any
+	actions    []map[string]map[string]string
+	docs       []map[string]any
+	itemStatus int
+	auth       string
+}
+
+func (c *cluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.auth = r.Header.Get("Authorization")
+	switch {
+	case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/_index_template/"):
+		var t map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&t)
+		c.templates[strings.TrimPrefix(r.URL.Path, "/_index_template/")] = t
+		_, _ = io.WriteString(w, `{"acknowledged":true}`)
+	case r.Method == http.MethodPost && r.URL.Path == "/_bulk":
+		sc := bufio.NewScanner(r.Body)
+		sc.Buffer(nil, 1<<20)
+		var items []string
+		for sc.Scan() {
+			var action map[string]map[string]string
+			_ = json.Unmarshal(sc.Bytes(), &action)
+			sc.Scan()
+			var doc map[string]any
+			_ = json.Unmarshal(sc.Bytes(), &doc)
+			status := 201
+			if c.itemStatus != 0 {
+				status = c.itemStatus
+			} else {
+				c.actions = append(c.actions, action)
+				c.docs = append(c.docs, doc)
+			}
+			items = append(items, `{"index":{"status":`+strconv.Itoa(status)+`,"error":{"type":"mapper_parsing_exception","reason":"failed to parse"}}}`)
+		}
+		_, _ = io.WriteString(w, `{"errors":`+strconv.FormatBool(c.itemStatus != 0)+`,"items":[`+strings.Join(items, ",")+`]}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func setup(t *testing.T, cfg GlobalConfig) (*Plugin, *cluster) {
+	t.Helper()
+	c := &cluster{templates: make(map[string]map[string]any)}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+	cfg.URL = srv.URL
+	p := New()
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Config: plugintest.GlobalConfig{Value: &cfg}}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, c
+}
+
+func stored(id int64) *events.Event {
+	return &events.Event{InteractionID: id, Draft: &events.InteractionDraft{
+		TokenValue: "tok123",
+		Kind:       events.KindHTTP,
+		OccurredAt: 1700000000,
+		RemoteIP:   "192.0.2.1",
+		HTTP:       &events.HTTPDraft{Method: "GET", Host: "tok123.example.com", Path: "/"},
+		Attributes: map[string]any{
+			asn.Attribute: asn.Info{Number: 64496, Org: "Example"},
+			"geo.country": "GB",
+			"intel_tags":  []string{"tor"},
+		},
+	}}
+}
+
+func TestIndex(t *testing.T) {
+	p, c := setup(t, GlobalConfig{APIKey: "a2V5", Rotate: RotateDaily, ILMPolicy: "oast", BatchSize: 2})
+	ctx := context.Background()
+	for id := range int64(2) {
+		if err := p.OnPostStore(ctx, stored(id+1)); err != nil {
+			t.Fatalf("OnPostStore failed: %v", err)
+		}
+	}
+
+	tmpl, ok := c.templates[DefaultIndex]
+	if !ok {
+		t.Fatalf("templates = %v, want one for %s", c.templates, DefaultIndex)
+	}
+	if patterns := tmpl["index_patterns"].([]any); patterns[0] != DefaultIndex+"*" {
+		t.Errorf("index_patterns = %v", patterns)
+	}
+	settings := tmpl["template"].(map[string]any)["settings"].(map[string]any)
+	if settings["index.lifecycle.name"] != "oast" {
+		t.Errorf("settings = %v, want the ILM policy", settings)
+	}
+	if c.auth != "ApiKey a2V5" {
+		t.Errorf("Authorization = %q", c.auth)
+	}
+
+	if len(c.docs) != 2 {
+		t.Fatalf("indexed %d documents, want 2", len(c.docs))
+	}
+	if a := c.actions[0]["index"]; a["_index"] != DefaultIndex+"-2023.11.14" || a["_id"] != "1" {
+		t.Errorf("action = %v", c.actions[0])
+	}
+	doc := c.docs[0]
+	attrs := doc["attributes"].(map[string]any)
+	if doc["@timestamp"] != "2023-11-14T22:13:20Z" || doc["token"] != "tok123" ||
+		attrs["asn.number"] != float64(64496) || attrs["asn.org"] != "Example" || attrs["geo.country"] != "GB" {
+		t.Errorf("document = %v", doc)
+	}
+	if tags, ok := attrs["intel_tags"].([]any); !ok || len(tags) != 1 {
+		t.Errorf("intel_tags = %v, want the list kept", attrs["intel_tags"])
+	}
+}
+
+func TestDataStream(t *testing.T) {
+	p, c := setup(t, GlobalConfig{Index: "logs-oastrix-default", DataStream: true})
+	if err := p.OnPostStore(context.Background(), stored(1)); err != nil {
+		t.Fatalf("OnPostStore failed: %v", err)
+	}
+	if err := p.flush(context.Background()); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	if _, ok := c.templates["logs-oastrix-default"]["data_stream"]; !ok {
+		t.Errorf("template = %v, want a data stream", c.templates["logs-oastrix-default"])
+	}
+	if a, ok := c.actions[0]["create"]; !ok || a["_index"] != "logs-oastrix-default" {
+		t.Errorf("action = %v, want a create", c.actions[0])
+	}
+}
+
+func TestItemFailures(t *testing.T) {
+	p, c := setup(t, GlobalConfig{SkipTemplate: true})
+	now := time.Unix(1700000000, 0)
+	p.now = func() time.Time { return now }
+	ctx := context.Background()
+	if err := p.OnPostStore(ctx, stored(1)); err != nil {
+		t.Fatalf("OnPostStore failed: %v", err)
+	}
+
+	c.itemStatus = http.StatusTooManyRequests
+	if err := p.flush(ctx); err == nil || p.queue.Len() != 1 {
+		t.Fatalf("flush error %v with %d queued, want the batch kept for a retry", err, p.queue.Len())
+	}
+	if len(c.templates) != 0 {
+		t.Errorf("templates = %v, want none installed", c.templates)
+	}
+
+	now = now.Add(time.Minute)
+	c.itemStatus = http.StatusBadRequest
+	err := p.flush(ctx)
+	if err == nil || !strings.Contains(err.Error(), "rejected 1 of 1 documents: mapper_parsing_exception") || p.queue.Len() != 0 {
+		t.Errorf("flush error %v with %d queued, want the batch dropped", err, p.queue.Len())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := GlobalConfig{URL: "https://es.example.com:9200", Username: "oast", Password: "p", Rotate: RotateMonthly, Mapping: json.RawMessage(`{"dynamic": true}`)}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	for name, c := range map[string]GlobalConfig{
+		"url":         {URL: "es:9200"},
+		"credentials": {Username: "oast", APIKey: "k"},
+		"index case":  {Index: "OAST"},
+		"index start": {Index: "_oast"},
+		"rotate":      {Rotate: "hourly"},
+		"data stream": {Rotate: RotateDaily, DataStream: true},
+		"mapping":     {Mapping: json.RawMessage(`[]`)},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted %+v", name, c)
+		}
+	}
+}
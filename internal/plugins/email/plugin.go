@@ -0,0 +1,427 @@
+// Package email implements a feature plugin that emails interactions over
+// SMTP, one message each or batched into periodic digests.
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/notify"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "email"
+
+// digestTick is how often pending digests are checked for being due.
+const digestTick = time.Minute
+
+// maxDigest bounds the interactions listed in one digest; the rest are
+// counted.
+const maxDigest = 500
+
+// Security modes for the SMTP connection.
+const (
+	SecurityStartTLS = "starttls" // upgrade a plain connection, failing if the server cannot
+	SecurityTLS      = "tls"      // implicit TLS, usually on port 465
+	SecurityNone     = "none"     // no encryption, e.g. to a local relay
+)
+
+// GlobalConfig holds the SMTP server and default recipients, how often
+// digests are sent, and which tokens are emailed about server-wide.
+type GlobalConfig struct {
+	Host      string        `json:"host"`
+	Port      int           `json:"port,omitempty"`     // 587, or 465 for SecurityTLS, when zero
+	Security  string        `json:"security,omitempty"` // SecurityStartTLS when empty
+	Username  string        `json:"username,omitempty"`
+	Password  string        `json:"password,omitempty" secret:"true"`
+	From      string        `json:"from"`
+	To        []string      `json:"to"`
+	Digest    string        `json:"digest,omitempty"` // Go duration; interactions are emailed one at a time when empty
+	AllTokens bool          `json:"all_tokens"`       // email about tokens without a Config
+	Kinds     []string      `json:"kinds,omitempty"`  // interaction kinds emailed about; all when empty
+	Filter    notify.Filter `json:"filter"`           // applies to every token
+}
+
+// Validate checks the addresses, security mode, port, digest interval and
+// kinds.
+func (c GlobalConfig) Validate() error {
+	switch c.Security {
+	case "", SecurityStartTLS, SecurityTLS, SecurityNone:
+	default:
+		return fmt.Errorf("invalid security %q: want %s, %s or %s", c.Security, SecurityStartTLS, SecurityTLS, SecurityNone)
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid port %d", c.Port)
+	}
+	if c.From != "" {
+		if _, err := mail.ParseAddress(c.From); err != nil {
+			return fmt.Errorf("invalid from address %q: %w", c.From, err)
+		}
+	}
+	if err := validateAddresses(c.To); err != nil {
+		return err
+	}
+	if c.Digest != "" {
+		if d, err := time.ParseDuration(c.Digest); err != nil || d < digestTick {
+			return fmt.Errorf("invalid digest %q: want a duration of at least %s", c.Digest, digestTick)
+		}
+	}
+	if err := notify.ValidateKinds(c.Kinds); err != nil {
+		return err
+	}
+	return c.Filter.Validate()
+}
+
+func (c GlobalConfig) addr() string {
+	port := c.Port
+	if port == 0 {
+		port = 587
+		if c.Security == SecurityTLS {
+			port = 465
+		}
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// digest returns the digest interval, or zero to email immediately.
+func (c GlobalConfig) digest() time.Duration {
+	d, _ := time.ParseDuration(c.Digest)
+	return d
+}
+
+func validateAddresses(addrs []string) error {
+	for _, a := range addrs {
+		if _, err := mail.ParseAddress(a); err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", a, err)
+		}
+	}
+	return nil
+}
+
+// Config enables emails for a token, overriding the server-wide settings,
+// optionally to recipients of its own.
+type Config struct {
+	Enabled bool     `json:"enabled"`
+	To      []string `json:"to,omitempty"`
+	Kinds   []string `json:"kinds,omitempty"` // interaction kinds emailed about; all when empty
+}
+
+// Validate checks the recipients and kinds.
+func (c Config) Validate() error {
+	if err := validateAddresses(c.To); err != nil {
+		return err
+	}
+	return notify.ValidateKinds(c.Kinds)
+}
+
+// item is an interaction awaiting a digest.
+type item struct {
+	at      time.Time
+	token   string
+	kind    events.Kind
+	remote  string
+	summary string
+}
+
+// pending is a digest being collected for a set of recipients.
+type pending struct {
+	to      []string
+	items   []item
+	omitted int // interactions beyond maxDigest
+}
+
+// Plugin emails the stored interactions of tokens whose Config enables it,
+// or of every token when the GlobalConfig's AllTokens is set. The SMTP server
+// is read from the GlobalConfig, so nothing is sent until it is configured.
+//
+// Without a digest interval, each interaction is emailed as it is stored, so
+// run the pipeline with workers to keep SMTP off the response path. With
+// one, interactions are collected per set of recipients and emailed together
+// at most once per interval. Digests are held in memory, so interactions not
+// yet emailed when the server stops are not.
+type Plugin struct {
+	store  plugins.Store
+	config plugins.GlobalConfigView
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+	now    func() time.Time
+	send   func(ctx context.Context, cfg GlobalConfig, to []string, msg []byte) error
+
+	throttle notify.Throttle
+
+	mu       sync.Mutex
+	pending  map[string]*pending  // by joined recipients
+	lastSent map[string]time.Time // when each set of recipients was last sent a digest
+}
+
+// New creates a new email Plugin.
+func New() *Plugin {
+	p := &Plugin{
+		now:      time.Now,
+		pending:  make(map[string]*pending),
+		lastSent: make(map[string]time.Time),
+	}
+	p.send = p.sendSMTP
+	return p
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Init initializes the plugin with the given context and schedules sending
+// digests.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Config == nil {
+		return errors.New("global config view required")
+	}
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.store = ctx.Store
+	p.config = ctx.Config
+	p.tokens = ctx.Tokens
+	if ctx.Scheduler != nil {
+		ctx.Scheduler.Every(digestTick, p.flush)
+	}
+	return nil
+}
+
+// NewGlobalConfig returns a new GlobalConfig for the server-wide
+// configuration to be decoded into.
+func (p *Plugin) NewGlobalConfig() any { return new(GlobalConfig) }
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnPostStore emails the stored interaction, or adds it to its recipients'
+// digest, if its token and kind are emailed about and it passes the filter.
+func (p *Plugin) OnPostStore(ctx context.Context, e *events.Event) error {
+	if e.InteractionID == 0 {
+		return nil
+	}
+	var global GlobalConfig
+	if err := p.config.Get(ID, &global); err != nil {
+		return fmt.Errorf("load email global config: %w", err)
+	}
+	if global.Host == "" {
+		return nil
+	}
+
+	enabled, to, kinds := global.AllTokens, global.To, global.Kinds
+	var cfg Config
+	ok, err := p.tokens.Get(ctx, e.Draft.TokenID, ID, &cfg)
+	if err != nil {
+		return fmt.Errorf("load email: %w", err)
+	}
+	if ok {
+		enabled = cfg.Enabled
+		if len(cfg.To) > 0 {
+			to = cfg.To
+		}
+		if len(cfg.Kinds) > 0 {
+			kinds = cfg.Kinds
+		}
+	}
+	if !enabled || len(to) == 0 || !notify.WantsKind(kinds, e.Draft.Kind) {
+		return nil
+	}
+	if ok, err := global.Filter.Pass(ctx, p.store, e, &p.throttle, ID, p.now(), p.logger); err != nil || !ok {
+		return err
+	}
+
+	it := itemOf(e.Draft, p.now())
+	if global.digest() == 0 {
+		subject := fmt.Sprintf("%s interaction on %s", strings.ToUpper(string(it.kind)), it.token)
+		return p.send(ctx, global, to, compose(global.From, to, subject, []item{it}, 0, p.now()))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := strings.Join(to, ",")
+	pd, ok := p.pending[key]
+	if !ok {
+		pd = &pending{to: to}
+		p.pending[key] = pd
+	}
+	if len(pd.items) < maxDigest {
+		pd.items = append(pd.items, it)
+	} else {
+		pd.omitted++
+	}
+	return nil
+}
+
+// flush emails the digests whose interval has passed since their recipients
+// were last sent one. If digests have been turned off, every pending one is
+// sent.
+func (p *Plugin) flush(ctx context.Context) error {
+	var global GlobalConfig
+	if err := p.config.Get(ID, &global); err != nil {
+		return fmt.Errorf("load email global config: %w", err)
+	}
+	interval := global.digest()
+	now := p.now()
+
+	p.mu.Lock()
+	var due []*pending
+	for key, pd := range p.pending {
+		if now.Sub(p.lastSent[key]) < interval {
+			continue
+		}
+		due = append(due, pd)
+		delete(p.pending, key)
+		p.lastSent[key] = now
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for _, pd := range due {
+		if global.Host == "" {
+			continue
+		}
+		subject := digestSubject(pd)
+		if err := p.send(ctx, global, pd.to, compose(global.From, pd.to, subject, pd.items, pd.omitted, now)); err != nil {
+			errs = append(errs, fmt.Errorf("send digest to %s: %w", strings.Join(pd.to, ", "), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func digestSubject(pd *pending) string {
+	tokens := map[string]bool{}
+	for _, it := range pd.items {
+		tokens[it.token] = true
+	}
+	n := len(pd.items) + pd.omitted
+	if n == 1 {
+		return fmt.Sprintf("1 interaction on %s", pd.items[0].token)
+	}
+	if len(tokens) == 1 {
+		return fmt.Sprintf("%d interactions on %s", n, pd.items[0].token)
+	}
+	return fmt.Sprintf("%d interactions on %d tokens", n, len(tokens))
+}
+
+func itemOf(d *events.InteractionDraft, now time.Time) item {
+	at := now
+	if d.OccurredAt > 0 {
+		at = time.Unix(d.OccurredAt, 0)
+	}
+	remote := d.RemoteIP
+	if d.RemotePort > 0 {
+		remote = net.JoinHostPort(d.RemoteIP, strconv.Itoa(d.RemotePort))
+	}
+	// Summaries are sent by targets; keep each on its own line.
+	summary := strings.Join(strings.Fields(d.Summary), " ")
+	return item{at: at, token: d.TokenValue, kind: d.Kind, remote: remote, summary: notify.Truncate(summary, 500)}
+}
+
+// compose builds a plain-text message listing items, newest last.
+func compose(from string, to []string, subject string, items []item, omitted int, now time.Time) []byte {
+	var body bytes.Buffer
+	qp := quotedprintable.NewWriter(&body)
+	for _, it := range items {
+		_, _ = fmt.Fprintf(qp, "%s  %s  %s  from %s\r\n  %s\r\n\r\n",
+			it.at.UTC().Format(time.RFC3339), it.token, strings.ToUpper(string(it.kind)), it.remote, it.summary)
+	}
+	if omitted > 0 {
+		_, _ = fmt.Fprintf(qp, "... and %d more.\r\n", omitted)
+	}
+	_ = qp.Close()
+
+	var msg bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&msg, "%s: %s\r\n", k, v) }
+	header("From", from)
+	header("To", strings.Join(to, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", "[oastrix] "+subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", `text/plain; charset="utf-8"`)
+	header("Content-Transfer-Encoding", "quoted-printable")
+	header("Auto-Submitted", "auto-generated")
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes()
+}
+
+// sendSMTP delivers msg to the configured server.
+func (p *Plugin) sendSMTP(ctx context.Context, cfg GlobalConfig, to []string, msg []byte) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", cfg.addr())
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+	if cfg.Security == SecurityTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	c, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer func() { _ = c.Close() }()
+
+	if cfg.Security == "" || cfg.Security == SecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return err
+		}
+	}
+	if cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		a, err := mail.ParseAddress(rcpt)
+		if err != nil {
+			return fmt.Errorf("invalid recipient: %w", err)
+		}
+		if err := c.Rcpt(a.Address); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,245 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/plugintest"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+type sent struct {
+	to  []string
+	msg *mail.Message
+}
+
+func newPlugin(t *testing.T, global *GlobalConfig, tokens map[int64]Config, now *time.Time) (*Plugin, *[]sent) {
+	t.Helper()
+	p := New()
+	p.now = func() time.Time { return *now }
+	var out []sent
+	p.send = func(_ context.Context, _ GlobalConfig, to []string, msg []byte) error {
+		m, err := mail.ReadMessage(bytes.NewReader(msg))
+		if err != nil {
+			t.Fatalf("malformed message: %v", err)
+		}
+		out = append(out, sent{to: to, msg: m})
+		return nil
+	}
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Config: plugintest.GlobalConfig{Value: global}, Tokens: plugintest.TokenConfigs[Config](tokens)}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, &out
+}
+
+func event(token string, tokenID int64, summary string) *events.Event {
+	return &events.Event{
+		InteractionID: 1,
+		Draft: &events.InteractionDraft{
+			TokenValue: token,
+			TokenID:    tokenID,
+			Kind:       events.KindHTTP,
+			OccurredAt: 1700000000,
+			RemoteIP:   "192.0.2.1",
+			RemotePort: 40000,
+			Summary:    summary,
+		},
+	}
+}
+
+func subject(t *testing.T, m *mail.Message) string {
+	t.Helper()
+	s, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("decode subject: %v", err)
+	}
+	return s
+}
+
+func body(t *testing.T, m *mail.Message) string {
+	t.Helper()
+	b, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	return string(b)
+}
+
+func TestImmediate(t *testing.T) {
+	now := time.Unix(1700000100, 0)
+	global := &GlobalConfig{Host: "smtp.example.com", From: "oastrix@example.com", To: []string{"team@example.com"}}
+	p, out := newPlugin(t, global, map[int64]Config{
+		1: {Enabled: true},
+		2: {Enabled: true, To: []string{"owner@example.com"}},
+		3: {Enabled: true, Kinds: []string{"dns"}},
+	}, &now)
+
+	for id, token := range map[int64]string{1: "tok1", 2: "tok2", 3: "tok3", 4: "tok4"} {
+		if err := p.OnPostStore(context.Background(), event(token, id, "GET /\r\nX-Injected: 1 HTTP/1.1")); err != nil {
+			t.Fatalf("OnPostStore failed: %v", err)
+		}
+	}
+	if len(*out) != 2 {
+		t.Fatalf("sent %d emails, want 2", len(*out))
+	}
+	for _, s := range *out {
+		switch s.to[0] {
+		case "team@example.com":
+			if got := subject(t, s.msg); got != "[oastrix] HTTP interaction on tok1" {
+				t.Errorf("subject = %q", got)
+			}
+			if s.msg.Header.Get("X-Injected") != "" {
+				t.Error("summary injected a header")
+			}
+			want := "2023-11-14T22:13:20Z  tok1  HTTP  from 192.0.2.1:40000\r\n  GET / X-Injected: 1 HTTP/1.1\r\n"
+			if got := body(t, s.msg); !strings.HasPrefix(got, want) {
+				t.Errorf("body = %q, want prefix %q", got, want)
+			}
+		case "owner@example.com":
+		default:
+			t.Errorf("emailed %v", s.to)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	now := time.Unix(1700000100, 0)
+	global := &GlobalConfig{Host: "smtp.example.com", From: "oastrix@example.com", To: []string{"team@example.com"}, Digest: "1h", AllTokens: true}
+	p, out := newPlugin(t, global, nil, &now)
+
+	for _, token := range []string{"tok1", "tok2"} {
+		if err := p.OnPostStore(context.Background(), event(token, 1, "GET / HTTP/1.1")); err != nil {
+			t.Fatalf("OnPostStore failed: %v", err)
+		}
+	}
+	if len(*out) != 0 {
+		t.Fatalf("sent %d emails before the digest, want none", len(*out))
+	}
+	if err := p.flush(context.Background()); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	if len(*out) != 1 {
+		t.Fatalf("sent %d digests, want 1", len(*out))
+	}
+	if got := subject(t, (*out)[0].msg); got != "[oastrix] 2 interactions on 2 tokens" {
+		t.Errorf("subject = %q", got)
+	}
+	if got := body(t, (*out)[0].msg); strings.Count(got, "GET / HTTP/1.1") != 2 {
+		t.Errorf("body = %q, want both interactions", got)
+	}
+
+	// The next digest waits for the interval.
+	_ = p.OnPostStore(context.Background(), event("tok1", 1, "GET / HTTP/1.1"))
+	now = now.Add(30 * time.Minute)
+	_ = p.flush(context.Background())
+	if len(*out) != 1 {
+		t.Fatalf("sent a digest within the interval")
+	}
+	now = now.Add(30 * time.Minute)
+	_ = p.flush(context.Background())
+	if len(*out) != 2 || subject(t, (*out)[1].msg) != "[oastrix] 1 interaction on tok1" {
+		t.Fatalf("sent %d digests, want a second after the interval", len(*out))
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := GlobalConfig{Host: "smtp.example.com", From: "Oastrix <oastrix@example.com>", To: []string{"team@example.com"}, Digest: "1h"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	for name, c := range map[string]GlobalConfig{
+		"security":  {Security: "ssl"},
+		"from":      {From: "not an address"},
+		"recipient": {To: []string{"team"}},
+		"digest":    {Digest: "10s"},
+		"kind":      {Kinds: []string{"gopher"}},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted %+v", name, c)
+		}
+	}
+}
+
+// serveSMTP answers one SMTP session on l without offering STARTTLS, sending
+// the message data received on data.
+func serveSMTP(l net.Listener, data chan<- string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	r := bufio.NewReader(conn)
+	reply := func(s string) { _, _ = io.WriteString(conn, s+"\r\n") }
+	reply("220 localhost ESMTP")
+	var msg strings.Builder
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250 localhost")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			for {
+				dl, err := r.ReadString('\n')
+				if err != nil || dl == ".\r\n" {
+					break
+				}
+				msg.WriteString(dl)
+			}
+			data <- msg.String()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSendSMTP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+	data := make(chan string, 1)
+	go serveSMTP(l, data)
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	cfg := GlobalConfig{Host: host, Security: SecurityNone, From: "oastrix@example.com"}
+	cfg.Port, _ = strconv.Atoi(port)
+	msg := compose(cfg.From, []string{"team@example.com"}, "test", nil, 0, time.Now())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := New().sendSMTP(ctx, cfg, []string{"team@example.com"}, msg); err != nil {
+		t.Fatalf("sendSMTP failed: %v", err)
+	}
+	if got := <-data; !strings.Contains(got, "Subject: [oastrix] test") {
+		t.Errorf("data = %q", got)
+	}
+
+	// Without STARTTLS support, the default security refuses to send.
+	go serveSMTP(l, data)
+	cfg.Security = ""
+	if err := New().sendSMTP(ctx, cfg, []string{"team@example.com"}, msg); err == nil {
+		t.Error("sent without STARTTLS")
+	}
+}
@@ -0,0 +1,198 @@
+// Package flood implements a feature plugin that limits how fast one remote
+// IP can record interactions with a token, protecting the database when a
+// token leaks to a scanner botnet.
+package flood
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier.
+const ID = "flood"
+
+// DroppedAttribute counts the interactions a flood interaction summarizes.
+const DroppedAttribute = "flood_dropped"
+
+// flushInterval is how often drop counts are saved and finished floods
+// forgotten.
+const flushInterval = 10 * time.Second
+
+// source is a remote IP recording interactions with a token.
+type source struct {
+	tokenID  int64
+	remoteIP string
+}
+
+// bucket is a source's token bucket and the flood it is in, if any.
+type bucket struct {
+	tokens float64
+	last   time.Time
+
+	summaryID int64 // flood interaction, zero until created
+	creating  bool  // the flood interaction is being created
+	dropped   int   // interactions dropped in this flood
+	saved     int   // dropped count last saved
+}
+
+// Plugin drops interactions from a remote IP to a token beyond Rate per
+// second on average, with bursts of Burst. The first drop records a KindFlood
+// interaction, whose DroppedAttribute attribute counts the drops until the
+// source's bucket refills. Its Priority runs it straight after quotas.
+type Plugin struct {
+	rate  float64
+	burst float64
+
+	store  plugins.Store
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[source]*bucket
+}
+
+// New creates a new flood Plugin allowing rate interactions per second per
+// source, with bursts of up to burst.
+func New(rate float64, burst int) *Plugin {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Plugin{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[source]*bucket),
+	}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Priority limits floods before any other feature plugin does work for them.
+func (p *Plugin) Priority() int { return 12 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Store == nil {
+		return errors.New("store required")
+	}
+	p.store = ctx.Store
+	if ctx.Scheduler != nil {
+		ctx.Scheduler.Every(flushInterval, p.flush)
+	}
+	return nil
+}
+
+// Config returns the plugin's settings.
+func (p *Plugin) Config() map[string]any {
+	return map[string]any{"rate": p.rate, "burst": int(p.burst)}
+}
+
+// OnPreStore drops interactions from a source beyond its rate, recording a
+// flood interaction at the first.
+func (p *Plugin) OnPreStore(ctx context.Context, e *events.Event) error {
+	if e.Draft.Drop || e.Draft.TokenID == 0 || e.Draft.Kind == events.KindFlood {
+		return nil
+	}
+	src := source{tokenID: e.Draft.TokenID, remoteIP: e.Draft.RemoteIP}
+
+	p.mu.Lock()
+	b := p.refill(src)
+	if b.tokens >= 1 {
+		b.tokens--
+		p.mu.Unlock()
+		return nil
+	}
+	e.Draft.Drop = true
+	b.dropped++
+	if b.summaryID != 0 || b.creating {
+		p.mu.Unlock()
+		return nil
+	}
+	b.creating = true
+	p.mu.Unlock()
+
+	p.logger.Warn("flood detected; dropping interactions", zap.Int64("token_id", src.tokenID), zap.String("remote_ip", src.remoteIP))
+	id, err := p.store.CreateInteraction(ctx, &events.InteractionDraft{
+		TokenID:    src.tokenID,
+		Kind:       events.KindFlood,
+		OccurredAt: p.now().Unix(),
+		RemoteIP:   src.remoteIP,
+		Summary:    fmt.Sprintf("flood from %s", src.remoteIP),
+	})
+
+	p.mu.Lock()
+	b.creating = false
+	b.summaryID = id
+	p.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("record flood: %w", err)
+	}
+	return p.save(ctx, b)
+}
+
+// refill returns src's bucket topped up for the time since it was last used.
+// The caller must hold p.mu.
+func (p *Plugin) refill(src source) *bucket {
+	now := p.now()
+	b, ok := p.buckets[src]
+	if !ok {
+		b = &bucket{tokens: p.burst, last: now}
+		p.buckets[src] = b
+	}
+	b.tokens = math.Min(p.burst, b.tokens+now.Sub(b.last).Seconds()*p.rate)
+	b.last = now
+	return b
+}
+
+// save records b's drop count on its flood interaction if it changed.
+func (p *Plugin) save(ctx context.Context, b *bucket) error {
+	p.mu.Lock()
+	id, dropped := b.summaryID, b.dropped
+	changed := id != 0 && dropped != b.saved
+	p.mu.Unlock()
+	if !changed {
+		return nil
+	}
+	if err := p.store.SaveAttributes(ctx, id, map[string]any{DroppedAttribute: dropped}); err != nil {
+		return fmt.Errorf("save flood count: %w", err)
+	}
+	p.mu.Lock()
+	b.saved = max(b.saved, dropped)
+	p.mu.Unlock()
+	return nil
+}
+
+// flush saves changed drop counts and forgets sources whose buckets have
+// refilled, ending their floods.
+func (p *Plugin) flush(ctx context.Context) error {
+	now := p.now()
+	var pending []*bucket
+	p.mu.Lock()
+	for src, b := range p.buckets {
+		if b.summaryID != 0 && b.dropped != b.saved {
+			pending = append(pending, b)
+		}
+		full := b.tokens+now.Sub(b.last).Seconds()*p.rate >= p.burst
+		if full && !b.creating && b.dropped == b.saved {
+			delete(p.buckets, src)
+		}
+	}
+	p.mu.Unlock()
+
+	var errs []error
+	for _, b := range pending {
+		errs = append(errs, p.save(ctx, b))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,105 @@
+package flood
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// memStore keeps created interactions and attributes in memory.
+type memStore struct {
+	drafts []*events.InteractionDraft
+	attrs  map[int64]map[string]any
+}
+
+func (m *memStore) ResolveTokenID(context.Context, string) (int64, bool, error) {
+	return 0, false, nil
+}
+
+func (m *memStore) CreateInteraction(_ context.Context, draft *events.InteractionDraft) (int64, error) {
+	m.drafts = append(m.drafts, draft)
+	return int64(len(m.drafts)), nil
+}
+
+func (m *memStore) SaveAttributes(_ context.Context, id int64, attrs map[string]any) error {
+	if m.attrs[id] == nil {
+		m.attrs[id] = make(map[string]any)
+	}
+	for k, v := range attrs {
+		m.attrs[id][k] = v
+	}
+	return nil
+}
+
+func (m *memStore) GetInteractionsByToken(context.Context, int64, int) ([]models.Interaction, error) {
+	return nil, nil
+}
+
+func (m *memStore) GetAttributes(_ context.Context, id int64) (map[string]any, error) {
+	return m.attrs[id], nil
+}
+
+func TestFlood(t *testing.T) {
+	store := &memStore{attrs: make(map[int64]map[string]any)}
+	now := time.Unix(1700000000, 0)
+	p := New(1, 2)
+	p.now = func() time.Time { return now }
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Store: store}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+
+	// process reports whether an interaction from ip to token 1 is kept.
+	process := func(ip string) bool {
+		t.Helper()
+		e := &events.Event{Draft: &events.InteractionDraft{TokenID: 1, Kind: events.KindHTTP, RemoteIP: ip}}
+		if err := p.OnPreStore(context.Background(), e); err != nil {
+			t.Fatalf("OnPreStore failed: %v", err)
+		}
+		return !e.Draft.Drop
+	}
+
+	var kept int
+	for range 5 {
+		if process("192.0.2.1") {
+			kept++
+		}
+	}
+	if kept != 2 {
+		t.Errorf("kept %d interactions, want the burst of 2", kept)
+	}
+	if !process("192.0.2.2") {
+		t.Error("another source was limited")
+	}
+
+	if len(store.drafts) != 1 || store.drafts[0].Kind != events.KindFlood || store.drafts[0].RemoteIP != "192.0.2.1" {
+		t.Fatalf("created %+v, want one flood interaction from 192.0.2.1", store.drafts)
+	}
+	if got := store.attrs[1][DroppedAttribute]; got != 1 {
+		t.Errorf("dropped count at creation = %v, want 1", got)
+	}
+	if err := p.flush(context.Background()); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	if got := store.attrs[1][DroppedAttribute]; got != 3 {
+		t.Errorf("dropped count after flush = %v, want 3", got)
+	}
+
+	// Once the bucket refills, the flood is over and the next one is
+	// recorded separately.
+	now = now.Add(2 * time.Second)
+	if err := p.flush(context.Background()); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	for range 3 {
+		process("192.0.2.1")
+	}
+	if len(store.drafts) != 2 {
+		t.Errorf("created %d flood interactions, want 2", len(store.drafts))
+	}
+}
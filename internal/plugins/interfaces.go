@@ -1,72 +1,47 @@
-// Package plugins defines the plugin interfaces and capability hooks for the plugin framework.
+// Package plugins runs the plugin framework: the pipeline that calls plugin
+// hooks and the registry of loaded plugins. The plugin interfaces themselves
+// are defined in package plugin, so that plugins built outside this module
+// can import them; they are aliased here for the framework and the plugins
+// built into the server.
 package plugins
 
-import (
-	"context"
-	"net/http"
-
-	"go.uber.org/zap"
-
-	"github.com/rsclarke/oastrix/internal/events"
+import "github.com/rsclarke/oastrix/pkg/plugin"
+
+// APIVersion is plugin.APIVersion.
+const APIVersion = plugin.APIVersion
+
+// DefaultPriority is plugin.DefaultPriority.
+const DefaultPriority = plugin.DefaultPriority
+
+// Aliases of the plugin interfaces and the types they use.
+type (
+	Plugin                   = plugin.Plugin
+	InitContext              = plugin.InitContext
+	Store                    = plugin.Store
+	ResponseStore            = plugin.ResponseStore
+	TokenTagStore            = plugin.TokenTagStore
+	RouterRegistrar          = plugin.RouterRegistrar
+	Scheduler                = plugin.Scheduler
+	GlobalConfigView         = plugin.GlobalConfigView
+	TokenConfigView          = plugin.TokenConfigView
+	PreStoreHook             = plugin.PreStoreHook
+	PostStoreHook            = plugin.PostStoreHook
+	HTTPResponseHook         = plugin.HTTPResponseHook
+	DNSResponseHook          = plugin.DNSResponseHook
+	ProtocolResponseHook     = plugin.ProtocolResponseHook
+	PayloadContext           = plugin.PayloadContext
+	Payload                  = plugin.Payload
+	Flusher                  = plugin.Flusher
+	PayloadProvider          = plugin.PayloadProvider
+	PrioritizedPlugin        = plugin.PrioritizedPlugin
+	TimeoutPlugin            = plugin.TimeoutPlugin
+	ConfigurablePlugin       = plugin.ConfigurablePlugin
+	TokenConfigurablePlugin  = plugin.TokenConfigurablePlugin
+	GlobalConfigurablePlugin = plugin.GlobalConfigurablePlugin
+	MigratingPlugin          = plugin.MigratingPlugin
+	Validator                = plugin.Validator
 )
 
-// Plugin is the base interface all plugins must implement.
-type Plugin interface {
-	ID() string
-	Init(ctx InitContext) error
-}
-
-// InitContext provides access to shared resources during plugin initialization.
-type InitContext struct {
-	Logger *zap.Logger
-	Store  Store
-	Config GlobalConfigView
-	Tokens TokenConfigView
-	Router RouterRegistrar
-}
-
-// Store provides storage operations for plugins.
-type Store interface {
-	ResolveTokenID(ctx context.Context, tokenValue string) (int64, bool, error)
-	CreateInteraction(ctx context.Context, draft *events.InteractionDraft) (int64, error)
-	SaveAttributes(ctx context.Context, interactionID int64, attrs map[string]any) error
-}
-
-// RouterRegistrar allows plugins to register HTTP handlers.
-type RouterRegistrar interface {
-	Handle(pattern string, h http.Handler)
-}
-
-// GlobalConfigView provides read access to global configuration.
-type GlobalConfigView interface {
-	Get(key string, out any) error
-}
-
-// TokenConfigView provides read access to per-token plugin configuration.
-type TokenConfigView interface {
-	Get(ctx context.Context, tokenID int64, pluginID string, out any) (bool, error)
-}
-
-// PreStoreHook is called after token extraction, before persistence.
-type PreStoreHook interface {
-	OnPreStore(ctx context.Context, e *events.Event) error
-}
-
-// PostStoreHook is called after the interaction is persisted.
-type PostStoreHook interface {
-	OnPostStore(ctx context.Context, e *events.Event) error
-}
-
-// HTTPResponseHook is called before writing the HTTP response.
-type HTTPResponseHook interface {
-	OnHTTPResponse(ctx context.Context, e *events.HTTPEvent) error
-}
-
-// DNSResponseHook is called before writing the DNS response.
-type DNSResponseHook interface {
-	OnDNSResponse(ctx context.Context, e *events.DNSEvent) error
-}
-
 // PluginType indicates whether a plugin is core infrastructure or a feature plugin.
 type PluginType string
 
@@ -81,20 +56,20 @@ type CorePlugin interface {
 	IsCore() bool
 }
 
-// ConfigurablePlugin is an optional interface for plugins that expose global configuration.
-type ConfigurablePlugin interface {
-	Config() map[string]any
-}
-
-// PluginInfo contains metadata about a registered plugin.
+// PluginInfo contains metadata about a registered plugin. A plugin is
+// unhealthy once one of its hooks has panicked; Problem describes the panic.
 type PluginInfo struct {
 	ID      string         `json:"id"`
 	Type    PluginType     `json:"type"`
 	Enabled bool           `json:"enabled"`
+	Healthy bool           `json:"healthy"`
+	Problem string         `json:"problem,omitempty"`
 	Config  map[string]any `json:"config,omitempty"`
 }
 
 // PluginRegistry provides read access to registered plugins.
 type PluginRegistry interface {
 	ListPlugins() []PluginInfo
+	Plugin(id string) (Plugin, bool)
+	Payloads(ctx PayloadContext) []Payload
 }
@@ -0,0 +1,125 @@
+// Package native loads feature plugins built as Go shared objects with
+// go build -buildmode=plugin.
+//
+// A plugin package exports a constructor and the plugin.APIVersion it was
+// built against:
+//
+//	var APIVersion = plugin.APIVersion
+//
+//	func New() plugin.Plugin { return &MyPlugin{} }
+//
+// Shared objects must be built with the same Go toolchain and versions of
+// every package they share with the server, which the Go runtime checks when
+// opening them.
+package native
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	goplugin "plugin"
+
+	"github.com/rsclarke/oastrix/pkg/plugin"
+)
+
+// Exported symbol names looked up in a shared object.
+const (
+	NewSymbol        = "New"
+	APIVersionSymbol = "APIVersion"
+)
+
+// Ext is the file extension of shared objects loaded from a directory.
+const Ext = ".so"
+
+// Result is the outcome of loading one shared object: either its plugin or
+// the error that prevented loading it.
+type Result struct {
+	Path   string
+	Plugin plugin.Plugin
+	Err    error
+}
+
+// LoadDir loads every shared object in dir, in name order. A shared object
+// that fails to load does not prevent the others from loading; its error is
+// reported in its Result.
+func LoadDir(dir string) ([]Result, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read plugin dir: %w", err)
+	}
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == Ext {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	results := make([]Result, 0, len(paths))
+	for _, path := range paths {
+		p, err := Load(path)
+		results = append(results, Result{Path: path, Plugin: p, Err: err})
+	}
+	return results, nil
+}
+
+// Load opens the shared object at path and constructs its plugin.
+func Load(path string) (plugin.Plugin, error) {
+	lib, err := goplugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return instantiate(lib)
+}
+
+// symbols is the part of *plugin.Plugin used to instantiate it.
+type symbols interface {
+	Lookup(name string) (goplugin.Symbol, error)
+}
+
+// instantiate checks the API version exported by lib and calls its
+// constructor, recovering from a panic in it.
+func instantiate(lib symbols) (p plugin.Plugin, err error) {
+	sym, err := lib.Lookup(APIVersionSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("missing %s: built against an unknown plugin API", APIVersionSymbol)
+	}
+	version, ok := sym.(*int)
+	if !ok {
+		return nil, fmt.Errorf("%s is %T, want int", APIVersionSymbol, sym)
+	}
+	if *version != plugin.APIVersion {
+		return nil, fmt.Errorf("built against plugin API %d, want %d", *version, plugin.APIVersion)
+	}
+
+	sym, err = lib.Lookup(NewSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("missing %s", NewSymbol)
+	}
+	var newPlugin func() plugin.Plugin
+	switch fn := sym.(type) {
+	case func() plugin.Plugin:
+		newPlugin = fn
+	case *func() plugin.Plugin:
+		newPlugin = *fn
+	default:
+		return nil, fmt.Errorf("%s is %T, want func() plugin.Plugin", NewSymbol, sym)
+	}
+	if newPlugin == nil {
+		return nil, fmt.Errorf("%s is nil", NewSymbol)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			p, err = nil, fmt.Errorf("%s panicked: %v", NewSymbol, r)
+		}
+	}()
+	p = newPlugin()
+	if p == nil {
+		return nil, errors.New(NewSymbol + " returned nil")
+	}
+	if p.ID() == "" {
+		return nil, errors.New("plugin has an empty ID")
+	}
+	return p, nil
+}
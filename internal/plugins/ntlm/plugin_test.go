@@ -0,0 +1,260 @@
+package ntlm
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/core/storage"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func setupTest(t *testing.T, cfg *Config) (*Plugin, int64) {
+	t.Helper()
+	database, err := db.Open(t.TempDir() + "/test.db")
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	t.Cleanup(func() { _ = database.Close() })
+
+	tokenID, err := db.CreateToken(database, "ntlmtoken", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	if cfg != nil {
+		if err := db.SetTokenPluginConfig(database, tokenID, ID, cfg); err != nil {
+			t.Fatalf("SetTokenPluginConfig failed: %v", err)
+		}
+	}
+
+	p := New()
+	p.now = func() time.Time { return time.Unix(1700000000, 0) }
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Tokens: storage.NewTokenConfig(db.NewSQLite(database))}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, tokenID
+}
+
+// process runs an HTTP interaction through the plugin's hooks.
+func process(t *testing.T, p *Plugin, tokenID int64, authorization string) *events.HTTPEvent {
+	t.Helper()
+	headers := map[string][]string{}
+	if authorization != "" {
+		headers["Authorization"] = []string{authorization}
+	}
+	e := &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{
+			TokenID: tokenID,
+			HTTP:    &events.HTTPDraft{Method: "GET", Host: "ntlmtoken.oastrix.example.com", Path: "/", Headers: headers},
+		}},
+		Resp: &events.HTTPResponsePlan{Status: 200, Headers: make(map[string]string), Body: []byte("ok")},
+	}
+	if err := p.OnPreStore(context.Background(), &e.Event); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if err := p.OnHTTPResponse(context.Background(), e); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	return e
+}
+
+func negotiate() []byte {
+	msg := append([]byte(nil), signature...)
+	msg = binary.LittleEndian.AppendUint32(msg, negotiateMessage)
+	msg = binary.LittleEndian.AppendUint32(msg, flagUnicode|flagNTLM|flagRequestTarget)
+	return append(msg, make([]byte, 16)...)
+}
+
+// authenticateMsg builds a Unicode authenticate message.
+func authenticateMsg(lm, nt []byte, domain, user, workstation string) []byte {
+	payloads := [][]byte{lm, nt, utf16le(domain), utf16le(user), utf16le(workstation), nil}
+	msg := append([]byte(nil), signature...)
+	msg = binary.LittleEndian.AppendUint32(msg, authenticateMessage)
+	offset := 64
+	for _, b := range payloads {
+		msg = appendField(msg, len(b), offset)
+		offset += len(b)
+	}
+	msg = binary.LittleEndian.AppendUint32(msg, flagUnicode|flagNTLM)
+	for _, b := range payloads {
+		msg = append(msg, b...)
+	}
+	return msg
+}
+
+func TestOffersSchemes(t *testing.T) {
+	p, tokenID := setupTest(t, &Config{})
+
+	e := process(t, p, tokenID, "")
+	if !e.Resp.Handled || e.Resp.Status != 401 {
+		t.Fatalf("response = %+v", e.Resp)
+	}
+	if got := e.Resp.Headers["WWW-Authenticate"]; got != "Negotiate, NTLM" {
+		t.Errorf("WWW-Authenticate = %q", got)
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	tests := []struct {
+		name   string
+		auth   string
+		scheme string
+		spnego bool
+	}{
+		{"ntlm", "NTLM " + base64.StdEncoding.EncodeToString(negotiate()), "NTLM", false},
+		{"negotiate bare", "Negotiate " + base64.StdEncoding.EncodeToString(negotiate()), "Negotiate", false},
+		{"negotiate spnego", "Negotiate " + base64.StdEncoding.EncodeToString(append([]byte{0x60, 0x48, 0x06, 0x06}, negotiate()...)), "Negotiate", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, tokenID := setupTest(t, &Config{Domain: "corp", Challenge: "0102030405060708"})
+
+			e := process(t, p, tokenID, tt.auth)
+			if e.Resp.Status != 401 {
+				t.Fatalf("status = %d, want 401", e.Resp.Status)
+			}
+			scheme, encoded, _ := strings.Cut(e.Resp.Headers["WWW-Authenticate"], " ")
+			if scheme != tt.scheme {
+				t.Errorf("scheme = %q, want %q", scheme, tt.scheme)
+			}
+			b, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				t.Fatalf("decode challenge: %v", err)
+			}
+			if got := b[0] == 0xa1; got != tt.spnego {
+				t.Errorf("spnego wrapped = %v, want %v", got, tt.spnego)
+			}
+
+			msg, typ, ok := extract(b)
+			if !ok || typ != challengeMessage {
+				t.Fatalf("extract = %d, %v", typ, ok)
+			}
+			if got := msg[24:32]; !bytes.Equal(got, []byte{1, 2, 3, 4, 5, 6, 7, 8}) {
+				t.Errorf("server challenge = %x", got)
+			}
+			target, err := field(msg, 12)
+			if err != nil || decodeString(target, true) != "CORP" {
+				t.Errorf("target name = %q, %v", decodeString(target, true), err)
+			}
+			if _, err := field(msg, 40); err != nil {
+				t.Errorf("target info: %v", err)
+			}
+		})
+	}
+}
+
+func TestCapture(t *testing.T) {
+	ntv2 := append(bytes.Repeat([]byte{0xaa}, 16), bytes.Repeat([]byte{0xbb}, 28)...)
+
+	tests := []struct {
+		name        string
+		cfg         Config
+		lm, nt      []byte
+		wantVersion string
+		wantHash    string
+		wantHandled bool
+	}{
+		{
+			name: "ntlmv2", cfg: Config{},
+			lm: make([]byte, 24), nt: ntv2,
+			wantVersion: "NTLMv2",
+			wantHash:    "alice::CORP:1122334455667788:" + strings.Repeat("aa", 16) + ":" + strings.Repeat("bb", 28),
+			wantHandled: true,
+		},
+		{
+			name: "ntlmv1 accepted", cfg: Config{Accept: true},
+			lm: bytes.Repeat([]byte{0x11}, 24), nt: bytes.Repeat([]byte{0x22}, 24),
+			wantVersion: "NTLMv1",
+			wantHash:    "alice::CORP:" + strings.Repeat("11", 24) + ":" + strings.Repeat("22", 24) + ":1122334455667788",
+			wantHandled: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, tokenID := setupTest(t, &tt.cfg)
+
+			msg := authenticateMsg(tt.lm, tt.nt, "CORP", "alice", "WS01")
+			e := process(t, p, tokenID, "NTLM "+base64.StdEncoding.EncodeToString(msg))
+			c, ok := e.Draft.Attributes[CaptureAttribute].(Capture)
+			if !ok {
+				t.Fatalf("attributes = %v", e.Draft.Attributes)
+			}
+			want := Capture{
+				Version: tt.wantVersion, Domain: "CORP", Username: "alice", Workstation: "WS01",
+				Challenge: DefaultChallenge, Hash: tt.wantHash,
+			}
+			if c != want {
+				t.Errorf("capture = %+v, want %+v", c, want)
+			}
+			if e.Resp.Handled != tt.wantHandled {
+				t.Errorf("handled = %v, want %v", e.Resp.Handled, tt.wantHandled)
+			}
+		})
+	}
+}
+
+func TestKerberosFallsBack(t *testing.T) {
+	p, tokenID := setupTest(t, &Config{})
+
+	e := process(t, p, tokenID, "Negotiate YIIBxwYGKwYBBQUCoIIBuzCCAbeg")
+	if got := e.Resp.Headers["WWW-Authenticate"]; got != "NTLM" {
+		t.Errorf("WWW-Authenticate = %q, want NTLM", got)
+	}
+}
+
+func TestNotEnabled(t *testing.T) {
+	p, tokenID := setupTest(t, nil)
+
+	msg := authenticateMsg(nil, make([]byte, 24), "CORP", "alice", "")
+	e := process(t, p, tokenID, "NTLM "+base64.StdEncoding.EncodeToString(msg))
+	if e.Resp.Handled {
+		t.Error("challenged a token without ntlm enabled")
+	}
+	if _, ok := e.Draft.Attributes[CaptureAttribute]; ok {
+		t.Error("recorded a capture for a token without ntlm enabled")
+	}
+}
+
+func TestMalformedAuthenticate(t *testing.T) {
+	p, tokenID := setupTest(t, &Config{})
+
+	msg := authenticateMsg(nil, make([]byte, 24), "CORP", "alice", "")
+	binary.LittleEndian.PutUint32(msg[24:28], 4096) // NT response offset past the end
+	e := process(t, p, tokenID, "NTLM "+base64.StdEncoding.EncodeToString(msg))
+	if _, ok := e.Draft.Attributes[CaptureAttribute]; ok {
+		t.Error("recorded a capture from a malformed message")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr bool
+	}{
+		{"default", Config{}, false},
+		{"domain and challenge", Config{Domain: "CORP-01", Challenge: "deadbeefcafebabe"}, false},
+		{"long domain", Config{Domain: "ABCDEFGHIJKLMNOP"}, true},
+		{"domain with dot", Config{Domain: "corp.local"}, true},
+		{"short challenge", Config{Challenge: "1122"}, true},
+		{"non-hex challenge", Config{Challenge: "zz22334455667788"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,13 +1,30 @@
 package plugins
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
-	"github.com/rsclarke/oastrix/internal/events"
+	"github.com/rsclarke/oastrix/internal/requestid"
+	"github.com/rsclarke/oastrix/internal/tracing"
+	"github.com/rsclarke/oastrix/pkg/events"
 )
 
+// eventMetrics publishes how many events the pipeline processed, the total
+// seconds spent on them and how many ran past the event timeout, under
+// /debug/vars.
+var eventMetrics = expvar.NewMap("pipeline_events")
+
 // Pipeline orchestrates plugin hook execution in the correct order.
 type Pipeline struct {
 	store        Store
@@ -16,7 +33,19 @@ type Pipeline struct {
 	postStore    []PostStoreHook
 	httpResponse []HTTPResponseHook
 	dnsResponse  []DNSResponseHook
+	protocolResp []ProtocolResponseHook
 	logger       *zap.Logger
+
+	hookTimeout  time.Duration
+	eventTimeout time.Duration
+	breakers     breakers
+
+	mu       sync.Mutex
+	problems map[string]string // plugin ID to the panic that made it unhealthy
+
+	queueMu sync.RWMutex
+	queue   chan func() // nil unless asynchronous; each runs the storage half of an event
+	workers sync.WaitGroup
 }
 
 // NewPipeline creates a new Pipeline with the given logger.
@@ -28,32 +57,76 @@ func NewPipeline(logger *zap.Logger) *Pipeline {
 		postStore:    make([]PostStoreHook, 0),
 		httpResponse: make([]HTTPResponseHook, 0),
 		dnsResponse:  make([]DNSResponseHook, 0),
+		protocolResp: make([]ProtocolResponseHook, 0),
+		hookTimeout:  DefaultHookTimeout,
+		breakers: breakers{
+			threshold: DefaultBreakerThreshold,
+			cooldown:  DefaultBreakerCooldown,
+			now:       time.Now,
+		},
 	}
 }
 
+// SetHookTimeout sets the deadline of the context each hook is called with.
+// Zero disables it.
+func (p *Pipeline) SetHookTimeout(d time.Duration) {
+	p.hookTimeout = d
+}
+
+// SetEventTimeout sets the deadline for processing each event, covering all
+// of its hooks and storage. Hooks not yet run when it expires are skipped,
+// but the interaction is still stored. In asynchronous mode, the listener's
+// half and the queued half each get their own deadline. Zero disables it.
+func (p *Pipeline) SetEventTimeout(d time.Duration) {
+	p.eventTimeout = d
+}
+
+// SetCircuitBreaker sets how many consecutive errors or timeouts from a
+// plugin's hooks cause its hooks to be skipped for cooldown. A threshold of
+// zero disables circuit breaking.
+func (p *Pipeline) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	p.breakers.threshold = threshold
+	p.breakers.cooldown = cooldown
+}
+
 // SetStore sets the storage backend for the pipeline.
 func (p *Pipeline) SetStore(store Store) {
 	p.store = store
 }
 
 // Register detects which capability interfaces a plugin implements
-// and adds it to the appropriate hook lists.
+// and adds it to the appropriate hook lists, keeping each in priority order.
 func (p *Pipeline) Register(plugin Plugin) {
 	p.plugins = append(p.plugins, plugin)
 	if hook, ok := plugin.(PreStoreHook); ok {
-		p.preStore = append(p.preStore, hook)
+		p.preStore = insertHook(p.preStore, hook)
 	}
 	if hook, ok := plugin.(PostStoreHook); ok {
-		p.postStore = append(p.postStore, hook)
+		p.postStore = insertHook(p.postStore, hook)
 	}
 	if hook, ok := plugin.(HTTPResponseHook); ok {
-		p.httpResponse = append(p.httpResponse, hook)
+		p.httpResponse = insertHook(p.httpResponse, hook)
 	}
 	if hook, ok := plugin.(DNSResponseHook); ok {
-		p.dnsResponse = append(p.dnsResponse, hook)
+		p.dnsResponse = insertHook(p.dnsResponse, hook)
+	}
+	if hook, ok := plugin.(ProtocolResponseHook); ok {
+		p.protocolResp = insertHook(p.protocolResp, hook)
 	}
 }
 
+// insertHook adds hook to hooks, ordered by ascending priority and then ID.
+func insertHook[H any](hooks []H, hook H) []H {
+	hooks = append(hooks, hook)
+	slices.SortStableFunc(hooks, func(a, b H) int {
+		return cmp.Or(
+			cmp.Compare(pluginPriority(a), pluginPriority(b)),
+			cmp.Compare(pluginID(a), pluginID(b)),
+		)
+	})
+	return hooks
+}
+
 // ListPlugins returns metadata about all registered plugins.
 func (p *Pipeline) ListPlugins() []PluginInfo {
 	infos := make([]PluginInfo, 0, len(p.plugins))
@@ -62,6 +135,11 @@ func (p *Pipeline) ListPlugins() []PluginInfo {
 			ID:      plugin.ID(),
 			Type:    PluginTypeFeature,
 			Enabled: true,
+			Healthy: true,
+		}
+		if problem := p.problem(plugin.ID()); problem != "" {
+			info.Healthy = false
+			info.Problem = problem
 		}
 		if cp, ok := plugin.(CorePlugin); ok && cp.IsCore() {
 			info.Type = PluginTypeCore
@@ -74,96 +152,288 @@ func (p *Pipeline) ListPlugins() []PluginInfo {
 	return infos
 }
 
-// ProcessHTTP runs hooks in order: PreStore → Storage → PostStore → HTTPResponse.
-func (p *Pipeline) ProcessHTTP(ctx context.Context, e *events.HTTPEvent) error {
-	for _, hook := range p.preStore {
-		if err := hook.OnPreStore(ctx, &e.Event); err != nil {
-			p.logger.Warn("prestore hook error",
-				zap.String("plugin", pluginID(hook)),
-				zap.Error(err))
+// Plugin returns the registered plugin with the given ID.
+func (p *Pipeline) Plugin(id string) (Plugin, bool) {
+	for _, plugin := range p.plugins {
+		if plugin.ID() == id {
+			return plugin, true
 		}
 	}
+	return nil, false
+}
 
-	if !e.Draft.Drop && p.store != nil {
-		id, err := p.store.CreateInteraction(ctx, e.Draft)
-		if err != nil {
-			return err
+// Flush calls Flush on each registered plugin that implements Flusher.
+func (p *Pipeline) Flush(ctx context.Context) error {
+	var errs []error
+	for _, plugin := range p.plugins {
+		if f, ok := plugin.(Flusher); ok {
+			if err := f.Flush(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("flush %s: %w", plugin.ID(), err))
+			}
 		}
-		e.InteractionID = id
+	}
+	return errors.Join(errs...)
+}
 
-		if len(e.Draft.Attributes) > 0 {
-			if err := p.store.SaveAttributes(ctx, id, e.Draft.Attributes); err != nil {
-				p.logger.Warn("failed to save attributes", zap.Error(err))
-			}
+// Payloads collects the payloads contributed by registered plugins, in
+// registration order.
+func (p *Pipeline) Payloads(ctx PayloadContext) []Payload {
+	var out []Payload
+	for _, plugin := range p.plugins {
+		if pp, ok := plugin.(PayloadProvider); ok {
+			out = append(out, pp.Payloads(ctx)...)
 		}
 	}
+	return out
+}
 
-	for _, hook := range p.postStore {
-		if err := hook.OnPostStore(ctx, &e.Event); err != nil {
-			p.logger.Warn("poststore hook error",
-				zap.String("plugin", pluginID(hook)),
-				zap.Error(err))
+// ProcessHTTP runs hooks in order: PreStore → Storage → PostStore → HTTPResponse.
+// See StartWorkers for the order in asynchronous mode.
+func (p *Pipeline) ProcessHTTP(ctx context.Context, e *events.HTTPEvent) error {
+	respond := func(ctx context.Context) {
+		for _, hook := range p.httpResponse {
+			p.runHook(ctx, "plugin.http_response", "http response hook error", hook, func(ctx context.Context) error {
+				return hook.OnHTTPResponse(ctx, e)
+			})
+			if e.Resp != nil && e.Resp.Handled {
+				break
+			}
+		}
+	}
+	saveResponse := func(ctx context.Context) {
+		if rs, ok := p.store.(ResponseStore); ok && e.InteractionID != 0 && e.Resp != nil {
+			p.runStore(ctx, "storage.save_response", "failed to save response", func(ctx context.Context) error {
+				return rs.SaveHTTPResponse(ctx, e.InteractionID, e.Resp)
+			})
 		}
 	}
+	return p.processWith(ctx, &e.Event, respond, saveResponse)
+}
 
-	for _, hook := range p.httpResponse {
-		if err := hook.OnHTTPResponse(ctx, e); err != nil {
-			p.logger.Warn("http response hook error",
-				zap.String("plugin", pluginID(hook)),
-				zap.Error(err))
+// ProcessDNS runs hooks in order: PreStore → Storage → PostStore → DNSResponse.
+// See StartWorkers for the order in asynchronous mode.
+func (p *Pipeline) ProcessDNS(ctx context.Context, e *events.DNSEvent) error {
+	respond := func(ctx context.Context) {
+		for _, hook := range p.dnsResponse {
+			p.runHook(ctx, "plugin.dns_response", "dns response hook error", hook, func(ctx context.Context) error {
+				return hook.OnDNSResponse(ctx, e)
+			})
+			if e.Resp != nil && e.Resp.Handled {
+				break
+			}
 		}
-		if e.Resp != nil && e.Resp.Handled {
-			break
+	}
+	saveResponse := func(ctx context.Context) {
+		if rs, ok := p.store.(ResponseStore); ok && e.InteractionID != 0 && e.Resp != nil {
+			p.runStore(ctx, "storage.save_response", "failed to save response", func(ctx context.Context) error {
+				return rs.SaveDNSResponse(ctx, e.InteractionID, e.Resp)
+			})
 		}
 	}
+	return p.processWith(ctx, &e.Event, respond, saveResponse)
+}
 
+// ProcessProtocol runs hooks in order: PreStore → Storage → PostStore →
+// ProtocolResponse, for protocols without a dedicated event type. See
+// StartWorkers for the order in asynchronous mode.
+func (p *Pipeline) ProcessProtocol(ctx context.Context, e *events.GenericEvent) error {
+	respond := func(ctx context.Context) {
+		for _, hook := range p.protocolResp {
+			p.runHook(ctx, "plugin.protocol_response", "protocol response hook error", hook, func(ctx context.Context) error {
+				return hook.OnProtocolResponse(ctx, e)
+			})
+			if e.Resp != nil && e.Resp.Handled {
+				break
+			}
+		}
+	}
+	return p.processWith(ctx, &e.Event, respond, func(context.Context) {})
+}
+
+// processWith runs the PreStore hooks, stores e and runs the PostStore hooks
+// around the protocol's response hooks and saving its response, queueing
+// storage in asynchronous mode.
+func (p *Pipeline) processWith(ctx context.Context, e *events.Event, respond, saveResponse func(context.Context)) error {
+	ctx, done := p.startEvent(ctx, e)
+	defer done()
+
+	if p.async() {
+		p.preStoreStage(ctx, e)
+		respond(ctx)
+		p.enqueue(ctx, func(ctx context.Context) error {
+			ctx, done := p.startEvent(ctx, e)
+			defer done()
+			if err := p.storeStage(ctx, e); err != nil {
+				return err
+			}
+			saveResponse(ctx)
+			return nil
+		})
+		return nil
+	}
+
+	p.preStoreStage(ctx, e)
+	if err := p.storeStage(ctx, e); err != nil {
+		return err
+	}
+	respond(ctx)
+	saveResponse(ctx)
 	return nil
 }
 
-// ProcessDNS runs hooks in order: PreStore → Storage → PostStore → DNSResponse.
-func (p *Pipeline) ProcessDNS(ctx context.Context, e *events.DNSEvent) error {
-	for _, hook := range p.preStore {
-		if err := hook.OnPreStore(ctx, &e.Event); err != nil {
-			p.logger.Warn("prestore hook error",
-				zap.String("plugin", pluginID(hook)),
-				zap.Error(err))
+// startEvent applies the event timeout to ctx and adds e's request ID, which
+// the pipeline's log lines for the event carry. The returned function
+// releases it and records how long processing took, logging when it overran.
+func (p *Pipeline) startEvent(ctx context.Context, e *events.Event) (context.Context, func()) {
+	start := time.Now()
+	if e.RequestID != "" {
+		ctx = requestid.NewContext(ctx, e.RequestID)
+	}
+	cancel := context.CancelFunc(func() {})
+	if p.eventTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.eventTimeout)
+	}
+	return ctx, func() {
+		elapsed := time.Since(start)
+		eventMetrics.Add("processed", 1)
+		eventMetrics.AddFloat("seconds", elapsed.Seconds())
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			eventMetrics.Add("deadline_exceeded", 1)
+			requestid.Logger(ctx, p.logger).Warn("event processing exceeded its deadline",
+				zap.String("kind", string(e.Draft.Kind)), zap.Duration("elapsed", elapsed), zap.Duration("timeout", p.eventTimeout))
 		}
+		cancel()
 	}
+}
 
+// preStoreStage runs the PreStore hooks.
+func (p *Pipeline) preStoreStage(ctx context.Context, e *events.Event) {
+	for _, hook := range p.preStore {
+		p.runHook(ctx, "plugin.prestore", "prestore hook error", hook, func(ctx context.Context) error {
+			return hook.OnPreStore(ctx, e)
+		})
+	}
+}
+
+// storeStage stores e unless it was dropped, then runs the PostStore hooks.
+func (p *Pipeline) storeStage(ctx context.Context, e *events.Event) error {
 	if !e.Draft.Drop && p.store != nil {
-		id, err := p.store.CreateInteraction(ctx, e.Draft)
+		storeCtx, span := tracing.Start(ctx, "storage.create_interaction")
+		id, err := p.store.CreateInteraction(storeCtx, e.Draft)
+		tracing.End(span, err)
 		if err != nil {
 			return err
 		}
 		e.InteractionID = id
 
 		if len(e.Draft.Attributes) > 0 {
-			if err := p.store.SaveAttributes(ctx, id, e.Draft.Attributes); err != nil {
-				p.logger.Warn("failed to save attributes", zap.Error(err))
-			}
+			p.runStore(ctx, "storage.save_attributes", "failed to save attributes", func(ctx context.Context) error {
+				return p.store.SaveAttributes(ctx, id, e.Draft.Attributes)
+			})
 		}
 	}
 
 	for _, hook := range p.postStore {
-		if err := hook.OnPostStore(ctx, &e.Event); err != nil {
-			p.logger.Warn("poststore hook error",
-				zap.String("plugin", pluginID(hook)),
-				zap.Error(err))
-		}
+		p.runHook(ctx, "plugin.poststore", "poststore hook error", hook, func(ctx context.Context) error {
+			return hook.OnPostStore(ctx, e)
+		})
+	}
+
+	return nil
+}
+
+// runHook calls a plugin hook inside its own span, with the hook timeout.
+// Hook errors are logged but do not stop the pipeline. Hooks of a plugin
+// whose circuit breaker is open are skipped.
+func (p *Pipeline) runHook(ctx context.Context, spanName, errMsg string, hook any, fn func(context.Context) error) {
+	id := pluginID(hook)
+	breakable := !isCore(hook)
+	if breakable && !p.breakers.allow(id) {
+		return
 	}
+	if err := ctx.Err(); err != nil {
+		requestid.Logger(ctx, p.logger).Debug("skipping hook after event deadline", zap.String("plugin", id), zap.Error(err))
+		return
+	}
+	eventCtx := ctx
 
-	for _, hook := range p.dnsResponse {
-		if err := hook.OnDNSResponse(ctx, e); err != nil {
-			p.logger.Warn("dns response hook error",
-				zap.String("plugin", pluginID(hook)),
-				zap.Error(err))
+	ctx, span := tracing.Start(ctx, spanName, trace.WithAttributes(attribute.String("oastrix.plugin", id)))
+	timeout := p.hookTimeout
+	if tp, ok := hook.(TimeoutPlugin); ok {
+		timeout = tp.HookTimeout()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := p.callHook(ctx, id, fn)
+	if err == nil && ctx.Err() == context.DeadlineExceeded {
+		// The hook ignored its deadline, so it stalled the pipeline as
+		// much as one that failed with it.
+		err = fmt.Errorf("hook exceeded timeout of %v", timeout)
+		if eventCtx.Err() != nil {
+			err = fmt.Errorf("hook exceeded event timeout of %v", p.eventTimeout)
 		}
-		if e.Resp != nil && e.Resp.Handled {
-			break
+	}
+	tracing.End(span, err)
+	if err != nil {
+		requestid.Logger(ctx, p.logger).Warn(errMsg, zap.String("plugin", id), zap.Error(err))
+	}
+
+	// A hook cut short by the event deadline rather than its own is not
+	// held against it.
+	if breakable && eventCtx.Err() == nil && p.breakers.record(id, err) {
+		p.logger.Error("plugin circuit breaker opened; skipping its hooks",
+			zap.String("plugin", id), zap.Int("failures", p.breakers.threshold), zap.Duration("cooldown", p.breakers.cooldown))
+	}
+}
+
+// callHook calls fn, recovering from a panic in it. A panic is logged with
+// its stack, marks the plugin unhealthy and is returned as an error.
+func (p *Pipeline) callHook(ctx context.Context, id string, fn func(context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("hook panicked: %v", r)
+			requestid.Logger(ctx, p.logger).Error("plugin hook panicked", zap.String("plugin", id), zap.Any("panic", r), zap.ByteString("stack", debug.Stack()))
+			p.mu.Lock()
+			if p.problems == nil {
+				p.problems = make(map[string]string)
+			}
+			p.problems[id] = err.Error()
+			p.mu.Unlock()
 		}
+	}()
+	return fn(ctx)
+}
+
+func (p *Pipeline) problem(id string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.problems[id]
+}
+
+// runStore calls a best-effort storage operation inside its own span, logging
+// any failure.
+func (p *Pipeline) runStore(ctx context.Context, spanName, errMsg string, fn func(context.Context) error) {
+	ctx, span := tracing.Start(ctx, spanName)
+	err := fn(ctx)
+	tracing.End(span, err)
+	if err != nil {
+		requestid.Logger(ctx, p.logger).Warn(errMsg, zap.Error(err))
 	}
+}
 
-	return nil
+func pluginPriority(hook any) int {
+	if p, ok := hook.(PrioritizedPlugin); ok {
+		return p.Priority()
+	}
+	return DefaultPriority
+}
+
+func isCore(hook any) bool {
+	cp, ok := hook.(CorePlugin)
+	return ok && cp.IsCore()
 }
 
 func pluginID(hook any) string {
@@ -3,11 +3,19 @@ package plugins
 import (
 	"context"
 	"errors"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 	"go.uber.org/zap"
 
-	"github.com/rsclarke/oastrix/internal/events"
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/models"
 )
 
 type mockStore struct {
@@ -41,6 +49,33 @@ func (m *mockStore) SaveAttributes(_ context.Context, id int64, attrs map[string
 	return m.saveErr
 }
 
+func (m *mockStore) GetInteractionsByToken(_ context.Context, _ int64, _ int) ([]models.Interaction, error) {
+	return nil, nil
+}
+
+func (m *mockStore) GetAttributes(_ context.Context, _ int64) (map[string]any, error) {
+	return nil, nil
+}
+
+type mockResponseStore struct {
+	mockStore
+	httpResp *events.HTTPResponsePlan
+	dnsResp  *events.DNSResponsePlan
+	respID   int64
+}
+
+func (m *mockResponseStore) SaveHTTPResponse(_ context.Context, id int64, resp *events.HTTPResponsePlan) error {
+	m.respID = id
+	m.httpResp = resp
+	return nil
+}
+
+func (m *mockResponseStore) SaveDNSResponse(_ context.Context, id int64, resp *events.DNSResponsePlan) error {
+	m.respID = id
+	m.dnsResp = resp
+	return nil
+}
+
 type callRecord struct {
 	pluginID string
 	phase    string
@@ -426,6 +461,101 @@ func TestAttributesSaved(t *testing.T) {
 	}
 }
 
+func TestResponseSaved(t *testing.T) {
+	p := NewPipeline(zap.NewNop())
+	store := &mockResponseStore{mockStore: mockStore{returnedID: 42}}
+	p.SetStore(store)
+
+	httpEvent := &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{TokenValue: "test"}},
+		Resp:  &events.HTTPResponsePlan{Status: 204},
+	}
+	if err := p.ProcessHTTP(context.Background(), httpEvent); err != nil {
+		t.Fatalf("ProcessHTTP failed: %v", err)
+	}
+	if store.respID != 42 || store.httpResp != httpEvent.Resp {
+		t.Errorf("expected HTTP response saved for interaction 42, got id %d", store.respID)
+	}
+
+	dnsEvent := &events.DNSEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{TokenValue: "test"}},
+		Resp:  &events.DNSResponsePlan{RCode: 3},
+	}
+	if err := p.ProcessDNS(context.Background(), dnsEvent); err != nil {
+		t.Fatalf("ProcessDNS failed: %v", err)
+	}
+	if store.dnsResp != dnsEvent.Resp {
+		t.Error("expected DNS response to be saved")
+	}
+}
+
+func TestResponseNotSavedWhenDropped(t *testing.T) {
+	p := NewPipeline(zap.NewNop())
+	store := &mockResponseStore{mockStore: mockStore{returnedID: 42}}
+	p.SetStore(store)
+
+	e := &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{TokenValue: "test", Drop: true}},
+		Resp:  &events.HTTPResponsePlan{Status: 200},
+	}
+	if err := p.ProcessHTTP(context.Background(), e); err != nil {
+		t.Fatalf("ProcessHTTP failed: %v", err)
+	}
+	if store.httpResp != nil {
+		t.Error("expected no response to be saved for a dropped interaction")
+	}
+}
+
+func TestProcessHTTPRecordsSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	p := NewPipeline(zap.NewNop())
+	p.SetStore(&mockResponseStore{mockStore: mockStore{returnedID: 1}})
+	var calls []callRecord
+	p.Register(&mockPlugin{id: "enrich", calls: &calls})
+
+	e := &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{TokenValue: "test"}},
+		Resp:  &events.HTTPResponsePlan{},
+	}
+	if err := p.ProcessHTTP(context.Background(), e); err != nil {
+		t.Fatalf("ProcessHTTP failed: %v", err)
+	}
+
+	got := map[string]string{}
+	for _, span := range recorder.Ended() {
+		plugin := ""
+		for _, attr := range span.Attributes() {
+			if attr.Key == "oastrix.plugin" {
+				plugin = attr.Value.AsString()
+			}
+		}
+		got[span.Name()] = plugin
+	}
+
+	want := map[string]string{
+		"plugin.prestore":            "enrich",
+		"storage.create_interaction": "",
+		"plugin.poststore":           "enrich",
+		"plugin.http_response":       "enrich",
+		"storage.save_response":      "",
+	}
+	for name, plugin := range want {
+		gotPlugin, ok := got[name]
+		if !ok {
+			t.Errorf("missing span %q", name)
+			continue
+		}
+		if gotPlugin != plugin {
+			t.Errorf("span %q plugin = %q, want %q", name, gotPlugin, plugin)
+		}
+	}
+}
+
 func TestNoStoreDoesNotPanic(t *testing.T) {
 	p := NewPipeline(zap.NewNop())
 
@@ -453,3 +583,470 @@ func TestPluginIDHelper(t *testing.T) {
 		t.Errorf("expected 'unknown', got '%s'", id)
 	}
 }
+
+type prioritizedPlugin struct {
+	mockPlugin
+	priority int
+}
+
+func (m *prioritizedPlugin) Priority() int { return m.priority }
+
+func TestRegisterSortsByPriority(t *testing.T) {
+	var calls []callRecord
+	p := NewPipeline(zap.NewNop())
+
+	// Registered out of order: fallback first, then plugins without a
+	// priority, whose ties are broken by ID.
+	p.Register(&prioritizedPlugin{mockPlugin{id: "fallback", calls: &calls}, 999})
+	p.Register(&mockPlugin{id: "zeta", calls: &calls})
+	p.Register(&mockPlugin{id: "alpha", calls: &calls})
+	p.Register(&prioritizedPlugin{mockPlugin{id: "early", calls: &calls}, 10})
+
+	e := &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{TokenValue: "test"}},
+		Resp:  &events.HTTPResponsePlan{},
+	}
+	if err := p.ProcessHTTP(context.Background(), e); err != nil {
+		t.Fatalf("ProcessHTTP failed: %v", err)
+	}
+
+	var got []string
+	for _, c := range calls {
+		if c.phase == "httpresponse" {
+			got = append(got, c.pluginID)
+		}
+	}
+	want := []string{"early", "alpha", "zeta", "fallback"}
+	if !slices.Equal(got, want) {
+		t.Errorf("http response order = %v, want %v", got, want)
+	}
+
+	// ListPlugins keeps registration order.
+	infos := p.ListPlugins()
+	if infos[0].ID != "fallback" || infos[3].ID != "early" {
+		t.Errorf("ListPlugins order = %v", infos)
+	}
+}
+
+func TestPluginPriorityHelper(t *testing.T) {
+	if got := pluginPriority(&mockPlugin{id: "plain"}); got != DefaultPriority {
+		t.Errorf("pluginPriority(plain) = %d, want %d", got, DefaultPriority)
+	}
+	if got := pluginPriority(&prioritizedPlugin{mockPlugin{id: "p"}, 5}); got != 5 {
+		t.Errorf("pluginPriority(prioritized) = %d, want 5", got)
+	}
+}
+
+// slowPlugin blocks in its pre-store hook until its context is done, or for
+// delay if it ignores its context.
+type slowPlugin struct {
+	ignoreCtx bool
+	delay     time.Duration
+	calls     int
+}
+
+func (s *slowPlugin) ID() string               { return "slow" }
+func (s *slowPlugin) Init(_ InitContext) error { return nil }
+
+func (s *slowPlugin) OnPreStore(ctx context.Context, _ *events.Event) error {
+	s.calls++
+	if s.ignoreCtx {
+		time.Sleep(s.delay)
+		return nil
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func newTestEvent() *events.HTTPEvent {
+	return &events.HTTPEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{TokenValue: "test"}},
+		Resp:  &events.HTTPResponsePlan{},
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	p := NewPipeline(zap.NewNop())
+	p.SetHookTimeout(10 * time.Millisecond)
+	slow := &slowPlugin{}
+	p.Register(slow)
+
+	start := time.Now()
+	if err := p.ProcessHTTP(context.Background(), newTestEvent()); err != nil {
+		t.Fatalf("ProcessHTTP failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ProcessHTTP took %v despite the hook timeout", elapsed)
+	}
+	if slow.calls != 1 {
+		t.Errorf("slow hook called %d times, want 1", slow.calls)
+	}
+}
+
+// failingPlugin counts calls to its pre-store hook, which fails while fail
+// is set.
+type failingPlugin struct {
+	id    string
+	core  bool
+	fail  bool
+	calls int
+}
+
+func (f *failingPlugin) ID() string               { return f.id }
+func (f *failingPlugin) Init(_ InitContext) error { return nil }
+func (f *failingPlugin) IsCore() bool             { return f.core }
+
+func (f *failingPlugin) OnPreStore(_ context.Context, _ *events.Event) error {
+	f.calls++
+	if f.fail {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	p := NewPipeline(zap.NewNop())
+	p.SetCircuitBreaker(2, time.Minute)
+	now := time.Unix(1700000000, 0)
+	p.breakers.now = func() time.Time { return now }
+
+	feature := &failingPlugin{id: "feature", fail: true}
+	core := &failingPlugin{id: "core", core: true, fail: true}
+	p.Register(feature)
+	p.Register(core)
+
+	process := func() {
+		t.Helper()
+		if err := p.ProcessHTTP(context.Background(), newTestEvent()); err != nil {
+			t.Fatalf("ProcessHTTP failed: %v", err)
+		}
+	}
+
+	for range 4 {
+		process()
+	}
+	if feature.calls != 2 {
+		t.Errorf("feature hook called %d times, want 2 before the breaker opened", feature.calls)
+	}
+	if core.calls != 4 {
+		t.Errorf("core hook called %d times, want 4: core plugins are never skipped", core.calls)
+	}
+
+	// After the cooldown one call is let through; failing reopens the breaker.
+	now = now.Add(time.Minute)
+	process()
+	process()
+	if feature.calls != 3 {
+		t.Errorf("feature hook called %d times after cooldown, want 3", feature.calls)
+	}
+
+	// Succeeding after the next cooldown closes it.
+	now = now.Add(time.Minute)
+	feature.fail = false
+	process()
+	feature.fail = true
+	process()
+	process()
+	if feature.calls != 6 {
+		t.Errorf("feature hook called %d times after recovering, want 6", feature.calls)
+	}
+}
+
+func TestSlowHookTripsBreaker(t *testing.T) {
+	p := NewPipeline(zap.NewNop())
+	p.SetHookTimeout(time.Millisecond)
+	p.SetCircuitBreaker(1, time.Minute)
+	slow := &slowPlugin{ignoreCtx: true, delay: 5 * time.Millisecond}
+	p.Register(slow)
+
+	for range 3 {
+		if err := p.ProcessHTTP(context.Background(), newTestEvent()); err != nil {
+			t.Fatalf("ProcessHTTP failed: %v", err)
+		}
+	}
+	if slow.calls != 1 {
+		t.Errorf("slow hook called %d times, want 1 before the breaker opened", slow.calls)
+	}
+}
+
+// patientPlugin is a slowPlugin that opts out of the hook timeout.
+type patientPlugin struct{ slowPlugin }
+
+func (p *patientPlugin) HookTimeout() time.Duration { return 0 }
+
+func TestTimeoutPluginOverride(t *testing.T) {
+	p := NewPipeline(zap.NewNop())
+	p.SetHookTimeout(time.Millisecond)
+	p.SetCircuitBreaker(1, time.Minute)
+	patient := &patientPlugin{slowPlugin{ignoreCtx: true, delay: 5 * time.Millisecond}}
+	p.Register(patient)
+
+	for range 3 {
+		if err := p.ProcessHTTP(context.Background(), newTestEvent()); err != nil {
+			t.Fatalf("ProcessHTTP failed: %v", err)
+		}
+	}
+	if patient.calls != 3 {
+		t.Errorf("hook called %d times, want 3: it has no timeout to exceed", patient.calls)
+	}
+}
+
+func TestEventTimeout(t *testing.T) {
+	var calls []callRecord
+	store := &mockStore{returnedID: 1}
+	p := NewPipeline(zap.NewNop())
+	p.SetHookTimeout(0)
+	p.SetEventTimeout(20 * time.Millisecond)
+	p.SetCircuitBreaker(1, time.Minute)
+	p.SetStore(store)
+	slow := &slowPlugin{}
+	p.Register(slow)
+	p.Register(&mockPlugin{id: "tail", calls: &calls})
+
+	for range 2 {
+		start := time.Now()
+		if err := p.ProcessHTTP(context.Background(), newTestEvent()); err != nil {
+			t.Fatalf("ProcessHTTP failed: %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("ProcessHTTP took %v despite the event timeout", elapsed)
+		}
+	}
+	if !store.createCalled {
+		t.Error("interaction not stored after the event deadline")
+	}
+	if len(calls) != 0 {
+		t.Errorf("hooks after the event deadline were called: %v", calls)
+	}
+	if slow.calls != 2 {
+		t.Errorf("slow hook called %d times, want 2: the event deadline is not held against it", slow.calls)
+	}
+}
+
+type panickingPlugin struct{}
+
+func (panickingPlugin) ID() string               { return "panicky" }
+func (panickingPlugin) Init(_ InitContext) error { return nil }
+
+func (panickingPlugin) OnPreStore(_ context.Context, _ *events.Event) error {
+	panic("nil map")
+}
+
+func TestHookPanicMarksPluginUnhealthy(t *testing.T) {
+	var calls []callRecord
+	p := NewPipeline(zap.NewNop())
+	p.SetStore(&mockStore{returnedID: 42})
+	p.Register(panickingPlugin{})
+	p.Register(&mockPlugin{id: "after", calls: &calls})
+
+	if err := p.ProcessHTTP(context.Background(), newTestEvent()); err != nil {
+		t.Fatalf("ProcessHTTP failed: %v", err)
+	}
+	if len(calls) != 3 {
+		t.Errorf("expected 3 calls to the plugin after the panic, got %d: %v", len(calls), calls)
+	}
+
+	for _, info := range p.ListPlugins() {
+		switch info.ID {
+		case "panicky":
+			if info.Healthy || info.Problem != "hook panicked: nil map" {
+				t.Errorf("panicky = %+v, want unhealthy with the panic", info)
+			}
+		case "after":
+			if !info.Healthy || info.Problem != "" {
+				t.Errorf("after = %+v, want healthy", info)
+			}
+		}
+	}
+}
+
+type protocolPlugin struct{ calls *[]callRecord }
+
+func (protocolPlugin) ID() string               { return "proto" }
+func (protocolPlugin) Init(_ InitContext) error { return nil }
+
+func (m protocolPlugin) OnProtocolResponse(_ context.Context, e *events.GenericEvent) error {
+	*m.calls = append(*m.calls, callRecord{"proto", "protocol"})
+	e.Resp = &events.ProtocolResponsePlan{Data: []byte("220 ready\r\n")}
+	return nil
+}
+
+func TestProcessProtocol(t *testing.T) {
+	var calls []callRecord
+	p := NewPipeline(zap.NewNop())
+	p.SetStore(&mockStore{returnedID: 42})
+	p.Register(&mockPlugin{id: "p1", calls: &calls})
+	p.Register(protocolPlugin{calls: &calls})
+
+	e := &events.GenericEvent{
+		Event: events.Event{Draft: &events.InteractionDraft{
+			TokenValue: "test",
+			Kind:       events.KindSMTP,
+			Protocol:   &events.ProtocolDraft{Raw: []byte("HELO x\r\n")},
+		}},
+	}
+	if err := p.ProcessProtocol(context.Background(), e); err != nil {
+		t.Fatalf("ProcessProtocol failed: %v", err)
+	}
+
+	want := []callRecord{
+		{"p1", "prestore"},
+		{"p1", "poststore"},
+		{"proto", "protocol"},
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+	if e.InteractionID != 42 {
+		t.Errorf("InteractionID = %d, want 42", e.InteractionID)
+	}
+	if e.Resp == nil || string(e.Resp.Data) != "220 ready\r\n" {
+		t.Errorf("Resp = %+v", e.Resp)
+	}
+}
+
+// blockingStore blocks CreateInteraction until release is closed.
+type blockingStore struct {
+	mockStore
+	release chan struct{}
+	mu      sync.Mutex
+}
+
+func (b *blockingStore) CreateInteraction(ctx context.Context, draft *events.InteractionDraft) (int64, error) {
+	<-b.release
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.mockStore.CreateInteraction(ctx, draft)
+}
+
+func TestAsyncPipeline(t *testing.T) {
+	var calls []callRecord
+	p := NewPipeline(zap.NewNop())
+	store := &blockingStore{mockStore: mockStore{returnedID: 42}, release: make(chan struct{})}
+	p.SetStore(store)
+	p.Register(&mockPlugin{id: "p1", calls: &calls})
+	p.StartWorkers(1, 1)
+
+	e := newTestEvent()
+	if err := p.ProcessHTTP(context.Background(), e); err != nil {
+		t.Fatalf("ProcessHTTP failed: %v", err)
+	}
+
+	// Storage is blocked, yet the response hooks have already run.
+	want := []callRecord{{"p1", "prestore"}, {"p1", "httpresponse"}}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls before storage = %v, want %v", calls, want)
+	}
+	if e.InteractionID != 0 {
+		t.Errorf("InteractionID = %d before storage, want 0", e.InteractionID)
+	}
+
+	close(store.release)
+	p.StopWorkers()
+	want = append(want, callRecord{"p1", "poststore"})
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls after storage = %v, want %v", calls, want)
+	}
+	if e.InteractionID != 42 {
+		t.Errorf("InteractionID = %d after storage, want 42", e.InteractionID)
+	}
+}
+
+func TestAsyncPipelineDrainTimeout(t *testing.T) {
+	p := NewPipeline(zap.NewNop())
+	store := &blockingStore{mockStore: mockStore{returnedID: 42}, release: make(chan struct{})}
+	p.SetStore(store)
+	p.StartWorkers(1, 2)
+
+	// The worker blocks on the first event and the second waits in the queue.
+	for range 2 {
+		if err := p.ProcessHTTP(context.Background(), newTestEvent()); err != nil {
+			t.Fatalf("ProcessHTTP failed: %v", err)
+		}
+	}
+	for len(p.queue) > 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := p.Drain(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "1 queued") {
+		t.Errorf("Drain() = %v, want a deadline error with 1 queued event", err)
+	}
+
+	// Events arriving after the drain began are stored inline.
+	if p.async() {
+		t.Error("pipeline still asynchronous after Drain")
+	}
+	close(store.release)
+	if err := p.Drain(context.Background()); err != nil {
+		t.Errorf("second Drain() = %v, want nil once storage resumes", err)
+	}
+}
+
+type flushPlugin struct {
+	mockPlugin
+	err     error
+	flushed bool
+}
+
+func (f *flushPlugin) Flush(ctx context.Context) error {
+	f.flushed = true
+	return f.err
+}
+
+func TestPipelineFlush(t *testing.T) {
+	p := NewPipeline(zap.NewNop())
+	ok := &flushPlugin{mockPlugin: mockPlugin{id: "ok"}}
+	failing := &flushPlugin{mockPlugin: mockPlugin{id: "failing"}, err: errors.New("collector down")}
+	p.Register(ok)
+	p.Register(failing)
+	p.Register(&mockPlugin{id: "plain"})
+
+	err := p.Flush(context.Background())
+	if !ok.flushed || !failing.flushed {
+		t.Error("Flush did not flush every Flusher")
+	}
+	if err == nil || !strings.Contains(err.Error(), "flush failing: collector down") {
+		t.Errorf("Flush() = %v, want the failing plugin's error", err)
+	}
+}
+
+func TestAsyncPipelineFullQueueStoresInline(t *testing.T) {
+	p := NewPipeline(zap.NewNop())
+	store := &blockingStore{mockStore: mockStore{returnedID: 42}, release: make(chan struct{})}
+	p.SetStore(store)
+	p.StartWorkers(1, 1)
+
+	// The worker blocks on the first event and the second fills the queue.
+	process := func() {
+		t.Helper()
+		if err := p.ProcessHTTP(context.Background(), newTestEvent()); err != nil {
+			t.Fatalf("ProcessHTTP failed: %v", err)
+		}
+	}
+	process()
+	for len(p.queue) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	process()
+
+	done := make(chan *events.HTTPEvent)
+	go func() {
+		e := newTestEvent()
+		_ = p.ProcessHTTP(context.Background(), e)
+		done <- e
+	}()
+	select {
+	case <-done:
+		t.Fatal("ProcessHTTP returned before storage with a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(store.release)
+	if e := <-done; e.InteractionID != 42 {
+		t.Errorf("InteractionID = %d, want 42 after storing inline", e.InteractionID)
+	}
+	p.StopWorkers()
+}
@@ -0,0 +1,51 @@
+// Package plugintest provides in-memory configuration views for testing
+// plugins.
+package plugintest
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+)
+
+var (
+	_ plugins.GlobalConfigView = GlobalConfig{}
+	_ plugins.TokenConfigView  = TokenConfigs[struct{}]{}
+)
+
+// GlobalConfig serves Value as a plugin's server-wide configuration. A nil
+// Value, or a nil pointer, leaves out unchanged, as if none were stored.
+type GlobalConfig struct {
+	Value any
+}
+
+// Get decodes c.Value into out.
+func (c GlobalConfig) Get(_ string, out any) error {
+	if c.Value == nil {
+		return nil
+	}
+	return decodeInto(c.Value, out)
+}
+
+// TokenConfigs serves per-token configurations, keyed by token ID.
+type TokenConfigs[T any] map[int64]T
+
+// Get decodes the configuration of tokenID into out, reporting false if it
+// has none.
+func (t TokenConfigs[T]) Get(_ context.Context, tokenID int64, _ string, out any) (bool, error) {
+	cfg, ok := t[tokenID]
+	if !ok {
+		return false, nil
+	}
+	return true, decodeInto(cfg, out)
+}
+
+// decodeInto round-trips v through JSON into out, as stored configuration is.
+func decodeInto(v, out any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
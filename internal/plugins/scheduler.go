@@ -0,0 +1,148 @@
+package plugins
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// jobMetrics publishes each job's run count, error count and last run
+// duration under /debug/vars, keyed by job name.
+var jobMetrics = expvar.NewMap("plugin_jobs")
+
+// JobScheduler runs the periodic jobs plugins register through their
+// Scheduler. Jobs registered before Start begin when it is called; later
+// ones begin immediately. Runs of one job never overlap.
+type JobScheduler struct {
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	done    <-chan struct{} // closed when the jobs are to stop; nil until Start
+	cancel  context.CancelFunc
+	pending []*job
+	counts  map[string]int
+	wg      sync.WaitGroup
+}
+
+type job struct {
+	name     string
+	interval time.Duration
+	fn       func(context.Context) error
+}
+
+// NewJobScheduler creates a JobScheduler with no jobs.
+func NewJobScheduler(logger *zap.Logger) *JobScheduler {
+	return &JobScheduler{logger: logger, counts: make(map[string]int)}
+}
+
+// ForPlugin returns the Scheduler for the plugin with the given ID. Its jobs
+// are named after the ID and the order they were registered in, e.g.
+// "quota/1".
+func (s *JobScheduler) ForPlugin(id string) Scheduler {
+	return pluginScheduler{s: s, id: id}
+}
+
+// Start runs the registered jobs until ctx is cancelled or Stop is called.
+func (s *JobScheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done != nil {
+		return
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	s.done = ctx.Done()
+	for _, j := range s.pending {
+		s.run(j)
+	}
+	s.pending = nil
+}
+
+// Stop cancels all jobs and waits for running ones to return.
+func (s *JobScheduler) Stop() {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *JobScheduler) every(id string, interval time.Duration, fn func(context.Context) error) {
+	if interval <= 0 {
+		panic(fmt.Sprintf("plugin %s: non-positive job interval %v", id, interval))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[id]++
+	j := &job{name: fmt.Sprintf("%s/%d", id, s.counts[id]), interval: interval, fn: fn}
+	if s.done == nil {
+		s.pending = append(s.pending, j)
+		return
+	}
+	s.run(j)
+}
+
+// run starts j's loop. s.mu must be held.
+func (s *JobScheduler) run(j *job) {
+	done := s.done
+	s.wg.Add(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer s.wg.Done()
+		<-done
+		cancel()
+	}()
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.runOnce(ctx, j)
+			}
+		}
+	}()
+}
+
+// runOnce runs j once, recording its outcome. A panicking job is logged and
+// runs again at its next interval.
+func (s *JobScheduler) runOnce(ctx context.Context, j *job) {
+	start := time.Now()
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		return j.fn(ctx)
+	}()
+	elapsed := time.Since(start)
+
+	jobMetrics.Add(j.name+".runs", 1)
+	duration := new(expvar.Int)
+	duration.Set(elapsed.Milliseconds())
+	jobMetrics.Set(j.name+".last_duration_ms", duration)
+	if err != nil {
+		jobMetrics.Add(j.name+".errors", 1)
+		s.logger.Warn("plugin job failed", zap.String("job", j.name), zap.Duration("duration", elapsed), zap.Error(err))
+		return
+	}
+	s.logger.Debug("plugin job completed", zap.String("job", j.name), zap.Duration("duration", elapsed))
+}
+
+// pluginScheduler registers jobs on behalf of one plugin.
+type pluginScheduler struct {
+	s  *JobScheduler
+	id string
+}
+
+func (p pluginScheduler) Every(interval time.Duration, fn func(context.Context) error) {
+	p.s.every(p.id, interval, fn)
+}
@@ -0,0 +1,104 @@
+package plugins
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestJobSchedulerRunsJobs(t *testing.T) {
+	s := NewJobScheduler(zap.NewNop())
+	sched := s.ForPlugin("sched-test")
+
+	var runs atomic.Int32
+	ran := make(chan struct{}, 10)
+	sched.Every(5*time.Millisecond, func(context.Context) error {
+		runs.Add(1)
+		ran <- struct{}{}
+		return nil
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	if n := runs.Load(); n != 0 {
+		t.Fatalf("job ran %d times before Start", n)
+	}
+
+	s.Start(context.Background())
+	for range 2 {
+		select {
+		case <-ran:
+		case <-time.After(time.Second):
+			t.Fatal("job did not run after Start")
+		}
+	}
+	s.Stop()
+
+	n := runs.Load()
+	time.Sleep(20 * time.Millisecond)
+	if runs.Load() != n {
+		t.Error("job ran after Stop")
+	}
+	if v, ok := jobMetrics.Get("sched-test/1.runs").(*expvar.Int); !ok || v.Value() < 2 {
+		t.Errorf("runs metric = %v", jobMetrics.Get("sched-test/1.runs"))
+	}
+}
+
+func TestJobSchedulerSurvivesFailures(t *testing.T) {
+	s := NewJobScheduler(zap.NewNop())
+	s.Start(context.Background())
+	defer s.Stop()
+
+	sched := s.ForPlugin("sched-fail")
+	sched.Every(5*time.Millisecond, func(context.Context) error { return errors.New("boom") })
+	var panics atomic.Int32
+	sched.Every(5*time.Millisecond, func(context.Context) error {
+		panics.Add(1)
+		panic("boom")
+	})
+
+	deadline := time.After(time.Second)
+	for panics.Load() < 2 {
+		select {
+		case <-deadline:
+			t.Fatal("panicking job was not run again")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	for _, name := range []string{"sched-fail/1.errors", "sched-fail/2.errors"} {
+		if v, ok := jobMetrics.Get(name).(*expvar.Int); !ok || v.Value() < 1 {
+			t.Errorf("%s = %v", name, jobMetrics.Get(name))
+		}
+	}
+}
+
+func TestJobSchedulerStopCancelsContext(t *testing.T) {
+	s := NewJobScheduler(zap.NewNop())
+	s.Start(context.Background())
+
+	started := make(chan struct{})
+	var once atomic.Bool
+	s.ForPlugin("sched-cancel").Every(time.Millisecond, func(ctx context.Context) error {
+		if once.CompareAndSwap(false, true) {
+			close(started)
+		}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	<-started
+	done := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stop did not cancel the running job")
+	}
+}
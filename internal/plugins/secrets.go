@@ -0,0 +1,79 @@
+package plugins
+
+import "reflect"
+
+// RedactedSecret replaces the secrets of configurations read back through
+// the API.
+const RedactedSecret = "REDACTED"
+
+// RedactSecrets replaces every non-empty string field tagged `secret:"true"`
+// in the configuration v points to, including in nested structs, slices and
+// maps, with RedactedSecret.
+func RedactSecrets(v any) {
+	walkSecrets(reflect.ValueOf(v), func(f reflect.Value) bool {
+		if f.String() != "" {
+			f.SetString(RedactedSecret)
+		}
+		return true
+	})
+}
+
+// HasRedactedSecret reports whether a field tagged `secret:"true"` in the
+// configuration v points to holds RedactedSecret, as one read back through
+// the API and sent again unchanged would.
+func HasRedactedSecret(v any) bool {
+	found := false
+	walkSecrets(reflect.ValueOf(v), func(f reflect.Value) bool {
+		found = f.String() == RedactedSecret
+		return !found
+	})
+	return found
+}
+
+// walkSecrets calls fn with each settable secret string field reachable from
+// v until fn returns false, and reports whether it ran to the end.
+func walkSecrets(v reflect.Value, fn func(reflect.Value) bool) bool {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return true
+		}
+		return walkSecrets(v.Elem(), fn)
+	case reflect.Struct:
+		t := v.Type()
+		for i := range t.NumField() {
+			f := v.Field(i)
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			if t.Field(i).Tag.Get("secret") == "true" && f.Kind() == reflect.String && f.CanSet() {
+				if !fn(f) {
+					return false
+				}
+				continue
+			}
+			if !walkSecrets(f, fn) {
+				return false
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := range v.Len() {
+			if !walkSecrets(v.Index(i), fn) {
+				return false
+			}
+		}
+	case reflect.Map:
+		// Map values cannot be set in place, so each is copied, walked and
+		// stored back.
+		for _, k := range v.MapKeys() {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			ok := walkSecrets(e, fn)
+			v.SetMapIndex(k, e)
+			if !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
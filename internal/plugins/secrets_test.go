@@ -0,0 +1,40 @@
+package plugins
+
+import "testing"
+
+func TestRedactSecrets(t *testing.T) {
+	type account struct {
+		User     string `json:"user"`
+		Password string `json:"password" secret:"true"`
+	}
+	type config struct {
+		Token    string             `json:"token" secret:"true"`
+		Empty    string             `json:"empty" secret:"true"`
+		Primary  *account           `json:"primary"`
+		Accounts map[string]account `json:"accounts"`
+		Public   string             `json:"public"`
+	}
+	cfg := &config{
+		Token:    "t",
+		Primary:  &account{User: "u", Password: "p"},
+		Accounts: map[string]account{"backup": {User: "b", Password: "q"}},
+		Public:   "visible",
+	}
+
+	if HasRedactedSecret(cfg) {
+		t.Fatal("HasRedactedSecret before redaction")
+	}
+	RedactSecrets(cfg)
+	if cfg.Token != RedactedSecret || cfg.Primary.Password != RedactedSecret || cfg.Accounts["backup"].Password != RedactedSecret {
+		t.Errorf("secrets not redacted: %+v %+v %+v", cfg, cfg.Primary, cfg.Accounts)
+	}
+	if cfg.Empty != "" {
+		t.Errorf("empty secret = %q, want it left empty", cfg.Empty)
+	}
+	if cfg.Public != "visible" || cfg.Primary.User != "u" || cfg.Accounts["backup"].User != "b" {
+		t.Errorf("non-secret fields changed: %+v %+v %+v", cfg, cfg.Primary, cfg.Accounts)
+	}
+	if !HasRedactedSecret(cfg) {
+		t.Error("HasRedactedSecret after redaction = false")
+	}
+}
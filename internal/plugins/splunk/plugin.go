@@ -0,0 +1,230 @@
+// Package splunk implements a feature plugin that forwards stored
+// interactions to a Splunk HTTP Event Collector (HEC), in batches.
+package splunk
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/bulk"
+	"github.com/rsclarke/oastrix/internal/siem"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the plugin_config key.
+const ID = "splunk"
+
+// eventPath is the HEC endpoint for JSON events, used when URL has no path.
+const eventPath = "/services/collector/event"
+
+// GlobalConfig sets the collector interactions are forwarded to. Nothing is
+// forwarded until URL and Token are set.
+type GlobalConfig struct {
+	URL         string `json:"url"`                    // e.g. https://splunk.example.com:8088; eventPath is used when it has no path
+	Token       string `json:"token" secret:"true"`    // HEC token
+	Index       string `json:"index,omitempty"`        // the HEC token's default index when empty
+	Source      string `json:"source,omitempty"`       // "oastrix" when empty
+	SourceType  string `json:"sourcetype,omitempty"`   // "oastrix:interaction" when empty
+	Host        string `json:"host,omitempty"`         // the collector's default when empty
+	BatchSize   int    `json:"batch_size,omitempty"`   // bulk.DefaultBatchSize when zero
+	MaxAttempts int    `json:"max_attempts,omitempty"` // bulk.DefaultMaxAttempts when zero
+}
+
+// Validate checks the URL, token and batching limits.
+func (c GlobalConfig) Validate() error {
+	if c.URL != "" {
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid url %q: want an http or https URL", c.URL)
+		}
+		if c.Token == "" {
+			return errors.New("token required")
+		}
+	}
+	if c.BatchSize < 0 || c.BatchSize > bulk.MaxQueued {
+		return fmt.Errorf("invalid batch_size %d: want at most %d", c.BatchSize, bulk.MaxQueued)
+	}
+	if c.MaxAttempts < 0 {
+		return fmt.Errorf("invalid max_attempts %d", c.MaxAttempts)
+	}
+	return nil
+}
+
+func (c GlobalConfig) endpoint() string {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return c.URL
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = eventPath
+	}
+	return u.String()
+}
+
+func (c GlobalConfig) batchSize() int {
+	return cmp.Or(c.BatchSize, bulk.DefaultBatchSize)
+}
+
+func (c GlobalConfig) maxAttempts() int {
+	return cmp.Or(c.MaxAttempts, bulk.DefaultMaxAttempts)
+}
+
+// event is a HEC event.
+type event struct {
+	Time       int64                  `json:"time"`
+	Host       string                 `json:"host,omitempty"`
+	Source     string                 `json:"source"`
+	SourceType string                 `json:"sourcetype"`
+	Index      string                 `json:"index,omitempty"`
+	Event      apitypes.InteractionV2 `json:"event"`
+}
+
+// Plugin forwards each stored interaction to the collector in its
+// GlobalConfig as a v2 interaction. Interactions are queued and posted in
+// batches once BatchSize are queued or every bulk.FlushInterval; a batch the
+// collector fails is retried with backoff, up to MaxAttempts times. The queue
+// is held in memory, so interactions not yet sent when the server stops are
+// lost.
+type Plugin struct {
+	// Client posts batches.
+	Client *http.Client
+
+	config plugins.GlobalConfigView
+	logger *zap.Logger
+	now    func() time.Time
+
+	queue bulk.Queue
+}
+
+// New creates a new splunk Plugin.
+func New() *Plugin {
+	return &Plugin{
+		Client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Init initializes the plugin with the given context and schedules flushing
+// the queue.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Config == nil {
+		return errors.New("global config view required")
+	}
+	p.config = ctx.Config
+	if ctx.Scheduler != nil {
+		ctx.Scheduler.Every(bulk.FlushInterval, p.flush)
+	}
+	return nil
+}
+
+// NewGlobalConfig returns a new GlobalConfig for the server-wide
+// configuration to be decoded into.
+func (p *Plugin) NewGlobalConfig() any { return new(GlobalConfig) }
+
+// OnPostStore queues the stored interaction, posting the queue if a batch is
+// ready.
+func (p *Plugin) OnPostStore(ctx context.Context, e *events.Event) error {
+	if e.InteractionID == 0 {
+		return nil
+	}
+	var cfg GlobalConfig
+	if err := p.config.Get(ID, &cfg); err != nil {
+		return fmt.Errorf("load splunk global config: %w", err)
+	}
+	if cfg.URL == "" || cfg.Token == "" {
+		return nil
+	}
+	b, err := json.Marshal(event{
+		Time:       e.Draft.OccurredAt,
+		Host:       cfg.Host,
+		Source:     cmp.Or(cfg.Source, "oastrix"),
+		SourceType: cmp.Or(cfg.SourceType, "oastrix:interaction"),
+		Index:      cfg.Index,
+		Event:      siem.Interaction(e),
+	})
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	if p.queue.Add(b) >= cfg.batchSize() {
+		return p.flush(ctx)
+	}
+	return nil
+}
+
+// flush posts the queued interactions.
+func (p *Plugin) flush(ctx context.Context) error {
+	var cfg GlobalConfig
+	if err := p.config.Get(ID, &cfg); err != nil {
+		return fmt.Errorf("load splunk global config: %w", err)
+	}
+	if cfg.URL == "" || cfg.Token == "" {
+		return nil
+	}
+	return p.queue.Flush(ctx, p.now(), cfg.batchSize(), cfg.maxAttempts(), func(ctx context.Context, batch [][]byte) error {
+		return p.post(ctx, cfg, batch)
+	})
+}
+
+// post sends a batch of events to the collector.
+func (p *Plugin) post(ctx context.Context, cfg GlobalConfig, batch [][]byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.endpoint(), bytes.NewReader(bytes.Join(batch, []byte("\n"))))
+	if err != nil {
+		return &bulk.PermanentError{Err: err}
+	}
+	req.Header.Set("Authorization", "Splunk "+cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "oastrix-splunk")
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("post to collector: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// The collector explains failures as {"text": ..., "code": ...}.
+	var reply struct {
+		Text string `json:"text"`
+	}
+	_ = json.Unmarshal(body, &reply)
+	err = fmt.Errorf("collector refused batch: %s: %s", resp.Status, reply.Text)
+	if code := resp.StatusCode; code == http.StatusBadRequest || code == http.StatusUnauthorized || code == http.StatusForbidden {
+		return &bulk.PermanentError{Err: err}
+	}
+	return err
+}
+
+// Flush posts whatever is queued, within ctx's deadline.
+func (p *Plugin) Flush(ctx context.Context) error {
+	if p.config == nil || p.queue.Len() == 0 {
+		return nil
+	}
+	return p.flush(ctx)
+}
+
+// Close posts whatever is still queued, giving the collector a few seconds
+// to take it.
+func (p *Plugin) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return p.Flush(ctx)
+}
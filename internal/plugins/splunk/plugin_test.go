@@ -0,0 +1,159 @@
+package splunk
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/plugintest"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// collector records the events posted to it, replying with status.
+type collector struct {
+	mu     sync.Mutex
+	status int
+	posts  int
+	events []event
+	auth   string
+	path   string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.posts++
+	c.auth, c.path = r.Header.Get("Authorization"), r.URL.Path
+	if c.status != http.StatusOK {
+		w.WriteHeader(c.status)
+		_, _ = w.Write([]byte(`{"text":"Server is busy","code":9}`))
+		return
+	}
+	sc := bufio.NewScanner(r.Body)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var ev event
+		if err := json.Unmarshal(sc.Bytes(), &ev); err == nil {
+			c.events = append(c.events, ev)
+		}
+	}
+	_, _ = w.Write([]byte(`{"text":"Success","code":0}`))
+}
+
+func setup(t *testing.T, cfg GlobalConfig) (*Plugin, *collector) {
+	t.Helper()
+	c := &collector{status: http.StatusOK}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+	cfg.URL = srv.URL
+	p := New()
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Config: plugintest.GlobalConfig{Value: &cfg}}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p, c
+}
+
+func stored(id int64) *events.Event {
+	return &events.Event{InteractionID: id, Draft: &events.InteractionDraft{
+		TokenValue: "tok123",
+		Kind:       events.KindDNS,
+		OccurredAt: 1700000000,
+		RemoteIP:   "192.0.2.1",
+		DNS:        &events.DNSDraft{QName: "tok123.example.com", QType: 1, Protocol: "udp"},
+		Attributes: map[string]any{"geo.country": "GB"},
+	}}
+}
+
+func TestBatches(t *testing.T) {
+	p, c := setup(t, GlobalConfig{Token: "hec-token", Index: "oast", BatchSize: 2})
+	ctx := context.Background()
+	for id := range int64(3) {
+		if err := p.OnPostStore(ctx, stored(id+1)); err != nil {
+			t.Fatalf("OnPostStore failed: %v", err)
+		}
+	}
+	if c.posts != 1 || len(c.events) != 2 {
+		t.Fatalf("%d posts of %d events, want one batch of 2", c.posts, len(c.events))
+	}
+	if c.auth != "Splunk hec-token" || c.path != eventPath {
+		t.Errorf("posted to %s with %q", c.path, c.auth)
+	}
+	ev := c.events[0]
+	if ev.Time != 1700000000 || ev.Index != "oast" || ev.Source != "oastrix" || ev.SourceType != "oastrix:interaction" ||
+		ev.Event.ID != 1 || ev.Event.DNS == nil || ev.Event.Attributes["geo.country"] != "GB" {
+		t.Errorf("event = %+v", ev)
+	}
+
+	// The rest goes on the next scheduled flush.
+	if err := p.flush(ctx); err != nil {
+		t.Fatalf("flush failed: %v", err)
+	}
+	if c.posts != 2 || len(c.events) != 3 || c.events[2].Event.ID != 3 {
+		t.Errorf("%d posts of %d events, want the third sent", c.posts, len(c.events))
+	}
+}
+
+func TestRetry(t *testing.T) {
+	p, c := setup(t, GlobalConfig{Token: "hec-token"})
+	now := time.Unix(1700000000, 0)
+	p.now = func() time.Time { return now }
+	c.status = http.StatusServiceUnavailable
+
+	ctx := context.Background()
+	if err := p.OnPostStore(ctx, stored(1)); err != nil {
+		t.Fatalf("OnPostStore failed: %v", err)
+	}
+	if err := p.flush(ctx); err == nil {
+		t.Fatal("flush succeeded while the collector is busy")
+	}
+	c.status = http.StatusOK
+	if err := p.flush(ctx); err != nil || c.posts != 1 {
+		t.Fatalf("flush before the backoff: %v after %d posts, want it held back", err, c.posts)
+	}
+	now = now.Add(time.Minute)
+	if err := p.flush(ctx); err != nil || len(c.events) != 1 {
+		t.Errorf("flush after the backoff: %v with %d events, want the retry sent", err, len(c.events))
+	}
+}
+
+func TestRejected(t *testing.T) {
+	p, c := setup(t, GlobalConfig{Token: "wrong"})
+	c.status = http.StatusForbidden
+	ctx := context.Background()
+	if err := p.OnPostStore(ctx, stored(1)); err != nil {
+		t.Fatalf("OnPostStore failed: %v", err)
+	}
+	if err := p.flush(ctx); err == nil {
+		t.Fatal("flush succeeded with a rejected token")
+	}
+	if p.queue.Len() != 0 {
+		t.Errorf("%d queued, want the rejected batch dropped", p.queue.Len())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := GlobalConfig{URL: "https://splunk.example.com:8088", Token: "t"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	if got := valid.endpoint(); got != "https://splunk.example.com:8088"+eventPath {
+		t.Errorf("endpoint = %s", got)
+	}
+	for name, c := range map[string]GlobalConfig{
+		"url":        {URL: "splunk:8088", Token: "t"},
+		"token":      {URL: "https://splunk.example.com:8088"},
+		"batch size": {BatchSize: -1},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted %+v", name, c)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Package ssrf implements a feature plugin that flags HTTP callbacks bearing
+// the marks of a server-side fetcher rather than a browser, to triage likely
+// server-side request forgery among browser noise.
+package ssrf
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier.
+const ID = "ssrf"
+
+// Attribute holds the Verdict of interactions scored at least Threshold.
+const Attribute = "likely_ssrf"
+
+// VerdictKey is the event data key other hooks read the Verdict from with
+// events.Get[Verdict], set for every scored interaction.
+const VerdictKey = ID + ".verdict"
+
+// Threshold is the confidence from which an interaction is flagged.
+const Threshold = 0.5
+
+// Verdict is how confident the plugin is that a request came from a
+// server-side fetcher, from 0 to 1, and the signals it saw.
+type Verdict struct {
+	Confidence float64  `json:"confidence"`
+	Signals    []string `json:"signals"`
+}
+
+// signal is a trait of a request and how much it adds to the confidence; a
+// negative weight marks a browser.
+type signal struct {
+	name   string
+	weight float64
+	match  func(h *events.HTTPDraft) bool
+}
+
+// fetcherAgents are User-Agent prefixes of HTTP libraries, command-line
+// tools and cloud SDKs, lowercased.
+var fetcherAgents = []string{
+	"python-requests", "python-urllib", "python-httpx", "aiohttp", "go-http-client",
+	"curl/", "wget/", "java/", "okhttp", "apache-httpclient", "jakarta", "libwww-perl",
+	"php", "guzzlehttp", "ruby", "faraday", "axios", "node-fetch", "undici",
+	"aws-sdk", "boto3", "botocore", "google-api", "gcloud", "azsdk", "azure-sdk",
+	"restsharp", "microsoft-cryptoapi", "winhttp",
+}
+
+var signals = []signal{
+	{"fetcher_user_agent", 0.5, func(h *events.HTTPDraft) bool {
+		ua := strings.ToLower(header(h, "User-Agent"))
+		for _, prefix := range fetcherAgents {
+			if strings.HasPrefix(ua, prefix) {
+				return true
+			}
+		}
+		return false
+	}},
+	{"metadata_header", 0.6, func(h *events.HTTPDraft) bool {
+		return header(h, "Metadata-Flavor") != "" || header(h, "X-Aws-Ec2-Metadata-Token") != "" ||
+			header(h, "X-Aws-Ec2-Metadata-Token-Ttl-Seconds") != "" || strings.EqualFold(header(h, "Metadata"), "true")
+	}},
+	{"no_user_agent", 0.3, func(h *events.HTTPDraft) bool { return header(h, "User-Agent") == "" }},
+	{"no_accept", 0.2, func(h *events.HTTPDraft) bool { return header(h, "Accept") == "" }},
+	{"no_accept_language", 0.2, func(h *events.HTTPDraft) bool { return header(h, "Accept-Language") == "" }},
+	{"http_1_0", 0.2, func(h *events.HTTPDraft) bool { return h.Proto == "HTTP/1.0" }},
+	{"browser_user_agent", -0.3, func(h *events.HTTPDraft) bool {
+		return strings.HasPrefix(header(h, "User-Agent"), "Mozilla/")
+	}},
+	{"fetch_metadata", -0.4, func(h *events.HTTPDraft) bool { return header(h, "Sec-Fetch-Mode") != "" }},
+}
+
+func header(h *events.HTTPDraft, name string) string {
+	if v := h.Headers[http.CanonicalHeaderKey(name)]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Score rates an HTTP request against the signals.
+func Score(h *events.HTTPDraft) Verdict {
+	v := Verdict{Signals: []string{}}
+	for _, s := range signals {
+		if s.match(h) {
+			v.Confidence += s.weight
+			v.Signals = append(v.Signals, s.name)
+		}
+	}
+	v.Confidence = math.Round(math.Max(0, math.Min(1, v.Confidence))*100) / 100
+	return v
+}
+
+// Plugin scores stored HTTP interactions and records the Verdict of those
+// scoring at least Threshold in the Attribute attribute. Header order, which
+// also tells fetchers apart, is not recorded and so not scored.
+type Plugin struct{}
+
+// New creates a new ssrf Plugin.
+func New() *Plugin {
+	return &Plugin{}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Priority scores interactions alongside the other enrichment plugins.
+func (p *Plugin) Priority() int { return 20 }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(plugins.InitContext) error { return nil }
+
+// OnPreStore flags requests likely made by a server-side fetcher.
+func (p *Plugin) OnPreStore(_ context.Context, e *events.Event) error {
+	if e.Draft.Drop || e.Draft.TokenID == 0 || e.Draft.HTTP == nil {
+		return nil
+	}
+	v := Score(e.Draft.HTTP)
+	e.Set(VerdictKey, v)
+	if v.Confidence < Threshold {
+		return nil
+	}
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes[Attribute] = v
+	return nil
+}
@@ -0,0 +1,91 @@
+package ssrf
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name       string
+		proto      string
+		headers    map[string][]string
+		confidence float64
+		signals    []string
+	}{
+		{
+			name:  "browser",
+			proto: "HTTP/1.1",
+			headers: map[string][]string{
+				"User-Agent":      {"Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"},
+				"Accept":          {"text/html"},
+				"Accept-Language": {"en-GB"},
+				"Sec-Fetch-Mode":  {"navigate"},
+			},
+			confidence: 0,
+			signals:    []string{"browser_user_agent", "fetch_metadata"},
+		},
+		{
+			name:       "python requests",
+			proto:      "HTTP/1.1",
+			headers:    map[string][]string{"User-Agent": {"python-requests/2.32.3"}, "Accept": {"*/*"}},
+			confidence: 0.7,
+			signals:    []string{"fetcher_user_agent", "no_accept_language"},
+		},
+		{
+			name:       "bare HTTP/1.0",
+			proto:      "HTTP/1.0",
+			headers:    map[string][]string{},
+			confidence: 0.9,
+			signals:    []string{"no_user_agent", "no_accept", "no_accept_language", "http_1_0"},
+		},
+		{
+			name:       "metadata client",
+			proto:      "HTTP/1.1",
+			headers:    map[string][]string{"Metadata-Flavor": {"Google"}, "User-Agent": {"Go-http-client/1.1"}, "Accept": {"*/*"}, "Accept-Language": {"en"}},
+			confidence: 1,
+			signals:    []string{"fetcher_user_agent", "metadata_header"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := Score(&events.HTTPDraft{Proto: tt.proto, Headers: tt.headers})
+			if v.Confidence != tt.confidence || !slices.Equal(v.Signals, tt.signals) {
+				t.Errorf("Score = %+v, want %v %v", v, tt.confidence, tt.signals)
+			}
+		})
+	}
+}
+
+func TestOnPreStore(t *testing.T) {
+	p := New()
+	draft := func(ua string) *events.InteractionDraft {
+		return &events.InteractionDraft{TokenID: 1, HTTP: &events.HTTPDraft{
+			Proto:   "HTTP/1.1",
+			Headers: map[string][]string{"User-Agent": {ua}, "Accept": {"*/*"}},
+		}}
+	}
+
+	e := &events.Event{Draft: draft("curl/8.5.0")}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	v, ok := e.Draft.Attributes[Attribute].(Verdict)
+	if !ok || v.Confidence < Threshold {
+		t.Errorf("attribute = %+v, want a verdict of at least %v", e.Draft.Attributes[Attribute], Threshold)
+	}
+
+	e = &events.Event{Draft: draft("Mozilla/5.0")}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if _, ok := e.Draft.Attributes[Attribute]; ok {
+		t.Error("browser request flagged")
+	}
+	if _, ok := events.Get[Verdict](e, VerdictKey); !ok {
+		t.Error("verdict not set on the event")
+	}
+}
@@ -0,0 +1,137 @@
+package syslog
+
+import (
+	"cmp"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/miekg/dns"
+
+	"github.com/rsclarke/oastrix/internal/siem"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// enterpriseID qualifies the structured data IDs. 32473 is the private
+// enterprise number reserved for documentation (RFC 5612).
+const enterpriseID = "32473"
+
+// severityInfo is the severity every message is sent with.
+const severityInfo = 6
+
+// maxDetail bounds the structured data values copied from a request, such as
+// its path or User-Agent.
+const maxDetail = 1024
+
+// format renders the stored interaction e as an RFC 5424 message whose MSGID
+// is its kind. With FormatCEF or FormatLEEF the MSG is the interaction as a
+// CEF or LEEF event; otherwise its summary is the MSG, and its token, remote
+// address and protocol details are structured data.
+func format(cfg GlobalConfig, e *events.Event) []byte {
+	d := e.Draft
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s - %s ",
+		facilities[cfg.facility()]*8+severityInfo,
+		time.Unix(d.OccurredAt, 0).UTC().Format(time.RFC3339),
+		headerField(cfg.Hostname, 255),
+		headerField(cmp.Or(cfg.AppName, "oastrix"), 48),
+		headerField(string(d.Kind), 32),
+	)
+
+	if cfg.Format == FormatCEF || cfg.Format == FormatLEEF {
+		b.WriteString("- ")
+		b.WriteString(siem.Format(cfg.Format, siem.Interaction(e)))
+		return []byte(b.String())
+	}
+
+	element(&b, "interaction",
+		"id", strconv.FormatInt(e.InteractionID, 10),
+		"token", d.TokenValue,
+		"kind", string(d.Kind),
+		"remote_ip", d.RemoteIP,
+		"remote_port", strconv.Itoa(d.RemotePort),
+		"tls", strconv.FormatBool(d.TLS),
+	)
+	if h := d.HTTP; h != nil {
+		params := []string{"method", h.Method, "host", h.Host, "path", h.Path}
+		if h.Query != "" {
+			params = append(params, "query", h.Query)
+		}
+		for k, v := range h.Headers {
+			if strings.EqualFold(k, "User-Agent") && len(v) > 0 {
+				params = append(params, "user_agent", v[0])
+			}
+		}
+		element(&b, "http", params...)
+	}
+	if q := d.DNS; q != nil {
+		element(&b, "dns",
+			"qname", q.QName,
+			"qtype", dns.TypeToString[uint16(q.QType)],
+			"protocol", q.Protocol,
+		)
+	}
+
+	if d.Summary != "" {
+		b.WriteString(" ")
+		b.WriteString(strings.Map(func(r rune) rune {
+			if r == '\r' || r == '\n' {
+				return ' '
+			}
+			return r
+		}, d.Summary))
+	}
+	return []byte(b.String())
+}
+
+// element writes an SD-ELEMENT named id@enterpriseID with the given name and
+// value pairs.
+func element(b *strings.Builder, id string, params ...string) {
+	fmt.Fprintf(b, "[%s@%s", id, enterpriseID)
+	for i := 0; i+1 < len(params); i += 2 {
+		fmt.Fprintf(b, ` %s="%s"`, params[i], paramEscaper.Replace(truncate(params[i+1], maxDetail)))
+	}
+	b.WriteString("]")
+}
+
+// paramEscaper escapes the characters PARAM-VALUE reserves.
+var paramEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// headerField returns s as a header field of at most limit printable ASCII
+// characters, or the nil value "-" if it is empty.
+func headerField(s string, limit int) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return "-"
+	}
+	return s[:min(len(s), limit)]
+}
+
+// printable reports whether s holds only printable ASCII characters, as
+// header fields must.
+func printable(s string) bool {
+	for _, r := range s {
+		if r < 33 || r > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// truncate shortens s to at most limit bytes without splitting a character.
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit]
+}
@@ -0,0 +1,257 @@
+// Package syslog implements a feature plugin that forwards every stored
+// interaction to a syslog collector as an RFC 5424 message, over UDP, TCP or
+// TLS. The message carries the interaction as structured data, or as a CEF or
+// LEEF event for SIEMs that parse those.
+package syslog
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/siem"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the plugin_config key.
+const ID = "syslog"
+
+// Transports to the collector.
+const (
+	TransportUDP = "udp"
+	TransportTCP = "tcp"
+	TransportTLS = "tls"
+)
+
+// Formats of the interaction within the message. FormatCEF and FormatLEEF
+// carry it as the message body rather than as structured data.
+const (
+	FormatRFC5424 = "rfc5424"
+	FormatCEF     = siem.FormatCEF
+	FormatLEEF    = siem.FormatLEEF
+)
+
+// dialTimeout bounds connecting to the collector when the hook's context
+// has no deadline.
+const dialTimeout = 10 * time.Second
+
+// facilities are the syslog facilities messages can be sent as, by name.
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// GlobalConfig sets the collector interactions are forwarded to. Nothing is
+// forwarded until Address is set.
+type GlobalConfig struct {
+	Address   string `json:"address"`             // host:port; port 514, or 6514 over TLS, when omitted
+	Transport string `json:"transport,omitempty"` // TransportUDP when empty
+	Facility  string `json:"facility,omitempty"`  // "local0" when empty
+	Hostname  string `json:"hostname,omitempty"`  // the host's name when empty
+	AppName   string `json:"app_name,omitempty"`  // "oastrix" when empty
+	Format    string `json:"format,omitempty"`    // FormatRFC5424 when empty
+}
+
+// Validate checks the transport, format, facility and the header fields'
+// lengths.
+func (c GlobalConfig) Validate() error {
+	switch c.Transport {
+	case "", TransportUDP, TransportTCP, TransportTLS:
+	default:
+		return fmt.Errorf("invalid transport %q: want %s, %s or %s", c.Transport, TransportUDP, TransportTCP, TransportTLS)
+	}
+	switch c.Format {
+	case "", FormatRFC5424, FormatCEF, FormatLEEF:
+	default:
+		return fmt.Errorf("invalid format %q: want %s, %s or %s", c.Format, FormatRFC5424, FormatCEF, FormatLEEF)
+	}
+	if _, ok := facilities[c.facility()]; !ok {
+		return fmt.Errorf("unknown facility %q", c.Facility)
+	}
+	if c.Address != "" {
+		if _, _, err := net.SplitHostPort(c.addr()); err != nil {
+			return fmt.Errorf("invalid address %q: %w", c.Address, err)
+		}
+	}
+	if len(c.Hostname) > 255 || !printable(c.Hostname) {
+		return fmt.Errorf("invalid hostname %q: want at most 255 printable ASCII characters", c.Hostname)
+	}
+	if len(c.AppName) > 48 || !printable(c.AppName) {
+		return fmt.Errorf("invalid app_name %q: want at most 48 printable ASCII characters", c.AppName)
+	}
+	return nil
+}
+
+func (c GlobalConfig) transport() string {
+	if c.Transport == "" {
+		return TransportUDP
+	}
+	return c.Transport
+}
+
+func (c GlobalConfig) facility() string {
+	if c.Facility == "" {
+		return "local0"
+	}
+	return c.Facility
+}
+
+// addr returns the collector's address, with the transport's default port
+// if it has none.
+func (c GlobalConfig) addr() string {
+	if _, _, err := net.SplitHostPort(c.Address); err == nil {
+		return c.Address
+	}
+	port := 514
+	if c.transport() == TransportTLS {
+		port = 6514
+	}
+	return net.JoinHostPort(c.Address, strconv.Itoa(port))
+}
+
+// Plugin forwards each stored interaction to the collector in its
+// GlobalConfig. Over TCP and TLS it keeps one connection open, redialing
+// after a failure; messages that cannot be sent are dropped. Messages are
+// sent as the interaction is stored, so run the pipeline with workers to keep
+// them off the response path.
+type Plugin struct {
+	// TLSConfig, if set, is the base configuration for TLS connections; the
+	// collector's host is set as the ServerName when it has none.
+	TLSConfig *tls.Config
+
+	config   plugins.GlobalConfigView
+	logger   *zap.Logger
+	hostname string
+
+	mu   sync.Mutex
+	conn net.Conn
+	dest string // transport and address conn is connected to
+}
+
+// New creates a new syslog Plugin.
+func New() *Plugin {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+	return &Plugin{hostname: hostname}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Config == nil {
+		return errors.New("global config view required")
+	}
+	p.config = ctx.Config
+	return nil
+}
+
+// NewGlobalConfig returns a new GlobalConfig for the server-wide
+// configuration to be decoded into.
+func (p *Plugin) NewGlobalConfig() any { return new(GlobalConfig) }
+
+// OnPostStore forwards the stored interaction.
+func (p *Plugin) OnPostStore(ctx context.Context, e *events.Event) error {
+	if e.InteractionID == 0 {
+		return nil
+	}
+	var cfg GlobalConfig
+	if err := p.config.Get(ID, &cfg); err != nil {
+		return fmt.Errorf("load syslog global config: %w", err)
+	}
+	if cfg.Address == "" {
+		return nil
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname = p.hostname
+	}
+	msg := format(cfg, e)
+	if err := p.send(ctx, cfg, msg); err != nil {
+		return fmt.Errorf("forward to syslog collector: %w", err)
+	}
+	return nil
+}
+
+// send writes msg to the collector, dialing it first if the connection is
+// not open or the configuration has changed. Over a stream, messages are
+// framed by octet counting (RFC 6587).
+func (p *Plugin) send(ctx context.Context, cfg GlobalConfig, msg []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	dest := cfg.transport() + "://" + cfg.addr()
+	if p.conn != nil && p.dest != dest {
+		p.closeLocked()
+	}
+	if p.conn == nil {
+		conn, err := p.dial(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		p.conn, p.dest = conn, dest
+	}
+
+	if cfg.transport() != TransportUDP {
+		msg = append([]byte(strconv.Itoa(len(msg))+" "), msg...)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(dialTimeout)
+	}
+	_ = p.conn.SetWriteDeadline(deadline)
+	if _, err := p.conn.Write(msg); err != nil {
+		p.closeLocked()
+		return err
+	}
+	return nil
+}
+
+func (p *Plugin) dial(ctx context.Context, cfg GlobalConfig) (net.Conn, error) {
+	d := net.Dialer{Timeout: dialTimeout}
+	switch cfg.transport() {
+	case TransportTLS:
+		tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+		if p.TLSConfig != nil {
+			tlsConfig = p.TLSConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(cfg.addr())
+		}
+		td := tls.Dialer{NetDialer: &d, Config: tlsConfig}
+		return td.DialContext(ctx, "tcp", cfg.addr())
+	case TransportTCP:
+		return d.DialContext(ctx, "tcp", cfg.addr())
+	default:
+		return d.DialContext(ctx, "udp", cfg.addr())
+	}
+}
+
+func (p *Plugin) closeLocked() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+		p.conn, p.dest = nil, ""
+	}
+}
+
+// Close closes the connection to the collector.
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closeLocked()
+	return nil
+}
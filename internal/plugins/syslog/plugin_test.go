@@ -0,0 +1,214 @@
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/plugintest"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func newPlugin(t *testing.T, cfg *GlobalConfig) *Plugin {
+	t.Helper()
+	p := New()
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Config: plugintest.GlobalConfig{Value: cfg}}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+	return p
+}
+
+func httpEvent() *events.Event {
+	return &events.Event{
+		InteractionID: 42,
+		Draft: &events.InteractionDraft{
+			TokenValue: "tok123",
+			TokenID:    1,
+			Kind:       events.KindHTTP,
+			OccurredAt: 1700000000,
+			RemoteIP:   "192.0.2.1",
+			RemotePort: 40000,
+			Summary:    "GET /x\r\n HTTP/1.1",
+			HTTP: &events.HTTPDraft{
+				Method: "GET", Host: "tok123.example.com", Path: `/x"]\`,
+				Headers: map[string][]string{"User-Agent": {"curl/8.0"}},
+			},
+		},
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cfg := GlobalConfig{Facility: "local4", Hostname: "oast host"}
+	got := string(format(cfg, httpEvent()))
+	want := `<166>1 2023-11-14T22:13:20Z oasthost oastrix - http ` +
+		`[interaction@32473 id="42" token="tok123" kind="http" remote_ip="192.0.2.1" remote_port="40000" tls="false"]` +
+		`[http@32473 method="GET" host="tok123.example.com" path="/x\"\]\\" user_agent="curl/8.0"]` +
+		` GET /x   HTTP/1.1`
+	if got != want {
+		t.Errorf("format =\n%s\nwant\n%s", got, want)
+	}
+
+	dnsEvent := &events.Event{InteractionID: 1, Draft: &events.InteractionDraft{
+		Kind: events.KindDNS, DNS: &events.DNSDraft{QName: "tok123.example.com", QType: 28, Protocol: "udp"},
+	}}
+	if got := string(format(GlobalConfig{}, dnsEvent)); !strings.HasPrefix(got, "<134>1 ") || !strings.Contains(got, ` - oastrix - dns [`) ||
+		!strings.Contains(got, `[dns@32473 qname="tok123.example.com" qtype="AAAA" protocol="udp"]`) {
+		t.Errorf("format = %s", got)
+	}
+
+	cef := string(format(GlobalConfig{Hostname: "oast", Format: FormatCEF}, httpEvent()))
+	if want := `<134>1 2023-11-14T22:13:20Z oast oastrix - http - CEF:0|oastrix|oastrix|1|http|HTTP interaction|3|rt=1700000000000 externalId=42 `; !strings.HasPrefix(cef, want) {
+		t.Errorf("format = %s, want prefix %s", cef, want)
+	}
+	leef := string(format(GlobalConfig{Hostname: "oast", Format: FormatLEEF}, httpEvent()))
+	if want := "<134>1 2023-11-14T22:13:20Z oast oastrix - http - LEEF:1.0|oastrix|oastrix|1|http|devTime="; !strings.HasPrefix(leef, want) {
+		t.Errorf("format = %s, want prefix %s", leef, want)
+	}
+}
+
+func TestUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = pc.Close() }()
+
+	p := newPlugin(t, &GlobalConfig{Address: pc.LocalAddr().String()})
+	if err := p.OnPostStore(context.Background(), httpEvent()); err != nil {
+		t.Fatalf("OnPostStore failed: %v", err)
+	}
+	_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 4096)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !strings.HasPrefix(string(buf[:n]), "<134>1 2023-11-14T22:13:20Z ") {
+		t.Errorf("received %q", buf[:n])
+	}
+}
+
+// readFrames reads count octet-counted messages from conn.
+func readFrames(conn net.Conn, count int) ([]string, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	var msgs []string
+	for range count {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			return msgs, err
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+		if err != nil {
+			return msgs, err
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, string(msg))
+	}
+	return msgs, nil
+}
+
+func TestTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	p := newPlugin(t, &GlobalConfig{Address: l.Addr().String(), Transport: TransportTCP})
+	for range 2 {
+		if err := p.OnPostStore(context.Background(), httpEvent()); err != nil {
+			t.Fatalf("OnPostStore failed: %v", err)
+		}
+	}
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatalf("accept: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+	msgs, err := readFrames(conn, 2)
+	if err != nil {
+		t.Fatalf("read frames: %v", err)
+	}
+	for _, msg := range msgs {
+		if !strings.HasPrefix(msg, "<134>1 ") || !strings.HasSuffix(msg, "HTTP/1.1") {
+			t.Errorf("received %q", msg)
+		}
+	}
+}
+
+func TestTLS(t *testing.T) {
+	// Borrow httptest's certificate for 127.0.0.1.
+	srv := httptest.NewTLSServer(nil)
+	certs := srv.TLS.Certificates
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	srv.Close()
+
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certs})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+	accepted := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		if msgs, err := readFrames(conn, 1); err == nil {
+			accepted <- msgs
+		}
+	}()
+
+	p := newPlugin(t, &GlobalConfig{Address: l.Addr().String(), Transport: TransportTLS})
+	p.TLSConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	if err := p.OnPostStore(context.Background(), httpEvent()); err != nil {
+		t.Fatalf("OnPostStore failed: %v", err)
+	}
+	select {
+	case msgs := <-accepted:
+		if !strings.HasPrefix(msgs[0], "<134>1 ") {
+			t.Errorf("received %q", msgs[0])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received over TLS")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := GlobalConfig{Address: "siem.example.com", Transport: TransportTLS, Facility: "local7", AppName: "oast"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	if got := valid.addr(); got != "siem.example.com:6514" {
+		t.Errorf("addr = %q, want the TLS default port", got)
+	}
+	for name, c := range map[string]GlobalConfig{
+		"transport": {Transport: "sctp"},
+		"facility":  {Facility: "local9"},
+		"address":   {Address: "[::1"},
+		"app name":  {AppName: "two words"},
+		"format":    {Format: "json"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("%s: Validate accepted %+v", name, c)
+		}
+	}
+}
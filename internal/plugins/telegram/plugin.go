@@ -0,0 +1,345 @@
+// Package telegram implements a feature plugin that sends interaction alerts
+// to a Telegram chat through the Bot API.
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	// Silence windows may be in any time zone, including on hosts without
+	// a zone database.
+	_ "time/tzdata"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/notify"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "telegram"
+
+// DefaultAPIURL is the Telegram Bot API's base URL.
+const DefaultAPIURL = "https://api.telegram.org"
+
+// maxDetail bounds the request line or query quoted in an alert, leaving
+// room within Telegram's 4096-character message limit for the rest.
+const maxDetail = 3000
+
+// Window is a daily period, between two "15:04" times in the configured time
+// zone, during which alerts are sent silently. A window whose From is after
+// its To spans midnight.
+type Window struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// minutes returns the window's bounds as minutes after midnight.
+func (w Window) minutes() (from, to int, err error) {
+	f, err := time.Parse("15:04", w.From)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid silence window start %q: want HH:MM", w.From)
+	}
+	t, err := time.Parse("15:04", w.To)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid silence window end %q: want HH:MM", w.To)
+	}
+	return f.Hour()*60 + f.Minute(), t.Hour()*60 + t.Minute(), nil
+}
+
+// contains reports whether the time of day m, in minutes after midnight, is
+// within the window.
+func (w Window) contains(m int) bool {
+	from, to, err := w.minutes()
+	if err != nil {
+		return false
+	}
+	if from <= to {
+		return m >= from && m < to
+	}
+	return m >= from || m < to
+}
+
+// GlobalConfig holds the bot's credentials and the default chat, and sets
+// which tokens are alerted about server-wide.
+type GlobalConfig struct {
+	BotToken  string        `json:"bot_token" secret:"true"`
+	ChatID    string        `json:"chat_id"`         // numeric chat ID or @channel username
+	AllTokens bool          `json:"all_tokens"`      // alert about tokens without a Config
+	Kinds     []string      `json:"kinds,omitempty"` // interaction kinds alerted about; all when empty
+	Silence   []Window      `json:"silence,omitempty"`
+	TimeZone  string        `json:"time_zone,omitempty"` // IANA name the silence windows are in; UTC when empty
+	Filter    notify.Filter `json:"filter"`              // applies to every token
+}
+
+// Validate checks the kinds, filter, silence windows and time zone.
+func (c GlobalConfig) Validate() error {
+	if err := notify.ValidateKinds(c.Kinds); err != nil {
+		return err
+	}
+	if err := c.Filter.Validate(); err != nil {
+		return err
+	}
+	for _, w := range c.Silence {
+		if _, _, err := w.minutes(); err != nil {
+			return err
+		}
+	}
+	if _, err := time.LoadLocation(c.TimeZone); err != nil {
+		return fmt.Errorf("invalid time zone %q", c.TimeZone)
+	}
+	return nil
+}
+
+// silenced reports whether t falls within a silence window.
+func (c GlobalConfig) silenced(t time.Time) bool {
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	m := t.Hour()*60 + t.Minute()
+	for _, w := range c.Silence {
+		if w.contains(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Config enables alerts for a token, overriding the server-wide settings,
+// optionally to a chat of its own.
+type Config struct {
+	Enabled bool     `json:"enabled"`
+	ChatID  string   `json:"chat_id,omitempty"`
+	Kinds   []string `json:"kinds,omitempty"` // interaction kinds alerted about; all when empty
+}
+
+// Validate checks that every kind is known.
+func (c Config) Validate() error { return notify.ValidateKinds(c.Kinds) }
+
+// Plugin sends an alert for each stored interaction of a token whose Config
+// enables it, or of every token when the GlobalConfig's AllTokens is set.
+// The bot token and chat are read from the GlobalConfig, so nothing is sent
+// until they are configured. Alerts are sent as the interaction is stored, so
+// run the pipeline with workers to keep them off the response path. While
+// Telegram rate limits the bot, alerts are dropped.
+type Plugin struct {
+	// APIURL is the Bot API's base URL.
+	APIURL string
+	// Client sends alerts.
+	Client *http.Client
+
+	store  plugins.Store
+	config plugins.GlobalConfigView
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+	now    func() time.Time
+
+	limiter  notify.Limiter
+	throttle notify.Throttle
+}
+
+// New creates a new telegram Plugin.
+func New() *Plugin {
+	return &Plugin{
+		APIURL: DefaultAPIURL,
+		Client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Config == nil {
+		return errors.New("global config view required")
+	}
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.store = ctx.Store
+	p.config = ctx.Config
+	p.tokens = ctx.Tokens
+	return nil
+}
+
+// NewGlobalConfig returns a new GlobalConfig for the server-wide
+// configuration to be decoded into.
+func (p *Plugin) NewGlobalConfig() any { return new(GlobalConfig) }
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// OnPostStore sends an alert about the stored interaction if its token and
+// kind are alerted about and it passes the filter, silently within a silence
+// window.
+func (p *Plugin) OnPostStore(ctx context.Context, e *events.Event) error {
+	if e.InteractionID == 0 {
+		return nil
+	}
+	var global GlobalConfig
+	if err := p.config.Get(ID, &global); err != nil {
+		return fmt.Errorf("load telegram global config: %w", err)
+	}
+	if global.BotToken == "" {
+		return nil
+	}
+
+	enabled, chatID, kinds := global.AllTokens, global.ChatID, global.Kinds
+	var cfg Config
+	ok, err := p.tokens.Get(ctx, e.Draft.TokenID, ID, &cfg)
+	if err != nil {
+		return fmt.Errorf("load telegram: %w", err)
+	}
+	if ok {
+		enabled = cfg.Enabled
+		if cfg.ChatID != "" {
+			chatID = cfg.ChatID
+		}
+		if len(cfg.Kinds) > 0 {
+			kinds = cfg.Kinds
+		}
+	}
+	if !enabled || chatID == "" || !notify.WantsKind(kinds, e.Draft.Kind) {
+		return nil
+	}
+	now := p.now()
+	if ok, err := global.Filter.Pass(ctx, p.store, e, &p.throttle, ID, now, p.logger); err != nil || !ok {
+		return err
+	}
+
+	allowed, dropped := p.limiter.Allow(now)
+	if dropped > 0 {
+		p.logger.Warn("dropped alerts while rate limited", zap.Int("dropped", dropped))
+	}
+	if !allowed {
+		return nil
+	}
+	return p.send(ctx, global.BotToken, sendMessage{
+		ChatID:              chatID,
+		Text:                format(e.Draft),
+		ParseMode:           "MarkdownV2",
+		DisableNotification: global.silenced(now),
+		LinkPreview:         linkPreview{Disabled: true},
+	})
+}
+
+// sendMessage is the body of a Bot API sendMessage call.
+type sendMessage struct {
+	ChatID              string      `json:"chat_id"`
+	Text                string      `json:"text"`
+	ParseMode           string      `json:"parse_mode"`
+	DisableNotification bool        `json:"disable_notification,omitempty"`
+	LinkPreview         linkPreview `json:"link_preview_options"`
+}
+
+type linkPreview struct {
+	Disabled bool `json:"is_disabled"`
+}
+
+// apiResponse is the Bot API's reply to every call.
+type apiResponse struct {
+	OK          bool   `json:"ok"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+func (p *Plugin) send(ctx context.Context, botToken string, msg sendMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.APIURL+"/bot"+botToken+"/sendMessage", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		// The URL, and so the error, contains the bot token.
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return fmt.Errorf("send telegram alert: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var result apiResponse
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&result)
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		wait := time.Duration(max(result.Parameters.RetryAfter, 1)) * time.Second
+		p.limiter.Limit(p.now().Add(wait))
+		return fmt.Errorf("telegram rate limited the bot for %s", wait)
+	case resp.StatusCode != http.StatusOK || !result.OK:
+		return fmt.Errorf("telegram returned %s: %s", resp.Status, result.Description)
+	}
+	return nil
+}
+
+// format renders d as a MarkdownV2 alert.
+func format(d *events.InteractionDraft) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%s interaction* on `%s`\n", escape(strings.ToUpper(string(d.Kind))), escapeCode(d.TokenValue))
+
+	remote := d.RemoteIP
+	if d.RemotePort > 0 {
+		remote = fmt.Sprintf("%s:%d", d.RemoteIP, d.RemotePort)
+	}
+	fmt.Fprintf(&b, "*From:* `%s`", escapeCode(remote))
+	if d.TLS {
+		b.WriteString(" over TLS")
+	}
+	b.WriteString("\n")
+
+	detail := d.Summary
+	switch {
+	case d.HTTP != nil:
+		uri := d.HTTP.Path
+		if d.HTTP.Query != "" {
+			uri += "?" + d.HTTP.Query
+		}
+		detail = d.HTTP.Method + " " + uri + "\nHost: " + d.HTTP.Host
+		for k, v := range d.HTTP.Headers {
+			if strings.EqualFold(k, "User-Agent") && len(v) > 0 {
+				detail += "\nUser-Agent: " + v[0]
+			}
+		}
+	case d.DNS != nil:
+		detail = fmt.Sprintf("%s %s over %s", d.DNS.QName, dns.TypeToString[uint16(d.DNS.QType)], d.DNS.Protocol)
+	}
+	if detail != "" {
+		fmt.Fprintf(&b, "```\n%s\n```", escapeCode(notify.Truncate(detail, maxDetail)))
+	}
+	return b.String()
+}
+
+// markdownEscaper escapes the characters MarkdownV2 reserves outside code.
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// codeEscaper escapes the characters MarkdownV2 reserves within code.
+var codeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+
+func escape(s string) string     { return markdownEscaper.Replace(s) }
+func escapeCode(s string) string { return codeEscaper.Replace(s) }
@@ -0,0 +1,174 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/plugintest"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// botAPI records the messages sent through it, answering with status.
+type botAPI struct {
+	status int
+	paths  []string
+	sent   []sendMessage
+}
+
+func (b *botAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var msg sendMessage
+	_ = json.NewDecoder(r.Body).Decode(&msg)
+	b.paths = append(b.paths, r.URL.Path)
+	b.sent = append(b.sent, msg)
+	w.WriteHeader(b.status)
+	if b.status == http.StatusTooManyRequests {
+		_, _ = w.Write([]byte(`{"ok":false,"description":"Too Many Requests","parameters":{"retry_after":5}}`))
+		return
+	}
+	_, _ = w.Write([]byte(`{"ok":true}`))
+}
+
+func newPlugin(t *testing.T, api *botAPI, global GlobalConfig, tokens map[int64]Config, now time.Time) *Plugin {
+	t.Helper()
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	p := New()
+	p.APIURL = srv.URL
+	p.now = func() time.Time { return now }
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Config: plugintest.GlobalConfig{Value: global}, Tokens: plugintest.TokenConfigs[Config](tokens)}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p
+}
+
+func dnsEvent(tokenID int64) *events.Event {
+	return &events.Event{
+		InteractionID: 1,
+		Draft: &events.InteractionDraft{
+			TokenValue: "tok_123",
+			TokenID:    tokenID,
+			Kind:       events.KindDNS,
+			RemoteIP:   "192.0.2.1",
+			RemotePort: 53,
+			DNS:        &events.DNSDraft{QName: "tok_123.example.com", QType: 1, Protocol: "udp"},
+		},
+	}
+}
+
+// noon is 12:00 UTC, 21:00 in Tokyo.
+var noon = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestAlerts(t *testing.T) {
+	bot := GlobalConfig{BotToken: "123:abc", ChatID: "-100"}
+	tests := []struct {
+		name     string
+		global   GlobalConfig
+		tokens   map[int64]Config
+		wantChat string // empty when no alert is sent
+	}{
+		{"no bot token", GlobalConfig{AllTokens: true, ChatID: "-100"}, nil, ""},
+		{"not enabled", bot, nil, ""},
+		{"enabled for token", bot, map[int64]Config{1: {Enabled: true}}, "-100"},
+		{"token chat", bot, map[int64]Config{1: {Enabled: true, ChatID: "@team"}}, "@team"},
+		{"all tokens", GlobalConfig{BotToken: "123:abc", ChatID: "-100", AllTokens: true}, nil, "-100"},
+		{"kind filtered out", bot, map[int64]Config{1: {Enabled: true, Kinds: []string{"http"}}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &botAPI{status: http.StatusOK}
+			p := newPlugin(t, api, tt.global, tt.tokens, noon)
+			if err := p.OnPostStore(context.Background(), dnsEvent(1)); err != nil {
+				t.Fatalf("OnPostStore failed: %v", err)
+			}
+			if tt.wantChat == "" {
+				if len(api.sent) != 0 {
+					t.Errorf("sent %d alerts, want none", len(api.sent))
+				}
+				return
+			}
+			if len(api.sent) != 1 {
+				t.Fatalf("sent %d alerts, want 1", len(api.sent))
+			}
+			if api.paths[0] != "/bot123:abc/sendMessage" || api.sent[0].ChatID != tt.wantChat {
+				t.Errorf("sent to %s chat %q, want chat %q", api.paths[0], api.sent[0].ChatID, tt.wantChat)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got := format(dnsEvent(1).Draft)
+	want := "*DNS interaction* on `tok_123`\n*From:* `192.0.2.1:53`\n```\ntok_123.example.com A over udp\n```"
+	if got != want {
+		t.Errorf("format =\n%s\nwant\n%s", got, want)
+	}
+	if got := escape("a.b_c!"); got != `a\.b\_c\!` {
+		t.Errorf("escape = %q", got)
+	}
+	if got := escapeCode("a`b\\c"); got != "a\\`b\\\\c" {
+		t.Errorf("escapeCode = %q", got)
+	}
+}
+
+func TestSilence(t *testing.T) {
+	cfg := GlobalConfig{
+		BotToken: "123:abc", ChatID: "-100", AllTokens: true,
+		Silence:  []Window{{From: "22:00", To: "07:00"}},
+		TimeZone: "Asia/Tokyo",
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{noon, false},                     // 21:00 in Tokyo
+		{noon.Add(time.Hour), true},       // 22:00 in Tokyo starts the window
+		{noon.Add(9 * time.Hour), true},   // 06:00 in Tokyo, the next day
+		{noon.Add(10 * time.Hour), false}, // 07:00 in Tokyo ends it
+	}
+	for _, tt := range tests {
+		if got := cfg.silenced(tt.at); got != tt.want {
+			t.Errorf("silenced(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+
+	api := &botAPI{status: http.StatusOK}
+	p := newPlugin(t, api, cfg, nil, noon.Add(time.Hour))
+	if err := p.OnPostStore(context.Background(), dnsEvent(1)); err != nil {
+		t.Fatalf("OnPostStore failed: %v", err)
+	}
+	if len(api.sent) != 1 || !api.sent[0].DisableNotification {
+		t.Errorf("sent %+v, want one silent alert", api.sent)
+	}
+
+	if err := (GlobalConfig{Silence: []Window{{From: "25:00", To: "07:00"}}}).Validate(); err == nil {
+		t.Error("Validate accepted an invalid window")
+	}
+	if err := (GlobalConfig{TimeZone: "Mars/Olympus"}).Validate(); err == nil {
+		t.Error("Validate accepted an unknown time zone")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	api := &botAPI{status: http.StatusTooManyRequests}
+	p := newPlugin(t, api, GlobalConfig{BotToken: "123:abc", ChatID: "-100", AllTokens: true}, nil, noon)
+
+	err := p.OnPostStore(context.Background(), dnsEvent(1))
+	if err == nil || strings.Contains(err.Error(), "123:abc") {
+		t.Fatalf("OnPostStore = %v, want a rate limit error without the bot token", err)
+	}
+	api.status = http.StatusOK
+	if err := p.OnPostStore(context.Background(), dnsEvent(1)); err != nil || len(api.sent) != 1 {
+		t.Errorf("while limited: err = %v, %d sent; want the alert dropped", err, len(api.sent))
+	}
+}
@@ -0,0 +1,384 @@
+// Package threatintel implements a feature plugin that tags interactions
+// whose remote IP appears on local blocklists, such as Tor exit nodes or
+// known internet scanners, or in ranges a token marks as its target's.
+package threatintel
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// ID is the plugin identifier, also used as the token_plugin_config key.
+const ID = "threatintel"
+
+// TagsAttribute holds the sorted tags of the interaction's remote IP.
+const TagsAttribute = "intel_tags"
+
+// TagsKey is the event data key other hooks read the tags from with
+// events.Get[[]string].
+const TagsKey = ID + ".tags"
+
+// TargetTag tags remote IPs within a token's Config.TargetRanges.
+const TargetTag = "target_range"
+
+// DefaultRefresh is how often lists are reloaded by default.
+const DefaultRefresh = time.Hour
+
+// maxListSize bounds how much of a fetched list is read.
+const maxListSize = 32 << 20
+
+// List is a set of addresses read from Source, a file path or http(s) URL,
+// with one address or CIDR prefix per line and # comments. Remote IPs in it
+// are tagged Tag; an Allow list's addresses are never tagged from lists.
+type List struct {
+	Tag    string
+	Source string
+	Allow  bool
+}
+
+// ParseList parses a "tag=source" list flag.
+func ParseList(s string) (List, error) {
+	tag, source, ok := strings.Cut(s, "=")
+	if !ok || source == "" {
+		return List{}, fmt.Errorf("invalid list %q: want tag=source", s)
+	}
+	if !validTag(tag) {
+		return List{}, fmt.Errorf("invalid tag %q: want lowercase letters, digits and _", tag)
+	}
+	return List{Tag: tag, Source: source}, nil
+}
+
+func validTag(tag string) bool {
+	if tag == "" {
+		return false
+	}
+	for _, r := range tag {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func (l List) remote() bool {
+	return strings.HasPrefix(l.Source, "http://") || strings.HasPrefix(l.Source, "https://")
+}
+
+// cacheName is the file a remote list's last fetched copy is kept in.
+func (l List) cacheName() string {
+	sum := sha256.Sum256([]byte(l.Source))
+	return hex.EncodeToString(sum[:8]) + ".txt"
+}
+
+// Config sets the address ranges that count as a token's target. Remote IPs
+// within them are tagged TargetTag.
+type Config struct {
+	TargetRanges []string `json:"target_ranges"`
+}
+
+// Validate checks that every target range is an address or CIDR prefix.
+func (c Config) Validate() error {
+	for _, r := range c.TargetRanges {
+		if _, err := parsePrefix(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addrSet is a set of single addresses and prefixes.
+type addrSet struct {
+	addrs    map[netip.Addr]struct{}
+	prefixes []netip.Prefix
+}
+
+func (s *addrSet) add(p netip.Prefix) {
+	if p.IsSingleIP() {
+		if s.addrs == nil {
+			s.addrs = make(map[netip.Addr]struct{})
+		}
+		s.addrs[p.Addr()] = struct{}{}
+		return
+	}
+	s.prefixes = append(s.prefixes, p)
+}
+
+func (s *addrSet) contains(addr netip.Addr) bool {
+	if s == nil {
+		return false
+	}
+	if _, ok := s.addrs[addr]; ok {
+		return true
+	}
+	for _, p := range s.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// readSet reads a list in the format described by List.
+func readSet(r io.Reader) (*addrSet, error) {
+	s := &addrSet{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		p, err := parsePrefix(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		s.add(p)
+	}
+	return s, scanner.Err()
+}
+
+// parsePrefix parses an address or CIDR prefix.
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Plugin tags interactions with the Tag of every List containing their
+// remote IP, and TargetTag when it is in the token's target ranges, in the
+// TagsAttribute attribute. Lists are reloaded every Refresh; a remote list
+// that cannot be fetched keeps its previous copy, which is cached in
+// CacheDir across restarts.
+type Plugin struct {
+	// CacheDir, if set, is where fetched copies of remote lists are kept.
+	CacheDir string
+	// Refresh is how often lists are reloaded. Zero disables reloading.
+	Refresh time.Duration
+	// Client fetches remote lists.
+	Client *http.Client
+
+	lists  []List
+	sets   atomic.Pointer[[]*addrSet] // last loaded copy of each list
+	tokens plugins.TokenConfigView
+	logger *zap.Logger
+}
+
+// New creates a new threatintel Plugin tagging addresses from lists.
+func New(lists []List) *Plugin {
+	return &Plugin{
+		Refresh: DefaultRefresh,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+		lists:   lists,
+	}
+}
+
+// ID returns the plugin identifier.
+func (p *Plugin) ID() string { return ID }
+
+// Priority tags interactions before feature plugins that might use the tags.
+func (p *Plugin) Priority() int { return 20 }
+
+// Init loads the lists and schedules their reloading. A local list that
+// cannot be read fails initialization; a remote one that cannot be fetched
+// is loaded from its cache, or left empty until it can be.
+func (p *Plugin) Init(ctx plugins.InitContext) error {
+	p.logger = ctx.Logger.Named(ID)
+	if ctx.Tokens == nil {
+		return errors.New("token config view required")
+	}
+	p.tokens = ctx.Tokens
+	if err := p.load(context.Background()); err != nil {
+		return err
+	}
+	if p.Refresh > 0 && ctx.Scheduler != nil {
+		ctx.Scheduler.Every(p.Refresh, p.load)
+	}
+	return nil
+}
+
+// Config returns the plugin's settings.
+func (p *Plugin) Config() map[string]any {
+	var tags, allow []string
+	for _, l := range p.lists {
+		if l.Allow {
+			allow = append(allow, l.Source)
+		} else {
+			tags = append(tags, l.Tag)
+		}
+	}
+	return map[string]any{
+		"tags":       tags,
+		"allowlists": allow,
+		"refresh":    p.Refresh.String(),
+	}
+}
+
+// NewTokenConfig returns a new Config for a token's configuration to be
+// decoded into.
+func (p *Plugin) NewTokenConfig() any { return new(Config) }
+
+// load reloads every list. A list that fails keeps its previous copy; the
+// errors of local lists are returned and those of remote lists logged.
+func (p *Plugin) load(ctx context.Context) error {
+	prev := p.sets.Load()
+	next := make([]*addrSet, len(p.lists))
+	var errs []error
+	for i, l := range p.lists {
+		s, err := p.loadList(ctx, l)
+		if err != nil {
+			if l.remote() {
+				p.logger.Warn("load list failed", zap.String("source", l.Source), zap.Error(err))
+			} else {
+				errs = append(errs, fmt.Errorf("load %s: %w", l.Source, err))
+			}
+			if prev != nil {
+				s = (*prev)[i]
+			}
+		}
+		next[i] = s
+	}
+	p.sets.Store(&next)
+	return errors.Join(errs...)
+}
+
+// loadList reads l, from its cache if it is remote and cannot be fetched.
+func (p *Plugin) loadList(ctx context.Context, l List) (*addrSet, error) {
+	if !l.remote() {
+		f, err := os.Open(l.Source)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = f.Close() }()
+		return readSet(f)
+	}
+
+	body, err := p.fetch(ctx, l.Source)
+	if err == nil {
+		var s *addrSet
+		if s, err = readSet(bytes.NewReader(body)); err == nil {
+			p.writeCache(l, body)
+			return s, nil
+		}
+	}
+	if p.CacheDir == "" {
+		return nil, err
+	}
+	cached, cacheErr := os.ReadFile(filepath.Join(p.CacheDir, l.cacheName()))
+	if cacheErr != nil {
+		return nil, err
+	}
+	p.logger.Warn("using cached list", zap.String("source", l.Source), zap.Error(err))
+	return readSet(bytes.NewReader(cached))
+}
+
+func (p *Plugin) fetch(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxListSize))
+}
+
+func (p *Plugin) writeCache(l List, body []byte) {
+	if p.CacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(p.CacheDir, 0o700); err != nil {
+		p.logger.Warn("create list cache failed", zap.Error(err))
+		return
+	}
+	if err := os.WriteFile(filepath.Join(p.CacheDir, l.cacheName()), body, 0o600); err != nil {
+		p.logger.Warn("cache list failed", zap.String("source", l.Source), zap.Error(err))
+	}
+}
+
+// OnPreStore tags the interaction with the lists and target ranges
+// containing its remote IP.
+func (p *Plugin) OnPreStore(ctx context.Context, e *events.Event) error {
+	if e.Draft.Drop || e.Draft.TokenID == 0 {
+		return nil
+	}
+	addr, err := netip.ParseAddr(e.Draft.RemoteIP)
+	if err != nil {
+		return nil
+	}
+	addr = addr.Unmap()
+
+	var tags []string
+	if sets := p.sets.Load(); sets != nil && !p.allowed(*sets, addr) {
+		for i, l := range p.lists {
+			if !l.Allow && !slices.Contains(tags, l.Tag) && (*sets)[i].contains(addr) {
+				tags = append(tags, l.Tag)
+			}
+		}
+	}
+
+	var cfg Config
+	if _, err := p.tokens.Get(ctx, e.Draft.TokenID, ID, &cfg); err != nil {
+		return fmt.Errorf("load threatintel: %w", err)
+	}
+	for _, r := range cfg.TargetRanges {
+		if prefix, err := parsePrefix(r); err == nil && prefix.Contains(addr) {
+			tags = append(tags, TargetTag)
+			break
+		}
+	}
+
+	if len(tags) == 0 {
+		return nil
+	}
+	slices.Sort(tags)
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes[TagsAttribute] = tags
+	e.Set(TagsKey, tags)
+	return nil
+}
+
+// allowed reports whether addr is on an allowlist.
+func (p *Plugin) allowed(sets []*addrSet, addr netip.Addr) bool {
+	for i, l := range p.lists {
+		if l.Allow && sets[i].contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package threatintel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/plugintest"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+func writeList(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write list: %v", err)
+	}
+	return path
+}
+
+func newPlugin(t *testing.T, lists []List, tokens plugintest.TokenConfigs[Config], cacheDir string) *Plugin {
+	t.Helper()
+	p := New(lists)
+	p.CacheDir = cacheDir
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Tokens: tokens}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p
+}
+
+func tags(t *testing.T, p *Plugin, tokenID int64, remoteIP string) []string {
+	t.Helper()
+	e := &events.Event{Draft: &events.InteractionDraft{TokenID: tokenID, RemoteIP: remoteIP}}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	got, _ := e.Draft.Attributes[TagsAttribute].([]string)
+	if data, _ := events.Get[[]string](e, TagsKey); !slices.Equal(data, got) {
+		t.Errorf("event data %v differs from attribute %v", data, got)
+	}
+	return got
+}
+
+func TestTags(t *testing.T) {
+	tor := writeList(t, "# exits\n198.51.100.7\n2001:db8::7\n")
+	scanners := writeList(t, "203.0.113.0/24 # scanner range\n198.51.100.7\n")
+	allow := writeList(t, "203.0.113.99\n")
+	p := newPlugin(t, []List{
+		{Tag: "tor_exit", Source: tor},
+		{Tag: "known_scanner", Source: scanners},
+		{Tag: "known_scanner", Source: writeList(t, "192.0.2.200\n")},
+		{Source: allow, Allow: true},
+	}, plugintest.TokenConfigs[Config]{2: {TargetRanges: []string{"192.0.2.0/24"}}}, "")
+
+	tests := []struct {
+		tokenID int64
+		ip      string
+		want    []string
+	}{
+		{1, "198.51.100.7", []string{"known_scanner", "tor_exit"}},
+		{1, "::ffff:198.51.100.7", []string{"known_scanner", "tor_exit"}},
+		{1, "2001:db8::7", []string{"tor_exit"}},
+		{1, "203.0.113.5", []string{"known_scanner"}},
+		{1, "203.0.113.99", nil},
+		{1, "192.0.2.200", []string{"known_scanner"}},
+		{2, "192.0.2.200", []string{"known_scanner", TargetTag}},
+		{2, "192.0.2.1", []string{TargetTag}},
+		{1, "192.0.2.1", nil},
+		{1, "not an ip", nil},
+		{0, "198.51.100.7", nil},
+	}
+	for _, tt := range tests {
+		if got := tags(t, p, tt.tokenID, tt.ip); !slices.Equal(got, tt.want) {
+			t.Errorf("token %d, %s: tags = %v, want %v", tt.tokenID, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestRemoteListCache(t *testing.T) {
+	list := "198.51.100.7\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if list == "" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(list))
+	}))
+	defer srv.Close()
+	cacheDir := t.TempDir()
+	lists := []List{{Tag: "tor_exit", Source: srv.URL}}
+
+	p := newPlugin(t, lists, nil, cacheDir)
+	if got := tags(t, p, 1, "198.51.100.7"); !slices.Equal(got, []string{"tor_exit"}) {
+		t.Fatalf("tags = %v, want tor_exit", got)
+	}
+
+	// With the source down, a failed reload keeps the loaded copy and a new
+	// server starts from the cached one.
+	list = ""
+	if err := p.load(context.Background()); err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if got := tags(t, p, 1, "198.51.100.7"); !slices.Equal(got, []string{"tor_exit"}) {
+		t.Errorf("after failed reload: tags = %v, want tor_exit", got)
+	}
+	restarted := newPlugin(t, lists, nil, cacheDir)
+	if got := tags(t, restarted, 1, "198.51.100.7"); !slices.Equal(got, []string{"tor_exit"}) {
+		t.Errorf("after restart: tags = %v, want tor_exit", got)
+	}
+
+	// Without a cache, the list starts empty.
+	empty := newPlugin(t, lists, nil, "")
+	if got := tags(t, empty, 1, "198.51.100.7"); got != nil {
+		t.Errorf("without cache: tags = %v, want none", got)
+	}
+}
+
+func TestInitFailsOnMissingLocalList(t *testing.T) {
+	p := New([]List{{Tag: "tor_exit", Source: filepath.Join(t.TempDir(), "missing.txt")}})
+	if err := p.Init(plugins.InitContext{Logger: zap.NewNop(), Tokens: plugintest.TokenConfigs[Config]{}}); err == nil {
+		t.Error("Init succeeded with a missing list")
+	}
+}
+
+func TestParseList(t *testing.T) {
+	l, err := ParseList("tor_exit=https://check.torproject.org/torbulkexitlist")
+	if err != nil || l.Tag != "tor_exit" || l.Source != "https://check.torproject.org/torbulkexitlist" {
+		t.Errorf("ParseList = %+v, %v", l, err)
+	}
+	for _, s := range []string{"tor_exit", "=list.txt", "Tor=list.txt", "tor exit=list.txt", "tor_exit="} {
+		if _, err := ParseList(s); err == nil {
+			t.Errorf("ParseList(%q) succeeded", s)
+		}
+	}
+}
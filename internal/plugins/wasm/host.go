@@ -0,0 +1,170 @@
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tetratelabs/wazero/api"
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/pkg/plugin/remote"
+)
+
+// callKey is the context key of the call a hook's host functions act on.
+type callKey struct{}
+
+// call is the state of one hook call: the event the module reads and what
+// it sets. A host function misused, e.g. with memory out of range or a
+// setter another hook owns, fails the call with err.
+type call struct {
+	hook    string
+	event   []byte
+	skipped bool
+
+	attrs    map[string]any
+	drop     *bool
+	httpResp *remote.HTTPResponse
+	dnsResp  *remote.DNSResponse
+	err      error
+}
+
+func (c *call) fail(err error) {
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// in reports whether the call is of hook, failing it if not.
+func (c *call) in(hook, fn string) bool {
+	if c.hook != hook {
+		c.fail(fmt.Errorf("%s called outside %s", fn, hooks[hook]))
+		return false
+	}
+	return true
+}
+
+func callFrom(ctx context.Context) *call {
+	if c, ok := ctx.Value(callKey{}).(*call); ok {
+		return c
+	}
+	// Host functions called while priority runs, or from _initialize.
+	return &call{}
+}
+
+// read returns a copy of the len bytes of m's memory at ptr, failing c if
+// they are out of range.
+func read(c *call, m api.Module, ptr, n uint32) ([]byte, bool) {
+	b, ok := m.Memory().Read(ptr, n)
+	if !ok {
+		c.fail(fmt.Errorf("memory range %d+%d out of bounds", ptr, n))
+		return nil, false
+	}
+	return append([]byte(nil), b...), true
+}
+
+// instantiateHost instantiates the host module in p's runtime.
+func (p *Plugin) instantiateHost(ctx context.Context) error {
+	_, err := p.runtime.NewHostModuleBuilder(HostModule).
+		NewFunctionBuilder().WithFunc(p.eventSize).Export("event_size").
+		NewFunctionBuilder().WithFunc(p.eventRead).Export("event_read").
+		NewFunctionBuilder().WithFunc(p.setAttribute).Export("set_attribute").
+		NewFunctionBuilder().WithFunc(p.setDrop).Export("set_drop").
+		NewFunctionBuilder().WithFunc(p.setHTTPResponse).Export("set_http_response").
+		NewFunctionBuilder().WithFunc(p.setDNSResponse).Export("set_dns_response").
+		NewFunctionBuilder().WithFunc(p.log).Export("log").
+		Instantiate(ctx)
+	return err
+}
+
+func (p *Plugin) eventSize(ctx context.Context) uint32 {
+	return uint32(len(callFrom(ctx).event))
+}
+
+func (p *Plugin) eventRead(ctx context.Context, m api.Module, ptr, n uint32) uint32 {
+	c := callFrom(ctx)
+	b := c.event
+	if uint32(len(b)) < n {
+		n = uint32(len(b))
+	}
+	if !m.Memory().Write(ptr, b[:n]) {
+		c.fail(fmt.Errorf("memory range %d+%d out of bounds", ptr, n))
+		return 0
+	}
+	return n
+}
+
+func (p *Plugin) setAttribute(ctx context.Context, m api.Module, kptr, klen, vptr, vlen uint32) {
+	c := callFrom(ctx)
+	if !c.in(remote.HookPreStore, "set_attribute") {
+		return
+	}
+	key, ok := read(c, m, kptr, klen)
+	if !ok {
+		return
+	}
+	raw, ok := read(c, m, vptr, vlen)
+	if !ok {
+		return
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		c.fail(fmt.Errorf("attribute %q: invalid JSON value: %w", key, err))
+		return
+	}
+	if c.attrs == nil {
+		c.attrs = make(map[string]any)
+	}
+	c.attrs[string(key)] = v
+}
+
+func (p *Plugin) setDrop(ctx context.Context, drop uint32) {
+	c := callFrom(ctx)
+	if !c.in(remote.HookPreStore, "set_drop") {
+		return
+	}
+	d := drop != 0
+	c.drop = &d
+}
+
+func (p *Plugin) setHTTPResponse(ctx context.Context, m api.Module, ptr, n uint32) {
+	c := callFrom(ctx)
+	if !c.in(remote.HookHTTPResponse, "set_http_response") {
+		return
+	}
+	raw, ok := read(c, m, ptr, n)
+	if !ok {
+		return
+	}
+	var resp remote.HTTPResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		c.fail(fmt.Errorf("invalid HTTP response: %w", err))
+		return
+	}
+	c.httpResp = &resp
+}
+
+func (p *Plugin) setDNSResponse(ctx context.Context, m api.Module, ptr, n uint32) {
+	c := callFrom(ctx)
+	if !c.in(remote.HookDNSResponse, "set_dns_response") {
+		return
+	}
+	raw, ok := read(c, m, ptr, n)
+	if !ok {
+		return
+	}
+	var resp remote.DNSResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		c.fail(fmt.Errorf("invalid DNS response: %w", err))
+		return
+	}
+	c.dnsResp = &resp
+}
+
+func (p *Plugin) log(ctx context.Context, m api.Module, ptr, n uint32) {
+	msg, ok := read(callFrom(ctx), m, ptr, n)
+	if !ok {
+		return
+	}
+	p.logger.Info("plugin output", zap.String("line", string(msg)))
+}
@@ -0,0 +1,286 @@
+// Package wasm runs feature plugins compiled to WebAssembly, sandboxed by
+// the wazero runtime: unlike shared objects, they cannot reach the server's
+// memory, files, network or environment, and a hook that runs past its
+// deadline is stopped. They can therefore be written in any language with a
+// WebAssembly target, and loaded without trusting them with the server.
+//
+// A plugin is a module exporting its memory as "memory" and any of the hooks
+//
+//	on_pre_store, on_post_store, on_http_response, on_dns_response
+//
+// each taking no parameters and returning an i32: zero on success, or an
+// error code failing the hook. It may also export priority, returning its
+// priority as an i32. Its ID is its file name without Ext. Every hook call
+// gets a fresh instance of the module, so nothing is kept between calls.
+//
+// Hooks call the functions the host module "oastrix" provides, with
+// pointers and lengths into the plugin's memory:
+//
+//	event_size() -> i32                      size of the event document
+//	event_read(ptr, len i32) -> i32          copy up to len bytes of it to ptr, returning how many were copied
+//	set_attribute(kptr, klen, vptr, vlen i32) set the attribute named by key to the JSON value (on_pre_store)
+//	set_drop(drop i32)                       drop the interaction unless drop is zero (on_pre_store)
+//	set_http_response(ptr, len i32)          replace the HTTP response (on_http_response)
+//	set_dns_response(ptr, len i32)           replace the DNS response (on_dns_response)
+//	log(ptr, len i32)                        log a message
+//
+// The event and responses are the JSON documents remote plugins exchange:
+// remote.Event, remote.HTTPResponse and remote.DNSResponse. Modules built
+// for WASI, e.g. by TinyGo or Rust's wasm32-wasip1 target, may also call its
+// functions, but see no arguments, environment or files, and have their
+// output discarded; an exported _initialize function runs before each hook.
+package wasm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/plugin"
+	"github.com/rsclarke/oastrix/pkg/plugin/remote"
+)
+
+// Ext is the file extension of WebAssembly modules.
+const Ext = ".wasm"
+
+// HostModule is the name of the module providing the host functions.
+const HostModule = "oastrix"
+
+// MemoryLimitPages caps each instance's memory, in 64KiB pages: 16MiB.
+const MemoryLimitPages = 256
+
+// hooks maps each hook to the function a module exports for it.
+var hooks = map[string]string{
+	remote.HookPreStore:     "on_pre_store",
+	remote.HookPostStore:    "on_post_store",
+	remote.HookHTTPResponse: "on_http_response",
+	remote.HookDNSResponse:  "on_dns_response",
+}
+
+// Plugin is a plugin.Plugin backed by a WebAssembly module. It implements
+// every hook interface but only calls the hooks the module exports.
+type Plugin struct {
+	id       string
+	priority int
+	hooks    []string
+	runtime  wazero.Runtime
+	module   wazero.CompiledModule
+	logger   *zap.Logger
+}
+
+// Load compiles the module at path.
+func Load(ctx context.Context, path string) (*Plugin, error) {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(ctx, strings.TrimSuffix(filepath.Base(path), Ext), code)
+}
+
+// New compiles the module code as the plugin id. Close releases it.
+func New(ctx context.Context, id string, code []byte) (*Plugin, error) {
+	cfg := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(MemoryLimitPages).
+		WithCloseOnContextDone(true)
+	p := &Plugin{
+		id:       id,
+		priority: plugin.DefaultPriority,
+		runtime:  wazero.NewRuntimeWithConfig(ctx, cfg),
+		logger:   zap.NewNop(),
+	}
+	if err := p.compile(ctx, code); err != nil {
+		_ = p.runtime.Close(ctx)
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Plugin) compile(ctx context.Context, code []byte) error {
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, p.runtime); err != nil {
+		return fmt.Errorf("instantiate wasi: %w", err)
+	}
+	if err := p.instantiateHost(ctx); err != nil {
+		return fmt.Errorf("instantiate host module: %w", err)
+	}
+
+	module, err := p.runtime.CompileModule(ctx, code)
+	if err != nil {
+		return fmt.Errorf("compile: %w", err)
+	}
+	p.module = module
+	if _, ok := module.ExportedMemories()["memory"]; !ok {
+		return errors.New("module does not export its memory")
+	}
+
+	exports := module.ExportedFunctions()
+	for _, hook := range []string{remote.HookPreStore, remote.HookPostStore, remote.HookHTTPResponse, remote.HookDNSResponse} {
+		fn, ok := exports[hooks[hook]]
+		if !ok {
+			continue
+		}
+		if !returnsI32(fn) {
+			return fmt.Errorf("%s must take no parameters and return an i32", hooks[hook])
+		}
+		p.hooks = append(p.hooks, hook)
+	}
+	if len(p.hooks) == 0 {
+		return errors.New("module exports no hooks")
+	}
+
+	if fn, ok := exports["priority"]; ok {
+		if !returnsI32(fn) {
+			return errors.New("priority must take no parameters and return an i32")
+		}
+		res, err := p.call(ctx, "priority", &call{})
+		if err != nil {
+			return err
+		}
+		p.priority = int(api.DecodeI32(res))
+	}
+	return nil
+}
+
+func returnsI32(fn api.FunctionDefinition) bool {
+	results := fn.ResultTypes()
+	return len(fn.ParamTypes()) == 0 && len(results) == 1 && results[0] == api.ValueTypeI32
+}
+
+// Close releases the compiled module and its runtime.
+func (p *Plugin) Close() error {
+	return p.runtime.Close(context.Background())
+}
+
+// ID returns the plugin's ID, its file name without Ext.
+func (p *Plugin) ID() string { return p.id }
+
+// Priority returns the priority the module exports, or
+// plugin.DefaultPriority.
+func (p *Plugin) Priority() int { return p.priority }
+
+// Hooks returns the hooks the module exports.
+func (p *Plugin) Hooks() []string { return p.hooks }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugin.InitContext) error {
+	p.logger = ctx.Logger.Named(p.id)
+	return nil
+}
+
+// OnPreStore calls the module's on_pre_store hook, applying the attributes
+// it sets and whether to drop the interaction.
+func (p *Plugin) OnPreStore(ctx context.Context, e *events.Event) error {
+	c := &call{hook: remote.HookPreStore}
+	if err := p.hook(ctx, c, remote.Event{InteractionID: e.InteractionID, Draft: remote.ToDraft(e.Draft)}); err != nil || c.skipped {
+		return err
+	}
+	if len(c.attrs) > 0 && e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any, len(c.attrs))
+	}
+	for k, v := range c.attrs {
+		e.Draft.Attributes[k] = v
+	}
+	if c.drop != nil {
+		e.Draft.Drop = *c.drop
+	}
+	return nil
+}
+
+// OnPostStore calls the module's on_post_store hook.
+func (p *Plugin) OnPostStore(ctx context.Context, e *events.Event) error {
+	c := &call{hook: remote.HookPostStore}
+	return p.hook(ctx, c, remote.Event{InteractionID: e.InteractionID, Draft: remote.ToDraft(e.Draft)})
+}
+
+// OnHTTPResponse calls the module's on_http_response hook, applying the
+// response it sets.
+func (p *Plugin) OnHTTPResponse(ctx context.Context, e *events.HTTPEvent) error {
+	if e.Draft == nil {
+		return nil
+	}
+	c := &call{hook: remote.HookHTTPResponse}
+	in := remote.Event{InteractionID: e.InteractionID, Draft: remote.ToDraft(e.Draft), HTTPResponse: remote.ToHTTPResponse(e.Resp)}
+	if err := p.hook(ctx, c, in); err != nil || c.skipped {
+		return err
+	}
+	if c.httpResp != nil {
+		e.Resp = c.httpResp.Plan()
+	}
+	return nil
+}
+
+// OnDNSResponse calls the module's on_dns_response hook, applying the
+// response it sets.
+func (p *Plugin) OnDNSResponse(ctx context.Context, e *events.DNSEvent) error {
+	if e.Draft == nil {
+		return nil
+	}
+	c := &call{hook: remote.HookDNSResponse}
+	in := remote.Event{InteractionID: e.InteractionID, Draft: remote.ToDraft(e.Draft), QNameRaw: e.QNameRaw, DNSResponse: remote.ToDNSResponse(e.Resp)}
+	if err := p.hook(ctx, c, in); err != nil || c.skipped {
+		return err
+	}
+	if c.dnsResp != nil {
+		plan, err := c.dnsResp.Plan()
+		if err != nil {
+			return err
+		}
+		e.Resp = plan
+	}
+	return nil
+}
+
+// hook calls c.hook with the event in, marking c skipped if the module does
+// not export it.
+func (p *Plugin) hook(ctx context.Context, c *call, in remote.Event) error {
+	if !p.has(c.hook) {
+		c.skipped = true
+		return nil
+	}
+	doc, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	c.event = doc
+	res, err := p.call(ctx, hooks[c.hook], c)
+	if err != nil {
+		return err
+	}
+	if code := api.DecodeI32(res); code != 0 {
+		return fmt.Errorf("%s returned %d", hooks[c.hook], code)
+	}
+	return nil
+}
+
+func (p *Plugin) has(hook string) bool { return slices.Contains(p.hooks, hook) }
+
+// call runs the exported function name in a fresh instance of the module,
+// returning its result. The host functions it calls act on c.
+func (p *Plugin) call(ctx context.Context, name string, c *call) (uint64, error) {
+	ctx = context.WithValue(ctx, callKey{}, c)
+	cfg := wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize")
+	mod, err := p.runtime.InstantiateModule(ctx, p.module, cfg)
+	if err != nil {
+		return 0, fmt.Errorf("instantiate: %w", err)
+	}
+	defer func() { _ = mod.Close(context.WithoutCancel(ctx)) }()
+
+	res, err := mod.ExportedFunction(name).Call(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if c.err != nil {
+		return 0, fmt.Errorf("%s: %w", name, c.err)
+	}
+	return res[0], nil
+}
@@ -0,0 +1,242 @@
+package wasm
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/plugin"
+	"github.com/rsclarke/oastrix/pkg/plugin/remote"
+)
+
+// WebAssembly opcodes and types used by the test modules.
+const (
+	opLoop     = 0x03
+	opBr       = 0x0c
+	opEnd      = 0x0b
+	opCall     = 0x10
+	opDrop     = 0x1a
+	opLocalGet = 0x20
+	opLocalSet = 0x21
+	opI32Const = 0x41
+	i32        = 0x7f
+)
+
+func uleb(v uint32) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func sleb(v int32) []byte {
+	var b []byte
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if (v == 0 && c&0x40 == 0) || (v == -1 && c&0x40 != 0) {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+func vec(items ...[]byte) []byte {
+	b := uleb(uint32(len(items)))
+	for _, it := range items {
+		b = append(b, it...)
+	}
+	return b
+}
+
+func name(s string) []byte { return append(uleb(uint32(len(s))), s...) }
+
+func section(id byte, payload []byte) []byte {
+	return append(append([]byte{id}, uleb(uint32(len(payload)))...), payload...)
+}
+
+func funcType(params, results int) []byte {
+	b := []byte{0x60}
+	b = append(b, vec(repeat([]byte{i32}, params)...)...)
+	return append(b, vec(repeat([]byte{i32}, results)...)...)
+}
+
+func repeat(b []byte, n int) [][]byte {
+	out := make([][]byte, n)
+	for i := range out {
+		out[i] = b
+	}
+	return out
+}
+
+func i32Const(v int32) []byte { return append([]byte{opI32Const}, sleb(v)...) }
+
+func callFn(fn uint32) []byte { return append([]byte{opCall}, uleb(fn)...) }
+
+func body(locals int, code ...[]byte) []byte {
+	b := []byte{0}
+	if locals > 0 {
+		b = vec(append(uleb(uint32(locals)), i32))
+	}
+	for _, c := range code {
+		b = append(b, c...)
+	}
+	b = append(b, opEnd)
+	return append(uleb(uint32(len(b))), b...)
+}
+
+func export(n string, kind byte, idx uint32) []byte {
+	return append(append(name(n), kind), uleb(idx)...)
+}
+
+func data(offset int32, s string) []byte {
+	b := append([]byte{0}, i32Const(offset)...)
+	b = append(b, opEnd)
+	return append(b, name(s)...)
+}
+
+const teapot = `{"status":418,"handled":true,"body":"dGVh"}`
+
+// testModule assembles a module whose on_pre_store copies the event into an
+// "event" attribute, sets "seen" and drops the interaction; whose
+// on_post_store never returns; whose on_http_response answers with teapot;
+// whose on_dns_response fails with 7; and whose priority is 5.
+func testModule() []byte {
+	imports := []struct {
+		name string
+		typ  uint32
+	}{
+		{"event_size", 0}, {"event_read", 1}, {"set_attribute", 2}, {"set_drop", 3}, {"set_http_response", 4},
+	}
+	var imps [][]byte
+	for _, imp := range imports {
+		imps = append(imps, append(append(append(name(HostModule), name(imp.name)...), 0x00), uleb(imp.typ)...))
+	}
+	const eventSize, eventRead, setAttribute, setDrop, setHTTPResponse = 0, 1, 2, 3, 4
+
+	m := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	m = append(m, section(1, vec(funcType(0, 1), funcType(2, 1), funcType(4, 0), funcType(1, 0), funcType(2, 0)))...)
+	m = append(m, section(2, vec(imps...))...)
+	m = append(m, section(3, vec([]byte{0}, []byte{0}, []byte{0}, []byte{0}, []byte{0}))...)
+	m = append(m, section(5, vec([]byte{0x00, 0x01}))...)
+	m = append(m, section(7, vec(
+		export("memory", 0x02, 0),
+		export("on_pre_store", 0x00, 5),
+		export("on_post_store", 0x00, 6),
+		export("on_http_response", 0x00, 7),
+		export("on_dns_response", 0x00, 8),
+		export("priority", 0x00, 9),
+	))...)
+	m = append(m, section(10, vec(
+		body(1,
+			callFn(eventSize), []byte{opLocalSet, 0},
+			i32Const(1024), []byte{opLocalGet, 0}, callFn(eventRead), []byte{opDrop},
+			i32Const(0), i32Const(4), i32Const(4), i32Const(4), callFn(setAttribute),
+			i32Const(8), i32Const(5), i32Const(1024), []byte{opLocalGet, 0}, callFn(setAttribute),
+			i32Const(1), callFn(setDrop),
+			i32Const(0)),
+		body(0, []byte{opLoop, 0x40, opBr, 0, opEnd}, i32Const(0)),
+		body(0, i32Const(16), i32Const(int32(len(teapot))), callFn(setHTTPResponse), i32Const(0)),
+		body(0, i32Const(7)),
+		body(0, i32Const(5)),
+	))...)
+	m = append(m, section(11, vec(data(0, "seentrue"), data(8, "event"), data(16, teapot)))...)
+	return m
+}
+
+func newPlugin(t *testing.T) *Plugin {
+	t.Helper()
+	p, err := New(context.Background(), "teapot", testModule())
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+	if err := p.Init(plugin.InitContext{Logger: zap.NewNop()}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p
+}
+
+func draft() *events.InteractionDraft {
+	return &events.InteractionDraft{
+		TokenValue: "tok123",
+		Kind:       events.KindHTTP,
+		RemoteIP:   "192.0.2.1",
+		HTTP:       &events.HTTPDraft{Method: "GET", Host: "tok123.example.com", Path: "/"},
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	p := newPlugin(t)
+	if p.ID() != "teapot" || p.Priority() != 5 {
+		t.Errorf("ID, Priority = %q, %d, want teapot, 5", p.ID(), p.Priority())
+	}
+	if want := []string{remote.HookPreStore, remote.HookPostStore, remote.HookHTTPResponse, remote.HookDNSResponse}; strings.Join(p.Hooks(), ",") != strings.Join(want, ",") {
+		t.Errorf("Hooks = %v, want %v", p.Hooks(), want)
+	}
+
+	e := &events.Event{Draft: draft()}
+	if err := p.OnPreStore(context.Background(), e); err != nil {
+		t.Fatalf("OnPreStore failed: %v", err)
+	}
+	if e.Draft.Attributes["seen"] != true || !e.Draft.Drop {
+		t.Errorf("draft = %+v, want seen set and dropped", e.Draft)
+	}
+	ev, _ := e.Draft.Attributes["event"].(map[string]any)
+	if d, _ := ev["draft"].(map[string]any); d["token"] != "tok123" {
+		t.Errorf("event read by the module = %v", ev)
+	}
+
+	he := &events.HTTPEvent{Event: events.Event{Draft: draft()}, Resp: &events.HTTPResponsePlan{Status: 200}}
+	if err := p.OnHTTPResponse(context.Background(), he); err != nil {
+		t.Fatalf("OnHTTPResponse failed: %v", err)
+	}
+	if he.Resp.Status != 418 || string(he.Resp.Body) != "tea" || !he.Resp.Handled {
+		t.Errorf("response = %+v", he.Resp)
+	}
+
+	de := &events.DNSEvent{Event: events.Event{Draft: draft()}}
+	if err := p.OnDNSResponse(context.Background(), de); err == nil || !strings.Contains(err.Error(), "returned 7") {
+		t.Errorf("OnDNSResponse error = %v, want the module's error code", err)
+	}
+}
+
+func TestPluginStoppedAtDeadline(t *testing.T) {
+	p := newPlugin(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.OnPostStore(ctx, &events.Event{Draft: draft()}); err == nil {
+		t.Error("OnPostStore returned without error from a hook that never returns")
+	}
+}
+
+func TestNewRejectsInvalidModules(t *testing.T) {
+	memoryOnly := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	memoryOnly = append(memoryOnly, section(5, vec([]byte{0x00, 0x01}))...)
+	memoryOnly = append(memoryOnly, section(7, vec(export("memory", 0x02, 0)))...)
+
+	tests := []struct {
+		name string
+		code []byte
+		want string
+	}{
+		{"not wasm", []byte("not wasm"), "compile"},
+		{"no hooks", memoryOnly, "exports no hooks"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(context.Background(), "bad", tt.code); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("New error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Package requestid identifies each HTTP request the server handles, so its
+// log lines, response and the interaction it produced can be tied together.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/logging"
+)
+
+// Header is the response header carrying the request ID.
+const Header = "X-Request-Id"
+
+// Attribute records the request ID on the interaction a request produced.
+const Attribute = "request_id"
+
+// maxLength bounds request IDs accepted from clients.
+const maxLength = 64
+
+type contextKey struct{}
+
+// New returns a new random request ID.
+func New() string {
+	return rand.Text()
+}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, or "" if none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Logger returns l with the request ID carried by ctx, if any, added to its
+// fields.
+func Logger(ctx context.Context, l *zap.Logger) *zap.Logger {
+	if id := FromContext(ctx); id != "" {
+		return l.With(logging.RequestID(id))
+	}
+	return l
+}
+
+// Middleware gives each request an ID, reusing a well-formed one sent in
+// Header, e.g. by a reverse proxy, and returns it in Header. Handlers read
+// it with FromContext.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = New()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// valid reports whether a client-supplied ID is safe to log and echo.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name, sent string
+		reused     bool
+	}{
+		{"none", "", false},
+		{"proxy", "8f14e45f-ceea-467a-9575-8e2b7c1a9b3d", true},
+		{"unsafe", "id\r\nX-Injected: 1", false},
+		{"long", strings.Repeat("a", maxLength+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = FromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.sent != "" {
+				req.Header[Header] = []string{tt.sent}
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			got := w.Header().Get(Header)
+			if got == "" || got != seen {
+				t.Fatalf("response ID %q, handler saw %q", got, seen)
+			}
+			if reused := got == tt.sent; reused != tt.reused {
+				t.Errorf("ID %q for %q sent, reused = %v", got, tt.sent, reused)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/rsclarke/oastrix/internal/logging"
+	"github.com/rsclarke/oastrix/internal/requestid"
+	"go.uber.org/zap"
+)
+
+// AccessLog writes one structured log entry for each request a listener
+// serves. Entries are operational logs of the listener, separate from the
+// interactions recorded.
+type AccessLog struct {
+	Logger *zap.Logger
+	// SampleRatio is the fraction of requests logged, 0 to 1. Responses
+	// with a server error status are always logged.
+	SampleRatio float64
+}
+
+// Middleware logs each request served by next once it has responded.
+func (a *AccessLog) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		aw := &accessLogWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, r)
+
+		status := aw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if status < http.StatusInternalServerError && !a.sampled() {
+			return
+		}
+
+		fields := []zap.Field{
+			logging.Method(r.Method),
+			logging.Host(r.Host),
+			logging.Path(r.URL.Path),
+			zap.Int("status", status),
+			zap.Int64("bytes", aw.bytes),
+			zap.Duration("duration", time.Since(start)),
+			logging.RemoteIP(remoteHost(r)),
+		}
+		// The request ID is set by handlers further in, so read it back
+		// from the response.
+		if id := w.Header().Get(requestid.Header); id != "" {
+			fields = append(fields, logging.RequestID(id))
+		}
+		a.Logger.Info("access", fields...)
+	})
+}
+
+func (a *AccessLog) sampled() bool {
+	return a.SampleRatio >= 1 || (a.SampleRatio > 0 && rand.Float64() < a.SampleRatio)
+}
+
+// accessLogWriter records the status and size of a response. Unwrap lets
+// http.ResponseController reach the underlying writer to flush streams.
+type accessLogWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessLogWriter) WriteHeader(code int) {
+	// Informational responses precede the final status.
+	if w.status == 0 && code >= http.StatusOK {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *accessLogWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessLogWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
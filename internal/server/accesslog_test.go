@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	a := &AccessLog{Logger: zap.New(core), SampleRatio: 1}
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req1")
+		w.WriteHeader(http.StatusTeapot)
+		_, _ = w.Write([]byte("short and stout"))
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "http://tok.oastrix.example.com/a?b=c", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d entries, want 1", len(entries))
+	}
+	got := entries[0].ContextMap()
+	want := map[string]any{
+		"method":     "POST",
+		"host":       "tok.oastrix.example.com",
+		"path":       "/a",
+		"status":     int64(http.StatusTeapot),
+		"bytes":      int64(15),
+		"remote_ip":  "192.0.2.1",
+		"request_id": "req1",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+	if _, ok := got["duration"]; !ok {
+		t.Error("entry has no duration")
+	}
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	a := &AccessLog{Logger: zap.New(core), SampleRatio: 0}
+	status := http.StatusOK
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if logs.Len() != 0 {
+		t.Errorf("logged %d entries at a sample ratio of 0", logs.Len())
+	}
+	status = http.StatusBadGateway
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if logs.Len() != 1 {
+		t.Errorf("logged %d entries for a server error, want 1", logs.Len())
+	}
+}
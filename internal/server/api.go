@@ -4,27 +4,38 @@ package server
 import (
 	"bytes"
 	"context"
-	"database/sql"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rsclarke/oastrix/internal/apitypes"
 	"github.com/rsclarke/oastrix/internal/auth"
 	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/logging"
 	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/requestid"
 	"github.com/rsclarke/oastrix/internal/token"
+	"github.com/rsclarke/oastrix/pkg/models"
 	"go.uber.org/zap"
 )
 
 type contextKey string
 
-const apiKeyIDContextKey contextKey = "apiKeyID"
+const (
+	apiKeyIDContextKey    contextKey = "apiKeyID"
+	apiKeyScopeContextKey contextKey = "apiKeyScope"
+)
 
 func getAPIKeyID(r *http.Request) int64 {
 	if id, ok := r.Context().Value(apiKeyIDContextKey).(int64); ok {
@@ -33,88 +44,408 @@ func getAPIKeyID(r *http.Request) int64 {
 	return 0
 }
 
+func getAPIKeyScope(r *http.Request) auth.Scope {
+	if scope, ok := r.Context().Value(apiKeyScopeContextKey).(auth.Scope); ok {
+		return scope
+	}
+	return ""
+}
+
+// keyUsageInterval throttles last-used updates so that authentication does not
+// write to the database on every request.
+const keyUsageInterval = time.Minute
+
+// streamHeartbeatInterval is how often an idle interaction stream sends a
+// comment line so that proxies do not close the connection.
+const streamHeartbeatInterval = 15 * time.Second
+
+// InteractionSubscriber delivers the IDs of newly stored interactions for a token.
+type InteractionSubscriber interface {
+	Subscribe(tokenID int64) (ids <-chan int64, cancel func())
+}
+
 // APIServer handles the REST API for token and interaction management.
 type APIServer struct {
-	DB       *sql.DB
+	Store    db.Store
 	Domain   string
 	Logger   *zap.Logger
 	PublicIP string
 	Plugins  plugins.PluginRegistry
+	Stream   InteractionSubscriber
+	Pepper   []byte // keys API key hashes; see auth.HashSecret
+	Limiter  *RateLimiter
+	CORS     *CORSConfig  // nil disables CORS headers
+	Tokens   token.Format // format of newly created tokens
+	Domains  []string     // served as well as Domain; payloads may use any
+	// LogLevels, if set, can be read and changed at /v2/admin/log-levels.
+	LogLevels *logging.Levels
+
+	keyUsageMu sync.Mutex
+	keyUsage   map[int64]time.Time
+
+	streamsOnce   sync.Once
+	streamsClosed chan struct{}
+}
+
+// CloseStreams ends the interaction streams being served and any opened
+// after, so that a graceful shutdown does not wait on them.
+func (s *APIServer) CloseStreams() {
+	close(s.streamsDone())
+}
+
+// streamsDone returns the channel CloseStreams closes.
+func (s *APIServer) streamsDone() chan struct{} {
+	s.streamsOnce.Do(func() { s.streamsClosed = make(chan struct{}) })
+	return s.streamsClosed
 }
 
 // AuthMiddleware validates API key authentication for protected routes.
+// Requests authenticate with a bearer API key or, when the listener requires
+// client certificates, with a verified certificate bound to an API key.
 func (s *APIServer) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
+		storedKey := s.authenticate(r)
+		if storedKey == nil || storedKey.RevokedAt != nil {
+			if !s.allowRequest(w, "ip:"+remoteHost(r)) {
+				return
+			}
 			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
 			return
 		}
 
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		if !s.allowRequest(w, "key:"+strconv.FormatInt(storedKey.ID, 10)) {
 			return
 		}
 
-		apiKey := strings.TrimPrefix(authHeader, "Bearer ")
-
-		prefix, _, err := auth.ParseAPIKey(apiKey)
-		if err != nil {
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		if len(storedKey.AllowedCIDRs) > 0 && !clientIPAllowed(r, storedKey.AllowedCIDRs) {
+			requestid.Logger(r.Context(), s.Logger).Warn("api key used from outside its allowlist",
+				zap.String("key_prefix", storedKey.KeyPrefix),
+				zap.String("remote_addr", r.RemoteAddr))
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
 			return
 		}
 
-		storedKey, err := db.GetAPIKeyByPrefix(s.DB, prefix)
-		if err != nil || storedKey == nil {
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
-			return
-		}
+		s.recordKeyUsage(r, storedKey.ID)
 
-		if storedKey.RevokedAt != nil {
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
-			return
-		}
+		ctx := context.WithValue(r.Context(), apiKeyIDContextKey, storedKey.ID)
+		ctx = context.WithValue(ctx, apiKeyScopeContextKey, auth.Scope(storedKey.Scope))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
 
-		if !auth.VerifyAPIKey(apiKey, storedKey.KeyHash) {
-			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+// allowRequest applies the rate limit for the given client identity, writing a
+// 429 response with Retry-After when it is exceeded.
+func (s *APIServer) allowRequest(w http.ResponseWriter, key string) bool {
+	if s.Limiter == nil {
+		return true
+	}
+	ok, retryAfter := s.Limiter.Allow(key)
+	if ok {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "rate limit exceeded"})
+	return false
+}
+
+// authenticate resolves the API key a request acts as, or nil if the request
+// carries no valid credentials. A bearer key takes precedence over a client
+// certificate.
+func (s *APIServer) authenticate(r *http.Request) *models.APIKey {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return s.authenticateClientCert(r)
+	}
+
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil
+	}
+
+	apiKey := strings.TrimPrefix(authHeader, "Bearer ")
+
+	prefix, _, err := auth.ParseAPIKey(apiKey)
+	if err != nil {
+		return nil
+	}
+
+	storedKey, err := s.Store.GetAPIKeyByPrefix(prefix)
+	if err != nil || storedKey == nil {
+		return nil
+	}
+
+	if !s.verifyAPIKey(apiKey, storedKey) {
+		return nil
+	}
+
+	return storedKey
+}
+
+// authenticateClientCert maps the subject common name of a verified client
+// certificate to the API key it is bound to.
+func (s *APIServer) authenticateClientCert(r *http.Request) *models.APIKey {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	subject := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if subject == "" {
+		return nil
+	}
+
+	storedKey, err := s.Store.GetAPIKeyByClientCert(subject)
+	if err != nil {
+		requestid.Logger(r.Context(), s.Logger).Error("failed to look up client certificate", zap.String("subject", subject), zap.Error(err))
+		return nil
+	}
+	return storedKey
+}
+
+// verifyAPIKey checks a presented key against its stored hash. Keys still
+// stored with the legacy unpeppered hash are upgraded on first successful use.
+func (s *APIServer) verifyAPIKey(apiKey string, storedKey *models.APIKey) bool {
+	if storedKey.HashVersion == auth.HashVersionHMAC {
+		return auth.VerifyAPIKey(apiKey, storedKey.KeyHash, s.Pepper)
+	}
+
+	if !auth.VerifyLegacyAPIKey(apiKey, storedKey.KeyHash) {
+		return false
+	}
+
+	_, secret, err := auth.ParseAPIKey(apiKey)
+	if err != nil {
+		return false
+	}
+	if err := s.Store.UpgradeAPIKeyHash(storedKey.ID, auth.HashSecret(secret, s.Pepper)); err != nil {
+		s.Logger.Warn("failed to upgrade api key hash", zap.Int64("api_key_id", storedKey.ID), zap.Error(err))
+	}
+	return true
+}
+
+// recordKeyUsage stores the time and source address of a successful
+// authentication, at most once per keyUsageInterval for each key.
+func (s *APIServer) recordKeyUsage(r *http.Request, keyID int64) {
+	now := time.Now()
+
+	s.keyUsageMu.Lock()
+	if s.keyUsage == nil {
+		s.keyUsage = make(map[int64]time.Time)
+	}
+	if last, ok := s.keyUsage[keyID]; ok && now.Sub(last) < keyUsageInterval {
+		s.keyUsageMu.Unlock()
+		return
+	}
+	s.keyUsage[keyID] = now
+	s.keyUsageMu.Unlock()
+
+	if err := s.Store.TouchAPIKey(keyID, now.Unix(), remoteHost(r)); err != nil {
+		requestid.Logger(r.Context(), s.Logger).Warn("failed to record api key usage", zap.Int64("api_key_id", keyID), zap.Error(err))
+	}
+}
+
+// clientIPAllowed reports whether the request's remote address falls within
+// the allowlist. Malformed allowlists and addresses fail closed.
+func clientIPAllowed(r *http.Request, cidrs []string) bool {
+	allowlist, err := auth.ParseAllowlist(cidrs)
+	if err != nil {
+		return false
+	}
+	ip, err := netip.ParseAddr(remoteHost(r))
+	if err != nil {
+		return false
+	}
+	return auth.IPAllowed(ip, allowlist)
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requireScope rejects requests whose API key lacks the required scope.
+// It must run behind AuthMiddleware.
+func requireScope(required auth.Scope, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !getAPIKeyScope(r).Allows(required) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "insufficient scope"})
 			return
 		}
-
-		ctx := context.WithValue(r.Context(), apiKeyIDContextKey, storedKey.ID)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next(w, r)
 	})
 }
 
-// Handler returns the HTTP handler for the API server.
+// route describes a single API endpoint. The table drives both handler
+// registration and the generated OpenAPI document, so the two cannot drift.
+type route struct {
+	method   string
+	path     string
+	scope    auth.Scope
+	handler  func(*APIServer, http.ResponseWriter, *http.Request)
+	summary  string
+	query    []queryParam
+	request  any  // JSON request body type, nil if none
+	response any  // JSON 200 response body type
+	stream   bool // response is a text/event-stream of response values
+	export   bool // response is NDJSON lines of response values, or CSV
+	upload   bool // request body is raw file content rather than JSON
+}
+
+// queryParam documents an optional query string parameter.
+type queryParam struct {
+	name        string
+	typ         string // OpenAPI primitive type
+	format      string
+	description string
+}
+
+var interactionFilterParams = []queryParam{
+	{"since_id", "integer", "int64", "Only return interactions with a greater ID."},
+	{"since", "string", "date-time", "Only return interactions at or after this RFC 3339 time."},
+	attributeFilterParam,
+}
+
+// attributeFilterParam documents the attr.<key> query parameters.
+var attributeFilterParam = queryParam{
+	"attr.{key}", "string", "",
+	"Only return interactions whose plugin attribute key equals this value, or is a list containing it. Repeat with different keys to require all of them.",
+}
+
+// maxAttributeFilters is the most attr.<key> parameters a request may use.
+const maxAttributeFilters = 8
+
+var apiRoutes = slices.Concat([]route{
+	{
+		method: "POST", path: "/v1/tokens", scope: auth.ScopeFull,
+		handler: (*APIServer).handleCreateToken, summary: "Create a token",
+		request: apitypes.CreateTokenRequest{}, response: apitypes.CreateTokenResponse{},
+	},
+	{
+		method: "GET", path: "/v1/tokens", scope: auth.ScopeRead,
+		handler: (*APIServer).handleListTokens, summary: "List tokens owned by the API key",
+		query: []queryParam{
+			{"tag", "string", "", "Only return tokens with this tag; repeat to require several."},
+			{"label", "string", "", "Only return tokens whose label contains this text, ignoring case."},
+		},
+		response: apitypes.ListTokensResponse{},
+	},
+	{
+		method: "GET", path: "/v1/tokens/{token}/interactions", scope: auth.ScopeRead,
+		handler: (*APIServer).handleGetInteractions, summary: "List interactions for a token",
+		query: interactionFilterParams, response: apitypes.GetInteractionsResponse{},
+	},
+	{
+		method: "GET", path: "/v1/tokens/{token}/interactions/stream", scope: auth.ScopeRead,
+		handler: (*APIServer).handleStreamInteractions, summary: "Stream new interactions for a token as server-sent events",
+		response: apitypes.InteractionResponse{}, stream: true,
+	},
+	{
+		method: "GET", path: "/v1/tokens/{token}/interactions/export", scope: auth.ScopeRead,
+		handler: (*APIServer).handleExportInteractions, summary: "Export interactions for a token as NDJSON, CSV, CEF or LEEF",
+		query: slices.Concat([]queryParam{
+			{"format", "string", "", "ndjson (default), one v2 interaction per line; csv; or cef or leef, one SIEM event per line."},
+		}, interactionFilterParams),
+		response: apitypes.InteractionV2{}, export: true,
+	},
+	{
+		method: "POST", path: "/v1/tokens/{token}/interactions/import", scope: auth.ScopeFull,
+		handler: (*APIServer).handleImportInteractions, summary: "Import interactions exported as NDJSON",
+		upload: true, response: apitypes.ImportInteractionsResponse{},
+	},
+	{
+		method: "POST", path: "/v1/tokens/{token}/interactions/purge", scope: auth.ScopeFull,
+		handler: (*APIServer).handlePurgeTokenInteractions, summary: "Purge old interactions for a token",
+		request: apitypes.PurgeInteractionsRequest{}, response: apitypes.PurgeInteractionsResponse{},
+	},
+	{
+		method: "PATCH", path: "/v1/tokens/{token}", scope: auth.ScopeFull,
+		handler: (*APIServer).handleUpdateToken, summary: "Update a token's label, expiry or tags",
+		request: apitypes.UpdateTokenRequest{}, response: apitypes.TokenInfo{},
+	},
+	{
+		method: "GET", path: "/v1/tokens/{token}/payloads", scope: auth.ScopeRead,
+		handler: (*APIServer).handleListPayloads, summary: "List ready-to-paste payloads for a token",
+		query: []queryParam{
+			{"domain", "string", "", "Build the payloads on this of the server's domains rather than its main one."},
+		},
+		response: apitypes.ListPayloadsResponse{},
+	},
+	{
+		method: "PUT", path: "/v1/tokens/{token}/aliases", scope: auth.ScopeFull,
+		handler: (*APIServer).handleSetTokenAliases, summary: "Replace a token's subdomain aliases",
+		request: apitypes.SetTokenAliasesRequest{}, response: apitypes.TokenInfo{},
+	},
+	{
+		method: "POST", path: "/v1/tokens/{token}/enable", scope: auth.ScopeFull,
+		handler: (*APIServer).handleEnableToken, summary: "Resume recording interactions for a token",
+		response: apitypes.TokenInfo{},
+	},
+	{
+		method: "POST", path: "/v1/tokens/{token}/disable", scope: auth.ScopeFull,
+		handler: (*APIServer).handleDisableToken, summary: "Pause a token without deleting its history",
+		response: apitypes.TokenInfo{},
+	},
+	{
+		method: "DELETE", path: "/v1/tokens/{token}", scope: auth.ScopeFull,
+		handler: (*APIServer).handleDeleteToken, summary: "Delete a token and its interactions",
+		response: apitypes.DeleteTokenResponse{},
+	},
+	{
+		method: "POST", path: "/v1/interactions/purge", scope: auth.ScopeFull,
+		handler: (*APIServer).handlePurgeInteractions, summary: "Purge old interactions across all tokens owned by the API key",
+		request: apitypes.PurgeInteractionsRequest{}, response: apitypes.PurgeInteractionsResponse{},
+	},
+	{
+		method: "GET", path: "/v1/plugins", scope: auth.ScopeRead,
+		handler: (*APIServer).handleListPlugins, summary: "List registered plugins",
+		response: apitypes.ListPluginsResponse{},
+	},
+}, quotaRoutes, httpResponseRoutes, delayRoutes, redirectRoutes, overridesRoutes, fileRoutes, basicAuthRoutes, ntlmRoutes, pluginConfigRoutes, globalPluginConfigRoutes)
+
+// Handler returns the API handler. The OpenAPI documents are served without
+// authentication so that clients can be generated before a key is issued.
 func (s *APIServer) Handler() http.Handler {
 	mux := http.NewServeMux()
-	mux.HandleFunc("POST /v1/tokens", s.handleCreateToken)
-	mux.HandleFunc("GET /v1/tokens", s.handleListTokens)
-	mux.HandleFunc("GET /v1/tokens/{token}/interactions", s.handleGetInteractions)
-	mux.HandleFunc("DELETE /v1/tokens/{token}", s.handleDeleteToken)
-	mux.HandleFunc("GET /v1/plugins", s.handleListPlugins)
+	for _, rt := range slices.Concat(apiRoutes, apiV2Routes) {
+		mux.Handle(rt.method+" "+rt.path, requireScope(rt.scope, func(w http.ResponseWriter, r *http.Request) {
+			rt.handler(s, w, r)
+		}))
+	}
 
-	return s.AuthMiddleware(mux)
+	root := http.NewServeMux()
+	root.HandleFunc("GET /v1/openapi.json", serveOpenAPI(openAPIV1Spec))
+	root.HandleFunc("GET /v2/openapi.json", serveOpenAPI(openAPIV2Spec))
+	root.Handle("/", s.AuthMiddleware(mux))
+
+	var h http.Handler = root
+	if s.CORS != nil {
+		h = s.CORS.Middleware(h)
+	}
+	return requestid.Middleware(h)
 }
 
 func (s *APIServer) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	tags, ok := normalizeTags(w, q["tag"])
+	if !ok {
+		return
+	}
+	filter := db.TokenFilter{Tags: tags, Label: q.Get("label")}
+
 	apiKeyID := getAPIKeyID(r)
-	tokens, err := db.ListTokensByAPIKey(s.DB, apiKeyID)
+	tokens, err := s.Store.ListTokensByAPIKey(apiKeyID, filter)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
 		return
 	}
 
+	now := time.Now().Unix()
 	resp := apitypes.ListTokensResponse{
 		Tokens: make([]apitypes.TokenInfo, 0, len(tokens)),
 	}
 	for _, t := range tokens {
-		resp.Tokens = append(resp.Tokens, apitypes.TokenInfo{
-			Token:            t.Token,
-			Label:            t.Label,
-			CreatedAt:        time.Unix(t.CreatedAt, 0).UTC().Format(time.RFC3339),
-			InteractionCount: t.InteractionCount,
-		})
+		resp.Tokens = append(resp.Tokens, tokenInfo(t, now))
 	}
 
 	writeJSON(w, http.StatusOK, resp)
@@ -122,27 +453,21 @@ func (s *APIServer) handleListTokens(w http.ResponseWriter, r *http.Request) {
 
 func (s *APIServer) handleCreateToken(w http.ResponseWriter, r *http.Request) {
 	var req apitypes.CreateTokenRequest
-	if r.Body != nil {
-		r.Body = http.MaxBytesReader(w, r.Body, 1<<16) // 64KB limit
-		dec := json.NewDecoder(r.Body)
-		dec.DisallowUnknownFields()
-		if err := dec.Decode(&req); err != nil && err != io.EOF {
-			var maxBytesErr *http.MaxBytesError
-			if errors.As(err, &maxBytesErr) {
-				writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "request body too large"})
-				return
-			}
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
-			return
-		}
-		// Ensure no trailing data
-		if dec.Decode(&struct{}{}) != io.EOF {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unexpected trailing data"})
-			return
-		}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	expiresAt, ok := parseTokenExpiry(w, req.ExpiresAt, req.TTL)
+	if !ok {
+		return
+	}
+
+	tags, ok := normalizeTags(w, req.Tags)
+	if !ok {
+		return
 	}
 
-	tok, err := token.Generate()
+	tok, err := s.generateToken()
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to generate token"})
 		return
@@ -155,14 +480,23 @@ func (s *APIServer) handleCreateToken(w http.ResponseWriter, r *http.Request) {
 
 	// Associate token with the API key that created it
 	apiKeyID := getAPIKeyID(r)
-	_, err = db.CreateToken(s.DB, tok, &apiKeyID, labelPtr)
+	tokenID, err := s.Store.CreateToken(tok, &apiKeyID, labelPtr, expiresAt)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create token"})
 		return
 	}
+	if len(tags) > 0 {
+		if err := s.Store.SetTokenTags(tokenID, tags); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to create token"})
+			return
+		}
+	}
 
 	resp := apitypes.CreateTokenResponse{
-		Token: tok,
+		Token:     tok,
+		ExpiresAt: formatOptionalTime(expiresAt),
+		Tags:      tags,
+		Catalog:   s.payloadCatalog(tok, s.Domain),
 		Payloads: map[string]string{
 			"dns":   fmt.Sprintf("%s.%s", tok, s.Domain),
 			"http":  fmt.Sprintf("http://%s.%s/", tok, s.Domain),
@@ -178,135 +512,618 @@ func (s *APIServer) handleCreateToken(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
-func (s *APIServer) handleGetInteractions(w http.ResponseWriter, r *http.Request) {
-	tokenValue := r.PathValue("token")
-	if tokenValue == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "token required"})
+// generateToken returns a new token value that does not collide with an
+// existing token or alias.
+func (s *APIServer) generateToken() (string, error) {
+	for range 5 {
+		tok, err := s.Tokens.Generate()
+		if err != nil {
+			return "", err
+		}
+		taken, err := s.Store.TokenValueInUse(tok)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return tok, nil
+		}
+	}
+	return "", errors.New("no unused token value after 5 attempts")
+}
+
+// Tag limits. Tags are lowercased and must start with a letter or digit,
+// followed by letters, digits or any of "._:/-".
+const (
+	maxTagLength = 64
+	maxTags      = 32
+)
+
+// normalizeTags lowercases, validates, sorts and deduplicates tags.
+// On failure an error response has already been written.
+func normalizeTags(w http.ResponseWriter, tags []string) ([]string, bool) {
+	if len(tags) > maxTags {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d tags allowed", maxTags)})
+		return nil, false
+	}
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if !validTag(tag) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid tag %q", tag)})
+			return nil, false
+		}
+		out = append(out, tag)
+	}
+	slices.Sort(out)
+	return slices.Compact(out), true
+}
+
+func validTag(tag string) bool {
+	if tag == "" || len(tag) > maxTagLength {
+		return false
+	}
+	for i, c := range tag {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case i > 0 && strings.ContainsRune("._:/-", c):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// parseTokenExpiry resolves an optional expires_at or ttl to a Unix timestamp,
+// returning nil when neither is set. On failure an error response has already
+// been written.
+func parseTokenExpiry(w http.ResponseWriter, expiresAt, ttl string) (*int64, bool) {
+	switch {
+	case expiresAt != "" && ttl != "":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "only one of expires_at or ttl allowed"})
+		return nil, false
+	case expiresAt != "":
+		t, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid expires_at timestamp"})
+			return nil, false
+		}
+		if !t.After(time.Now()) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "expires_at must be in the future"})
+			return nil, false
+		}
+		unix := t.Unix()
+		return &unix, true
+	case ttl != "":
+		d, err := time.ParseDuration(ttl)
+		if err != nil || d <= 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid ttl"})
+			return nil, false
+		}
+		unix := time.Now().Add(d).Unix()
+		return &unix, true
+	default:
+		return nil, true
+	}
+}
+
+func (s *APIServer) handleUpdateToken(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
 		return
 	}
 
-	tok, err := db.GetTokenByValue(s.DB, tokenValue)
-	if err != nil {
+	var req apitypes.UpdateTokenRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	// Validate everything before writing so a bad field leaves the token as it was.
+	var expiresAt *int64
+	if req.ExpiresAt != nil || req.TTL != nil {
+		if req.ExpiresAt == nil || *req.ExpiresAt != "" {
+			expiresAt, ok = parseTokenExpiry(w, derefString(req.ExpiresAt), derefString(req.TTL))
+			if !ok {
+				return
+			}
+		} else if req.TTL != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "only one of expires_at or ttl allowed"})
+			return
+		}
+	}
+
+	var tags []string
+	if req.Tags != nil {
+		if tags, ok = normalizeTags(w, *req.Tags); !ok {
+			return
+		}
+	}
+
+	if req.Label != nil {
+		var label *string
+		if *req.Label != "" {
+			label = req.Label
+		}
+		if err := s.Store.SetTokenLabel(tok.ID, label); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+			return
+		}
+	}
+
+	if req.ExpiresAt != nil || req.TTL != nil {
+		if err := s.Store.SetTokenExpiry(tok.ID, expiresAt); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+			return
+		}
+	}
+
+	if req.Tags != nil {
+		if err := s.Store.SetTokenTags(tok.ID, tags); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+			return
+		}
+	}
+
+	s.writeTokenInfo(w, tok.ID)
+}
+
+// maxAliases is the number of aliases a single token may have.
+const maxAliases = 16
+
+func (s *APIServer) handleSetTokenAliases(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+
+	var req apitypes.SetTokenAliasesRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if len(req.Aliases) > maxAliases {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d aliases allowed", maxAliases)})
+		return
+	}
+	aliases := make([]string, 0, len(req.Aliases))
+	for _, alias := range req.Aliases {
+		alias = strings.ToLower(strings.TrimSpace(alias))
+		if !validAlias(alias) {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid alias %q", alias)})
+			return
+		}
+		aliases = append(aliases, alias)
+	}
+	slices.Sort(aliases)
+	aliases = slices.Compact(aliases)
+
+	if err := s.Store.SetTokenAliases(tok.ID, aliases); err != nil {
+		if errors.Is(err, db.ErrAliasTaken) {
+			writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+			return
+		}
+		requestid.Logger(r.Context(), s.Logger).Error("failed to set token aliases", zap.Int64("token_id", tok.ID), zap.Error(err))
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
 		return
 	}
-	if tok == nil {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": "token not found"})
+
+	s.writeTokenInfo(w, tok.ID)
+}
+
+// validAlias reports whether alias is a lowercase DNS label that does not
+// shadow a name the server answers itself: the nameserver, or the API host
+// of --api-vhost.
+func validAlias(alias string) bool {
+	if alias == "" || len(alias) > token.MaxLength || alias == "ns1" || alias == "api" {
+		return false
+	}
+	if alias[0] == '-' || alias[len(alias)-1] == '-' {
+		return false
+	}
+	for _, c := range alias {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *APIServer) handleEnableToken(w http.ResponseWriter, r *http.Request) {
+	s.setTokenEnabled(w, r, true)
+}
+
+func (s *APIServer) handleDisableToken(w http.ResponseWriter, r *http.Request) {
+	s.setTokenEnabled(w, r, false)
+}
+
+func (s *APIServer) setTokenEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
 		return
 	}
 
-	// Verify ownership: token must belong to the requesting API key
-	apiKeyID := getAPIKeyID(r)
-	if tok.APIKeyID == nil || *tok.APIKeyID != apiKeyID {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": "token not found"})
+	if err := s.Store.SetTokenEnabled(tok.ID, enabled); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+
+	s.writeTokenInfo(w, tok.ID)
+}
+
+// writeTokenInfo responds with the current state of the token with the given
+// ID.
+func (s *APIServer) writeTokenInfo(w http.ResponseWriter, tokenID int64) {
+	t, err := s.Store.GetTokenWithCount(tokenID)
+	if err != nil || t == nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, tokenInfo(*t, time.Now().Unix()))
+}
+
+// tokenInfo converts a stored token into its API representation, flagging it
+// as expired relative to now.
+func tokenInfo(t db.TokenWithCount, now int64) apitypes.TokenInfo {
+	return apitypes.TokenInfo{
+		Token:            t.Token,
+		Label:            t.Label,
+		CreatedAt:        time.Unix(t.CreatedAt, 0).UTC().Format(time.RFC3339),
+		ExpiresAt:        formatOptionalTime(t.ExpiresAt),
+		Expired:          t.ExpiresAt != nil && *t.ExpiresAt <= now,
+		Enabled:          t.Enabled,
+		Tags:             t.Tags,
+		Aliases:          t.Aliases,
+		InteractionCount: t.InteractionCount,
+	}
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// formatOptionalTime formats a nullable Unix timestamp as RFC 3339.
+func formatOptionalTime(unix *int64) *string {
+	if unix == nil {
+		return nil
+	}
+	s := time.Unix(*unix, 0).UTC().Format(time.RFC3339)
+	return &s
+}
+
+func (s *APIServer) handleGetInteractions(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
 		return
 	}
 
-	interactions, err := db.GetInteractionsByToken(s.DB, tok.ID)
+	filter, ok := parseInteractionFilter(w, r)
+	if !ok {
+		return
+	}
+
+	interactions, err := s.Store.ListInteractionDetails(tok.ID, filter)
 	if err != nil {
 		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
 		return
 	}
 
 	resp := apitypes.GetInteractionsResponse{
-		Token:        tokenValue,
+		Token:        tok.Token,
 		Interactions: make([]apitypes.InteractionResponse, 0, len(interactions)),
 	}
 
 	for _, i := range interactions {
-		ir := apitypes.InteractionResponse{
-			ID:         i.ID,
-			Kind:       i.Kind,
-			OccurredAt: time.Unix(i.OccurredAt, 0).UTC().Format(time.RFC3339),
-			RemoteIP:   i.RemoteIP,
-			RemotePort: i.RemotePort,
-			TLS:        i.TLS,
-			Summary:    i.Summary,
-		}
-
-		if i.Kind == "http" {
-			httpInt, err := db.GetHTTPInteraction(s.DB, i.ID)
-			if err != nil {
-				s.Logger.Error("failed to get HTTP interaction details",
-					zap.Int64("interaction_id", i.ID),
-					zap.Error(err))
-			} else if httpInt != nil {
-				var headers map[string][]string
-				if err := json.Unmarshal([]byte(httpInt.RequestHeaders), &headers); err != nil {
-					s.Logger.Warn("failed to parse stored request headers",
-						zap.Int64("interaction_id", i.ID),
-						zap.Error(err))
-					headers = make(map[string][]string)
-				}
-
-				ir.HTTP = &apitypes.HTTPInteractionDetail{
-					Method:  httpInt.Method,
-					Scheme:  httpInt.Scheme,
-					Host:    httpInt.Host,
-					Path:    httpInt.Path,
-					Query:   httpInt.Query,
-					Headers: headers,
-					Body:    base64.StdEncoding.EncodeToString(httpInt.RequestBody),
-				}
-			}
+		resp.Interactions = append(resp.Interactions, s.interactionResponse(i))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseInteractionFilter reads the since_id, since and attr.<key> query parameters.
+// On failure an error response has already been written.
+func parseInteractionFilter(w http.ResponseWriter, r *http.Request) (db.InteractionFilter, bool) {
+	var f db.InteractionFilter
+	q := r.URL.Query()
+
+	if v := q.Get("since_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid since_id"})
+			return f, false
+		}
+		f.SinceID = id
+	}
+
+	if v := q.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid since timestamp"})
+			return f, false
 		}
+		f.Since = since.Unix()
+	}
+
+	return f, parseAttributeFilter(w, r, &f)
+}
 
-		if i.Kind == "dns" {
-			dnsInt, err := db.GetDNSInteraction(s.DB, i.ID)
+// parseAttributeFilter reads attr.<key>=<value> query parameters into
+// f.Attributes. On failure an error response has already been written.
+func parseAttributeFilter(w http.ResponseWriter, r *http.Request, f *db.InteractionFilter) bool {
+	for name, values := range r.URL.Query() {
+		key, ok := strings.CutPrefix(name, "attr.")
+		if !ok {
+			continue
+		}
+		if key == "" || len(values) != 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid attribute filter " + name})
+			return false
+		}
+		if f.Attributes == nil {
+			f.Attributes = make(map[string]string)
+		}
+		f.Attributes[key] = values[0]
+	}
+	if len(f.Attributes) > maxAttributeFilters {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("at most %d attribute filters allowed", maxAttributeFilters)})
+		return false
+	}
+	return true
+}
+
+// interactionDetails loads the details and attributes of a single stored
+// interaction, as ListInteractionDetails does for many. Unreadable details
+// are logged and omitted rather than failing the whole response.
+func (s *APIServer) interactionDetails(i models.Interaction) models.InteractionDetails {
+	details := models.InteractionDetails{Interaction: i}
+
+	switch i.Kind {
+	case "http":
+		h, err := s.Store.GetHTTPInteraction(i.ID)
+		if err != nil {
+			s.Logger.Error("failed to get HTTP interaction details",
+				zap.Int64("interaction_id", i.ID),
+				zap.Error(err))
+		}
+		details.HTTP = h
+	case "dns":
+		d, err := s.Store.GetDNSInteraction(i.ID)
+		if err != nil {
+			s.Logger.Error("failed to get DNS interaction details",
+				zap.Int64("interaction_id", i.ID),
+				zap.Error(err))
+		}
+		details.DNS = d
+	}
+
+	attrs, err := s.Store.GetAttributes(i.ID)
+	if err != nil {
+		s.Logger.Error("failed to get interaction attributes",
+			zap.Int64("interaction_id", i.ID),
+			zap.Error(err))
+		attrs = make(map[string]any)
+	}
+	details.Attributes = attrs
+	return details
+}
+
+// interactionResponse converts a stored interaction, including its
+// protocol-specific details, into its API representation.
+func (s *APIServer) interactionResponse(i models.InteractionDetails) apitypes.InteractionResponse {
+	ir := apitypes.InteractionResponse{
+		ID:         i.ID,
+		Kind:       i.Kind,
+		OccurredAt: time.Unix(i.OccurredAt, 0).UTC().Format(time.RFC3339),
+		RemoteIP:   i.RemoteIP,
+		RemotePort: i.RemotePort,
+		TLS:        i.TLS,
+		Summary:    i.Summary,
+	}
+
+	if httpInt := i.HTTP; httpInt != nil {
+		var headers map[string][]string
+		if err := json.Unmarshal([]byte(httpInt.RequestHeaders), &headers); err != nil {
+			s.Logger.Warn("failed to parse stored request headers",
+				zap.Int64("interaction_id", i.ID),
+				zap.Error(err))
+			headers = make(map[string][]string)
+		}
+
+		ir.HTTP = &apitypes.HTTPInteractionDetail{
+			Method:   httpInt.Method,
+			Scheme:   httpInt.Scheme,
+			Host:     httpInt.Host,
+			Path:     httpInt.Path,
+			Query:    httpInt.Query,
+			Headers:  headers,
+			Body:     base64.StdEncoding.EncodeToString(httpInt.RequestBody),
+			Response: s.httpResponseV2(httpInt),
+		}
+	}
+
+	if dnsInt := i.DNS; dnsInt != nil {
+		ir.DNS = &apitypes.DNSInteractionDetail{
+			QName:    dnsInt.QName,
+			QType:    dnsInt.QType,
+			QClass:   dnsInt.QClass,
+			RD:       dnsInt.RD != 0,
+			Opcode:   dnsInt.Opcode,
+			DNSID:    dnsInt.DNSID,
+			Protocol: dnsInt.Protocol,
+			Response: s.dnsResponseV2(dnsInt),
+		}
+	}
+
+	return ir
+}
+
+func (s *APIServer) handleStreamInteractions(w http.ResponseWriter, r *http.Request) {
+	if s.Stream == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"error": "streaming not enabled"})
+		return
+	}
+
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+
+	// Streams are long-lived, so lift the server-wide write timeout for this connection.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming not supported"})
+		return
+	}
+
+	ids, cancel := s.Stream.Subscribe(tok.ID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	closed := s.streamsDone()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-closed:
+			return
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case id := <-ids:
+			i, err := s.Store.GetInteraction(id)
+			if err != nil {
+				requestid.Logger(r.Context(), s.Logger).Error("failed to load streamed interaction", zap.Int64("interaction_id", id), zap.Error(err))
+				continue
+			}
+			if i == nil {
+				continue
+			}
+			data, err := json.Marshal(s.interactionResponse(s.interactionDetails(*i)))
 			if err != nil {
-				s.Logger.Error("failed to get DNS interaction details",
-					zap.Int64("interaction_id", i.ID),
-					zap.Error(err))
-			} else if dnsInt != nil {
-				ir.DNS = &apitypes.DNSInteractionDetail{
-					QName:    dnsInt.QName,
-					QType:    dnsInt.QType,
-					QClass:   dnsInt.QClass,
-					RD:       dnsInt.RD != 0,
-					Opcode:   dnsInt.Opcode,
-					DNSID:    dnsInt.DNSID,
-					Protocol: dnsInt.Protocol,
-				}
+				requestid.Logger(r.Context(), s.Logger).Error("failed to encode streamed interaction", zap.Int64("interaction_id", id), zap.Error(err))
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: interaction\ndata: %s\n\n", i.ID, data); err != nil {
+				return
 			}
 		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *APIServer) handleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
 
-		resp.Interactions = append(resp.Interactions, ir)
+	err := s.Store.DeleteToken(tok.Token)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete token"})
+		return
 	}
 
-	writeJSON(w, http.StatusOK, resp)
+	writeJSON(w, http.StatusOK, apitypes.DeleteTokenResponse{Deleted: true})
 }
 
-func (s *APIServer) handleDeleteToken(w http.ResponseWriter, r *http.Request) {
-	tokenValue := r.PathValue("token")
-	if tokenValue == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "token required"})
+func (s *APIServer) handlePurgeTokenInteractions(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
 		return
 	}
 
-	tok, err := db.GetTokenByValue(s.DB, tokenValue)
+	before, ok := decodePurgeCutoff(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := s.Store.PurgeInteractions(tok.ID, before.Unix())
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		requestid.Logger(r.Context(), s.Logger).Error("failed to purge interactions", zap.Int64("token_id", tok.ID), zap.Error(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to purge interactions"})
 		return
 	}
-	if tok == nil {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": "token not found"})
+
+	writeJSON(w, http.StatusOK, apitypes.PurgeInteractionsResponse{Deleted: deleted})
+}
+
+func (s *APIServer) handlePurgeInteractions(w http.ResponseWriter, r *http.Request) {
+	before, ok := decodePurgeCutoff(w, r)
+	if !ok {
 		return
 	}
 
-	// Verify ownership: token must belong to the requesting API key
 	apiKeyID := getAPIKeyID(r)
-	if tok.APIKeyID == nil || *tok.APIKeyID != apiKeyID {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": "token not found"})
+	deleted, err := s.Store.PurgeInteractionsByAPIKey(apiKeyID, before.Unix())
+	if err != nil {
+		requestid.Logger(r.Context(), s.Logger).Error("failed to purge interactions", zap.Int64("api_key_id", apiKeyID), zap.Error(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to purge interactions"})
 		return
 	}
 
-	err = db.DeleteToken(s.DB, tokenValue)
+	writeJSON(w, http.StatusOK, apitypes.PurgeInteractionsResponse{Deleted: deleted})
+}
+
+func (s *APIServer) handlePurgeAllInteractions(w http.ResponseWriter, r *http.Request) {
+	before, ok := decodePurgeCutoff(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := s.Store.PurgeAllInteractions(before.Unix())
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to delete token"})
+		requestid.Logger(r.Context(), s.Logger).Error("failed to purge interactions", zap.Error(err))
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to purge interactions"})
 		return
 	}
 
-	writeJSON(w, http.StatusOK, apitypes.DeleteTokenResponse{Deleted: true})
+	writeJSON(w, http.StatusOK, apitypes.PurgeInteractionsResponse{Deleted: deleted})
+}
+
+// decodePurgeCutoff reads a purge request and resolves it to an absolute cutoff.
+// On failure an error response has already been written.
+func decodePurgeCutoff(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	var req apitypes.PurgeInteractionsRequest
+	if !decodeJSON(w, r, &req) {
+		return time.Time{}, false
+	}
+
+	switch {
+	case req.OlderThan != "" && req.Before != "":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "specify only one of older_than or before"})
+		return time.Time{}, false
+	case req.OlderThan != "":
+		age, err := time.ParseDuration(req.OlderThan)
+		if err != nil || age < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid older_than duration"})
+			return time.Time{}, false
+		}
+		return time.Now().Add(-age), true
+	case req.Before != "":
+		before, err := time.Parse(time.RFC3339, req.Before)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid before timestamp"})
+			return time.Time{}, false
+		}
+		return before, true
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "older_than or before required"})
+		return time.Time{}, false
+	}
 }
 
 func (s *APIServer) handleListPlugins(w http.ResponseWriter, _ *http.Request) {
@@ -325,6 +1142,8 @@ func (s *APIServer) handleListPlugins(w http.ResponseWriter, _ *http.Request) {
 			ID:      p.ID,
 			Type:    string(p.Type),
 			Enabled: p.Enabled,
+			Healthy: p.Healthy,
+			Problem: p.Problem,
 			Config:  p.Config,
 		})
 	}
@@ -332,6 +1151,64 @@ func (s *APIServer) handleListPlugins(w http.ResponseWriter, _ *http.Request) {
 	writeJSON(w, http.StatusOK, resp)
 }
 
+// ownedToken resolves the {token} path value to a token owned by the requesting
+// API key. Tokens belonging to other keys are reported as not found so that
+// their existence is not disclosed. On failure an error response has already
+// been written.
+func (s *APIServer) ownedToken(w http.ResponseWriter, r *http.Request) (*models.Token, bool) {
+	tokenValue := r.PathValue("token")
+	if tokenValue == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "token required"})
+		return nil, false
+	}
+
+	tok, err := s.Store.GetTokenByValue(tokenValue)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return nil, false
+	}
+	if tok == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "token not found"})
+		return nil, false
+	}
+
+	apiKeyID := getAPIKeyID(r)
+	if tok.APIKeyID == nil || *tok.APIKeyID != apiKeyID {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "token not found"})
+		return nil, false
+	}
+
+	return tok, true
+}
+
+// decodeJSON decodes an optional JSON request body into out, rejecting unknown
+// fields and trailing data. An empty body leaves out unchanged. On failure an
+// error response has already been written.
+func decodeJSON(w http.ResponseWriter, r *http.Request, out any) bool {
+	if r.Body == nil {
+		return true
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<16) // 64KB limit
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil && err != io.EOF {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "request body too large"})
+			return false
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return false
+	}
+	// Ensure no trailing data
+	if dec.Decode(&struct{}{}) != io.EOF {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unexpected trailing data"})
+		return false
+	}
+	return true
+}
+
 func writeJSON(w http.ResponseWriter, status int, data any) {
 	buf := new(bytes.Buffer)
 	if err := json.NewEncoder(buf).Encode(data); err != nil {
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/pkg/models"
+	"go.uber.org/zap"
+)
+
+// handleListStraysV2 lists the traffic recorded in honeypot mode. Stray
+// interactions belong to no token, so only admin keys may read them.
+func (s *APIServer) handleListStraysV2(w http.ResponseWriter, r *http.Request) {
+	page, ok := parsePageFilter(w, r)
+	if !ok {
+		return
+	}
+	if len(page.Attributes) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "stray interactions have no attributes to filter by"})
+		return
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	limit := page.Limit
+	// Strays are never imported, so they are listed in ID order alone.
+	var beforeID int64
+	if page.After != nil {
+		beforeID = page.After.ID
+	}
+	strays, err := s.Store.ListStrayInteractions(db.StrayFilter{
+		BeforeID: beforeID,
+		Since:    page.Since,
+		Kind:     r.URL.Query().Get("kind"),
+		Limit:    limit + 1,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+
+	resp := apitypes.ListStrayInteractionsV2Response{
+		Data:       make([]apitypes.StrayInteractionV2, 0, min(len(strays), limit)),
+		Pagination: apitypes.Pagination{Limit: limit},
+	}
+	if len(strays) > limit {
+		strays = strays[:limit]
+		resp.Pagination.HasMore = true
+		last := strays[limit-1]
+		resp.Pagination.NextCursor = encodeCursor(db.Cursor{OccurredAt: last.OccurredAt, ID: last.ID})
+	}
+	for _, stray := range strays {
+		resp.Data = append(resp.Data, s.strayV2(stray))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// strayV2 converts a stray interaction into its v2 representation. Details
+// that cannot be parsed are logged and omitted.
+func (s *APIServer) strayV2(stray models.StrayInteraction) apitypes.StrayInteractionV2 {
+	sv := apitypes.StrayInteractionV2{
+		ID:         stray.ID,
+		Kind:       stray.Kind,
+		OccurredAt: time.Unix(stray.OccurredAt, 0).UTC().Format(time.RFC3339),
+		Remote:     apitypes.RemoteEndpoint{IP: stray.RemoteIP, Port: stray.RemotePort},
+		TLS:        stray.TLS,
+		Summary:    stray.Summary,
+	}
+	if stray.Token != nil {
+		sv.Token = *stray.Token
+	}
+	if len(stray.Body) > 0 {
+		sv.Body = base64.StdEncoding.EncodeToString(stray.Body)
+	}
+
+	var details any
+	switch stray.Kind {
+	case "http":
+		sv.HTTP = &apitypes.HTTPRequestV2{}
+		details = sv.HTTP
+	case "dns":
+		sv.DNS = &apitypes.DNSQueryV2{}
+		details = sv.DNS
+	default:
+		details = &sv.Fields
+	}
+	if err := json.Unmarshal([]byte(stray.Details), details); err != nil {
+		s.Logger.Warn("failed to parse stored stray interaction details",
+			zap.Int64("stray_id", stray.ID),
+			zap.Error(err))
+		sv.HTTP, sv.DNS, sv.Fields = nil, nil, nil
+	}
+	if sv.HTTP != nil {
+		sv.HTTP.Body = sv.Body
+		sv.Body = ""
+	}
+	return sv
+}
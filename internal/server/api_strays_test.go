@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+func TestListStraysV2(t *testing.T) {
+	srv, fullKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	adminKey := createAdminKey(t, srv)
+
+	token := "unknown"
+	strays := []models.StrayInteraction{
+		{Kind: "http", OccurredAt: 1000, RemoteIP: "192.0.2.1", RemotePort: 40000, Summary: "POST /login HTTP/1.1",
+			Details: `{"method":"POST","host":"example.com","path":"/login","headers":{"User-Agent":["scanner"]}}`, Body: []byte("user=admin")},
+		{Kind: "dns", OccurredAt: 2000, RemoteIP: "192.0.2.2", RemotePort: 53, Token: &token, Summary: "A unknown.example.com udp",
+			Details: `{"qname":"unknown.example.com","qtype":1,"qclass":1,"rd":true,"opcode":0,"dns_id":7,"protocol":"udp"}`},
+	}
+	for _, s := range strays {
+		if _, err := srv.Store.CreateStrayInteraction(s); err != nil {
+			t.Fatalf("create stray interaction: %v", err)
+		}
+	}
+
+	// Strays belong to no tenant, so tenant keys cannot list them.
+	if code := getV2(t, srv, fullKey, "/v2/strays", nil); code != http.StatusForbidden {
+		t.Errorf("full-scope key: expected status 403, got %d", code)
+	}
+
+	var resp apitypes.ListStrayInteractionsV2Response
+	if code := getV2(t, srv, adminKey, "/v2/strays?limit=1", &resp); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if len(resp.Data) != 1 || !resp.Pagination.HasMore {
+		t.Fatalf("first page = %+v, want one stray interaction and more to follow", resp)
+	}
+	dns := resp.Data[0]
+	if dns.Token != token || dns.DNS == nil || dns.DNS.QName != "unknown.example.com" || !dns.DNS.RD || dns.HTTP != nil {
+		t.Errorf("dns stray interaction = %+v", dns)
+	}
+
+	resp = apitypes.ListStrayInteractionsV2Response{}
+	if code := getV2(t, srv, adminKey, "/v2/strays?kind=http", &resp); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+	if len(resp.Data) != 1 || resp.Pagination.HasMore {
+		t.Fatalf("http page = %+v, want one stray interaction", resp)
+	}
+	h := resp.Data[0]
+	if h.Token != "" || h.HTTP == nil || h.HTTP.Path != "/login" || h.HTTP.Headers["User-Agent"][0] != "scanner" {
+		t.Errorf("http stray interaction = %+v", h)
+	}
+	if h.HTTP != nil && h.HTTP.Body != base64.StdEncoding.EncodeToString([]byte("user=admin")) {
+		t.Errorf("http stray body = %q", h.HTTP.Body)
+	}
+
+	if code := getV2(t, srv, adminKey, "/v2/strays?attr.geo.country=GB", nil); code != http.StatusBadRequest {
+		t.Errorf("attribute filter: expected status 400, got %d", code)
+	}
+}
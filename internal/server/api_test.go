@@ -1,19 +1,34 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/rsclarke/oastrix/internal/apitypes"
 	"github.com/rsclarke/oastrix/internal/auth"
 	"github.com/rsclarke/oastrix/internal/db"
 	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/core/stream"
+	"github.com/rsclarke/oastrix/internal/token"
+	"github.com/rsclarke/oastrix/pkg/events"
+	"go.uber.org/zap"
 )
 
+var testPepper = []byte("test-pepper")
+
 func setupTestAPIServer(t *testing.T) (*APIServer, string, func()) {
 	t.Helper()
 
@@ -29,14 +44,14 @@ func setupTestAPIServer(t *testing.T) (*APIServer, string, func()) {
 		t.Fatalf("open database: %v", err)
 	}
 
-	displayKey, prefix, hash, err := auth.GenerateAPIKey()
+	displayKey, prefix, hash, err := auth.GenerateAPIKey(testPepper)
 	if err != nil {
 		_ = database.Close()
 		_ = os.Remove(tmpFile.Name())
 		t.Fatalf("generate API key: %v", err)
 	}
 
-	_, err = db.CreateAPIKey(database, prefix, hash)
+	_, err = db.CreateAPIKey(database, prefix, hash, string(auth.ScopeFull), nil)
 	if err != nil {
 		_ = database.Close()
 		_ = os.Remove(tmpFile.Name())
@@ -44,8 +59,10 @@ func setupTestAPIServer(t *testing.T) (*APIServer, string, func()) {
 	}
 
 	srv := &APIServer{
-		DB:     database,
+		Store:  db.NewSQLite(database),
 		Domain: "oastrix.example.com",
+		Logger: zap.NewNop(),
+		Pepper: testPepper,
 	}
 
 	cleanup := func() {
@@ -296,11 +313,11 @@ func TestTokenOwnership_CannotAccessOtherKeysToken(t *testing.T) {
 	tokenValue := createResp.Token
 
 	// Create a second API key
-	displayKey2, prefix2, hash2, err := auth.GenerateAPIKey()
+	displayKey2, prefix2, hash2, err := auth.GenerateAPIKey(testPepper)
 	if err != nil {
 		t.Fatalf("generate second API key: %v", err)
 	}
-	_, err = db.CreateAPIKey(srv.DB, prefix2, hash2)
+	_, err = srv.Store.CreateAPIKey(prefix2, hash2, string(auth.ScopeFull), nil)
 	if err != nil {
 		t.Fatalf("create second API key: %v", err)
 	}
@@ -432,3 +449,979 @@ func TestListPlugins_WithRegistry(t *testing.T) {
 		t.Error("expected second plugin to have config")
 	}
 }
+
+func TestPurgeTokenInteractions(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	createReq := httptest.NewRequest("POST", "/v1/tokens", nil)
+	createReq.Header.Set("Authorization", "Bearer "+displayKey)
+	createW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(createW, createReq)
+
+	var createResp apitypes.CreateTokenResponse
+	if err := json.NewDecoder(createW.Body).Decode(&createResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	tok, err := srv.Store.GetTokenByValue(createResp.Token)
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+	if _, err := srv.Store.(*db.SQLite).DB.Exec("INSERT INTO interactions (token_id, kind, occurred_at, remote_ip, remote_port, summary) VALUES (?, 'dns', 1000, '127.0.0.1', 0, 'old')", tok.ID); err != nil {
+		t.Fatalf("insert interaction: %v", err)
+	}
+	if _, err := srv.Store.CreateInteraction(tok.ID, "http", "127.0.0.1", 1234, false, "recent"); err != nil {
+		t.Fatalf("create interaction: %v", err)
+	}
+
+	body := bytes.NewBufferString(`{"older_than": "24h"}`)
+	req := httptest.NewRequest("POST", "/v1/tokens/"+createResp.Token+"/interactions/purge", body)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp apitypes.PurgeInteractionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Deleted != 1 {
+		t.Errorf("expected 1 deleted, got %d", resp.Deleted)
+	}
+}
+
+func TestPurgeInteractions_InvalidRequest(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"empty", `{}`},
+		{"both set", `{"older_than": "1h", "before": "2024-01-01T00:00:00Z"}`},
+		{"bad duration", `{"older_than": "soon"}`},
+		{"bad timestamp", `{"before": "yesterday"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/interactions/purge", bytes.NewBufferString(tt.body))
+			req.Header.Set("Authorization", "Bearer "+displayKey)
+			w := httptest.NewRecorder()
+
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestPurgeServerInteractions(t *testing.T) {
+	srv, fullKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	adminKey := createAdminKey(t, srv)
+
+	// Tokens of two different keys, and one created by the server.
+	var tokenIDs []int64
+	for _, key := range []string{fullKey, adminKey} {
+		req := httptest.NewRequest("POST", "/v1/tokens", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		var resp apitypes.CreateTokenResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		tok, err := srv.Store.GetTokenByValue(resp.Token)
+		if err != nil || tok == nil {
+			t.Fatalf("get token: %v", err)
+		}
+		tokenIDs = append(tokenIDs, tok.ID)
+	}
+	ownerless, err := srv.Store.CreateToken("ownerless", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	for _, id := range append(tokenIDs, ownerless) {
+		if _, err := srv.Store.(*db.SQLite).DB.Exec("INSERT INTO interactions (token_id, kind, occurred_at, remote_ip, remote_port, summary) VALUES (?, 'dns', 1000, '127.0.0.1', 0, 'old')", id); err != nil {
+			t.Fatalf("insert interaction: %v", err)
+		}
+	}
+
+	purge := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v2/admin/interactions/purge", bytes.NewBufferString(`{"older_than": "24h"}`))
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+	if w := purge(fullKey); w.Code != http.StatusForbidden {
+		t.Errorf("full-scope key: expected status 403, got %d", w.Code)
+	}
+
+	w := purge(adminKey)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp apitypes.PurgeInteractionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Deleted != 3 {
+		t.Errorf("expected 3 deleted, got %d", resp.Deleted)
+	}
+}
+
+func TestStreamInteractions_NotEnabled(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/v1/tokens/abc123/interactions/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", w.Code)
+	}
+}
+
+func TestStreamInteractions(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	broker := stream.New()
+	_ = broker.Init(plugins.InitContext{Logger: zap.NewNop()})
+	srv.Stream = broker
+
+	createReq := httptest.NewRequest("POST", "/v1/tokens", nil)
+	createReq.Header.Set("Authorization", "Bearer "+displayKey)
+	createW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(createW, createReq)
+
+	var createResp apitypes.CreateTokenResponse
+	if err := json.NewDecoder(createW.Body).Decode(&createResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	tok, err := srv.Store.GetTokenByValue(createResp.Token)
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/v1/tokens/"+createResp.Token+"/interactions/stream", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", ct)
+	}
+
+	id, err := srv.Store.CreateInteraction(tok.ID, "http", "127.0.0.1", 1234, false, "GET / HTTP/1.1")
+	if err != nil {
+		t.Fatalf("create interaction: %v", err)
+	}
+	e := &events.Event{Draft: &events.InteractionDraft{TokenID: tok.ID}, InteractionID: id}
+	if err := broker.OnPostStore(ctx, e); err != nil {
+		t.Fatalf("OnPostStore: %v", err)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	var data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data: ") {
+			data = strings.TrimPrefix(line, "data: ")
+			break
+		}
+	}
+	if data == "" {
+		t.Fatalf("no event received: %v", scanner.Err())
+	}
+
+	var ir apitypes.InteractionResponse
+	if err := json.Unmarshal([]byte(data), &ir); err != nil {
+		t.Fatalf("decode event: %v", err)
+	}
+	if ir.ID != id {
+		t.Errorf("expected interaction %d, got %d", id, ir.ID)
+	}
+
+	srv.CloseStreams()
+	for scanner.Scan() {
+	}
+	if err := scanner.Err(); err != nil {
+		t.Errorf("stream did not end after CloseStreams: %v", err)
+	}
+}
+
+func TestGetInteractions_SinceID(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	createReq := httptest.NewRequest("POST", "/v1/tokens", nil)
+	createReq.Header.Set("Authorization", "Bearer "+displayKey)
+	createW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(createW, createReq)
+
+	var createResp apitypes.CreateTokenResponse
+	if err := json.NewDecoder(createW.Body).Decode(&createResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	tok, err := srv.Store.GetTokenByValue(createResp.Token)
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+
+	first, err := srv.Store.CreateInteraction(tok.ID, "dns", "127.0.0.1", 53, false, "first")
+	if err != nil {
+		t.Fatalf("create interaction: %v", err)
+	}
+	second, err := srv.Store.CreateInteraction(tok.ID, "dns", "127.0.0.1", 53, false, "second")
+	if err != nil {
+		t.Fatalf("create interaction: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/v1/tokens/%s/interactions?since_id=%d", createResp.Token, first), nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp apitypes.GetInteractionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Interactions) != 1 || resp.Interactions[0].ID != second {
+		t.Errorf("expected only interaction %d, got %+v", second, resp.Interactions)
+	}
+}
+
+func TestGetInteractions_AttributeFilter(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	createReq := httptest.NewRequest("POST", "/v1/tokens", nil)
+	createReq.Header.Set("Authorization", "Bearer "+displayKey)
+	createW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(createW, createReq)
+
+	var createResp apitypes.CreateTokenResponse
+	if err := json.NewDecoder(createW.Body).Decode(&createResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	tok, err := srv.Store.GetTokenByValue(createResp.Token)
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+
+	var ids []int64
+	for _, country := range []string{"GB", "US"} {
+		id, err := srv.Store.CreateInteraction(tok.ID, "dns", "127.0.0.1", 53, false, country)
+		if err != nil {
+			t.Fatalf("create interaction: %v", err)
+		}
+		if err := srv.Store.SaveAttributes(id, map[string]any{"geo.country": country}); err != nil {
+			t.Fatalf("save attributes: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	req := httptest.NewRequest("GET", "/v1/tokens/"+createResp.Token+"/interactions?attr.geo.country=US", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp apitypes.GetInteractionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Interactions) != 1 || resp.Interactions[0].ID != ids[1] {
+		t.Errorf("expected only interaction %d, got %+v", ids[1], resp.Interactions)
+	}
+
+	req = httptest.NewRequest("GET", "/v1/tokens/"+createResp.Token+"/interactions?attr.=x", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("empty attribute key: expected status 400, got %d", w.Code)
+	}
+}
+
+func TestGetInteractions_InvalidSinceID(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	createReq := httptest.NewRequest("POST", "/v1/tokens", nil)
+	createReq.Header.Set("Authorization", "Bearer "+displayKey)
+	createW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(createW, createReq)
+
+	var createResp apitypes.CreateTokenResponse
+	if err := json.NewDecoder(createW.Body).Decode(&createResp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/v1/tokens/"+createResp.Token+"/interactions?since_id=abc", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestReadScope_CannotModify(t *testing.T) {
+	srv, _, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	readKey, prefix, hash, err := auth.GenerateAPIKey(testPepper)
+	if err != nil {
+		t.Fatalf("generate API key: %v", err)
+	}
+	if _, err := srv.Store.CreateAPIKey(prefix, hash, string(auth.ScopeRead), nil); err != nil {
+		t.Fatalf("create API key: %v", err)
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		want   int
+	}{
+		{"GET", "/v1/tokens", http.StatusOK},
+		{"GET", "/v1/plugins", http.StatusOK},
+		{"POST", "/v1/tokens", http.StatusForbidden},
+		{"DELETE", "/v1/tokens/abc123", http.StatusForbidden},
+		{"POST", "/v1/interactions/purge", http.StatusForbidden},
+		{"PUT", "/v1/plugins/geoip/config", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+readKey)
+			w := httptest.NewRecorder()
+
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_IPAllowlist(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	prefix, _, _ := auth.ParseAPIKey(displayKey)
+	key, err := srv.Store.GetAPIKeyByPrefix(prefix)
+	if err != nil || key == nil {
+		t.Fatalf("get API key: %v", err)
+	}
+	if err := srv.Store.SetAPIKeyAllowlist(key.ID, []string{"10.0.0.0/8"}); err != nil {
+		t.Fatalf("set allowlist: %v", err)
+	}
+
+	tests := []struct {
+		remoteAddr string
+		want       int
+	}{
+		{"10.1.2.3:4567", http.StatusOK},
+		{"192.0.2.1:4567", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/tokens", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("Authorization", "Bearer "+displayKey)
+			w := httptest.NewRecorder()
+
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_RecordsKeyUsage(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/v1/tokens", nil)
+	req.RemoteAddr = "192.0.2.10:5555"
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	prefix, _, _ := auth.ParseAPIKey(displayKey)
+	key, err := srv.Store.GetAPIKeyByPrefix(prefix)
+	if err != nil || key == nil {
+		t.Fatalf("get API key: %v", err)
+	}
+	if key.LastUsedAt == nil {
+		t.Fatal("expected LastUsedAt to be set")
+	}
+	if key.LastUsedIP == nil || *key.LastUsedIP != "192.0.2.10" {
+		t.Errorf("LastUsedIP = %v, want 192.0.2.10", key.LastUsedIP)
+	}
+
+	// A second request within the throttle window does not rewrite the record.
+	req = httptest.NewRequest("GET", "/v1/tokens", nil)
+	req.RemoteAddr = "198.51.100.20:5555"
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	key, err = srv.Store.GetAPIKeyByPrefix(prefix)
+	if err != nil || key == nil {
+		t.Fatalf("get API key: %v", err)
+	}
+	if key.LastUsedIP == nil || *key.LastUsedIP != "192.0.2.10" {
+		t.Errorf("LastUsedIP = %v, want unchanged 192.0.2.10", key.LastUsedIP)
+	}
+}
+
+func TestAuthMiddleware_UpgradesLegacyHash(t *testing.T) {
+	srv, _, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	legacyKey := "oastrix_legacy123456_somesecretvalue123"
+	_, err := srv.Store.(*db.SQLite).DB.Exec(
+		"INSERT INTO api_keys (key_prefix, key_hash, scope, created_at) VALUES (?, ?, 'full', 0)",
+		"legacy123456", auth.LegacyHashSecret("somesecretvalue123"),
+	)
+	if err != nil {
+		t.Fatalf("insert legacy key: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/v1/tokens", nil)
+		req.Header.Set("Authorization", "Bearer "+legacyKey)
+		w := httptest.NewRecorder()
+
+		srv.Handler().ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status 200, got %d", i, w.Code)
+		}
+	}
+
+	key, err := srv.Store.GetAPIKeyByPrefix("legacy123456")
+	if err != nil || key == nil {
+		t.Fatalf("get API key: %v", err)
+	}
+	if key.HashVersion != auth.HashVersionHMAC {
+		t.Errorf("HashVersion = %d, want %d", key.HashVersion, auth.HashVersionHMAC)
+	}
+	if !auth.VerifyAPIKey(legacyKey, key.KeyHash, testPepper) {
+		t.Error("upgraded hash does not verify with the pepper")
+	}
+}
+
+func TestAuthMiddleware_ClientCertificate(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	prefix, _, _ := auth.ParseAPIKey(displayKey)
+	key, err := srv.Store.GetAPIKeyByPrefix(prefix)
+	if err != nil || key == nil {
+		t.Fatalf("get API key: %v", err)
+	}
+	subject := "alice"
+	if err := srv.Store.SetAPIKeyClientCert(key.ID, &subject); err != nil {
+		t.Fatalf("bind client cert: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		tlsState *tls.ConnectionState
+		want     int
+	}{
+		{"bound certificate", clientCertState("alice"), http.StatusOK},
+		{"unbound certificate", clientCertState("mallory"), http.StatusUnauthorized},
+		{"no certificate", &tls.ConnectionState{}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/v1/tokens", nil)
+			req.TLS = tt.tlsState
+			w := httptest.NewRecorder()
+
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func clientCertState(commonName string) *tls.ConnectionState {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+	return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+}
+
+func TestAuthMiddleware_RateLimit(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	srv.Limiter = NewRateLimiter(1, 2)
+
+	tests := []struct {
+		name string
+		auth string
+		want []int
+	}{
+		{"authenticated", "Bearer " + displayKey, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}},
+		{"unauthenticated", "", []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, want := range tt.want {
+				req := httptest.NewRequest("GET", "/v1/tokens", nil)
+				if tt.auth != "" {
+					req.Header.Set("Authorization", tt.auth)
+				}
+				w := httptest.NewRecorder()
+
+				srv.Handler().ServeHTTP(w, req)
+
+				if w.Code != want {
+					t.Fatalf("request %d: expected status %d, got %d", i, want, w.Code)
+				}
+				if want == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+					t.Errorf("request %d: missing Retry-After header", i)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateToken_Expiry(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantExpiry bool
+	}{
+		{"none", `{}`, http.StatusOK, false},
+		{"ttl", `{"ttl":"1h"}`, http.StatusOK, true},
+		{"expires_at", `{"expires_at":"` + time.Now().Add(time.Hour).UTC().Format(time.RFC3339) + `"}`, http.StatusOK, true},
+		{"both", `{"ttl":"1h","expires_at":"2099-01-01T00:00:00Z"}`, http.StatusBadRequest, false},
+		{"past", `{"expires_at":"2000-01-01T00:00:00Z"}`, http.StatusBadRequest, false},
+		{"negative ttl", `{"ttl":"-1h"}`, http.StatusBadRequest, false},
+		{"bad ttl", `{"ttl":"soon"}`, http.StatusBadRequest, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/tokens", strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+displayKey)
+			w := httptest.NewRecorder()
+
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var resp apitypes.CreateTokenResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if (resp.ExpiresAt != nil) != tt.wantExpiry {
+				t.Errorf("expires_at = %v, want set %v", resp.ExpiresAt, tt.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestListTokens_FlagsExpired(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	prefix, _, _ := auth.ParseAPIKey(displayKey)
+	key, err := srv.Store.GetAPIKeyByPrefix(prefix)
+	if err != nil || key == nil {
+		t.Fatalf("get API key: %v", err)
+	}
+	past := time.Now().Add(-time.Minute).Unix()
+	if _, err := srv.Store.CreateToken("expiredtoken", &key.ID, nil, &past); err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/v1/tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	var resp apitypes.ListTokensResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Tokens) != 1 {
+		t.Fatalf("expected 1 token, got %d", len(resp.Tokens))
+	}
+	if !resp.Tokens[0].Expired || resp.Tokens[0].ExpiresAt == nil {
+		t.Errorf("expected token flagged as expired, got %+v", resp.Tokens[0])
+	}
+}
+
+func TestUpdateToken(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	createReq := httptest.NewRequest("POST", "/v1/tokens", strings.NewReader(`{"label":"typo"}`))
+	createReq.Header.Set("Authorization", "Bearer "+displayKey)
+	createW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(createW, createReq)
+
+	var created apitypes.CreateTokenResponse
+	if err := json.NewDecoder(createW.Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantLabel  string
+		wantExpiry bool
+	}{
+		{"label", `{"label":"fixed"}`, http.StatusOK, "fixed", false},
+		{"ttl keeps label", `{"ttl":"1h"}`, http.StatusOK, "fixed", true},
+		{"clear expiry", `{"expires_at":""}`, http.StatusOK, "fixed", false},
+		{"clear label", `{"label":""}`, http.StatusOK, "", false},
+		{"both", `{"ttl":"1h","expires_at":"2099-01-01T00:00:00Z"}`, http.StatusBadRequest, "", false},
+		{"clear and ttl", `{"ttl":"1h","expires_at":""}`, http.StatusBadRequest, "", false},
+		{"bad ttl", `{"ttl":"soon"}`, http.StatusBadRequest, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", "/v1/tokens/"+created.Token, strings.NewReader(tt.body))
+			req.Header.Set("Authorization", "Bearer "+displayKey)
+			w := httptest.NewRecorder()
+
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			var info apitypes.TokenInfo
+			if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if info.Token != created.Token {
+				t.Errorf("token = %q, want %q", info.Token, created.Token)
+			}
+			gotLabel := ""
+			if info.Label != nil {
+				gotLabel = *info.Label
+			}
+			if gotLabel != tt.wantLabel {
+				t.Errorf("label = %q, want %q", gotLabel, tt.wantLabel)
+			}
+			if (info.ExpiresAt != nil) != tt.wantExpiry {
+				t.Errorf("expires_at = %v, want set %v", info.ExpiresAt, tt.wantExpiry)
+			}
+		})
+	}
+}
+
+func TestUpdateToken_OtherKeysToken(t *testing.T) {
+	srv, displayKey1, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	createReq := httptest.NewRequest("POST", "/v1/tokens", nil)
+	createReq.Header.Set("Authorization", "Bearer "+displayKey1)
+	createW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(createW, createReq)
+
+	var created apitypes.CreateTokenResponse
+	if err := json.NewDecoder(createW.Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	displayKey2, prefix2, hash2, err := auth.GenerateAPIKey(testPepper)
+	if err != nil {
+		t.Fatalf("generate second API key: %v", err)
+	}
+	if _, err := srv.Store.CreateAPIKey(prefix2, hash2, string(auth.ScopeFull), nil); err != nil {
+		t.Fatalf("create second API key: %v", err)
+	}
+
+	req := httptest.NewRequest("PATCH", "/v1/tokens/"+created.Token, strings.NewReader(`{"label":"stolen"}`))
+	req.Header.Set("Authorization", "Bearer "+displayKey2)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", w.Code)
+	}
+}
+
+func TestDisableEnableToken(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	createReq := httptest.NewRequest("POST", "/v1/tokens", nil)
+	createReq.Header.Set("Authorization", "Bearer "+displayKey)
+	createW := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(createW, createReq)
+
+	var created apitypes.CreateTokenResponse
+	if err := json.NewDecoder(createW.Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	for _, tt := range []struct {
+		action      string
+		wantEnabled bool
+	}{
+		{"disable", false},
+		{"enable", true},
+	} {
+		req := httptest.NewRequest("POST", "/v1/tokens/"+created.Token+"/"+tt.action, nil)
+		req.Header.Set("Authorization", "Bearer "+displayKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", tt.action, w.Code)
+		}
+		var info apitypes.TokenInfo
+		if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if info.Enabled != tt.wantEnabled {
+			t.Errorf("%s: enabled = %v, want %v", tt.action, info.Enabled, tt.wantEnabled)
+		}
+
+		tok, err := srv.Store.GetTokenByValue(created.Token)
+		if err != nil || tok == nil {
+			t.Fatalf("get token: %v", err)
+		}
+		if tok.Enabled != tt.wantEnabled {
+			t.Errorf("%s: stored enabled = %v, want %v", tt.action, tok.Enabled, tt.wantEnabled)
+		}
+	}
+}
+
+func TestTokenTags(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+displayKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+	create := func(body string) string {
+		t.Helper()
+		w := do("POST", "/v1/tokens", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("create token: status %d: %s", w.Code, w.Body.String())
+		}
+		var resp apitypes.CreateTokenResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp.Token
+	}
+	list := func(query string) []string {
+		t.Helper()
+		w := do("GET", "/v1/tokens"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("list tokens: status %d: %s", w.Code, w.Body.String())
+		}
+		var resp apitypes.ListTokensResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		var got []string
+		for _, tok := range resp.Tokens {
+			got = append(got, tok.Token)
+		}
+		slices.Sort(got)
+		return got
+	}
+	sorted := func(s ...string) []string {
+		slices.Sort(s)
+		return s
+	}
+
+	a := create(`{"label":"Login form","tags":["Acme","xss","acme"]}`)
+	b := create(`{"label":"Search","tags":["acme"]}`)
+
+	if got := list("?tag=acme"); !slices.Equal(got, sorted(a, b)) {
+		t.Errorf("tag=acme: got %v", got)
+	}
+	if got := list("?tag=acme&tag=XSS"); !slices.Equal(got, []string{a}) {
+		t.Errorf("tag=acme&tag=XSS: got %v", got)
+	}
+	if got := list("?label=login"); !slices.Equal(got, []string{a}) {
+		t.Errorf("label=login: got %v", got)
+	}
+
+	w := do("PATCH", "/v1/tokens/"+b, `{"tags":["sqli"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update tags: status %d: %s", w.Code, w.Body.String())
+	}
+	var info apitypes.TokenInfo
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !slices.Equal(info.Tags, []string{"sqli"}) {
+		t.Errorf("tags after update = %v, want [sqli]", info.Tags)
+	}
+	if got := list("?tag=acme"); !slices.Equal(got, []string{a}) {
+		t.Errorf("tag=acme after update: got %v", got)
+	}
+
+	for _, body := range []string{`{"tags":["has space"]}`, `{"tags":["-leading"]}`, `{"tags":[""]}`} {
+		if w := do("POST", "/v1/tokens", body); w.Code != http.StatusBadRequest {
+			t.Errorf("create with %s: expected status 400, got %d", body, w.Code)
+		}
+	}
+	if w := do("PATCH", "/v1/tokens/"+a, `{"label":"changed","tags":["bad tag"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("update with bad tag: expected status 400, got %d", w.Code)
+	}
+	if got := list("?label=changed"); len(got) != 0 {
+		t.Errorf("rejected update changed the label: %v", got)
+	}
+}
+
+func TestCreateToken_Format(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	srv.Tokens = token.Format{UUID: true}
+
+	req := httptest.NewRequest("POST", "/v1/tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp apitypes.CreateTokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Token) != 36 || strings.Count(resp.Token, "-") != 4 {
+		t.Errorf("token %q is not a UUID", resp.Token)
+	}
+	if got := extractTokenFromQName(resp.Token+".oastrix.example.com", "oastrix.example.com"); got != resp.Token {
+		t.Errorf("token extracted from DNS name = %q, want %q", got, resp.Token)
+	}
+}
+
+func TestSetTokenAliases(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+displayKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+	create := func() string {
+		t.Helper()
+		var resp apitypes.CreateTokenResponse
+		if err := json.NewDecoder(do("POST", "/v1/tokens", "").Body).Decode(&resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		return resp.Token
+	}
+	a, b := create(), create()
+
+	w := do("PUT", "/v1/tokens/"+a+"/aliases", `{"aliases":["IMG-CDN","static","img-cdn"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var info apitypes.TokenInfo
+	if err := json.NewDecoder(w.Body).Decode(&info); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !slices.Equal(info.Aliases, []string{"img-cdn", "static"}) {
+		t.Errorf("aliases = %v, want [img-cdn static]", info.Aliases)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{"other token's alias", `{"aliases":["static"]}`, http.StatusConflict},
+		{"token value", `{"aliases":["` + a + `"]}`, http.StatusConflict},
+		{"underscore", `{"aliases":["img_cdn"]}`, http.StatusBadRequest},
+		{"leading hyphen", `{"aliases":["-cdn"]}`, http.StatusBadRequest},
+		{"nameserver", `{"aliases":["ns1"]}`, http.StatusBadRequest},
+		{"api host", `{"aliases":["api"]}`, http.StatusBadRequest},
+		{"too long", `{"aliases":["` + strings.Repeat("a", 64) + `"]}`, http.StatusBadRequest},
+		{"clear", `{"aliases":[]}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := do("PUT", "/v1/tokens/"+b+"/aliases", tt.body); w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
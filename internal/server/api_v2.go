@@ -0,0 +1,321 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/auth"
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/pkg/models"
+	"go.uber.org/zap"
+)
+
+// Page size bounds for paginated v2 list endpoints.
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+var apiV2Routes = []route{
+	{
+		method: "GET", path: "/v2/tokens/{token}/interactions", scope: auth.ScopeRead,
+		handler: (*APIServer).handleListInteractionsV2, summary: "List interactions for a token, newest first",
+		query: []queryParam{
+			{"limit", "integer", "", "Maximum interactions per page (default 100, max 1000)."},
+			{"cursor", "string", "", "Opaque cursor from a previous page's next_cursor."},
+			{"since", "string", "date-time", "Only return interactions at or after this RFC 3339 time."},
+			attributeFilterParam,
+		},
+		response: apitypes.ListInteractionsV2Response{},
+	},
+	{
+		method: "GET", path: "/v2/tokens/{token}/interactions/{id}", scope: auth.ScopeRead,
+		handler: (*APIServer).handleGetInteractionV2, summary: "Get a single interaction",
+		response: apitypes.InteractionV2{},
+	},
+	{
+		method: "GET", path: "/v2/strays", scope: auth.ScopeAdmin,
+		handler: (*APIServer).handleListStraysV2, summary: "List traffic recorded in honeypot mode that matched no token, newest first",
+		query: []queryParam{
+			{"limit", "integer", "", "Maximum stray interactions per page (default 100, max 1000)."},
+			{"cursor", "string", "", "Opaque cursor from a previous page's next_cursor."},
+			{"since", "string", "date-time", "Only return stray interactions at or after this RFC 3339 time."},
+			{"kind", "string", "", "Only return stray interactions of this kind, e.g. http or dns."},
+		},
+		response: apitypes.ListStrayInteractionsV2Response{},
+	},
+	{
+		method: "POST", path: "/v2/tokens/{token}/collaborator", scope: auth.ScopeFull,
+		handler: (*APIServer).handleCreateCollaboratorSessionV2, summary: "Bind a token to the Burp Collaborator biid that may poll it",
+		request: apitypes.CreateCollaboratorSessionRequest{}, response: apitypes.CreateCollaboratorSessionResponse{},
+	},
+	{
+		method: "DELETE", path: "/v2/tokens/{token}/collaborator", scope: auth.ScopeFull,
+		handler: (*APIServer).handleDeleteCollaboratorSessionV2, summary: "Unbind a token from the Burp Collaborator biid polling it",
+		response: apitypes.DeleteCollaboratorSessionResponse{},
+	},
+	{
+		method: "POST", path: "/v2/admin/interactions/purge", scope: auth.ScopeAdmin,
+		handler: (*APIServer).handlePurgeAllInteractions, summary: "Purge old interactions across every token on the server",
+		request: apitypes.PurgeInteractionsRequest{}, response: apitypes.PurgeInteractionsResponse{},
+	},
+	{
+		method: "GET", path: logLevelsPath, scope: auth.ScopeAdmin,
+		handler: (*APIServer).handleGetLogLevelsV2, summary: "Get the server's log levels",
+		response: apitypes.LogLevels{},
+	},
+	{
+		method: "PUT", path: logLevelsPath, scope: auth.ScopeAdmin,
+		handler: (*APIServer).handleSetLogLevelsV2, summary: "Change the server's log levels until it restarts",
+		request: apitypes.LogLevels{}, response: apitypes.LogLevels{},
+	},
+}
+
+func (s *APIServer) handleListInteractionsV2(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+
+	filter, ok := parsePageFilter(w, r)
+	if !ok {
+		return
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	limit := filter.Limit
+	filter.Limit++
+	interactions, err := s.Store.ListInteractionDetails(tok.ID, filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+
+	resp := apitypes.ListInteractionsV2Response{
+		Data:       make([]apitypes.InteractionV2, 0, min(len(interactions), limit)),
+		Pagination: apitypes.Pagination{Limit: limit},
+	}
+	if len(interactions) > limit {
+		interactions = interactions[:limit]
+		resp.Pagination.HasMore = true
+		last := interactions[limit-1]
+		resp.Pagination.NextCursor = encodeCursor(db.Cursor{OccurredAt: last.OccurredAt, ID: last.ID})
+	}
+	for _, i := range interactions {
+		resp.Data = append(resp.Data, s.interactionV2(tok, i))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *APIServer) handleGetInteractionV2(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid interaction id"})
+		return
+	}
+
+	i, err := s.Store.GetInteraction(id)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	if i == nil || i.TokenID != tok.ID {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "interaction not found"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.interactionV2(tok, s.interactionDetails(*i)))
+}
+
+// parsePageFilter reads the limit, cursor, since and attr.<key> query
+// parameters.
+// On failure an error response has already been written.
+func parsePageFilter(w http.ResponseWriter, r *http.Request) (db.InteractionFilter, bool) {
+	f := db.InteractionFilter{Limit: defaultPageLimit}
+	q := r.URL.Query()
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid limit"})
+			return f, false
+		}
+		f.Limit = limit
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		c, ok := decodeCursor(v)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid cursor"})
+			return f, false
+		}
+		f.After = &c
+	}
+
+	if v := q.Get("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid since timestamp"})
+			return f, false
+		}
+		f.Since = since.Unix()
+	}
+
+	return f, parseAttributeFilter(w, r, &f)
+}
+
+// encodeCursor returns an opaque cursor resuming after the interaction at c.
+// Clients must not rely on its format.
+func encodeCursor(c db.Cursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.OccurredAt, 10) + "." + strconv.FormatInt(c.ID, 10)))
+}
+
+func decodeCursor(cursor string) (db.Cursor, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return db.Cursor{}, false
+	}
+	occurredAt, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return db.Cursor{}, false
+	}
+	var c db.Cursor
+	c.OccurredAt, err = strconv.ParseInt(occurredAt, 10, 64)
+	if err != nil {
+		return db.Cursor{}, false
+	}
+	c.ID, err = strconv.ParseInt(id, 10, 64)
+	if err != nil || c.ID <= 0 {
+		return db.Cursor{}, false
+	}
+	return c, true
+}
+
+// interactionV2 converts a stored interaction into its v2 representation.
+func (s *APIServer) interactionV2(tok *models.Token, i models.InteractionDetails) apitypes.InteractionV2 {
+	iv := apitypes.InteractionV2{
+		ID:         i.ID,
+		Token:      tok.Token,
+		Kind:       i.Kind,
+		OccurredAt: time.Unix(i.OccurredAt, 0).UTC().Format(time.RFC3339),
+		Remote:     apitypes.RemoteEndpoint{IP: i.RemoteIP, Port: i.RemotePort},
+		TLS:        i.TLS,
+		Summary:    i.Summary,
+	}
+
+	iv.Attributes = i.Attributes
+	if iv.Attributes == nil {
+		iv.Attributes = make(map[string]any)
+	}
+	if i.HTTP != nil {
+		iv.HTTP = s.httpDetailV2(i.HTTP)
+	}
+	if i.DNS != nil {
+		iv.DNS = s.dnsDetailV2(i.DNS)
+	}
+
+	return iv
+}
+
+func (s *APIServer) httpDetailV2(h *models.HTTPInteraction) *apitypes.HTTPDetailV2 {
+	headers := make(map[string][]string)
+	if err := json.Unmarshal([]byte(h.RequestHeaders), &headers); err != nil {
+		s.Logger.Warn("failed to parse stored request headers",
+			zap.Int64("interaction_id", h.InteractionID),
+			zap.Error(err))
+	}
+
+	detail := &apitypes.HTTPDetailV2{
+		Request: apitypes.HTTPRequestV2{
+			Method:  h.Method,
+			Scheme:  h.Scheme,
+			Host:    h.Host,
+			Path:    h.Path,
+			Query:   h.Query,
+			Proto:   h.HTTPVersion,
+			Headers: headers,
+			Body:    base64.StdEncoding.EncodeToString(h.RequestBody),
+		},
+	}
+
+	detail.Response = s.httpResponseV2(h)
+	return detail
+}
+
+// httpResponseV2 returns the recorded response of an HTTP interaction, or nil
+// if none was.
+func (s *APIServer) httpResponseV2(h *models.HTTPInteraction) *apitypes.HTTPResponseV2 {
+	if h.ResponseStatus == nil {
+		return nil
+	}
+	respHeaders := make(map[string]string)
+	if h.ResponseHeaders != nil {
+		if err := json.Unmarshal([]byte(*h.ResponseHeaders), &respHeaders); err != nil {
+			s.Logger.Warn("failed to parse stored response headers",
+				zap.Int64("interaction_id", h.InteractionID),
+				zap.Error(err))
+		}
+	}
+	resp := &apitypes.HTTPResponseV2{
+		Status:   *h.ResponseStatus,
+		Headers:  respHeaders,
+		Body:     base64.StdEncoding.EncodeToString(h.ResponseBody),
+		BodySize: len(h.ResponseBody),
+	}
+	// Responses recorded before sizes and hashes were kept were stored whole.
+	if h.ResponseBodySize != nil {
+		resp.BodySize = *h.ResponseBodySize
+	}
+	if h.ResponseBodySHA256 != nil {
+		resp.BodySHA256 = *h.ResponseBodySHA256
+	}
+	return resp
+}
+
+func (s *APIServer) dnsDetailV2(d *models.DNSInteraction) *apitypes.DNSDetailV2 {
+	detail := &apitypes.DNSDetailV2{
+		Query: apitypes.DNSQueryV2{
+			QName:    d.QName,
+			QType:    d.QType,
+			QClass:   d.QClass,
+			RD:       d.RD != 0,
+			Opcode:   d.Opcode,
+			DNSID:    d.DNSID,
+			Protocol: d.Protocol,
+		},
+	}
+
+	detail.Response = s.dnsResponseV2(d)
+	return detail
+}
+
+// dnsResponseV2 returns the recorded response of a DNS interaction, or nil if
+// none was.
+func (s *APIServer) dnsResponseV2(d *models.DNSInteraction) *apitypes.DNSResponseV2 {
+	if d.ResponseRCode == nil {
+		return nil
+	}
+	answers := []string{}
+	if d.ResponseAnswers != nil {
+		if err := json.Unmarshal([]byte(*d.ResponseAnswers), &answers); err != nil {
+			s.Logger.Warn("failed to parse stored response answers",
+				zap.Int64("interaction_id", d.InteractionID),
+				zap.Error(err))
+		}
+	}
+	return &apitypes.DNSResponseV2{
+		RCode:   *d.ResponseRCode,
+		Answers: answers,
+	}
+}
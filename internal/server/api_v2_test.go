@@ -0,0 +1,192 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+)
+
+// createV2TestToken creates a token through the API and records n HTTP
+// interactions against it, returning the token value and interaction IDs in
+// insertion order.
+func createV2TestToken(t *testing.T, srv *APIServer, displayKey string, n int) (string, []int64) {
+	t.Helper()
+
+	req := httptest.NewRequest("POST", "/v1/tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	var created apitypes.CreateTokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	tok, err := srv.Store.GetTokenByValue(created.Token)
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+
+	var ids []int64
+	for i := range n {
+		id, err := srv.Store.CreateInteraction(tok.ID, "http", "192.0.2.1", 40000+i, false, fmt.Sprintf("GET /%d", i))
+		if err != nil {
+			t.Fatalf("create interaction: %v", err)
+		}
+		if err := srv.Store.CreateHTTPInteraction(id, "GET", "http", "example.com", fmt.Sprintf("/%d", i), "", "HTTP/1.1", `{"Accept":["*/*"]}`, nil); err != nil {
+			t.Fatalf("create http interaction: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return created.Token, ids
+}
+
+func getV2(t *testing.T, srv *APIServer, displayKey, path string, out any) int {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", path, nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code == http.StatusOK && out != nil {
+		if err := json.NewDecoder(w.Body).Decode(out); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+	}
+	return w.Code
+}
+
+func TestListInteractionsV2_Pagination(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	tokenValue, ids := createV2TestToken(t, srv, displayKey, 5)
+
+	// An imported interaction keeps its original time but gets the highest
+	// ID, so it is listed last.
+	tok, err := srv.Store.GetTokenByValue(tokenValue)
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+	imported, err := srv.Store.CreateInteractionAt(1000, tok.ID, "dns", "192.0.2.1", 53, false, "imported")
+	if err != nil {
+		t.Fatalf("create interaction: %v", err)
+	}
+	ids = append([]int64{imported}, ids...)
+
+	var seen []int64
+	path := "/v2/tokens/" + tokenValue + "/interactions?limit=2"
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		var resp apitypes.ListInteractionsV2Response
+		if code := getV2(t, srv, displayKey, path, &resp); code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", code)
+		}
+		if resp.Pagination.Limit != 2 {
+			t.Errorf("pagination limit = %d, want 2", resp.Pagination.Limit)
+		}
+		for _, i := range resp.Data {
+			seen = append(seen, i.ID)
+		}
+		if !resp.Pagination.HasMore {
+			if resp.Pagination.NextCursor != "" {
+				t.Errorf("unexpected next_cursor on last page")
+			}
+			break
+		}
+		path = "/v2/tokens/" + tokenValue + "/interactions?limit=2&cursor=" + resp.Pagination.NextCursor
+	}
+
+	if len(seen) != len(ids) {
+		t.Fatalf("got %d interactions across pages, want %d", len(seen), len(ids))
+	}
+	for i, id := range seen {
+		if want := ids[len(ids)-1-i]; id != want {
+			t.Errorf("interaction %d: got ID %d, want %d", i, id, want)
+		}
+	}
+}
+
+func TestListInteractionsV2_InvalidParams(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	tokenValue, _ := createV2TestToken(t, srv, displayKey, 0)
+
+	for _, query := range []string{"limit=0", "limit=1001", "limit=x", "cursor=!!", "since=yesterday"} {
+		t.Run(query, func(t *testing.T) {
+			code := getV2(t, srv, displayKey, "/v2/tokens/"+tokenValue+"/interactions?"+query, nil)
+			if code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", code)
+			}
+		})
+	}
+}
+
+func TestGetInteractionV2_Detail(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	tokenValue, ids := createV2TestToken(t, srv, displayKey, 1)
+	id := ids[0]
+
+	if err := srv.Store.SaveAttributes(id, map[string]any{"geo.country": "GB"}); err != nil {
+		t.Fatalf("save attributes: %v", err)
+	}
+	if err := srv.Store.SetHTTPResponse(id, http.StatusTeapot, `{"X-Test":"1"}`, []byte("short and stout")); err != nil {
+		t.Fatalf("set response: %v", err)
+	}
+
+	var iv apitypes.InteractionV2
+	if code := getV2(t, srv, displayKey, fmt.Sprintf("/v2/tokens/%s/interactions/%d", tokenValue, id), &iv); code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", code)
+	}
+
+	if iv.Token != tokenValue {
+		t.Errorf("token = %q, want %q", iv.Token, tokenValue)
+	}
+	if iv.Remote.IP != "192.0.2.1" || iv.Remote.Port != 40000 {
+		t.Errorf("remote = %+v", iv.Remote)
+	}
+	if iv.Attributes["geo.country"] != "GB" {
+		t.Errorf("attributes = %v", iv.Attributes)
+	}
+	if iv.HTTP == nil {
+		t.Fatal("missing http detail")
+	}
+	if iv.HTTP.Request.Proto != "HTTP/1.1" || iv.HTTP.Request.Path != "/0" {
+		t.Errorf("request = %+v", iv.HTTP.Request)
+	}
+	if iv.HTTP.Response == nil {
+		t.Fatal("missing http response")
+	}
+	if iv.HTTP.Response.Status != http.StatusTeapot || iv.HTTP.Response.Headers["X-Test"] != "1" {
+		t.Errorf("response = %+v", iv.HTTP.Response)
+	}
+	if iv.HTTP.Response.Body != "c2hvcnQgYW5kIHN0b3V0" {
+		t.Errorf("response body = %q", iv.HTTP.Response.Body)
+	}
+	if iv.HTTP.Response.BodySize != 15 || len(iv.HTTP.Response.BodySHA256) != 64 {
+		t.Errorf("response body size %d and hash %q, want 15 bytes hashed", iv.HTTP.Response.BodySize, iv.HTTP.Response.BodySHA256)
+	}
+}
+
+func TestGetInteractionV2_OtherToken(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	tokenA, _ := createV2TestToken(t, srv, displayKey, 0)
+	_, idsB := createV2TestToken(t, srv, displayKey, 1)
+
+	code := getV2(t, srv, displayKey, fmt.Sprintf("/v2/tokens/%s/interactions/%d", tokenA, idsB[0]), nil)
+	if code != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", code)
+	}
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/requestid"
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// CollaboratorPollPath is the path Burp Suite polls a private Collaborator
+// server's polling location at.
+const CollaboratorPollPath = "/burpresults"
+
+// collaboratorPollLimit caps the interactions returned by one poll; Burp
+// polls again for the rest.
+const collaboratorPollLimit = 500
+
+// collaboratorOpCodes are the Collaborator operation codes of the interaction
+// kinds Burp understands. Interactions of other kinds are not returned.
+var collaboratorOpCodes = map[string]string{
+	"dns":  "0",
+	"http": "1",
+	"smtp": "2",
+}
+
+// CollaboratorHandler serves the Burp Collaborator polling protocol on the
+// catcher, so Burp Suite can use oastrix as a private Collaborator server.
+// Burp's server location and polling location are both set to a token's
+// host, <token>.<domain>: its payloads are then subdomains of the token, and
+// its polls, GET CollaboratorPollPath?biid=<biid>, return the token's
+// interactions.
+//
+// Polls are served only over TLS, and only for tokens whose owner has bound
+// them through the API to a biid, a secret Burp keeps per project; polls
+// with any other biid are refused.
+type CollaboratorHandler struct {
+	Store  db.Store
+	Domain string
+	Logger *zap.Logger
+	// Domains, if set, are served as well as Domain.
+	Domains []string
+}
+
+// collaboratorPollResponse is the body of a poll with interactions; a poll
+// without any is answered with an empty object.
+type collaboratorPollResponse struct {
+	Responses []collaboratorInteraction `json:"responses"`
+}
+
+// collaboratorInteraction is an interaction as Burp decodes it. Time is in
+// milliseconds since the epoch.
+type collaboratorInteraction struct {
+	Protocol          string         `json:"protocol"`
+	OpCode            string         `json:"opCode"`
+	InteractionString string         `json:"interactionString"`
+	ClientIP          string         `json:"clientIp"`
+	Time              string         `json:"time"`
+	Data              map[string]any `json:"data"`
+}
+
+func (h *CollaboratorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	// The biid is the poller's only credential, so it is never accepted in
+	// the clear.
+	if r.TLS == nil {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "polls require TLS"})
+		return
+	}
+	biid := r.URL.Query().Get("biid")
+	if biid == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "biid required"})
+		return
+	}
+
+	domain := cmp.Or(h.domain(r.Host), h.Domain)
+	tok, err := h.Store.ResolveToken(ExtractToken(r, domain))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	if tok == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "token not found"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(biid))
+	sess, err := h.Store.GetCollaboratorSession(tok.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	if sess == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "token is not bound to a biid"})
+		return
+	}
+	if subtle.ConstantTimeCompare(sum[:], sess.BIIDHash) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "token is bound to another biid"})
+		return
+	}
+
+	interactions, err := h.Store.ListInteractionDetails(tok.ID, db.InteractionFilter{
+		SinceID:   sess.LastPolledID,
+		Limit:     collaboratorPollLimit,
+		Ascending: true,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+
+	var resp collaboratorPollResponse
+	for _, i := range interactions {
+		if ci, ok := h.interaction(tok, i); ok {
+			resp.Responses = append(resp.Responses, ci)
+		}
+	}
+	if n := len(interactions); n > 0 {
+		if err := h.Store.SetCollaboratorPolled(tok.ID, interactions[n-1].ID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+			return
+		}
+	}
+
+	if len(resp.Responses) == 0 {
+		writeJSON(w, http.StatusOK, struct{}{})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// interaction converts a stored interaction of tok, reporting false for kinds
+// Burp does not understand.
+func (h *CollaboratorHandler) interaction(tok *models.Token, i models.InteractionDetails) (collaboratorInteraction, bool) {
+	opCode, ok := collaboratorOpCodes[i.Kind]
+	if !ok {
+		return collaboratorInteraction{}, false
+	}
+	out := collaboratorInteraction{
+		Protocol:          i.Kind,
+		OpCode:            opCode,
+		InteractionString: tok.Token,
+		ClientIP:          i.RemoteIP,
+		Time:              strconv.FormatInt(i.OccurredAt*1000, 10),
+		Data:              make(map[string]any),
+	}
+
+	switch {
+	case i.HTTP != nil:
+		out.InteractionString = h.interactionString(i.HTTP.Host, tok.Token)
+		req, resp := rawHTTP(i.HTTP)
+		out.Data["request"] = base64.StdEncoding.EncodeToString([]byte(req))
+		out.Data["response"] = base64.StdEncoding.EncodeToString([]byte(resp))
+	case i.DNS != nil:
+		out.InteractionString = h.interactionString(i.DNS.QName, tok.Token)
+		query, _ := dnsMessages(i.DNS)
+		wire, err := query.Pack()
+		if err != nil {
+			h.Logger.Warn("failed to pack DNS query",
+				zap.Int64("interaction_id", i.ID),
+				zap.Error(err))
+		}
+		out.Data["subDomain"] = strings.TrimSuffix(i.DNS.QName, ".")
+		out.Data["type"] = i.DNS.QType
+		out.Data["rawRequest"] = base64.StdEncoding.EncodeToString(wire)
+	default:
+		p, err := h.Store.GetProtocolInteraction(i.ID)
+		if err != nil {
+			h.Logger.Warn("failed to get protocol interaction",
+				zap.Int64("interaction_id", i.ID),
+				zap.Error(err))
+		}
+		if p != nil {
+			out.Data["conversation"] = base64.StdEncoding.EncodeToString(p.Raw)
+		}
+	}
+	return out, true
+}
+
+// interactionString returns the labels of host before the token, the
+// payload ID Burp generated, or token if there are none.
+func (h *CollaboratorHandler) interactionString(host, token string) string {
+	if hp, _, err := net.SplitHostPort(host); err == nil {
+		host = hp
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	domain := h.domain(host)
+	sub, ok := strings.CutSuffix(host, "."+domain)
+	if !ok || domain == "" {
+		return token
+	}
+	if dot := strings.LastIndex(sub, "."); dot > 0 {
+		return sub[:dot]
+	}
+	return token
+}
+
+func (s *APIServer) handleCreateCollaboratorSessionV2(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+	var req apitypes.CreateCollaboratorSessionRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if req.BIID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "biid required"})
+		return
+	}
+
+	sess, err := s.Store.GetCollaboratorSession(tok.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	if sess != nil {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "token is already bound to a biid"})
+		return
+	}
+	sum := sha256.Sum256([]byte(req.BIID))
+	if err := s.Store.CreateCollaboratorSession(tok.ID, sum[:]); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	requestid.Logger(r.Context(), s.Logger).Info("collaborator client bound", zap.String("token", tok.Token))
+	writeJSON(w, http.StatusCreated, apitypes.CreateCollaboratorSessionResponse{Created: true})
+}
+
+func (s *APIServer) handleDeleteCollaboratorSessionV2(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+	deleted, err := s.Store.DeleteCollaboratorSession(tok.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, apitypes.DeleteCollaboratorSessionResponse{Deleted: deleted})
+}
+
+// domain returns the domain that host is or is under, or "" if there is
+// none.
+func (h *CollaboratorHandler) domain(host string) string {
+	if hp, _, err := net.SplitHostPort(host); err == nil {
+		host = hp
+	}
+	return matchDomain(host, append([]string{h.Domain}, h.Domains...)...)
+}
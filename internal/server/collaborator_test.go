@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+)
+
+func TestCollaboratorPoll(t *testing.T) {
+	database := setupTestDB(t)
+	store := db.NewSQLite(database)
+	tokenID, err := store.CreateToken("burptoken123", nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateToken failed: %v", err)
+	}
+	srv := &HTTPServer{
+		Pipeline:     setupPipeline(t, database),
+		Domain:       "oastrix.example.com",
+		Logger:       zap.NewNop(),
+		Collaborator: &CollaboratorHandler{Store: store, Domain: "oastrix.example.com", Logger: zap.NewNop()},
+	}
+	poll := func(biid string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "https://burptoken123.oastrix.example.com"+CollaboratorPollPath+"?biid="+url.QueryEscape(biid), nil)
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, req)
+		return w
+	}
+
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://k2v9x7q.burptoken123.oastrix.example.com/probe", nil))
+
+	if w := poll("nB1ei/ZQ+4kA=="); w.Code != http.StatusNotFound {
+		t.Fatalf("poll of an unbound token: %d", w.Code)
+	}
+	sum := sha256.Sum256([]byte("nB1ei/ZQ+4kA=="))
+	if err := store.CreateCollaboratorSession(tokenID, sum[:]); err != nil {
+		t.Fatalf("CreateCollaboratorSession failed: %v", err)
+	}
+	plain := httptest.NewRecorder()
+	srv.ServeHTTP(plain, httptest.NewRequest(http.MethodGet, "http://burptoken123.oastrix.example.com"+CollaboratorPollPath+"?biid=nB1ei%2FZQ%2B4kA%3D%3D", nil))
+	if plain.Code != http.StatusForbidden {
+		t.Errorf("poll without TLS: %d", plain.Code)
+	}
+
+	w := poll("nB1ei/ZQ+4kA==")
+	if w.Code != http.StatusOK {
+		t.Fatalf("poll: %d %s", w.Code, w.Body)
+	}
+	var resp collaboratorPollResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode poll response: %v", err)
+	}
+	if len(resp.Responses) != 1 {
+		t.Fatalf("poll returned %d interactions, want 1", len(resp.Responses))
+	}
+	got := resp.Responses[0]
+	if got.Protocol != "http" || got.OpCode != "1" || got.InteractionString != "k2v9x7q" || got.ClientIP != "192.0.2.1" {
+		t.Errorf("interaction = %+v", got)
+	}
+	raw, _ := base64.StdEncoding.DecodeString(got.Data["request"].(string))
+	if !strings.HasPrefix(string(raw), "GET /probe HTTP/1.1\r\n") {
+		t.Errorf("request = %q", raw)
+	}
+
+	if w := poll("nB1ei/ZQ+4kA=="); w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != "{}" {
+		t.Errorf("second poll: %d %s, want an empty object", w.Code, w.Body)
+	}
+	if w := poll("other"); w.Code != http.StatusUnauthorized {
+		t.Errorf("poll with another biid: %d", w.Code)
+	}
+
+}
+
+func TestCreateCollaboratorSessionV2(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	tokenValue, _ := createV2TestToken(t, srv, displayKey, 0)
+
+	bind := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/v2/tokens/"+tokenValue+"/collaborator", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+displayKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := bind(`{}`); code != http.StatusBadRequest {
+		t.Errorf("bind without a biid: %d", code)
+	}
+	if code := bind(`{"biid":"nB1ei/ZQ+4kA=="}`); code != http.StatusCreated {
+		t.Fatalf("bind: %d", code)
+	}
+	if code := bind(`{"biid":"other"}`); code != http.StatusConflict {
+		t.Errorf("bind of a bound token: %d", code)
+	}
+
+	tok, err := srv.Store.GetTokenByValue(tokenValue)
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+	sess, err := srv.Store.GetCollaboratorSession(tok.ID)
+	if err != nil || sess == nil {
+		t.Fatalf("GetCollaboratorSession = %v, %v", sess, err)
+	}
+	if sum := sha256.Sum256([]byte("nB1ei/ZQ+4kA==")); !bytes.Equal(sess.BIIDHash, sum[:]) {
+		t.Errorf("biid hash = %x, want %x", sess.BIIDHash, sum)
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rsclarke/oastrix/internal/requestid"
+)
+
+// defaultCORSHeaders are the request headers a browser client needs to call
+// the API.
+var defaultCORSHeaders = []string{"Authorization", "Content-Type"}
+
+// CORSConfig controls which browser origins may call the API.
+type CORSConfig struct {
+	AllowedOrigins []string // "*" allows any origin
+	AllowedHeaders []string // defaults to Authorization and Content-Type
+}
+
+// Middleware adds CORS headers for allowed origins and answers preflight
+// requests. It must wrap AuthMiddleware because browsers send preflights
+// without credentials.
+func (c *CORSConfig) Middleware(next http.Handler) http.Handler {
+	headers := c.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	allowHeaders := strings.Join(headers, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if !c.originAllowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Expose-Headers", "Retry-After, "+requestid.Header)
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", allowHeaders)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *CORSConfig) originAllowed(origin string) bool {
+	return slices.Contains(c.AllowedOrigins, "*") || slices.Contains(c.AllowedOrigins, origin)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	cors := &CORSConfig{AllowedOrigins: []string{"https://dash.example.com"}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := cors.Middleware(next)
+
+	tests := []struct {
+		name        string
+		method      string
+		origin      string
+		preflight   bool
+		wantStatus  int
+		wantOrigin  string
+		wantHeaders string
+	}{
+		{"no origin", "GET", "", false, http.StatusTeapot, "", ""},
+		{"allowed origin", "GET", "https://dash.example.com", false, http.StatusTeapot, "https://dash.example.com", ""},
+		{"disallowed origin", "GET", "https://evil.example.com", false, http.StatusTeapot, "", ""},
+		{"preflight", "OPTIONS", "https://dash.example.com", true, http.StatusNoContent, "https://dash.example.com", "Authorization, Content-Type"},
+		{"disallowed preflight", "OPTIONS", "https://evil.example.com", true, http.StatusTeapot, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/v1/tokens", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Headers"); got != tt.wantHeaders {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, tt.wantHeaders)
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware_Wildcard(t *testing.T) {
+	cors := &CORSConfig{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"Authorization", "X-Custom"}}
+	h := cors.Middleware(http.NotFoundHandler())
+
+	req := httptest.NewRequest("OPTIONS", "/v1/tokens", nil)
+	req.Header.Set("Origin", "moz-extension://abc")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+
+	h.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "moz-extension://abc" {
+		t.Errorf("Access-Control-Allow-Origin = %q", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Authorization, X-Custom" {
+		t.Errorf("Access-Control-Allow-Headers = %q", got)
+	}
+}
+
+func TestHandler_CORSPreflightSkipsAuth(t *testing.T) {
+	srv, _, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	srv.CORS = &CORSConfig{AllowedOrigins: []string{"*"}}
+
+	req := httptest.NewRequest("OPTIONS", "/v1/tokens", nil)
+	req.Header.Set("Origin", "https://dash.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", w.Code)
+	}
+}
@@ -9,87 +9,107 @@ import (
 
 	"github.com/miekg/dns"
 	"github.com/rsclarke/oastrix/internal/acme"
-	"github.com/rsclarke/oastrix/internal/events"
 	"github.com/rsclarke/oastrix/internal/logging"
 	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/tracing"
+	"github.com/rsclarke/oastrix/pkg/events"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 // DNSServer handles DNS queries and records interactions.
 type DNSServer struct {
-	Pipeline  *plugins.Pipeline
-	Domain    string
-	PublicIP  string // IP address to return for ns1.<domain> and A queries
-	TXTStore  *acme.TXTStore
-	Logger    *zap.Logger
-	udpServer *dns.Server
-	tcpServer *dns.Server
+	Pipeline *plugins.Pipeline
+	Domain   string
+	PublicIP string // IP address to return for ns1.<domain> and A queries
+	TXTStore *acme.TXTStore
+	Logger   *zap.Logger
+	Strays   StrayRecorder // if set, records queries under the domain that carry no token
+	servers  []*dns.Server
+	errCh    chan error
+
+	// Domains, if set, are answered for as well as Domain.
+	Domains []string
+	// APIHost, if set, is answered with PublicIP, as the host the API is
+	// served on, and its queries are not recorded.
+	APIHost string
+
+	// UDPConns and TCPListeners, if set, are served as well as the
+	// addresses passed to Start, e.g. sockets passed by systemd.
+	UDPConns     []net.PacketConn
+	TCPListeners []net.Listener
+
+	// ProxyProtocol, if set, reads PROXY headers on TCP connections from
+	// the load balancers it trusts.
+	ProxyProtocol *ProxyProtocol
 }
 
-// Start begins listening for DNS queries on the specified UDP and TCP ports.
-func (s *DNSServer) Start(udpPort, tcpPort int) error {
+// Start begins listening for DNS queries over UDP and TCP on each of addrs,
+// and serving UDPConns and TCPListeners.
+func (s *DNSServer) Start(addrs []string) error {
 	handler := dns.HandlerFunc(s.handleDNS)
 
-	s.udpServer = &dns.Server{
-		Addr:    fmt.Sprintf(":%d", udpPort),
-		Net:     "udp",
-		Handler: handler,
+	tcpListeners := s.TCPListeners
+	for _, addr := range addrs {
+		s.servers = append(s.servers, &dns.Server{Addr: addr, Net: "udp", Handler: handler})
+		if s.ProxyProtocol == nil {
+			s.servers = append(s.servers, &dns.Server{Addr: addr, Net: "tcp", Handler: handler})
+			continue
+		}
+		// Listened on here, to be wrapped below.
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("TCP DNS server failed to start: %w", err)
+		}
+		tcpListeners = append(tcpListeners, ln)
 	}
-
-	s.tcpServer = &dns.Server{
-		Addr:    fmt.Sprintf(":%d", tcpPort),
-		Net:     "tcp",
-		Handler: handler,
+	for _, pc := range s.UDPConns {
+		s.servers = append(s.servers, &dns.Server{Net: "udp", Handler: handler, PacketConn: pc})
 	}
-
-	udpErrCh := make(chan error, 1)
-	tcpErrCh := make(chan error, 1)
-
-	go func() {
-		s.Logger.Info("starting dns server", logging.Net("udp"), logging.Port(udpPort))
-		if err := s.udpServer.ListenAndServe(); err != nil {
-			udpErrCh <- err
+	for _, ln := range tcpListeners {
+		if s.ProxyProtocol != nil {
+			ln = s.ProxyProtocol.Listener(ln)
 		}
-		close(udpErrCh)
-	}()
+		s.servers = append(s.servers, &dns.Server{Net: "tcp", Handler: handler, Listener: ln})
+	}
 
-	go func() {
-		s.Logger.Info("starting dns server", logging.Net("tcp"), logging.Port(tcpPort))
-		if err := s.tcpServer.ListenAndServe(); err != nil {
-			tcpErrCh <- err
+	s.errCh = make(chan error, len(s.servers))
+	for _, srv := range s.servers {
+		addr, serve := srv.Addr, srv.ListenAndServe
+		switch {
+		case srv.PacketConn != nil:
+			addr, serve = srv.PacketConn.LocalAddr().String(), srv.ActivateAndServe
+		case srv.Listener != nil:
+			addr, serve = srv.Listener.Addr().String(), srv.ActivateAndServe
 		}
-		close(tcpErrCh)
-	}()
-
-	timeout := time.After(100 * time.Millisecond)
-	for i := 0; i < 2; i++ {
-		select {
-		case err := <-udpErrCh:
-			if err != nil {
-				return fmt.Errorf("UDP DNS server failed to start: %w", err)
+		go func() {
+			s.Logger.Info("starting dns server", logging.Net(srv.Net), logging.Addr(addr))
+			if err := serve(); err != nil {
+				s.errCh <- fmt.Errorf("%s DNS server on %s failed: %w", strings.ToUpper(srv.Net), addr, err)
 			}
-		case err := <-tcpErrCh:
-			if err != nil {
-				return fmt.Errorf("TCP DNS server failed to start: %w", err)
-			}
-		case <-timeout:
-			return nil
-		}
+		}()
 	}
 
-	return nil
+	select {
+	case err := <-s.errCh:
+		return err
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
+
+// Err returns a channel that receives the error of each DNS server that
+// fails after Start returns.
+func (s *DNSServer) Err() <-chan error {
+	return s.errCh
 }
 
 // Shutdown gracefully stops the DNS servers.
 func (s *DNSServer) Shutdown(ctx context.Context) {
-	if s.udpServer != nil {
-		if err := s.udpServer.ShutdownContext(ctx); err != nil {
-			s.Logger.Warn("dns udp shutdown error", zap.Error(err))
-		}
-	}
-	if s.tcpServer != nil {
-		if err := s.tcpServer.ShutdownContext(ctx); err != nil {
-			s.Logger.Warn("dns tcp shutdown error", zap.Error(err))
+	for _, srv := range s.servers {
+		if err := srv.ShutdownContext(ctx); err != nil {
+			s.Logger.Warn("dns shutdown error", logging.Net(srv.Net), zap.Error(err))
 		}
 	}
 }
@@ -108,14 +128,15 @@ func (s *DNSServer) handleDNS(w dns.ResponseWriter, r *dns.Msg) {
 
 	for _, q := range r.Question {
 		qname := strings.ToLower(strings.TrimSuffix(q.Name, "."))
+		domain := s.zone(qname)
 
 		// Handle SOA queries for the domain (required for ACME zone discovery)
 		if q.Qtype == dns.TypeSOA {
-			if qname == s.Domain || strings.HasSuffix(qname, "."+s.Domain) {
+			if domain != "" {
 				soa := &dns.SOA{
-					Hdr:     dns.RR_Header{Name: s.Domain + ".", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
-					Ns:      "ns1." + s.Domain + ".",
-					Mbox:    "hostmaster." + s.Domain + ".",
+					Hdr:     dns.RR_Header{Name: domain + ".", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+					Ns:      "ns1." + domain + ".",
+					Mbox:    "hostmaster." + domain + ".",
 					Serial:  1,
 					Refresh: 3600,
 					Retry:   600,
@@ -128,17 +149,17 @@ func (s *DNSServer) handleDNS(w dns.ResponseWriter, r *dns.Msg) {
 		}
 
 		// Handle NS queries for the domain
-		if q.Qtype == dns.TypeNS && qname == s.Domain {
+		if q.Qtype == dns.TypeNS && domain != "" && qname == domain {
 			ns := &dns.NS{
 				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: 300},
-				Ns:  "ns1." + s.Domain + ".",
+				Ns:  "ns1." + domain + ".",
 			}
 			m.Answer = append(m.Answer, ns)
 			continue
 		}
 
 		// Handle queries for ns1.<domain> (required for ACME to resolve nameserver)
-		if qname == "ns1."+s.Domain {
+		if domain != "" && qname == "ns1."+domain {
 			if q.Qtype == dns.TypeA && s.PublicIP != "" {
 				rr := &dns.A{
 					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
@@ -150,8 +171,20 @@ func (s *DNSServer) handleDNS(w dns.ResponseWriter, r *dns.Msg) {
 			continue
 		}
 
+		// Handle queries for the API's host
+		if s.APIHost != "" && qname == strings.ToLower(s.APIHost) {
+			if q.Qtype == dns.TypeA && s.PublicIP != "" {
+				rr := &dns.A{
+					Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
+					A:   net.ParseIP(s.PublicIP),
+				}
+				m.Answer = append(m.Answer, rr)
+			}
+			continue
+		}
+
 		// Handle A queries for the base domain (required for API server access)
-		if qname == s.Domain && q.Qtype == dns.TypeA && s.PublicIP != "" {
+		if domain != "" && qname == domain && q.Qtype == dns.TypeA && s.PublicIP != "" {
 			rr := &dns.A{
 				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 300},
 				A:   net.ParseIP(s.PublicIP),
@@ -175,9 +208,12 @@ func (s *DNSServer) handleDNS(w dns.ResponseWriter, r *dns.Msg) {
 			}
 		}
 
-		token := extractTokenFromQName(qname, s.Domain)
+		var token string
+		if domain != "" {
+			token = extractTokenFromQName(qname, domain)
+		}
 
-		if token == "" {
+		if token == "" && (s.Strays == nil || domain == "") {
 			m.Rcode = dns.RcodeNameError
 			continue
 		}
@@ -208,6 +244,17 @@ func (s *DNSServer) handleDNS(w dns.ResponseWriter, r *dns.Msg) {
 			},
 			Attributes: make(map[string]any),
 		}
+		if domain != "" {
+			draft.Attributes[DomainAttribute] = domain
+		}
+
+		if token == "" {
+			if err := s.Strays.RecordStray(context.Background(), draft); err != nil {
+				s.Logger.Warn("failed to record stray query", zap.Error(err))
+			}
+			m.Rcode = dns.RcodeNameError
+			continue
+		}
 
 		resp := &events.DNSResponsePlan{
 			RCode:   dns.RcodeSuccess,
@@ -221,7 +268,19 @@ func (s *DNSServer) handleDNS(w dns.ResponseWriter, r *dns.Msg) {
 			QNameRaw: q.Name,
 		}
 
-		if err := s.Pipeline.ProcessDNS(context.Background(), e); err != nil {
+		ctx, span := tracing.Start(context.Background(), "dns.interaction",
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("oastrix.token", token),
+				attribute.String("dns.question.name", qname),
+				attribute.String("dns.question.type", dns.TypeToString[q.Qtype]),
+				attribute.String("client.address", remoteIP),
+				attribute.String("network.transport", protocol),
+			))
+		err := s.Pipeline.ProcessDNS(ctx, e)
+		span.SetAttributes(attribute.Int("dns.response.rcode", e.Resp.RCode))
+		tracing.End(span, err)
+		if err != nil {
 			s.Logger.Error("pipeline error", zap.Error(err))
 		}
 
@@ -234,6 +293,12 @@ func (s *DNSServer) handleDNS(w dns.ResponseWriter, r *dns.Msg) {
 	}
 }
 
+// zone returns the domain that qname is or is under, or "" if there is
+// none.
+func (s *DNSServer) zone(qname string) string {
+	return matchDomain(qname, append([]string{s.Domain}, s.Domains...)...)
+}
+
 func extractTokenFromQName(qname, domain string) string {
 	domain = strings.ToLower(domain)
 
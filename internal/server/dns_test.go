@@ -1,9 +1,11 @@
 package server
 
 import (
+	"context"
 	"net"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/miekg/dns"
 	"github.com/rsclarke/oastrix/internal/db"
@@ -75,7 +77,7 @@ func TestDNSServer_StoresInteraction(t *testing.T) {
 	defer func() { _ = os.Remove(tmpDB) }()
 
 	tokenValue := "testtoken123"
-	_, err = db.CreateToken(database, tokenValue, nil, nil)
+	_, err = db.CreateToken(database, tokenValue, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create token: %v", err)
 	}
@@ -137,6 +139,95 @@ func TestDNSServer_StoresInteraction(t *testing.T) {
 	}
 }
 
+func TestDNSServer_Domains(t *testing.T) {
+	tmpDB := t.TempDir() + "/test.db"
+	database, err := db.Open(tmpDB)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	if _, err := db.CreateToken(database, "testtoken123", nil, nil, nil); err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+
+	srv := &DNSServer{
+		Pipeline: setupPipeline(t, database),
+		Domain:   "oastrix.local",
+		Domains:  []string{"oob.example.net"},
+		PublicIP: "127.0.0.1",
+		Logger:   zap.NewNop(),
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("OOB.example.net.", dns.TypeSOA)
+	w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 12345}}
+	srv.handleDNS(w, req)
+	if len(w.msg.Answer) != 1 || w.msg.Answer[0].Header().Name != "oob.example.net." {
+		t.Fatalf("SOA answer = %v, want one for oob.example.net", w.msg.Answer)
+	}
+
+	req = new(dns.Msg)
+	req.SetQuestion("testtoken123.oob.example.net.", dns.TypeA)
+	w = &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 12345}}
+	srv.handleDNS(w, req)
+	if w.msg.Rcode != dns.RcodeSuccess {
+		t.Errorf("expected RcodeSuccess, got %d", w.msg.Rcode)
+	}
+
+	var id int64
+	if err := database.QueryRow("SELECT id FROM interactions").Scan(&id); err != nil {
+		t.Fatalf("failed to query interaction: %v", err)
+	}
+	attrs, err := db.GetAttributes(database, id)
+	if err != nil {
+		t.Fatalf("failed to get attributes: %v", err)
+	}
+	if attrs[DomainAttribute] != "oob.example.net" {
+		t.Errorf("domain attribute = %v, want oob.example.net", attrs[DomainAttribute])
+	}
+}
+
+func TestDNSServer_APIHost(t *testing.T) {
+	tmpDB := t.TempDir() + "/test.db"
+	database, err := db.Open(tmpDB)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	if _, err := db.CreateToken(database, "api", nil, nil, nil); err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	srv := &DNSServer{
+		Pipeline: setupPipeline(t, database),
+		Domain:   "oastrix.local",
+		PublicIP: "192.0.2.10",
+		Logger:   zap.NewNop(),
+		APIHost:  "api.oastrix.local",
+	}
+
+	req := new(dns.Msg)
+	req.SetQuestion("api.oastrix.local.", dns.TypeA)
+	w := &mockResponseWriter{remoteAddr: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 12345}}
+	srv.handleDNS(w, req)
+
+	if len(w.msg.Answer) != 1 {
+		t.Fatalf("expected 1 answer, got %d", len(w.msg.Answer))
+	}
+	if a, ok := w.msg.Answer[0].(*dns.A); !ok || !a.A.Equal(net.ParseIP("192.0.2.10")) {
+		t.Errorf("answer = %v, want the public IP", w.msg.Answer[0])
+	}
+
+	var count int
+	if err := database.QueryRow("SELECT COUNT(*) FROM interactions").Scan(&count); err != nil {
+		t.Fatalf("failed to count interactions: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected 0 interactions for the API host, got %d", count)
+	}
+}
+
 func TestDNSServer_UnknownTokenDoesNotStore(t *testing.T) {
 	tmpDB := t.TempDir() + "/test.db"
 	database, err := db.Open(tmpDB)
@@ -261,3 +352,39 @@ func TestDNSServer_NSQueryNotProcessedByPipeline(t *testing.T) {
 		t.Errorf("expected 0 interactions for NS query, got %d", count)
 	}
 }
+
+func TestDNSServer_StartServesSockets(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &DNSServer{
+		Domain:       "oastrix.local",
+		PublicIP:     "127.0.0.1",
+		Logger:       zap.NewNop(),
+		UDPConns:     []net.PacketConn{pc},
+		TCPListeners: []net.Listener{ln},
+	}
+	if err := srv.Start(nil); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	req := new(dns.Msg)
+	req.SetQuestion("oastrix.local.", dns.TypeSOA)
+	for network, addr := range map[string]string{"udp": pc.LocalAddr().String(), "tcp": ln.Addr().String()} {
+		c := &dns.Client{Net: network, Timeout: time.Second}
+		resp, _, err := c.Exchange(req, addr)
+		if err != nil {
+			t.Fatalf("%s query: %v", network, err)
+		}
+		if len(resp.Answer) != 1 {
+			t.Errorf("%s: got %d answers, want 1", network, len(resp.Answer))
+		}
+	}
+}
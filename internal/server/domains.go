@@ -0,0 +1,23 @@
+package server
+
+import "strings"
+
+// DomainAttribute records the domain an interaction arrived on.
+const DomainAttribute = "domain"
+
+// matchDomain returns the longest of domains that name is or is under,
+// ignoring case, or "" if there is none.
+func matchDomain(name string, domains ...string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	match := ""
+	for _, d := range domains {
+		d = strings.ToLower(d)
+		if d == "" || len(d) <= len(match) {
+			continue
+		}
+		if name == d || strings.HasSuffix(name, "."+d) {
+			match = d
+		}
+	}
+	return match
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/requestid"
+	"github.com/rsclarke/oastrix/internal/siem"
+	"go.uber.org/zap"
+)
+
+// Export formats.
+const (
+	exportNDJSON = "ndjson"
+	exportCSV    = "csv"
+	exportCEF    = siem.FormatCEF
+	exportLEEF   = siem.FormatLEEF
+)
+
+// exportFlushEvery is how many interactions are written between flushes.
+const exportFlushEvery = 100
+
+// exportCSVHeader names the columns of a CSV export.
+var exportCSVHeader = []string{
+	"id", "occurred_at", "kind", "remote_ip", "remote_port", "tls", "summary",
+	"http_method", "http_host", "http_path", "http_query", "dns_qname", "dns_qtype",
+	"attributes",
+}
+
+// handleExportInteractions streams a token's interactions, newest first, as
+// NDJSON lines of v2 interactions, as CSV rows, or as lines of CEF or LEEF
+// events.
+func (s *APIServer) handleExportInteractions(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportNDJSON
+	}
+	switch format {
+	case exportNDJSON, exportCSV, exportCEF, exportLEEF:
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid format: want ndjson, csv, cef or leef"})
+		return
+	}
+
+	filter, ok := parseInteractionFilter(w, r)
+	if !ok {
+		return
+	}
+	interactions, err := s.Store.ListInteractionDetails(tok.ID, filter)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+
+	// Exports can be large, so lift the server-wide write timeout for this
+	// connection.
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "streaming not supported"})
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	switch format {
+	case exportCSV:
+		contentType = "text/csv"
+	case exportCEF, exportLEEF:
+		contentType = "text/plain; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+tok.Token+`-interactions.`+format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	var write func(apitypes.InteractionV2) error
+	var flush func() error
+	switch format {
+	case exportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(exportCSVHeader); err != nil {
+			return
+		}
+		write = func(iv apitypes.InteractionV2) error { return cw.Write(csvRecord(iv)) }
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case exportCEF, exportLEEF:
+		write = func(iv apitypes.InteractionV2) error {
+			_, err := io.WriteString(w, siem.Format(format, iv)+"\n")
+			return err
+		}
+		flush = func() error { return nil }
+	default:
+		enc := json.NewEncoder(w)
+		write = func(iv apitypes.InteractionV2) error { return enc.Encode(iv) }
+		flush = func() error { return nil }
+	}
+
+	for n, i := range interactions {
+		if err := write(s.interactionV2(tok, i)); err != nil {
+			requestid.Logger(r.Context(), s.Logger).Debug("export aborted", zap.String("token", tok.Token), zap.Error(err))
+			return
+		}
+		if (n+1)%exportFlushEvery == 0 {
+			if err := flush(); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+				return
+			}
+		}
+	}
+	_ = flush()
+}
+
+// csvRecord flattens an interaction into the columns of exportCSVHeader.
+func csvRecord(iv apitypes.InteractionV2) []string {
+	record := []string{
+		strconv.FormatInt(iv.ID, 10),
+		iv.OccurredAt,
+		iv.Kind,
+		iv.Remote.IP,
+		strconv.Itoa(iv.Remote.Port),
+		strconv.FormatBool(iv.TLS),
+		csvText(iv.Summary),
+		"", "", "", "", "", "",
+		"",
+	}
+	if iv.HTTP != nil {
+		req := iv.HTTP.Request
+		record[7], record[8], record[9], record[10] = csvText(req.Method), csvText(req.Host), csvText(req.Path), csvText(req.Query)
+	}
+	if iv.DNS != nil {
+		record[11], record[12] = csvText(iv.DNS.Query.QName), strconv.Itoa(iv.DNS.Query.QType)
+	}
+	if len(iv.Attributes) > 0 {
+		if b, err := json.Marshal(iv.Attributes); err == nil {
+			record[13] = string(b)
+		}
+	}
+	return record
+}
+
+// csvText quotes client-controlled text that a spreadsheet would otherwise
+// evaluate as a formula.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+)
+
+func TestExportInteractionsNDJSON(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	token, ids := createV2TestToken(t, srv, displayKey, 3)
+
+	req := httptest.NewRequest("GET", "/v1/tokens/"+token+"/interactions/export", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var got []int64
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var iv apitypes.InteractionV2
+		if err := json.Unmarshal(scanner.Bytes(), &iv); err != nil {
+			t.Fatalf("decode line %q: %v", scanner.Text(), err)
+		}
+		if iv.Token != token || iv.HTTP == nil {
+			t.Errorf("line %d = %+v, want an HTTP interaction with %s", len(got), iv, token)
+		}
+		got = append(got, iv.ID)
+	}
+	if len(got) != len(ids) || got[0] != ids[len(ids)-1] {
+		t.Errorf("exported IDs %v, want %v newest first", got, ids)
+	}
+}
+
+func TestExportInteractionsCSV(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	token, ids := createV2TestToken(t, srv, displayKey, 2)
+
+	req := httptest.NewRequest("GET", "/v1/tokens/"+token+"/interactions/export?format=csv", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if len(records) != len(ids)+1 || records[0][0] != "id" {
+		t.Fatalf("got %d records starting %v, want a header and %d rows", len(records), records[0], len(ids))
+	}
+	if records[1][7] != "GET" || records[1][8] != "example.com" {
+		t.Errorf("row = %v, want the HTTP request columns filled", records[1])
+	}
+}
+
+func TestExportInteractionsCEF(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	token, ids := createV2TestToken(t, srv, displayKey, 2)
+
+	for _, format := range []string{"cef", "leef"} {
+		req := httptest.NewRequest("GET", "/v1/tokens/"+token+"/interactions/export?format="+format, nil)
+		req.Header.Set("Authorization", "Bearer "+displayKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d: %s", format, w.Code, w.Body.String())
+		}
+		lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+		if len(lines) != len(ids) {
+			t.Fatalf("%s: got %d lines, want %d", format, len(lines), len(ids))
+		}
+		prefix := map[string]string{"cef": "CEF:0|oastrix|oastrix|", "leef": "LEEF:1.0|oastrix|oastrix|"}[format]
+		if !strings.HasPrefix(lines[0], prefix) || !strings.Contains(lines[0], "GET") {
+			t.Errorf("%s: line = %q", format, lines[0])
+		}
+	}
+}
+
+func TestExportInteractionsInvalidFormat(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	token, _ := createV2TestToken(t, srv, displayKey, 1)
+
+	req := httptest.NewRequest("GET", "/v1/tokens/"+token+"/interactions/export?format=xml", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestCSVText(t *testing.T) {
+	tests := map[string]string{
+		"GET / HTTP/1.1":      "GET / HTTP/1.1",
+		"=HYPERLINK(\"x\")":   "'=HYPERLINK(\"x\")",
+		"@SUM(1+1)":           "'@SUM(1+1)",
+		"":                    "",
+		"-2+3+cmd|' /C calc'": "'-2+3+cmd|' /C calc'",
+	}
+	for in, want := range tests {
+		if got := csvText(in); got != want {
+			t.Errorf("csvText(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/auth"
+	"github.com/rsclarke/oastrix/internal/plugins/core/files"
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+var fileRoutes = []route{
+	{
+		method: "GET", path: "/v1/tokens/{token}/files", scope: auth.ScopeRead,
+		handler: (*APIServer).handleListFiles, summary: "List files served under a token's host",
+		response: apitypes.ListTokenFilesResponse{},
+	},
+	{
+		method: "PUT", path: "/v1/tokens/{token}/files/{path...}", scope: auth.ScopeFull,
+		handler: (*APIServer).handlePutFile, summary: "Upload a file to serve under a token's host",
+		upload: true, response: apitypes.TokenFile{},
+	},
+	{
+		method: "DELETE", path: "/v1/tokens/{token}/files/{path...}", scope: auth.ScopeFull,
+		handler: (*APIServer).handleDeleteFile, summary: "Remove a file served under a token's host",
+		response: apitypes.DeleteTokenFileResponse{},
+	},
+}
+
+func (s *APIServer) handleListFiles(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+
+	list, err := s.Store.ListTokenFiles(tok.ID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+
+	resp := apitypes.ListTokenFilesResponse{Token: tok.Token, Files: make([]apitypes.TokenFile, 0, len(list))}
+	for _, f := range list {
+		resp.Files = append(resp.Files, s.tokenFile(tok.Token, f))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handlePutFile stores the request body as a file. Its content type is taken
+// from the Content-Type header, or else guessed from the extension and
+// content.
+func (s *APIServer) handlePutFile(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+	p, ok := filePath(w, r)
+	if !ok {
+		return
+	}
+
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, files.MaxFileSize))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "file too large"})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "failed to read body"})
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(p))
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+
+	if err := s.Store.PutTokenFile(tok.ID, p, contentType, content); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.tokenFile(tok.Token, models.TokenFile{
+		Path:        p,
+		ContentType: contentType,
+		Size:        int64(len(content)),
+		CreatedAt:   time.Now().Unix(),
+	}))
+}
+
+func (s *APIServer) handleDeleteFile(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+	p, ok := filePath(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := s.Store.DeleteTokenFile(tok.ID, p)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	if !deleted {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "file not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, apitypes.DeleteTokenFileResponse{Deleted: true})
+}
+
+// filePath returns the cleaned file path from the request. On failure an
+// error response has already been written.
+func filePath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	p, err := files.CleanPath(r.PathValue("path"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return "", false
+	}
+	return p, true
+}
+
+func (s *APIServer) tokenFile(tok string, f models.TokenFile) apitypes.TokenFile {
+	return apitypes.TokenFile{
+		Path:        f.Path,
+		ContentType: f.ContentType,
+		Size:        f.Size,
+		CreatedAt:   time.Unix(f.CreatedAt, 0).UTC().Format(time.RFC3339),
+		URL:         "https://" + tok + "." + s.Domain + f.Path,
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+)
+
+func TestTokenFileRoutes(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+displayKey)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	var created apitypes.CreateTokenResponse
+	if err := json.NewDecoder(do("POST", "/v1/tokens", "", "").Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	base := "/v1/tokens/" + created.Token + "/files"
+
+	w := do("PUT", base+"/payloads/x.dtd", "application/xml-dtd", `<!ENTITY % a SYSTEM "http://x/">`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var file apitypes.TokenFile
+	if err := json.NewDecoder(w.Body).Decode(&file); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if file.Path != "/payloads/x.dtd" || file.ContentType != "application/xml-dtd" || file.Size != 32 {
+		t.Errorf("file = %+v", file)
+	}
+	if want := "https://" + created.Token + ".oastrix.example.com/payloads/x.dtd"; file.URL != want {
+		t.Errorf("URL = %q, want %q", file.URL, want)
+	}
+
+	// Without a Content-Type the type is guessed from the extension.
+	if w := do("PUT", base+"/a.svg", "", "<svg/>"); w.Code != http.StatusOK {
+		t.Fatalf("PUT svg: expected status 200, got %d", w.Code)
+	}
+
+	w = do("GET", base, "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET: expected status 200, got %d", w.Code)
+	}
+	var list apitypes.ListTokenFilesResponse
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(list.Files) != 2 || list.Files[0].Path != "/a.svg" || list.Files[0].ContentType != "image/svg+xml" {
+		t.Errorf("files = %+v", list.Files)
+	}
+
+	tok, err := srv.Store.GetTokenByValue(created.Token)
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+	if f, err := srv.Store.GetTokenFile(tok.ID, "/payloads/x.dtd"); err != nil || f == nil {
+		t.Errorf("stored file = %v, %v", f, err)
+	}
+
+	if w := do("DELETE", base+"/a.svg", "", ""); w.Code != http.StatusOK {
+		t.Errorf("DELETE: expected status 200, got %d", w.Code)
+	}
+	if w := do("DELETE", base+"/a.svg", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("DELETE missing: expected status 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/rsclarke/oastrix/internal/auth"
+)
+
+// Interaction attributes recorded when a request's client address is taken
+// from the headers of a trusted proxy.
+const (
+	// PeerAddrAttribute records the address of the proxy the request came
+	// from.
+	PeerAddrAttribute = "peer_addr"
+	// ForwardedForAttribute records the client address derived from the
+	// proxy's forwarding headers.
+	ForwardedForAttribute = "forwarded_for"
+)
+
+// TrustedProxies derives the client address of requests relayed by trusted
+// reverse proxies from their Forwarded or X-Forwarded-For headers. The headers
+// of requests from anywhere else are not trusted.
+type TrustedProxies struct {
+	trusted []netip.Prefix
+}
+
+// NewTrustedProxies returns TrustedProxies trusting the proxies at the given
+// addresses and CIDR prefixes.
+func NewTrustedProxies(trusted []string) (*TrustedProxies, error) {
+	if len(trusted) == 0 {
+		return nil, errors.New("no trusted proxies")
+	}
+	prefixes, err := auth.ParseAllowlist(trusted)
+	if err != nil {
+		return nil, err
+	}
+	return &TrustedProxies{trusted: prefixes}, nil
+}
+
+// ClientIP returns the address of the client of a request from peer, and
+// whether one was derived. The addresses the headers list are walked from
+// the rightmost, which the nearest proxy appended, and the first that is not
+// a trusted proxy is the client: addresses left of it may have been forged by
+// the client. The Forwarded header is used over X-Forwarded-For if both are
+// present. No address is derived if peer is not trusted, or if the client's
+// entry is not an IP address, such as "unknown" or an obfuscated identifier.
+func (p *TrustedProxies) ClientIP(peer netip.Addr, h http.Header) (netip.Addr, bool) {
+	if !p.trusts(peer) {
+		return netip.Addr{}, false
+	}
+	hops := forwardedFor(h.Values("Forwarded"))
+	if len(h.Values("Forwarded")) == 0 {
+		hops = xForwardedFor(h.Values("X-Forwarded-For"))
+	}
+	if len(hops) == 0 {
+		return netip.Addr{}, false
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip, ok := parseHop(hops[i])
+		if !ok {
+			return netip.Addr{}, false
+		}
+		if i == 0 || !p.trusts(ip) {
+			return ip, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+func (p *TrustedProxies) trusts(ip netip.Addr) bool {
+	return ip.IsValid() && auth.IPAllowed(ip.Unmap(), p.trusted)
+}
+
+// xForwardedFor returns the comma-separated addresses of X-Forwarded-For
+// header values, in order.
+func xForwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for hop := range strings.SplitSeq(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// forwardedFor returns the for= node of each element of Forwarded header
+// values (RFC 7239), in order. An element without one yields "".
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, v := range values {
+		for elem := range strings.SplitSeq(v, ",") {
+			node := ""
+			for pair := range strings.SplitSeq(elem, ";") {
+				key, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+				if strings.EqualFold(key, "for") {
+					node = strings.Trim(strings.TrimSpace(value), `"`)
+				}
+			}
+			hops = append(hops, node)
+		}
+	}
+	return hops
+}
+
+// parseHop parses a forwarded address, which may carry a port and, for IPv6,
+// brackets.
+func parseHop(hop string) (netip.Addr, bool) {
+	if ip, err := netip.ParseAddr(strings.Trim(hop, "[]")); err == nil {
+		return ip.Unmap(), true
+	}
+	if ap, err := netip.ParseAddrPort(hop); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
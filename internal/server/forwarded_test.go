@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func TestTrustedProxiesClientIP(t *testing.T) {
+	p, err := NewTrustedProxies([]string{"10.0.0.0/8", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		peer    string
+		headers map[string][]string
+		want    string
+	}{
+		{
+			name:    "untrusted peer",
+			peer:    "198.51.100.1",
+			headers: map[string][]string{"X-Forwarded-For": {"192.0.2.1"}},
+		},
+		{
+			name: "no headers",
+			peer: "10.0.0.1",
+		},
+		{
+			name:    "x-forwarded-for",
+			peer:    "10.0.0.1",
+			headers: map[string][]string{"X-Forwarded-For": {"192.0.2.1"}},
+			want:    "192.0.2.1",
+		},
+		{
+			name:    "rightmost untrusted",
+			peer:    "10.0.0.1",
+			headers: map[string][]string{"X-Forwarded-For": {"203.0.113.9, 192.0.2.1", "10.1.2.3"}},
+			want:    "192.0.2.1",
+		},
+		{
+			name:    "all trusted takes leftmost",
+			peer:    "10.0.0.1",
+			headers: map[string][]string{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:    "10.0.0.3",
+		},
+		{
+			name:    "unknown client",
+			peer:    "10.0.0.1",
+			headers: map[string][]string{"X-Forwarded-For": {"192.0.2.1, unknown"}},
+		},
+		{
+			name:    "port",
+			peer:    "10.0.0.1",
+			headers: map[string][]string{"X-Forwarded-For": {"192.0.2.1:4711"}},
+			want:    "192.0.2.1",
+		},
+		{
+			name: "forwarded",
+			peer: "2001:db8::1",
+			headers: map[string][]string{"Forwarded": {
+				`for=192.0.2.60;proto=http, For="[2001:db8:cafe::17]:4711";by=10.0.0.2`,
+			}},
+			want: "2001:db8:cafe::17",
+		},
+		{
+			name: "forwarded over x-forwarded-for",
+			peer: "10.0.0.1",
+			headers: map[string][]string{
+				"Forwarded":       {"for=192.0.2.60"},
+				"X-Forwarded-For": {"192.0.2.1"},
+			},
+			want: "192.0.2.60",
+		},
+		{
+			name:    "obfuscated",
+			peer:    "10.0.0.1",
+			headers: map[string][]string{"Forwarded": {"for=_hidden"}},
+		},
+		{
+			name:    "mapped peer",
+			peer:    "::ffff:10.0.0.1",
+			headers: map[string][]string{"X-Forwarded-For": {"192.0.2.1"}},
+			want:    "192.0.2.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := make(http.Header)
+			for k, vs := range tt.headers {
+				for _, v := range vs {
+					h.Add(k, v)
+				}
+			}
+			ip, ok := p.ClientIP(netip.MustParseAddr(tt.peer), h)
+			if tt.want == "" {
+				if ok {
+					t.Errorf("ClientIP() = %v, want none", ip)
+				}
+				return
+			}
+			if !ok || ip.String() != tt.want {
+				t.Errorf("ClientIP() = %v, %v; want %s", ip, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTrustedProxiesInvalid(t *testing.T) {
+	for _, trusted := range [][]string{nil, {"not-an-ip"}} {
+		if _, err := NewTrustedProxies(trusted); err == nil {
+			t.Errorf("NewTrustedProxies(%q) succeeded", trusted)
+		}
+	}
+}
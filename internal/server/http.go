@@ -1,17 +1,25 @@
 package server
 
 import (
+	"cmp"
+	"context"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/caddyserver/certmagic"
-	"github.com/rsclarke/oastrix/internal/events"
 	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/canary"
+	"github.com/rsclarke/oastrix/internal/requestid"
+	"github.com/rsclarke/oastrix/internal/tracing"
+	"github.com/rsclarke/oastrix/pkg/events"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -21,8 +29,45 @@ type HTTPServer struct {
 	Domain   string
 	PublicIP string
 	Logger   *zap.Logger
+	// Domains, if set, are served as well as Domain, so tokens can be
+	// reached under another domain when a target blocks one.
+	Domains []string
+	// Routes, if set, serves plugins' own routes under PluginPathPrefix.
+	Routes *PluginRouter
+	// MaxBodySize bounds the request body recorded with each interaction;
+	// zero means DefaultMaxBodySize.
+	MaxBodySize int64
+	// Strays, if set, records requests to the domain that carry no token.
+	Strays StrayRecorder
+	// Interactsh, if set, serves the interactsh server protocol on requests
+	// to the domain that carry no token.
+	Interactsh *InteractshHandler
+	// Collaborator, if set, serves Burp Collaborator polls of a token's host
+	// at CollaboratorPollPath.
+	Collaborator *CollaboratorHandler
+	// CanaryPaths, if set, takes the token of requests to the domain that
+	// carry none from the path of a canary tracking URL; see canary.PathToken.
+	CanaryPaths bool
+	// TrustedProxies, if set, takes the remote address of requests relayed
+	// by trusted reverse proxies from their forwarding headers.
+	TrustedProxies *TrustedProxies
+	// API, if set, serves HTTPS requests for APIHost instead of recording
+	// them, so the API needs no listener of its own. Plain HTTP requests for
+	// APIHost are refused rather than recorded.
+	API     http.Handler
+	APIHost string
 }
 
+// StrayRecorder records traffic to the domain that carried no token, in
+// honeypot mode. It is implemented by the storage plugin, which records
+// traffic with unknown tokens itself.
+type StrayRecorder interface {
+	RecordStray(ctx context.Context, draft *events.InteractionDraft) error
+}
+
+// DefaultMaxBodySize is the request body size recorded by default.
+const DefaultMaxBodySize = 1 << 20
+
 // ExtractToken extracts an OAST token from the request host or path.
 func ExtractToken(r *http.Request, domain string) string {
 	host := r.Host
@@ -55,20 +100,33 @@ func ExtractToken(r *http.Request, domain string) string {
 	return ""
 }
 
-func (s *HTTPServer) isValidHost(host string) bool {
+// hostDomain returns the domain that host is or is under, or "" if there
+// is none.
+func (s *HTTPServer) hostDomain(host string) string {
 	if h, _, err := net.SplitHostPort(host); err == nil {
 		host = h
 	}
-	host = strings.Trim(host, "[]")
+	return matchDomain(strings.Trim(host, "[]"), append([]string{s.Domain}, s.Domains...)...)
+}
 
-	if strings.HasSuffix(host, "."+s.Domain) {
-		return true
+// isAPIHost reports whether host is APIHost, with or without a port.
+func (s *HTTPServer) isAPIHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
 	}
+	return strings.EqualFold(strings.TrimSuffix(host, "."), s.APIHost)
+}
 
-	if host == s.Domain {
+func (s *HTTPServer) isValidHost(host string) bool {
+	if s.hostDomain(host) != "" {
 		return true
 	}
 
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+
 	if s.PublicIP != "" && host == s.PublicIP {
 		return true
 	}
@@ -77,6 +135,21 @@ func (s *HTTPServer) isValidHost(host string) bool {
 }
 
 func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.API != nil && s.isAPIHost(r.Host) {
+		if r.TLS == nil {
+			http.Error(w, "the API is only served over HTTPS", http.StatusMisdirectedRequest)
+			return
+		}
+		s.API.ServeHTTP(w, r)
+		return
+	}
+
+	// Targets' request IDs are untrusted, so always assign a new one.
+	reqID := requestid.New()
+	w.Header().Set(requestid.Header, reqID)
+	r = r.WithContext(requestid.NewContext(r.Context(), reqID))
+	logger := requestid.Logger(r.Context(), s.Logger)
+
 	// Handle ACME HTTP-01 challenges for IP certificate acquisition
 	if strings.HasPrefix(r.URL.Path, "/.well-known/acme-challenge/") {
 		if certmagic.DefaultACME.HandleHTTPChallenge(w, r) {
@@ -89,8 +162,27 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := ExtractToken(r, s.Domain)
-	if token == "" {
+	if s.Routes != nil {
+		if h := s.Routes.handler(r); h != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	domain := s.hostDomain(r.Host)
+	token := ExtractToken(r, cmp.Or(domain, s.Domain))
+	if token == "" && s.Interactsh != nil && s.Interactsh.Handles(r) {
+		s.Interactsh.ServeHTTP(w, r)
+		return
+	}
+	if token == "" && s.CanaryPaths {
+		token = canary.PathToken(r.URL.Path)
+	}
+	if token != "" && s.Collaborator != nil && r.URL.Path == CollaboratorPollPath {
+		s.Collaborator.ServeHTTP(w, r)
+		return
+	}
+	if token == "" && s.Strays == nil {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("ok"))
 		return
@@ -102,6 +194,19 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		remotePortStr = "0"
 	}
 	remotePort, _ := strconv.Atoi(remotePortStr)
+	attrs := map[string]any{requestid.Attribute: reqID}
+	if domain != "" {
+		attrs[DomainAttribute] = domain
+	}
+	if s.TrustedProxies != nil {
+		peer, _ := netip.ParseAddr(remoteIP)
+		if client, ok := s.TrustedProxies.ClientIP(peer, r.Header); ok {
+			attrs[PeerAddrAttribute] = r.RemoteAddr
+			attrs[ForwardedForAttribute] = client.String()
+			// The client's port is not forwarded; the proxy's is meaningless.
+			remoteIP, remotePort = client.String(), 0
+		}
+	}
 
 	tls := r.TLS != nil
 
@@ -117,10 +222,14 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		headers[k] = v
 	}
 
-	r.Body = http.MaxBytesReader(w, r.Body, 1<<20) // 1MB limit
+	maxBody := s.MaxBodySize
+	if maxBody == 0 {
+		maxBody = DefaultMaxBodySize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBody)
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		s.Logger.Warn("read body failed", zap.Error(err))
+		logger.Warn("read body failed", zap.Error(err))
 		body = nil
 	}
 
@@ -133,16 +242,26 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		TLS:        tls,
 		Summary:    summary,
 		HTTP: &events.HTTPDraft{
-			Method:  r.Method,
-			Scheme:  scheme,
-			Host:    r.Host,
-			Path:    r.URL.Path,
-			Query:   r.URL.RawQuery,
-			Proto:   r.Proto,
-			Headers: headers,
-			Body:    body,
+			Method:           r.Method,
+			Scheme:           scheme,
+			Host:             r.Host,
+			Path:             r.URL.Path,
+			Query:            r.URL.RawQuery,
+			Proto:            r.Proto,
+			Headers:          headers,
+			Body:             body,
+			TransferEncoding: r.TransferEncoding,
 		},
-		Attributes: make(map[string]any),
+		Attributes: attrs,
+	}
+
+	if token == "" {
+		if err := s.Strays.RecordStray(r.Context(), draft); err != nil {
+			logger.Warn("failed to record stray request", zap.Error(err))
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+		return
 	}
 
 	resp := &events.HTTPResponsePlan{
@@ -152,14 +271,26 @@ func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	e := &events.HTTPEvent{
-		Event:   events.Event{Draft: draft},
-		Req:     r,
-		Resp:    resp,
-		Scratch: make(map[string]any),
+		Event: events.Event{Draft: draft, RequestID: reqID},
+		Req:   r,
+		Resp:  resp,
 	}
 
-	if err := s.Pipeline.ProcessHTTP(r.Context(), e); err != nil {
-		s.Logger.Error("pipeline error", zap.Error(err))
+	// Start a new root span: trace context supplied by the target is untrusted.
+	ctx, span := tracing.Start(r.Context(), "http.interaction",
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("oastrix.token", token),
+			attribute.String("oastrix.request_id", reqID),
+			attribute.String("http.request.method", r.Method),
+			attribute.String("client.address", remoteIP),
+		))
+	err = s.Pipeline.ProcessHTTP(ctx, e)
+	span.SetAttributes(attribute.Int("http.response.status_code", e.Resp.Status))
+	tracing.End(span, err)
+	if err != nil {
+		logger.Error("pipeline error", zap.Error(err))
 	}
 
 	for k, v := range e.Resp.Headers {
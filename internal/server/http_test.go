@@ -12,6 +12,7 @@ import (
 	"github.com/rsclarke/oastrix/internal/plugins"
 	"github.com/rsclarke/oastrix/internal/plugins/core/defaultresponse"
 	"github.com/rsclarke/oastrix/internal/plugins/core/storage"
+	"github.com/rsclarke/oastrix/internal/requestid"
 	"go.uber.org/zap"
 )
 
@@ -129,7 +130,7 @@ func setupPipeline(t *testing.T, database *sql.DB) *plugins.Pipeline {
 	logger := zap.NewNop()
 	pipeline := plugins.NewPipeline(logger)
 
-	storagePlugin := storage.New(database)
+	storagePlugin := storage.New(db.NewSQLite(database))
 	_ = storagePlugin.Init(plugins.InitContext{Logger: logger})
 	pipeline.SetStore(storagePlugin)
 	pipeline.Register(storagePlugin)
@@ -151,7 +152,7 @@ func TestHTTPServer_StoresInteraction(t *testing.T) {
 	defer func() { _ = os.Remove(tmpDB) }()
 
 	tokenValue := "testtoken123"
-	_, err = db.CreateToken(database, tokenValue, nil, nil)
+	_, err = db.CreateToken(database, tokenValue, nil, nil, nil)
 	if err != nil {
 		t.Fatalf("failed to create token: %v", err)
 	}
@@ -203,6 +204,160 @@ func TestHTTPServer_StoresInteraction(t *testing.T) {
 	if string(body) != "request body" {
 		t.Errorf("expected body 'request body', got %s", string(body))
 	}
+
+	reqID := rec.Header().Get(requestid.Header)
+	if reqID == "" {
+		t.Fatal("response has no request ID")
+	}
+	var id int64
+	if err := database.QueryRow("SELECT id FROM interactions").Scan(&id); err != nil {
+		t.Fatalf("failed to query interaction id: %v", err)
+	}
+	attrs, err := db.GetAttributes(database, id)
+	if err != nil {
+		t.Fatalf("failed to get attributes: %v", err)
+	}
+	if attrs[requestid.Attribute] != reqID {
+		t.Errorf("interaction request ID = %v, want %s", attrs[requestid.Attribute], reqID)
+	}
+}
+
+func TestHTTPServer_TrustedProxies(t *testing.T) {
+	tmpDB := t.TempDir() + "/test.db"
+	database, err := db.Open(tmpDB)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	if _, err := db.CreateToken(database, "testtoken123", nil, nil, nil); err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	proxies, err := NewTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &HTTPServer{
+		Pipeline:       setupPipeline(t, database),
+		Domain:         "oastrix.example.com",
+		Logger:         zap.NewNop(),
+		TrustedProxies: proxies,
+	}
+
+	req := httptest.NewRequest("GET", "http://testtoken123.oastrix.example.com/", nil)
+	req.RemoteAddr = "10.0.0.1:40000"
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	var id int64
+	var remoteIP string
+	if err := database.QueryRow("SELECT id, remote_ip FROM interactions").Scan(&id, &remoteIP); err != nil {
+		t.Fatalf("failed to query interaction: %v", err)
+	}
+	if remoteIP != "192.0.2.1" {
+		t.Errorf("remote IP = %s, want the forwarded client's", remoteIP)
+	}
+	attrs, err := db.GetAttributes(database, id)
+	if err != nil {
+		t.Fatalf("failed to get attributes: %v", err)
+	}
+	if attrs[PeerAddrAttribute] != "10.0.0.1:40000" || attrs[ForwardedForAttribute] != "192.0.2.1" {
+		t.Errorf("attributes = %v, want peer and forwarded addresses", attrs)
+	}
+}
+
+func TestHTTPServer_Domains(t *testing.T) {
+	tmpDB := t.TempDir() + "/test.db"
+	database, err := db.Open(tmpDB)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	if _, err := db.CreateToken(database, "testtoken123", nil, nil, nil); err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	srv := &HTTPServer{
+		Pipeline: setupPipeline(t, database),
+		Domain:   "example.com",
+		Domains:  []string{"oob.example.com"},
+		Logger:   zap.NewNop(),
+	}
+
+	// The longest matching domain wins, so the token is not "oob".
+	req := httptest.NewRequest("GET", "http://testtoken123.oob.example.com:8080/", nil)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var id int64
+	if err := database.QueryRow("SELECT id FROM interactions").Scan(&id); err != nil {
+		t.Fatalf("failed to query interaction: %v", err)
+	}
+	attrs, err := db.GetAttributes(database, id)
+	if err != nil {
+		t.Fatalf("failed to get attributes: %v", err)
+	}
+	if attrs[DomainAttribute] != "oob.example.com" {
+		t.Errorf("domain attribute = %v, want oob.example.com", attrs[DomainAttribute])
+	}
+}
+
+func TestHTTPServer_APIVHost(t *testing.T) {
+	tmpDB := t.TempDir() + "/test.db"
+	database, err := db.Open(tmpDB)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer func() { _ = database.Close() }()
+
+	for _, tok := range []string{"api", "abc123"} {
+		if _, err := db.CreateToken(database, tok, nil, nil, nil); err != nil {
+			t.Fatalf("failed to create token: %v", err)
+		}
+	}
+	srv := &HTTPServer{
+		Pipeline: setupPipeline(t, database),
+		Domain:   "oastrix.example.com",
+		Logger:   zap.NewNop(),
+		API: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+		APIHost: "api.oastrix.example.com",
+	}
+
+	req := httptest.NewRequest("GET", "https://API.oastrix.example.com:443/v1/tokens", nil)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("HTTPS request: status = %d, want the API's", rec.Code)
+	}
+
+	// Without TLS, the request is refused rather than recorded.
+	req = httptest.NewRequest("GET", "http://api.oastrix.example.com/v1/tokens", nil)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMisdirectedRequest {
+		t.Errorf("HTTP request: status = %d, want 421", rec.Code)
+	}
+
+	// Other hosts are still recorded.
+	req = httptest.NewRequest("GET", "http://abc123.oastrix.example.com/", nil)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("token request: status = %d, want 200", rec.Code)
+	}
+
+	var count int
+	if err := database.QueryRow("SELECT COUNT(*) FROM interactions").Scan(&count); err != nil {
+		t.Fatalf("failed to count interactions: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected only the token request recorded, got %d interactions", count)
+	}
 }
 
 func TestHTTPServer_UnknownTokenDoesNotError(t *testing.T) {
@@ -240,6 +395,31 @@ func TestHTTPServer_UnknownTokenDoesNotError(t *testing.T) {
 	}
 }
 
+func TestHTTPServer_CanaryPaths(t *testing.T) {
+	database := setupTestDB(t)
+	if _, err := db.CreateToken(database, "canarytoken1", nil, nil, nil); err != nil {
+		t.Fatalf("failed to create token: %v", err)
+	}
+	srv := &HTTPServer{
+		Pipeline: setupPipeline(t, database),
+		Domain:   "oastrix.example.com",
+		Logger:   zap.NewNop(),
+	}
+	req := httptest.NewRequest("GET", "http://oastrix.example.com/static/tags/canarytoken1/index.html", nil)
+
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	var count int
+	if err := database.QueryRow("SELECT COUNT(*) FROM interactions").Scan(&count); err != nil || count != 0 {
+		t.Fatalf("recorded %d interactions (%v) without CanaryPaths, want 0", count, err)
+	}
+
+	srv.CanaryPaths = true
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	if err := database.QueryRow("SELECT COUNT(*) FROM interactions").Scan(&count); err != nil || count != 1 {
+		t.Errorf("recorded %d interactions (%v) with CanaryPaths, want 1", count, err)
+	}
+}
+
 func setupTestDB(t *testing.T) *sql.DB {
 	tmpDB := t.TempDir() + "/test.db"
 	database, err := db.Open(tmpDB)
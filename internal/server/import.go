@@ -0,0 +1,164 @@
+package server
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/requestid"
+	"go.uber.org/zap"
+)
+
+// maxImportSize bounds the NDJSON body of an import.
+const maxImportSize = 64 << 20
+
+// importRecord is an exported interaction checked and decoded for import.
+type importRecord struct {
+	apitypes.InteractionV2
+	occurredAt   int64
+	requestBody  []byte
+	responseBody []byte
+}
+
+// handleImportInteractions restores interactions from an NDJSON export
+// under the token, keeping their timestamps, details and attributes. Every
+// record is checked before any is stored. Imported interactions are not run
+// through the plugin pipeline.
+func (s *APIServer) handleImportInteractions(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+
+	var records []importRecord
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize))
+	for n := 1; ; n++ {
+		var iv apitypes.InteractionV2
+		err := dec.Decode(&iv)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				writeJSON(w, http.StatusRequestEntityTooLarge, map[string]string{"error": "import too large"})
+				return
+			}
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("record %d: invalid JSON", n)})
+			return
+		}
+		rec, err := parseImportRecord(iv)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("record %d: %v", n, err)})
+			return
+		}
+		records = append(records, rec)
+	}
+
+	// Store the oldest first, so IDs follow time as they did when the
+	// interactions were recorded. Exports list the newest first, so reversing
+	// before the stable sort keeps ties in their recorded order.
+	slices.Reverse(records)
+	slices.SortStableFunc(records, func(a, b importRecord) int { return cmp.Compare(a.occurredAt, b.occurredAt) })
+
+	for n, rec := range records {
+		if err := s.Store.Write(r.Context(), func(dw db.Writer) error { return importInteraction(dw, tok.ID, rec) }); err != nil {
+			requestid.Logger(r.Context(), s.Logger).Error("failed to import interaction", zap.String("token", tok.Token), zap.Int("record", n+1), zap.Error(err))
+			writeJSON(w, http.StatusInternalServerError, map[string]string{
+				"error": fmt.Sprintf("database error after importing %d interactions", n),
+			})
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, apitypes.ImportInteractionsResponse{Imported: len(records)})
+}
+
+// parseImportRecord checks an exported interaction and decodes its
+// timestamp and bodies.
+func parseImportRecord(iv apitypes.InteractionV2) (importRecord, error) {
+	rec := importRecord{InteractionV2: iv}
+	if iv.Kind == "" {
+		return rec, errors.New("kind is required")
+	}
+	occurredAt, err := time.Parse(time.RFC3339, iv.OccurredAt)
+	if err != nil {
+		return rec, errors.New("invalid occurred_at")
+	}
+	rec.occurredAt = occurredAt.Unix()
+
+	if iv.HTTP != nil {
+		if rec.requestBody, err = base64.StdEncoding.DecodeString(iv.HTTP.Request.Body); err != nil {
+			return rec, errors.New("invalid request body encoding")
+		}
+		if iv.HTTP.Response != nil {
+			if rec.responseBody, err = base64.StdEncoding.DecodeString(iv.HTTP.Response.Body); err != nil {
+				return rec, errors.New("invalid response body encoding")
+			}
+		}
+	}
+	return rec, nil
+}
+
+// importInteraction stores rec under the token.
+func importInteraction(w db.Writer, tokenID int64, rec importRecord) error {
+	id, err := w.CreateInteractionAt(rec.occurredAt, tokenID, rec.Kind, rec.Remote.IP, rec.Remote.Port, rec.TLS, rec.Summary)
+	if err != nil {
+		return fmt.Errorf("create interaction: %w", err)
+	}
+
+	if h := rec.HTTP; h != nil {
+		headers, err := json.Marshal(h.Request.Headers)
+		if err != nil {
+			return fmt.Errorf("marshal headers: %w", err)
+		}
+		req := h.Request
+		if err := w.CreateHTTPInteraction(id, req.Method, req.Scheme, req.Host, req.Path, req.Query, req.Proto, string(headers), rec.requestBody); err != nil {
+			return fmt.Errorf("create http interaction: %w", err)
+		}
+		if h.Response != nil {
+			headers, err := json.Marshal(h.Response.Headers)
+			if err != nil {
+				return fmt.Errorf("marshal response headers: %w", err)
+			}
+			if err := w.SetHTTPResponse(id, h.Response.Status, string(headers), rec.responseBody); err != nil {
+				return fmt.Errorf("set http response: %w", err)
+			}
+		}
+	}
+
+	if d := rec.DNS; d != nil {
+		q := d.Query
+		rd := 0
+		if q.RD {
+			rd = 1
+		}
+		if err := w.CreateDNSInteraction(id, q.QName, q.QType, q.QClass, rd, q.Opcode, q.DNSID, q.Protocol); err != nil {
+			return fmt.Errorf("create dns interaction: %w", err)
+		}
+		if d.Response != nil {
+			answers, err := json.Marshal(d.Response.Answers)
+			if err != nil {
+				return fmt.Errorf("marshal response answers: %w", err)
+			}
+			if err := w.SetDNSResponse(id, d.Response.RCode, string(answers)); err != nil {
+				return fmt.Errorf("set dns response: %w", err)
+			}
+		}
+	}
+
+	if len(rec.Attributes) > 0 {
+		if err := w.SaveAttributes(id, rec.Attributes); err != nil {
+			return fmt.Errorf("save attributes: %w", err)
+		}
+	}
+	return nil
+}
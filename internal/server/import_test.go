@@ -0,0 +1,88 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+)
+
+func TestImportInteractions(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	from, ids := createV2TestToken(t, srv, displayKey, 2)
+	if err := srv.Store.SaveAttributes(ids[0], map[string]any{"geo.country": "GB"}); err != nil {
+		t.Fatalf("save attributes: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/v1/tokens/"+from+"/interactions/export", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: expected status 200, got %d", w.Code)
+	}
+	export := w.Body.String()
+
+	to, _ := createV2TestToken(t, srv, displayKey, 0)
+	req = httptest.NewRequest("POST", "/v1/tokens/"+to+"/interactions/import", strings.NewReader(export))
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp apitypes.ImportInteractionsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Imported != 2 {
+		t.Errorf("imported %d, want 2", resp.Imported)
+	}
+
+	var original, imported apitypes.ListInteractionsV2Response
+	getV2(t, srv, displayKey, "/v2/tokens/"+from+"/interactions", &original)
+	getV2(t, srv, displayKey, "/v2/tokens/"+to+"/interactions", &imported)
+	if len(imported.Data) != len(original.Data) {
+		t.Fatalf("imported %d interactions, want %d", len(imported.Data), len(original.Data))
+	}
+	for i, got := range imported.Data {
+		want := original.Data[i]
+		if got.Token != to || got.OccurredAt != want.OccurredAt || got.Summary != want.Summary {
+			t.Errorf("interaction %d = %+v, want %+v under %s", i, got, want, to)
+		}
+		if got.HTTP == nil || got.HTTP.Request.Path != want.HTTP.Request.Path {
+			t.Errorf("interaction %d HTTP = %+v, want %+v", i, got.HTTP, want.HTTP)
+		}
+		if got.Attributes["geo.country"] != want.Attributes["geo.country"] {
+			t.Errorf("interaction %d attributes = %v, want %v", i, got.Attributes, want.Attributes)
+		}
+	}
+}
+
+func TestImportInteractionsRejectsInvalidRecords(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	token, _ := createV2TestToken(t, srv, displayKey, 0)
+
+	body := `{"kind":"dns","occurred_at":"2026-01-02T03:04:05Z","remote":{"ip":"192.0.2.1","port":53}}
+{"kind":"http","occurred_at":"yesterday"}
+`
+	req := httptest.NewRequest("POST", "/v1/tokens/"+token+"/interactions/import", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "record 2") {
+		t.Fatalf("expected a 400 naming record 2, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Nothing is stored when any record is invalid.
+	var list apitypes.ListInteractionsV2Response
+	getV2(t, srv, displayKey, "/v2/tokens/"+token+"/interactions", &list)
+	if len(list.Data) != 0 {
+		t.Errorf("stored %d interactions, want none", len(list.Data))
+	}
+}
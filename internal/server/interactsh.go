@@ -0,0 +1,436 @@
+package server
+
+import (
+	"cmp"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/auth"
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins/core/interactsh"
+	"github.com/rsclarke/oastrix/internal/requestid"
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// DefaultInteractshTTL is how long the token registered for an interactsh
+// session lives.
+const DefaultInteractshTTL = 30 * 24 * time.Hour
+
+// interactshTag tags the tokens registered by interactsh clients.
+const interactshTag = "interactsh"
+
+// interactshPollLimit caps the interactions returned by one poll; clients poll
+// again for the rest.
+const interactshPollLimit = 500
+
+// InteractshHandler serves the /register, /poll and /deregister endpoints of
+// the interactsh server protocol on the catcher, so interactsh-client, nuclei
+// and other interactsh tooling can use oastrix unchanged. Each registration
+// creates a token whose value is the client's correlation ID; the interactsh
+// core plugin resolves the client's payload labels to it.
+//
+// Clients authenticate with an API key sent as the interactsh server token,
+// a bare key in the Authorization header. Registering requires a key with the
+// full scope, and a session's token belongs to that key, so only it can poll.
+// With Anonymous set, clients that send no key can register too, and anyone
+// holding a session's secret can poll it.
+type InteractshHandler struct {
+	API       *APIServer
+	Domain    string
+	Anonymous bool
+	TTL       time.Duration // DefaultInteractshTTL when zero
+	Domains   []string      // served as well as Domain
+}
+
+// Handles reports whether r is for an interactsh endpoint.
+func (h *InteractshHandler) Handles(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/register", "/poll", "/deregister":
+		return true
+	}
+	return false
+}
+
+func (h *InteractshHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var next http.HandlerFunc
+	switch r.Method + " " + r.URL.Path {
+	case "POST /register":
+		next = h.register
+	case "GET /poll":
+		next = h.poll
+	case "POST /deregister":
+		next = h.deregister
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	key := r.Header.Get("Authorization")
+	if key == "" && h.Anonymous {
+		next(w, r)
+		return
+	}
+	// interactsh clients send the server token without a scheme.
+	if key != "" && !strings.HasPrefix(key, "Bearer ") {
+		r = r.Clone(r.Context())
+		r.Header.Set("Authorization", "Bearer "+key)
+	}
+	h.API.AuthMiddleware(next).ServeHTTP(w, r)
+}
+
+// interactshRegisterRequest is the body of /register and /deregister.
+type interactshRegisterRequest struct {
+	PublicKey     string `json:"public-key"` // base64 of a PEM RSA public key
+	SecretKey     string `json:"secret-key"`
+	CorrelationID string `json:"correlation-id"`
+}
+
+// decode reads the request body, writing an error response on failure.
+func (req *interactshRegisterRequest) decode(w http.ResponseWriter, r *http.Request) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<16)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return false
+	}
+	req.CorrelationID = strings.ToLower(req.CorrelationID)
+	if !validCorrelationID(req.CorrelationID) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid correlation-id"})
+		return false
+	}
+	if req.SecretKey == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "secret-key required"})
+		return false
+	}
+	return true
+}
+
+func validCorrelationID(id string) bool {
+	if len(id) != interactsh.CorrelationIDLength {
+		return false
+	}
+	for _, c := range id {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeInteractshKey decodes a client's public key, base64 of a PEM block,
+// returning the PEM.
+func decodeInteractshKey(s string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("decode public key: %w", err)
+	}
+	if _, err := parseRSAPublicKey(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// parseRSAPublicKey parses a PEM block holding a PKIX or PKCS #1 RSA public
+// key.
+func parseRSAPublicKey(b []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("public key is not PEM")
+	}
+	if pub, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		if key, ok := pub.(*rsa.PublicKey); ok {
+			return key, nil
+		}
+		return nil, errors.New("public key is not RSA")
+	}
+	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %w", err)
+	}
+	return key, nil
+}
+
+func (h *InteractshHandler) register(w http.ResponseWriter, r *http.Request) {
+	s := h.API
+	var apiKeyID *int64
+	if id := getAPIKeyID(r); id != 0 {
+		if !getAPIKeyScope(r).Allows(auth.ScopeFull) {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "insufficient scope"})
+			return
+		}
+		apiKeyID = &id
+	}
+
+	var req interactshRegisterRequest
+	if !req.decode(w, r) {
+		return
+	}
+	publicKey, err := decodeInteractshKey(req.PublicKey)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid public-key"})
+		return
+	}
+
+	inUse, err := s.Store.TokenValueInUse(req.CorrelationID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	if inUse {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": "correlation-id already registered"})
+		return
+	}
+
+	label := interactshTag
+	expiresAt := time.Now().Add(cmp.Or(h.TTL, DefaultInteractshTTL)).Unix()
+	tokenID, err := s.Store.CreateToken(req.CorrelationID, apiKeyID, &label, &expiresAt)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to register"})
+		return
+	}
+	secret := sha256.Sum256([]byte(req.SecretKey))
+	if err := s.Store.SetTokenTags(tokenID, []string{interactshTag}); err == nil {
+		err = s.Store.CreateInteractshSession(models.InteractshSession{
+			CorrelationID: req.CorrelationID,
+			TokenID:       tokenID,
+			SecretHash:    secret[:],
+			PublicKey:     publicKey,
+		})
+	}
+	if err != nil {
+		_ = s.Store.DeleteToken(req.CorrelationID)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to register"})
+		return
+	}
+
+	requestid.Logger(r.Context(), s.Logger).Info("interactsh client registered", zap.String("correlation_id", req.CorrelationID))
+	writeJSON(w, http.StatusOK, map[string]string{"message": "registration successful"})
+}
+
+// session returns the session with the given correlation ID if secret is its
+// secret key and the request may use it. On failure an error response has
+// already been written.
+func (h *InteractshHandler) session(w http.ResponseWriter, r *http.Request, correlationID, secret string) (*models.InteractshSession, *models.Token, bool) {
+	s := h.API
+	sess, err := s.Store.GetInteractshSession(strings.ToLower(correlationID))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return nil, nil, false
+	}
+	if sess == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "could not get correlation-id"})
+		return nil, nil, false
+	}
+	sum := sha256.Sum256([]byte(secret))
+	if subtle.ConstantTimeCompare(sum[:], sess.SecretHash) != 1 {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid secret key"})
+		return nil, nil, false
+	}
+
+	tok, err := s.Store.GetTokenByValue(sess.CorrelationID)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return nil, nil, false
+	}
+	if tok == nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "could not get correlation-id"})
+		return nil, nil, false
+	}
+	if tok.APIKeyID != nil && *tok.APIKeyID != getAPIKeyID(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+		return nil, nil, false
+	}
+	return sess, tok, true
+}
+
+// interactshPollResponse is the body of a /poll response. Each of Data is an
+// interaction encrypted with AES-256-CFB under a key that AESKey carries,
+// encrypted with RSA-OAEP to the session's public key.
+type interactshPollResponse struct {
+	Data   []string `json:"data"`
+	Extra  []string `json:"extra"`
+	AESKey string   `json:"aes_key"`
+}
+
+// interactshInteraction is an interaction as interactsh clients decode it.
+type interactshInteraction struct {
+	Protocol      string `json:"protocol"`
+	UniqueID      string `json:"unique-id"`
+	FullID        string `json:"full-id"`
+	QType         string `json:"q-type,omitempty"`
+	RawRequest    string `json:"raw-request,omitempty"`
+	RawResponse   string `json:"raw-response,omitempty"`
+	SMTPFrom      string `json:"smtp-from,omitempty"`
+	RemoteAddress string `json:"remote-address"`
+	Timestamp     string `json:"timestamp"`
+}
+
+func (h *InteractshHandler) poll(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	sess, tok, ok := h.session(w, r, q.Get("id"), q.Get("secret"))
+	if !ok {
+		return
+	}
+	pub, err := parseRSAPublicKey(sess.PublicKey)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "invalid public-key"})
+		return
+	}
+
+	interactions, err := h.API.Store.ListInteractionDetails(tok.ID, db.InteractionFilter{
+		SinceID: sess.LastPolledID, Limit: interactshPollLimit, Ascending: true,
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	encKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "could not encrypt"})
+		return
+	}
+
+	resp := interactshPollResponse{
+		Data:   make([]string, 0, len(interactions)),
+		Extra:  []string{},
+		AESKey: base64.StdEncoding.EncodeToString(encKey),
+	}
+	for _, i := range interactions {
+		b, err := json.Marshal(h.interaction(sess.CorrelationID, i))
+		if err != nil {
+			continue
+		}
+		ct, err := encryptCFB(key, b)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "could not encrypt"})
+			return
+		}
+		resp.Data = append(resp.Data, base64.StdEncoding.EncodeToString(ct))
+	}
+
+	if n := len(interactions); n > 0 {
+		if err := h.API.Store.SetInteractshPolled(sess.CorrelationID, interactions[n-1].ID); err != nil {
+			writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *InteractshHandler) deregister(w http.ResponseWriter, r *http.Request) {
+	var req interactshRegisterRequest
+	if !req.decode(w, r) {
+		return
+	}
+	sess, _, ok := h.session(w, r, req.CorrelationID, req.SecretKey)
+	if !ok {
+		return
+	}
+	// The token is kept, so its interactions stay available through the API
+	// until it expires.
+	if err := h.API.Store.DeleteInteractshSession(sess.CorrelationID); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "deregistration successful"})
+}
+
+// interaction converts a stored interaction for the session with the given
+// correlation ID.
+func (h *InteractshHandler) interaction(correlationID string, i models.InteractionDetails) interactshInteraction {
+	out := interactshInteraction{
+		Protocol:      i.Kind,
+		UniqueID:      correlationID,
+		RemoteAddress: i.RemoteIP,
+		Timestamp:     time.Unix(i.OccurredAt, 0).UTC().Format(time.RFC3339Nano),
+	}
+	if id, ok := i.Attributes[interactsh.Attribute].(string); ok {
+		out.UniqueID = id
+	}
+	out.FullID = out.UniqueID
+
+	switch {
+	case i.HTTP != nil:
+		out.FullID = h.fullID(i.HTTP.Host, out.UniqueID)
+		out.RawRequest, out.RawResponse = rawHTTP(i.HTTP)
+	case i.DNS != nil:
+		out.FullID = h.fullID(i.DNS.QName, out.UniqueID)
+		out.QType = dns.TypeToString[uint16(i.DNS.QType)]
+		query, reply := dnsMessages(i.DNS)
+		out.RawRequest = query.String()
+		if reply != nil {
+			out.RawResponse = reply.String()
+		}
+	default:
+		p, err := h.API.Store.GetProtocolInteraction(i.ID)
+		if err != nil {
+			h.API.Logger.Warn("failed to get protocol interaction",
+				zap.Int64("interaction_id", i.ID),
+				zap.Error(err))
+		}
+		if p != nil {
+			out.RawRequest = string(p.Raw)
+		}
+	}
+	return out
+}
+
+// fullID returns the labels of host before its domain, as interactsh clients
+// report them, or uniqueID if host is not under one of the domains.
+func (h *InteractshHandler) fullID(host, uniqueID string) string {
+	if hp, _, err := net.SplitHostPort(host); err == nil {
+		host = hp
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	domain := matchDomain(host, append([]string{h.Domain}, h.Domains...)...)
+	if sub, ok := strings.CutSuffix(host, "."+domain); ok && domain != "" && sub != "" {
+		return sub
+	}
+	return uniqueID
+}
+
+// encryptCFB encrypts plaintext with AES in CFB mode, as interactsh clients
+// decrypt poll results, returning a random IV followed by the ciphertext.
+// crypto/cipher's CFB is deprecated, so the mode is applied here directly.
+func encryptCFB(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, aes.BlockSize+len(plaintext))
+	iv := out[:aes.BlockSize]
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	// Each block of keystream is the encryption of the previous ciphertext
+	// block, starting from the IV.
+	stream := make([]byte, aes.BlockSize)
+	prev := iv
+	for off := 0; off < len(plaintext); off += aes.BlockSize {
+		block.Encrypt(stream, prev)
+		end := min(off+aes.BlockSize, len(plaintext))
+		ct := out[aes.BlockSize+off : aes.BlockSize+end]
+		subtle.XORBytes(ct, plaintext[off:end], stream)
+		prev = ct
+	}
+	return out, nil
+}
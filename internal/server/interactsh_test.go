@@ -0,0 +1,207 @@
+package server
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/core/interactsh"
+)
+
+const testCorrelationID = "cn5g2hbc9jmp0s2vq7a0"
+
+// interactshClient plays an interactsh client against an HTTPServer.
+type interactshClient struct {
+	t    *testing.T
+	srv  *HTTPServer
+	key  *rsa.PrivateKey
+	auth string
+}
+
+func setupInteractsh(t *testing.T, anonymous bool) (*interactshClient, *db.SQLite) {
+	t.Helper()
+	api, displayKey, cleanup := setupTestAPIServer(t)
+	t.Cleanup(cleanup)
+	store := api.Store.(*db.SQLite)
+
+	pipeline := setupPipeline(t, store.DB)
+	p := interactsh.New(store)
+	_ = p.Init(plugins.InitContext{Logger: zap.NewNop()})
+	pipeline.Register(p)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return &interactshClient{
+		t: t,
+		srv: &HTTPServer{
+			Pipeline:   pipeline,
+			Domain:     api.Domain,
+			Logger:     zap.NewNop(),
+			Interactsh: &InteractshHandler{API: api, Domain: api.Domain, Anonymous: anonymous},
+		},
+		key:  key,
+		auth: displayKey,
+	}, store
+}
+
+func (c *interactshClient) do(method, target, body string) *httptest.ResponseRecorder {
+	c.t.Helper()
+	req := httptest.NewRequest(method, "http://oastrix.example.com"+target, strings.NewReader(body))
+	if c.auth != "" {
+		req.Header.Set("Authorization", c.auth)
+	}
+	w := httptest.NewRecorder()
+	c.srv.ServeHTTP(w, req)
+	return w
+}
+
+func (c *interactshClient) register() *httptest.ResponseRecorder {
+	c.t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&c.key.PublicKey)
+	if err != nil {
+		c.t.Fatalf("marshal public key: %v", err)
+	}
+	pub := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: der})
+	body, _ := json.Marshal(map[string]string{
+		"public-key":     base64.StdEncoding.EncodeToString(pub),
+		"secret-key":     "s3cret",
+		"correlation-id": testCorrelationID,
+	})
+	return c.do(http.MethodPost, "/register", string(body))
+}
+
+// poll polls with secret and decrypts the interactions returned.
+func (c *interactshClient) poll(secret string) (int, []interactshInteraction) {
+	c.t.Helper()
+	w := c.do(http.MethodGet, "/poll?id="+testCorrelationID+"&secret="+secret, "")
+	if w.Code != http.StatusOK {
+		return w.Code, nil
+	}
+	var resp interactshPollResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		c.t.Fatalf("decode poll response: %v", err)
+	}
+	encKey, _ := base64.StdEncoding.DecodeString(resp.AESKey)
+	key, err := rsa.DecryptOAEP(sha256.New(), nil, c.key, encKey, nil)
+	if err != nil {
+		c.t.Fatalf("decrypt aes_key: %v", err)
+	}
+
+	var out []interactshInteraction
+	for _, d := range resp.Data {
+		ct, _ := base64.StdEncoding.DecodeString(d)
+		var i interactshInteraction
+		if err := json.Unmarshal(decryptCFB(c.t, key, ct), &i); err != nil {
+			c.t.Fatalf("decode interaction: %v", err)
+		}
+		out = append(out, i)
+	}
+	return w.Code, out
+}
+
+// decryptCFB reverses encryptCFB as interactsh clients do.
+func decryptCFB(t *testing.T, key, ct []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("new cipher: %v", err)
+	}
+	iv, ct := ct[:aes.BlockSize], ct[aes.BlockSize:]
+	out := make([]byte, len(ct))
+	stream := make([]byte, aes.BlockSize)
+	for off := 0; off < len(ct); off += aes.BlockSize {
+		block.Encrypt(stream, iv)
+		end := min(off+aes.BlockSize, len(ct))
+		subtle.XORBytes(out[off:end], ct[off:end], stream)
+		iv = ct[off:end]
+	}
+	return out
+}
+
+func TestInteractshRoundTrip(t *testing.T) {
+	c, store := setupInteractsh(t, false)
+	if w := c.register(); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "registration successful") {
+		t.Fatalf("register: %d %s", w.Code, w.Body)
+	}
+	if w := c.register(); w.Code != http.StatusConflict {
+		t.Errorf("second register: %d, want a conflict", w.Code)
+	}
+	tok, err := store.GetTokenByValue(testCorrelationID)
+	if err != nil || tok == nil || tok.APIKeyID == nil || tok.ExpiresAt == nil {
+		t.Fatalf("token = %+v, %v, want one owned by the key that expires", tok, err)
+	}
+
+	label := testCorrelationID + "abcdefghijklm"
+	req := httptest.NewRequest(http.MethodGet, "http://x."+label+".oastrix.example.com/probe?a=1", nil)
+	req.Header.Set("User-Agent", "curl/8")
+	c.srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	code, got := c.poll("s3cret")
+	if code != http.StatusOK || len(got) != 1 {
+		t.Fatalf("poll: %d with %d interactions, want 1", code, len(got))
+	}
+	i := got[0]
+	if i.Protocol != "http" || i.UniqueID != label || i.FullID != "x."+label || i.RemoteAddress != "192.0.2.1" {
+		t.Errorf("interaction = %+v", i)
+	}
+	if !strings.HasPrefix(i.RawRequest, "GET /probe?a=1 HTTP/1.1\r\nHost: x."+label) || !strings.Contains(i.RawRequest, "User-Agent: curl/8\r\n") {
+		t.Errorf("raw-request = %q", i.RawRequest)
+	}
+
+	if _, got := c.poll("s3cret"); len(got) != 0 {
+		t.Errorf("second poll returned %d interactions, want none", len(got))
+	}
+	if code, _ := c.poll("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("poll with the wrong secret: %d", code)
+	}
+	c.auth = ""
+	if code, _ := c.poll("s3cret"); code != http.StatusUnauthorized {
+		t.Errorf("poll without the key: %d", code)
+	}
+}
+
+func TestInteractshDeregister(t *testing.T) {
+	c, store := setupInteractsh(t, true)
+	c.auth = ""
+	if w := c.register(); w.Code != http.StatusOK {
+		t.Fatalf("anonymous register: %d %s", w.Code, w.Body)
+	}
+	if code, _ := c.poll("s3cret"); code != http.StatusOK {
+		t.Errorf("anonymous poll: %d", code)
+	}
+
+	w := c.do(http.MethodPost, "/deregister", `{"correlation-id":"`+testCorrelationID+`","secret-key":"s3cret"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("deregister: %d %s", w.Code, w.Body)
+	}
+	if sess, _ := store.GetInteractshSession(testCorrelationID); sess != nil {
+		t.Error("session kept after deregistering")
+	}
+	if tok, _ := store.GetTokenByValue(testCorrelationID); tok == nil {
+		t.Error("token deleted with the session")
+	}
+}
+
+func TestInteractshRequiresKey(t *testing.T) {
+	c, _ := setupInteractsh(t, false)
+	c.auth = ""
+	if w := c.register(); w.Code != http.StatusUnauthorized {
+		t.Errorf("register without a key: %d", w.Code)
+	}
+}
@@ -3,8 +3,12 @@ package server
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"strings"
 	"time"
 
 	"go.uber.org/zap"
@@ -13,7 +17,9 @@ import (
 
 // Config holds configuration for an HTTP server.
 type Config struct {
+	Network           string // "tcp" (default) or "unix"
 	Addr              string
+	Listeners         []net.Listener // if set, served instead of listening on Network and Addr, e.g. several addresses or sockets passed by systemd
 	Handler           http.Handler
 	TLSConfig         *tls.Config
 	Logger            *zap.Logger
@@ -36,12 +42,14 @@ func DefaultServerConfig(addr string, handler http.Handler, logger *zap.Logger)
 
 // ManagedServer wraps an HTTP server with lifecycle management.
 type ManagedServer struct {
-	server   *http.Server
-	logger   *zap.Logger
-	name     string
-	useTLS   bool
-	errCh    chan error
-	startErr error
+	server    *http.Server
+	network   string
+	listeners []net.Listener
+	logger    *zap.Logger
+	name      string
+	useTLS    bool
+	errCh     chan error
+	startErr  error
 }
 
 // NewManagedServer creates a new managed HTTP server.
@@ -60,24 +68,26 @@ func NewManagedServer(name string, cfg Config) *ManagedServer {
 
 	useTLS := cfg.TLSConfig != nil
 
+	network := cfg.Network
+	if network == "" {
+		network = "tcp"
+	}
+
 	return &ManagedServer{
-		server: srv,
-		logger: cfg.Logger,
-		name:   name,
-		useTLS: useTLS,
-		errCh:  make(chan error, 1),
+		server:    srv,
+		network:   network,
+		listeners: cfg.Listeners,
+		logger:    cfg.Logger,
+		name:      name,
+		useTLS:    useTLS,
+		errCh:     make(chan error, 1),
 	}
 }
 
 // Start begins listening and serving in a background goroutine.
 func (m *ManagedServer) Start() {
 	go func() {
-		var err error
-		if m.useTLS {
-			err = m.server.ListenAndServeTLS("", "")
-		} else {
-			err = m.server.ListenAndServe()
-		}
+		err := m.serve()
 		if err != nil && err != http.ErrServerClosed {
 			m.errCh <- err
 		}
@@ -85,6 +95,71 @@ func (m *ManagedServer) Start() {
 	}()
 }
 
+// serve serves each listener until the server is shut down, returning the
+// first listener's error.
+func (m *ManagedServer) serve() error {
+	lns := m.listeners
+	if len(lns) == 0 {
+		ln, err := Listen(m.network, m.server.Addr)
+		if err != nil {
+			return err
+		}
+		lns = []net.Listener{ln}
+	}
+
+	errCh := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func() {
+			if m.useTLS {
+				errCh <- m.server.ServeTLS(ln, "", "")
+			} else {
+				errCh <- m.server.Serve(ln)
+			}
+		}()
+	}
+	return <-errCh
+}
+
+// Listen opens a listener on network. Unix sockets left behind by an unclean
+// shutdown are replaced, and new sockets are restricted to the owner and group
+// so access can be granted to a reverse proxy through group membership.
+func Listen(network, addr string) (net.Listener, error) {
+	if network != "unix" {
+		return net.Listen(network, addr)
+	}
+
+	if fi, err := os.Lstat(addr); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(addr); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+	ln, err := net.Listen("unix", addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(addr, 0o660); err != nil {
+		_ = ln.Close()
+		return nil, fmt.Errorf("chmod socket: %w", err)
+	}
+	return ln, nil
+}
+
+// ParseListenAddr splits a listen address of the form "unix:///path/to.sock"
+// or "host:port" into a network and address suitable for Config.
+func ParseListenAddr(s string) (network, addr string, err error) {
+	if path, ok := strings.CutPrefix(s, "unix://"); ok {
+		if path == "" {
+			return "", "", errors.New("unix socket path required")
+		}
+		return "unix", path, nil
+	}
+
+	if _, port, err := net.SplitHostPort(s); err != nil || port == "" {
+		return "", "", fmt.Errorf("invalid listen address %q: want host:port or unix:///path", s)
+	}
+	return "tcp", s, nil
+}
+
 // WaitForStartup waits for the server to start or fail within a timeout.
 func (m *ManagedServer) WaitForStartup(timeout time.Duration) error {
 	select {
@@ -99,6 +174,13 @@ func (m *ManagedServer) WaitForStartup(timeout time.Duration) error {
 	}
 }
 
+// Err returns a channel that receives the error the server stops with
+// unless it is shut down, and is closed once it stops. An error received by
+// WaitForStartup is not received again.
+func (m *ManagedServer) Err() <-chan error {
+	return m.errCh
+}
+
 // Shutdown gracefully stops the server.
 func (m *ManagedServer) Shutdown(ctx context.Context) {
 	if m.startErr != nil {
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestParseListenAddr(t *testing.T) {
+	tests := []struct {
+		in          string
+		wantNetwork string
+		wantAddr    string
+		wantErr     bool
+	}{
+		{"unix:///run/oastrix/api.sock", "unix", "/run/oastrix/api.sock", false},
+		{"127.0.0.1:8081", "tcp", "127.0.0.1:8081", false},
+		{"[::1]:8081", "tcp", "[::1]:8081", false},
+		{":8443", "tcp", ":8443", false},
+		{"unix://", "", "", true},
+		{"8081", "", "", true},
+		{"127.0.0.1:", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			network, addr, err := ParseListenAddr(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseListenAddr(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if network != tt.wantNetwork || addr != tt.wantAddr {
+				t.Errorf("ParseListenAddr(%q) = %q, %q, want %q, %q", tt.in, network, addr, tt.wantNetwork, tt.wantAddr)
+			}
+		})
+	}
+}
+
+func TestManagedServer_UnixSocket(t *testing.T) {
+	sock := filepath.Join(t.TempDir(), "api.sock")
+
+	// A stale socket from a previous run must not prevent startup.
+	stale, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatalf("create stale socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	})
+	cfg := DefaultServerConfig(sock, handler, zap.NewNop())
+	cfg.Network = "unix"
+	srv := NewManagedServer("api", cfg)
+	srv.Start()
+	if err := srv.WaitForStartup(100 * time.Millisecond); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	fi, err := os.Stat(sock)
+	if err != nil {
+		t.Fatalf("stat socket: %v", err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o660 {
+		t.Errorf("socket permissions = %o, want 660", perm)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", sock)
+		},
+	}}
+	resp, err := client.Get("http://oastrix/")
+	if err != nil {
+		t.Fatalf("request over unix socket: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "ok" {
+		t.Errorf("body = %q, want %q", body, "ok")
+	}
+}
+
+func TestManagedServer_Listeners(t *testing.T) {
+	var lns []net.Listener
+	for range 2 {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lns = append(lns, ln)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	})
+	// The address is unusable, so the server must serve lns rather than listen.
+	cfg := DefaultServerConfig("invalid", handler, zap.NewNop())
+	cfg.Listeners = lns
+	srv := NewManagedServer("http", cfg)
+	srv.Start()
+	if err := srv.WaitForStartup(100 * time.Millisecond); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	for _, ln := range lns {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err != nil {
+			t.Fatalf("request: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if string(body) != "ok" {
+			t.Errorf("%s: body = %q, want %q", ln.Addr(), body, "ok")
+		}
+	}
+}
+
+func TestManagedServer_ErrAfterStartup(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultServerConfig("", http.NotFoundHandler(), zap.NewNop())
+	cfg.Listeners = []net.Listener{ln}
+	srv := NewManagedServer("http", cfg)
+	srv.Start()
+	if err := srv.WaitForStartup(50 * time.Millisecond); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	defer srv.Shutdown(context.Background())
+
+	// The listener dying under the server is reported.
+	_ = ln.Close()
+	select {
+	case err := <-srv.Err():
+		if err == nil {
+			t.Error("Err() closed without an error after the listener failed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error after the listener failed")
+	}
+}
+
+func TestManagedServer_ErrClosedOnShutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultServerConfig("", http.NotFoundHandler(), zap.NewNop())
+	cfg.Listeners = []net.Listener{ln}
+	srv := NewManagedServer("http", cfg)
+	srv.Start()
+	if err := srv.WaitForStartup(50 * time.Millisecond); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	srv.Shutdown(context.Background())
+	select {
+	case err, ok := <-srv.Err():
+		if ok {
+			t.Errorf("Err() received %v after Shutdown, want it closed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Err() not closed after Shutdown")
+	}
+}
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/requestid"
+	"go.uber.org/zap"
+)
+
+// logLevelsPath is where the server's log levels are served. They apply to
+// the whole server, so reading and changing them needs the full scope.
+const logLevelsPath = "/v2/admin/log-levels"
+
+func (s *APIServer) handleGetLogLevelsV2(w http.ResponseWriter, r *http.Request) {
+	if s.LogLevels == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "log levels not configurable"})
+		return
+	}
+	writeJSON(w, http.StatusOK, apitypes.LogLevels{Levels: s.LogLevels.String()})
+}
+
+// handleSetLogLevelsV2 replaces the log levels until they are next changed
+// or the server restarts.
+func (s *APIServer) handleSetLogLevelsV2(w http.ResponseWriter, r *http.Request) {
+	if s.LogLevels == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "log levels not configurable"})
+		return
+	}
+	var req apitypes.LogLevels
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := s.LogLevels.Set(req.Levels); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	levels := s.LogLevels.String()
+	requestid.Logger(r.Context(), s.Logger).Info("log levels changed", zap.String("levels", levels), zap.Int64("api_key_id", getAPIKeyID(r)))
+	writeJSON(w, http.StatusOK, apitypes.LogLevels{Levels: levels})
+}
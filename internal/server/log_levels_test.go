@@ -0,0 +1,64 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/logging"
+)
+
+func TestLogLevelsV2(t *testing.T) {
+	srv, fullKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	adminKey := createAdminKey(t, srv)
+
+	var resp apitypes.LogLevels
+	if code := getV2(t, srv, adminKey, logLevelsPath, &resp); code != http.StatusNotFound {
+		t.Errorf("without levels: status %d, want 404", code)
+	}
+
+	levels, err := logging.ParseLevels("info")
+	if err != nil {
+		t.Fatalf("ParseLevels failed: %v", err)
+	}
+	srv.LogLevels = levels
+
+	put := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, logLevelsPath, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+	// Levels are server-wide, so tenant keys cannot read or change them.
+	if code := getV2(t, srv, fullKey, logLevelsPath, nil); code != http.StatusForbidden {
+		t.Errorf("GET with a full-scope key: status %d, want 403", code)
+	}
+	if w := put(fullKey, `{"levels":"debug"}`); w.Code != http.StatusForbidden {
+		t.Errorf("PUT with a full-scope key: status %d, want 403", w.Code)
+	}
+
+	w := put(adminKey, `{"levels":"warn,dns=debug"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT: status %d: %s", w.Code, w.Body)
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Levels != "warn,dns=debug" {
+		t.Errorf("PUT response = %+v, %v", resp, err)
+	}
+	if levels.Level("dns") != zapcore.DebugLevel || levels.Level("http") != zapcore.WarnLevel {
+		t.Errorf("levels = %s, want warn,dns=debug", levels)
+	}
+
+	if w := put(adminKey, `{"levels":"dns=loud"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid level: status %d, want 400", w.Code)
+	}
+	if code := getV2(t, srv, adminKey, logLevelsPath, &resp); code != http.StatusOK || resp.Levels != "warn,dns=debug" {
+		t.Errorf("GET = %d %+v, want the levels unchanged", code, resp)
+	}
+}
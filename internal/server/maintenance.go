@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"time"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"go.uber.org/zap"
+)
+
+// maintenanceMetrics publishes database maintenance runs, errors, their last
+// duration, and the pages checkpointed and freed, under /debug/vars.
+var maintenanceMetrics = expvar.NewMap("db_maintenance")
+
+// DBMaintainer periodically checkpoints the database's write-ahead log,
+// refreshes its query planner statistics and frees unused pages, so that
+// long-running servers keep a small WAL and good query plans.
+type DBMaintainer struct {
+	DB       *sql.DB
+	Logger   *zap.Logger
+	Interval time.Duration
+}
+
+// Run maintains the database every Interval until ctx is cancelled.
+func (m *DBMaintainer) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Maintain()
+		}
+	}
+}
+
+// Maintain runs the maintenance once.
+func (m *DBMaintainer) Maintain() {
+	start := time.Now()
+	res, err := db.Maintain(m.DB)
+	elapsed := time.Since(start)
+
+	maintenanceMetrics.Add("runs", 1)
+	duration := new(expvar.Int)
+	duration.Set(elapsed.Milliseconds())
+	maintenanceMetrics.Set("last_duration_ms", duration)
+	if err != nil {
+		maintenanceMetrics.Add("errors", 1)
+		m.Logger.Warn("database maintenance failed", zap.Duration("duration", elapsed), zap.Error(err))
+		return
+	}
+	maintenanceMetrics.Add("wal_pages_checkpointed", int64(res.Checkpointed))
+	maintenanceMetrics.Add("pages_freed", int64(res.FreedPages))
+	if res.Busy {
+		maintenanceMetrics.Add("busy_checkpoints", 1)
+	}
+	m.Logger.Info("database maintenance completed",
+		zap.Duration("duration", elapsed),
+		zap.Int("wal_pages", res.WALPages),
+		zap.Int("checkpointed", res.Checkpointed),
+		zap.Bool("busy", res.Busy),
+		zap.Int("pages_freed", res.FreedPages))
+}
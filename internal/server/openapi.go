@@ -0,0 +1,246 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+)
+
+// pathParamPattern matches path parameters, including trailing "{name...}"
+// wildcards, which OpenAPI writes as "{name}".
+var pathParamPattern = regexp.MustCompile(`\{(\w+)(?:\.\.\.)?\}`)
+
+// The documents are built once on first use; they depend only on the route
+// tables and the apitypes definitions.
+var (
+	openAPIV1Spec = sync.OnceValue(func() map[string]any {
+		return buildOpenAPISpec("1.0.0", apiRoutes)
+	})
+	openAPIV2Spec = sync.OnceValue(func() map[string]any {
+		return buildOpenAPISpec("2.0.0", apiV2Routes)
+	})
+)
+
+func serveOpenAPI(spec func() map[string]any) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, spec())
+	}
+}
+
+// buildOpenAPISpec generates an OpenAPI 3.0 document for routes, deriving
+// component schemas from the request and response types by reflection.
+// version is the version of the API described, not of OpenAPI itself.
+func buildOpenAPISpec(version string, routes []route) map[string]any {
+	g := &schemaGenerator{schemas: map[string]any{}}
+	errorRef := g.schemaFor(reflect.TypeFor[apitypes.ErrorResponse]())
+
+	paths := map[string]any{}
+	for _, rt := range routes {
+		p := openAPIPath(rt.path)
+		item, ok := paths[p].(map[string]any)
+		if !ok {
+			item = map[string]any{}
+			paths[p] = item
+		}
+		item[strings.ToLower(rt.method)] = g.operation(rt, errorRef)
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   "oastrix API",
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":   "http",
+					"scheme": "bearer",
+				},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []string{}}},
+	}
+}
+
+type schemaGenerator struct {
+	schemas map[string]any
+}
+
+func (g *schemaGenerator) operation(rt route, errorRef map[string]any) map[string]any {
+	var params []any
+	for _, m := range pathParamPattern.FindAllStringSubmatch(rt.path, -1) {
+		params = append(params, map[string]any{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+	}
+	for _, q := range rt.query {
+		schema := map[string]any{"type": q.typ}
+		if q.format != "" {
+			schema["format"] = q.format
+		}
+		params = append(params, map[string]any{
+			"name":        q.name,
+			"in":          "query",
+			"description": q.description,
+			"schema":      schema,
+		})
+	}
+
+	mediaType := "application/json"
+	description := "Success."
+	if rt.stream {
+		mediaType = "text/event-stream"
+		description = "Server-sent events; each interaction event carries one JSON-encoded object."
+	}
+	if rt.export {
+		mediaType = "application/x-ndjson"
+		description = "One JSON-encoded object per line, or CSV rows or CEF or LEEF events when requested."
+	}
+
+	op := map[string]any{
+		"operationId": operationID(rt),
+		"summary":     rt.summary,
+		"description": "Requires the " + string(rt.scope) + " scope.",
+		"responses": map[string]any{
+			"200": map[string]any{
+				"description": description,
+				"content": map[string]any{
+					mediaType: map[string]any{"schema": g.schemaFor(reflect.TypeOf(rt.response))},
+				},
+			},
+			"default": map[string]any{
+				"description": "Error.",
+				"content": map[string]any{
+					"application/json": map[string]any{"schema": errorRef},
+				},
+			},
+		},
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if rt.upload {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content": map[string]any{
+				"*/*": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+			},
+		}
+	}
+	if rt.request != nil {
+		op["requestBody"] = map[string]any{
+			"content": map[string]any{
+				"application/json": map[string]any{"schema": g.schemaFor(reflect.TypeOf(rt.request))},
+			},
+		}
+	}
+	return op
+}
+
+// openAPIPath returns the OpenAPI form of a route path.
+func openAPIPath(path string) string {
+	return strings.ReplaceAll(path, "...}", "}")
+}
+
+// operationID derives a stable identifier from the route, dropping the
+// version segment, e.g. "GET /v1/tokens/{token}/interactions" becomes
+// "getTokensTokenInteractions".
+func operationID(rt route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(rt.method))
+	parts := strings.Split(strings.Trim(rt.path, "/"), "/")
+	for _, part := range parts[1:] {
+		part = strings.Trim(part, "{}.")
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// schemaFor returns the schema for t. Named struct types are registered as
+// components and referenced by name.
+func (g *schemaGenerator) schemaFor(t reflect.Type) map[string]any {
+	if t == reflect.TypeFor[json.RawMessage]() {
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := g.schemaFor(t.Elem())
+		if _, isRef := s["$ref"]; isRef {
+			// Siblings of $ref are ignored in OpenAPI 3.0.
+			return map[string]any{"allOf": []any{s}, "nullable": true}
+		}
+		s["nullable"] = true
+		return s
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint8, reflect.Uint16:
+		return map[string]any{"type": "integer"}
+	case reflect.Int32, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Interface:
+		return map[string]any{}
+	case reflect.Struct:
+		name := t.Name()
+		if _, ok := g.schemas[name]; !ok {
+			// Register before recursing so self-referential types terminate.
+			g.schemas[name] = nil
+			g.schemas[name] = g.structSchema(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	default:
+		panic("openapi: unsupported type " + t.String())
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = g.schemaFor(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+)
+
+func fetchOpenAPISpec(t *testing.T) map[string]any {
+	t.Helper()
+
+	srv, _, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/v1/openapi.json", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 without authentication, got %d", w.Code)
+	}
+
+	var spec map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("decode spec: %v", err)
+	}
+	return spec
+}
+
+func TestOpenAPI_CoversRoutes(t *testing.T) {
+	spec := fetchOpenAPISpec(t)
+
+	if spec["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v, want 3.0.3", spec["openapi"])
+	}
+
+	paths, _ := spec["paths"].(map[string]any)
+	operationIDs := map[string]bool{}
+	for _, rt := range apiRoutes {
+		item, _ := paths[openAPIPath(rt.path)].(map[string]any)
+		op, ok := item[strings.ToLower(rt.method)].(map[string]any)
+		if !ok {
+			t.Errorf("missing operation %s %s", rt.method, rt.path)
+			continue
+		}
+		id, _ := op["operationId"].(string)
+		if operationIDs[id] {
+			t.Errorf("duplicate operationId %q", id)
+		}
+		operationIDs[id] = true
+
+		if strings.Contains(rt.path, "{token}") {
+			params, _ := op["parameters"].([]any)
+			if len(params) == 0 || params[0].(map[string]any)["name"] != "token" {
+				t.Errorf("%s %s: missing token path parameter", rt.method, rt.path)
+			}
+		}
+	}
+}
+
+// TestOpenAPI_RefsResolve walks the whole document and checks every $ref
+// points at a defined component schema.
+func TestOpenAPI_RefsResolve(t *testing.T) {
+	spec := fetchOpenAPISpec(t)
+	schemas := spec["components"].(map[string]any)["schemas"].(map[string]any)
+
+	var walk func(path string, v any)
+	walk = func(path string, v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				name := strings.TrimPrefix(ref, "#/components/schemas/")
+				if name == ref {
+					t.Errorf("%s: unexpected $ref %q", path, ref)
+				} else if schemas[name] == nil {
+					t.Errorf("%s: unresolved $ref %q", path, ref)
+				}
+			}
+			for k, child := range v {
+				walk(path+"/"+k, child)
+			}
+		case []any:
+			for _, child := range v {
+				walk(path+"/[]", child)
+			}
+		}
+	}
+	walk("#", spec)
+}
+
+func TestOpenAPI_SchemaMatchesTypes(t *testing.T) {
+	g := &schemaGenerator{schemas: map[string]any{}}
+	g.schemaFor(reflect.TypeFor[apitypes.InteractionResponse]())
+
+	ir := g.schemas["InteractionResponse"].(map[string]any)
+	props := ir["properties"].(map[string]any)
+	for _, name := range []string{"id", "kind", "occurred_at", "remote_ip", "remote_port", "tls", "summary", "http", "dns"} {
+		if _, ok := props[name]; !ok {
+			t.Errorf("InteractionResponse missing property %q", name)
+		}
+	}
+
+	required := ir["required"].([]string)
+	for _, name := range required {
+		if name == "http" || name == "dns" {
+			t.Errorf("omitempty field %q marked required", name)
+		}
+	}
+	if props["id"].(map[string]any)["format"] != "int64" {
+		t.Errorf("id format = %v, want int64", props["id"])
+	}
+	if _, ok := g.schemas["HTTPInteractionDetail"]; !ok {
+		t.Error("nested HTTPInteractionDetail not registered as a component")
+	}
+
+	g.schemaFor(reflect.TypeFor[apitypes.TokenInfo]())
+	label := g.schemas["TokenInfo"].(map[string]any)["properties"].(map[string]any)["label"].(map[string]any)
+	if label["nullable"] != true {
+		t.Errorf("pointer field label not nullable: %v", label)
+	}
+}
+
+func TestOperationID(t *testing.T) {
+	tests := []struct {
+		method, path, want string
+	}{
+		{"GET", "/v1/tokens", "getTokens"},
+		{"GET", "/v1/tokens/{token}/interactions", "getTokensTokenInteractions"},
+		{"POST", "/v1/interactions/purge", "postInteractionsPurge"},
+	}
+	for _, tt := range tests {
+		if got := operationID(route{method: tt.method, path: tt.path}); got != tt.want {
+			t.Errorf("operationID(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
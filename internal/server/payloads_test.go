@@ -0,0 +1,117 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/plugins"
+)
+
+type payloadPlugin struct{ mockPlugin }
+
+func (p *payloadPlugin) Payloads(pc plugins.PayloadContext) []plugins.Payload {
+	return []plugins.Payload{{Name: "probe", Category: "test", Value: "https://" + pc.Token + "." + pc.Domain + "/probe.js"}}
+}
+
+func TestListPayloads(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	srv.PublicIP = "203.0.113.10"
+	pipeline := plugins.NewPipeline(nil)
+	pipeline.Register(&payloadPlugin{mockPlugin{id: "probe"}})
+	srv.Plugins = pipeline
+
+	req := httptest.NewRequest("POST", "/v1/tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	var created apitypes.CreateTokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "/v1/tokens/"+created.Token+"/payloads", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp apitypes.ListPayloadsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	if len(resp.Payloads) != len(created.Catalog) {
+		t.Errorf("catalog has %d payloads, create response had %d", len(resp.Payloads), len(created.Catalog))
+	}
+
+	host := created.Token + ".oastrix.example.com"
+	byName := make(map[string]apitypes.Payload)
+	for _, p := range resp.Payloads {
+		if _, dup := byName[p.Name]; dup {
+			t.Errorf("duplicate payload name %q", p.Name)
+		}
+		byName[p.Name] = p
+		if p.Name != "http_ip" && p.Name != "https_ip" && !strings.Contains(p.Value, host) {
+			t.Errorf("payload %q = %q does not reference %s", p.Name, p.Value, host)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"dns":       host,
+		"log4j_dns": "${jndi:dns://" + host + "/a}",
+		"http_ip":   "http://203.0.113.10/oast/" + created.Token,
+		"probe":     "https://" + host + "/probe.js",
+	} {
+		if got := byName[name].Value; got != want {
+			t.Errorf("payload %q = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestListPayloadsDomain(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	srv.Domains = []string{"oob.example.net"}
+
+	req := httptest.NewRequest("POST", "/v1/tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+displayKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	var created apitypes.CreateTokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	list := func(domain string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/tokens/"+created.Token+"/payloads?domain="+domain, nil)
+		req.Header.Set("Authorization", "Bearer "+displayKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	w = list("OOB.example.net")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	var resp apitypes.ListPayloadsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if want := created.Token + ".oob.example.net"; len(resp.Payloads) == 0 || resp.Payloads[0].Value != want {
+		t.Errorf("payloads = %v, want first %q", resp.Payloads, want)
+	}
+
+	if w := list("other.example"); w.Code != http.StatusBadRequest {
+		t.Errorf("unknown domain: expected status 400, got %d", w.Code)
+	}
+}
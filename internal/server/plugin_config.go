@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/auth"
+	"github.com/rsclarke/oastrix/internal/plugins"
+)
+
+// globalPluginConfigPath is where a plugin's server-wide configuration is
+// served. It applies to every API key and may hold credentials, so reading or
+// changing it needs the admin scope.
+const globalPluginConfigPath = "/v1/plugins/{pluginID}/config"
+
+var globalPluginConfigRoutes = []route{
+	{
+		method: "GET", path: globalPluginConfigPath, scope: auth.ScopeAdmin,
+		handler: (*APIServer).handleGetPluginConfig, summary: "Get a plugin's server-wide configuration",
+		response: json.RawMessage{},
+	},
+	{
+		method: "PUT", path: globalPluginConfigPath, scope: auth.ScopeAdmin,
+		handler: (*APIServer).handleSetPluginConfig, summary: "Set a plugin's server-wide configuration",
+		request: json.RawMessage{}, response: json.RawMessage{},
+	},
+	{
+		method: "DELETE", path: globalPluginConfigPath, scope: auth.ScopeAdmin,
+		handler: (*APIServer).handleDeletePluginConfig, summary: "Reset a plugin's server-wide configuration to its defaults",
+		response: apitypes.DeletePluginConfigResponse{},
+	},
+}
+
+// handleGetPluginConfig returns the plugin's stored configuration, with its
+// secrets redacted if the plugin's configuration type is known.
+func (s *APIServer) handleGetPluginConfig(w http.ResponseWriter, r *http.Request) {
+	pluginID := r.PathValue("pluginID")
+	var cfg any = new(json.RawMessage)
+	if gc, ok := s.globalConfigurable(pluginID); ok {
+		cfg = gc.NewGlobalConfig()
+	}
+	found, err := s.Store.GetPluginConfig(pluginID, cfg)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "plugin config not set"})
+		return
+	}
+	plugins.RedactSecrets(cfg)
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+// handleSetPluginConfig decodes the request body into the plugin's own
+// configuration type, rejecting unknown fields, values that fail the
+// plugin's validation and secrets left redacted from a GET.
+func (s *APIServer) handleSetPluginConfig(w http.ResponseWriter, r *http.Request) {
+	pluginID := r.PathValue("pluginID")
+	var plugin plugins.Plugin
+	ok := false
+	if s.Plugins != nil {
+		plugin, ok = s.Plugins.Plugin(pluginID)
+	}
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "plugin not found"})
+		return
+	}
+	gc, ok := plugin.(plugins.GlobalConfigurablePlugin)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "plugin has no server-wide configuration"})
+		return
+	}
+
+	cfg := gc.NewGlobalConfig()
+	if !decodeJSON(w, r, cfg) {
+		return
+	}
+	if plugins.HasRedactedSecret(cfg) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "secrets must be given in full, not as " + plugins.RedactedSecret})
+		return
+	}
+	if v, ok := cfg.(plugins.Validator); ok {
+		if err := v.Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if err := s.Store.SetPluginConfig(pluginID, cfg); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	plugins.RedactSecrets(cfg)
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+// globalConfigurable returns the registered plugin pluginID if it has a
+// server-wide configuration.
+func (s *APIServer) globalConfigurable(pluginID string) (plugins.GlobalConfigurablePlugin, bool) {
+	if s.Plugins == nil {
+		return nil, false
+	}
+	plugin, ok := s.Plugins.Plugin(pluginID)
+	if !ok {
+		return nil, false
+	}
+	gc, ok := plugin.(plugins.GlobalConfigurablePlugin)
+	return gc, ok
+}
+
+func (s *APIServer) handleDeletePluginConfig(w http.ResponseWriter, r *http.Request) {
+	if err := s.Store.DeletePluginConfig(r.PathValue("pluginID")); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, apitypes.DeletePluginConfigResponse{Deleted: true})
+}
@@ -0,0 +1,180 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rsclarke/oastrix/internal/auth"
+	"github.com/rsclarke/oastrix/internal/plugins"
+)
+
+type geoConfig struct {
+	Path string `json:"path"`
+}
+
+func (c geoConfig) Validate() error {
+	if !strings.HasSuffix(c.Path, ".mmdb") {
+		return errors.New("path must name an .mmdb file")
+	}
+	return nil
+}
+
+type globalConfigPlugin struct{ mockPlugin }
+
+func (p *globalConfigPlugin) NewGlobalConfig() any { return new(geoConfig) }
+
+type forwarderConfig struct {
+	URL     string `json:"url"`
+	Token   string `json:"token" secret:"true"`
+	Targets []struct {
+		Name   string `json:"name"`
+		Secret string `json:"secret,omitempty" secret:"true"`
+	} `json:"targets,omitempty"`
+}
+
+type forwarderPlugin struct{ mockPlugin }
+
+func (p *forwarderPlugin) NewGlobalConfig() any { return new(forwarderConfig) }
+
+// createAdminKey adds an admin-scope key to srv's database.
+func createAdminKey(t *testing.T, srv *APIServer) string {
+	t.Helper()
+	key, prefix, hash, err := auth.GenerateAPIKey(testPepper)
+	if err != nil {
+		t.Fatalf("generate API key: %v", err)
+	}
+	if _, err := srv.Store.CreateAPIKey(prefix, hash, string(auth.ScopeAdmin), nil); err != nil {
+		t.Fatalf("create API key: %v", err)
+	}
+	return key
+}
+
+func TestGlobalPluginConfigRoutes(t *testing.T) {
+	srv, _, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	adminKey := createAdminKey(t, srv)
+
+	pipeline := plugins.NewPipeline(nil)
+	pipeline.Register(&globalConfigPlugin{mockPlugin{id: "geoip"}})
+	pipeline.Register(&mockPlugin{id: "plain"})
+	srv.Plugins = pipeline
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+	const path = "/v1/plugins/geoip/config"
+
+	if w := do("GET", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET before set: expected status 404, got %d", w.Code)
+	}
+
+	tests := []struct {
+		path, body string
+		want       int
+	}{
+		{path, `{"path":"/data/geo.csv"}`, http.StatusBadRequest},
+		{path, `{"path":"/data/geo.mmdb","extra":true}`, http.StatusBadRequest},
+		{"/v1/plugins/missing/config", `{}`, http.StatusNotFound},
+		{"/v1/plugins/plain/config", `{}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if w := do("PUT", tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("PUT %s %s: expected status %d, got %d", tt.path, tt.body, tt.want, w.Code)
+		}
+	}
+
+	if w := do("PUT", path, `{"path":"/data/geo.mmdb"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	w := do("GET", path, "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"path":"/data/geo.mmdb"}` {
+		t.Errorf("GET: %d %s", w.Code, w.Body.String())
+	}
+
+	var cfg geoConfig
+	if ok, err := srv.Store.GetPluginConfig("geoip", &cfg); err != nil || !ok || cfg.Path != "/data/geo.mmdb" {
+		t.Errorf("stored config = %+v, %v, %v", cfg, ok, err)
+	}
+
+	if w := do("DELETE", path, ""); w.Code != http.StatusOK {
+		t.Errorf("DELETE: expected status 200, got %d", w.Code)
+	}
+	if w := do("GET", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET after delete: expected status 404, got %d", w.Code)
+	}
+}
+
+func TestGlobalPluginConfigNeedsAdminScope(t *testing.T) {
+	srv, fullKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	adminKey := createAdminKey(t, srv)
+
+	pipeline := plugins.NewPipeline(nil)
+	pipeline.Register(&globalConfigPlugin{mockPlugin{id: "geoip"}})
+	srv.Plugins = pipeline
+
+	const path = "/v1/plugins/geoip/config"
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"path":"/data/geo.mmdb"}`))
+		req.Header.Set("Authorization", "Bearer "+fullKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s with a full-scope key: expected status 403, got %d", method, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest("PUT", path, strings.NewReader(`{"path":"/data/geo.mmdb"}`))
+	req.Header.Set("Authorization", "Bearer "+adminKey)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("PUT with an admin key: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGlobalPluginConfigRedactsSecrets(t *testing.T) {
+	srv, _, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+	adminKey := createAdminKey(t, srv)
+
+	pipeline := plugins.NewPipeline(nil)
+	pipeline.Register(&forwarderPlugin{mockPlugin{id: "forwarder"}})
+	srv.Plugins = pipeline
+
+	do := func(method, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, "/v1/plugins/forwarder/config", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+adminKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	const redacted = `{"url":"https://collector.example.com","token":"REDACTED","targets":[{"name":"a","secret":"REDACTED"},{"name":"b"}]}`
+	w := do("PUT", `{"url":"https://collector.example.com","token":"hec-token","targets":[{"name":"a","secret":"s3cret"},{"name":"b"}]}`)
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != redacted {
+		t.Errorf("PUT: %d %s, want %s", w.Code, w.Body.String(), redacted)
+	}
+	w = do("GET", "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != redacted {
+		t.Errorf("GET: %d %s, want %s", w.Code, w.Body.String(), redacted)
+	}
+
+	// Sending back what GET returned would overwrite the secrets.
+	if w := do("PUT", redacted); w.Code != http.StatusBadRequest {
+		t.Errorf("PUT of redacted secrets: expected status 400, got %d", w.Code)
+	}
+	var cfg forwarderConfig
+	if ok, err := srv.Store.GetPluginConfig("forwarder", &cfg); err != nil || !ok || cfg.Token != "hec-token" || cfg.Targets[0].Secret != "s3cret" {
+		t.Errorf("stored config = %+v, %v, %v", cfg, ok, err)
+	}
+}
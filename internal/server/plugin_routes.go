@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rsclarke/oastrix/internal/plugins"
+)
+
+// PluginPathPrefix is the path under which plugins' own HTTP routes are
+// served, on any host the catcher answers. Each plugin gets the subtree
+// PluginPathPrefix + ID.
+const PluginPathPrefix = "/_oastrix/"
+
+// PluginRouter holds the HTTP routes registered by plugins. Requests to them
+// are answered by the plugin's handler and are not recorded as interactions.
+type PluginRouter struct {
+	mux *http.ServeMux
+}
+
+// NewPluginRouter creates an empty PluginRouter.
+func NewPluginRouter() *PluginRouter {
+	return &PluginRouter{mux: http.NewServeMux()}
+}
+
+// ForPlugin returns the RouterRegistrar for the plugin with the given ID.
+func (r *PluginRouter) ForPlugin(id string) plugins.RouterRegistrar {
+	return &pluginRegistrar{router: r, prefix: PluginPathPrefix + id}
+}
+
+// handler returns the handler registered for req, or nil if there is none.
+func (r *PluginRouter) handler(req *http.Request) http.Handler {
+	if !strings.HasPrefix(req.URL.Path, PluginPathPrefix) {
+		return nil
+	}
+	h, pattern := r.mux.Handler(req)
+	if pattern == "" {
+		return nil
+	}
+	return h
+}
+
+// pluginRegistrar registers a plugin's routes under its prefix.
+type pluginRegistrar struct {
+	router *PluginRouter
+	prefix string
+}
+
+// Handle registers h for pattern, which takes the form "[METHOD ]/path" of
+// http.ServeMux patterns without a host, relative to the plugin's prefix.
+// The prefix is stripped from the request path before h is called. Like
+// http.ServeMux, it panics on an invalid or conflicting pattern.
+func (p *pluginRegistrar) Handle(pattern string, h http.Handler) {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		method, path = "", pattern
+	}
+	path = strings.TrimLeft(path, " \t")
+	if !strings.HasPrefix(path, "/") {
+		panic(fmt.Sprintf("plugin route %q: path must begin with /", pattern))
+	}
+
+	full := p.prefix + path
+	if method != "" {
+		full = method + " " + full
+	}
+	p.router.mux.Handle(full, http.StripPrefix(p.prefix, h))
+}
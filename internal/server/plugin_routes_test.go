@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestPluginRoutes(t *testing.T) {
+	database := setupTestDB(t)
+	routes := NewPluginRouter()
+	routes.ForPlugin("geoip").Handle("GET /lookup", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("path=" + r.URL.Path))
+	}))
+
+	srv := &HTTPServer{
+		Pipeline: setupPipeline(t, database),
+		Domain:   "oastrix.example.com",
+		Logger:   zap.NewNop(),
+		Routes:   routes,
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		host       string
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"plugin route", "GET", "oastrix.example.com", "/_oastrix/geoip/lookup", http.StatusOK, "path=/lookup"},
+		{"plugin route on token host", "GET", "tok.oastrix.example.com", "/_oastrix/geoip/lookup", http.StatusOK, "path=/lookup"},
+		{"wrong method falls through", "POST", "oastrix.example.com", "/_oastrix/geoip/lookup", http.StatusOK, "ok"},
+		{"unregistered path falls through", "GET", "oastrix.example.com", "/_oastrix/other/lookup", http.StatusOK, "ok"},
+		{"invalid host", "GET", "evil.example.net", "/_oastrix/geoip/lookup", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://"+tt.host+tt.path, nil)
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+
+	var count int
+	if err := database.QueryRow("SELECT COUNT(*) FROM interactions").Scan(&count); err != nil {
+		t.Fatalf("failed to count interactions: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("expected plugin routes not to be recorded, got %d interactions", count)
+	}
+}
+
+func TestPluginRoutes_InvalidPattern(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a pattern without a leading /")
+		}
+	}()
+	NewPluginRouter().ForPlugin("geoip").Handle("GET lookup", http.NotFoundHandler())
+}
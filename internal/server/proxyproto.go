@@ -0,0 +1,55 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/rsclarke/oastrix/internal/auth"
+)
+
+// ProxyProtocol accepts PROXY protocol v1 and v2 headers on TCP listeners
+// from trusted load balancers, so the client address a header carries is
+// recorded instead of the load balancer's. Connections from anywhere else are
+// served unchanged, so their PROXY headers are not trusted.
+type ProxyProtocol struct {
+	trusted []netip.Prefix
+}
+
+// NewProxyProtocol returns a ProxyProtocol trusting headers from the given
+// addresses and CIDR prefixes.
+func NewProxyProtocol(trusted []string) (*ProxyProtocol, error) {
+	if len(trusted) == 0 {
+		return nil, errors.New("no trusted PROXY protocol sources")
+	}
+	prefixes, err := auth.ParseAllowlist(trusted)
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyProtocol{trusted: prefixes}, nil
+}
+
+// Listener wraps ln to read PROXY headers from trusted sources.
+func (p *ProxyProtocol) Listener(ln net.Listener) net.Listener {
+	return &proxyproto.Listener{Listener: ln, Policy: p.policy}
+}
+
+// Listeners wraps each of lns as Listener does.
+func (p *ProxyProtocol) Listeners(lns []net.Listener) []net.Listener {
+	wrapped := make([]net.Listener, len(lns))
+	for i, ln := range lns {
+		wrapped[i] = p.Listener(ln)
+	}
+	return wrapped
+}
+
+// policy reads an optional header from trusted sources, and leaves other
+// connections untouched.
+func (p *ProxyProtocol) policy(upstream net.Addr) (proxyproto.Policy, error) {
+	ap, err := netip.ParseAddrPort(upstream.String())
+	if err == nil && auth.IPAllowed(ap.Addr(), p.trusted) {
+		return proxyproto.USE, nil
+	}
+	return proxyproto.SKIP, nil
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// serveRemoteAddr serves the remote address of each request on a wrapped
+// listener, and returns its address.
+func serveRemoteAddr(t *testing.T, p *ProxyProtocol) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, remoteHost(r))
+	})}
+	go func() { _ = srv.Serve(p.Listener(ln)) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return ln.Addr().String()
+}
+
+// proxiedGet sends a GET request preceded by a PROXY v1 header from
+// 198.51.100.7, and returns the response.
+func proxiedGet(t *testing.T, addr string) *http.Response {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_, err = io.WriteString(conn, "PROXY TCP4 198.51.100.7 127.0.0.1 5555 80\r\nGET / HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func TestProxyProtocolTrusted(t *testing.T) {
+	p, err := NewProxyProtocol([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveRemoteAddr(t, p)
+
+	body, _ := io.ReadAll(proxiedGet(t, addr).Body)
+	if string(body) != "198.51.100.7" {
+		t.Errorf("remote address = %q, want the PROXY header's", body)
+	}
+
+	// The header is optional, e.g. for load balancer health checks.
+	resp, err := http.Get("http://" + addr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ = io.ReadAll(resp.Body)
+	if string(body) != "127.0.0.1" {
+		t.Errorf("remote address = %q, want 127.0.0.1", body)
+	}
+}
+
+func TestProxyProtocolUntrusted(t *testing.T) {
+	p, err := NewProxyProtocol([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serveRemoteAddr(t, p)
+
+	// The header is left in the request rather than trusted.
+	resp := proxiedGet(t, addr)
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusOK || strings.Contains(string(body), "198.51.100.7") {
+		t.Errorf("untrusted PROXY header used: %s %q", resp.Status, body)
+	}
+}
+
+func TestNewProxyProtocolInvalid(t *testing.T) {
+	for _, trusted := range [][]string{nil, {"not-an-ip"}} {
+		if _, err := NewProxyProtocol(trusted); err == nil {
+			t.Errorf("NewProxyProtocol(%q) succeeded", trusted)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// rawHTTP reconstructs the request and recorded response of an HTTP
+// interaction.
+func rawHTTP(h *models.HTTPInteraction) (string, string) {
+	var req strings.Builder
+	target := h.Path
+	if h.Query != "" {
+		target += "?" + h.Query
+	}
+	fmt.Fprintf(&req, "%s %s %s\r\nHost: %s\r\n", h.Method, target, h.HTTPVersion, h.Host)
+	var headers map[string][]string
+	_ = json.Unmarshal([]byte(h.RequestHeaders), &headers)
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range headers[name] {
+			fmt.Fprintf(&req, "%s: %s\r\n", name, v)
+		}
+	}
+	req.WriteString("\r\n")
+	req.Write(h.RequestBody)
+
+	if h.ResponseStatus == nil {
+		return req.String(), ""
+	}
+	var resp strings.Builder
+	fmt.Fprintf(&resp, "%s %d %s\r\n", h.HTTPVersion, *h.ResponseStatus, http.StatusText(*h.ResponseStatus))
+	var respHeaders map[string]string
+	if h.ResponseHeaders != nil {
+		_ = json.Unmarshal([]byte(*h.ResponseHeaders), &respHeaders)
+	}
+	names = names[:0]
+	for name := range respHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&resp, "%s: %s\r\n", name, respHeaders[name])
+	}
+	resp.WriteString("\r\n")
+	resp.Write(h.ResponseBody)
+	return req.String(), resp.String()
+}
+
+// dnsMessages reconstructs the query and recorded reply of a DNS interaction.
+// The reply is nil if none was recorded.
+func dnsMessages(d *models.DNSInteraction) (*dns.Msg, *dns.Msg) {
+	m := new(dns.Msg)
+	m.Id = uint16(d.DNSID)
+	m.Opcode = d.Opcode
+	m.RecursionDesired = d.RD != 0
+	m.Question = []dns.Question{{Name: dns.Fqdn(d.QName), Qtype: uint16(d.QType), Qclass: uint16(d.QClass)}}
+	if d.ResponseRCode == nil {
+		return m, nil
+	}
+
+	resp := new(dns.Msg)
+	resp.SetReply(m)
+	resp.Rcode = *d.ResponseRCode
+	if d.ResponseAnswers != nil {
+		var answers []string
+		_ = json.Unmarshal([]byte(*d.ResponseAnswers), &answers)
+		for _, a := range answers {
+			if rr, err := dns.NewRR(a); err == nil && rr != nil {
+				resp.Answer = append(resp.Answer, rr)
+			}
+		}
+	}
+	return m, resp
+}
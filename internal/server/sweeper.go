@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/rsclarke/oastrix/internal/db"
+	"go.uber.org/zap"
+)
+
+// TokenSweeper periodically deletes tokens, along with their interactions,
+// once they have been expired for longer than Retention.
+type TokenSweeper struct {
+	Store     db.Store
+	Logger    *zap.Logger
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+// Run sweeps immediately and then every Interval until ctx is cancelled.
+func (s *TokenSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes tokens that expired more than Retention before now.
+func (s *TokenSweeper) Sweep(now time.Time) {
+	deleted, err := s.Store.PurgeExpiredTokens(now.Add(-s.Retention).Unix())
+	if err != nil {
+		s.Logger.Warn("failed to purge expired tokens", zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		s.Logger.Info("purged expired tokens", zap.Int64("count", deleted))
+	}
+}
+
+// StraySweeper periodically deletes stray interactions once they are older
+// than Retention.
+type StraySweeper struct {
+	Store     db.Store
+	Logger    *zap.Logger
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+// Run sweeps immediately and then every Interval until ctx is cancelled.
+func (s *StraySweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes stray interactions that occurred more than Retention before
+// now.
+func (s *StraySweeper) Sweep(now time.Time) {
+	deleted, err := s.Store.PurgeStrayInteractions(now.Add(-s.Retention).Unix())
+	if err != nil {
+		s.Logger.Warn("failed to purge stray interactions", zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		s.Logger.Info("purged stray interactions", zap.Int64("count", deleted))
+	}
+}
+
+// BlobSweeper periodically deletes blobs that no interaction references any
+// longer, once they are older than Grace.
+type BlobSweeper struct {
+	Store    *db.SQLite
+	Logger   *zap.Logger
+	Grace    time.Duration
+	Interval time.Duration
+}
+
+// Run sweeps immediately and then every Interval until ctx is cancelled.
+func (s *BlobSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.Sweep(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes unreferenced blobs stored more than Grace before now.
+func (s *BlobSweeper) Sweep(now time.Time) {
+	deleted, err := s.Store.CollectBlobs(now.Add(-s.Grace))
+	if err != nil {
+		s.Logger.Warn("failed to collect blobs", zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		s.Logger.Info("collected unreferenced blobs", zap.Int("count", deleted))
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/auth"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/basicauth"
+	"github.com/rsclarke/oastrix/internal/plugins/core/delay"
+	"github.com/rsclarke/oastrix/internal/plugins/core/httpresponse"
+	"github.com/rsclarke/oastrix/internal/plugins/core/overrides"
+	"github.com/rsclarke/oastrix/internal/plugins/core/quota"
+	"github.com/rsclarke/oastrix/internal/plugins/core/redirect"
+	"github.com/rsclarke/oastrix/internal/plugins/ntlm"
+)
+
+var quotaRoutes = tokenConfigRoutes("quota", quota.ID, "quota", func(q *apitypes.TokenQuota) error {
+	return quota.Config{Max: q.Max, Window: q.Window, Policy: quota.Policy(q.Policy)}.Validate()
+})
+
+var httpResponseRoutes = tokenConfigRoutes("http-response", httpresponse.ID, "HTTP response", func(r *apitypes.TokenHTTPResponse) error {
+	return httpresponse.Config(*r).Validate()
+})
+
+var delayRoutes = tokenConfigRoutes("delay", delay.ID, "response delay", func(d *apitypes.TokenDelay) error {
+	return delay.Config(*d).Validate()
+})
+
+var redirectRoutes = tokenConfigRoutes("redirect", redirect.ID, "redirect", func(r *apitypes.TokenRedirect) error {
+	return redirect.Config(*r).Validate()
+})
+
+var overridesRoutes = tokenConfigRoutes("overrides", overrides.ID, "response overrides", func(o *apitypes.TokenOverrides) error {
+	return overrides.Config(*o).Validate()
+})
+
+var basicAuthRoutes = tokenConfigRoutes("basic-auth", basicauth.ID, "basic auth challenge", func(b *apitypes.TokenBasicAuth) error {
+	return basicauth.Config(*b).Validate()
+})
+
+var ntlmRoutes = tokenConfigRoutes("ntlm", ntlm.ID, "NTLM capture", func(n *apitypes.TokenNTLM) error {
+	return ntlm.Config(*n).Validate()
+})
+
+// pluginConfigPath is where any plugin's per-token configuration is served.
+const pluginConfigPath = "/v1/tokens/{token}/plugins/{pluginID}/config"
+
+var pluginConfigRoutes = []route{
+	{
+		method: "GET", path: pluginConfigPath, scope: auth.ScopeRead,
+		handler: (*APIServer).handleGetTokenPluginConfig, summary: "Get a token's configuration for a plugin",
+		response: json.RawMessage{},
+	},
+	{
+		method: "PUT", path: pluginConfigPath, scope: auth.ScopeFull,
+		handler: (*APIServer).handleSetTokenPluginConfig, summary: "Set a token's configuration for a plugin",
+		request: json.RawMessage{}, response: json.RawMessage{},
+	},
+	{
+		method: "DELETE", path: pluginConfigPath, scope: auth.ScopeFull,
+		handler: (*APIServer).handleDeleteTokenPluginConfig, summary: "Remove a token's configuration for a plugin",
+		response: apitypes.DeleteTokenConfigResponse{},
+	},
+}
+
+func (s *APIServer) handleGetTokenPluginConfig(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+	var cfg json.RawMessage
+	found, err := s.Store.GetTokenPluginConfig(tok.ID, r.PathValue("pluginID"), &cfg)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	if !found {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "plugin config not set"})
+		return
+	}
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+// handleSetTokenPluginConfig decodes the request body into the plugin's own
+// configuration type, rejecting unknown fields and values that fail the
+// plugin's validation.
+func (s *APIServer) handleSetTokenPluginConfig(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+	pluginID := r.PathValue("pluginID")
+	var plugin plugins.Plugin
+	if s.Plugins != nil {
+		plugin, ok = s.Plugins.Plugin(pluginID)
+	}
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "plugin not found"})
+		return
+	}
+	tc, ok := plugin.(plugins.TokenConfigurablePlugin)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "plugin has no per-token configuration"})
+		return
+	}
+
+	cfg := tc.NewTokenConfig()
+	if !decodeJSON(w, r, cfg) {
+		return
+	}
+	if v, ok := cfg.(plugins.Validator); ok {
+		if err := v.Validate(); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+	}
+	if err := s.Store.SetTokenPluginConfig(tok.ID, pluginID, cfg); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, cfg)
+}
+
+func (s *APIServer) handleDeleteTokenPluginConfig(w http.ResponseWriter, r *http.Request) {
+	tok, ok := s.ownedToken(w, r)
+	if !ok {
+		return
+	}
+	if err := s.Store.DeleteTokenPluginConfig(tok.ID, r.PathValue("pluginID")); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, apitypes.DeleteTokenConfigResponse{Deleted: true})
+}
+
+// tokenConfigRoutes returns routes to get, replace and delete the per-token
+// configuration that plugin pluginID reads, served at /v1/tokens/{token}/name.
+// Values are stored as their JSON encoding, so T must share its JSON layout
+// with the plugin's own configuration type. A PUT body that fails validate is
+// rejected with a 400 response carrying the error.
+func tokenConfigRoutes[T any](name, pluginID, what string, validate func(*T) error) []route {
+	path := "/v1/tokens/{token}/" + name
+	var zero T
+
+	return []route{
+		{
+			method: "GET", path: path, scope: auth.ScopeRead,
+			handler: func(s *APIServer, w http.ResponseWriter, r *http.Request) {
+				tok, ok := s.ownedToken(w, r)
+				if !ok {
+					return
+				}
+				var cfg T
+				found, err := s.Store.GetTokenPluginConfig(tok.ID, pluginID, &cfg)
+				if err != nil {
+					writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+					return
+				}
+				if !found {
+					writeJSON(w, http.StatusNotFound, map[string]string{"error": what + " not set"})
+					return
+				}
+				writeJSON(w, http.StatusOK, cfg)
+			},
+			summary:  "Get a token's " + what,
+			response: zero,
+		},
+		{
+			method: "PUT", path: path, scope: auth.ScopeFull,
+			handler: func(s *APIServer, w http.ResponseWriter, r *http.Request) {
+				tok, ok := s.ownedToken(w, r)
+				if !ok {
+					return
+				}
+				var cfg T
+				if !decodeJSON(w, r, &cfg) {
+					return
+				}
+				if err := validate(&cfg); err != nil {
+					writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+					return
+				}
+				if err := s.Store.SetTokenPluginConfig(tok.ID, pluginID, cfg); err != nil {
+					writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+					return
+				}
+				writeJSON(w, http.StatusOK, cfg)
+			},
+			summary: "Set a token's " + what,
+			request: zero, response: zero,
+		},
+		{
+			method: "DELETE", path: path, scope: auth.ScopeFull,
+			handler: func(s *APIServer, w http.ResponseWriter, r *http.Request) {
+				tok, ok := s.ownedToken(w, r)
+				if !ok {
+					return
+				}
+				if err := s.Store.DeleteTokenPluginConfig(tok.ID, pluginID); err != nil {
+					writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "database error"})
+					return
+				}
+				writeJSON(w, http.StatusOK, apitypes.DeleteTokenConfigResponse{Deleted: true})
+			},
+			summary:  "Remove a token's " + what,
+			response: apitypes.DeleteTokenConfigResponse{},
+		},
+	}
+}
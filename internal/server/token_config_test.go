@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/plugins"
+	"github.com/rsclarke/oastrix/internal/plugins/core/httpresponse"
+	"github.com/rsclarke/oastrix/internal/plugins/core/quota"
+)
+
+func TestTokenQuotaRoutes(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+displayKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	var created apitypes.CreateTokenResponse
+	if err := json.NewDecoder(do("POST", "/v1/tokens", "").Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	path := "/v1/tokens/" + created.Token + "/quota"
+
+	if w := do("GET", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET before set: expected status 404, got %d", w.Code)
+	}
+	for _, body := range []string{`{"max":0,"policy":"drop"}`, `{"max":5,"policy":"keep_newest","window":"1m"}`, `{"max":5}`} {
+		if w := do("PUT", path, body); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: expected status 400, got %d", body, w.Code)
+		}
+	}
+
+	if w := do("PUT", path, `{"max":5,"window":"1m","policy":"coalesce"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := do("GET", path, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET: expected status 200, got %d", w.Code)
+	}
+	var got apitypes.TokenQuota
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got != (apitypes.TokenQuota{Max: 5, Window: "1m", Policy: "coalesce"}) {
+		t.Errorf("quota = %+v", got)
+	}
+
+	// The stored value must be readable as the plugin's own config.
+	tok, err := srv.Store.GetTokenByValue(created.Token)
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+	var cfg quota.Config
+	if ok, err := srv.Store.GetTokenPluginConfig(tok.ID, quota.ID, &cfg); err != nil || !ok {
+		t.Fatalf("get plugin config: %v, %v", ok, err)
+	}
+	if cfg.Max != 5 || cfg.Policy != quota.PolicyCoalesce {
+		t.Errorf("plugin config = %+v", cfg)
+	}
+
+	if w := do("DELETE", path, ""); w.Code != http.StatusOK {
+		t.Errorf("DELETE: expected status 200, got %d", w.Code)
+	}
+	if w := do("GET", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET after delete: expected status 404, got %d", w.Code)
+	}
+}
+
+func TestTokenHTTPResponseRoutes(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+displayKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	var created apitypes.CreateTokenResponse
+	if err := json.NewDecoder(do("POST", "/v1/tokens", "").Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	path := "/v1/tokens/" + created.Token + "/http-response"
+
+	for _, body := range []string{`{"status":42}`, `{"headers":{"Bad Name":"x"}}`, `{"body":"a","body_base64":"YQ=="}`} {
+		if w := do("PUT", path, body); w.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s: expected status 400, got %d", body, w.Code)
+		}
+	}
+
+	if w := do("PUT", path, `{"status":404,"headers":{"Content-Type":"text/plain"},"body":"gone"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	tok, err := srv.Store.GetTokenByValue(created.Token)
+	if err != nil || tok == nil {
+		t.Fatalf("get token: %v", err)
+	}
+	var cfg httpresponse.Config
+	if ok, err := srv.Store.GetTokenPluginConfig(tok.ID, httpresponse.ID, &cfg); err != nil || !ok {
+		t.Fatalf("get plugin config: %v, %v", ok, err)
+	}
+	if cfg.Status != 404 || cfg.Body != "gone" || cfg.Headers["Content-Type"] != "text/plain" {
+		t.Errorf("plugin config = %+v", cfg)
+	}
+}
+
+func TestTokenPluginConfigRoutes(t *testing.T) {
+	srv, displayKey, cleanup := setupTestAPIServer(t)
+	defer cleanup()
+
+	pipeline := plugins.NewPipeline(nil)
+	pipeline.Register(quota.New(srv.Store))
+	pipeline.Register(&mockPlugin{id: "plain"})
+	srv.Plugins = pipeline
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+displayKey)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	var created apitypes.CreateTokenResponse
+	if err := json.NewDecoder(do("POST", "/v1/tokens", "").Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	path := "/v1/tokens/" + created.Token + "/plugins/quota/config"
+
+	if w := do("GET", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET before set: expected status 404, got %d", w.Code)
+	}
+
+	tests := []struct {
+		path, body string
+		want       int
+	}{
+		{path, `{"max":0,"policy":"drop"}`, http.StatusBadRequest},
+		{path, `{"max":5,"policy":"drop","extra":1}`, http.StatusBadRequest},
+		{path, `{"max":"five","policy":"drop"}`, http.StatusBadRequest},
+		{"/v1/tokens/" + created.Token + "/plugins/missing/config", `{}`, http.StatusNotFound},
+		{"/v1/tokens/" + created.Token + "/plugins/plain/config", `{}`, http.StatusBadRequest},
+		{"/v1/tokens/unknowntoken/plugins/quota/config", `{"max":5,"policy":"drop"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := do("PUT", tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("PUT %s %s: expected status %d, got %d", tt.path, tt.body, tt.want, w.Code)
+		}
+	}
+
+	if w := do("PUT", path, `{"max":5,"policy":"drop"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT: expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// The generic and dedicated routes share storage.
+	w := do("GET", "/v1/tokens/"+created.Token+"/quota", "")
+	var got apitypes.TokenQuota
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got != (apitypes.TokenQuota{Max: 5, Policy: "drop"}) {
+		t.Errorf("quota = %+v", got)
+	}
+
+	w = do("GET", path, "")
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != `{"max":5,"policy":"drop"}` {
+		t.Errorf("GET: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do("DELETE", path, ""); w.Code != http.StatusOK {
+		t.Errorf("DELETE: expected status 200, got %d", w.Code)
+	}
+	if w := do("GET", path, ""); w.Code != http.StatusNotFound {
+		t.Errorf("GET after delete: expected status 404, got %d", w.Code)
+	}
+}
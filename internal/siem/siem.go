@@ -0,0 +1,327 @@
+// Package siem renders interactions as ArcSight Common Event Format (CEF)
+// and IBM QRadar Log Event Extended Format (LEEF) events, for SIEMs that
+// ingest those rather than JSON. Both the syslog forwarder and the export
+// endpoint use it, and outputs to SIEMs convert stored interactions to JSON
+// with it.
+package siem
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/miekg/dns"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/plugins/asn"
+	"github.com/rsclarke/oastrix/internal/plugins/correlation"
+	"github.com/rsclarke/oastrix/internal/plugins/ssrf"
+	"github.com/rsclarke/oastrix/internal/plugins/threatintel"
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// Formats events can be rendered in.
+const (
+	FormatCEF  = "cef"
+	FormatLEEF = "leef"
+)
+
+// Device identification in event headers.
+const (
+	vendor  = "oastrix"
+	product = "oastrix"
+	version = "1"
+)
+
+// Severities on CEF's 0-10 scale. Interactions from a likely server-side
+// fetcher, or from an address threat intelligence knows, are raised.
+const (
+	severityDefault = 3
+	severityFlagged = 6
+)
+
+// maxValue bounds the values copied from a request, such as its URL or
+// User-Agent.
+const maxValue = 1024
+
+// Format renders iv in the named format, FormatCEF or FormatLEEF.
+func Format(format string, iv apitypes.InteractionV2) string {
+	if format == FormatLEEF {
+		return LEEF(iv)
+	}
+	return CEF(iv)
+}
+
+// Interaction converts the stored interaction e to the v2 representation
+// the formatters take, and that outputs send as JSON.
+func Interaction(e *events.Event) apitypes.InteractionV2 {
+	d := e.Draft
+	iv := apitypes.InteractionV2{
+		ID:         e.InteractionID,
+		Token:      d.TokenValue,
+		Kind:       string(d.Kind),
+		OccurredAt: time.Unix(d.OccurredAt, 0).UTC().Format(time.RFC3339),
+		Remote:     apitypes.RemoteEndpoint{IP: d.RemoteIP, Port: d.RemotePort},
+		TLS:        d.TLS,
+		Summary:    d.Summary,
+		Attributes: d.Attributes,
+	}
+	if iv.Attributes == nil {
+		iv.Attributes = make(map[string]any)
+	}
+	if h := d.HTTP; h != nil {
+		iv.HTTP = &apitypes.HTTPDetailV2{Request: apitypes.HTTPRequestV2{
+			Method:  h.Method,
+			Scheme:  h.Scheme,
+			Host:    h.Host,
+			Path:    h.Path,
+			Query:   h.Query,
+			Proto:   h.Proto,
+			Headers: h.Headers,
+			Body:    base64.StdEncoding.EncodeToString(h.Body),
+		}}
+	}
+	if q := d.DNS; q != nil {
+		iv.DNS = &apitypes.DNSDetailV2{Query: apitypes.DNSQueryV2{
+			QName:    q.QName,
+			QType:    q.QType,
+			QClass:   q.QClass,
+			RD:       q.RD != 0,
+			Opcode:   q.Opcode,
+			DNSID:    q.DNSID,
+			Protocol: q.Protocol,
+		}}
+	}
+	return iv
+}
+
+// field is a key and value of an event's extension.
+type field struct{ key, value string }
+
+// summary is what both formats record of an interaction.
+type summary struct {
+	severity int
+	fields   []field // CEF keys
+	leef     []field // LEEF keys
+}
+
+// CEF renders iv as a CEF event: the interaction's kind is the signature ID,
+// the remote endpoint the source, and the token, request and key plugin
+// attributes are extension fields.
+func CEF(iv apitypes.InteractionV2) string {
+	s := summarize(iv)
+	var b strings.Builder
+	b.WriteString("CEF:0")
+	for _, h := range []string{vendor, product, version, iv.Kind, name(iv), strconv.Itoa(s.severity)} {
+		b.WriteString("|")
+		b.WriteString(cefHeaderEscaper.Replace(oneLine(h)))
+	}
+	b.WriteString("|")
+	for i, f := range s.fields {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString(f.key)
+		b.WriteString("=")
+		b.WriteString(cefValueEscaper.Replace(truncate(f.value, maxValue)))
+	}
+	return b.String()
+}
+
+// LEEF renders iv as a tab-delimited LEEF 1.0 event with the same fields as
+// CEF, under LEEF's predefined keys where it has them.
+func LEEF(iv apitypes.InteractionV2) string {
+	s := summarize(iv)
+	var b strings.Builder
+	b.WriteString("LEEF:1.0")
+	for _, h := range []string{vendor, product, version, iv.Kind} {
+		b.WriteString("|")
+		b.WriteString(leefHeaderEscaper.Replace(oneLine(h)))
+	}
+	b.WriteString("|")
+	for i, f := range s.leef {
+		if i > 0 {
+			b.WriteString("\t")
+		}
+		b.WriteString(f.key)
+		b.WriteString("=")
+		b.WriteString(leefValueEscaper.Replace(truncate(f.value, maxValue)))
+	}
+	return b.String()
+}
+
+// name is the event's human-readable name.
+func name(iv apitypes.InteractionV2) string {
+	return strings.ToUpper(iv.Kind) + " interaction"
+}
+
+// summarize extracts the fields both formats record, in the order they are
+// written.
+func summarize(iv apitypes.InteractionV2) summary {
+	s := summary{severity: severityDefault}
+	add := func(cef, leef, value string) {
+		if value == "" {
+			return
+		}
+		if cef != "" {
+			s.fields = append(s.fields, field{cef, value})
+		}
+		if leef != "" {
+			s.leef = append(s.leef, field{leef, value})
+		}
+	}
+	// label adds a CEF custom field, named by its label, and the LEEF field
+	// of the same name.
+	label := func(slot, key, value string) {
+		if value == "" {
+			return
+		}
+		s.fields = append(s.fields, field{slot + "Label", key}, field{slot, value})
+		s.leef = append(s.leef, field{key, value})
+	}
+
+	if t, err := time.Parse(time.RFC3339, iv.OccurredAt); err == nil {
+		add("rt", "", strconv.FormatInt(t.UnixMilli(), 10))
+		add("", "devTime", t.UTC().Format("Jan 02 2006 15:04:05"))
+		add("", "devTimeFormat", "MMM dd yyyy HH:mm:ss")
+	}
+	add("externalId", "externalId", strconv.FormatInt(iv.ID, 10))
+	add("cat", "cat", iv.Kind)
+	// CEF's src only holds IPv4 addresses; LEEF's holds either.
+	if ip, err := netip.ParseAddr(iv.Remote.IP); err == nil && ip.Unmap().Is6() {
+		add("c6a2", "src", iv.Remote.IP)
+	} else {
+		add("src", "src", iv.Remote.IP)
+	}
+	if iv.Remote.Port != 0 {
+		add("spt", "srcPort", strconv.Itoa(iv.Remote.Port))
+	}
+	add("app", "", app(iv))
+	label("cs1", "token", iv.Token)
+
+	if h := iv.HTTP; h != nil {
+		req := h.Request
+		add("requestMethod", "method", req.Method)
+		add("request", "url", requestURL(iv))
+		add("dhost", "dhost", req.Host)
+		for k, v := range req.Headers {
+			if strings.EqualFold(k, "User-Agent") && len(v) > 0 {
+				add("requestClientApplication", "userAgent", v[0])
+			}
+		}
+	}
+	if d := iv.DNS; d != nil {
+		q := d.Query
+		add("proto", "proto", strings.ToUpper(q.Protocol))
+		add("dhost", "dhost", q.QName)
+		label("cs2", "qtype", dns.TypeToString[uint16(q.QType)])
+	}
+
+	var info asn.Info
+	if attribute(iv.Attributes, asn.Attribute, &info) {
+		if info.Number != 0 {
+			label("cn1", "asn", strconv.FormatUint(uint64(info.Number), 10))
+		}
+		label("cs3", "asnOrg", info.Org)
+		label("cs4", "country", info.Country)
+	}
+	var tags []string
+	if attribute(iv.Attributes, threatintel.TagsAttribute, &tags) && len(tags) > 0 {
+		s.severity = severityFlagged
+		label("cs5", "intelTags", strings.Join(tags, ","))
+	}
+	var verdict ssrf.Verdict
+	if attribute(iv.Attributes, ssrf.Attribute, &verdict) {
+		s.severity = severityFlagged
+		label("cfp1", "ssrfConfidence", strconv.FormatFloat(verdict.Confidence, 'f', 2, 64))
+	}
+	var correlationID string
+	if attribute(iv.Attributes, correlation.Attribute, &correlationID) {
+		label("cs6", "correlationId", correlationID)
+	}
+
+	add("msg", "msg", oneLine(iv.Summary))
+	s.leef = append(s.leef, field{"sev", strconv.Itoa(s.severity)})
+	return s
+}
+
+// app is the application protocol of the interaction.
+func app(iv apitypes.InteractionV2) string {
+	switch {
+	case iv.HTTP != nil && iv.TLS:
+		return "HTTPS"
+	case iv.Kind == "":
+		return ""
+	default:
+		return strings.ToUpper(iv.Kind)
+	}
+}
+
+// requestURL reconstructs the URL of an HTTP interaction's request.
+func requestURL(iv apitypes.InteractionV2) string {
+	req := iv.HTTP.Request
+	scheme := req.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if iv.TLS {
+			scheme = "https"
+		}
+	}
+	u := scheme + "://" + req.Host + req.Path
+	if req.Query != "" {
+		u += "?" + req.Query
+	}
+	return u
+}
+
+// attribute decodes the attribute key into out, whether attrs came from the
+// database, as decoded JSON, or from a plugin, as its own type. It reports
+// whether the attribute was present and decoded.
+func attribute(attrs map[string]any, key string, out any) bool {
+	v, ok := attrs[key]
+	if !ok || v == nil {
+		return false
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(b, out) == nil
+}
+
+var (
+	// cefHeaderEscaper escapes the characters CEF header fields reserve.
+	cefHeaderEscaper = strings.NewReplacer(`\`, `\\`, `|`, `\|`)
+	// cefValueEscaper escapes the characters CEF extension values reserve.
+	cefValueEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+	// leefHeaderEscaper escapes the character LEEF header fields reserve.
+	leefHeaderEscaper = strings.NewReplacer(`|`, `\|`)
+	// leefValueEscaper replaces the delimiter and line breaks, which LEEF
+	// values cannot contain.
+	leefValueEscaper = strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+)
+
+// oneLine replaces line breaks in s with spaces.
+func oneLine(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// truncate shortens s to at most limit bytes without splitting a character.
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit]
+}
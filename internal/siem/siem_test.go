@@ -0,0 +1,69 @@
+package siem
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rsclarke/oastrix/internal/apitypes"
+	"github.com/rsclarke/oastrix/internal/plugins/asn"
+	"github.com/rsclarke/oastrix/internal/plugins/ssrf"
+)
+
+func httpInteraction() apitypes.InteractionV2 {
+	return apitypes.InteractionV2{
+		ID:         42,
+		Token:      "tok123",
+		Kind:       "http",
+		OccurredAt: "2023-11-14T22:13:20Z",
+		Remote:     apitypes.RemoteEndpoint{IP: "192.0.2.1", Port: 40000},
+		Summary:    "GET /x\r\n HTTP/1.1",
+		Attributes: map[string]any{
+			// As a plugin sets it.
+			asn.Attribute: asn.Info{Number: 64496, Org: "Example|Net", Country: "GB"},
+			// As decoded from the database.
+			ssrf.Attribute: map[string]any{"confidence": 0.9, "signals": []any{"fetcher_agent"}},
+		},
+		HTTP: &apitypes.HTTPDetailV2{Request: apitypes.HTTPRequestV2{
+			Method: "GET", Host: "tok123.example.com", Path: "/x", Query: "a=b\\c",
+			Headers: map[string][]string{"User-Agent": {"curl/8.0"}},
+		}},
+	}
+}
+
+func TestCEF(t *testing.T) {
+	got := CEF(httpInteraction())
+	want := `CEF:0|oastrix|oastrix|1|http|HTTP interaction|6|` +
+		`rt=1700000000000 externalId=42 cat=http src=192.0.2.1 spt=40000 app=HTTP cs1Label=token cs1=tok123 ` +
+		`requestMethod=GET request=http://tok123.example.com/x?a\=b\\c dhost=tok123.example.com requestClientApplication=curl/8.0 ` +
+		`cn1Label=asn cn1=64496 cs3Label=asnOrg cs3=Example|Net cs4Label=country cs4=GB ` +
+		`cfp1Label=ssrfConfidence cfp1=0.90 msg=GET /x   HTTP/1.1`
+	if got != want {
+		t.Errorf("CEF =\n%s\nwant\n%s", got, want)
+	}
+
+	dns := apitypes.InteractionV2{
+		ID: 1, Kind: "dns", Remote: apitypes.RemoteEndpoint{IP: "2001:db8::1"},
+		DNS: &apitypes.DNSDetailV2{Query: apitypes.DNSQueryV2{QName: "tok123.example.com", QType: 28, Protocol: "udp"}},
+	}
+	if got := CEF(dns); !strings.HasPrefix(got, "CEF:0|oastrix|oastrix|1|dns|DNS interaction|3|") ||
+		!strings.Contains(got, " c6a2=2001:db8::1 ") || !strings.Contains(got, " proto=UDP dhost=tok123.example.com cs2Label=qtype cs2=AAAA") {
+		t.Errorf("CEF = %s", got)
+	}
+}
+
+func TestLEEF(t *testing.T) {
+	iv := httpInteraction()
+	iv.Kind = "ht|tp"
+	iv.HTTP.Request.Headers["User-Agent"] = []string{"curl\t8.0"}
+	got := LEEF(iv)
+	want := "LEEF:1.0|oastrix|oastrix|1|ht\\|tp|" + strings.Join([]string{
+		"devTime=Nov 14 2023 22:13:20", "devTimeFormat=MMM dd yyyy HH:mm:ss",
+		"externalId=42", "cat=ht|tp", "src=192.0.2.1", "srcPort=40000", "token=tok123",
+		"method=GET", "url=http://tok123.example.com/x?a=b\\c", "dhost=tok123.example.com", "userAgent=curl 8.0",
+		"asn=64496", "asnOrg=Example|Net", "country=GB", "ssrfConfidence=0.90",
+		"msg=GET /x   HTTP/1.1", "sev=6",
+	}, "\t")
+	if got != want {
+		t.Errorf("LEEF =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+// Package systemd receives the sockets systemd passes to a socket-activated
+// service, so privileged ports can be bound by systemd rather than by the
+// process itself.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor systemd passes sockets from.
+const listenFDsStart = 3
+
+// Sockets holds the sockets passed by systemd, grouped by the
+// FileDescriptorName= of their socket unit. Each is handed out once.
+type Sockets struct {
+	listeners   map[string][]net.Listener
+	packetConns map[string][]net.PacketConn
+}
+
+// Activated returns the sockets systemd passed to the process, or empty
+// Sockets when it was not socket-activated. The LISTEN_ environment variables
+// are unset so that child processes do not take the sockets as theirs.
+func Activated() (*Sockets, error) {
+	names, err := listenFDNames(os.Getpid(), os.Getenv)
+	for _, env := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_ = os.Unsetenv(env)
+	}
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*os.File, len(names))
+	for i, name := range names {
+		files[i] = os.NewFile(uintptr(listenFDsStart+i), name)
+	}
+	return newSockets(files, names)
+}
+
+// listenFDNames returns the FileDescriptorName= of each socket passed to
+// process pid according to the LISTEN_ environment variables, in file
+// descriptor order from listenFDsStart.
+func listenFDNames(pid int, getenv func(string) string) ([]string, error) {
+	if getenv("LISTEN_PID") == "" {
+		return nil, nil
+	}
+	if listenPID, err := strconv.Atoi(getenv("LISTEN_PID")); err != nil || listenPID != pid {
+		// Meant for another process, e.g. inherited from a parent.
+		return nil, nil
+	}
+	n, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", getenv("LISTEN_FDS"))
+	}
+	var fdNames []string
+	if s := getenv("LISTEN_FDNAMES"); s != "" {
+		fdNames = strings.Split(s, ":")
+	}
+
+	names := make([]string, n)
+	for i := range names {
+		names[i] = "unknown"
+		if i < len(fdNames) && fdNames[i] != "" {
+			names[i] = fdNames[i]
+		}
+	}
+	return names, nil
+}
+
+// newSockets turns files into listeners and packet connections, grouped by
+// names. The files themselves are closed; the sockets use duplicates of them
+// that are closed on exec.
+func newSockets(files []*os.File, names []string) (*Sockets, error) {
+	s := &Sockets{
+		listeners:   make(map[string][]net.Listener),
+		packetConns: make(map[string][]net.PacketConn),
+	}
+	for i, f := range files {
+		name := names[i]
+		ln, lnErr := net.FileListener(f)
+		if lnErr == nil {
+			s.listeners[name] = append(s.listeners[name], ln)
+		} else if pc, err := net.FilePacketConn(f); err == nil {
+			s.packetConns[name] = append(s.packetConns[name], pc)
+		} else {
+			for _, f := range files[i:] {
+				_ = f.Close()
+			}
+			s.Close()
+			return nil, fmt.Errorf("socket %q: %w", name, lnErr)
+		}
+		_ = f.Close()
+	}
+	return s, nil
+}
+
+// Listeners returns the stream sockets named name not yet handed out.
+func (s *Sockets) Listeners(name string) []net.Listener {
+	lns := s.listeners[name]
+	delete(s.listeners, name)
+	return lns
+}
+
+// PacketConns returns the datagram sockets named name not yet handed out.
+func (s *Sockets) PacketConns(name string) []net.PacketConn {
+	pcs := s.packetConns[name]
+	delete(s.packetConns, name)
+	return pcs
+}
+
+// Close closes the sockets not yet handed out and returns their names.
+func (s *Sockets) Close() []string {
+	var unused []string
+	for name, lns := range s.listeners {
+		for _, ln := range lns {
+			_ = ln.Close()
+			unused = append(unused, name)
+		}
+	}
+	for name, pcs := range s.packetConns {
+		for _, pc := range pcs {
+			_ = pc.Close()
+			unused = append(unused, name)
+		}
+	}
+	clear(s.listeners)
+	clear(s.packetConns)
+	slices.Sort(unused)
+	return unused
+}
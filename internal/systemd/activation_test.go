@@ -0,0 +1,88 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"slices"
+	"testing"
+)
+
+func env(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestListenFDNames(t *testing.T) {
+	names, err := listenFDNames(42, env(map[string]string{
+		"LISTEN_PID":     "42",
+		"LISTEN_FDS":     "3",
+		"LISTEN_FDNAMES": "dns:dns",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"dns", "dns", "unknown"}; !slices.Equal(names, want) {
+		t.Errorf("names = %q, want %q", names, want)
+	}
+}
+
+func TestListenFDNamesOtherProcess(t *testing.T) {
+	for _, vars := range []map[string]string{
+		{},
+		{"LISTEN_PID": "7", "LISTEN_FDS": "1"},
+	} {
+		names, err := listenFDNames(42, env(vars))
+		if err != nil || names != nil {
+			t.Errorf("%v: got %q, %v; want no sockets", vars, names, err)
+		}
+	}
+
+	if _, err := listenFDNames(42, env(map[string]string{"LISTEN_PID": "42", "LISTEN_FDS": "x"})); err == nil {
+		t.Error("invalid LISTEN_FDS accepted")
+	}
+}
+
+func TestSockets(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pc.Close() }()
+
+	lnFile, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcFile, err := pc.(*net.UDPConn).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newSockets([]*os.File{lnFile, pcFile}, []string{"dns", "dns"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.Listeners("http"); got != nil {
+		t.Errorf("Listeners(http) = %v, want none", got)
+	}
+	tcp := s.Listeners("dns")
+	if len(tcp) != 1 || tcp[0].Addr().String() != ln.Addr().String() {
+		t.Fatalf("Listeners(dns) = %v, want %v", tcp, ln.Addr())
+	}
+	defer func() { _ = tcp[0].Close() }()
+	if s.Listeners("dns") != nil {
+		t.Error("Listeners(dns) handed out twice")
+	}
+
+	if unused := s.Close(); len(unused) != 1 || unused[0] != "dns" {
+		t.Errorf("Close() = %v, want [dns]", unused)
+	}
+	if s.PacketConns("dns") != nil {
+		t.Error("PacketConns(dns) returned a closed socket")
+	}
+}
@@ -3,21 +3,105 @@ package token
 
 import (
 	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
 )
 
 const tokenLength = 12
 
-var charset = []byte("abcdefghijklmnopqrstuvwxyz0123456789")
+const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
 
-// Generate creates a new random OAST token.
+// Token length bounds. Tokens are used as a single DNS label, which may not
+// exceed 63 characters.
+const (
+	MinLength = 8
+	MaxLength = 63
+)
+
+// Format describes how tokens are generated. The zero value produces 12
+// character lowercase alphanumeric tokens.
+type Format struct {
+	Length   int    // number of characters; 0 uses the default of 12
+	Alphabet string // characters to draw from; empty uses a-z and 0-9
+	UUID     bool   // generate random version 4 UUIDs, ignoring Length and Alphabet
+}
+
+// Validate checks that f produces tokens that survive DNS case folding and fit
+// in a single label.
+func (f Format) Validate() error {
+	if f.UUID {
+		return nil
+	}
+	if f.Length != 0 && (f.Length < MinLength || f.Length > MaxLength) {
+		return fmt.Errorf("token length %d out of range %d-%d", f.Length, MinLength, MaxLength)
+	}
+	if f.Alphabet == "" {
+		return nil
+	}
+	for _, c := range f.Alphabet {
+		if !strings.ContainsRune(charset, c) {
+			return fmt.Errorf("token alphabet contains %q: only lowercase letters and digits are allowed", c)
+		}
+	}
+	if distinct(f.Alphabet) < 2 {
+		return errors.New("token alphabet needs at least two distinct characters")
+	}
+	return nil
+}
+
+// Generate creates a new random OAST token in format f.
+func (f Format) Generate() (string, error) {
+	if f.UUID {
+		return generateUUID()
+	}
+
+	length := f.Length
+	if length == 0 {
+		length = tokenLength
+	}
+	alphabet := f.Alphabet
+	if alphabet == "" {
+		alphabet = charset
+	}
+
+	// Reject bytes at or above the largest multiple of the alphabet size so
+	// every character is equally likely.
+	limit := 256 - 256%len(alphabet)
+	b := make([]byte, 0, length)
+	randomBytes := make([]byte, length)
+	for len(b) < length {
+		if _, err := rand.Read(randomBytes); err != nil {
+			return "", err
+		}
+		for _, r := range randomBytes {
+			if int(r) < limit && len(b) < length {
+				b = append(b, alphabet[int(r)%len(alphabet)])
+			}
+		}
+	}
+	return string(b), nil
+}
+
+// Generate creates a new random OAST token in the default format.
 func Generate() (string, error) {
-	b := make([]byte, tokenLength)
-	randomBytes := make([]byte, tokenLength)
-	if _, err := rand.Read(randomBytes); err != nil {
+	return Format{}.Generate()
+}
+
+func generateUUID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
 		return "", err
 	}
-	for i := range b {
-		b[i] = charset[int(randomBytes[i])%len(charset)]
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 9562 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
+
+func distinct(s string) int {
+	seen := make(map[rune]bool)
+	for _, c := range s {
+		seen[c] = true
 	}
-	return string(b), nil
+	return len(seen)
 }
@@ -1,6 +1,7 @@
 package token
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -36,3 +37,74 @@ func TestGenerateUniqueness(t *testing.T) {
 		tokens[tok] = true
 	}
 }
+
+func TestFormatGenerate(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  Format
+		wantLen int
+		allowed string
+	}{
+		{"default", Format{}, tokenLength, charset},
+		{"length", Format{Length: 20}, 20, charset},
+		{"letters only", Format{Length: 16, Alphabet: "abcdefghijklmnopqrstuvwxyz"}, 16, "abcdefghijklmnopqrstuvwxyz"},
+		{"uuid", Format{UUID: true, Length: 10}, 36, "0123456789abcdef-"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.format.Validate(); err != nil {
+				t.Fatalf("Validate failed: %v", err)
+			}
+			tok, err := tt.format.Generate()
+			if err != nil {
+				t.Fatalf("Generate failed: %v", err)
+			}
+			if len(tok) != tt.wantLen {
+				t.Errorf("token %q length = %d, want %d", tok, len(tok), tt.wantLen)
+			}
+			for _, c := range tok {
+				if !strings.ContainsRune(tt.allowed, c) {
+					t.Errorf("token %q contains invalid character: %c", tok, c)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateUUIDVersion(t *testing.T) {
+	tok, err := Format{UUID: true}.Generate()
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if tok[8] != '-' || tok[13] != '-' || tok[18] != '-' || tok[23] != '-' {
+		t.Errorf("token %q is not in UUID form", tok)
+	}
+	if tok[14] != '4' {
+		t.Errorf("token %q version = %c, want 4", tok, tok[14])
+	}
+	if !strings.ContainsRune("89ab", rune(tok[19])) {
+		t.Errorf("token %q has unexpected variant %c", tok, tok[19])
+	}
+}
+
+func TestFormatValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+	}{
+		{"too short", Format{Length: MinLength - 1}},
+		{"too long", Format{Length: MaxLength + 1}},
+		{"uppercase", Format{Alphabet: "ABCdef"}},
+		{"hyphen", Format{Alphabet: "abc-"}},
+		{"single character", Format{Alphabet: "aaaa"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.format.Validate(); err == nil {
+				t.Errorf("expected error for %+v", tt.format)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// Event wraps an interaction draft with its assigned ID after storage.
+// RequestID identifies the HTTP request that produced it, if any; see
+// package requestid.
+//
+// Plugins hand data to hooks that run after theirs on the same event with
+// Set and Get, e.g. an enrichment plugin's PreStore hook calls
+// e.Set("geoip.country", "NL") and a notifier's PostStore hook reads it with
+// Get[string](e, "geoip.country"). Keys are namespaced by the ID of the
+// plugin that sets them. Values are not stored and are not passed to remote
+// plugins; hooks that want a value recorded add it to the draft's Attributes.
+type Event struct {
+	Draft         *InteractionDraft
+	InteractionID int64
+	RequestID     string
+
+	mu   sync.Mutex
+	data map[string]any
+}
+
+// Set stores v under key for later hooks processing the event, replacing any
+// previous value.
+func (e *Event) Set(key string, v any) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.data == nil {
+		e.data = make(map[string]any)
+	}
+	e.data[key] = v
+}
+
+// Value returns the value stored under key by Set.
+func (e *Event) Value(key string) (any, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	v, ok := e.data[key]
+	return v, ok
+}
+
+// Get returns the value stored under key on e if it is a T.
+func Get[T any](e *Event, key string) (T, bool) {
+	v, _ := e.Value(key)
+	t, ok := v.(T)
+	return t, ok
+}
+
+// HTTPEvent extends Event with HTTP-specific request and response data.
+type HTTPEvent struct {
+	Event
+	Req  *http.Request
+	Resp *HTTPResponsePlan
+}
+
+// DNSEvent extends Event with DNS-specific request and response data.
+type DNSEvent struct {
+	Event
+	Req      *dns.Msg
+	Resp     *DNSResponsePlan
+	QNameRaw string
+}
+
+// GenericEvent extends Event for protocols without a dedicated event type.
+// The draft's Protocol holds the request.
+type GenericEvent struct {
+	Event
+	Resp *ProtocolResponsePlan
+}
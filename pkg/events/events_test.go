@@ -0,0 +1,23 @@
+package events
+
+import "testing"
+
+func TestEventData(t *testing.T) {
+	e := &Event{}
+	if _, ok := e.Value("geoip.country"); ok {
+		t.Error("Value found a key that was never set")
+	}
+
+	e.Set("geoip.country", "NL")
+	if got, ok := Get[string](e, "geoip.country"); !ok || got != "NL" {
+		t.Errorf("Get[string] = %q, %v, want NL, true", got, ok)
+	}
+	if got, ok := Get[int](e, "geoip.country"); ok || got != 0 {
+		t.Errorf("Get[int] of a string = %d, %v, want 0, false", got, ok)
+	}
+
+	e.Set("geoip.country", "DE")
+	if got, _ := Get[string](e, "geoip.country"); got != "DE" {
+		t.Errorf("Get after replacing = %q, want DE", got)
+	}
+}
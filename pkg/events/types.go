@@ -3,15 +3,24 @@ package events
 
 import "github.com/miekg/dns"
 
-// Kind represents the type of interaction (HTTP or DNS).
+// Kind represents the type of interaction (HTTP, DNS or another protocol).
 type Kind string
 
-// Interaction kinds.
+// Interaction kinds. Kinds other than HTTP and DNS carry a ProtocolDraft.
 const (
 	KindHTTP Kind = "http"
 	KindDNS  Kind = "dns"
+	KindSMTP Kind = "smtp"
+	KindLDAP Kind = "ldap"
+	KindFTP  Kind = "ftp"
+	KindTCP  Kind = "tcp"
+	KindTLS  Kind = "tls"
 )
 
+// KindFlood is an interaction summarizing others dropped by flood
+// protection. It carries no protocol details.
+const KindFlood Kind = "flood"
+
 // InteractionDraft represents an interaction in progress before storage.
 type InteractionDraft struct {
 	TokenValue string
@@ -24,15 +33,18 @@ type InteractionDraft struct {
 	Summary    string
 	HTTP       *HTTPDraft
 	DNS        *DNSDraft
+	Protocol   *ProtocolDraft
 	Attributes map[string]any
 	Drop       bool
 }
 
-// HTTPDraft contains HTTP-specific interaction details.
+// HTTPDraft contains HTTP-specific interaction details. TransferEncoding is
+// the request's transfer codings, which net/http removes from Headers.
 type HTTPDraft struct {
 	Method, Scheme, Host, Path, Query, Proto string
 	Headers                                  map[string][]string
 	Body                                     []byte
+	TransferEncoding                         []string
 }
 
 // DNSDraft contains DNS-specific interaction details.
@@ -46,6 +58,15 @@ type DNSDraft struct {
 	Protocol string
 }
 
+// ProtocolDraft contains the details of an interaction over a protocol
+// without a dedicated draft type: the raw bytes received and whatever
+// fields the listener parsed from them, e.g. "helo" and "mail_from" for
+// SMTP.
+type ProtocolDraft struct {
+	Raw    []byte
+	Fields map[string]any
+}
+
 // HTTPResponsePlan describes the HTTP response to be sent.
 type HTTPResponsePlan struct {
 	Status  int
@@ -60,3 +81,12 @@ type DNSResponsePlan struct {
 	Answers []dns.RR
 	Handled bool
 }
+
+// ProtocolResponsePlan describes the bytes to send back over a protocol
+// without a dedicated response type, and whether to close the connection
+// afterwards.
+type ProtocolResponsePlan struct {
+	Data    []byte
+	Close   bool
+	Handled bool
+}
@@ -0,0 +1,158 @@
+// Package models defines the database entity types.
+package models
+
+// APIKey represents an API key record in the database.
+type APIKey struct {
+	ID                int64
+	KeyPrefix         string
+	KeyHash           []byte
+	HashVersion       int
+	Name              *string
+	Scope             string
+	AllowedCIDRs      []string
+	ClientCertSubject *string
+	CreatedAt         int64
+	RevokedAt         *int64
+	LastUsedAt        *int64
+	LastUsedIP        *string
+}
+
+// Token represents an OAST token record in the database.
+type Token struct {
+	ID        int64
+	Token     string
+	APIKeyID  *int64
+	CreatedAt int64
+	Label     *string
+	ExpiresAt *int64
+	Enabled   bool
+}
+
+// Expired reports whether the token has an expiry at or before now, a Unix
+// timestamp.
+func (t *Token) Expired(now int64) bool {
+	return t.ExpiresAt != nil && *t.ExpiresAt <= now
+}
+
+// TokenFile is a file served at Path under a token's host.
+type TokenFile struct {
+	TokenID     int64
+	Path        string
+	ContentType string
+	Size        int64
+	Content     []byte // nil when listed
+	CreatedAt   int64
+}
+
+// Interaction represents a recorded interaction event.
+type Interaction struct {
+	ID         int64
+	TokenID    int64
+	Kind       string
+	OccurredAt int64
+	RemoteIP   string
+	RemotePort int
+	TLS        bool
+	Summary    string
+}
+
+// HTTPInteraction contains HTTP-specific details for an interaction.
+type HTTPInteraction struct {
+	InteractionID  int64
+	Method         string
+	Scheme         string
+	Host           string
+	Path           string
+	Query          string
+	HTTPVersion    string
+	RequestHeaders string
+	RequestBody    []byte
+
+	// Response fields are nil until the response has been recorded.
+	ResponseStatus     *int
+	ResponseHeaders    *string // JSON object
+	ResponseBody       []byte  // at most the first db.ResponseSnippetSize bytes
+	ResponseBodySize   *int
+	ResponseBodySHA256 *string // hex
+}
+
+// DNSInteraction contains DNS-specific details for an interaction.
+type DNSInteraction struct {
+	InteractionID int64
+	QName         string
+	QType         int
+	QClass        int
+	RD            int
+	Opcode        int
+	DNSID         int
+	Protocol      string
+
+	// Response fields are nil until the response has been recorded.
+	ResponseRCode   *int
+	ResponseAnswers *string // JSON array of RRs in presentation format
+}
+
+// InteractionDetails is an interaction together with its HTTP or DNS
+// details, if it has them, and its attributes, as read in bulk for listings.
+type InteractionDetails struct {
+	Interaction
+	HTTP       *HTTPInteraction
+	DNS        *DNSInteraction
+	Attributes map[string]any
+}
+
+// StrayInteraction is traffic to the domain that carried no token, or one
+// that does not exist, as recorded in honeypot mode.
+type StrayInteraction struct {
+	ID         int64
+	Kind       string
+	OccurredAt int64
+	RemoteIP   string
+	RemotePort int
+	TLS        bool
+	Token      *string // nil if the traffic carried no token
+	Summary    string
+	Details    string // JSON object of the request's protocol fields
+	Body       []byte // the start of the request body or raw capture
+}
+
+// WebhookDelivery is an interaction queued for delivery to a webhook
+// endpoint.
+type WebhookDelivery struct {
+	ID            int64
+	Endpoint      string // the endpoint's name in the webhook configuration
+	InteractionID int64
+	Payload       []byte // the JSON body to post
+	Attempts      int    // failed attempts so far
+	NextAttemptAt int64
+	LastError     *string
+	CreatedAt     int64
+}
+
+// InteractshSession is an interactsh client's registration, mapped onto the
+// token whose value is its correlation ID.
+type InteractshSession struct {
+	CorrelationID string
+	TokenID       int64
+	SecretHash    []byte // SHA-256 of the client's secret key
+	PublicKey     []byte // PEM RSA public key poll responses are encrypted to
+	LastPolledID  int64  // newest interaction returned by a poll
+	CreatedAt     int64
+}
+
+// CollaboratorSession binds a token to the Burp Collaborator biid allowed to
+// poll it.
+type CollaboratorSession struct {
+	TokenID      int64
+	BIIDHash     []byte // SHA-256 of the biid
+	LastPolledID int64  // newest interaction returned by a poll
+	CreatedAt    int64
+}
+
+// ProtocolInteraction contains the details of an interaction over a protocol
+// without a dedicated table, such as SMTP or raw TCP.
+type ProtocolInteraction struct {
+	InteractionID int64
+	Raw           []byte
+	Fields        *string // JSON object of the fields parsed by the listener
+}
@@ -0,0 +1,199 @@
+// Package plugin defines the interfaces oastrix plugins implement and the
+// resources the server hands them. Plugins built outside the oastrix module,
+// as Go shared objects or as remote plugin processes, import it.
+package plugin
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/models"
+)
+
+// APIVersion is the version of the plugin interfaces. It changes whenever
+// they change incompatibly, so external plugins built against another
+// version can be refused.
+const APIVersion = 1
+
+// Plugin is the base interface all plugins must implement.
+type Plugin interface {
+	ID() string
+	Init(ctx InitContext) error
+}
+
+// InitContext provides access to shared resources during plugin initialization.
+type InitContext struct {
+	Logger    *zap.Logger
+	Store     Store
+	Config    GlobalConfigView
+	Tokens    TokenConfigView
+	Router    RouterRegistrar
+	Scheduler Scheduler
+}
+
+// Store provides storage operations for plugins. GetInteractionsByToken
+// returns a token's most recent interactions first, at most limit of them
+// unless limit is zero, so plugins can consult earlier interactions rather
+// than keep their own state.
+type Store interface {
+	ResolveTokenID(ctx context.Context, tokenValue string) (int64, bool, error)
+	CreateInteraction(ctx context.Context, draft *events.InteractionDraft) (int64, error)
+	SaveAttributes(ctx context.Context, interactionID int64, attrs map[string]any) error
+	GetInteractionsByToken(ctx context.Context, tokenID int64, limit int) ([]models.Interaction, error)
+	GetAttributes(ctx context.Context, interactionID int64) (map[string]any, error)
+}
+
+// ResponseStore is an optional Store extension that records the response
+// sent for a stored interaction.
+type ResponseStore interface {
+	SaveHTTPResponse(ctx context.Context, interactionID int64, resp *events.HTTPResponsePlan) error
+	SaveDNSResponse(ctx context.Context, interactionID int64, resp *events.DNSResponsePlan) error
+}
+
+// TokenTagStore is an optional Store extension that returns a token's tags,
+// for plugins that treat tokens differently by tag.
+type TokenTagStore interface {
+	TokenTags(ctx context.Context, tokenID int64) ([]string, error)
+}
+
+// RouterRegistrar allows plugins to register HTTP handlers. Patterns are
+// http.ServeMux patterns without a host, relative to a path reserved for the
+// plugin on the catcher; requests to them are not recorded as interactions.
+type RouterRegistrar interface {
+	Handle(pattern string, h http.Handler)
+}
+
+// Scheduler allows plugins to run periodic jobs, e.g. retention sweeps or
+// retrying deliveries. fn first runs one interval after the server starts
+// and is passed a context cancelled at shutdown. Errors are logged.
+type Scheduler interface {
+	Every(interval time.Duration, fn func(ctx context.Context) error)
+}
+
+// GlobalConfigView provides read access to global configuration. Get decodes
+// the server-wide configuration stored for the plugin ID key into out, leaving
+// out unchanged when none is stored, so plugins can preset their defaults.
+// Configuration can change while the server runs, so plugins should read it
+// when they use it rather than once at Init.
+type GlobalConfigView interface {
+	Get(key string, out any) error
+}
+
+// TokenConfigView provides read access to per-token plugin configuration.
+type TokenConfigView interface {
+	Get(ctx context.Context, tokenID int64, pluginID string, out any) (bool, error)
+}
+
+// PreStoreHook is called after token extraction, before persistence.
+type PreStoreHook interface {
+	OnPreStore(ctx context.Context, e *events.Event) error
+}
+
+// PostStoreHook is called after the interaction is persisted.
+type PostStoreHook interface {
+	OnPostStore(ctx context.Context, e *events.Event) error
+}
+
+// HTTPResponseHook is called before writing the HTTP response.
+type HTTPResponseHook interface {
+	OnHTTPResponse(ctx context.Context, e *events.HTTPEvent) error
+}
+
+// DNSResponseHook is called before writing the DNS response.
+type DNSResponseHook interface {
+	OnDNSResponse(ctx context.Context, e *events.DNSEvent) error
+}
+
+// ProtocolResponseHook is called before responding over a protocol without
+// a dedicated hook, such as SMTP or raw TCP.
+type ProtocolResponseHook interface {
+	OnProtocolResponse(ctx context.Context, e *events.GenericEvent) error
+}
+
+// PayloadContext describes the token a payload catalog is built for.
+type PayloadContext struct {
+	Token    string
+	Domain   string // token hostname is Token + "." + Domain
+	PublicIP string // empty when not configured
+}
+
+// Payload is a ready-to-paste string that causes an interaction with a token.
+type Payload struct {
+	Name        string // unique within the catalog, e.g. "log4j_dns"
+	Category    string // e.g. "dns", "http", "xss"
+	Description string
+	Value       string
+}
+
+// Flusher is an optional interface for plugins that queue work outside the
+// database, e.g. batches for a collector. Flush sends what is queued, within
+// ctx's deadline; it is called at shutdown once interactions stop arriving.
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// PayloadProvider is an optional interface for plugins that contribute
+// payloads to a token's catalog.
+type PayloadProvider interface {
+	Payloads(ctx PayloadContext) []Payload
+}
+
+// DefaultPriority is the priority of plugins that do not implement
+// PrioritizedPlugin.
+const DefaultPriority = 100
+
+// PrioritizedPlugin is an optional interface for plugins whose hooks must run
+// at a particular point relative to others. Hooks run in ascending priority,
+// with ties broken by plugin ID.
+type PrioritizedPlugin interface {
+	Priority() int
+}
+
+// TimeoutPlugin is an optional interface for plugins whose hooks need a
+// different deadline than the pipeline's hook timeout. Zero means none.
+type TimeoutPlugin interface {
+	HookTimeout() time.Duration
+}
+
+// ConfigurablePlugin is an optional interface for plugins that expose global configuration.
+type ConfigurablePlugin interface {
+	Config() map[string]any
+}
+
+// TokenConfigurablePlugin is an optional interface for plugins that read
+// per-token configuration. NewTokenConfig returns a pointer to a new zero
+// configuration for API requests to be decoded into; if it implements
+// Validator, values failing validation are rejected.
+type TokenConfigurablePlugin interface {
+	NewTokenConfig() any
+}
+
+// GlobalConfigurablePlugin is an optional interface for plugins that read
+// server-wide configuration through GlobalConfigView. NewGlobalConfig returns
+// a pointer to a new zero configuration for API requests to be decoded into;
+// if it implements Validator, values failing validation are rejected. String
+// fields tagged `secret:"true"` are redacted when the configuration is read
+// back through the API.
+type GlobalConfigurablePlugin interface {
+	NewGlobalConfig() any
+}
+
+// MigratingPlugin is an optional interface for plugins that keep data in
+// their own tables. Migrations returns the SQL migrations creating them,
+// named NNN_description.sql at the root of the file system. They are applied
+// in version order before Init, and versioned separately for each plugin ID.
+// Tables should be prefixed with the plugin ID.
+type MigratingPlugin interface {
+	Migrations() fs.FS
+}
+
+// Validator is implemented by plugin configuration types that check their
+// own values.
+type Validator interface {
+	Validate() error
+}
@@ -0,0 +1,299 @@
+// Package remote runs plugins as separate processes that serve the hook
+// interfaces over gRPC, so they can be written in any language or carry
+// dependencies the server should not link.
+//
+// The server starts the plugin executable with MagicCookieKey set in its
+// environment. The plugin listens on a local address and writes a single
+// handshake line to stdout:
+//
+//	<protocol version>|<network>|<address>|grpc
+//
+// e.g. "1|tcp|127.0.0.1:41234|grpc" or "1|unix|/tmp/plugin.sock|grpc", then
+// serves the service in plugin.proto on that address. Anything it writes to
+// stderr is logged. Go plugins can use Serve to do all of this.
+package remote
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/plugin"
+)
+
+// ProtocolVersion is the version of the handshake and service. It changes
+// whenever either changes incompatibly.
+const ProtocolVersion = 1
+
+// MagicCookieKey and MagicCookieValue are set in a plugin's environment so it
+// can tell it was started by the server rather than run directly.
+const (
+	MagicCookieKey   = "OASTRIX_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue = "6c1ef4a3d0b94e0f8a7b2d5c9e3f1a08"
+)
+
+// StartTimeout is how long a plugin has to complete the handshake and
+// describe itself.
+const StartTimeout = 10 * time.Second
+
+// Plugin is a plugin.Plugin backed by a plugin process. It implements every
+// hook interface but only calls the hooks the process advertised.
+type Plugin struct {
+	desc   Description
+	cmd    *exec.Cmd
+	conn   *grpc.ClientConn
+	logger *zap.Logger
+
+	closeOnce sync.Once
+	exited    chan struct{}
+}
+
+// Launch starts the plugin process cmd and connects to it, replacing its
+// stdout and stderr. The process is stopped if it cannot be connected to;
+// otherwise Close stops it.
+func Launch(cmd *exec.Cmd, logger *zap.Logger) (*Plugin, error) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, MagicCookieKey+"="+MagicCookieValue)
+
+	// Pipes rather than cmd.StdoutPipe, which Wait closes before the
+	// handshake may have been read.
+	stdout, stdoutW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, stderrW, err := os.Pipe()
+	if err != nil {
+		_ = stdout.Close()
+		_ = stdoutW.Close()
+		return nil, err
+	}
+	cmd.Stdout, cmd.Stderr = stdoutW, stderrW
+	err = cmd.Start()
+	_ = stdoutW.Close()
+	_ = stderrW.Close()
+	if err != nil {
+		_ = stdout.Close()
+		_ = stderr.Close()
+		return nil, fmt.Errorf("start plugin: %w", err)
+	}
+
+	p := &Plugin{cmd: cmd, logger: logger, exited: make(chan struct{})}
+	go logOutput(logger, stderr)
+	go func() {
+		_ = cmd.Wait()
+		close(p.exited)
+	}()
+
+	if err := p.connect(stdout); err != nil {
+		p.kill()
+		return nil, err
+	}
+	return p, nil
+}
+
+// connect completes the handshake read from stdout and describes the plugin.
+func (p *Plugin) connect(stdout io.ReadCloser) error {
+	lines := make(chan string, 1)
+	go func() {
+		defer stdout.Close()
+		r := bufio.NewReader(stdout)
+		line, _ := r.ReadString('\n')
+		lines <- line
+		// Drain anything else so the plugin never blocks writing to stdout.
+		_, _ = io.Copy(io.Discard, r)
+	}()
+
+	var line string
+	select {
+	case line = <-lines:
+		if line == "" {
+			return errors.New("plugin exited before the handshake")
+		}
+	case <-time.After(StartTimeout):
+		return errors.New("timed out waiting for the plugin handshake")
+	}
+
+	target, err := parseHandshake(line)
+	if err != nil {
+		return err
+	}
+	p.conn, err = grpc.NewClient(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("connect to plugin: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), StartTimeout)
+	defer cancel()
+	if err := invoke(ctx, p.conn, methodDescribe, struct{}{}, &p.desc); err != nil {
+		return fmt.Errorf("describe plugin: %w", err)
+	}
+	if p.desc.ID == "" {
+		return errors.New("plugin has an empty ID")
+	}
+	return nil
+}
+
+// parseHandshake returns the gRPC target announced by a handshake line.
+func parseHandshake(line string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 4 {
+		return "", fmt.Errorf("malformed handshake %q", strings.TrimSpace(line))
+	}
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("malformed handshake %q", strings.TrimSpace(line))
+	}
+	if version != ProtocolVersion {
+		return "", fmt.Errorf("plugin speaks protocol %d, want %d", version, ProtocolVersion)
+	}
+	if parts[3] != "grpc" {
+		return "", fmt.Errorf("unsupported plugin protocol %q", parts[3])
+	}
+	switch network, addr := parts[1], parts[2]; network {
+	case "tcp":
+		return "passthrough:///" + addr, nil
+	case "unix":
+		return "unix://" + addr, nil
+	default:
+		return "", fmt.Errorf("unsupported plugin network %q", network)
+	}
+}
+
+func logOutput(logger *zap.Logger, r io.ReadCloser) {
+	defer r.Close()
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		logger.Info("plugin output", zap.String("line", s.Text()))
+	}
+}
+
+// Close disconnects from the plugin and stops its process.
+func (p *Plugin) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		if p.conn != nil {
+			err = p.conn.Close()
+		}
+		p.kill()
+	})
+	return err
+}
+
+func (p *Plugin) kill() {
+	_ = p.cmd.Process.Kill()
+	<-p.exited
+}
+
+// ID returns the ID the plugin described itself with.
+func (p *Plugin) ID() string { return p.desc.ID }
+
+// Priority returns the priority the plugin described itself with, or
+// plugin.DefaultPriority.
+func (p *Plugin) Priority() int {
+	if p.desc.Priority == nil {
+		return plugin.DefaultPriority
+	}
+	return *p.desc.Priority
+}
+
+// Hooks returns the hooks the plugin advertised.
+func (p *Plugin) Hooks() []string { return p.desc.Hooks }
+
+// Init initializes the plugin with the given context.
+func (p *Plugin) Init(ctx plugin.InitContext) error {
+	p.logger = ctx.Logger.Named(p.desc.ID)
+	return nil
+}
+
+func (p *Plugin) has(hook string) bool { return slices.Contains(p.desc.Hooks, hook) }
+
+// OnPreStore calls the plugin's pre_store hook, applying the attributes it
+// sets and whether to drop the interaction.
+func (p *Plugin) OnPreStore(ctx context.Context, e *events.Event) error {
+	if !p.has(HookPreStore) {
+		return nil
+	}
+	var res Result
+	if err := invoke(ctx, p.conn, methodOnPreStore, Event{InteractionID: e.InteractionID, Draft: ToDraft(e.Draft)}, &res); err != nil {
+		return err
+	}
+	applyAttributes(e.Draft, res.Attributes)
+	if res.Drop != nil {
+		e.Draft.Drop = *res.Drop
+	}
+	return nil
+}
+
+// OnPostStore calls the plugin's post_store hook.
+func (p *Plugin) OnPostStore(ctx context.Context, e *events.Event) error {
+	if !p.has(HookPostStore) {
+		return nil
+	}
+	return invoke(ctx, p.conn, methodOnPostStore, Event{InteractionID: e.InteractionID, Draft: ToDraft(e.Draft)}, nil)
+}
+
+// OnHTTPResponse calls the plugin's http_response hook, applying the
+// response it returns.
+func (p *Plugin) OnHTTPResponse(ctx context.Context, e *events.HTTPEvent) error {
+	if !p.has(HookHTTPResponse) || e.Draft == nil {
+		return nil
+	}
+	in := Event{InteractionID: e.InteractionID, Draft: ToDraft(e.Draft), HTTPResponse: ToHTTPResponse(e.Resp)}
+	var res Result
+	if err := invoke(ctx, p.conn, methodOnHTTPResponse, in, &res); err != nil {
+		return err
+	}
+	if res.HTTPResponse != nil {
+		e.Resp = res.HTTPResponse.Plan()
+	}
+	return nil
+}
+
+// OnDNSResponse calls the plugin's dns_response hook, applying the response
+// it returns.
+func (p *Plugin) OnDNSResponse(ctx context.Context, e *events.DNSEvent) error {
+	if !p.has(HookDNSResponse) || e.Draft == nil {
+		return nil
+	}
+	in := Event{InteractionID: e.InteractionID, Draft: ToDraft(e.Draft), QNameRaw: e.QNameRaw, DNSResponse: ToDNSResponse(e.Resp)}
+	var res Result
+	if err := invoke(ctx, p.conn, methodOnDNSResponse, in, &res); err != nil {
+		return err
+	}
+	if res.DNSResponse != nil {
+		plan, err := res.DNSResponse.Plan()
+		if err != nil {
+			return err
+		}
+		e.Resp = plan
+	}
+	return nil
+}
+
+func applyAttributes(d *events.InteractionDraft, attrs map[string]any) {
+	if len(attrs) == 0 {
+		return
+	}
+	if d.Attributes == nil {
+		d.Attributes = make(map[string]any, len(attrs))
+	}
+	for k, v := range attrs {
+		d.Attributes[k] = v
+	}
+}
@@ -0,0 +1,207 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"go.uber.org/zap"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/plugin"
+)
+
+// helperEnv makes the test binary act as a plugin process in
+// TestHelperProcess.
+const helperEnv = "OASTRIX_REMOTE_TEST_HELPER"
+
+// echoPlugin tags interactions and answers HTTP and DNS requests.
+type echoPlugin struct{}
+
+func (echoPlugin) ID() string                      { return "echo" }
+func (echoPlugin) Priority() int                   { return 15 }
+func (echoPlugin) Init(_ plugin.InitContext) error { return nil }
+
+func (echoPlugin) OnPreStore(_ context.Context, e *events.Event) error {
+	if e.Draft.Attributes == nil {
+		e.Draft.Attributes = make(map[string]any)
+	}
+	e.Draft.Attributes["echo"] = e.Draft.TokenValue
+	e.Draft.Drop = e.Draft.RemoteIP == "192.0.2.99"
+	return nil
+}
+
+func (echoPlugin) OnHTTPResponse(_ context.Context, e *events.HTTPEvent) error {
+	e.Resp.Status = 418
+	e.Resp.Headers["X-Echo"] = e.Draft.HTTP.Path
+	e.Resp.Body = e.Draft.HTTP.Body
+	e.Resp.Handled = true
+	return nil
+}
+
+func (echoPlugin) OnDNSResponse(_ context.Context, e *events.DNSEvent) error {
+	rr, err := dns.NewRR(e.Draft.DNS.QName + " 60 IN A 192.0.2.1")
+	if err != nil {
+		return err
+	}
+	e.Resp.Answers = append(e.Resp.Answers, rr)
+	e.Resp.Handled = true
+	return nil
+}
+
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv(helperEnv) != "1" {
+		t.Skip("run as a plugin process by other tests")
+	}
+	if err := Serve(echoPlugin{}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func launch(t *testing.T) *Plugin {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), helperEnv+"=1")
+	p, err := Launch(cmd, zap.NewNop())
+	if err != nil {
+		t.Fatalf("Launch failed: %v", err)
+	}
+	t.Cleanup(func() { _ = p.Close() })
+	if err := p.Init(plugin.InitContext{Logger: zap.NewNop()}); err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	return p
+}
+
+func TestDescribe(t *testing.T) {
+	p := launch(t)
+	if p.ID() != "echo" || p.Priority() != 15 {
+		t.Errorf("ID, Priority = %q, %d; want echo, 15", p.ID(), p.Priority())
+	}
+	want := []string{HookPreStore, HookHTTPResponse, HookDNSResponse}
+	if got := p.Hooks(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Hooks = %v, want %v", got, want)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	p := launch(t)
+	ctx := context.Background()
+
+	t.Run("pre_store", func(t *testing.T) {
+		for _, tt := range []struct {
+			remoteIP string
+			wantDrop bool
+		}{{"192.0.2.10", false}, {"192.0.2.99", true}} {
+			e := &events.Event{Draft: &events.InteractionDraft{
+				TokenValue: "tok", TokenID: 1700000000123, OccurredAt: 1700000000, RemoteIP: tt.remoteIP,
+				Attributes: map[string]any{"existing": true},
+			}}
+			if err := p.OnPreStore(ctx, e); err != nil {
+				t.Fatalf("OnPreStore failed: %v", err)
+			}
+			if e.Draft.Attributes["echo"] != "tok" || e.Draft.Attributes["existing"] != true {
+				t.Errorf("attributes = %v", e.Draft.Attributes)
+			}
+			if e.Draft.Drop != tt.wantDrop {
+				t.Errorf("drop = %v, want %v", e.Draft.Drop, tt.wantDrop)
+			}
+		}
+	})
+
+	t.Run("post_store not advertised", func(t *testing.T) {
+		e := &events.Event{Draft: &events.InteractionDraft{TokenValue: "tok"}}
+		if err := p.OnPostStore(ctx, e); err != nil {
+			t.Errorf("OnPostStore failed: %v", err)
+		}
+	})
+
+	t.Run("http_response", func(t *testing.T) {
+		e := &events.HTTPEvent{
+			Event: events.Event{Draft: &events.InteractionDraft{
+				TokenValue: "tok", Kind: events.KindHTTP,
+				HTTP: &events.HTTPDraft{Method: "POST", Path: "/x", Body: []byte{0, 1, 0xff}},
+			}},
+			Resp: &events.HTTPResponsePlan{Status: 200, Headers: map[string]string{}},
+		}
+		if err := p.OnHTTPResponse(ctx, e); err != nil {
+			t.Fatalf("OnHTTPResponse failed: %v", err)
+		}
+		if e.Resp.Status != 418 || !e.Resp.Handled || e.Resp.Headers["X-Echo"] != "/x" || string(e.Resp.Body) != "\x00\x01\xff" {
+			t.Errorf("response = %+v", e.Resp)
+		}
+	})
+
+	t.Run("dns_response", func(t *testing.T) {
+		e := &events.DNSEvent{
+			Event: events.Event{Draft: &events.InteractionDraft{
+				TokenValue: "tok", Kind: events.KindDNS,
+				DNS: &events.DNSDraft{QName: "tok.oastrix.example.com.", QType: int(dns.TypeA)},
+			}},
+			Resp: &events.DNSResponsePlan{},
+		}
+		if err := p.OnDNSResponse(ctx, e); err != nil {
+			t.Fatalf("OnDNSResponse failed: %v", err)
+		}
+		if !e.Resp.Handled || len(e.Resp.Answers) != 1 {
+			t.Fatalf("response = %+v", e.Resp)
+		}
+		if a, ok := e.Resp.Answers[0].(*dns.A); !ok || a.A.String() != "192.0.2.1" {
+			t.Errorf("answer = %v", e.Resp.Answers[0])
+		}
+	})
+}
+
+func TestLaunchFailures(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  *exec.Cmd
+		want string
+	}{
+		{"exits", exec.Command("true"), "exited before the handshake"},
+		{"bad handshake", exec.Command("echo", "hello"), "malformed handshake"},
+		{"wrong version", exec.Command("echo", "99|tcp|127.0.0.1:1|grpc"), "protocol 99"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Launch(tt.cmd, zap.NewNop())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseHandshake(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    string
+		wantErr bool
+	}{
+		{"1|tcp|127.0.0.1:4000|grpc\n", "passthrough:///127.0.0.1:4000", false},
+		{"1|unix|/tmp/p.sock|grpc", "unix:///tmp/p.sock", false},
+		{"1|udp|127.0.0.1:4000|grpc", "", true},
+		{"1|tcp|127.0.0.1:4000|netrpc", "", true},
+		{"1|tcp|127.0.0.1:4000", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseHandshake(tt.line)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseHandshake(%q) = %q, %v; want %q, error %v", tt.line, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestServeRequiresLaunch(t *testing.T) {
+	t.Setenv(MagicCookieKey, "")
+	if err := Serve(echoPlugin{}); err != ErrNotLaunched {
+		t.Errorf("Serve = %v, want ErrNotLaunched", err)
+	}
+}
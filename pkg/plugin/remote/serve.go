@@ -0,0 +1,138 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+	"github.com/rsclarke/oastrix/pkg/plugin"
+)
+
+// ErrNotLaunched is returned by Serve when the process was not started by
+// the server.
+var ErrNotLaunched = errors.New("this is an oastrix plugin: load it with the server's --remote-plugin flag")
+
+// Serve serves p as a plugin process, for the main function of a Go plugin
+// executable. It initializes p with a logger writing to stderr, completes
+// the handshake on stdout and serves until the process is stopped. Hooks
+// receive events without the underlying *http.Request or *dns.Msg.
+func Serve(p plugin.Plugin) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return ErrNotLaunched
+	}
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return err
+	}
+	if err := p.Init(plugin.InitContext{Logger: logger}); err != nil {
+		return fmt.Errorf("init plugin: %w", err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	return serve(p, lis, os.Stdout)
+}
+
+// serve announces lis on w and serves p on it.
+func serve(p plugin.Plugin, lis net.Listener, w io.Writer) error {
+	srv := grpc.NewServer()
+	srv.RegisterService(serviceDesc(pluginHandlers(p)), nil)
+
+	if _, err := fmt.Fprintf(w, "%d|%s|%s|grpc\n", ProtocolVersion, lis.Addr().Network(), lis.Addr().String()); err != nil {
+		return err
+	}
+	return srv.Serve(lis)
+}
+
+// pluginHandlers adapts p's hooks to the service methods.
+func pluginHandlers(p plugin.Plugin) handlers {
+	desc := Description{ID: p.ID(), Hooks: []string{}}
+	if pp, ok := p.(plugin.PrioritizedPlugin); ok {
+		priority := pp.Priority()
+		desc.Priority = &priority
+	}
+
+	h := handlers{
+		methodDescribe: func(context.Context, *structpb.Struct) (*structpb.Struct, error) {
+			return encode(desc)
+		},
+	}
+
+	if hook, ok := p.(plugin.PreStoreHook); ok {
+		desc.Hooks = append(desc.Hooks, HookPreStore)
+		h[methodOnPreStore] = eventHandler(func(ctx context.Context, in Event) (Result, error) {
+			e := &events.Event{Draft: in.Draft.draft(), InteractionID: in.InteractionID}
+			if err := hook.OnPreStore(ctx, e); err != nil {
+				return Result{}, err
+			}
+			return Result{Attributes: e.Draft.Attributes, Drop: &e.Draft.Drop}, nil
+		})
+	}
+	if hook, ok := p.(plugin.PostStoreHook); ok {
+		desc.Hooks = append(desc.Hooks, HookPostStore)
+		h[methodOnPostStore] = eventHandler(func(ctx context.Context, in Event) (Result, error) {
+			e := &events.Event{Draft: in.Draft.draft(), InteractionID: in.InteractionID}
+			return Result{}, hook.OnPostStore(ctx, e)
+		})
+	}
+	if hook, ok := p.(plugin.HTTPResponseHook); ok {
+		desc.Hooks = append(desc.Hooks, HookHTTPResponse)
+		h[methodOnHTTPResponse] = eventHandler(func(ctx context.Context, in Event) (Result, error) {
+			e := &events.HTTPEvent{
+				Event: events.Event{Draft: in.Draft.draft(), InteractionID: in.InteractionID},
+			}
+			if in.HTTPResponse != nil {
+				e.Resp = in.HTTPResponse.Plan()
+			}
+			if err := hook.OnHTTPResponse(ctx, e); err != nil {
+				return Result{}, err
+			}
+			return Result{HTTPResponse: ToHTTPResponse(e.Resp)}, nil
+		})
+	}
+	if hook, ok := p.(plugin.DNSResponseHook); ok {
+		desc.Hooks = append(desc.Hooks, HookDNSResponse)
+		h[methodOnDNSResponse] = eventHandler(func(ctx context.Context, in Event) (Result, error) {
+			e := &events.DNSEvent{
+				Event:    events.Event{Draft: in.Draft.draft(), InteractionID: in.InteractionID},
+				QNameRaw: in.QNameRaw,
+			}
+			if in.DNSResponse != nil {
+				plan, err := in.DNSResponse.Plan()
+				if err != nil {
+					return Result{}, err
+				}
+				e.Resp = plan
+			}
+			if err := hook.OnDNSResponse(ctx, e); err != nil {
+				return Result{}, err
+			}
+			return Result{DNSResponse: ToDNSResponse(e.Resp)}, nil
+		})
+	}
+	return h
+}
+
+func eventHandler(fn func(context.Context, Event) (Result, error)) func(context.Context, *structpb.Struct) (*structpb.Struct, error) {
+	return func(ctx context.Context, s *structpb.Struct) (*structpb.Struct, error) {
+		var in Event
+		if err := decode(s, &in); err != nil {
+			return nil, err
+		}
+		res, err := fn(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		return encode(res)
+	}
+}
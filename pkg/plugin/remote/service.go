@@ -0,0 +1,70 @@
+package remote
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// serviceName is the fully-qualified gRPC service in plugin.proto.
+const serviceName = "oastrix.plugin.v1.Plugin"
+
+// RPC method names.
+const (
+	methodDescribe       = "Describe"
+	methodOnPreStore     = "OnPreStore"
+	methodOnPostStore    = "OnPostStore"
+	methodOnHTTPResponse = "OnHTTPResponse"
+	methodOnDNSResponse  = "OnDNSResponse"
+)
+
+// handlers implements the service: each method takes and returns a Struct.
+type handlers map[string]func(context.Context, *structpb.Struct) (*structpb.Struct, error)
+
+// serviceDesc describes the service for a grpc.Server, as protoc-gen-go-grpc
+// would generate from plugin.proto.
+func serviceDesc(h handlers) *grpc.ServiceDesc {
+	desc := &grpc.ServiceDesc{
+		ServiceName: serviceName,
+		HandlerType: (*any)(nil),
+		Metadata:    "plugin.proto",
+	}
+	for name, fn := range h {
+		fullMethod := "/" + serviceName + "/" + name
+		desc.Methods = append(desc.Methods, grpc.MethodDesc{
+			MethodName: name,
+			Handler: func(_ any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				in := new(structpb.Struct)
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return fn(ctx, in)
+				}
+				info := &grpc.UnaryServerInfo{FullMethod: fullMethod}
+				return interceptor(ctx, in, info, func(ctx context.Context, req any) (any, error) {
+					return fn(ctx, req.(*structpb.Struct))
+				})
+			},
+		})
+	}
+	return desc
+}
+
+// invoke calls method on conn with the wire document in and decodes the
+// reply into out.
+func invoke(ctx context.Context, conn *grpc.ClientConn, method string, in, out any) error {
+	req, err := encode(in)
+	if err != nil {
+		return err
+	}
+	resp := new(structpb.Struct)
+	if err := conn.Invoke(ctx, "/"+serviceName+"/"+method, req, resp); err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return decode(resp, out)
+}
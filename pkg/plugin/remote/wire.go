@@ -0,0 +1,229 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/miekg/dns"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"github.com/rsclarke/oastrix/pkg/events"
+)
+
+// Hook names advertised by Describe.
+const (
+	HookPreStore     = "pre_store"
+	HookPostStore    = "post_store"
+	HookHTTPResponse = "http_response"
+	HookDNSResponse  = "dns_response"
+)
+
+// Description is the document returned by Describe.
+type Description struct {
+	ID       string   `json:"id"`
+	Priority *int     `json:"priority,omitempty"`
+	Hooks    []string `json:"hooks"`
+}
+
+// Event is the document sent to each hook. Byte slices are base64 encoded.
+// HTTPResponse is only set for the http_response hook and DNSResponse for
+// the dns_response hook.
+type Event struct {
+	InteractionID int64         `json:"interaction_id,omitempty"`
+	Draft         Draft         `json:"draft"`
+	QNameRaw      string        `json:"qname_raw,omitempty"`
+	HTTPResponse  *HTTPResponse `json:"http_response,omitempty"`
+	DNSResponse   *DNSResponse  `json:"dns_response,omitempty"`
+}
+
+// Result is the document a hook returns: the attributes to set and, from
+// pre_store, whether to drop the interaction, or from a response hook, the
+// response to send. Omitted fields leave the event unchanged.
+type Result struct {
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Drop         *bool          `json:"drop,omitempty"`
+	HTTPResponse *HTTPResponse  `json:"http_response,omitempty"`
+	DNSResponse  *DNSResponse   `json:"dns_response,omitempty"`
+}
+
+// Draft mirrors events.InteractionDraft.
+type Draft struct {
+	Token      string         `json:"token"`
+	TokenID    int64          `json:"token_id,omitempty"`
+	Kind       events.Kind    `json:"kind"`
+	OccurredAt int64          `json:"occurred_at"`
+	RemoteIP   string         `json:"remote_ip"`
+	RemotePort int            `json:"remote_port"`
+	TLS        bool           `json:"tls"`
+	Summary    string         `json:"summary"`
+	HTTP       *HTTPDraft     `json:"http,omitempty"`
+	DNS        *DNSDraft      `json:"dns,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Drop       bool           `json:"drop,omitempty"`
+}
+
+// HTTPDraft mirrors events.HTTPDraft.
+type HTTPDraft struct {
+	Method  string              `json:"method"`
+	Scheme  string              `json:"scheme"`
+	Host    string              `json:"host"`
+	Path    string              `json:"path"`
+	Query   string              `json:"query"`
+	Proto   string              `json:"proto"`
+	Headers map[string][]string `json:"headers"`
+	Body    []byte              `json:"body,omitempty"`
+}
+
+// DNSDraft mirrors events.DNSDraft.
+type DNSDraft struct {
+	QName    string `json:"qname"`
+	QType    int    `json:"qtype"`
+	QClass   int    `json:"qclass"`
+	RD       int    `json:"rd"`
+	Opcode   int    `json:"opcode"`
+	DNSID    int    `json:"dns_id"`
+	Protocol string `json:"protocol"`
+}
+
+// HTTPResponse mirrors events.HTTPResponsePlan.
+type HTTPResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    []byte            `json:"body,omitempty"`
+	Handled bool              `json:"handled"`
+}
+
+// DNSResponse mirrors events.DNSResponsePlan, with answers in zone file
+// format, e.g. "example.com. 60 IN A 192.0.2.1".
+type DNSResponse struct {
+	RCode   int      `json:"rcode"`
+	Answers []string `json:"answers,omitempty"`
+	Handled bool     `json:"handled"`
+}
+
+// ToDraft converts an interaction draft to its wire document.
+func ToDraft(d *events.InteractionDraft) Draft {
+	w := Draft{
+		Token:      d.TokenValue,
+		TokenID:    d.TokenID,
+		Kind:       d.Kind,
+		OccurredAt: d.OccurredAt,
+		RemoteIP:   d.RemoteIP,
+		RemotePort: d.RemotePort,
+		TLS:        d.TLS,
+		Summary:    d.Summary,
+		Attributes: d.Attributes,
+		Drop:       d.Drop,
+	}
+	if h := d.HTTP; h != nil {
+		w.HTTP = &HTTPDraft{
+			Method: h.Method, Scheme: h.Scheme, Host: h.Host, Path: h.Path,
+			Query: h.Query, Proto: h.Proto, Headers: h.Headers, Body: h.Body,
+		}
+	}
+	if q := d.DNS; q != nil {
+		w.DNS = &DNSDraft{
+			QName: q.QName, QType: q.QType, QClass: q.QClass, RD: q.RD,
+			Opcode: q.Opcode, DNSID: q.DNSID, Protocol: q.Protocol,
+		}
+	}
+	return w
+}
+
+func (w Draft) draft() *events.InteractionDraft {
+	d := &events.InteractionDraft{
+		TokenValue: w.Token,
+		TokenID:    w.TokenID,
+		Kind:       w.Kind,
+		OccurredAt: w.OccurredAt,
+		RemoteIP:   w.RemoteIP,
+		RemotePort: w.RemotePort,
+		TLS:        w.TLS,
+		Summary:    w.Summary,
+		Attributes: w.Attributes,
+		Drop:       w.Drop,
+	}
+	if h := w.HTTP; h != nil {
+		d.HTTP = &events.HTTPDraft{
+			Method: h.Method, Scheme: h.Scheme, Host: h.Host, Path: h.Path,
+			Query: h.Query, Proto: h.Proto, Headers: h.Headers, Body: h.Body,
+		}
+	}
+	if q := w.DNS; q != nil {
+		d.DNS = &events.DNSDraft{
+			QName: q.QName, QType: q.QType, QClass: q.QClass, RD: q.RD,
+			Opcode: q.Opcode, DNSID: q.DNSID, Protocol: q.Protocol,
+		}
+	}
+	return d
+}
+
+// ToHTTPResponse converts an HTTP response plan to its wire document, or
+// returns nil if there is none.
+func ToHTTPResponse(r *events.HTTPResponsePlan) *HTTPResponse {
+	if r == nil {
+		return nil
+	}
+	return &HTTPResponse{Status: r.Status, Headers: r.Headers, Body: r.Body, Handled: r.Handled}
+}
+
+// Plan converts the wire document back to an HTTP response plan.
+func (w *HTTPResponse) Plan() *events.HTTPResponsePlan {
+	p := &events.HTTPResponsePlan{Status: w.Status, Headers: w.Headers, Body: w.Body, Handled: w.Handled}
+	if p.Headers == nil {
+		p.Headers = make(map[string]string)
+	}
+	return p
+}
+
+// ToDNSResponse converts a DNS response plan to its wire document, or
+// returns nil if there is none.
+func ToDNSResponse(r *events.DNSResponsePlan) *DNSResponse {
+	if r == nil {
+		return nil
+	}
+	w := &DNSResponse{RCode: r.RCode, Handled: r.Handled}
+	for _, rr := range r.Answers {
+		w.Answers = append(w.Answers, rr.String())
+	}
+	return w
+}
+
+// Plan converts the wire document back to a DNS response plan, failing if
+// an answer does not parse.
+func (w *DNSResponse) Plan() (*events.DNSResponsePlan, error) {
+	p := &events.DNSResponsePlan{RCode: w.RCode, Handled: w.Handled}
+	for _, s := range w.Answers {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid answer %q: %w", s, err)
+		}
+		if rr != nil {
+			p.Answers = append(p.Answers, rr)
+		}
+	}
+	return p, nil
+}
+
+// encode converts a wire document to the Struct carried over gRPC.
+func encode(v any) (*structpb.Struct, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s := new(structpb.Struct)
+	if err := protojson.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// decode converts a Struct received over gRPC to a wire document.
+func decode(s *structpb.Struct, v any) error {
+	b, err := protojson.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}